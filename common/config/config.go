@@ -495,6 +495,111 @@ var (
 	ConversationRateLimitDuration = int64(env.Int("CONVERSATION_RATE_LIMIT_DURATION", 60))
 )
 
+// =============================================================================
+// FILES & BATCH API
+// =============================================================================
+// Settings for the OpenAI-compatible /v1/files store and the local /v1/batches
+// executor, which replays every JSONL line through the normal relay pipeline.
+
+var (
+	// FileMaxBytes caps the size of a single file uploaded to /v1/files. Files
+	// are stored in the primary database, so keep this bounded.
+	//
+	// Environment variable: FILE_MAX_BYTES
+	// Default: 100 MiB
+	FileMaxBytes = int64(env.Int("FILE_MAX_BYTES", 100<<20))
+
+	// BatchWorkerEnabled starts the background executor that runs queued
+	// batches. Disable it on replicas that should only serve the API; any node
+	// with the worker enabled picks up pending batches.
+	//
+	// Environment variable: BATCH_WORKER_ENABLED
+	// Default: true
+	BatchWorkerEnabled = env.Bool("BATCH_WORKER_ENABLED", true)
+
+	// BatchWorkerPollIntervalSec is how often the executor looks for batches to
+	// claim.
+	//
+	// Environment variable: BATCH_WORKER_POLL_INTERVAL
+	// Default: 10 seconds
+	BatchWorkerPollIntervalSec = env.Int("BATCH_WORKER_POLL_INTERVAL", 10)
+
+	// BatchWorkerConcurrency bounds how many lines of one batch are relayed in
+	// parallel.
+	//
+	// Environment variable: BATCH_WORKER_CONCURRENCY
+	// Default: 4
+	BatchWorkerConcurrency = env.Int("BATCH_WORKER_CONCURRENCY", 4)
+
+	// BatchMaxRequests caps the number of JSONL lines accepted in one batch.
+	//
+	// Environment variable: BATCH_MAX_REQUESTS
+	// Default: 50000
+	BatchMaxRequests = env.Int("BATCH_MAX_REQUESTS", 50000)
+
+	// BatchDiscountRatio multiplies the group ratio of every request executed on
+	// behalf of a batch, e.g. 0.5 bills batch traffic at half price. Values
+	// outside (0, 1] are treated as 1 (no discount).
+	//
+	// Environment variable: BATCH_DISCOUNT_RATIO
+	// Default: 1
+	BatchDiscountRatio = func() float64 {
+		v := env.Float64("BATCH_DISCOUNT_RATIO", 1)
+		if v <= 0 || v > 1 {
+			return 1
+		}
+		return v
+	}()
+)
+
+// =============================================================================
+// RESPONSE CACHE
+// =============================================================================
+// Settings for the opt-in exact-match cache of deterministic relay responses:
+// embeddings and temperature-0 chat completions. Entries live in Redis when it
+// is enabled and in process memory otherwise.
+
+var (
+	// ResponseCacheEnabled turns on the exact-match response cache.
+	//
+	// Environment variable: RESPONSE_CACHE_ENABLED
+	// Default: false
+	ResponseCacheEnabled = env.Bool("RESPONSE_CACHE_ENABLED", false)
+
+	// ResponseCacheTTLSec is how long a cached response stays valid.
+	//
+	// Environment variable: RESPONSE_CACHE_TTL
+	// Default: 3600 seconds
+	ResponseCacheTTLSec = env.Int("RESPONSE_CACHE_TTL", 3600)
+
+	// ResponseCacheMaxEntries bounds the in-memory cache; the least recently
+	// used entry is evicted first. Redis relies on TTL expiry instead.
+	//
+	// Environment variable: RESPONSE_CACHE_MAX_ENTRIES
+	// Default: 10000
+	ResponseCacheMaxEntries = env.Int("RESPONSE_CACHE_MAX_ENTRIES", 10000)
+
+	// ResponseCacheMaxEntryBytes skips caching responses whose body is larger.
+	//
+	// Environment variable: RESPONSE_CACHE_MAX_ENTRY_BYTES
+	// Default: 1 MiB
+	ResponseCacheMaxEntryBytes = env.Int("RESPONSE_CACHE_MAX_ENTRY_BYTES", 1<<20)
+
+	// ResponseCacheHitRatio multiplies the group ratio of a request served from
+	// the cache, e.g. 0.1 bills a hit at a tenth of the model price. Values
+	// outside [0, 1] are treated as 1 (full price).
+	//
+	// Environment variable: RESPONSE_CACHE_HIT_RATIO
+	// Default: 0.1
+	ResponseCacheHitRatio = func() float64 {
+		v := env.Float64("RESPONSE_CACHE_HIT_RATIO", 0.1)
+		if v < 0 || v > 1 {
+			return 1
+		}
+		return v
+	}()
+)
+
 // =============================================================================
 // CHANNEL MANAGEMENT
 // =============================================================================
@@ -574,6 +679,30 @@ var (
 	// Default: false
 	AutomaticEnableChannelEnabled = false
 
+	// ChannelHealthWindow is how many recent relay outcomes are kept per
+	// (channel, model) pair to compute its health score.
+	//
+	// Environment variable: CHANNEL_HEALTH_WINDOW
+	// Default: 100
+	ChannelHealthWindow = env.Int("CHANNEL_HEALTH_WINDOW", 100)
+
+	// ChannelHealthMinSamples is how many outcomes a (channel, model) pair needs
+	// before its health score affects routing.
+	//
+	// Environment variable: CHANNEL_HEALTH_MIN_SAMPLES
+	// Default: 20
+	ChannelHealthMinSamples = env.Int("CHANNEL_HEALTH_MIN_SAMPLES", 20)
+
+	// ChannelHealthMaxAdjustment caps how far the health score may lower a
+	// channel's configured weight: a channel keeps at least (1 - value) of its
+	// weight however unhealthy it is. 0 disables health-aware routing.
+	//
+	// Runtime variable (set via admin UI)
+	// Environment variable: CHANNEL_HEALTH_MAX_ADJUSTMENT
+	// Default: 0.5
+	// Range: 0.0 to 1.0
+	ChannelHealthMaxAdjustment = env.Float64("CHANNEL_HEALTH_MAX_ADJUSTMENT", 0.5)
+
 	// SyncFrequency controls how frequently option/channel caches refresh from
 	// the database. Set to 0 to disable automatic syncing.
 	//
@@ -592,7 +721,7 @@ var (
 
 var (
 	// RateLimitDisabled turns off ALL rate limiting (global web/API/relay,
-	// critical, upload/download, per-channel, low-balance relay, and TOTP) when
+	// critical, upload/download, per-channel, per-token, low-balance relay, and TOTP) when
 	// RATE_LIMIT_DISABLED=true. This is a behavioral toggle intended for local
 	// development and tests; it is deliberately independent of DEBUG so that
 	// DEBUG only affects logging and never changes runtime behavior.
@@ -814,6 +943,25 @@ var (
 	// Runtime variable (set via admin UI)
 	// Default: 1000
 	QuotaRemindThreshold int64 = 1000
+
+	// BudgetNotifyPercents lists the shares of a token or user spend budget, in
+	// percent, at which the owner is emailed once per budget window. Entries
+	// outside 1-100 are ignored; an empty list disables the notifications.
+	//
+	// Environment variable: BUDGET_NOTIFY_PERCENTS
+	// Default: "80,100"
+	BudgetNotifyPercents = func() []int {
+		var percents []int
+		for _, field := range strings.Split(env.String("BUDGET_NOTIFY_PERCENTS", "80,100"), ",") {
+			v, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || v < 1 || v > 100 || slices.Contains(percents, v) {
+				continue
+			}
+			percents = append(percents, v)
+		}
+		slices.Sort(percents)
+		return percents
+	}()
 )
 
 // =============================================================================
@@ -863,6 +1011,31 @@ var (
 	// Unit: rounds
 	MCPMaxToolRounds = env.Int("MCP_MAX_TOOL_ROUNDS", 10)
 
+	// StructuredOutputEmulationMaxRepairs bounds how many repair requests the
+	// gateway sends when an emulated structured output fails schema validation.
+	//
+	// Environment variable: STRUCTURED_OUTPUT_EMULATION_MAX_REPAIRS
+	// Default: 1
+	// Unit: upstream requests
+	StructuredOutputEmulationMaxRepairs = env.Int("STRUCTURED_OUTPUT_EMULATION_MAX_REPAIRS", 1)
+
+	// ContextSummaryModel is the model that condenses the oldest turns of an
+	// oversized conversation when a token or request selects the summarize
+	// context strategy. The call is relayed and billed as the client's token.
+	// Without it, summarize falls back to truncate.
+	//
+	// Environment variable: CONTEXT_SUMMARY_MODEL
+	// Default: "" (summarize behaves like truncate)
+	// Example: "gpt-4o-mini"
+	ContextSummaryModel = strings.TrimSpace(env.String("CONTEXT_SUMMARY_MODEL", ""))
+
+	// ContextSummaryMaxTokens bounds the length of a context summary.
+	//
+	// Environment variable: CONTEXT_SUMMARY_MAX_TOKENS
+	// Default: 1024
+	// Unit: tokens
+	ContextSummaryMaxTokens = env.Int("CONTEXT_SUMMARY_MAX_TOKENS", 1024)
+
 	// MCPToolCallTimeoutSec limits how long one-api will wait for a single MCP tool call.
 	//
 	// Environment variable: MCP_TOOL_CALL_TIMEOUT
@@ -1125,6 +1298,36 @@ var (
 		return v
 	}()
 
+	// CaptureRetentionDays controls how long request captures are kept before
+	// the retention worker removes them. Set to 0 to disable cleanup.
+	//
+	// Environment variable: CAPTURE_RETENTION_DAYS
+	// Default: 7 days
+	// Unit: days
+	CaptureRetentionDays = func() int {
+		v := env.Int("CAPTURE_RETENTION_DAYS", 7)
+		if v < 0 {
+			return 0
+		}
+		return v
+	}()
+
+	// StatementFreezeEnabled runs the worker that stores each user, token and
+	// organization statement once its calendar month (UTC) has closed, so
+	// statements survive log retention. Only master nodes run it.
+	//
+	// Environment variable: STATEMENT_FREEZE_ENABLED
+	// Default: true
+	StatementFreezeEnabled = env.Bool("STATEMENT_FREEZE_ENABLED", true)
+
+	// CaptureMaxBodyBytes caps each body stored by a request capture (inbound
+	// request, upstream request and response). Longer bodies are truncated.
+	//
+	// Environment variable: CAPTURE_MAX_BODY_BYTES
+	// Default: 262144 (256 KiB)
+	// Unit: bytes
+	CaptureMaxBodyBytes = env.Int("CAPTURE_MAX_BODY_BYTES", 256*1024)
+
 	// LogPushAPI defines the webhook endpoint for escalated log alerts.
 	// Leave empty to disable log push.
 	//
@@ -1147,6 +1350,97 @@ var (
 	// Environment variable: LOG_PUSH_TOKEN
 	// Default: "" (no authentication)
 	LogPushToken = env.String("LOG_PUSH_TOKEN", "")
+
+	// UsageExportWebhookURL receives every billed request as a usage event,
+	// POSTed in JSON batches. Leave empty to disable the webhook sink.
+	//
+	// Environment variable: USAGE_EXPORT_WEBHOOK_URL
+	// Default: "" (disabled)
+	UsageExportWebhookURL = strings.TrimSpace(env.String("USAGE_EXPORT_WEBHOOK_URL", ""))
+
+	// UsageExportWebhookSecret signs webhook batches with HMAC-SHA256 so the
+	// receiver can verify them. Required when USAGE_EXPORT_WEBHOOK_URL is set;
+	// startup fails without it.
+	//
+	// Environment variable: USAGE_EXPORT_WEBHOOK_SECRET
+	// Default: "" (webhook sink refuses to start)
+	UsageExportWebhookSecret = env.String("USAGE_EXPORT_WEBHOOK_SECRET", "")
+
+	// UsageExportFileDir is the directory that receives usage events as NDJSON
+	// files rotated daily and by size. Leave empty to disable the file sink.
+	//
+	// Environment variable: USAGE_EXPORT_FILE_DIR
+	// Default: "" (disabled)
+	UsageExportFileDir = strings.TrimSpace(env.String("USAGE_EXPORT_FILE_DIR", ""))
+
+	// UsageExportFileMaxMB starts a new NDJSON file once the current one reaches
+	// this size. 0 rotates only when the UTC day changes.
+	//
+	// Environment variable: USAGE_EXPORT_FILE_MAX_MB
+	// Default: 100
+	// Unit: megabytes
+	UsageExportFileMaxMB = env.Int("USAGE_EXPORT_FILE_MAX_MB", 100)
+
+	// UsageExportSyslogAddr sends usage events to syslog. "local" uses the local
+	// syslog daemon; any other value is a host:port reached over
+	// USAGE_EXPORT_SYSLOG_NETWORK. Leave empty to disable the syslog sink.
+	//
+	// Environment variable: USAGE_EXPORT_SYSLOG_ADDR
+	// Default: "" (disabled)
+	// Example: "local", "syslog.internal:514"
+	UsageExportSyslogAddr = strings.TrimSpace(env.String("USAGE_EXPORT_SYSLOG_ADDR", ""))
+
+	// UsageExportSyslogNetwork is the transport used for a remote
+	// USAGE_EXPORT_SYSLOG_ADDR.
+	//
+	// Environment variable: USAGE_EXPORT_SYSLOG_NETWORK
+	// Default: "udp"
+	// Valid values: "udp", "tcp"
+	UsageExportSyslogNetwork = strings.ToLower(strings.TrimSpace(env.String("USAGE_EXPORT_SYSLOG_NETWORK", "udp")))
+
+	// UsageExportSyslogTag is the syslog tag attached to usage events.
+	//
+	// Environment variable: USAGE_EXPORT_SYSLOG_TAG
+	// Default: "one-api-usage"
+	UsageExportSyslogTag = env.String("USAGE_EXPORT_SYSLOG_TAG", "one-api-usage")
+
+	// UsageExportQueueSize bounds how many usage events wait in memory for each
+	// sink. Events that do not fit are dropped and counted, so a slow sink
+	// never delays billing.
+	//
+	// Environment variable: USAGE_EXPORT_QUEUE_SIZE
+	// Default: 10000
+	UsageExportQueueSize = env.Int("USAGE_EXPORT_QUEUE_SIZE", 10000)
+
+	// UsageExportBatchSize is the largest number of events delivered to a sink
+	// in one write.
+	//
+	// Environment variable: USAGE_EXPORT_BATCH_SIZE
+	// Default: 100
+	UsageExportBatchSize = env.Int("USAGE_EXPORT_BATCH_SIZE", 100)
+
+	// UsageExportFlushIntervalMs delivers a partial batch once it has waited
+	// this long.
+	//
+	// Environment variable: USAGE_EXPORT_FLUSH_INTERVAL_MS
+	// Default: 1000
+	// Unit: milliseconds
+	UsageExportFlushIntervalMs = env.Int("USAGE_EXPORT_FLUSH_INTERVAL_MS", 1000)
+
+	// UsageExportMaxRetries is how many times a failed batch is retried, with
+	// exponential backoff, before it is written to the spool directory.
+	//
+	// Environment variable: USAGE_EXPORT_MAX_RETRIES
+	// Default: 5
+	UsageExportMaxRetries = env.Int("USAGE_EXPORT_MAX_RETRIES", 5)
+
+	// UsageExportSpoolDir keeps batches a sink could not accept, one NDJSON
+	// file per sink. They are replayed once the sink recovers, including after
+	// a restart. Leave empty to drop undeliverable batches instead.
+	//
+	// Environment variable: USAGE_EXPORT_SPOOL_DIR
+	// Default: "" (undeliverable batches are dropped)
+	UsageExportSpoolDir = strings.TrimSpace(env.String("USAGE_EXPORT_SPOOL_DIR", ""))
 )
 
 // =============================================================================
@@ -1232,6 +1526,35 @@ var (
 	// Example: "oneapi-", "myservice-"
 	TokenKeyPrefix = env.String("TOKEN_KEY_PREFIX", "sk-")
 
+	// TokenKeyHashSecret is the HMAC secret used to hash API token keys at rest.
+	// Only the hash is stored, so changing this value invalidates every issued
+	// token key. When empty, a secret is derived from an explicitly configured
+	// SESSION_SECRET, so changing SESSION_SECRET then invalidates every key too.
+	// The server refuses to start when neither is set.
+	//
+	// Environment variable: TOKEN_KEY_HASH_SECRET
+	// Default: "" (derived from SESSION_SECRET)
+	TokenKeyHashSecret = env.String("TOKEN_KEY_HASH_SECRET", "")
+
+	// ChannelSecretKeys carries the versioned master keys that wrap the data keys
+	// of encrypted channel credentials (channel keys, pooled keys and the
+	// sk/ak/vertex_ai_adc config fields), newest first, as
+	// "<version>:<base64-key>" entries separated by commas or whitespace. New
+	// secrets are wrapped with the first key; older keys stay listed until the
+	// re-encryption job has moved every secret off them.
+	//
+	// Environment variable: CHANNEL_SECRET_KEYS
+	// Default: "" (falls back to CHANNEL_SECRET_KEY_FILE; else secrets are stored in plaintext)
+	ChannelSecretKeys = strings.TrimSpace(env.String("CHANNEL_SECRET_KEYS", ""))
+
+	// ChannelSecretKeyFile names a local key file holding the same specification
+	// as CHANNEL_SECRET_KEYS, so the master keys can live outside the process
+	// environment. It is read only when CHANNEL_SECRET_KEYS is empty.
+	//
+	// Environment variable: CHANNEL_SECRET_KEY_FILE
+	// Default: ""
+	ChannelSecretKeyFile = strings.TrimSpace(env.String("CHANNEL_SECRET_KEY_FILE", ""))
+
 	// InitialRootToken seeds an initial personal token for the root user on first boot.
 	// Useful for automated deployments that need immediate API access.
 	//
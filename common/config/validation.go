@@ -88,6 +88,21 @@ func ValidateLogRotationInterval(value string) error {
 	return nil
 }
 
+// ValidateUsageExportSyslogNetwork validates USAGE_EXPORT_SYSLOG_NETWORK.
+// Allowed values: "udp", "tcp".
+func ValidateUsageExportSyslogNetwork(value string) error {
+	allowed := []string{"udp", "tcp"}
+	if !slices.Contains(allowed, value) {
+		return &ConfigValidationError{
+			Variable:    "USAGE_EXPORT_SYSLOG_NETWORK",
+			Value:       value,
+			Constraint:  "must be a supported syslog transport",
+			AllowedVals: allowed,
+		}
+	}
+	return nil
+}
+
 // ValidateTheme validates the THEME environment variable.
 // Allowed values: "berry", "air", "modern".
 // Note: "default" is accepted for backward compatibility and redirected to "modern".
@@ -368,6 +383,12 @@ func ValidateAllEnvVars() *ValidationResult {
 	if err := ValidateNonNegativeInt("BATCH_UPDATE_TIMEOUT", BatchUpdateTimeoutSec); err != nil {
 		result.Errors = append(result.Errors, err)
 	}
+	if err := ValidateNonNegativeInt("CHANNEL_HEALTH_WINDOW", ChannelHealthWindow); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	if err := ValidateNonNegativeInt("CHANNEL_HEALTH_MIN_SAMPLES", ChannelHealthMinSamples); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
 	if err := ValidateNonNegativeInt("METRIC_QUEUE_SIZE", MetricQueueSize); err != nil {
 		result.Errors = append(result.Errors, err)
 	}
@@ -385,6 +406,9 @@ func ValidateAllEnvVars() *ValidationResult {
 	if err := ValidateFloatRange("METRIC_SUCCESS_RATE_THRESHOLD", MetricSuccessRateThreshold, 0.0, 1.0); err != nil {
 		result.Errors = append(result.Errors, err)
 	}
+	if err := ValidateFloatRange("CHANNEL_HEALTH_MAX_ADJUSTMENT", ChannelHealthMaxAdjustment, 0.0, 1.0); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
 
 	// Rate limit validators (must be positive)
 	if err := ValidatePositiveInt("GLOBAL_API_RATE_LIMIT", GlobalApiRateLimitNum); err != nil {
@@ -421,6 +445,30 @@ func ValidateAllEnvVars() *ValidationResult {
 	if err := ValidateURLFormat("API_BASE", APIBase); err != nil {
 		result.Errors = append(result.Errors, err)
 	}
+	if err := ValidateURLFormat("USAGE_EXPORT_WEBHOOK_URL", UsageExportWebhookURL); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	if err := ValidateNonNegativeInt("USAGE_EXPORT_FILE_MAX_MB", UsageExportFileMaxMB); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	if err := ValidatePositiveInt("CAPTURE_MAX_BODY_BYTES", CaptureMaxBodyBytes); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	if err := ValidatePositiveInt("USAGE_EXPORT_QUEUE_SIZE", UsageExportQueueSize); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	if err := ValidatePositiveInt("USAGE_EXPORT_BATCH_SIZE", UsageExportBatchSize); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	if err := ValidatePositiveInt("USAGE_EXPORT_FLUSH_INTERVAL_MS", UsageExportFlushIntervalMs); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	if err := ValidateNonNegativeInt("USAGE_EXPORT_MAX_RETRIES", UsageExportMaxRetries); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
+	if err := ValidateUsageExportSyslogNetwork(UsageExportSyslogNetwork); err != nil {
+		result.Errors = append(result.Errors, err)
+	}
 
 	return result
 }
@@ -59,6 +59,12 @@ const (
 	// Read by relay metadata and log writers that need client-safe identifiers.
 	ChannelUUID = "channel_uuid"
 
+	// ChannelKeyId is the internal id of the pooled channel key serving the
+	// current attempt, or 0 when the channel does not use a key pool.
+	// Set in: middleware/distributor.SetupContextForSelectedChannel.
+	// Read in: controller relay error handling for per-key suspension and counters.
+	ChannelKeyId = "channel_key_id"
+
 	// SpecificChannelId indicates the caller explicitly requested a particular channel.
 	// Set in: middleware/auth.TokenAuth via token suffix or :channelid route param (admin-only).
 	// Read in: middleware/distributor to bypass normal selection and use that specific channel.
@@ -80,6 +86,42 @@ const (
 	// mutating RequestModel. Use RequestModel for logging, billing trace, retries, and response.model.
 	RequestModel = "request_model"
 
+	// ServedModel is the model the selected channel serves for this attempt. It equals
+	// RequestModel unless RequestModel is a virtual model or the relay degraded along an
+	// admin-defined ModelFallbackChains entry, in which case ModelMapping routes
+	// RequestModel to this model.
+	// Set in: middleware.SetupContextForSelectedChannel on every channel selection.
+	// Read in: controller.Relay to continue the fallback chain across retries, and
+	//          relay/meta to refresh the cached Meta when a hop reuses the same channel.
+	ServedModel = "served_model"
+
+	// VirtualModelTargets is the []string of targets a virtual RequestModel resolved to
+	// for this request, the weighted pick first and the failover targets after it.
+	// Set in: middleware.Distribute when RequestModel is a VirtualModels alias.
+	// Read in: middleware.FallbackModels, so retries try the remaining targets
+	//          before the fallback chain.
+	VirtualModelTargets = "virtual_model_targets"
+
+	// RequestCapture is the *model.RequestCapture being filled for a relay request
+	// covered by a capture rule.
+	// Set in: controller.Relay when model.ShouldCaptureRequest matches the user or token.
+	// Read in: relay/adaptor.DoRequestHelper to record the converted upstream request.
+	RequestCapture = "request_capture"
+
+	// FirstResponseAt is the time.Time of the first byte written to the client.
+	// Set in: middleware.TracingMiddleware's response writer.
+	// Read in: controller.Relay to measure the time to first byte of each
+	//          streamed attempt for channel health scoring.
+	FirstResponseAt = "first_response_at"
+
+	// UpstreamRequestAt and UpstreamResponseAt are the time.Time at which the
+	// latest upstream request was sent and its response headers arrived.
+	// Set in: relay/adaptor.DoRequest.
+	// Read in: controller.Relay to measure the upstream response time of each
+	//          attempt for channel health scoring.
+	UpstreamRequestAt  = "upstream_request_at"
+	UpstreamResponseAt = "upstream_response_at"
+
 	// ConvertedRequest holds the provider-specific request body after conversion.
 	// Set in: controller/text during conversion, and in several adaptors (AWS/Gemini/OpenAI variants).
 	// Read in: adaptor DoRequest/DoResponse or signing steps that need the converted structure.
@@ -172,6 +214,39 @@ const (
 	// Read in: controllers to bypass quota checks when true.
 	TokenQuotaUnlimited = "token_quota_unlimited"
 
+	// GuardrailPolicy is the guardrail policy name the API token overrides its group policy with.
+	// Set in: middleware/auth.TokenAuth.
+	// Read in: relay/controller guardrail hooks.
+	GuardrailPolicy = "guardrail_policy"
+
+	// ContextStrategy is the context-window strategy of the API token; the
+	// X-OneAPI-Context-Strategy request header overrides it per request.
+	// Set in: middleware/auth.TokenAuth.
+	// Read in: relay/controller context fitting.
+	ContextStrategy = "context_strategy"
+
+	// ParentRequestId is the request id of the client request an in-process
+	// sub-request, such as a context summary, was made for.
+	// Set in: middleware/auth.TokenAuth.
+	// Read in: relay metadata and consume logs, which link the two requests.
+	ParentRequestId = "parent_request_id"
+
+	// TokenScopes is the []string of relay endpoints the API token may call;
+	// unset when the token is not restricted.
+	// Set in: middleware/auth.TokenAuth.
+	// Read in: controller/model.ListModels to list only reachable models.
+	TokenScopes = "token_scopes"
+
+	// OrgId is the id of the organization owning the API token, 0 for a personal token.
+	// Set in: middleware/auth.TokenAuth.
+	// Read in: relay metadata, quota checks and billing, which charge the organization pool.
+	OrgId = "org_id"
+
+	// GuardrailChecked marks that the request guardrail already ran, so relay
+	// retries neither re-run the filters nor repeat the moderation call.
+	// Set in: relay/controller guardrail hooks.
+	GuardrailChecked = "guardrail_checked"
+
 	// UserObj stores the authenticated *model.User in context.
 	// Set in: middleware/auth (both session and token auth paths).
 	// Read in: downstream handlers to avoid redundant DB/cache lookups for user fields
@@ -3,6 +3,15 @@ package helper
 const (
 	// RequestIdKey stores the gin context key used to persist the current request identifier.
 	RequestIdKey = "X-Oneapi-Request-Id"
+	// ServedModelHeader names the response header that reports which model actually
+	// answered a relay request, which differs from the requested model after a fallback.
+	ServedModelHeader = "X-Oneapi-Served-Model"
+	// ResponseCacheHeader names the response header that reports HIT or MISS for
+	// requests eligible for the exact-match response cache.
+	ResponseCacheHeader = "X-Oneapi-Cache"
+	// ResponseCacheControlHeader lets a client opt a request out of the response
+	// cache by sending "no-cache" or "no-store".
+	ResponseCacheControlHeader = "X-Oneapi-Cache-Control"
 )
 
 // MaskAPIKey returns a masked version of an API key for safe logging.
@@ -29,6 +29,23 @@ var sensitiveURLQueryKeys = map[string]struct{}{
 	"turnstile":    {},
 }
 
+// sensitivePayloadKeys lists JSON object keys whose values are credentials,
+// such as the authorization of a Responses API MCP tool. Their values are
+// redacted from logged payloads.
+var sensitivePayloadKeys = map[string]struct{}{
+	"access_token":  {},
+	"api_key":       {},
+	"apikey":        {},
+	"authorization": {},
+	"client_secret": {},
+	"password":      {},
+	"private_key":   {},
+	"refresh_token": {},
+	"secret":        {},
+	"secret_key":    {},
+	"x-api-key":     {},
+}
+
 // SanitizeURLForLogging redacts sensitive query parameter values before URLs are written to logs or traces.
 func SanitizeURLForLogging(rawURL string) string {
 	if rawURL == "" {
@@ -94,7 +111,7 @@ func SanitizePayloadForLogging(body []byte, limit int) ([]byte, bool) {
 	return truncateBytes(body, limit)
 }
 
-// sanitizeJSONValueForLogging walks JSON values and truncates or redacts string leaves.
+// sanitizeJSONValueForLogging walks JSON values, redacts credential fields and truncates or redacts string leaves.
 // Parameters: value is the decoded JSON node; limit is the maximum length per string.
 // Returns: a sanitized JSON node suitable for logging.
 func sanitizeJSONValueForLogging(value any, limit int) any {
@@ -102,6 +119,10 @@ func sanitizeJSONValueForLogging(value any, limit int) any {
 	case map[string]any:
 		sanitized := make(map[string]any, len(v))
 		for key, inner := range v {
+			if _, ok := sensitivePayloadKeys[strings.ToLower(key)]; ok && inner != nil {
+				sanitized[key] = "[redacted]"
+				continue
+			}
 			sanitized[key] = sanitizeJSONValueForLogging(inner, limit)
 		}
 		return sanitized
@@ -40,6 +40,19 @@ func TestSanitizeURLForLogging_RedactsSensitiveQuery(t *testing.T) {
 	require.NotContains(t, sanitized, "secret-key")
 }
 
+// TestSanitizePayloadForLogging_RedactsCredentialFields verifies credential-like keys are redacted at any depth.
+func TestSanitizePayloadForLogging_RedactsCredentialFields(t *testing.T) {
+	body := []byte(`{"model":"gpt-4o","tools":[{"type":"mcp","authorization":"Bearer sk-live","headers":{"X-Api-Key":"sk-other"}}],"logprobs":[{"token":"hi"}]}`)
+
+	preview, _ := SanitizePayloadForLogging(body, 512)
+	previewText := string(preview)
+
+	require.NotContains(t, previewText, "sk-live")
+	require.NotContains(t, previewText, "sk-other")
+	require.Contains(t, previewText, `"authorization":"[redacted]"`)
+	require.Contains(t, previewText, `"token":"hi"`, "content fields named token are kept")
+}
+
 // TestSanitizePayloadForLogging_Base64String verifies raw base64 strings are redacted.
 func TestSanitizePayloadForLogging_Base64String(t *testing.T) {
 	base64Data := strings.Repeat("B", 1024)
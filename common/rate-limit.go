@@ -8,11 +8,21 @@ import (
 // InMemoryRateLimiter keeps per-key request timestamps to enforce simple in-memory quotas.
 // It is safe for concurrent use within a single process.
 type InMemoryRateLimiter struct {
-	store              map[string]*[]int64
+	store map[string]*[]int64
+	// usage keeps weighted hits (e.g. tokens consumed) for WindowUsage/AddUsage.
+	usage map[string][]weightedHit
+	// inFlight counts requests currently holding an Acquire slot.
+	inFlight           map[string]int
 	mutex              sync.Mutex
 	expirationDuration time.Duration
 }
 
+// weightedHit is one AddUsage record: its unix time in seconds and its weight.
+type weightedHit struct {
+	at     int64
+	weight int64
+}
+
 // Init prepares the rate limiter with an optional expiration window for idle keys.
 // When expirationDuration is greater than zero, a background goroutine periodically prunes stale entries.
 func (l *InMemoryRateLimiter) Init(expirationDuration time.Duration) {
@@ -20,6 +30,8 @@ func (l *InMemoryRateLimiter) Init(expirationDuration time.Duration) {
 		l.mutex.Lock()
 		if l.store == nil {
 			l.store = make(map[string]*[]int64)
+			l.usage = make(map[string][]weightedHit)
+			l.inFlight = make(map[string]int)
 			l.expirationDuration = expirationDuration
 			if expirationDuration > 0 {
 				go l.clearExpiredItems()
@@ -41,6 +53,11 @@ func (l *InMemoryRateLimiter) clearExpiredItems() {
 				delete(l.store, key)
 			}
 		}
+		for key, hits := range l.usage {
+			if len(hits) == 0 || now-hits[len(hits)-1].at > int64(l.expirationDuration.Seconds()) {
+				delete(l.usage, key)
+			}
+		}
 		l.mutex.Unlock()
 	}
 }
@@ -111,3 +128,94 @@ func (l *InMemoryRateLimiter) Record(key string, maxRequestNum int) {
 		*queue = (*queue)[len(*queue)-maxRequestNum:]
 	}
 }
+
+// AddUsage records weight units (for example tokens consumed) against key at the
+// current time. Pair it with WindowUsage to enforce a weighted sliding window.
+func (l *InMemoryRateLimiter) AddUsage(key string, weight int64) {
+	if weight <= 0 {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.usage == nil {
+		l.usage = make(map[string][]weightedHit)
+	}
+	l.usage[key] = append(l.usage[key], weightedHit{at: time.Now().Unix(), weight: weight})
+}
+
+// WindowUsage returns the total weight recorded for key within the last duration
+// seconds, together with the seconds until the oldest retained record leaves the
+// window (0 when nothing is recorded). Records older than the window are pruned.
+func (l *InMemoryRateLimiter) WindowUsage(key string, duration int64) (used int64, resetSeconds int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.windowUsageLocked(key, duration, time.Now().Unix())
+}
+
+// TakeUsage records weight units against key only when the total already
+// recorded within the last duration seconds is below limit. The check and the
+// record happen under one lock, so concurrent callers cannot overshoot limit.
+// It returns whether the usage was recorded, the window total including it when
+// it was, and the seconds until the oldest retained record leaves the window.
+func (l *InMemoryRateLimiter) TakeUsage(key string, weight int64, limit int64, duration int64) (allowed bool, used int64, resetSeconds int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.usage == nil {
+		l.usage = make(map[string][]weightedHit)
+	}
+	now := time.Now().Unix()
+	used, resetSeconds = l.windowUsageLocked(key, duration, now)
+	if used >= limit {
+		return false, used, resetSeconds
+	}
+	l.usage[key] = append(l.usage[key], weightedHit{at: now, weight: weight})
+	if resetSeconds == 0 {
+		resetSeconds = duration
+	}
+	return true, used + weight, resetSeconds
+}
+
+// windowUsageLocked prunes and sums the records of key; l.mutex must be held.
+func (l *InMemoryRateLimiter) windowUsageLocked(key string, duration int64, now int64) (used int64, resetSeconds int64) {
+	hits := l.usage[key]
+	idx := 0
+	for idx < len(hits) && now-hits[idx].at >= duration {
+		idx++
+	}
+	hits = hits[idx:]
+	if len(hits) == 0 {
+		delete(l.usage, key)
+		return 0, 0
+	}
+	l.usage[key] = hits
+	for _, hit := range hits {
+		used += hit.weight
+	}
+	return used, duration - (now - hits[0].at)
+}
+
+// Acquire takes one of maxInFlight concurrent slots for key and reports whether
+// a slot was available. Every successful Acquire must be paired with Release.
+func (l *InMemoryRateLimiter) Acquire(key string, maxInFlight int) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.inFlight == nil {
+		l.inFlight = make(map[string]int)
+	}
+	if l.inFlight[key] >= maxInFlight {
+		return false
+	}
+	l.inFlight[key]++
+	return true
+}
+
+// Release returns a slot taken by Acquire.
+func (l *InMemoryRateLimiter) Release(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.inFlight[key] <= 1 {
+		delete(l.inFlight, key)
+		return
+	}
+	l.inFlight[key]--
+}
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -67,3 +69,74 @@ func TestInMemoryRateLimiter_WindowExpiry(t *testing.T) {
 		t.Fatal("expected budget to free up after the window elapsed")
 	}
 }
+
+// TestInMemoryRateLimiter_WindowUsage verifies weighted usage is summed per key
+// within the window and ages out afterwards.
+func TestInMemoryRateLimiter_WindowUsage(t *testing.T) {
+	var l InMemoryRateLimiter
+	l.Init(0)
+
+	const key = "rateLimit:TKT:1"
+	if used, reset := l.WindowUsage(key, 1); used != 0 || reset != 0 {
+		t.Fatalf("expected empty window, got used=%d reset=%d", used, reset)
+	}
+
+	l.AddUsage(key, 300)
+	l.AddUsage(key, 200)
+	l.AddUsage(key, 0) // ignored
+	used, reset := l.WindowUsage(key, 1)
+	if used != 500 || reset < 0 || reset > 1 {
+		t.Fatalf("expected 500 tokens in window, got used=%d reset=%d", used, reset)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if used, _ := l.WindowUsage(key, 1); used != 0 {
+		t.Fatalf("expected usage to age out, got %d", used)
+	}
+}
+
+// TestInMemoryRateLimiter_TakeUsage verifies that concurrent TakeUsage calls
+// never admit more than the limit within one window.
+func TestInMemoryRateLimiter_TakeUsage(t *testing.T) {
+	var l InMemoryRateLimiter
+	l.Init(0)
+
+	const key = "rateLimit:TKR:7"
+	const limit = 5
+	var admitted atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if allowed, _, _ := l.TakeUsage(key, 1, limit, 60); allowed {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := admitted.Load(); got != limit {
+		t.Fatalf("admitted %d requests, want %d", got, limit)
+	}
+	if allowed, used, reset := l.TakeUsage(key, 1, limit, 60); allowed || used != limit || reset <= 0 {
+		t.Fatalf("full window: allowed=%v used=%d reset=%d", allowed, used, reset)
+	}
+}
+
+// TestInMemoryRateLimiter_AcquireRelease verifies the in-flight slot accounting.
+func TestInMemoryRateLimiter_AcquireRelease(t *testing.T) {
+	var l InMemoryRateLimiter
+	l.Init(0)
+
+	const key = "rateLimit:TKC:1"
+	if !l.Acquire(key, 2) || !l.Acquire(key, 2) {
+		t.Fatal("expected two slots to be available")
+	}
+	if l.Acquire(key, 2) {
+		t.Fatal("expected the third concurrent acquire to be rejected")
+	}
+	l.Release(key)
+	if !l.Acquire(key, 2) {
+		t.Fatal("expected a released slot to be reusable")
+	}
+}
@@ -0,0 +1,49 @@
+// Package usageexport streams a usage event for every billed request to
+// external sinks such as a webhook, rotating NDJSON files or syslog.
+//
+// Each sink has its own bounded queue and worker, so a slow or failing sink
+// never holds back the others or the relay path. Workers deliver events in
+// batches and retry failed batches with exponential backoff. A batch that still
+// cannot be delivered is appended to a per-sink spool file and replayed once
+// the sink accepts writes again.
+package usageexport
+
+import "context"
+
+// EventTypeConsume marks the usage event of a billed relay request.
+const EventTypeConsume = "consume"
+
+// Event is one billed request as seen by downstream consumers. EventID is the
+// UUID of the consume log row, so consumers can de-duplicate replays.
+type Event struct {
+	EventID            string `json:"event_id"`
+	Type               string `json:"type"`
+	Timestamp          int64  `json:"timestamp"`
+	LogID              int    `json:"log_id,omitempty"`
+	UserUUID           string `json:"user_uuid,omitempty"`
+	TokenUUID          string `json:"token_uuid,omitempty"`
+	TokenName          string `json:"token_name,omitempty"`
+	ChannelUUID        string `json:"channel_uuid,omitempty"`
+	OrgID              int    `json:"org_id,omitempty"`
+	Model              string `json:"model"`
+	OriginModel        string `json:"origin_model,omitempty"`
+	PromptTokens       int    `json:"prompt_tokens"`
+	CompletionTokens   int    `json:"completion_tokens"`
+	CachedPromptTokens int    `json:"cached_prompt_tokens,omitempty"`
+	Quota              int64  `json:"quota"`
+	ElapsedMs          int64  `json:"elapsed_ms"`
+	IsStream           bool   `json:"is_stream"`
+	RequestID          string `json:"request_id,omitempty"`
+	TraceID            string `json:"trace_id,omitempty"`
+}
+
+// Sink delivers batches of usage events to one destination.
+type Sink interface {
+	// Name identifies the sink in logs and names its spool file.
+	Name() string
+	// Write delivers the batch. An error makes the exporter retry the whole
+	// batch, so a sink should not partially accept one.
+	Write(ctx context.Context, events []Event) error
+	// Close releases the sink's resources.
+	Close() error
+}
@@ -0,0 +1,319 @@
+package usageexport
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/Laisky/one-api/common/logger"
+)
+
+// maxRetryBackoff caps the delay between two delivery attempts of a batch.
+const maxRetryBackoff = 30 * time.Second
+
+// Options tunes how an Exporter queues, batches and retries events.
+type Options struct {
+	// QueueSize bounds the in-memory queue of each sink.
+	QueueSize int
+	// BatchSize is the largest number of events passed to one Sink.Write.
+	BatchSize int
+	// FlushInterval delivers a partial batch once it has waited this long.
+	FlushInterval time.Duration
+	// MaxRetries is how many times a failed batch is retried before spooling.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry; it doubles each time.
+	RetryBackoff time.Duration
+	// SpoolDir keeps undeliverable batches; empty drops them instead.
+	SpoolDir string
+}
+
+// Stats counts what happened to the events of one sink.
+type Stats struct {
+	Delivered int64 `json:"delivered"`
+	Spooled   int64 `json:"spooled"`
+	Dropped   int64 `json:"dropped"`
+}
+
+// Exporter fans usage events out to its sinks.
+type Exporter struct {
+	mu      sync.RWMutex
+	closed  bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	workers []*sinkWorker
+}
+
+// sinkWorker owns the queue, spool and delivery loop of one sink.
+type sinkWorker struct {
+	sink  Sink
+	opts  Options
+	queue chan Event
+	spool *spool
+	stop  <-chan struct{}
+
+	delivered atomic.Int64
+	spooled   atomic.Int64
+	dropped   atomic.Int64
+}
+
+// New starts one delivery worker per sink.
+//
+// Parameters:
+//   - opts: queueing, batching and retry settings; non-positive sizes fall back to defaults.
+//   - sinks: the destinations, at least one.
+//
+// Return values:
+//   - *Exporter: the running exporter; call Close to flush and stop it.
+//   - error: when no sink is given or a spool file cannot be prepared.
+func New(opts Options, sinks ...Sink) (*Exporter, error) {
+	if len(sinks) == 0 {
+		return nil, errors.New("usage exporter needs at least one sink")
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 500 * time.Millisecond
+	}
+
+	exporter := &Exporter{stop: make(chan struct{})}
+	for _, sink := range sinks {
+		sp, err := newSpool(opts.SpoolDir, sink.Name())
+		if err != nil {
+			return nil, err
+		}
+		exporter.workers = append(exporter.workers, &sinkWorker{
+			sink:  sink,
+			opts:  opts,
+			queue: make(chan Event, opts.QueueSize),
+			spool: sp,
+			stop:  exporter.stop,
+		})
+	}
+	for _, worker := range exporter.workers {
+		exporter.wg.Go(worker.run)
+	}
+	return exporter, nil
+}
+
+// Publish queues the event for every sink without blocking. When a sink's
+// queue is full the event is dropped and counted, so a slow sink or spool
+// disk never holds up the billing path that publishes it.
+func (e *Exporter) Publish(event Event) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	for _, worker := range e.workers {
+		select {
+		case worker.queue <- event:
+		default:
+			worker.overflow()
+		}
+	}
+}
+
+// Stats returns the delivery counters of every sink, keyed by sink name.
+func (e *Exporter) Stats() map[string]Stats {
+	stats := make(map[string]Stats, len(e.workers))
+	for _, worker := range e.workers {
+		stats[worker.sink.Name()] = Stats{
+			Delivered: worker.delivered.Load(),
+			Spooled:   worker.spooled.Load(),
+			Dropped:   worker.dropped.Load(),
+		}
+	}
+	return stats
+}
+
+// Close stops accepting events, delivers what is queued with a single attempt
+// per batch, spools whatever fails and closes the sinks. It returns ctx's error
+// when the workers do not finish in time.
+func (e *Exporter) Close(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	close(e.stop)
+	for _, worker := range e.workers {
+		close(worker.queue)
+	}
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "wait for usage export workers")
+	}
+
+	var closeErr error
+	for _, worker := range e.workers {
+		if err := worker.sink.Close(); err != nil && closeErr == nil {
+			closeErr = errors.Wrapf(err, "close usage export sink %q", worker.sink.Name())
+		}
+	}
+	return closeErr
+}
+
+// run batches queued events until the queue is closed. Spooled events are
+// replayed on the flush tick.
+func (w *sinkWorker) run() {
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, w.opts.BatchSize)
+	// A failed replay backs off like a failed batch, so a long outage does
+	// not rewrite the spool file on every tick.
+	var replayAt time.Time
+	replayBackoff := w.opts.RetryBackoff
+	flush := func() {
+		if len(batch) > 0 {
+			w.deliver(batch)
+			batch = make([]Event, 0, w.opts.BatchSize)
+		}
+	}
+	for {
+		select {
+		case event, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= w.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			if time.Now().Before(replayAt) {
+				continue
+			}
+			if w.replay() {
+				replayBackoff = w.opts.RetryBackoff
+				replayAt = time.Time{}
+			} else {
+				replayAt = time.Now().Add(replayBackoff)
+				replayBackoff = min(replayBackoff*2, maxRetryBackoff)
+			}
+		}
+	}
+}
+
+// deliver writes one batch with retries and spools it when every attempt
+// fails.
+func (w *sinkWorker) deliver(batch []Event) {
+	backoff := w.opts.RetryBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = w.sink.Write(context.Background(), batch); err == nil {
+			w.delivered.Add(int64(len(batch)))
+			return
+		}
+		if attempt >= w.opts.MaxRetries || w.stopping() {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-w.stop:
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+
+	logger.Logger.Warn("usage export batch failed, spooling",
+		zap.String("sink", w.sink.Name()),
+		zap.Int("events", len(batch)),
+		zap.Error(err))
+	w.store(batch)
+}
+
+// replay re-delivers spooled events in batches with a single attempt each,
+// putting back whatever the sink rejects. It reports whether the sink
+// accepted every batch.
+func (w *sinkWorker) replay() bool {
+	if w.spool == nil || !w.spool.pending() {
+		return true
+	}
+	events, err := w.spool.take()
+	if err != nil {
+		logger.Logger.Error("failed to read usage export spool",
+			zap.String("sink", w.sink.Name()), zap.Error(err))
+		return false
+	}
+	for start := 0; start < len(events); start += w.opts.BatchSize {
+		end := min(start+w.opts.BatchSize, len(events))
+		if err = w.sink.Write(context.Background(), events[start:end]); err != nil {
+			// Already counted as spooled; putting them back is not a new spool.
+			if err = w.spool.append(events[start:]); err != nil {
+				w.lose(events[start:], err)
+			}
+			return false
+		}
+		w.delivered.Add(int64(end - start))
+	}
+	if len(events) > 0 {
+		logger.Logger.Info("replayed spooled usage events",
+			zap.String("sink", w.sink.Name()), zap.Int("events", len(events)))
+	}
+	return true
+}
+
+// store appends events to the spool, counting them as dropped when spooling
+// is disabled or fails.
+func (w *sinkWorker) store(events []Event) {
+	if w.spool == nil {
+		if w.dropped.Add(int64(len(events))) == int64(len(events)) {
+			logger.Logger.Warn("dropping usage events; set USAGE_EXPORT_SPOOL_DIR to keep them",
+				zap.String("sink", w.sink.Name()))
+		}
+		return
+	}
+	if err := w.spool.append(events); err != nil {
+		w.lose(events, err)
+		return
+	}
+	w.spooled.Add(int64(len(events)))
+}
+
+// overflow counts an event dropped because the queue is full, warning once
+// per sink so a sustained backlog does not flood the log.
+func (w *sinkWorker) overflow() {
+	if w.dropped.Add(1) == 1 {
+		logger.Logger.Warn("usage export queue is full, dropping events; raise USAGE_EXPORT_QUEUE_SIZE",
+			zap.String("sink", w.sink.Name()))
+	}
+}
+
+// lose counts events the spool could not keep.
+func (w *sinkWorker) lose(events []Event, err error) {
+	w.dropped.Add(int64(len(events)))
+	logger.Logger.Error("failed to spool usage events, dropping them",
+		zap.String("sink", w.sink.Name()), zap.Int("events", len(events)), zap.Error(err))
+}
+
+// stopping reports whether the exporter is shutting down.
+func (w *sinkWorker) stopping() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
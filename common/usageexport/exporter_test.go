@@ -0,0 +1,170 @@
+package usageexport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink records delivered batches and fails while failing is set.
+type memorySink struct {
+	mu      sync.Mutex
+	failing bool
+	batches [][]Event
+	writes  int
+}
+
+func (s *memorySink) Name() string { return "memory" }
+
+func (s *memorySink) Write(_ context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	if s.failing {
+		return errors.New("sink unavailable")
+	}
+	s.batches = append(s.batches, append([]Event(nil), events...))
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func (s *memorySink) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *memorySink) eventIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for _, batch := range s.batches {
+		for _, event := range batch {
+			ids = append(ids, event.EventID)
+		}
+	}
+	return ids
+}
+
+func testEvents(n int) []Event {
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = Event{EventID: fmt.Sprintf("evt-%d", i), Type: EventTypeConsume, Model: "gpt-4o"}
+	}
+	return events
+}
+
+func TestExporterBatchesEvents(t *testing.T) {
+	sink := &memorySink{}
+	exporter, err := New(Options{BatchSize: 2, FlushInterval: time.Hour}, sink)
+	require.NoError(t, err)
+
+	for _, event := range testEvents(5) {
+		exporter.Publish(event)
+	}
+	require.NoError(t, exporter.Close(context.Background()))
+
+	require.Len(t, sink.batches, 3)
+	require.Len(t, sink.batches[0], 2)
+	require.Len(t, sink.batches[2], 1, "close flushes the partial batch")
+	require.Equal(t, []string{"evt-0", "evt-1", "evt-2", "evt-3", "evt-4"}, sink.eventIDs())
+	require.Equal(t, Stats{Delivered: 5}, exporter.Stats()["memory"])
+
+	exporter.Publish(testEvents(1)[0])
+	require.Len(t, sink.batches, 3, "events published after close are ignored")
+}
+
+func TestExporterSpoolsAndReplaysFailedBatches(t *testing.T) {
+	sink := &memorySink{failing: true}
+	exporter, err := New(Options{
+		BatchSize:     10,
+		FlushInterval: 10 * time.Millisecond,
+		MaxRetries:    2,
+		RetryBackoff:  time.Millisecond,
+		SpoolDir:      t.TempDir(),
+	}, sink)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = exporter.Close(context.Background()) })
+
+	for _, event := range testEvents(3) {
+		exporter.Publish(event)
+	}
+	require.Eventually(t, func() bool {
+		return exporter.Stats()["memory"].Spooled == 3
+	}, 5*time.Second, 5*time.Millisecond)
+	sink.mu.Lock()
+	require.GreaterOrEqual(t, sink.writes, 3, "the batch is retried before it is spooled")
+	sink.mu.Unlock()
+
+	sink.setFailing(false)
+	require.Eventually(t, func() bool {
+		return exporter.Stats()["memory"].Delivered == 3
+	}, 5*time.Second, 5*time.Millisecond)
+	require.Equal(t, []string{"evt-0", "evt-1", "evt-2"}, sink.eventIDs())
+	require.False(t, exporter.workers[0].spool.pending())
+}
+
+func TestExporterSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	failing := &memorySink{failing: true}
+	first, err := New(Options{FlushInterval: time.Hour, SpoolDir: dir}, failing)
+	require.NoError(t, err)
+	for _, event := range testEvents(2) {
+		first.Publish(event)
+	}
+	require.NoError(t, first.Close(context.Background()))
+	require.Equal(t, int64(2), first.Stats()["memory"].Spooled)
+
+	sink := &memorySink{}
+	second, err := New(Options{FlushInterval: 10 * time.Millisecond, SpoolDir: dir}, sink)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = second.Close(context.Background()) })
+	require.Eventually(t, func() bool {
+		return len(sink.eventIDs()) == 2
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestExporterDropsOverflow(t *testing.T) {
+	block := make(chan struct{})
+	sink := &blockingSink{started: make(chan struct{}), release: block}
+	exporter, err := New(Options{QueueSize: 1, BatchSize: 1, FlushInterval: time.Hour, SpoolDir: t.TempDir()}, sink)
+	require.NoError(t, err)
+
+	events := testEvents(4)
+	exporter.Publish(events[0])
+	<-sink.started // the worker holds the first event
+	for _, event := range events[1:] {
+		exporter.Publish(event)
+	}
+	require.Equal(t, int64(2), exporter.Stats()["blocking"].Dropped, "one event fits the queue")
+	require.Zero(t, exporter.Stats()["blocking"].Spooled, "overflow never touches the spool on the publishing goroutine")
+
+	close(block)
+	require.NoError(t, exporter.Close(context.Background()))
+	require.Equal(t, int64(2), exporter.Stats()["blocking"].Delivered)
+}
+
+// blockingSink holds its first write until release is closed.
+type blockingSink struct {
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSink) Name() string { return "blocking" }
+
+func (s *blockingSink) Write(context.Context, []Event) error {
+	s.once.Do(func() {
+		close(s.started)
+		<-s.release
+	})
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
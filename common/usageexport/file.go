@@ -0,0 +1,149 @@
+package usageexport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// fileDateLayout stamps the UTC day into NDJSON file names.
+const fileDateLayout = "20060102"
+
+// FileSink appends events to NDJSON files named usage-<yyyymmdd>-<seq>.ndjson.
+// A new file starts when the UTC day changes or the current file reaches
+// maxBytes.
+type FileSink struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	now      func() time.Time
+
+	file *os.File
+	day  string
+	seq  int
+	size int64
+}
+
+// NewFileSink returns a sink writing into dir. maxBytes <= 0 rotates daily only.
+func NewFileSink(dir string, maxBytes int64) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.Wrapf(err, "create usage export dir %q", dir)
+	}
+	return &FileSink{dir: dir, maxBytes: maxBytes, now: time.Now}, nil
+}
+
+// Name implements Sink.
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+// Write implements Sink. The batch is encoded first and written with a single
+// call, so a batch never straddles two files.
+func (s *FileSink) Write(_ context.Context, events []Event) error {
+	lines, err := encodeLines(events)
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	for _, line := range lines {
+		buf = append(append(buf, line...), '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err = s.rotate(int64(len(buf))); err != nil {
+		return err
+	}
+	n, err := s.file.Write(buf)
+	s.size += int64(n)
+	if err != nil {
+		return errors.Wrapf(err, "write usage export file %q", s.file.Name())
+	}
+	return nil
+}
+
+// rotate makes sure the open file belongs to the current day and has room
+// for another pending bytes. The caller holds s.mu.
+func (s *FileSink) rotate(pending int64) error {
+	day := s.now().UTC().Format(fileDateLayout)
+	full := s.maxBytes > 0 && s.size > 0 && s.size+pending > s.maxBytes
+	if s.file != nil && day == s.day && !full {
+		return nil
+	}
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return errors.Wrapf(err, "close usage export file %q", s.file.Name())
+		}
+		s.file = nil
+	}
+	if day != s.day {
+		s.day, s.seq = day, s.lastSeq(day)
+	} else {
+		s.seq++
+	}
+
+	// Resume the newest file of the day after a restart while it has room.
+	for {
+		path := filepath.Join(s.dir, fmt.Sprintf("usage-%s-%03d.ndjson", s.day, s.seq))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+		if err != nil {
+			return errors.Wrapf(err, "open usage export file %q", path)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return errors.Wrapf(err, "stat usage export file %q", path)
+		}
+		if s.maxBytes > 0 && info.Size() > 0 && info.Size()+pending > s.maxBytes {
+			_ = file.Close()
+			s.seq++
+			continue
+		}
+		s.file, s.size = file, info.Size()
+		return nil
+	}
+}
+
+// lastSeq returns the highest sequence number already used for day.
+func (s *FileSink) lastSeq(day string) int {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, "usage-"+day+"-*.ndjson"))
+	last := 0
+	for _, match := range matches {
+		var seq int
+		if _, err := fmt.Sscanf(filepath.Base(match), "usage-"+day+"-%d.ndjson", &seq); err == nil && seq > last {
+			last = seq
+		}
+	}
+	return last
+}
+
+// Close implements Sink.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return errors.Wrap(err, "close usage export file")
+}
+
+// encodeLines encodes events as NDJSON lines for line-oriented sinks.
+func encodeLines(events []Event) ([][]byte, error) {
+	lines := make([][]byte, 0, len(events))
+	for i := range events {
+		line, err := json.Marshal(&events[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal usage event")
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
@@ -0,0 +1,97 @@
+package usageexport
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/logger"
+)
+
+// global is the process-wide exporter installed by Init, nil when no sink is
+// configured.
+var global atomic.Pointer[Exporter]
+
+// Init builds the sinks configured through the USAGE_EXPORT_* variables and
+// installs the process-wide exporter. It does nothing when no sink is set.
+//
+// Return values:
+//   - error: when a configured sink or the spool directory cannot be set up.
+func Init() error {
+	var sinks []Sink
+	if config.UsageExportWebhookURL != "" {
+		sink, err := NewWebhookSink(config.UsageExportWebhookURL, config.UsageExportWebhookSecret)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if config.UsageExportFileDir != "" {
+		sink, err := NewFileSink(config.UsageExportFileDir, int64(config.UsageExportFileMaxMB)*1024*1024)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if config.UsageExportSyslogAddr != "" {
+		sink, err := NewSyslogSink(config.UsageExportSyslogNetwork, config.UsageExportSyslogAddr, config.UsageExportSyslogTag)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil
+	}
+
+	exporter, err := New(Options{
+		QueueSize:     config.UsageExportQueueSize,
+		BatchSize:     config.UsageExportBatchSize,
+		FlushInterval: time.Duration(config.UsageExportFlushIntervalMs) * time.Millisecond,
+		MaxRetries:    config.UsageExportMaxRetries,
+		SpoolDir:      config.UsageExportSpoolDir,
+	}, sinks...)
+	if err != nil {
+		return errors.Wrap(err, "start usage exporter")
+	}
+	SetExporter(exporter)
+
+	names := make([]string, 0, len(sinks))
+	for _, sink := range sinks {
+		names = append(names, sink.Name())
+	}
+	logger.Logger.Info("usage event export enabled",
+		zap.Strings("sinks", names),
+		zap.String("spool_dir", config.UsageExportSpoolDir))
+	return nil
+}
+
+// SetExporter replaces the process-wide exporter; nil disables export.
+func SetExporter(exporter *Exporter) {
+	global.Store(exporter)
+}
+
+// Enabled reports whether usage events are being exported.
+func Enabled() bool {
+	return global.Load() != nil
+}
+
+// Publish hands the event to the process-wide exporter, if any.
+func Publish(event Event) {
+	if exporter := global.Load(); exporter != nil {
+		exporter.Publish(event)
+	}
+}
+
+// Shutdown flushes and stops the process-wide exporter.
+func Shutdown(ctx context.Context) error {
+	exporter := global.Swap(nil)
+	if exporter == nil {
+		return nil
+	}
+	return exporter.Close(ctx)
+}
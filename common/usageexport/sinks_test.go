@@ -0,0 +1,93 @@
+package usageexport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSinkSignsBatches(t *testing.T) {
+	var received webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		timestamp := r.Header.Get(WebhookTimestampHeader)
+		require.NotEmpty(t, timestamp)
+		require.Equal(t, SignWebhookBody([]byte("hook-secret"), timestamp, body), r.Header.Get(WebhookSignatureHeader))
+		require.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(server.URL, "hook-secret")
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(context.Background(), testEvents(2)))
+	require.Len(t, received.Events, 2)
+	require.Equal(t, "evt-1", received.Events[1].EventID)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	failingSink, err := NewWebhookSink(failing.URL, "hook-secret")
+	require.NoError(t, err)
+	require.ErrorContains(t, failingSink.Write(context.Background(), testEvents(1)), "status 502")
+
+	_, err = NewWebhookSink(server.URL, "")
+	require.ErrorContains(t, err, "USAGE_EXPORT_WEBHOOK_SECRET", "unsigned webhooks are refused")
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestFileSinkRotatesBySizeAndDay(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(dir, 150)
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+
+	events := testEvents(3)
+	for _, event := range events {
+		require.NoError(t, sink.Write(context.Background(), []Event{event}))
+	}
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, sink.Write(context.Background(), testEvents(1)))
+	require.NoError(t, sink.Close())
+
+	first := readLines(t, filepath.Join(dir, "usage-20261016-000.ndjson"))
+	require.Len(t, first, 1, "one event is about 140 bytes, so each file holds one")
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(first[0]), &event))
+	require.Equal(t, "evt-0", event.EventID)
+	require.Len(t, readLines(t, filepath.Join(dir, "usage-20261016-002.ndjson")), 1)
+	require.Len(t, readLines(t, filepath.Join(dir, "usage-20261017-000.ndjson")), 1)
+
+	// A restarted sink continues with the newest file of the day.
+	restarted, err := NewFileSink(dir, 0)
+	require.NoError(t, err)
+	restarted.now = func() time.Time { return now }
+	require.NoError(t, restarted.Write(context.Background(), testEvents(1)))
+	require.NoError(t, restarted.Close())
+	require.Len(t, readLines(t, filepath.Join(dir, "usage-20261017-000.ndjson")), 2)
+}
@@ -0,0 +1,102 @@
+package usageexport
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// spoolFileSuffix names the spool file of a sink: "<sink>.spool.ndjson".
+const spoolFileSuffix = ".spool.ndjson"
+
+// spool keeps batches a sink could not accept as NDJSON lines on disk.
+type spool struct {
+	mu   sync.Mutex
+	path string
+}
+
+// newSpool returns the spool of the named sink inside dir, or nil when dir is
+// empty, which disables spooling.
+func newSpool(dir, sinkName string) (*spool, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.Wrapf(err, "create usage export spool dir %q", dir)
+	}
+	return &spool{path: filepath.Join(dir, sinkName+spoolFileSuffix)}, nil
+}
+
+// append adds events to the end of the spool file.
+func (s *spool) append(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return errors.Wrapf(err, "open usage export spool %q", s.path)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for i := range events {
+		if err = encoder.Encode(&events[i]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Wrapf(err, "write usage export spool %q", s.path)
+}
+
+// take removes and returns every spooled event. Lines that cannot be decoded
+// are skipped, since replaying them could never succeed.
+func (s *spool) take() ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "open usage export spool %q", s.path)
+	}
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if json.Unmarshal(scanner.Bytes(), &event) == nil {
+			events = append(events, event)
+		}
+	}
+	err = scanner.Err()
+	_ = file.Close()
+	if err != nil {
+		return nil, errors.Wrapf(err, "read usage export spool %q", s.path)
+	}
+	if err = os.Remove(s.path); err != nil {
+		return nil, errors.Wrapf(err, "remove usage export spool %q", s.path)
+	}
+	return events, nil
+}
+
+// pending reports whether the spool holds events.
+func (s *spool) pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.path)
+	return err == nil && info.Size() > 0
+}
@@ -0,0 +1,32 @@
+//go:build !unix
+
+package usageexport
+
+import (
+	"context"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// SyslogSink is unavailable on platforms without log/syslog.
+type SyslogSink struct{}
+
+// NewSyslogSink always fails on platforms without log/syslog.
+func NewSyslogSink(network, addr, tag string) (*SyslogSink, error) {
+	return nil, errors.New("usage export syslog sink is not supported on this platform")
+}
+
+// Name implements Sink.
+func (s *SyslogSink) Name() string {
+	return "syslog"
+}
+
+// Write implements Sink.
+func (s *SyslogSink) Write(context.Context, []Event) error {
+	return errors.New("usage export syslog sink is not supported on this platform")
+}
+
+// Close implements Sink.
+func (s *SyslogSink) Close() error {
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build unix
+
+package usageexport
+
+import (
+	"context"
+	"log/syslog"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// SyslogSink writes one JSON line per event at LOG_INFO on facility LOCAL0.
+type SyslogSink struct {
+	mu     sync.Mutex
+	writer *syslog.Writer
+}
+
+// NewSyslogSink dials the syslog daemon. addr "local" uses the local daemon;
+// anything else is a host:port reached over network.
+func NewSyslogSink(network, addr, tag string) (*SyslogSink, error) {
+	if addr == "local" {
+		network, addr = "", ""
+	}
+	writer, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+	if err != nil {
+		return nil, errors.Wrap(err, "dial usage export syslog")
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+// Name implements Sink.
+func (s *SyslogSink) Name() string {
+	return "syslog"
+}
+
+// Write implements Sink. The syslog writer reconnects on its own after a
+// failed write, so the retried batch goes to a fresh connection.
+func (s *SyslogSink) Write(_ context.Context, events []Event) error {
+	lines, err := encodeLines(events)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, line := range lines {
+		if err = s.writer.Info(string(line)); err != nil {
+			return errors.Wrap(err, "write usage export syslog")
+		}
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *SyslogSink) Close() error {
+	return errors.Wrap(s.writer.Close(), "close usage export syslog")
+}
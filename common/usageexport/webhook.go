@@ -0,0 +1,102 @@
+package usageexport
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+)
+
+const (
+	// WebhookTimestampHeader carries the Unix second at which a batch was signed.
+	WebhookTimestampHeader = "X-OneAPI-Timestamp"
+	// WebhookSignatureHeader carries "sha256=<hex>", the HMAC-SHA256 of
+	// "<timestamp>.<body>" under the webhook secret.
+	WebhookSignatureHeader = "X-OneAPI-Signature"
+)
+
+// webhookPayload is the JSON body POSTed for each batch.
+type webhookPayload struct {
+	Events []Event `json:"events"`
+}
+
+// WebhookSink POSTs batches to an HTTP endpoint.
+type WebhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookSink returns a sink that POSTs {"events": [...]} to url, signing
+// every request with WebhookSignatureHeader. Usage events carry billing data,
+// so an unsigned webhook is refused rather than sent.
+//
+// Return values:
+//   - *WebhookSink: the sink.
+//   - error: when secret is empty.
+func NewWebhookSink(url, secret string) (*WebhookSink, error) {
+	if secret == "" {
+		return nil, errors.New("usage export webhook needs USAGE_EXPORT_WEBHOOK_SECRET")
+	}
+	return &WebhookSink{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Name implements Sink.
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+// Write implements Sink. Any status outside 2xx fails the batch.
+func (s *WebhookSink) Write(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(webhookPayload{Events: events})
+	if err != nil {
+		return errors.Wrap(err, "marshal usage events")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "build usage webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookBody(s.secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "post usage webhook")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("usage webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close implements Sink.
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// SignWebhookBody returns the WebhookSignatureHeader value for a body signed
+// at timestamp. Receivers recompute it to verify a batch.
+func SignWebhookBody(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/helper"
+	rcontroller "github.com/Laisky/one-api/relay/controller"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+// batchAPIHandler adapts a files/batches helper into a gin handler. Like the
+// Conversations API these endpoints are owner-scoped CRUD over gateway storage
+// and never enter channel distribution.
+func batchAPIHandler(scope string, fn func(*gin.Context) *relaymodel.ErrorWithStatusCode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if bizErr := fn(c); bizErr != nil {
+			logRelayStateBizError(c, scope, bizErr)
+			requestId := c.GetString(helper.RequestIdKey)
+			bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+			c.JSON(bizErr.StatusCode, gin.H{"error": bizErr.Error})
+		}
+	}
+}
+
+// RelayFileUpload handles POST /v1/files.
+func RelayFileUpload(c *gin.Context) {
+	batchAPIHandler("files", rcontroller.FileUploadHelper)(c)
+}
+
+// RelayFileList handles GET /v1/files.
+func RelayFileList(c *gin.Context) {
+	batchAPIHandler("files", rcontroller.FileListHelper)(c)
+}
+
+// RelayFileGet handles GET /v1/files/{id}.
+func RelayFileGet(c *gin.Context) {
+	batchAPIHandler("files", rcontroller.FileGetHelper)(c)
+}
+
+// RelayFileContent handles GET /v1/files/{id}/content.
+func RelayFileContent(c *gin.Context) {
+	batchAPIHandler("files", rcontroller.FileContentHelper)(c)
+}
+
+// RelayFileDelete handles DELETE /v1/files/{id}.
+func RelayFileDelete(c *gin.Context) {
+	batchAPIHandler("files", rcontroller.FileDeleteHelper)(c)
+}
+
+// RelayBatchCreate handles POST /v1/batches.
+func RelayBatchCreate(c *gin.Context) {
+	batchAPIHandler("batches", rcontroller.BatchCreateHelper)(c)
+}
+
+// RelayBatchList handles GET /v1/batches.
+func RelayBatchList(c *gin.Context) {
+	batchAPIHandler("batches", rcontroller.BatchListHelper)(c)
+}
+
+// RelayBatchGet handles GET /v1/batches/{id}.
+func RelayBatchGet(c *gin.Context) {
+	batchAPIHandler("batches", rcontroller.BatchGetHelper)(c)
+}
+
+// RelayBatchCancel handles POST /v1/batches/{id}/cancel.
+func RelayBatchCancel(c *gin.Context) {
+	batchAPIHandler("batches", rcontroller.BatchCancelHelper)(c)
+}
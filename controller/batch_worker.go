@@ -0,0 +1,443 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/graceful"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/common/random"
+	"github.com/Laisky/one-api/middleware"
+	"github.com/Laisky/one-api/model"
+	rcontroller "github.com/Laisky/one-api/relay/controller"
+)
+
+const (
+	// batchLease is how long a claimed batch stays owned without renewal.
+	batchLease = 2 * time.Minute
+	// batchLeaseRenewInterval must stay well below batchLease.
+	batchLeaseRenewInterval = 30 * time.Second
+	// batchLineMaxAttempts bounds how often a line answered with 429 or 5xx is
+	// relayed before its last response is recorded as the failure.
+	batchLineMaxAttempts = 3
+	// batchLineRetryDelay is the backoff before the first retry of a line; it
+	// doubles on each further attempt.
+	batchLineRetryDelay = 5 * time.Second
+	// batchLineMaxRetryDelay caps the backoff, including one asked for by a
+	// Retry-After header.
+	batchLineMaxRetryDelay = time.Minute
+)
+
+// batchWorker executes queued batches by replaying every input line through
+// the HTTP handler that serves the public API, so each line goes through token
+// auth, channel distribution, retries and billing exactly like a client call.
+type batchWorker struct {
+	handler     http.Handler
+	owner       string
+	concurrency int
+	// retryDelay is the backoff before the first retry of a throttled or
+	// failed line.
+	retryDelay time.Duration
+}
+
+// StartBatchWorker launches the background batch executor. handler must be
+// the fully configured gin engine. Batches are claimed with a lease, so any
+// number of nodes may run the worker.
+func StartBatchWorker(ctx context.Context, handler http.Handler) {
+	if !config.BatchWorkerEnabled {
+		logger.Logger.Info("batch worker disabled")
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	worker := &batchWorker{
+		handler:     handler,
+		owner:       hostname + "-" + random.GetRandomString(8),
+		concurrency: max(config.BatchWorkerConcurrency, 1),
+		retryDelay:  batchLineRetryDelay,
+	}
+	interval := time.Duration(max(config.BatchWorkerPollIntervalSec, 1)) * time.Second
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			worker.runPending(ctx)
+			select {
+			case <-ctx.Done():
+				logger.Logger.Info("batch worker stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	logger.Logger.Info("batch worker started",
+		zap.String("owner", worker.owner),
+		zap.Int("concurrency", worker.concurrency),
+		zap.Duration("poll_interval", interval))
+}
+
+// runPending claims and runs batches until none is left or the process drains.
+func (w *batchWorker) runPending(ctx context.Context) {
+	for !graceful.IsDraining() && ctx.Err() == nil {
+		batch, err := model.ClaimRelayBatch(ctx, w.owner, batchLease)
+		if err != nil {
+			logger.Logger.Warn("failed to claim batch", zap.Error(err))
+			return
+		}
+		if batch == nil {
+			return
+		}
+		w.run(ctx, batch)
+	}
+}
+
+// run processes one claimed batch while keeping its lease alive.
+func (w *batchWorker) run(ctx context.Context, batch *model.RelayBatch) {
+	lg := logger.Logger.With(zap.String("batch_id", batch.BatchId), zap.String("status", batch.Status))
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(batchLeaseRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				if err := model.RenewRelayBatchLease(runCtx, batch.Id, w.owner, batchLease); err != nil {
+					lg.Warn("lost batch lease, stopping", zap.Error(err))
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	if err := w.process(runCtx, batch); err != nil {
+		lg.Warn("batch processing interrupted", zap.Error(err))
+	}
+	if err := model.ReleaseRelayBatchLease(context.WithoutCancel(ctx), batch.Id, w.owner); err != nil {
+		lg.Warn("failed to release batch lease", zap.Error(err))
+	}
+}
+
+// process advances a batch from its current status.
+func (w *batchWorker) process(ctx context.Context, batch *model.RelayBatch) error {
+	switch batch.Status {
+	case model.RelayBatchStatusValidating, model.RelayBatchStatusInProgress:
+		inputFile, err := model.GetRelayFileContent(ctx, batch.UserId, batch.TokenId, batch.InputFileId)
+		if err != nil {
+			return w.fail(ctx, batch, errors.Wrapf(err, "load input file %s", batch.InputFileId))
+		}
+		lines, err := rcontroller.ParseBatchInput(inputFile.Content, batch.Endpoint)
+		if err != nil {
+			return w.fail(ctx, batch, err)
+		}
+		if batch.Status == model.RelayBatchStatusValidating {
+			started, err := model.TransitionRelayBatch(ctx, batch.Id, w.owner, model.RelayBatchStatusValidating, map[string]any{
+				"status":         model.RelayBatchStatusInProgress,
+				"in_progress_at": helper.GetTimestamp(),
+				"request_total":  len(lines),
+			})
+			if err != nil || !started {
+				// Cancelled while validating; the next claim finalizes it.
+				return err
+			}
+		}
+		return w.execute(ctx, batch, lines)
+	case model.RelayBatchStatusFinalizing:
+		return w.finalize(ctx, batch, model.RelayBatchStatusCompleted)
+	case model.RelayBatchStatusCancelling:
+		return w.finalize(ctx, batch, model.RelayBatchStatusCancelled)
+	default:
+		return nil
+	}
+}
+
+// execute relays every line that has no recorded result yet, then finalizes
+// the batch. It stops early, leaving the batch resumable, when the process
+// drains or the lease is lost.
+func (w *batchWorker) execute(ctx context.Context, batch *model.RelayBatch, lines []rcontroller.BatchInputLine) error {
+	done, err := model.GetRelayBatchItemLines(ctx, batch.Id)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, w.concurrency)
+	target := model.RelayBatchStatusCompleted
+	interrupted := false
+	for _, line := range lines {
+		if done[line.Line] {
+			continue
+		}
+		if graceful.IsDraining() || ctx.Err() != nil {
+			interrupted = true
+			break
+		}
+		if helper.GetTimestamp() > batch.ExpiresAt {
+			target = model.RelayBatchStatusExpired
+			break
+		}
+		if status, err := model.GetRelayBatchStatus(ctx, batch.Id); err == nil && status == model.RelayBatchStatusCancelling {
+			target = model.RelayBatchStatusCancelled
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(line rcontroller.BatchInputLine) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			item := w.executeLine(ctx, batch, line)
+			if item == nil {
+				// Interrupted while waiting to retry; the next claim resumes it.
+				return
+			}
+			if err := model.SaveRelayBatchItem(context.WithoutCancel(ctx), item); err != nil {
+				logger.Logger.Warn("failed to save batch line result",
+					zap.String("batch_id", batch.BatchId),
+					zap.Int("line", line.Line),
+					zap.Error(err))
+			}
+		}(line)
+	}
+	wg.Wait()
+	if interrupted {
+		return ctx.Err()
+	}
+
+	if target == model.RelayBatchStatusCompleted {
+		moved, err := model.TransitionRelayBatch(ctx, batch.Id, w.owner, model.RelayBatchStatusInProgress, map[string]any{
+			"status":        model.RelayBatchStatusFinalizing,
+			"finalizing_at": helper.GetTimestamp(),
+		})
+		if err != nil {
+			return err
+		}
+		if !moved {
+			// Cancelled after the last line started; honour the cancellation.
+			target = model.RelayBatchStatusCancelled
+		}
+	}
+	return w.finalize(ctx, batch, target)
+}
+
+// executeLine relays one line in-process and wraps the outcome as an output
+// line. Responses with 429 or 5xx are retried with backoff; other non-2xx
+// responses, and the last retryable one, are recorded as failed and go to the
+// error file. It returns nil when ctx ends while waiting to retry, leaving the
+// line unrecorded so it is relayed again when the batch resumes.
+func (w *batchWorker) executeLine(ctx context.Context, batch *model.RelayBatch, line rcontroller.BatchInputLine) *model.RelayBatchItem {
+	out := rcontroller.BatchOutputLine{
+		Id:       "batch_req_" + random.GetUUID(),
+		CustomId: line.CustomId,
+	}
+	item := &model.RelayBatchItem{BatchId: batch.Id, Line: line.Line, CustomId: line.CustomId}
+
+	reqCtx := middleware.WithInternalRelay(ctx, middleware.InternalRelay{TokenId: batch.TokenId, BatchId: batch.BatchId})
+	var recorder *batchResponseRecorder
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, line.URL, bytes.NewReader(line.Body))
+		if err != nil {
+			out.Error = &rcontroller.BatchOutputError{Code: "internal_error", Message: err.Error()}
+			item.Failed = true
+			break
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "127.0.0.1:0"
+		recorder = newBatchResponseRecorder()
+		w.handler.ServeHTTP(recorder, req)
+
+		if !batchLineRetryable(recorder.statusCode()) || attempt >= batchLineMaxAttempts {
+			break
+		}
+		delay := w.retryBackoff(attempt, recorder.Header().Get("Retry-After"))
+		logger.Logger.Debug("retrying batch line",
+			zap.String("batch_id", batch.BatchId),
+			zap.Int("line", line.Line),
+			zap.Int("status", recorder.statusCode()),
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+
+	if out.Error == nil {
+		body := recorder.body.Bytes()
+		if !json.Valid(body) {
+			body, _ = json.Marshal(string(body))
+		}
+		out.Response = &rcontroller.BatchOutputResponse{
+			StatusCode: recorder.statusCode(),
+			RequestId:  recorder.Header().Get(helper.RequestIdKey),
+			Body:       body,
+		}
+		item.Failed = recorder.statusCode() >= http.StatusMultipleChoices
+	}
+
+	encoded, err := json.Marshal(out)
+	if err != nil {
+		encoded = []byte(`{"custom_id":` + jsonQuote(line.CustomId) + `,"response":null,"error":{"code":"internal_error","message":"failed to encode result"}}`)
+		item.Failed = true
+	}
+	item.Result = string(encoded)
+	return item
+}
+
+// batchLineRetryable reports whether a line answered with status is worth
+// relaying again: rate limits and upstream or gateway errors are transient.
+func batchLineRetryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryBackoff returns the wait before retrying a line after the given attempt.
+// A Retry-After header in seconds wins when it asks for longer; either way the
+// wait is capped at batchLineMaxRetryDelay.
+func (w *batchWorker) retryBackoff(attempt int, retryAfter string) time.Duration {
+	delay := w.retryDelay << (attempt - 1)
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && time.Duration(seconds)*time.Second > delay {
+		delay = time.Duration(seconds) * time.Second
+	}
+	return min(delay, batchLineMaxRetryDelay)
+}
+
+// finalize writes the output and error files and moves the batch to target.
+func (w *batchWorker) finalize(ctx context.Context, batch *model.RelayBatch, target string) error {
+	items, err := model.GetRelayBatchItems(ctx, batch.Id)
+	if err != nil {
+		return err
+	}
+
+	var output, failed bytes.Buffer
+	completedCount, failedCount := 0, 0
+	for _, item := range items {
+		if item.Failed {
+			failed.WriteString(item.Result)
+			failed.WriteByte('\n')
+			failedCount++
+			continue
+		}
+		output.WriteString(item.Result)
+		output.WriteByte('\n')
+		completedCount++
+	}
+
+	var outputFile, errorFile *model.RelayFile
+	if output.Len() > 0 {
+		outputFile = &model.RelayFile{
+			UserId:   batch.UserId,
+			TokenId:  batch.TokenId,
+			Purpose:  model.RelayFilePurposeBatchOutput,
+			Filename: batch.BatchId + "_output.jsonl",
+			Content:  output.Bytes(),
+		}
+	}
+	if failed.Len() > 0 {
+		errorFile = &model.RelayFile{
+			UserId:   batch.UserId,
+			TokenId:  batch.TokenId,
+			Purpose:  model.RelayFilePurposeBatchOutput,
+			Filename: batch.BatchId + "_error.jsonl",
+			Content:  failed.Bytes(),
+		}
+	}
+
+	now := helper.GetTimestamp()
+	updates := map[string]any{
+		"status":            target,
+		"request_completed": completedCount,
+		"request_failed":    failedCount,
+	}
+	switch target {
+	case model.RelayBatchStatusCompleted:
+		updates["completed_at"] = now
+	case model.RelayBatchStatusCancelled:
+		updates["cancelled_at"] = now
+	case model.RelayBatchStatusExpired:
+		updates["expired_at"] = now
+	}
+	if err := model.FinalizeRelayBatch(ctx, batch.Id, w.owner, outputFile, errorFile, updates); err != nil {
+		return err
+	}
+	logger.Logger.Info("batch finalized",
+		zap.String("batch_id", batch.BatchId),
+		zap.String("status", target),
+		zap.Int("completed", completedCount),
+		zap.Int("failed", failedCount))
+	return nil
+}
+
+// fail marks a batch whose input could not be validated as failed.
+func (w *batchWorker) fail(ctx context.Context, batch *model.RelayBatch, cause error) error {
+	encoded, err := json.Marshal([]rcontroller.BatchError{{Code: "invalid_request", Message: cause.Error()}})
+	if err != nil {
+		return errors.Wrap(err, "marshal batch errors")
+	}
+	return model.FinalizeRelayBatch(ctx, batch.Id, w.owner, nil, nil, map[string]any{
+		"status":    model.RelayBatchStatusFailed,
+		"failed_at": helper.GetTimestamp(),
+		"errors":    string(encoded),
+	})
+}
+
+func jsonQuote(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
+
+// batchResponseRecorder is a minimal in-memory http.ResponseWriter for
+// in-process batch requests.
+type batchResponseRecorder struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func newBatchResponseRecorder() *batchResponseRecorder {
+	return &batchResponseRecorder{header: make(http.Header)}
+}
+
+func (r *batchResponseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *batchResponseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+func (r *batchResponseRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+}
+
+// Flush satisfies http.Flusher for handlers that flush eagerly.
+func (r *batchResponseRecorder) Flush() {}
+
+func (r *batchResponseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/middleware"
+	"github.com/Laisky/one-api/model"
+	rcontroller "github.com/Laisky/one-api/relay/controller"
+)
+
+func setupBatchWorkerTest(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.RelayFile{}, &model.RelayBatch{}, &model.RelayBatchItem{}))
+
+	originalDB := model.DB
+	model.DB = db
+	t.Cleanup(func() { model.DB = originalDB })
+}
+
+func TestBatchWorker_RunsLinesThroughHandler(t *testing.T) {
+	setupBatchWorkerTest(t)
+	ctx := context.Background()
+
+	input := strings.Join([]string{
+		`{"custom_id":"ok","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[]}}`,
+		`{"custom_id":"bad","method":"POST","url":"/v1/chat/completions","body":{"model":"missing","messages":[]}}`,
+	}, "\n")
+	inputFile := &model.RelayFile{UserId: 1, TokenId: 7, Purpose: model.RelayFilePurposeBatch, Content: []byte(input)}
+	require.NoError(t, model.CreateRelayFile(ctx, inputFile))
+	batch := &model.RelayBatch{
+		UserId: 1, TokenId: 7,
+		Endpoint:         "/v1/chat/completions",
+		InputFileId:      inputFile.FileId,
+		CompletionWindow: "24h",
+		ExpiresAt:        helper.GetTimestamp() + 3600,
+	}
+	require.NoError(t, model.CreateRelayBatch(ctx, batch))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Runs on the worker goroutine, so use assert rather than require.
+		relay, ok := middleware.InternalRelayFromContext(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, 7, relay.TokenId)
+		assert.Equal(t, batch.BatchId, relay.BatchId)
+
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set(helper.RequestIdKey, "req-1")
+		if strings.Contains(string(body), "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"message":"model not found"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion"}`))
+	})
+	worker := &batchWorker{handler: handler, owner: "test-node", concurrency: 2}
+	worker.runPending(ctx)
+
+	final, err := model.GetRelayBatch(ctx, 1, 7, batch.BatchId)
+	require.NoError(t, err)
+	require.Equal(t, model.RelayBatchStatusCompleted, final.Status)
+	require.Equal(t, 2, final.RequestTotal)
+	require.Equal(t, 1, final.RequestCompleted)
+	require.Equal(t, 1, final.RequestFailed)
+	require.NotZero(t, final.CompletedAt)
+
+	output, err := model.GetRelayFileContent(ctx, 1, 7, final.OutputFileId)
+	require.NoError(t, err)
+	var line rcontroller.BatchOutputLine
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(string(output.Content))), &line))
+	require.Equal(t, "ok", line.CustomId)
+	require.Equal(t, http.StatusOK, line.Response.StatusCode)
+	require.Equal(t, "req-1", line.Response.RequestId)
+	require.JSONEq(t, `{"id":"chatcmpl-1","object":"chat.completion"}`, string(line.Response.Body))
+
+	errorFile, err := model.GetRelayFileContent(ctx, 1, 7, final.ErrorFileId)
+	require.NoError(t, err)
+	require.Contains(t, string(errorFile.Content), `"custom_id":"bad"`)
+	require.Contains(t, string(errorFile.Content), `"status_code":404`)
+}
+
+func TestBatchWorker_FailsInvalidInput(t *testing.T) {
+	setupBatchWorkerTest(t)
+	ctx := context.Background()
+
+	inputFile := &model.RelayFile{UserId: 1, TokenId: 7, Purpose: model.RelayFilePurposeBatch,
+		Content: []byte(`{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":{"input":"x"}}`)}
+	require.NoError(t, model.CreateRelayFile(ctx, inputFile))
+	batch := &model.RelayBatch{UserId: 1, TokenId: 7, Endpoint: "/v1/chat/completions", InputFileId: inputFile.FileId, CompletionWindow: "24h"}
+	require.NoError(t, model.CreateRelayBatch(ctx, batch))
+
+	worker := &batchWorker{handler: http.NotFoundHandler(), owner: "test-node", concurrency: 1}
+	worker.runPending(ctx)
+
+	final, err := model.GetRelayBatch(ctx, 1, 7, batch.BatchId)
+	require.NoError(t, err)
+	require.Equal(t, model.RelayBatchStatusFailed, final.Status)
+	require.Contains(t, final.Errors, "does not match the batch endpoint")
+}
+
+func TestBatchWorker_RetriesThrottledAndFailedLines(t *testing.T) {
+	setupBatchWorkerTest(t)
+	ctx := context.Background()
+
+	input := strings.Join([]string{
+		`{"custom_id":"flaky","method":"POST","url":"/v1/chat/completions","body":{"model":"flaky","messages":[]}}`,
+		`{"custom_id":"down","method":"POST","url":"/v1/chat/completions","body":{"model":"down","messages":[]}}`,
+	}, "\n")
+	inputFile := &model.RelayFile{UserId: 1, TokenId: 7, Purpose: model.RelayFilePurposeBatch, Content: []byte(input)}
+	require.NoError(t, model.CreateRelayFile(ctx, inputFile))
+	batch := &model.RelayBatch{
+		UserId: 1, TokenId: 7,
+		Endpoint:         "/v1/chat/completions",
+		InputFileId:      inputFile.FileId,
+		CompletionWindow: "24h",
+		ExpiresAt:        helper.GetTimestamp() + 3600,
+	}
+	require.NoError(t, model.CreateRelayBatch(ctx, batch))
+
+	var flakyCalls, downCalls atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "down") {
+			downCalls.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":{"message":"upstream unavailable"}}`))
+			return
+		}
+		if flakyCalls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"message":"rate limit exceeded"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion"}`))
+	})
+	worker := &batchWorker{handler: handler, owner: "test-node", concurrency: 2}
+	worker.runPending(ctx)
+
+	require.Equal(t, int32(2), flakyCalls.Load())
+	require.Equal(t, int32(batchLineMaxAttempts), downCalls.Load())
+
+	final, err := model.GetRelayBatch(ctx, 1, 7, batch.BatchId)
+	require.NoError(t, err)
+	require.Equal(t, model.RelayBatchStatusCompleted, final.Status)
+	require.Equal(t, 1, final.RequestCompleted)
+	require.Equal(t, 1, final.RequestFailed)
+
+	errorFile, err := model.GetRelayFileContent(ctx, 1, 7, final.ErrorFileId)
+	require.NoError(t, err)
+	require.Contains(t, string(errorFile.Content), `"custom_id":"down"`)
+	require.Contains(t, string(errorFile.Content), `"status_code":503`)
+}
+
+func TestBatchWorker_RetryBackoff(t *testing.T) {
+	worker := &batchWorker{retryDelay: 5 * time.Second}
+	require.Equal(t, 5*time.Second, worker.retryBackoff(1, ""))
+	require.Equal(t, 10*time.Second, worker.retryBackoff(2, ""))
+	require.Equal(t, 30*time.Second, worker.retryBackoff(1, "30"), "Retry-After asks for longer")
+	require.Equal(t, 5*time.Second, worker.retryBackoff(1, "1"))
+	require.Equal(t, batchLineMaxRetryDelay, worker.retryBackoff(1, "3600"))
+}
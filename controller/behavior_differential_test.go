@@ -40,8 +40,9 @@ import (
 // the last commit before this refactor) and are replayed on the POST-refactor
 // tree: a zero diff is the mechanical proof that relocating the external JSON
 // contract from model-level MarshalJSON methods to boundary dto.*Response
-// mappers changed no observable behavior. 78 of 81 cases are such a zero diff;
-// the 3 exceptions are recorded in behaviorDiffKnownDeviations below.
+// mappers changed no observable behavior. 78 of 81 cases were such a zero diff;
+// the 3 exceptions are recorded in behaviorDiffKnownDeviations below, together
+// with the token cases whose key is masked since keys are hashed at rest.
 //
 // The file deliberately references only handler funcs, model entity
 // types/constants, common/* helpers, gin, httptest, testify and the stdlib, and
@@ -50,10 +51,9 @@ import (
 // worktree to generate the baselines in the first place; keeping it means the
 // capture can be reproduced from scratch rather than taken on trust.
 //
-// Caveat when replaying in a pre-refactor worktree: the 3 cases listed in
+// Caveat when replaying in a pre-refactor worktree: the cases listed in
 // behaviorDiffKnownDeviations assert POST-refactor expectations and will fail
 // there, correctly reporting that the output matches the pre-refactor baseline.
-// The other 78 pass on both trees.
 //
 // Regenerate the baselines with:
 //
@@ -100,9 +100,30 @@ var behaviorDiffKnownDeviations = map[string]string{
 	"user/register_wrong_type_unbound_field":    behaviorDiffUnboundFieldReason,
 	"user/create_wrong_type_unbound_field":      behaviorDiffUnboundFieldReason,
 	"user/update_self_wrong_type_unbound_field": behaviorDiffUnboundFieldReason,
+	"token/get_all":           behaviorDiffHashedKeyReason,
+	"token/search":            behaviorDiffHashedKeyReason,
+	"token/get_by_uuid":       behaviorDiffHashedKeyReason,
+	"token/consume_single":    behaviorDiffHashedKeyReason,
+	"token/update":            behaviorDiffHashedKeyReason,
+	"token/admin_get_all":     behaviorDiffHashedKeyReason,
+	"token/admin_search":      behaviorDiffHashedKeyReason,
+	"token/admin_get_by_uuid": behaviorDiffHashedKeyReason,
+	"channel/update":          behaviorDiffMaskedChannelSecretReason,
 }
 
-// behaviorDiffUnboundFieldReason documents the single accepted I2 deviation.
+// behaviorDiffHashedKeyReason documents the token key masking deviation.
+const behaviorDiffHashedKeyReason = "" +
+	"Token keys are stored only as an HMAC plus an 8-character display prefix, " +
+	"so every response except the creation one carries the masked key " +
+	"(\"sk-<prefix>...\") instead of the full plaintext key."
+
+// behaviorDiffMaskedChannelSecretReason documents the channel credential masking deviation.
+const behaviorDiffMaskedChannelSecretReason = "" +
+	"Channel credentials are encrypted at rest and never returned in plaintext, " +
+	"so the channel echoed by UpdateChannel carries the \"******\" mask instead " +
+	"of its key; only a root GetChannel with reveal_secrets=true returns it."
+
+// behaviorDiffUnboundFieldReason documents the accepted I2 deviation.
 const behaviorDiffUnboundFieldReason = "" +
 	"Register/CreateUser/UpdateSelf used to decode into model.User, so a type " +
 	"mismatch on ANY of its JSON-tagged fields — including fields the handler " +
@@ -171,6 +192,15 @@ type behaviorDiffReplacement struct {
 type behaviorDiffNormalizer struct {
 	strs []behaviorDiffReplacement
 	nums []behaviorDiffReplacement
+	keys []behaviorDiffTokenKey
+}
+
+// behaviorDiffTokenKey identifies a generated token key that is stored only as
+// its display prefix and hash, so it cannot be read back from the row verbatim.
+type behaviorDiffTokenKey struct {
+	prefix      string
+	hash        string
+	placeholder string
 }
 
 // addString registers a string value whose every occurrence (including inside a
@@ -187,6 +217,22 @@ func (n *behaviorDiffNormalizer) addString(value, placeholder string) {
 	n.strs = append(n.strs, behaviorDiffReplacement{value: value, placeholder: placeholder})
 }
 
+// addTokenKey registers a generated token key by its stored display prefix and
+// hash. A response string that contains the prefix and whose tail from there
+// hashes to the stored value has that tail rewritten to placeholder.
+// Parameters:
+//   - prefix: the stored key_prefix of the token row.
+//   - hash: the stored key_hash of the token row.
+//   - placeholder: the stable token written to the baseline.
+//
+// Return values: none.
+func (n *behaviorDiffNormalizer) addTokenKey(prefix, hash, placeholder string) {
+	if prefix == "" || hash == "" {
+		return
+	}
+	n.keys = append(n.keys, behaviorDiffTokenKey{prefix: prefix, hash: hash, placeholder: placeholder})
+}
+
 // addNumber registers a numeric value that is rewritten to placeholder on an
 // exact match of its JSON text.
 // Parameters:
@@ -256,6 +302,11 @@ func (n *behaviorDiffNormalizer) apply(v any) any {
 		return typed
 	case string:
 		out := typed
+		for _, k := range n.keys {
+			if idx := strings.Index(out, k.prefix); idx >= 0 && model.HashTokenKey(out[idx:]) == k.hash {
+				out = out[:idx] + k.placeholder
+			}
+		}
 		for _, r := range n.sortedStrings() {
 			out = strings.ReplaceAll(out, r.value, r.placeholder)
 		}
@@ -880,7 +931,7 @@ func behaviorDiffNormalizeToken(t *testing.T, name string, n *behaviorDiffNormal
 	var row model.Token
 	require.NoError(t, model.DB.Where("name = ?", name).First(&row).Error)
 	n.addString(row.UUID, "<new-token-uuid>")
-	n.addString(row.Key, "<new-token-key>")
+	n.addTokenKey(row.KeyPrefix, row.KeyHash, "<new-token-key>")
 	n.addNumber(row.CreatedTime, "<ts>")
 	n.addNumber(row.AccessedTime, "<ts>")
 	n.addNumber(row.CreatedAt, "<ts-milli>")
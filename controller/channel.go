@@ -16,9 +16,12 @@ import (
 
 	"github.com/Laisky/one-api/common"
 	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
 	"github.com/Laisky/one-api/common/errkind"
 	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/identity"
 	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/monitor"
 	"github.com/Laisky/one-api/relay"
 	"github.com/Laisky/one-api/relay/adaptor"
 	"github.com/Laisky/one-api/relay/channeltype"
@@ -190,6 +193,7 @@ func cloneChannelForDuplicate(source *model.Channel) *model.Channel {
 }
 
 // buildChannelResponsePayload renders a channel response with strict external identifiers and optional tooling JSON.
+// The channel key and config credentials are always masked.
 // Parameters:
 //   - lg: request-scoped logger used for non-fatal tooling serialization diagnostics.
 //   - c: current request context used for channel configuration logging.
@@ -202,7 +206,7 @@ func buildChannelResponsePayload(c *gin.Context, lg glog.Logger, channel *model.
 	// Build from the explicit boundary DTO (byte-identical to the retired
 	// Channel.MarshalJSON) so the internal integer id never crosses the API, then
 	// splice the optional tooling JSON as before.
-	if payload, err := json.Marshal(channel.ToResponse()); err == nil {
+	if payload, err := json.Marshal(channel.WithMaskedSecrets().ToResponse()); err == nil {
 		if err = json.Unmarshal(payload, &response); err != nil && lg != nil {
 			lg.Error("failed to unmarshal channel response payload", append(channel.Ref().Zap(), zap.Error(err))...)
 		}
@@ -294,15 +298,37 @@ func GetChannel(c *gin.Context) {
 		helper.RespondError(c, err)
 		return
 	}
-	channel, err := model.GetChannelById(id, false)
+	// Credentials come back masked unless a root user explicitly asks for them.
+	revealSecrets := c.Query("reveal_secrets") == "true"
+	if revealSecrets && c.GetInt(ctxkey.Role) < model.RoleRootUser {
+		helper.RespondError(c, errkind.ForbiddenErr(errors.New("only root users can reveal channel secrets")))
+		return
+	}
+	channel, err := model.GetChannelById(id, revealSecrets)
 	if err != nil {
 		helper.RespondError(c, err)
 		return
 	}
+	payload := buildChannelResponsePayload(c, lg, channel)
+	if revealSecrets {
+		revealed, err := channel.WithRevealedSecrets()
+		if err != nil {
+			helper.RespondError(c, errors.Wrapf(err, "decrypt secrets of channel %d", channel.Id))
+			return
+		}
+		if response, ok := payload.(gin.H); ok {
+			response["key"] = revealed.Key
+			response["config"] = revealed.Config
+		}
+		if lg != nil {
+			lg.Info("channel secrets revealed",
+				append(channel.Ref().Zap(), zap.Int("user_id", c.GetInt(ctxkey.Id)))...)
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    buildChannelResponsePayload(c, lg, channel),
+		"data":    payload,
 	})
 }
 
@@ -363,6 +389,11 @@ func AddChannel(c *gin.Context) {
 		}
 	}
 
+	if err := channel.ValidateMockConfig(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+
 	if toolingCfg, provided, err := parseToolingConfigPayload(toolingRaw); err != nil {
 		helper.RespondError(c, errkind.InvalidRequestErr(errors.New("Invalid tooling config: "+err.Error())))
 		return
@@ -374,6 +405,28 @@ func AddChannel(c *gin.Context) {
 	}
 
 	prepareChannelForCreate(channel)
+	poolKeys, err := syncChannelKeyPool(channel)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if channel.UsesKeyPool() {
+		// A pooled channel keeps every key line in one channel row's key pool
+		// instead of fanning out into one channel per key.
+		if len(poolKeys) == 0 {
+			helper.RespondError(c, errkind.InvalidRequestErr(errors.New("A key pool requires at least one key")))
+			return
+		}
+		if err := channel.InsertWithKeyPool(poolKeys); err != nil {
+			helper.RespondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+		})
+		return
+	}
 	keys := strings.Split(channel.Key, "\n")
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
@@ -415,6 +468,7 @@ func DeleteChannel(c *gin.Context) {
 		helper.RespondError(c, err)
 		return
 	}
+	monitor.ResetChannelHealth(id)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -484,6 +538,11 @@ func UpdateChannel(c *gin.Context) {
 		return
 	}
 
+	if err := channel.ValidateMockConfig(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+
 	if toolingCfg, provided, err := parseToolingConfigPayload(toolingRaw); err != nil {
 		helper.RespondError(c, errkind.InvalidRequestErr(errors.New("Invalid tooling config: "+err.Error())))
 		return
@@ -494,11 +553,25 @@ func UpdateChannel(c *gin.Context) {
 		}
 	}
 
+	poolKeys, err := syncChannelKeyPool(channel)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+
 	err = channel.UpdateWithContext(gmw.Ctx(c))
 	if err != nil {
 		helper.RespondError(c, err)
 		return
 	}
+	if len(poolKeys) > 0 {
+		// Key lines submitted while the pool is enabled join the pool; keys
+		// already in it are skipped.
+		if _, err := model.AddChannelKeys(gmw.Ctx(c), channel.Id, poolKeys); err != nil {
+			helper.RespondError(c, identity.Tag(err, channel.Ref()))
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
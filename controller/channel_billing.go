@@ -19,6 +19,7 @@ import (
 	"github.com/Laisky/one-api/model"
 	"github.com/Laisky/one-api/monitor"
 	"github.com/Laisky/one-api/relay/channeltype"
+	"github.com/Laisky/one-api/relay/meta"
 )
 
 // https://github.com/Laisky/one-api/issues/79
@@ -312,6 +313,11 @@ func updateChannelOpenRouterBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelBalance(channel *model.Channel) (float64, error) {
+	// Balance endpoints authenticate with the upstream key, so decrypt it.
+	channel, err := meta.RevealChannelSecrets(channel)
+	if err != nil {
+		return 0, errors.Wrap(err, "balance query")
+	}
 	baseURL := channeltype.ChannelBaseURLs[channel.Type]
 	if channel.GetBaseURL() == "" {
 		channel.BaseURL = &baseURL
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/monitor"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+// GetChannelHealth lists the rolling health score of every (channel, model)
+// pair this instance has relayed, optionally filtered by the model query.
+func GetChannelHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    monitor.ChannelHealthToResponses(gmw.Ctx(c), monitor.ListChannelHealth(0, strings.TrimSpace(c.Query("model")))),
+	})
+}
+
+// GetChannelHealthById lists the health score of each model served by the
+// channel identified by the path parameter.
+func GetChannelHealthById(c *gin.Context) {
+	id, err := resolveChannelRef(c.Param("id"))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    monitor.ChannelHealthToResponses(gmw.Ctx(c), monitor.ListChannelHealth(id, strings.TrimSpace(c.Query("model")))),
+	})
+}
+
+// recordChannelHealth feeds the outcome of one relay attempt into the health
+// score of the channel and served model bound on c. Failures caused by the
+// client, such as invalid requests or disconnects, say nothing about the
+// channel and are not recorded.
+//
+// Latencies are measured from the last upstream request of the attempt, so
+// request conversion and the gateway's own retries are left out. A
+// non-streaming attempt is timed until the upstream response arrived, a stream
+// until it ended; its time to first byte is taken when the client received the
+// first chunk. Attempts that never reached upstream through adaptor.DoRequest
+// are recorded without latency.
+func recordChannelHealth(c *gin.Context, attemptStart time.Time, isStream bool, bizErr *relaymodel.ErrorWithStatusCode) {
+	if bizErr != nil && !isChannelHealthFailure(bizErr) {
+		return
+	}
+	servedModel := c.GetString(ctxkey.ServedModel)
+	if servedModel == "" {
+		servedModel = c.GetString(ctxkey.RequestModel)
+	}
+
+	var latency, ttft time.Duration
+	if sentAt, ok := contextTime(c, ctxkey.UpstreamRequestAt); ok && !sentAt.Before(attemptStart) {
+		if !isStream {
+			if respondedAt, ok := contextTime(c, ctxkey.UpstreamResponseAt); ok && respondedAt.After(sentAt) {
+				latency = respondedAt.Sub(sentAt)
+			}
+		} else {
+			latency = time.Since(sentAt)
+			if at, ok := contextTime(c, ctxkey.FirstResponseAt); ok && at.After(sentAt) {
+				ttft = at.Sub(sentAt)
+			}
+		}
+	}
+	monitor.RecordChannelHealth(c.GetInt(ctxkey.ChannelId), servedModel, bizErr == nil, latency, ttft)
+}
+
+// contextTime returns the time.Time stored on c under key.
+func contextTime(c *gin.Context, key string) (time.Time, bool) {
+	value, ok := c.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	at, ok := value.(time.Time)
+	return at, ok
+}
+
+// isChannelHealthFailure reports whether a failed attempt counts against the
+// channel: server errors, rate limits, credential rejections, timeouts and
+// transport failures do; other client errors are the request's fault.
+func isChannelHealthFailure(bizErr *relaymodel.ErrorWithStatusCode) bool {
+	if isUserOriginatedRelayError(bizErr) {
+		return false
+	}
+	switch status := bizErr.StatusCode; {
+	case status < http.StatusBadRequest, status >= http.StatusInternalServerError:
+		return true
+	case status == http.StatusUnauthorized, status == http.StatusForbidden,
+		status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
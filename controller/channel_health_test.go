@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/monitor"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+func TestRecordChannelHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	prevWindow := config.ChannelHealthWindow
+	config.ChannelHealthWindow = 10
+	monitor.ResetChannelHealth(0)
+	t.Cleanup(func() {
+		config.ChannelHealthWindow = prevWindow
+		monitor.ResetChannelHealth(0)
+	})
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(ctxkey.ChannelId, 7)
+	c.Set(ctxkey.RequestModel, "gpt-4o")
+	c.Set(ctxkey.ServedModel, "gpt-4o-mini")
+	start := time.Now().Add(-2 * time.Second)
+	c.Set(ctxkey.UpstreamRequestAt, start.Add(100*time.Millisecond))
+	c.Set(ctxkey.UpstreamResponseAt, start.Add(400*time.Millisecond))
+	c.Set(ctxkey.FirstResponseAt, start.Add(600*time.Millisecond))
+
+	recordChannelHealth(c, start, true, nil)
+	recordChannelHealth(c, start, true, &relaymodel.ErrorWithStatusCode{StatusCode: http.StatusBadGateway})
+	recordChannelHealth(c, start, true, &relaymodel.ErrorWithStatusCode{StatusCode: http.StatusTooManyRequests})
+	// Client mistakes do not count against the channel.
+	recordChannelHealth(c, start, true, &relaymodel.ErrorWithStatusCode{StatusCode: http.StatusBadRequest})
+	recordChannelHealth(c, start, true, &relaymodel.ErrorWithStatusCode{StatusCode: http.StatusNotFound})
+
+	health := monitor.ListChannelHealth(7, "")
+	require.Len(t, health, 1)
+	require.Equal(t, "gpt-4o-mini", health[0].Model, "outcomes are keyed by the served model")
+	require.Equal(t, 3, health[0].Samples)
+	require.InDelta(t, 1.0/3, health[0].SuccessRate, 1e-9)
+	require.Equal(t, 500*time.Millisecond, health[0].P95TTFT, "time to first byte starts at the upstream request")
+	require.GreaterOrEqual(t, health[0].P95Latency, 1900*time.Millisecond)
+
+	// A non-streaming attempt is timed by the upstream response alone, not by
+	// the attempts and conversion before it.
+	c.Set(ctxkey.ChannelId, 8)
+	recordChannelHealth(c, start, false, nil)
+	health = monitor.ListChannelHealth(8, "")
+	require.Len(t, health, 1)
+	require.Equal(t, 300*time.Millisecond, health[0].P95Latency)
+	require.Zero(t, health[0].P95TTFT)
+
+	// Upstream timestamps left over from an earlier attempt are ignored.
+	c.Set(ctxkey.ChannelId, 9)
+	recordChannelHealth(c, start.Add(time.Second), false, nil)
+	health = monitor.ListChannelHealth(9, "")
+	require.Len(t, health, 1)
+	require.Equal(t, 1, health[0].Samples)
+	require.Zero(t, health[0].P95Latency)
+}
@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/identity"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/monitor"
+)
+
+// channelKeysRequest is the payload accepted by AddChannelKeys. Keys holds one
+// credential per line, matching the multi-line key field of AddChannel.
+type channelKeysRequest struct {
+	Keys string `json:"keys"`
+}
+
+// channelKeyStatusRequest is the payload accepted by UpdateChannelKey.
+type channelKeyStatusRequest struct {
+	Status int `json:"status"`
+}
+
+// loadPooledChannel resolves the :id path parameter to a channel that uses a key pool.
+func loadPooledChannel(c *gin.Context) (*model.Channel, error) {
+	id, err := resolveChannelRef(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		return nil, err
+	}
+	if !channel.UsesKeyPool() {
+		return nil, identity.Tag(
+			errkind.InvalidRequestErr(errors.New("channel does not use a key pool; set key_selection_mode in its config first")),
+			channel.Ref())
+	}
+	return channel, nil
+}
+
+// syncChannelKeyPool prepares a pooled channel payload before it is persisted:
+// it validates the selection mode and keeps only the first line as the legacy
+// Channel.Key. It returns the key lines carried by the payload, which callers
+// add to the pool.
+func syncChannelKeyPool(channel *model.Channel) ([]string, error) {
+	mode := channel.KeySelectionMode()
+	if !model.IsValidKeySelectionMode(mode) {
+		return nil, errkind.InvalidRequestErr(errors.Errorf("invalid key_selection_mode %q", mode))
+	}
+	if mode == "" {
+		return nil, nil
+	}
+	keys := model.SplitChannelKeys(channel.Key)
+	if len(keys) > 0 {
+		channel.Key = keys[0]
+	}
+	return keys, nil
+}
+
+// GetChannelKeys lists the key pool of a channel with masked credentials.
+func GetChannelKeys(c *gin.Context) {
+	channel, err := loadPooledChannel(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	keys, err := model.GetChannelKeys(gmw.Ctx(c), channel.Id)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.ChannelKeysToResponses(keys),
+	})
+}
+
+// AddChannelKeys appends one or more keys (newline separated) to a channel's pool.
+func AddChannelKeys(c *gin.Context) {
+	channel, err := loadPooledChannel(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	var req channelKeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.RespondError(c, errkind.InvalidRequestErr(err))
+		return
+	}
+	keys := model.SplitChannelKeys(req.Keys)
+	if len(keys) == 0 {
+		helper.RespondError(c, errkind.InvalidRequestErr(errors.New("at least one key is required")))
+		return
+	}
+	added, err := model.AddChannelKeys(gmw.Ctx(c), channel.Id, keys)
+	if err != nil {
+		helper.RespondError(c, identity.Tag(err, channel.Ref()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.ChannelKeysToResponses(added),
+	})
+}
+
+// UpdateChannelKey enables or disables a single pooled key. Re-enabling a key
+// also clears any active suspension.
+func UpdateChannelKey(c *gin.Context) {
+	channel, err := loadPooledChannel(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	key, err := model.GetChannelKeyByUUID(gmw.Ctx(c), channel.Id, c.Param("key_id"))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	var req channelKeyStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.RespondError(c, errkind.InvalidRequestErr(err))
+		return
+	}
+	if req.Status != model.ChannelKeyStatusEnabled && req.Status != model.ChannelKeyStatusManuallyDisabled {
+		helper.RespondError(c, errkind.InvalidRequestErr(errors.Errorf("unsupported key status %d", req.Status)))
+		return
+	}
+	if err := model.UpdateChannelKeyStatus(gmw.Ctx(c), key.Id, req.Status); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	key.Status = req.Status
+	if req.Status == model.ChannelKeyStatusEnabled {
+		key.SuspendUntil = nil
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    key.ToResponse(),
+	})
+}
+
+// DeleteChannelKey removes a single key from a channel's pool.
+func DeleteChannelKey(c *gin.Context) {
+	channel, err := loadPooledChannel(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	key, err := model.GetChannelKeyByUUID(gmw.Ctx(c), channel.Id, c.Param("key_id"))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := model.DeleteChannelKey(gmw.Ctx(c), key.Id); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// TestChannelKey probes a single pooled key with the channel's test model. A
+// successful probe re-enables a key the health policy had auto-disabled.
+func TestChannelKey(c *gin.Context) {
+	lg := gmw.GetLogger(c).Named("test_channel_key")
+	channel, err := loadPooledChannel(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	key, err := model.GetChannelKeyByUUID(gmw.Ctx(c), channel.Id, c.Param("key_id"))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	pinned, err := channel.WithSingleKey(key)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+
+	lg = lg.With(append(channel.Ref().Zap(), zap.String("channel_key_uuid", key.UUID))...)
+	modelName, _, err := chooseChannelTestModelWithContext(gmw.Ctx(c), pinned, c.Query("model"))
+	if err != nil {
+		helper.RespondError(c, identity.Tag(err, channel.Ref()))
+		return
+	}
+
+	ctx := gmw.SetLogger(c, lg)
+	tik := time.Now()
+	responseMessage, err, openaiErr := testChannel(ctx, pinned, buildTestRequest(modelName))
+	consumedTime := time.Since(tik).Seconds()
+	if err != nil || openaiErr != nil {
+		msg := ""
+		if err != nil {
+			msg = err.Error()
+		} else {
+			msg = openaiErr.Message
+		}
+		if recordErr := model.RecordChannelKeyOutcome(ctx, key.Id, false, msg); recordErr != nil {
+			lg.Warn("failed to record channel key test failure", zap.Error(recordErr))
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success":   false,
+			"message":   msg,
+			"time":      0.0,
+			"modelName": modelName,
+		})
+		return
+	}
+
+	if recordErr := model.RecordChannelKeyOutcome(ctx, key.Id, true, ""); recordErr != nil {
+		lg.Warn("failed to record channel key test success", zap.Error(recordErr))
+	}
+	if key.Status != model.ChannelKeyStatusManuallyDisabled &&
+		(key.Status == model.ChannelKeyStatusAutoDisabled || key.SuspendUntil != nil) {
+		if err := model.UpdateChannelKeyStatus(ctx, key.Id, model.ChannelKeyStatusEnabled); err != nil {
+			lg.Error("failed to re-enable channel key after successful test", zap.Error(err))
+		} else {
+			lg.Info("channel key re-enabled after successful test")
+			// A pool whose keys were all auto-disabled takes the channel down
+			// with it; a recovered key brings the channel back.
+			if channel.Status == model.ChannelStatusAutoDisabled {
+				monitor.EnableChannel(channel.Id, channel.Name)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"message":   responseMessage,
+		"time":      consumedTime,
+		"modelName": modelName,
+	})
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/model"
+)
+
+func setupChannelKeyControllerTest(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Channel{}, &model.Ability{}, &model.ChannelKey{}))
+
+	originalDB := model.DB
+	originalUsingSQLite := common.UsingSQLite.Load()
+	model.DB = db
+	common.UsingSQLite.Store(true)
+	t.Cleanup(func() {
+		model.DB = originalDB
+		common.UsingSQLite.Store(originalUsingSQLite)
+	})
+
+	router := gin.New()
+	router.POST("/api/channel/", AddChannel)
+	router.GET("/api/channel/:id/keys", GetChannelKeys)
+	router.POST("/api/channel/:id/keys", AddChannelKeys)
+	router.PUT("/api/channel/:id/keys/:key_id", UpdateChannelKey)
+	return router
+}
+
+func serveChannelKeyRequest(t *testing.T, router *gin.Engine, method, path string, body any) map[string]any {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, reader)
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &payload), recorder.Body.String())
+	return payload
+}
+
+func TestAddChannel_KeyPoolCreatesSingleChannel(t *testing.T) {
+	router := setupChannelKeyControllerTest(t)
+
+	payload := serveChannelKeyRequest(t, router, http.MethodPost, "/api/channel/", map[string]any{
+		"name":   "pooled",
+		"type":   1,
+		"key":    "sk-pool-key-000001\nsk-pool-key-000002\n",
+		"models": "gpt-4o",
+		"group":  "default",
+		"config": `{"key_selection_mode":"round_robin"}`,
+	})
+	require.Equal(t, true, payload["success"], payload)
+
+	var channels []model.Channel
+	require.NoError(t, model.DB.Find(&channels).Error)
+	require.Len(t, channels, 1)
+	require.Equal(t, "sk-pool-key-000001", channels[0].Key)
+
+	keysPayload := serveChannelKeyRequest(t, router, http.MethodGet, "/api/channel/"+channels[0].UUID+"/keys", nil)
+	require.Equal(t, true, keysPayload["success"], keysPayload)
+	rows, ok := keysPayload["data"].([]any)
+	require.True(t, ok)
+	require.Len(t, rows, 2)
+	first := rows[0].(map[string]any)
+	require.NotContains(t, first, "key")
+	require.NotContains(t, first, "id")
+	require.NotContains(t, first["masked_key"], "000001")
+
+	keyUUID := first["uuid"].(string)
+	updatePayload := serveChannelKeyRequest(t, router, http.MethodPut,
+		"/api/channel/"+channels[0].UUID+"/keys/"+keyUUID,
+		map[string]any{"status": model.ChannelKeyStatusManuallyDisabled})
+	require.Equal(t, true, updatePayload["success"], updatePayload)
+
+	enabled, err := model.CountEnabledChannelKeys(t.Context(), channels[0].Id)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, enabled)
+}
+
+func TestAddChannel_RejectsUnknownKeySelectionMode(t *testing.T) {
+	router := setupChannelKeyControllerTest(t)
+
+	payload := serveChannelKeyRequest(t, router, http.MethodPost, "/api/channel/", map[string]any{
+		"name":   "pooled",
+		"type":   1,
+		"key":    "k1\nk2",
+		"models": "gpt-4o",
+		"config": `{"key_selection_mode":"fastest"}`,
+	})
+	require.Equal(t, false, payload["success"])
+
+	var count int64
+	require.NoError(t, model.DB.Model(&model.Channel{}).Count(&count).Error)
+	require.Zero(t, count)
+}
+
+func TestChannelKeyEndpoints_RequireKeyPool(t *testing.T) {
+	router := setupChannelKeyControllerTest(t)
+	channel := &model.Channel{Name: "plain", Key: "sk-plain", Models: "gpt-4o", Group: "default"}
+	require.NoError(t, model.DB.Create(channel).Error)
+
+	payload := serveChannelKeyRequest(t, router, http.MethodPost, "/api/channel/"+channel.UUID+"/keys",
+		map[string]any{"keys": "sk-extra"})
+	require.Equal(t, false, payload["success"])
+}
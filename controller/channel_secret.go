@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"net/http"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/relayctx"
+	"github.com/Laisky/one-api/model"
+)
+
+// GetChannelSecretStatus reports how stored channel credentials are encrypted
+// and the progress of the latest re-encryption job.
+func GetChannelSecretStatus(c *gin.Context) {
+	status, err := model.GetChannelSecretStatus(gmw.Ctx(c))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    status,
+	})
+}
+
+// ReencryptChannelSecrets starts a background job that moves every channel
+// credential onto the primary CHANNEL_SECRET_KEYS entry. Poll
+// GetChannelSecretStatus for its progress.
+func ReencryptChannelSecrets(c *gin.Context) {
+	if err := model.StartChannelSecretReencryption(relayctx.Detach(c)); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
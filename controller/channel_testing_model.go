@@ -127,7 +127,7 @@ func buildChannelListResponse(channels []*model.Channel) []channelListItem {
 		// channelTextTestModels always returns a non-nil slice, so test_models
 		// serializes as [] (never null) when empty — matching the old splicer.
 		items = append(items, channelListItem{
-			ChannelResponse: channel.ToResponse(),
+			ChannelResponse: channel.WithMaskedSecrets().ToResponse(),
 			TestModels:      channelTextTestModels(channel),
 		})
 	}
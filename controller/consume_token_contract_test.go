@@ -72,7 +72,8 @@ var (
 	// consumeTokenContractForbiddenKeys must never appear at any depth of a
 	// ConsumeToken response: internal integer identifiers and user secrets.
 	// Note `key` is deliberately absent from this list — the token key is part
-	// of the frozen contract, returned (prefixed) to the token's own bearer.
+	// of the frozen contract, returned (prefixed and masked) to the token's own
+	// bearer.
 	consumeTokenContractForbiddenKeys = []string{
 		"access_token",
 		"id",
@@ -279,12 +280,13 @@ func TestConsumeTokenResponseContract(t *testing.T) {
 			require.Equal(t, tc.expectStatus, txn["status"])
 
 			// 6. `key` is part of the frozen contract: the caller's own token
-			// key, returned with the configured prefix applied at response time.
+			// key, masked to its stored display prefix, with the configured
+			// prefix applied at response time.
 			prefix := config.TokenKeyPrefix
 			if prefix == "" {
 				prefix = "sk-"
 			}
-			require.Equal(t, prefix+token.Key, data["key"])
+			require.Equal(t, prefix+token.KeyPrefix+"...", data["key"])
 
 			// 7. Guard against an integer id sneaking back in under any name:
 			// the seeded ids are 1/1, and no bare `1` may appear as a value.
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/middleware"
+	"github.com/Laisky/one-api/relay/contextfit"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+// contextSummaryPath is the relay route context summary calls go through.
+const contextSummaryPath = "/v1/chat/completions"
+
+// summaryResponse is the subset of a chat completion response the context
+// summarizer reads.
+type summaryResponse struct {
+	Choices []struct {
+		Message relaymodel.Message `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// StartContextSummarizer lets the summarize context strategy call the chat
+// completions relay. handler must be the fully configured gin engine: each
+// call is replayed through it in-process as the client request's token, so it
+// is routed, billed and logged like a client request, with the client request
+// id recorded as its parent.
+func StartContextSummarizer(handler http.Handler) {
+	contextfit.SetSummarizer(func(ctx context.Context, req contextfit.SummaryRequest) (*contextfit.SummaryResult, error) {
+		return summarizeThroughRelay(ctx, handler, req)
+	})
+}
+
+func summarizeThroughRelay(ctx context.Context, handler http.Handler, req contextfit.SummaryRequest) (*contextfit.SummaryResult, error) {
+	payload, err := json.Marshal(relaymodel.GeneralOpenAIRequest{
+		Model:     req.Model,
+		Messages:  req.Messages,
+		MaxTokens: req.MaxTokens,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "encode summary request")
+	}
+	reqCtx := middleware.WithInternalRelay(ctx, middleware.InternalRelay{
+		TokenId:         req.TokenId,
+		ContextSummary:  true,
+		ParentRequestId: req.ParentRequestId,
+	})
+	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, contextSummaryPath, bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "build summary request")
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.RemoteAddr = "127.0.0.1:0"
+
+	recorder := newBatchResponseRecorder()
+	handler.ServeHTTP(recorder, httpReq)
+
+	var resp summaryResponse
+	if err := json.Unmarshal(recorder.body.Bytes(), &resp); err != nil {
+		return nil, errors.Wrapf(err, "decode summary response with status %d", recorder.statusCode())
+	}
+	if recorder.statusCode() != http.StatusOK {
+		message := http.StatusText(recorder.statusCode())
+		if resp.Error != nil && resp.Error.Message != "" {
+			message = resp.Error.Message
+		}
+		return nil, errors.Errorf("summary request failed with status %d: %s", recorder.statusCode(), message)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("summary response has no choices")
+	}
+	return &contextfit.SummaryResult{
+		Summary:   resp.Choices[0].Message.StringContent(),
+		RequestId: recorder.Header().Get(helper.RequestIdKey),
+	}, nil
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/middleware"
+	"github.com/Laisky/one-api/relay/contextfit"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+func TestSummarizeThroughRelay(t *testing.T) {
+	var seen middleware.InternalRelay
+	var body relaymodel.GeneralOpenAIRequest
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, contextSummaryPath, r.URL.Path)
+		seen, _ = middleware.InternalRelayFromContext(r.Context())
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set(helper.RequestIdKey, "summary-req")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"The user is planning a trip."}}]}`))
+	})
+
+	result, err := summarizeThroughRelay(context.Background(), handler, contextfit.SummaryRequest{
+		TokenId:         42,
+		ParentRequestId: "client-req",
+		Model:           "gpt-4o-mini",
+		MaxTokens:       256,
+		Messages:        []relaymodel.Message{{Role: "user", Content: "user: hi"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &contextfit.SummaryResult{Summary: "The user is planning a trip.", RequestId: "summary-req"}, result)
+	require.Equal(t, middleware.InternalRelay{TokenId: 42, ContextSummary: true, ParentRequestId: "client-req"}, seen)
+	require.Equal(t, "gpt-4o-mini", body.Model)
+	require.Equal(t, 256, body.MaxTokens)
+	require.Len(t, body.Messages, 1)
+}
+
+func TestSummarizeThroughRelayReportsRelayErrors(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"message":"insufficient quota"}}`))
+	})
+
+	_, err := summarizeThroughRelay(context.Background(), handler, contextfit.SummaryRequest{TokenId: 1, Model: "m"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "insufficient quota")
+}
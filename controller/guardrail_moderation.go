@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/Laisky/one-api/middleware"
+	"github.com/Laisky/one-api/relay/guardrail"
+)
+
+// guardrailModerationPath is the relay route guardrail moderation calls go through.
+const guardrailModerationPath = "/v1/moderations"
+
+// moderationResponse is the subset of an OpenAI moderation response the
+// guardrail reads.
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// StartGuardrailModerator lets guardrail policies with a moderation model call
+// the /v1/moderations relay. handler must be the fully configured gin engine:
+// each call is replayed through it in-process as the guarded request's token,
+// so it is routed, billed and logged like a client moderation request.
+func StartGuardrailModerator(handler http.Handler) {
+	guardrail.SetModerator(func(ctx context.Context, req guardrail.ModerationRequest) (*guardrail.ModerationResult, error) {
+		return moderateThroughRelay(ctx, handler, req)
+	})
+}
+
+func moderateThroughRelay(ctx context.Context, handler http.Handler, req guardrail.ModerationRequest) (*guardrail.ModerationResult, error) {
+	payload, err := json.Marshal(map[string]string{"model": req.Model, "input": req.Input})
+	if err != nil {
+		return nil, errors.Wrap(err, "encode moderation request")
+	}
+	reqCtx := middleware.WithInternalRelay(ctx, middleware.InternalRelay{TokenId: req.TokenId, Guardrail: true})
+	httpReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, guardrailModerationPath, bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "build moderation request")
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.RemoteAddr = "127.0.0.1:0"
+
+	recorder := newBatchResponseRecorder()
+	handler.ServeHTTP(recorder, httpReq)
+
+	var resp moderationResponse
+	if err := json.Unmarshal(recorder.body.Bytes(), &resp); err != nil {
+		return nil, errors.Wrapf(err, "decode moderation response with status %d", recorder.statusCode())
+	}
+	if recorder.statusCode() != http.StatusOK {
+		message := http.StatusText(recorder.statusCode())
+		if resp.Error != nil && resp.Error.Message != "" {
+			message = resp.Error.Message
+		}
+		return nil, errors.Errorf("moderation request failed with status %d: %s", recorder.statusCode(), message)
+	}
+
+	result := &guardrail.ModerationResult{}
+	for _, item := range resp.Results {
+		if !item.Flagged {
+			continue
+		}
+		result.Flagged = true
+		for category, flagged := range item.Categories {
+			if flagged {
+				result.Categories = append(result.Categories, category)
+			}
+		}
+	}
+	sort.Strings(result.Categories)
+	return result, nil
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/middleware"
+	"github.com/Laisky/one-api/relay/guardrail"
+)
+
+func TestModerateThroughRelay(t *testing.T) {
+	var seen middleware.InternalRelay
+	var body map[string]string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, guardrailModerationPath, r.URL.Path)
+		seen, _ = middleware.InternalRelayFromContext(r.Context())
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		_, _ = w.Write([]byte(`{"results":[{"flagged":true,"categories":{"violence":true,"hate":false,"harassment":true}}]}`))
+	})
+
+	result, err := moderateThroughRelay(context.Background(), handler, guardrail.ModerationRequest{
+		TokenId: 42, Model: "omni-moderation-latest", Input: "some prompt",
+	})
+	require.NoError(t, err)
+	require.Equal(t, &guardrail.ModerationResult{Flagged: true, Categories: []string{"harassment", "violence"}}, result)
+	require.Equal(t, middleware.InternalRelay{TokenId: 42, Guardrail: true}, seen)
+	require.Equal(t, map[string]string{"model": "omni-moderation-latest", "input": "some prompt"}, body)
+}
+
+func TestModerateThroughRelayReportsRelayErrors(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":{"message":"model not allowed"}}`))
+	})
+
+	_, err := moderateThroughRelay(context.Background(), handler, guardrail.ModerationRequest{TokenId: 1, Model: "m", Input: "x"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "model not allowed")
+}
@@ -70,6 +70,17 @@ func resolveTokenRef(ref string) (int, error) {
 	return idresolve.Resolve(model.GetTokenIdByUUID, ref)
 }
 
+// resolveOrganizationRef resolves an organization UUID string to an internal id.
+// Parameters:
+//   - ref: client supplied organization reference.
+//
+// Return values:
+//   - int: internal organization primary key.
+//   - error: invalid-reference or not-found error.
+func resolveOrganizationRef(ref string) (int, error) {
+	return idresolve.Resolve(model.GetOrgIdByUUID, ref)
+}
+
 // resolveRedemptionRef resolves a redemption UUID string to an internal id.
 // Parameters:
 //   - ref: client supplied redemption reference.
@@ -85,51 +85,21 @@ func GetAllLogs(c *gin.Context) {
 
 // GetUserLogs lists logs scoped to the current user, honoring filter and sorting options.
 func GetUserLogs(c *gin.Context) {
-	p, _ := strconv.Atoi(c.Query("p"))
-	if p < 0 {
-		p = 0
-	}
 	userId := c.GetInt(ctxkey.Id)
-	logType, _ := strconv.Atoi(c.Query("type"))
-	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
-	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
-	tokenName := c.Query("token_name")
-	modelName := c.Query("model_name")
-	sortBy := c.DefaultQuery("sort_by", "")
-	if sortBy == "" { // frontend fallback
-		sortBy = c.Query("sort")
-	}
-	sortOrder := c.DefaultQuery("sort_order", "desc")
-	if c.Query("order") != "" {
-		sortOrder = c.Query("order")
-	}
-
-	// Validate date range for sorting requests (max 30 days)
-	if sortBy != "" && startTimestamp > 0 && endTimestamp > 0 {
-		maxRange := int64(30 * 24 * 60 * 60) // 30 days in seconds
-		if endTimestamp-startTimestamp > maxRange {
-			helper.RespondError(c, errkind.InvalidRequestErr(errors.New("Date range for sorting cannot exceed 30 days")))
-			return
-		}
-	}
-
-	// Get page size from query parameter, default to config value
-	size, err := strconv.Atoi(c.Query("size"))
-	if err != nil || size <= 0 {
-		size = config.DefaultItemsPerPage
-	}
-	if size > config.MaxItemsPerPage {
-		size = config.MaxItemsPerPage
+	q, err := parseLogListQuery(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
 	}
 
-	logs, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, p*size, size, sortBy, sortOrder)
+	logs, err := model.GetUserLogs(userId, q.logType, q.startTimestamp, q.endTimestamp, q.modelName, q.tokenName, q.page*q.size, q.size, q.sortBy, q.sortOrder)
 	if err != nil {
 		helper.RespondError(c, err)
 		return
 	}
 
 	// Get total count for pagination
-	totalCount, err := model.GetUserLogsCount(userId, logType, startTimestamp, endTimestamp, modelName, tokenName)
+	totalCount, err := model.GetUserLogsCount(userId, q.logType, q.startTimestamp, q.endTimestamp, q.modelName, q.tokenName)
 	if err != nil {
 		helper.RespondError(c, err)
 		return
@@ -143,6 +113,58 @@ func GetUserLogs(c *gin.Context) {
 	})
 }
 
+// logListQuery holds the filters, sorting and paging shared by the self and
+// organization log listings.
+type logListQuery struct {
+	page           int
+	size           int
+	logType        int
+	startTimestamp int64
+	endTimestamp   int64
+	tokenName      string
+	modelName      string
+	sortBy         string
+	sortOrder      string
+}
+
+// parseLogListQuery reads the query parameters of GET /api/log/self.
+func parseLogListQuery(c *gin.Context) (logListQuery, error) {
+	q := logListQuery{}
+	q.page, _ = strconv.Atoi(c.Query("p"))
+	if q.page < 0 {
+		q.page = 0
+	}
+	q.logType, _ = strconv.Atoi(c.Query("type"))
+	q.startTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	q.endTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	q.tokenName = c.Query("token_name")
+	q.modelName = c.Query("model_name")
+	q.sortBy = c.DefaultQuery("sort_by", "")
+	if q.sortBy == "" { // frontend fallback
+		q.sortBy = c.Query("sort")
+	}
+	q.sortOrder = c.DefaultQuery("sort_order", "desc")
+	if c.Query("order") != "" {
+		q.sortOrder = c.Query("order")
+	}
+
+	// Validate date range for sorting requests (max 30 days)
+	if q.sortBy != "" && q.startTimestamp > 0 && q.endTimestamp > 0 {
+		maxRange := int64(30 * 24 * 60 * 60) // 30 days in seconds
+		if q.endTimestamp-q.startTimestamp > maxRange {
+			return q, errkind.InvalidRequestErr(errors.New("Date range for sorting cannot exceed 30 days"))
+		}
+	}
+
+	// Get page size from query parameter, default to config value
+	size, err := strconv.Atoi(c.Query("size"))
+	if err != nil || size <= 0 {
+		size = config.DefaultItemsPerPage
+	}
+	q.size = min(size, config.MaxItemsPerPage)
+	return q, nil
+}
+
 // GetTokenLogs lists logs associated with the specific token used for authentication,
 // scoped to its owning user.
 func GetTokenLogs(c *gin.Context) {
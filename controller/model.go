@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -63,6 +64,14 @@ type OpenAIModels struct {
 	Permission []OpenAIModelPermission `json:"permission"`
 	Root       string                  `json:"root"`
 	Parent     *string                 `json:"parent"`
+	// The fields below are only set on virtual model entries, copied from the
+	// ModelConfig of the target named in Root.
+	ContextLength     int32    `json:"context_length,omitempty"`
+	MaxOutputTokens   int32    `json:"max_output_tokens,omitempty"`
+	InputModalities   []string `json:"input_modalities,omitempty"`
+	OutputModalities  []string `json:"output_modalities,omitempty"`
+	SupportedFeatures []string `json:"supported_features,omitempty"`
+	Description       string   `json:"description,omitempty"`
 }
 
 // BUG(#39): 更新 custom channel 时，应该同步更新所有自定义的 models 到 allModels
@@ -288,6 +297,127 @@ func filterVisibleAbilities(abilities []dto.EnabledAbility, cache map[int]*model
 	return visible
 }
 
+// tokenScopesFromContext returns the relay endpoints the calling API token may
+// use, or nil when the token is not restricted.
+func tokenScopesFromContext(c *gin.Context) []string {
+	if v, ok := c.Get(ctxkey.TokenScopes); ok {
+		if scopes, ok := v.([]string); ok {
+			return scopes
+		}
+	}
+	return nil
+}
+
+// filterScopeReachableAbilities keeps the abilities a scoped token can call:
+// the channel must support one of the token's endpoint scopes and the model
+// itself must be served through that endpoint, so an embedding model is not
+// listed for a chat_completions scope. The batches, voice_clone and
+// gemini_native scopes keep every model; the other gateway scopes keep none.
+// A nil scope list keeps every ability.
+func filterScopeReachableAbilities(ctx context.Context, abilities []dto.EnabledAbility, scopes []string, cache map[int]*model.Channel) []dto.EnabledAbility {
+	if len(scopes) == 0 {
+		return abilities
+	}
+	now := time.Now()
+	reachable := make([]dto.EnabledAbility, 0, len(abilities))
+	for _, ability := range abilities {
+		channel, err := loadChannelCached(ability.ChannelId, cache)
+		if err != nil {
+			continue
+		}
+		endpoints := channel.GetSupportedEndpointsWithContext(ctx)
+		if len(endpoints) == 0 {
+			endpoints = channeltype.DefaultEndpointNamesForChannelType(channel.Type)
+		}
+		var served []string
+		for _, scope := range scopes {
+			if !channeltype.IsChannelEndpointName(scope) {
+				if scopeListsEveryModel(scope) {
+					reachable = append(reachable, ability)
+					break
+				}
+				continue
+			}
+			if !channeltype.IsEndpointSupportedByName(scope, endpoints) {
+				continue
+			}
+			if served == nil {
+				served = modelServedEndpoints(ctx, channel, ability.Model, now)
+			}
+			if slices.Contains(served, scope) {
+				reachable = append(reachable, ability)
+				break
+			}
+		}
+	}
+	return reachable
+}
+
+// scopeListsEveryModel reports whether a scope-only name reaches every model.
+// Batch lines, voice cloning and the native Gemini surface can name any model,
+// while files, conversations and MCP never call one.
+func scopeListsEveryModel(scope string) bool {
+	switch scope {
+	case channeltype.ScopeBatches, channeltype.ScopeVoiceClone, channeltype.ScopeGeminiNative:
+		return true
+	default:
+		return false
+	}
+}
+
+// modelServedEndpoints returns the endpoint names a model is called through
+// on a channel. It reads the model's resolved ModelConfig (pricing blocks and
+// output modalities) and falls back to the model name when the config says
+// nothing; anything else is treated as a text generation model.
+func modelServedEndpoints(ctx context.Context, channel *model.Channel, modelName string, now time.Time) []string {
+	actual := modelName
+	if mapped, ok := channel.GetModelMappingWithContext(ctx)[modelName]; ok && mapped != "" {
+		actual = mapped
+	}
+	provider := relay.GetAdaptor(channeltype.ToAPIType(channel.Type))
+	if provider == nil {
+		provider = relay.GetAdaptor(apitype.OpenAI)
+	}
+	if provider != nil {
+		provider.Init(&meta.Meta{ChannelType: channel.Type})
+	}
+	cfg, _ := relaypricing.ResolveModelConfig(actual, channel.GetModelPriceConfigsWithContext(ctx), provider, now)
+
+	name := strings.ToLower(actual)
+	outputsOnly := func(modality string) bool {
+		return len(cfg.OutputModalities) > 0 && !slices.Contains(cfg.OutputModalities, "text") &&
+			slices.Contains(cfg.OutputModalities, modality)
+	}
+	switch {
+	case cfg.Embedding != nil || strings.Contains(name, "embed"):
+		return channeltype.EndpointListToNames([]channeltype.Endpoint{channeltype.EndpointEmbeddings})
+	case strings.Contains(name, "rerank"):
+		return channeltype.EndpointListToNames([]channeltype.Endpoint{channeltype.EndpointRerank})
+	case cfg.Video != nil && cfg.Video.HasData(), outputsOnly("video"):
+		return channeltype.EndpointListToNames([]channeltype.Endpoint{channeltype.EndpointVideos})
+	case cfg.Image != nil && cfg.Image.PricePerImageUsd > 0 && cfg.Ratio == 0, outputsOnly("image"),
+		strings.Contains(name, "dall-e"), strings.Contains(name, "gpt-image"), strings.Contains(name, "imagen"):
+		return channeltype.EndpointListToNames([]channeltype.Endpoint{channeltype.EndpointImagesGenerations, channeltype.EndpointImagesEdits})
+	case strings.Contains(name, "moderation"):
+		return channeltype.EndpointListToNames([]channeltype.Endpoint{channeltype.EndpointModerations})
+	case strings.Contains(name, "tts"), outputsOnly("audio"):
+		return channeltype.EndpointListToNames([]channeltype.Endpoint{channeltype.EndpointAudioSpeech})
+	case strings.Contains(name, "whisper"), strings.Contains(name, "transcribe"):
+		return channeltype.EndpointListToNames([]channeltype.Endpoint{channeltype.EndpointAudioTranscription, channeltype.EndpointAudioTranslation})
+	case strings.Contains(name, "ocr"):
+		return channeltype.EndpointListToNames([]channeltype.Endpoint{channeltype.EndpointOCR})
+	case strings.Contains(name, "realtime"):
+		return channeltype.EndpointListToNames([]channeltype.Endpoint{channeltype.EndpointRealtime})
+	default:
+		return channeltype.EndpointListToNames([]channeltype.Endpoint{
+			channeltype.EndpointChatCompletions,
+			channeltype.EndpointCompletions,
+			channeltype.EndpointResponseAPI,
+			channeltype.EndpointClaudeMessages,
+		})
+	}
+}
+
 // respondModelNotFound returns the OpenAI-compatible model-not-found error payload.
 func respondModelNotFound(c *gin.Context, modelID string) {
 	msg := fmt.Sprintf("The model '%s' does not exist", modelID)
@@ -1575,6 +1705,7 @@ func ListModels(c *gin.Context) {
 	}
 	channelCache := make(map[int]*model.Channel)
 	availableAbilities = filterVisibleAbilities(availableAbilities, channelCache)
+	availableAbilities = filterScopeReachableAbilities(ctx, availableAbilities, tokenScopesFromContext(c), channelCache)
 
 	snapshot, err := getSupportedModelsSnapshotWithContext(gmw.Ctx(c))
 	if err != nil {
@@ -1583,6 +1714,7 @@ func ListModels(c *gin.Context) {
 	}
 
 	userAvailableModels := resolveUserAvailableModels(availableAbilities, snapshot, int(time.Now().Unix()), channelCache, lg)
+	userAvailableModels = withVirtualModelEntries(userAvailableModels)
 
 	respondModelList(c, userAvailableModels)
 }
@@ -1762,6 +1894,21 @@ func RetrieveModel(c *gin.Context) {
 	}
 	channelCache := make(map[int]*model.Channel)
 	visibleAbilities := filterVisibleAbilities(abilities, channelCache)
+	visibleAbilities = filterScopeReachableAbilities(ctx, visibleAbilities, tokenScopesFromContext(c), channelCache)
+	if len(model.GetVirtualModelTargets(modelId)) > 0 {
+		snapshot, err := getSupportedModelsSnapshotWithContext(ctx)
+		if err != nil {
+			middleware.AbortWithError(c, http.StatusInternalServerError, errors.Wrap(err, "load supported models snapshot"))
+			return
+		}
+		listed := resolveUserAvailableModels(visibleAbilities, snapshot, int(time.Now().Unix()), channelCache, gmw.GetLogger(c))
+		if entry, ok := virtualModelEntry(modelId, indexModelEntries(listed)); ok {
+			c.JSON(http.StatusOK, entry)
+			return
+		}
+		respondModelNotFound(c, modelId)
+		return
+	}
 	matched, ok := matchVisibleAbilityByModelID(visibleAbilities, modelId)
 	if !ok {
 		respondModelNotFound(c, modelId)
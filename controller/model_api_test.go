@@ -712,3 +712,109 @@ func createTestChannelForGroup(t *testing.T, name, group, models string, channel
 	require.NoError(t, channel.AddAbilities())
 	return channel
 }
+
+// TestListModels_FiltersByTokenScopes verifies that a scoped token only lists
+// models that its scopes can call, judged per channel and per model.
+func TestListModels_FiltersByTokenScopes(t *testing.T) {
+	setupListModelsTestEnv(t)
+	gin.SetMode(gin.TestMode)
+	group := fmt.Sprintf("group-%d", time.Now().UnixNano())
+	user := createTestUserForGroup(t, group)
+
+	createTestChannelForGroup(t, "anthropic-chat", group, "claude-scope-test", channeltype.Anthropic)
+	createTestChannelForGroup(t, "openai-embeddings", group, "text-embedding-scope-test", channeltype.OpenAI)
+
+	listModels := func(scopes []string) []string {
+		router := gin.New()
+		router.GET("/v1/models", func(c *gin.Context) {
+			c.Set(ctxkey.Id, user.Id)
+			if scopes != nil {
+				c.Set(ctxkey.TokenScopes, scopes)
+			}
+			ListModels(c)
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Data []struct {
+				Id string `json:"id"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		ids := make([]string, 0, len(resp.Data))
+		for _, m := range resp.Data {
+			ids = append(ids, m.Id)
+		}
+		return ids
+	}
+
+	require.ElementsMatch(t, []string{"claude-scope-test", "text-embedding-scope-test"}, listModels(nil))
+	require.Equal(t, []string{"text-embedding-scope-test"}, listModels([]string{"embeddings"}),
+		"the Anthropic channel does not serve embeddings")
+	require.Equal(t, []string{"claude-scope-test"}, listModels([]string{"chat_completions"}),
+		"an embedding model is not callable through chat completions")
+	require.ElementsMatch(t, []string{"claude-scope-test", "text-embedding-scope-test"}, listModels([]string{"chat_completions", "embeddings"}))
+	require.ElementsMatch(t, []string{"claude-scope-test", "text-embedding-scope-test"}, listModels([]string{"gemini_native"}),
+		"gemini_native can call any model")
+	require.Empty(t, listModels([]string{"files"}), "gateway scopes call no model")
+}
+
+// TestListModels_IncludesVirtualModels verifies that a virtual model is listed
+// with the metadata of its heaviest reachable target and can be retrieved.
+func TestListModels_IncludesVirtualModels(t *testing.T) {
+	setupListModelsTestEnv(t)
+	gin.SetMode(gin.TestMode)
+	group := fmt.Sprintf("group-%d", time.Now().UnixNano())
+	user := createTestUserForGroup(t, group)
+	createTestChannelForGroup(t, "openai-virtual", group, "gpt-4o", channeltype.OpenAI)
+	relay.InitializeGlobalPricing()
+
+	require.NoError(t, model.UpdateVirtualModelsByJSONString(
+		`{"team-default":[{"model":"claude-unreachable","weight":9},{"model":"gpt-4o","weight":1}],"orphan":"claude-unreachable"}`))
+	t.Cleanup(func() { _ = model.UpdateVirtualModelsByJSONString("") })
+
+	router := gin.New()
+	router.GET("/v1/models", func(c *gin.Context) {
+		c.Set(ctxkey.Id, user.Id)
+		ListModels(c)
+	})
+	router.GET("/v1/models/:model", func(c *gin.Context) {
+		c.Set(ctxkey.Id, user.Id)
+		RetrieveModel(c)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data []OpenAIModels `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	byID := map[string]OpenAIModels{}
+	for _, m := range resp.Data {
+		byID[m.Id] = m
+	}
+	require.Contains(t, byID, "gpt-4o")
+	require.NotContains(t, byID, "orphan", "a virtual model without reachable targets is not listed")
+	alias, ok := byID["team-default"]
+	require.True(t, ok)
+	require.Equal(t, "gpt-4o", alias.Root)
+	require.Equal(t, int32(128000), alias.ContextLength)
+	require.Contains(t, alias.InputModalities, "image")
+	require.Zero(t, byID["gpt-4o"].ContextLength, "real models keep the plain OpenAI shape")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models/team-default", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var retrieved OpenAIModels
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &retrieved))
+	require.Equal(t, "team-default", retrieved.Id)
+	require.Equal(t, "gpt-4o", retrieved.Root)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models/orphan", nil))
+	require.Contains(t, w.Body.String(), "model_not_found")
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"sort"
+
+	"github.com/Laisky/one-api/model"
+	relaypricing "github.com/Laisky/one-api/relay/pricing"
+)
+
+// withVirtualModelEntries adds an entry for every virtual model with a target
+// among listed, the models the caller can already reach. A virtual model
+// replaces a real model of the same name, since the alias wins at routing.
+func withVirtualModelEntries(listed []OpenAIModels) []OpenAIModels {
+	aliases := model.GetVirtualModelNames()
+	if len(aliases) == 0 {
+		return listed
+	}
+	byID := indexModelEntries(listed)
+	for _, alias := range aliases {
+		if entry, ok := virtualModelEntry(alias, byID); ok {
+			byID[alias] = entry
+		}
+	}
+
+	merged := make([]OpenAIModels, 0, len(byID))
+	for _, entry := range byID {
+		merged = append(merged, entry)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Id < merged[j].Id
+	})
+	return merged
+}
+
+// indexModelEntries keys model entries by id.
+func indexModelEntries(entries []OpenAIModels) map[string]OpenAIModels {
+	byID := make(map[string]OpenAIModels, len(entries))
+	for _, entry := range entries {
+		byID[entry.Id] = entry
+	}
+	return byID
+}
+
+// virtualModelEntry builds the entry of alias from its heaviest reachable
+// target: the target's entry renamed to alias, with Root naming the target
+// and the capability fields taken from the target's ModelConfig.
+func virtualModelEntry(alias string, reachable map[string]OpenAIModels) (OpenAIModels, bool) {
+	targets := model.GetVirtualModelTargets(alias)
+	sort.SliceStable(targets, func(i, j int) bool { return targets[i].Weight > targets[j].Weight })
+	for _, target := range targets {
+		entry, ok := reachable[target.Model]
+		if !ok {
+			continue
+		}
+		entry.Id = alias
+		entry.Root = target.Model
+		if cfg, ok := relaypricing.GetGlobalModelConfig(target.Model); ok {
+			entry.ContextLength = cfg.ContextLength
+			entry.MaxOutputTokens = cfg.MaxOutputTokens
+			entry.InputModalities = cfg.InputModalities
+			entry.OutputModalities = cfg.OutputModalities
+			entry.SupportedFeatures = cfg.SupportedFeatures
+			entry.Description = cfg.Description
+		}
+		return entry, true
+	}
+	return OpenAIModels{}, false
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/Laisky/errors/v2"
@@ -14,6 +15,7 @@ import (
 	"github.com/Laisky/one-api/common/errkind"
 	"github.com/Laisky/one-api/common/helper"
 	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/guardrail"
 )
 
 // isSensitiveOptionKey reports whether the option key holds a secret value
@@ -98,6 +100,32 @@ func UpdateOption(c *gin.Context) {
 			return
 		}
 		option.Value = val
+	case "ModelFallbackChains":
+		if _, err := model.ParseModelFallbackChains(option.Value); err != nil {
+			helper.RespondError(c, errkind.InvalidRequestErr(errors.Wrap(err, "invalid model fallback chains")))
+			return
+		}
+	case "VirtualModels":
+		if _, err := model.ParseVirtualModels(option.Value); err != nil {
+			helper.RespondError(c, errkind.InvalidRequestErr(errors.Wrap(err, "invalid virtual models")))
+			return
+		}
+	case "SubscriptionPlans":
+		if _, err := model.ParseSubscriptionPlans(option.Value); err != nil {
+			helper.RespondError(c, errkind.InvalidRequestErr(errors.Wrap(err, "invalid subscription plans")))
+			return
+		}
+	case "ChannelHealthMaxAdjustment":
+		value, err := strconv.ParseFloat(strings.TrimSpace(option.Value), 64)
+		if err != nil || value < 0 || value > 1 {
+			helper.RespondError(c, errkind.InvalidRequestErr(errors.New("invalid channel health max adjustment: must be a number between 0 and 1")))
+			return
+		}
+	case "GuardrailPolicies":
+		if _, err := guardrail.ParsePolicies(option.Value); err != nil {
+			helper.RespondError(c, errkind.InvalidRequestErr(errors.Wrap(err, "invalid guardrail policies")))
+			return
+		}
 	case "GitHubOAuthEnabled":
 		if option.Value == "true" && config.GitHubClientId == "" {
 			helper.RespondError(c, errkind.InvalidRequestErr(errors.New("Unable to enable GitHub OAuth, please fill in the GitHub Client Id and GitHub Client Secret first!")))
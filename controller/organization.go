@@ -0,0 +1,550 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/model"
+)
+
+// organizationRequest is the payload accepted by CreateOrganization and
+// UpdateOrganization. Status is ignored on create.
+type organizationRequest struct {
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+}
+
+// organizationMemberRequest is the payload accepted by AddOrganizationMember
+// and UpdateOrganizationMember; Username is only read on add.
+type organizationMemberRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// organizationQuotaRequest is the payload accepted by TransferOrganizationQuota
+// and TopUpOrganization.
+type organizationQuotaRequest struct {
+	Quota  int64  `json:"quota"`
+	Remark string `json:"remark"`
+}
+
+// loadOrganization resolves the :id path parameter to an organization the
+// caller belongs to with at least minRole, and returns the caller's role.
+// Non-members get a not-found error so organization UUIDs cannot be probed.
+func loadOrganization(c *gin.Context, minRole string) (*model.Organization, string, error) {
+	orgId, err := resolveOrganizationRef(c.Param("id"))
+	if err != nil {
+		return nil, "", err
+	}
+	role, err := model.GetOrgMemberRole(orgId, c.GetInt(ctxkey.Id))
+	if err != nil {
+		return nil, "", err
+	}
+	if role == "" {
+		return nil, "", errkind.NotFoundErr(errors.New("organization not found"))
+	}
+	if !model.OrgRoleAtLeast(role, minRole) {
+		return nil, "", errkind.ForbiddenErr(errors.Errorf("this action requires the %s role in the organization", minRole))
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		return nil, "", err
+	}
+	return org, role, nil
+}
+
+// canManageOrgRole reports whether a member holding actorRole may grant,
+// change or revoke targetRole: owners manage every role, admins only members
+// and viewers.
+func canManageOrgRole(actorRole string, targetRole string) bool {
+	if actorRole == model.OrgRoleOwner {
+		return true
+	}
+	return actorRole == model.OrgRoleAdmin && !model.OrgRoleAtLeast(targetRole, model.OrgRoleAdmin)
+}
+
+// GetOrganizations lists the organizations of the current user with the
+// user's role in each.
+func GetOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt(ctxkey.Id))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.UserOrganizationsToResponses(orgs),
+	})
+}
+
+// GetAllOrganizations lists every organization for site administrators.
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	size, _ := strconv.Atoi(c.Query("size"))
+	if size <= 0 {
+		size = config.DefaultItemsPerPage
+	}
+	size = min(size, config.MaxItemsPerPage)
+	orgs, total, err := model.GetAllOrganizations(p*size, size)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.OrganizationsToResponses(orgs),
+		"total":   total,
+	})
+}
+
+// CreateOrganization creates an organization owned by the current user.
+func CreateOrganization(c *gin.Context) {
+	var req organizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.RespondError(c, errkind.InvalidRequestErr(err))
+		return
+	}
+	name, err := model.ValidateOrganizationName(req.Name)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	org, err := model.CreateOrganization(gmw.Ctx(c), name, c.GetInt(ctxkey.Id))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org.ToResponse(model.OrgRoleOwner),
+	})
+}
+
+// GetOrganization returns one organization of the current user.
+func GetOrganization(c *gin.Context) {
+	org, role, err := loadOrganization(c, model.OrgRoleViewer)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org.ToResponse(role),
+	})
+}
+
+// UpdateOrganization renames an organization (admin role) or changes its
+// status (owner role). Disabling an organization stops all its tokens.
+func UpdateOrganization(c *gin.Context) {
+	org, role, err := loadOrganization(c, model.OrgRoleAdmin)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	var req organizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.RespondError(c, errkind.InvalidRequestErr(err))
+		return
+	}
+	if req.Name != "" {
+		if org.Name, err = model.ValidateOrganizationName(req.Name); err != nil {
+			helper.RespondError(c, err)
+			return
+		}
+	}
+	if req.Status != 0 && req.Status != org.Status {
+		if req.Status != model.OrganizationStatusEnabled && req.Status != model.OrganizationStatusDisabled {
+			helper.RespondError(c, errkind.InvalidRequestErr(errors.Errorf("unsupported organization status %d", req.Status)))
+			return
+		}
+		if role != model.OrgRoleOwner {
+			helper.RespondError(c, errkind.ForbiddenErr(errors.New("only organization owners can change its status")))
+			return
+		}
+		org.Status = req.Status
+	}
+	if err := model.UpdateOrganization(gmw.Ctx(c), org); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    org.ToResponse(role),
+	})
+}
+
+// DeleteOrganization deletes an organization without tokens; its remaining
+// quota returns to the deleting owner.
+func DeleteOrganization(c *gin.Context) {
+	org, _, err := loadOrganization(c, model.OrgRoleOwner)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := model.DeleteOrganization(gmw.Ctx(c), org.Id, c.GetInt(ctxkey.Id)); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetOrganizationMembers lists the members of an organization.
+func GetOrganizationMembers(c *gin.Context) {
+	org, _, err := loadOrganization(c, model.OrgRoleViewer)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	members, err := model.GetOrgMembers(org.Id)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.OrganizationMembersToResponses(members),
+	})
+}
+
+// AddOrganizationMember adds an existing user, by username, to an organization.
+func AddOrganizationMember(c *gin.Context) {
+	org, role, err := loadOrganization(c, model.OrgRoleAdmin)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	var req organizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.RespondError(c, errkind.InvalidRequestErr(err))
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrgRoleMember
+	}
+	if !model.IsValidOrgRole(req.Role) {
+		helper.RespondError(c, errkind.InvalidRequestErr(errors.Errorf("invalid organization role %q", req.Role)))
+		return
+	}
+	if !canManageOrgRole(role, req.Role) {
+		helper.RespondError(c, errkind.ForbiddenErr(errors.Errorf("your organization role cannot grant the %s role", req.Role)))
+		return
+	}
+	user := &model.User{Username: strings.TrimSpace(req.Username)}
+	if user.Username == "" {
+		helper.RespondError(c, errkind.InvalidRequestErr(errors.New("username is required")))
+		return
+	}
+	if err := user.FillUserByUsername(); err != nil || user.Id == 0 {
+		helper.RespondError(c, errkind.NotFoundErr(errors.New("user not found")))
+		return
+	}
+	if err := model.AddOrgMember(gmw.Ctx(c), org.Id, user.Id, req.Role); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// loadOrganizationMember resolves the :user_id path parameter (a user UUID)
+// to a member of org and returns the member's user id and role.
+func loadOrganizationMember(c *gin.Context, org *model.Organization) (int, string, error) {
+	userId, err := resolveUserRef(c.Param("user_id"))
+	if err != nil {
+		return 0, "", err
+	}
+	role, err := model.GetOrgMemberRole(org.Id, userId)
+	if err != nil {
+		return 0, "", err
+	}
+	if role == "" {
+		return 0, "", errkind.NotFoundErr(errors.New("user is not a member of this organization"))
+	}
+	return userId, role, nil
+}
+
+// UpdateOrganizationMember changes the role of a member. Demoting a member to
+// viewer disables the organization tokens they created.
+func UpdateOrganizationMember(c *gin.Context) {
+	org, role, err := loadOrganization(c, model.OrgRoleAdmin)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	userId, currentRole, err := loadOrganizationMember(c, org)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	var req organizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.RespondError(c, errkind.InvalidRequestErr(err))
+		return
+	}
+	if !model.IsValidOrgRole(req.Role) {
+		helper.RespondError(c, errkind.InvalidRequestErr(errors.Errorf("invalid organization role %q", req.Role)))
+		return
+	}
+	if !canManageOrgRole(role, currentRole) || !canManageOrgRole(role, req.Role) {
+		helper.RespondError(c, errkind.ForbiddenErr(errors.New("your organization role cannot change this member")))
+		return
+	}
+	if err := model.UpdateOrgMemberRole(gmw.Ctx(c), org.Id, userId, req.Role); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// RemoveOrganizationMember removes a member and disables the organization
+// tokens they created. Every member may remove themselves.
+func RemoveOrganizationMember(c *gin.Context) {
+	org, role, err := loadOrganization(c, model.OrgRoleViewer)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	userId, currentRole, err := loadOrganizationMember(c, org)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if userId != c.GetInt(ctxkey.Id) && !canManageOrgRole(role, currentRole) {
+		helper.RespondError(c, errkind.ForbiddenErr(errors.New("your organization role cannot remove this member")))
+		return
+	}
+	if err := model.RemoveOrgMember(gmw.Ctx(c), org.Id, userId); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// TransferOrganizationQuota moves quota from the current user's balance into
+// the organization pool.
+func TransferOrganizationQuota(c *gin.Context) {
+	ctx := gmw.Ctx(c)
+	org, _, err := loadOrganization(c, model.OrgRoleMember)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	var req organizationQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.RespondError(c, errkind.InvalidRequestErr(err))
+		return
+	}
+	userId := c.GetInt(ctxkey.Id)
+	if err := model.TransferUserQuotaToOrg(ctx, userId, org.Id, req.Quota); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	model.RecordOrgLog(ctx, org.Id, userId, model.LogTypeManage,
+		fmt.Sprintf("Transferred %s to organization %s", common.LogQuota(req.Quota), org.Name), req.Quota)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// TopUpOrganization credits an organization pool; site administrators only.
+func TopUpOrganization(c *gin.Context) {
+	ctx := gmw.Ctx(c)
+	orgId, err := resolveOrganizationRef(c.Param("id"))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	var req organizationQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.RespondError(c, errkind.InvalidRequestErr(err))
+		return
+	}
+	if req.Quota <= 0 {
+		helper.RespondError(c, errkind.InvalidRequestErr(errors.New("quota must be positive")))
+		return
+	}
+	if err := model.IncreaseOrgQuota(ctx, orgId, req.Quota); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := model.CacheUpdateOrgQuota(ctx, orgId); err != nil {
+		gmw.GetLogger(c).Warn("failed to refresh organization quota cache after top-up")
+	}
+	if req.Remark == "" {
+		req.Remark = fmt.Sprintf("Organization recharged via API %s", common.LogQuota(req.Quota))
+	}
+	model.RecordOrgLog(ctx, orgId, c.GetInt(ctxkey.Id), model.LogTypeTopup, req.Remark, req.Quota)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetOrganizationTokens lists organization tokens: all of them for admins,
+// otherwise only those the caller created.
+func GetOrganizationTokens(c *gin.Context) {
+	org, role, err := loadOrganization(c, model.OrgRoleViewer)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	size, _ := strconv.Atoi(c.Query("size"))
+	if size <= 0 {
+		size = config.DefaultItemsPerPage
+	}
+	size = min(size, config.MaxItemsPerPage)
+	creator := c.GetInt(ctxkey.Id)
+	if model.OrgRoleAtLeast(role, model.OrgRoleAdmin) {
+		creator = 0
+	}
+	tokens, total, err := model.GetOrgTokens(org.Id, creator, p*size, size)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.TokensToResponses(tokens),
+		"total":   total,
+	})
+}
+
+// AddOrganizationToken creates a token owned by the organization and charged
+// to its pool. It accepts the same payload as POST /api/token/.
+func AddOrganizationToken(c *gin.Context) {
+	org, _, err := loadOrganization(c, model.OrgRoleMember)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if org.Status != model.OrganizationStatusEnabled {
+		helper.RespondError(c, errkind.ForbiddenErr(errors.New("organization has been disabled")))
+		return
+	}
+	createToken(c, org.Id)
+}
+
+// DeleteOrganizationToken deletes an organization token; admins may delete
+// any of them, other members only their own.
+func DeleteOrganizationToken(c *gin.Context) {
+	org, role, err := loadOrganization(c, model.OrgRoleViewer)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	tokenId, err := resolveTokenRef(c.Param("token_id"))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	token, err := model.GetTokenById(tokenId)
+	if err != nil || token.OrgId != org.Id {
+		helper.RespondError(c, errkind.NotFoundErr(errors.New("token not found in this organization")))
+		return
+	}
+	if token.UserId != c.GetInt(ctxkey.Id) && !model.OrgRoleAtLeast(role, model.OrgRoleAdmin) {
+		helper.RespondError(c, errkind.ForbiddenErr(errors.New("only organization admins can delete tokens of other members")))
+		return
+	}
+	if err := model.DeleteTokenById(gmw.Ctx(c), token.Id, token.UserId); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetOrganizationLogs lists the logs paid by an organization. It accepts the
+// query parameters of GET /api/log/self.
+func GetOrganizationLogs(c *gin.Context) {
+	org, _, err := loadOrganization(c, model.OrgRoleViewer)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	q, err := parseLogListQuery(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	logs, err := model.GetOrgLogs(org.Id, q.logType, q.startTimestamp, q.endTimestamp, q.modelName, q.tokenName, q.page*q.size, q.size, q.sortBy, q.sortOrder)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	totalCount, err := model.GetOrgLogsCount(org.Id, q.logType, q.startTimestamp, q.endTimestamp, q.modelName, q.tokenName)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.LogsToResponses(logs),
+		"total":   totalCount,
+	})
+}
+
+// GetOrganizationLogsStat reports the quota an organization paid over the
+// requested range, mirroring GET /api/log/self/stat.
+func GetOrganizationLogsStat(c *gin.Context) {
+	org, _, err := loadOrganization(c, model.OrgRoleViewer)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channel, err := resolveOptionalChannelRef(c.Query("channel"))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	quotaNum := model.SumOrgUsedQuota(org.Id, startTimestamp, endTimestamp, c.Query("model_name"), c.Query("token_name"), channel)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"quota": quotaNum,
+		},
+	})
+}
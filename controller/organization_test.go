@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/model"
+)
+
+// setupOrganizationTestEnvironment swaps in an isolated SQLite DB seeded with
+// the user and organization tables and returns a cleanup that restores the globals.
+func setupOrganizationTestEnvironment(t *testing.T) func() {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Token{}, &model.Organization{}, &model.OrganizationMember{}))
+
+	originalDB := model.DB
+	originalUsingSQLite := common.UsingSQLite.Load()
+	model.DB = db
+	common.UsingSQLite.Store(true)
+
+	return func() {
+		model.DB = originalDB
+		common.UsingSQLite.Store(originalUsingSQLite)
+	}
+}
+
+// callOrganizationHandler runs handler as userId with the given path params
+// and JSON body, and returns the decoded response envelope.
+func callOrganizationHandler(t *testing.T, handler gin.HandlerFunc, userId int, params gin.Params, body any) (bool, string) {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/organization", reader)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	c.Set(ctxkey.Id, userId)
+
+	handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var payload struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &payload))
+	return payload.Success, payload.Message
+}
+
+func TestOrganizationHandlersEnforceMemberRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Cleanup(setupOrganizationTestEnvironment(t))
+
+	users := map[string]*model.User{}
+	for _, name := range []string{"owner", "admin", "viewer", "outsider", "newcomer"} {
+		user := &model.User{Username: name, Password: "testpassword12345", AccessToken: "at-" + name, AffCode: "ac-" + name}
+		require.NoError(t, model.DB.Create(user).Error)
+		users[name] = user
+	}
+
+	org, err := model.CreateOrganization(context.Background(), "acme", users["owner"].Id)
+	require.NoError(t, err)
+	require.NoError(t, model.AddOrgMember(context.Background(), org.Id, users["admin"].Id, model.OrgRoleAdmin))
+	require.NoError(t, model.AddOrgMember(context.Background(), org.Id, users["viewer"].Id, model.OrgRoleViewer))
+	orgParams := gin.Params{{Key: "id", Value: org.UUID}}
+
+	ok, msg := callOrganizationHandler(t, GetOrganization, users["outsider"].Id, orgParams, nil)
+	require.False(t, ok)
+	require.Contains(t, msg, "organization not found", "non-members must not learn the organization exists")
+
+	ok, msg = callOrganizationHandler(t, AddOrganizationMember, users["viewer"].Id, orgParams,
+		map[string]any{"username": "newcomer", "role": model.OrgRoleMember})
+	require.False(t, ok)
+	require.Contains(t, msg, "requires the admin role")
+
+	ok, msg = callOrganizationHandler(t, AddOrganizationMember, users["admin"].Id, orgParams,
+		map[string]any{"username": "newcomer", "role": model.OrgRoleOwner})
+	require.False(t, ok)
+	require.Contains(t, msg, "cannot grant the owner role")
+
+	ok, msg = callOrganizationHandler(t, AddOrganizationMember, users["admin"].Id, orgParams,
+		map[string]any{"username": "newcomer"})
+	require.True(t, ok, msg)
+	role, err := model.GetOrgMemberRole(org.Id, users["newcomer"].Id)
+	require.NoError(t, err)
+	require.Equal(t, model.OrgRoleMember, role, "members are added with the member role by default")
+
+	ok, msg = callOrganizationHandler(t, UpdateOrganization, users["admin"].Id, orgParams,
+		map[string]any{"status": model.OrganizationStatusDisabled})
+	require.False(t, ok)
+	require.Contains(t, msg, "only organization owners")
+
+	// Viewers cannot remove others but may always leave.
+	viewerParams := gin.Params{{Key: "id", Value: org.UUID}, {Key: "user_id", Value: users["viewer"].UUID}}
+	adminParams := gin.Params{{Key: "id", Value: org.UUID}, {Key: "user_id", Value: users["admin"].UUID}}
+	ok, _ = callOrganizationHandler(t, RemoveOrganizationMember, users["viewer"].Id, adminParams, nil)
+	require.False(t, ok)
+	ok, msg = callOrganizationHandler(t, RemoveOrganizationMember, users["viewer"].Id, viewerParams, nil)
+	require.True(t, ok, msg)
+}
+
+func TestCanManageOrgRole(t *testing.T) {
+	require.True(t, canManageOrgRole(model.OrgRoleOwner, model.OrgRoleOwner))
+	require.True(t, canManageOrgRole(model.OrgRoleAdmin, model.OrgRoleMember))
+	require.False(t, canManageOrgRole(model.OrgRoleAdmin, model.OrgRoleAdmin))
+	require.False(t, canManageOrgRole(model.OrgRoleMember, model.OrgRoleViewer))
+}
@@ -329,7 +329,8 @@ func ListStripePaymentOrders(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": orders})
 }
 
-// StripeWebhook handles checkout.session.* payment events. The route must receive the raw request body.
+// StripeWebhook handles checkout.session.* payment events, customer.subscription.*
+// events and invoice.paid. The route must receive the raw request body.
 func StripeWebhook(c *gin.Context) {
 	ctx := gmw.Ctx(c)
 	logger := gmw.GetLogger(c)
@@ -379,7 +380,13 @@ func StripeWebhook(c *gin.Context) {
 		finished = handleCheckoutPaid(c, event)
 	case "checkout.session.expired", "checkout.session.async_payment_failed":
 		finished = handleCheckoutTerminal(c, event)
+	case "invoice.paid":
+		finished = handleInvoicePaid(c, event)
 	default:
+		if strings.HasPrefix(string(event.Type), "customer.subscription.") {
+			finished = handleSubscriptionEvent(c, event)
+			break
+		}
 		c.JSON(http.StatusOK, gin.H{"received": true})
 		finished = true
 	}
@@ -395,6 +402,11 @@ func StripeWebhook(c *gin.Context) {
 func handleCheckoutPaid(c *gin.Context, event stripe.Event) bool {
 	ctx := gmw.Ctx(c)
 	logger := gmw.GetLogger(c)
+	if mode, _ := event.Data.Object["mode"].(string); mode == string(stripe.CheckoutSessionModeSubscription) {
+		// Subscriptions settle through customer.subscription.* and invoice.paid.
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return true
+	}
 	sessionID, _ := event.Data.Object["id"].(string)
 	paymentStatus, _ := event.Data.Object["payment_status"].(string)
 	currency, _ := event.Data.Object["currency"].(string)
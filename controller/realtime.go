@@ -61,6 +61,12 @@ func RelayRealtime(c *gin.Context) {
 	// Record channel requests in flight
 	PrometheusMonitor.RecordChannelRequest(relayMeta, start)
 
+	if bizErr := channelCredentialError(c); bizErr != nil {
+		c.JSON(bizErr.StatusCode, gin.H{"error": bizErr.Error})
+		PrometheusMonitor.RecordRelayRequest(c, relayMeta, start, false, 0, 0, 0)
+		return
+	}
+
 	// ── Step 1: Resolve pricing ─────────────────────────────────────────
 	var channelModelRatio map[string]float64
 	var channelModelConfigs map[string]model.ModelConfigLocal
@@ -85,7 +91,7 @@ func RelayRealtime(c *gin.Context) {
 		modelName, modelRatio, groupRatio, channelModelConfigs, pricingAdaptor, relayMeta.StartTime)
 
 	// Check user quota before allowing the session
-	userQuota, err := model.CacheGetUserQuota(ctx, relayMeta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, relayMeta.UserId, relayMeta.OrgId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": gin.H{
 			"message": "failed to get user quota",
@@ -284,6 +290,7 @@ func postConsumeRealtimeQuota(
 			TotalQuota:        totalQuota,
 			UserId:            relayMeta.UserId,
 			UserUUID:          relayMeta.UserUUID,
+			OrgId:             relayMeta.OrgId,
 			ChannelId:         relayMeta.ChannelId,
 			ChannelUUID:       relayMeta.ChannelUUID,
 			PromptTokens:      computeResult.PromptTokens,
@@ -325,6 +332,12 @@ func RelayRealtimeSessions(c *gin.Context) {
 
 	PrometheusMonitor.RecordChannelRequest(relayMeta, start)
 
+	if bizErr := channelCredentialError(c); bizErr != nil {
+		c.JSON(bizErr.StatusCode, gin.H{"error": bizErr.Error})
+		PrometheusMonitor.RecordRelayRequest(c, relayMeta, start, false, 0, 0, 0)
+		return
+	}
+
 	if relayMeta.APIType != apitype.OpenAI {
 		// GLM-Realtime authenticates with the API key directly over WebSocket
 		// and has no ephemeral-session (WebRTC) minting surface.
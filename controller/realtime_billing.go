@@ -88,7 +88,8 @@ func rtReturnPreConsumedQuota(
 	// Reconcile provisional log to 0
 	if provLogID := c.GetInt(ctxkey.ProvisionalLogId); provLogID > 0 {
 		if err := model.ReconcileConsumeLog(ctx, provLogID, 0,
-			fmt.Sprintf("refunded: %s", reason), 0, 0, 0, nil); err != nil {
+			fmt.Sprintf("refunded: %s", reason), 0, 0, 0,
+			model.LogMetadata{model.LogMetadataKeyRefundedQuota: preConsumedQuota}); err != nil {
 			gmw.GetLogger(c).Warn("failed to reconcile provisional log on refund",
 				zap.Error(err), zap.Int("provisional_log_id", provLogID))
 		}
@@ -112,6 +113,7 @@ func rtRecordProvisionalLog(c *gin.Context, meta *metalib.Meta, modelName string
 
 	logEntry := &model.Log{
 		UserId:      meta.UserId,
+		OrgId:       meta.OrgId,
 		UserUUID:    model.StringPtrIfNotEmpty(meta.UserUUID),
 		ChannelId:   meta.ChannelId,
 		ChannelUUID: model.StringPtrIfNotEmpty(meta.ChannelUUID),
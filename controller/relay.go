@@ -17,6 +17,7 @@ import (
 	"github.com/Laisky/one-api/common"
 	"github.com/Laisky/one-api/common/config"
 	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/graceful"
 	"github.com/Laisky/one-api/common/helper"
 	"github.com/Laisky/one-api/common/relayctx"
 	"github.com/Laisky/one-api/middleware"
@@ -31,6 +32,9 @@ import (
 // https://platform.openai.com/docs/api-reference/chat
 
 func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
+	if credErr := channelCredentialError(c); credErr != nil {
+		return credErr
+	}
 	var err *model.ErrorWithStatusCode
 	switch relayMode {
 	case relaymode.Realtime:
@@ -51,7 +55,11 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 	case relaymode.ResponseAPI:
 		err = rcontroller.RelayResponseAPIHelper(c)
 	case relaymode.ClaudeMessages:
-		err = rcontroller.RelayClaudeMessagesHelper(c)
+		if strings.HasSuffix(c.Request.URL.Path, "/count_tokens") {
+			err = rcontroller.RelayClaudeMessagesCountTokensHelper(c)
+		} else {
+			err = rcontroller.RelayClaudeMessagesHelper(c)
+		}
 	case relaymode.Rerank:
 		err = rcontroller.RelayRerankHelper(c)
 	case relaymode.Videos:
@@ -60,12 +68,32 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 		err = rcontroller.RelayOCRHelper(c)
 	case relaymode.VoiceClone:
 		err = rcontroller.RelayVoiceCloneHelper(c)
+	case relaymode.GeminiNative:
+		err = rcontroller.RelayGeminiNativeHelper(c)
 	default:
 		err = rcontroller.RelayTextHelper(c)
 	}
 	return err
 }
 
+// channelCredentialError reports a selected channel whose credentials could not
+// be decrypted, so the request fails instead of sending ciphertext upstream.
+func channelCredentialError(c *gin.Context) *model.ErrorWithStatusCode {
+	credErr := meta.GetByContext(c).CredentialErr
+	if credErr == nil {
+		return nil
+	}
+	return &model.ErrorWithStatusCode{
+		Error: model.Error{
+			Message:  "channel credentials could not be decrypted",
+			Type:     model.ErrorTypeOneAPI,
+			Code:     "channel_credentials_unavailable",
+			RawError: credErr,
+		},
+		StatusCode: http.StatusInternalServerError,
+	}
+}
+
 func Relay(c *gin.Context) {
 	ctx := relayctx.Detach(c)
 	lg := gmw.GetLogger(c)
@@ -76,6 +104,9 @@ func Relay(c *gin.Context) {
 	if shouldDebugLog {
 		rcontroller.EnsureDebugResponseWriter(c)
 	}
+	if capture := startRequestCapture(c); capture != nil {
+		defer capture.finish(ctx, c)
+	}
 
 	// Start timing for Prometheus metrics
 	startTime := time.Now()
@@ -99,8 +130,10 @@ func Relay(c *gin.Context) {
 	PrometheusMonitor.RecordChannelRequest(relayMeta, startTime)
 
 	bizErr := relayHelper(c, relayMode)
+	recordChannelHealth(c, startTime, relayMeta.IsStream, bizErr)
 	if bizErr == nil {
 		monitor.Emit(channelId, true)
+		goRecordChannelKeySuccess(ctx, c.GetInt(ctxkey.ChannelKeyId))
 
 		// Record successful relay request metrics
 		PrometheusMonitor.RecordRelayRequest(c, relayMeta, startTime, true, 0, 0, 0)
@@ -116,6 +149,9 @@ func Relay(c *gin.Context) {
 	tokenId := c.GetInt(ctxkey.TokenId)
 	actualModel := relayMeta.ActualModelName
 	requestURL := c.Request.URL.String()
+	// The distributor may already have degraded to a fallback model; resume the
+	// chain from there.
+	fallback := newModelFallback(c, originalModel, c.GetString(ctxkey.ServedModel))
 	// Ensure channel error processing is completed during graceful drain
 	goProcessChannelRelayError(ctx, bizErr, processChannelRelayErrorParams{
 		RequestID:     requestId,
@@ -123,8 +159,10 @@ func Relay(c *gin.Context) {
 		TokenId:       tokenId,
 		ChannelId:     channelId,
 		ChannelName:   channelName,
+		ChannelKeyId:  c.GetInt(ctxkey.ChannelKeyId),
 		Group:         group,
 		OriginalModel: originalModel,
+		ServedModel:   fallback.served,
 		ActualModel:   actualModel,
 		RequestURL:    requestURL,
 	})
@@ -133,6 +171,8 @@ func Relay(c *gin.Context) {
 	PrometheusMonitor.RecordRelayRequest(c, relayMeta, startTime, false, 0, 0, 0)
 
 	retryTimes := config.RetryTimes
+	// Degrading to a fallback model is only worth it when retrying could help.
+	fallbackAllowed := true
 	retryableClientError, retryableClientReason := classifyRetryableUpstreamClientError(bizErr)
 	if err := shouldRetry(c, bizErr); err != nil {
 		if retryableClientError {
@@ -156,6 +196,7 @@ func Relay(c *gin.Context) {
 				ChannelName:   channelName,
 				Group:         group,
 				OriginalModel: originalModel,
+				ServedModel:   fallback.served,
 				ActualModel:   actualModel,
 				Err:           *bizErr,
 			}
@@ -176,6 +217,7 @@ func Relay(c *gin.Context) {
 				)...,
 			)
 			retryTimes = 0
+			fallbackAllowed = false
 		}
 	}
 
@@ -195,7 +237,7 @@ func Relay(c *gin.Context) {
 	if bizErr.StatusCode == http.StatusRequestEntityTooLarge {
 		// Get the total number of channels for this model/group
 		// and try to retry all channels
-		channels, err := dbmodel.GetChannelsFromCache(group, originalModel)
+		channels, err := dbmodel.GetChannelsFromCache(group, fallback.served)
 		if err != nil {
 			retryTimes = 1
 			lg.Debug("413 error detected, Get channels from cache error",
@@ -241,6 +283,26 @@ func Relay(c *gin.Context) {
 	// For 5xx/server transient errors, avoid reusing the same ability first, probe within tier
 	isServerTransient := bizErr.StatusCode >= 500 && bizErr.StatusCode <= 599
 
+	// Once the served model runs out of channels or attempts, degrade to the next
+	// model of its fallback chain. Each hop starts with a fresh channel exclusion
+	// list, since a channel that failed one model may still serve another, and
+	// gets the same attempt budget as a fresh request.
+	hopAttempts := config.RetryTimes + 1
+	nextFallbackHop := func() bool {
+		if !fallbackAllowed || !fallback.next() {
+			return false
+		}
+		lg.Info("relay degrading to fallback model",
+			zap.String("origin_model", originalModel),
+			zap.String("fallback_model", fallback.served),
+		)
+		failedChannels = make(map[int]bool)
+		return true
+	}
+	if retryTimes <= 0 && nextFallbackHop() {
+		retryTimes = hopAttempts
+	}
+
 	for i := retryTimes; i > 0; i-- {
 		var channel *dbmodel.Channel
 		var err error
@@ -257,24 +319,24 @@ func Relay(c *gin.Context) {
 
 		if shouldTryLargerMaxTokensFirst {
 			// For 413 errors, try larger max_tokens channels
-			channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), group, originalModel, false, failedChannels, true)
+			channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), group, fallback.served, false, failedChannels, true)
 		} else if shouldTryLowerPriorityFirst {
 			// For 429 errors, first try lower priority channels while excluding failed ones
-			channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), group, originalModel, true, failedChannels, false)
+			channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), group, fallback.served, true, failedChannels, false)
 			if err != nil {
 				// If no lower priority channels available, try highest priority channels (excluding failed ones)
 				lg.Info("No lower priority channels available, trying highest priority channels",
 					dbmodel.ChannelRefsField("excluded_channels", getChannelIds(failedChannels)),
 				)
-				channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), group, originalModel, false, failedChannels, false)
+				channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), group, fallback.served, false, failedChannels, false)
 			}
 		} else {
 			// For non-429 errors, try highest priority first, then lower priority (excluding failed ones)
-			channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), group, originalModel, false, failedChannels, false)
+			channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), group, fallback.served, false, failedChannels, false)
 			if err != nil {
 				lg.Info("No highest priority channels available, trying lower priority channels",
 					dbmodel.ChannelRefsField("excluded_channels", getChannelIds(failedChannels)))
-				channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), group, originalModel, true, failedChannels, false)
+				channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), group, fallback.served, true, failedChannels, false)
 			}
 		}
 
@@ -288,6 +350,7 @@ func Relay(c *gin.Context) {
 				ChannelName:   channelName,
 				Group:         group,
 				OriginalModel: originalModel,
+				ServedModel:   fallback.served,
 				ActualModel:   actualModel,
 				Err:           *bizErr,
 			}
@@ -311,7 +374,12 @@ func Relay(c *gin.Context) {
 
 			// Log database suspension status to help distinguish between in-memory and database exclusions
 			// Only check the channels that were actually excluded in this request
-			logChannelSuspensionStatus(ctx, group, originalModel, failedChannels)
+			logChannelSuspensionStatus(ctx, group, fallback.served, failedChannels)
+			if nextFallbackHop() {
+				// The for statement decrements i before the next selection.
+				i = hopAttempts + 1
+				continue
+			}
 			break
 		}
 
@@ -327,7 +395,19 @@ func Relay(c *gin.Context) {
 		// attempt's (conservative-skip) outstanding pre-consume, which would double
 		// charge the user. Terminal failures never reach this point.
 		rcontroller.ResetPerAttemptBillingForRetry(ctx, c)
-		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+		if err := middleware.SetupContextForSelectedChannel(c, channel, fallback.served); err != nil {
+			// The context still describes the previous attempt, so only exclude
+			// the channel that could not be bound and spend this attempt.
+			lg.Warn("relay retry skipped channel without a usable key",
+				zap.String("retry_channel", channel.Ref().String()),
+				zap.Error(err),
+			)
+			failedChannels[channel.Id] = true
+			if i == 1 && nextFallbackHop() {
+				i = hopAttempts + 1
+			}
+			continue
+		}
 		// SetupContextForSelectedChannel re-binds the request identity onto a NEW
 		// request-scoped logger, so refresh both the logger value and the detached
 		// context; otherwise every later log line and the async error processor would
@@ -342,7 +422,9 @@ func Relay(c *gin.Context) {
 		retryMeta := meta.GetByContext(c)
 
 		bizErr = relayHelper(c, relayMode)
+		recordChannelHealth(c, retryStartTime, retryMeta.IsStream, bizErr)
 		if bizErr == nil {
+			goRecordChannelKeySuccess(ctx, c.GetInt(ctxkey.ChannelKeyId))
 			// Record successful retry
 			PrometheusMonitor.RecordRelayRequest(c, retryMeta, retryStartTime, true, 0, 0, 0)
 			return
@@ -374,11 +456,16 @@ func Relay(c *gin.Context) {
 			TokenId:       tokenId,
 			ChannelId:     channelId,
 			ChannelName:   channelName,
+			ChannelKeyId:  c.GetInt(ctxkey.ChannelKeyId),
 			Group:         group,
 			OriginalModel: originalModel,
+			ServedModel:   fallback.served,
 			ActualModel:   retryActualModel,
 			RequestURL:    requestURL,
 		})
+		if i == 1 && nextFallbackHop() {
+			i = hopAttempts + 1
+		}
 	}
 
 	if bizErr != nil {
@@ -404,6 +491,19 @@ func Relay(c *gin.Context) {
 	}
 }
 
+// goRecordChannelKeySuccess bumps the usage counters of the pooled key that
+// served a successful attempt. It is a no-op for channels without a key pool.
+func goRecordChannelKeySuccess(ctx context.Context, channelKeyId int) {
+	if channelKeyId <= 0 {
+		return
+	}
+	graceful.GoCritical(ctx, "recordChannelKeySuccess", func(ctx context.Context) {
+		if err := dbmodel.RecordChannelKeyOutcome(ctx, channelKeyId, true, ""); err != nil {
+			gmw.GetLogger(ctx).Warn("failed to record channel key success", zap.Error(err))
+		}
+	})
+}
+
 func RelayNotImplemented(c *gin.Context) {
 	msg := "API not implemented"
 	errObj := model.Error{
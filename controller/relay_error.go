@@ -213,16 +213,30 @@ func logChannelSuspensionStatus(ctx context.Context, group, model string, failed
 // appendRelayFailureFields so every relay failure remains self-contained even when
 // request-scoped logger bindings are unavailable.
 type processChannelRelayErrorParams struct {
-	RequestID     string
-	UserId        int
-	TokenId       int
-	ChannelId     int
-	ChannelName   string
+	RequestID   string
+	UserId      int
+	TokenId     int
+	ChannelId   int
+	ChannelName string
+	// ChannelKeyId is the pooled channel key that served the attempt, or 0 when
+	// the channel does not use a key pool.
+	ChannelKeyId  int
 	Group         string
 	OriginalModel string
-	ActualModel   string
-	RequestURL    string
-	Err           model.ErrorWithStatusCode
+	// ServedModel is the model the failed channel was serving. It differs from
+	// OriginalModel only after degrading along a model fallback chain.
+	ServedModel string
+	ActualModel string
+	RequestURL  string
+	Err         model.ErrorWithStatusCode
+}
+
+// abilityModel returns the model whose ability the failed attempt exercised.
+func (params processChannelRelayErrorParams) abilityModel() string {
+	if params.ServedModel != "" {
+		return params.ServedModel
+	}
+	return params.OriginalModel
 }
 
 // appendRelayFailureFields builds consistent relay failure context fields from params and appends extra fields.
@@ -259,6 +273,9 @@ func appendRelayFailureFields(params processChannelRelayErrorParams, extra ...za
 	if params.OriginalModel != "" {
 		fields = append(fields, zap.String("origin_model", params.OriginalModel))
 	}
+	if params.ServedModel != "" && params.ServedModel != params.OriginalModel {
+		fields = append(fields, zap.String("served_model", params.ServedModel))
+	}
 	if params.ActualModel != "" {
 		fields = append(fields, zap.String("actual_model", params.ActualModel))
 	}
@@ -394,6 +411,12 @@ func processChannelRelayError(ctx context.Context, params processChannelRelayErr
 		)
 	}
 
+	if !isUserError && !isClientContextCancel(params.Err.StatusCode, params.Err.RawError) {
+		if recordErr := dbmodel.RecordChannelKeyOutcome(ctx, params.ChannelKeyId, false, params.Err.Message); recordErr != nil {
+			lg.Warn("failed to record channel key failure", zap.Error(recordErr))
+		}
+	}
+
 	if isInternalInfraError(params.Err.RawError) {
 		lg.Debug("internal infrastructure failure detected, skipping channel suspension",
 			appendRelayFailureFields(params, zap.Error(params.Err.RawError))...,
@@ -439,9 +462,7 @@ func processChannelRelayError(ctx context.Context, params processChannelRelayErr
 				zap.Duration("suspension_duration", config.ChannelSuspendSecondsFor429),
 			)...,
 		)
-		if suspendErr := dbmodel.SuspendAbility(ctx,
-			params.Group, params.OriginalModel, params.ChannelId,
-			config.ChannelSuspendSecondsFor429); suspendErr != nil {
+		if suspendErr := suspendChannelKeyOrAbility(ctx, params, config.ChannelSuspendSecondsFor429); suspendErr != nil {
 			lg.Error("failed to suspend ability for channel",
 				appendRelayFailureFields(params,
 					zap.Error(errors.Wrap(suspendErr, "suspend ability failed")),
@@ -486,7 +507,7 @@ func processChannelRelayError(ctx context.Context, params processChannelRelayErr
 				zap.Duration("suspension_duration", config.ChannelSuspendSecondsFor5XX),
 			)...,
 		)
-		if suspendErr := dbmodel.SuspendAbility(ctx, params.Group, params.OriginalModel, params.ChannelId, config.ChannelSuspendSecondsFor5XX); suspendErr != nil {
+		if suspendErr := suspendChannelKeyOrAbility(ctx, params, config.ChannelSuspendSecondsFor5XX); suspendErr != nil {
 			lg.Error("failed to suspend ability for 5xx",
 				appendRelayFailureFields(params,
 					zap.Error(errors.Wrap(suspendErr, "suspend ability failed")),
@@ -507,7 +528,7 @@ func processChannelRelayError(ctx context.Context, params processChannelRelayErr
 				zap.Duration("suspension_duration", config.ChannelSuspendSecondsForAuth),
 			)...,
 		)
-		if suspendErr := dbmodel.SuspendAbility(ctx, params.Group, params.OriginalModel, params.ChannelId, config.ChannelSuspendSecondsForAuth); suspendErr != nil {
+		if suspendErr := suspendChannelKeyOrAbility(ctx, params, config.ChannelSuspendSecondsForAuth); suspendErr != nil {
 			lg.Error("failed to suspend ability for auth/permission",
 				appendRelayFailureFields(params,
 					zap.Error(errors.Wrap(suspendErr, "suspend ability failed")),
@@ -522,7 +543,7 @@ func processChannelRelayError(ctx context.Context, params processChannelRelayErr
 					zap.String("disable_rationale", "fatal auth error detected; channel automatically disabled"),
 				)...,
 			)
-			monitor.DisableChannel(params.ChannelId, params.ChannelName, params.Err.Message)
+			disableChannelOrKey(params)
 		} else {
 			monitor.Emit(params.ChannelId, false)
 		}
@@ -537,12 +558,43 @@ func processChannelRelayError(ctx context.Context, params processChannelRelayErr
 				zap.String("disable_rationale", "fatal error per auto-disable policy; channel automatically disabled"),
 			)...,
 		)
-		monitor.DisableChannel(params.ChannelId, params.ChannelName, params.Err.Message)
+		disableChannelOrKey(params)
 	} else {
 		monitor.Emit(params.ChannelId, false)
 	}
 }
 
+// suspendChannelKeyOrAbility applies a cooldown for a failed attempt. On a
+// pooled channel only the failing key is suspended, so sibling keys keep
+// serving; the ability is suspended as well once no key of the pool remains
+// available. Non-pooled channels suspend the ability as before.
+func suspendChannelKeyOrAbility(ctx context.Context, params processChannelRelayErrorParams, duration time.Duration) error {
+	if params.ChannelKeyId <= 0 {
+		return dbmodel.SuspendAbility(ctx, params.Group, params.abilityModel(), params.ChannelId, duration)
+	}
+	if err := dbmodel.SuspendChannelKey(ctx, params.ChannelKeyId, duration); err != nil {
+		return errors.Wrap(err, "suspend channel key")
+	}
+	available, err := dbmodel.CountAvailableChannelKeys(ctx, params.ChannelId)
+	if err != nil {
+		return errors.Wrap(err, "count available channel keys")
+	}
+	if available > 0 {
+		return nil
+	}
+	return dbmodel.SuspendAbility(ctx, params.Group, params.abilityModel(), params.ChannelId, duration)
+}
+
+// disableChannelOrKey auto-disables the pooled key that failed fatally, or the
+// whole channel when the attempt did not use a key pool.
+func disableChannelOrKey(params processChannelRelayErrorParams) {
+	if params.ChannelKeyId > 0 {
+		monitor.DisableChannelKey(params.ChannelId, params.ChannelName, params.ChannelKeyId, params.Err.Message)
+		return
+	}
+	monitor.DisableChannel(params.ChannelId, params.ChannelName, params.Err.Message)
+}
+
 // isUserOriginatedRelayError reports whether a relay failure was caused by caller-side
 // request or quota conditions rather than upstream/channel health.
 //
@@ -4,15 +4,48 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/Laisky/errors/v2"
 	"github.com/gin-gonic/gin"
 
 	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/middleware"
 	"github.com/Laisky/one-api/relay/model"
 )
 
+// modelFallback tracks the relay's position along the admin-defined
+// ModelFallbackChains entry of the requested model.
+type modelFallback struct {
+	// served is the model the current channel selection targets.
+	served string
+	// pending holds the fallback models not tried yet, in order.
+	pending []string
+}
+
+// newModelFallback resumes the fallback chain of requestModel after servedModel,
+// which the distributor may already have degraded to.
+func newModelFallback(c *gin.Context, requestModel, servedModel string) *modelFallback {
+	if servedModel == "" {
+		servedModel = requestModel
+	}
+	pending := middleware.FallbackModels(c, requestModel)
+	if idx := slices.Index(pending, servedModel); idx >= 0 {
+		pending = pending[idx+1:]
+	}
+	return &modelFallback{served: servedModel, pending: pending}
+}
+
+// next advances to the next fallback model and reports false once the chain is exhausted.
+func (f *modelFallback) next() bool {
+	if len(f.pending) == 0 {
+		return false
+	}
+	f.served, f.pending = f.pending[0], f.pending[1:]
+	return true
+}
+
 // shouldRetry returns nil if should retry, otherwise returns error.
 // Parameters: c carries the routing context (specific-channel pinning),
 // bizErr is the normalized relay failure whose status, raw error, and
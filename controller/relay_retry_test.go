@@ -2,11 +2,14 @@ package controller
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/Laisky/one-api/common/ctxkey"
 	"github.com/Laisky/one-api/model"
 )
 
@@ -189,3 +192,35 @@ func TestChannelExclusionLogic(t *testing.T) {
 		})
 	}
 }
+
+func TestModelFallback_ResumesAfterServedModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	require.NoError(t, model.UpdateModelFallbackChainsByJSONString(`{"gpt-5":["gpt-5-mini","claude-sonnet-4"]}`))
+	t.Cleanup(func() { _ = model.UpdateModelFallbackChainsByJSONString("") })
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	fallback := newModelFallback(c, "gpt-5", "")
+	require.Equal(t, "gpt-5", fallback.served)
+	require.True(t, fallback.next())
+	require.Equal(t, "gpt-5-mini", fallback.served)
+	require.True(t, fallback.next())
+	require.Equal(t, "claude-sonnet-4", fallback.served)
+	require.False(t, fallback.next())
+	require.Equal(t, "claude-sonnet-4", fallback.served)
+
+	// The distributor already degraded to gpt-5-mini, so only the rest of the chain remains.
+	fallback = newModelFallback(c, "gpt-5", "gpt-5-mini")
+	require.Equal(t, []string{"claude-sonnet-4"}, fallback.pending)
+
+	c.Set(ctxkey.AvailableModels, "gpt-5")
+	require.False(t, newModelFallback(c, "gpt-5", "gpt-5").next())
+}
+
+func TestProcessChannelRelayErrorParams_AbilityModel(t *testing.T) {
+	t.Parallel()
+	params := processChannelRelayErrorParams{OriginalModel: "gpt-5"}
+	require.Equal(t, "gpt-5", params.abilityModel())
+	// A failed fallback hop suspends the ability of the model it actually served.
+	params.ServedModel = "gpt-5-mini"
+	require.Equal(t, "gpt-5-mini", params.abilityModel())
+}
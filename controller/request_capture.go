@@ -0,0 +1,756 @@
+package controller
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/middleware"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay"
+	"github.com/Laisky/one-api/relay/adaptor"
+	"github.com/Laisky/one-api/relay/channeltype"
+	"github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+// captureStreamBufferFactor sizes the response buffer of a capture relative to
+// CAPTURE_MAX_BODY_BYTES. Streams carry far more framing than content, so the
+// raw stream is buffered generously before it is reassembled and capped.
+const captureStreamBufferFactor = 4
+
+// captureResponseWriter copies the response sent to the client, up to limit
+// bytes, for a request capture.
+type captureResponseWriter struct {
+	gin.ResponseWriter
+	buffer    bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write implements io.Writer.
+func (w *captureResponseWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements io.StringWriter.
+func (w *captureResponseWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *captureResponseWriter) capture(data []byte) {
+	remaining := w.limit - w.buffer.Len()
+	if len(data) > remaining {
+		data = data[:max(remaining, 0)]
+		w.truncated = true
+	}
+	_, _ = w.buffer.Write(data)
+}
+
+// requestCapture follows one captured relay request from start to finish.
+type requestCapture struct {
+	record *model.RequestCapture
+	writer *captureResponseWriter
+}
+
+// startRequestCapture begins capturing the request when a capture rule covers
+// its user or token, and returns nil otherwise.
+func startRequestCapture(c *gin.Context) *requestCapture {
+	userId, tokenId := c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId)
+	if !model.ShouldCaptureRequest(userId, tokenId) {
+		return nil
+	}
+	record := &model.RequestCapture{
+		RequestId: c.GetString(helper.RequestIdKey),
+		UserId:    userId,
+		UserUUID:  c.GetString(ctxkey.UserUUID),
+		TokenId:   tokenId,
+		TokenUUID: c.GetString(ctxkey.TokenUUID),
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+	}
+	c.Set(ctxkey.RequestCapture, record)
+	writer := &captureResponseWriter{
+		ResponseWriter: c.Writer,
+		limit:          config.CaptureMaxBodyBytes * captureStreamBufferFactor,
+	}
+	c.Writer = writer
+	return &requestCapture{record: record, writer: writer}
+}
+
+// finish fills in what the relay learned about the request and stores the
+// capture. ctx must outlive the client connection.
+func (capture *requestCapture) finish(ctx context.Context, c *gin.Context) {
+	record := capture.record
+	record.ChannelId = c.GetInt(ctxkey.ChannelId)
+	record.ChannelUUID = c.GetString(ctxkey.ChannelUUID)
+	record.Model = c.GetString(ctxkey.RequestModel)
+	record.StatusCode = c.Writer.Status()
+
+	if body, ok := c.Get(ctxkey.KeyRequestBody); ok {
+		if raw, ok := body.([]byte); ok {
+			stored, truncated := model.CaptureBody(raw, c.GetHeader("Content-Type"))
+			record.InboundRequest = stored
+			record.Truncated = record.Truncated || truncated
+		}
+	}
+	// Adaptors that call their provider through an SDK never reach
+	// DoRequestHelper; fall back to the converted request they stored.
+	if record.UpstreamRequest == "" {
+		if converted, ok := c.Get(ctxkey.ConvertedRequest); ok && converted != nil {
+			if raw, err := json.Marshal(converted); err == nil {
+				stored, truncated := model.CaptureBody(raw, "application/json")
+				record.UpstreamRequest = stored
+				record.Truncated = record.Truncated || truncated
+			}
+		}
+	}
+
+	response := capture.writer.buffer.Bytes()
+	contentType := capture.writer.Header().Get("Content-Type")
+	record.IsStream = strings.HasPrefix(contentType, "text/event-stream")
+	if record.IsStream {
+		if reassembled := reassembleStream(response); reassembled != nil {
+			response, contentType = reassembled, "application/json"
+		}
+	}
+	stored, truncated := model.CaptureBody(response, contentType)
+	record.Response = stored
+	record.Truncated = record.Truncated || truncated || capture.writer.truncated
+
+	if err := model.SaveRequestCapture(ctx, record); err != nil {
+		gmw.GetLogger(c).Warn("failed to save request capture", zap.Error(err))
+	}
+}
+
+// streamEvent holds the fields of the stream chunks reassembleStream
+// understands: OpenAI chat completion chunks, Responses API events and
+// Claude Messages events.
+type streamEvent struct {
+	Type         string               `json:"type"`
+	Id           string               `json:"id"`
+	Model        string               `json:"model"`
+	Choices      []streamChoice       `json:"choices"`
+	Usage        json.RawMessage      `json:"usage"`
+	Response     json.RawMessage      `json:"response"`
+	Message      *streamClaudeMessage `json:"message"`
+	Index        int                  `json:"index"`
+	ContentBlock map[string]any       `json:"content_block"`
+	Delta        json.RawMessage      `json:"delta"`
+}
+
+type streamChoice struct {
+	Index int `json:"index"`
+	Delta struct {
+		Content          string           `json:"content"`
+		ReasoningContent string           `json:"reasoning_content"`
+		ToolCalls        []streamToolCall `json:"tool_calls"`
+	} `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+type streamToolCall struct {
+	Index    int    `json:"index"`
+	Id       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type streamClaudeMessage struct {
+	Id    string          `json:"id"`
+	Model string          `json:"model"`
+	Usage json.RawMessage `json:"usage"`
+}
+
+type streamClaudeDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Thinking    string `json:"thinking"`
+	PartialJSON string `json:"partial_json"`
+	StopReason  string `json:"stop_reason"`
+}
+
+// reassembleStream rebuilds the final response from a server-sent event
+// stream: the completed response of a Responses API stream, or a chat
+// completion or Claude message built from the deltas. It returns nil for
+// streams it does not understand, which are then stored raw.
+func reassembleStream(raw []byte) []byte {
+	var (
+		completed json.RawMessage
+		chat      = &chatStreamAccumulator{}
+		claude    = &claudeStreamAccumulator{}
+	)
+	for line := range bytes.SplitSeq(raw, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+			continue
+		}
+		var event streamEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			continue
+		}
+		switch {
+		case event.Type == "response.completed" && len(event.Response) > 0:
+			completed = event.Response
+		case len(event.Choices) > 0 || (event.Type == "" && len(event.Usage) > 0):
+			chat.add(&event)
+		case strings.HasPrefix(event.Type, "message_") || strings.HasPrefix(event.Type, "content_block_"):
+			claude.add(&event)
+		}
+	}
+
+	var out any
+	switch {
+	case completed != nil:
+		return completed
+	case chat.seen:
+		out = chat.result()
+	case claude.seen:
+		out = claude.result()
+	default:
+		return nil
+	}
+	body, err := json.Marshal(out)
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+// chatStreamAccumulator rebuilds a chat completion from its chunks.
+type chatStreamAccumulator struct {
+	seen    bool
+	id      string
+	model   string
+	usage   json.RawMessage
+	choices []*chatStreamChoice
+}
+
+type chatStreamChoice struct {
+	content      strings.Builder
+	reasoning    strings.Builder
+	toolCalls    []*streamToolCall
+	finishReason *string
+}
+
+func (acc *chatStreamAccumulator) add(event *streamEvent) {
+	acc.seen = true
+	acc.id = cmp.Or(acc.id, event.Id)
+	acc.model = cmp.Or(acc.model, event.Model)
+	if len(event.Usage) > 0 && !bytes.Equal(event.Usage, []byte("null")) {
+		acc.usage = event.Usage
+	}
+	for _, chunk := range event.Choices {
+		if chunk.Index < 0 || chunk.Index > 127 {
+			continue
+		}
+		for len(acc.choices) <= chunk.Index {
+			acc.choices = append(acc.choices, &chatStreamChoice{})
+		}
+		choice := acc.choices[chunk.Index]
+		choice.content.WriteString(chunk.Delta.Content)
+		choice.reasoning.WriteString(chunk.Delta.ReasoningContent)
+		for _, call := range chunk.Delta.ToolCalls {
+			if call.Index < 0 || call.Index > 127 {
+				continue
+			}
+			for len(choice.toolCalls) <= call.Index {
+				choice.toolCalls = append(choice.toolCalls, &streamToolCall{Index: len(choice.toolCalls)})
+			}
+			merged := choice.toolCalls[call.Index]
+			merged.Id = cmp.Or(merged.Id, call.Id)
+			merged.Type = cmp.Or(merged.Type, call.Type)
+			merged.Function.Name += call.Function.Name
+			merged.Function.Arguments += call.Function.Arguments
+		}
+		if chunk.FinishReason != nil {
+			choice.finishReason = chunk.FinishReason
+		}
+	}
+}
+
+func (acc *chatStreamAccumulator) result() map[string]any {
+	choices := make([]map[string]any, 0, len(acc.choices))
+	for i, choice := range acc.choices {
+		message := map[string]any{"role": "assistant", "content": choice.content.String()}
+		if choice.reasoning.Len() > 0 {
+			message["reasoning_content"] = choice.reasoning.String()
+		}
+		if len(choice.toolCalls) > 0 {
+			message["tool_calls"] = choice.toolCalls
+		}
+		choices = append(choices, map[string]any{
+			"index":         i,
+			"message":       message,
+			"finish_reason": choice.finishReason,
+		})
+	}
+	out := map[string]any{
+		"id":      acc.id,
+		"object":  "chat.completion",
+		"model":   acc.model,
+		"choices": choices,
+	}
+	if len(acc.usage) > 0 {
+		out["usage"] = acc.usage
+	}
+	return out
+}
+
+// claudeStreamAccumulator rebuilds a Claude message from its events.
+type claudeStreamAccumulator struct {
+	seen       bool
+	id         string
+	model      string
+	usage      map[string]any
+	stopReason string
+	blocks     []map[string]any
+	partials   map[int]*strings.Builder
+}
+
+func (acc *claudeStreamAccumulator) add(event *streamEvent) {
+	acc.seen = true
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			acc.id, acc.model = event.Message.Id, event.Message.Model
+			acc.mergeUsage(event.Message.Usage)
+		}
+	case "content_block_start":
+		if event.Index < 0 || event.Index > 127 || event.ContentBlock == nil {
+			return
+		}
+		for len(acc.blocks) <= event.Index {
+			acc.blocks = append(acc.blocks, map[string]any{})
+		}
+		acc.blocks[event.Index] = event.ContentBlock
+	case "content_block_delta":
+		if event.Index < 0 || event.Index >= len(acc.blocks) {
+			return
+		}
+		var delta streamClaudeDelta
+		if err := json.Unmarshal(event.Delta, &delta); err != nil {
+			return
+		}
+		block := acc.blocks[event.Index]
+		switch delta.Type {
+		case "text_delta":
+			block["text"] = stringField(block, "text") + delta.Text
+		case "thinking_delta":
+			block["thinking"] = stringField(block, "thinking") + delta.Thinking
+		case "input_json_delta":
+			if acc.partials == nil {
+				acc.partials = map[int]*strings.Builder{}
+			}
+			if acc.partials[event.Index] == nil {
+				acc.partials[event.Index] = &strings.Builder{}
+			}
+			acc.partials[event.Index].WriteString(delta.PartialJSON)
+		}
+	case "message_delta":
+		var delta streamClaudeDelta
+		if err := json.Unmarshal(event.Delta, &delta); err == nil && delta.StopReason != "" {
+			acc.stopReason = delta.StopReason
+		}
+		acc.mergeUsage(event.Usage)
+	}
+}
+
+func (acc *claudeStreamAccumulator) mergeUsage(raw json.RawMessage) {
+	var usage map[string]any
+	if len(raw) == 0 || json.Unmarshal(raw, &usage) != nil {
+		return
+	}
+	if acc.usage == nil {
+		acc.usage = map[string]any{}
+	}
+	for key, value := range usage {
+		acc.usage[key] = value
+	}
+}
+
+func (acc *claudeStreamAccumulator) result() map[string]any {
+	for index, partial := range acc.partials {
+		var input any
+		if err := json.Unmarshal([]byte(partial.String()), &input); err != nil {
+			input = partial.String()
+		}
+		acc.blocks[index]["input"] = input
+	}
+	out := map[string]any{
+		"id":          acc.id,
+		"type":        "message",
+		"role":        "assistant",
+		"model":       acc.model,
+		"content":     acc.blocks,
+		"stop_reason": acc.stopReason,
+	}
+	if acc.usage != nil {
+		out["usage"] = acc.usage
+	}
+	return out
+}
+
+// stringField returns block[key] when it is a string.
+func stringField(block map[string]any, key string) string {
+	value, _ := block[key].(string)
+	return value
+}
+
+type captureRuleRequest struct {
+	UserUUID        string `json:"user_uuid"`
+	TokenUUID       string `json:"token_uuid"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Remark          string `json:"remark"`
+}
+
+// GetCaptureRules lists the capture rules that have not expired.
+func GetCaptureRules(c *gin.Context) {
+	rules, err := model.GetCaptureRules(gmw.Ctx(c))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.CaptureRulesToResponses(rules),
+	})
+}
+
+// CreateCaptureRule starts capturing the requests of one user or one token
+// for duration_minutes.
+func CreateCaptureRule(c *gin.Context) {
+	var req captureRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.RespondError(c, errkind.InvalidRequestErr(err))
+		return
+	}
+	rule := &model.CaptureRule{CreatedBy: c.GetInt(ctxkey.Id), Remark: strings.TrimSpace(req.Remark)}
+	var err error
+	if req.UserUUID != "" {
+		if rule.UserId, err = resolveUserRef(req.UserUUID); err != nil {
+			helper.RespondError(c, err)
+			return
+		}
+		rule.UserUUID = strings.TrimSpace(req.UserUUID)
+	}
+	if req.TokenUUID != "" {
+		if rule.TokenId, err = resolveTokenRef(req.TokenUUID); err != nil {
+			helper.RespondError(c, err)
+			return
+		}
+		rule.TokenUUID = strings.TrimSpace(req.TokenUUID)
+	}
+	rule, err = model.CreateCaptureRule(gmw.Ctx(c), rule, time.Duration(req.DurationMinutes)*time.Minute)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    rule.ToResponse(),
+	})
+}
+
+// DeleteCaptureRule stops a capture rule before it expires.
+func DeleteCaptureRule(c *gin.Context) {
+	if err := model.DeleteCaptureRuleByUUID(gmw.Ctx(c), strings.TrimSpace(c.Param("id"))); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetRequestCaptures lists captures without their bodies, optionally
+// filtered by request_id, user_uuid or token_uuid.
+func GetRequestCaptures(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	size, _ := strconv.Atoi(c.Query("size"))
+	if size <= 0 {
+		size = config.DefaultItemsPerPage
+	}
+	size = min(size, config.MaxItemsPerPage)
+
+	filter := model.RequestCaptureFilter{RequestId: strings.TrimSpace(c.Query("request_id"))}
+	var err error
+	if filter.UserId, err = resolveOptionalUserRef(c.Query("user_uuid")); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if ref := strings.TrimSpace(c.Query("token_uuid")); ref != "" {
+		if filter.TokenId, err = resolveTokenRef(ref); err != nil {
+			helper.RespondError(c, err)
+			return
+		}
+	}
+	captures, total, err := model.GetRequestCaptures(gmw.Ctx(c), filter, p*size, size)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.RequestCapturesToResponses(captures),
+		"total":   total,
+	})
+}
+
+// GetRequestCapture returns one capture with its bodies.
+func GetRequestCapture(c *gin.Context) {
+	capture, err := model.GetRequestCaptureByUUID(gmw.Ctx(c), strings.TrimSpace(c.Param("id")))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    capture.ToResponse(),
+	})
+}
+
+type replayCaptureRequest struct {
+	ChannelUUID string `json:"channel_uuid"`
+}
+
+// ReplayRequestCapture sends a captured request, on its stored method and
+// path, to the chosen channel and returns the raw upstream answer. The replay is logged as a channel test and is not billed to
+// the captured user.
+func ReplayRequestCapture(c *gin.Context) {
+	ctx := gmw.Ctx(c)
+	var req replayCaptureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		helper.RespondError(c, errkind.InvalidRequestErr(err))
+		return
+	}
+	capture, err := model.GetRequestCaptureByUUID(ctx, strings.TrimSpace(c.Param("id")))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := checkReplayable(capture); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	channelId, err := resolveChannelRef(req.ChannelUUID)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(channelId, true)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if !channel.SupportsModel(capture.Model) {
+		helper.RespondError(c, errkind.InvalidRequestErr(errors.Errorf("channel %s does not serve model %s", channel.Name, capture.Model)))
+		return
+	}
+
+	lg := gmw.GetLogger(c).With(channel.Ref().AppendZap([]zap.Field{zap.String("capture_uuid", capture.UUID)})...)
+	started := time.Now()
+	result, err := replayCapture(gmw.SetLogger(ctx, lg), channel, capture)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"channel_uuid": channel.UUID,
+			"model":        capture.Model,
+			"path":         capture.Path,
+			"status_code":  result.statusCode,
+			"response":     result.body,
+			"truncated":    result.truncated,
+			"elapsed_ms":   time.Since(started).Milliseconds(),
+		},
+	})
+}
+
+// replayBody builds the request body to send for a replayed capture.
+//
+// OpenAI-shaped text requests (chat, completions, embeddings, moderations) are
+// parsed from the inbound request, given the channel's mapped model and run
+// through the adaptor's ConvertRequest, so any channel type can serve them.
+// Other endpoints have no such shared conversion; their captured upstream
+// request is resent as is, which is only valid for a channel of the type that
+// produced it.
+func replayBody(c *gin.Context, adaptorInstance adaptor.Adaptor, relayMeta *meta.Meta, channel *model.Channel, capture *model.RequestCapture) ([]byte, error) {
+	switch relayMeta.Mode {
+	case relaymode.ChatCompletions, relaymode.Completions, relaymode.Embeddings, relaymode.Moderations:
+		request := &relaymodel.GeneralOpenAIRequest{}
+		if err := json.Unmarshal([]byte(capture.InboundRequest), request); err != nil {
+			return nil, errkind.InvalidRequestErr(errors.Wrap(err, "parse captured request"))
+		}
+		request.Model = relayMeta.ActualModelName
+		converted, err := adaptorInstance.ConvertRequest(c, relayMeta.Mode, request)
+		if err != nil {
+			return nil, errors.Wrap(err, "convert captured request")
+		}
+		body, err := json.Marshal(converted)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal converted request")
+		}
+		return body, nil
+	}
+
+	if capture.UpstreamRequest == "" {
+		return nil, errkind.InvalidRequestErr(errors.Errorf("capture of %s has no upstream request to replay", capture.Path))
+	}
+	captured, err := model.GetChannelById(capture.ChannelId, false)
+	if err != nil {
+		return nil, errkind.InvalidRequestErr(errors.Wrapf(err, "captures of %s can only be replayed on a channel of the captured type, and the captured channel is gone", capture.Path))
+	}
+	if captured.Type != channel.Type {
+		return nil, errkind.InvalidRequestErr(errors.Errorf("captures of %s can only be replayed on a %s channel like the captured one, not on %s",
+			capture.Path, channeltype.IdToName(captured.Type), channeltype.IdToName(channel.Type)))
+	}
+	return []byte(capture.UpstreamRequest), nil
+}
+
+// checkReplayable rejects captures whose request cannot be sent again: ones
+// whose body was cut, that have no model, or whose path is not an HTTP relay
+// endpoint.
+func checkReplayable(capture *model.RequestCapture) error {
+	if capture.Truncated {
+		return errkind.InvalidRequestErr(errors.New("capture was truncated and cannot be replayed"))
+	}
+	if capture.Model == "" {
+		return errkind.InvalidRequestErr(errors.New("captured request has no model"))
+	}
+	switch relaymode.GetByPath(capture.Path) {
+	case relaymode.Unknown, relaymode.Proxy, relaymode.Realtime:
+		return errkind.InvalidRequestErr(errors.Errorf("captures of %s cannot be replayed", capture.Path))
+	}
+	return nil
+}
+
+// replayResult is the upstream answer to a replayed capture.
+type replayResult struct {
+	statusCode int
+	body       string
+	truncated  bool
+}
+
+// replayCapture sends the stored request to channel on the same method and
+// path. The body is built by replayBody: converted for the channel like a live
+// request where possible, otherwise the captured upstream request is resent.
+// Sanitized values such as redacted images are sent as stored. The upstream
+// response is returned unparsed and capped at CAPTURE_MAX_BODY_BYTES.
+func replayCapture(ctx context.Context, channel *model.Channel, capture *model.RequestCapture) (result *replayResult, err error) {
+	startTime := time.Now()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = (&http.Request{
+		Method: cmp.Or(capture.Method, http.MethodPost),
+		URL:    &url.URL{Path: capture.Path},
+		Header: make(http.Header),
+	}).WithContext(ctx)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(ctxkey.Channel, channel.Type)
+	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
+	cfg, _ := channel.LoadConfig()
+	c.Set(ctxkey.Config, cfg)
+	c.Set(ctxkey.RequestModel, capture.Model)
+	if err := middleware.SetupContextForSelectedChannel(c, channel, capture.Model); err != nil {
+		return nil, errors.Wrap(err, "bind replay channel")
+	}
+	relayMeta := meta.GetByContext(c)
+	if relayMeta.CredentialErr != nil {
+		return nil, errors.Wrap(relayMeta.CredentialErr, "load channel credentials")
+	}
+	relayMeta.OriginModelName = capture.Model
+	relayMeta.ActualModelName = meta.GetMappedModelName(capture.Model, channel.GetModelMappingWithContext(ctx))
+
+	apiType := channeltype.ToAPIType(channel.Type)
+	adaptor := relay.GetAdaptor(apiType)
+	if adaptor == nil {
+		return nil, errors.Errorf("invalid api type %d", apiType)
+	}
+	adaptor.Init(relayMeta)
+
+	defer func() {
+		logContent := fmt.Sprintf("replay capture %s on channel %s failed, error: %v", capture.UUID, channel.Name, err)
+		if err == nil {
+			logContent = fmt.Sprintf("replay capture %s on channel %s, status %d", capture.UUID, channel.Name, result.statusCode)
+		}
+		model.RecordTestLog(ctx, &model.Log{
+			ChannelId:       channel.Id,
+			ChannelUUID:     model.StringPtrIfNotEmpty(channel.UUID),
+			ModelName:       relayMeta.ActualModelName,
+			OriginModelName: capture.Model,
+			Content:         logContent,
+			ElapsedTime:     helper.CalcElapsedTime(startTime),
+		})
+	}()
+
+	body, err := replayBody(c, adaptor, relayMeta, channel, capture)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	resp, err := adaptor.DoRequest(c, relayMeta, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "send replayed request")
+	}
+	if resp == nil {
+		return nil, errors.New("the channel does not support raw replay")
+	}
+	defer resp.Body.Close()
+
+	limit := config.CaptureMaxBodyBytes
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "read replayed response")
+	}
+	result = &replayResult{statusCode: resp.StatusCode}
+	if len(raw) > limit {
+		raw, result.truncated = raw[:limit], true
+	}
+	result.body = string(raw)
+	return result, nil
+}
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/channeltype"
+)
+
+func TestReassembleStream(t *testing.T) {
+	chat := strings.Join([]string{
+		`data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\""}}]}}]}`,
+		`data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		`data: {"id":"chatcmpl-1","model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+		`data: [DONE]`,
+	}, "\n\n")
+	require.JSONEq(t, `{
+		"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o",
+		"choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":"Hello",
+			"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}}],
+		"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`, string(reassembleStream([]byte(chat))))
+
+	claude := strings.Join([]string{
+		"event: message_start",
+		`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4-5","usage":{"input_tokens":9}}}`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"lookup"}}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"x\"}"}}`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":4}}`,
+		`data: {"type":"message_stop"}`,
+	}, "\n")
+	require.JSONEq(t, `{
+		"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5","stop_reason":"tool_use",
+		"content":[{"type":"text","text":"Hi"},{"type":"tool_use","id":"toolu_1","name":"lookup","input":{"q":"x"}}],
+		"usage":{"input_tokens":9,"output_tokens":4}}`, string(reassembleStream([]byte(claude))))
+
+	responses := strings.Join([]string{
+		`data: {"type":"response.output_text.delta","delta":"Hi"}`,
+		`data: {"type":"response.completed","response":{"id":"resp_1","status":"completed"}}`,
+	}, "\n\n")
+	require.JSONEq(t, `{"id":"resp_1","status":"completed"}`, string(reassembleStream([]byte(responses))))
+
+	require.Nil(t, reassembleStream([]byte("data: not json\n\n")))
+}
+
+func TestRequestCaptureStoresSanitizedBodies(t *testing.T) {
+	setupListModelsTestEnv(t)
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	rule, err := model.CreateCaptureRule(ctx, &model.CaptureRule{TokenId: 4242}, time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = model.DeleteCaptureRuleByUUID(context.Background(), rule.UUID) })
+
+	inbound := `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"mcp","authorization":"Bearer sk-secret"}]}`
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(inbound))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(ctxkey.TokenId, 4242)
+	c.Set(helper.RequestIdKey, "req-capture-1")
+	c.Set(ctxkey.KeyRequestBody, []byte(inbound))
+	c.Set(ctxkey.RequestModel, "gpt-4o")
+
+	capture := startRequestCapture(c)
+	require.NotNil(t, capture)
+	// The adaptor records the converted request; the handler streams back.
+	capture.record.SetUpstreamRequest("https://api.openai.com/v1/chat/completions", `{"model":"gpt-4o"}`, false)
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, _ = c.Writer.WriteString(`data: {"id":"c1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"hello"},"finish_reason":"stop"}]}` + "\n\ndata: [DONE]\n\n")
+	capture.finish(ctx, c)
+
+	captures, total, err := model.GetRequestCaptures(ctx, model.RequestCaptureFilter{RequestId: "req-capture-1"}, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	stored, err := model.GetRequestCaptureByUUID(ctx, captures[0].UUID)
+	require.NoError(t, err)
+	require.True(t, stored.IsStream)
+	require.Equal(t, http.StatusOK, stored.StatusCode)
+	require.NotContains(t, stored.InboundRequest, "sk-secret")
+	require.Equal(t, `{"model":"gpt-4o"}`, stored.UpstreamRequest)
+
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(stored.Response), &response))
+	require.Equal(t, "hello", response.Choices[0].Message.Content)
+
+	// Any HTTP relay endpoint can be replayed; websocket and proxy captures cannot.
+	require.NoError(t, checkReplayable(stored))
+	stored.Path = "/v1/embeddings"
+	require.NoError(t, checkReplayable(stored))
+	stored.Path = "/v1/realtime"
+	require.Error(t, checkReplayable(stored))
+
+	// Requests outside every rule are not captured.
+	other, _ := gin.CreateTestContext(httptest.NewRecorder())
+	other.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	other.Set(ctxkey.TokenId, 4243)
+	require.Nil(t, startRequestCapture(other))
+}
+
+func TestReplayCaptureConvertsForChannel(t *testing.T) {
+	setupListModelsTestEnv(t)
+	gin.SetMode(gin.TestMode)
+
+	var gotPath, gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object":"list","data":[{"embedding":[0.1]}]}`))
+	}))
+	defer upstream.Close()
+
+	baseURL := upstream.URL
+	mapping := `{"text-embedding-3-small":"text-embedding-3-large"}`
+	channel := &model.Channel{
+		Name:         "replay-target",
+		Type:         channeltype.OpenAI,
+		Key:          "sk-upstream",
+		BaseURL:      &baseURL,
+		Models:       "text-embedding-3-small",
+		ModelMapping: &mapping,
+		Status:       model.ChannelStatusEnabled,
+	}
+	capture := &model.RequestCapture{
+		UUID:           "capture-replay",
+		Model:          "text-embedding-3-small",
+		Method:         http.MethodPost,
+		Path:           "/v1/embeddings",
+		InboundRequest: `{"model":"text-embedding-3-small","input":"hi","dimensions":8}`,
+	}
+
+	result, err := replayCapture(context.Background(), channel, capture)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, result.statusCode)
+	require.Equal(t, "/v1/embeddings", gotPath)
+	var sent map[string]any
+	require.NoError(t, json.Unmarshal([]byte(gotBody), &sent))
+	require.Equal(t, "text-embedding-3-large", sent["model"], "the model is mapped like a live request")
+	require.Equal(t, "hi", sent["input"])
+	require.Contains(t, result.body, `"embedding"`)
+}
+
+func TestReplayCaptureResendsUpstreamRequestOnlyToSameChannelType(t *testing.T) {
+	setupListModelsTestEnv(t)
+	gin.SetMode(gin.TestMode)
+
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"url":"https://example.com/a.png"}]}`))
+	}))
+	defer upstream.Close()
+
+	baseURL := upstream.URL
+	captured := &model.Channel{Name: "captured", Type: channeltype.OpenAI, Key: "sk-captured", BaseURL: &baseURL, Models: "gpt-image-1", Status: model.ChannelStatusEnabled}
+	require.NoError(t, model.DB.Create(captured).Error)
+	capture := &model.RequestCapture{
+		UUID:            "capture-image",
+		ChannelId:       captured.Id,
+		Model:           "gpt-image-1",
+		Method:          http.MethodPost,
+		Path:            "/v1/images/generations",
+		InboundRequest:  `{"model":"gpt-image-1","prompt":"a cat"}`,
+		UpstreamRequest: `{"model":"gpt-image-1","prompt":"a cat","n":1}`,
+	}
+
+	sameType := &model.Channel{Name: "same-type", Type: channeltype.OpenAI, Key: "sk-same", BaseURL: &baseURL, Models: "gpt-image-1", Status: model.ChannelStatusEnabled}
+	result, err := replayCapture(context.Background(), sameType, capture)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, result.statusCode)
+	require.JSONEq(t, capture.UpstreamRequest, gotBody)
+
+	otherType := &model.Channel{Name: "other-type", Type: channeltype.Anthropic, Key: "sk-other", BaseURL: &baseURL, Models: "gpt-image-1", Status: model.ChannelStatusEnabled}
+	_, err = replayCapture(context.Background(), otherType, capture)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "can only be replayed on a")
+}
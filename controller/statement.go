@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/model"
+)
+
+// statementExportFlushEvery flushes a streamed export after this many items.
+const statementExportFlushEvery = 200
+
+// statementCSVHeader is the first line of a CSV statement export.
+var statementCSVHeader = []string{
+	"created_at", "kind", "user_uuid", "username", "token_uuid", "token_name",
+	"model_name", "prompt_tokens", "completion_tokens", "quota", "request_id",
+}
+
+// selfStatementSubject returns the statement subject of the current user, or
+// of one of the user's tokens when the token_uuid query parameter is set.
+func selfStatementSubject(c *gin.Context) (model.StatementSubject, error) {
+	userId := c.GetInt(ctxkey.Id)
+	if tokenUUID := strings.TrimSpace(c.Query("token_uuid")); tokenUUID != "" {
+		token, err := model.GetTokenByUUID(tokenUUID)
+		if err != nil || token.UserId != userId {
+			return model.StatementSubject{}, errkind.NotFoundErr(errors.New("token not found"))
+		}
+		return model.StatementSubject{Scope: model.StatementScopeToken, ID: token.Id, UUID: token.UUID}, nil
+	}
+	userUUID, err := model.GetUserUUIDByID(userId)
+	if err != nil {
+		return model.StatementSubject{}, errors.Wrap(err, "get statement user uuid")
+	}
+	return model.StatementSubject{Scope: model.StatementScopeUser, ID: userId, UUID: userUUID}, nil
+}
+
+// adminStatementSubject resolves the user_uuid, token_uuid or org_uuid query
+// parameter of an admin statement request. At most one may be set; with none,
+// allowAll selects every user for bulk exports.
+func adminStatementSubject(c *gin.Context, allowAll bool) (model.StatementSubject, error) {
+	userRef := strings.TrimSpace(c.Query("user_uuid"))
+	tokenRef := strings.TrimSpace(c.Query("token_uuid"))
+	orgRef := strings.TrimSpace(c.Query("org_uuid"))
+	set := 0
+	for _, ref := range []string{userRef, tokenRef, orgRef} {
+		if ref != "" {
+			set++
+		}
+	}
+	switch {
+	case set > 1:
+		return model.StatementSubject{}, errkind.InvalidRequestErr(errors.New("set only one of user_uuid, token_uuid and org_uuid"))
+	case userRef != "":
+		id, err := resolveUserRef(userRef)
+		if err != nil {
+			return model.StatementSubject{}, err
+		}
+		userUUID, err := model.GetUserUUIDByID(id)
+		if err != nil {
+			return model.StatementSubject{}, errors.Wrap(err, "get statement user uuid")
+		}
+		return model.StatementSubject{Scope: model.StatementScopeUser, ID: id, UUID: userUUID}, nil
+	case tokenRef != "":
+		token, err := model.GetTokenByUUID(tokenRef)
+		if err != nil {
+			return model.StatementSubject{}, errkind.NotFoundErr(errors.New("token not found"))
+		}
+		return model.StatementSubject{Scope: model.StatementScopeToken, ID: token.Id, UUID: token.UUID}, nil
+	case orgRef != "":
+		id, err := resolveOrganizationRef(orgRef)
+		if err != nil {
+			return model.StatementSubject{}, err
+		}
+		org, err := model.GetOrganizationById(id)
+		if err != nil {
+			return model.StatementSubject{}, err
+		}
+		return model.StatementSubject{Scope: model.StatementScopeOrg, ID: id, UUID: org.UUID}, nil
+	case allowAll:
+		return model.StatementSubject{Scope: model.StatementScopeAll}, nil
+	}
+	return model.StatementSubject{}, errkind.InvalidRequestErr(errors.New("one of user_uuid, token_uuid or org_uuid is required"))
+}
+
+// orgStatementSubject returns the statement subject of the :id organization
+// for a member with at least the viewer role.
+func orgStatementSubject(c *gin.Context) (model.StatementSubject, error) {
+	org, _, err := loadOrganization(c, model.OrgRoleViewer)
+	if err != nil {
+		return model.StatementSubject{}, err
+	}
+	return model.StatementSubject{Scope: model.StatementScopeOrg, ID: org.Id, UUID: org.UUID}, nil
+}
+
+// respondStatement writes the :month statement of the subject resolved by resolve.
+func respondStatement(c *gin.Context, resolve func(*gin.Context) (model.StatementSubject, error)) {
+	subject, err := resolve(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	stmt, err := model.GetUsageStatement(gmw.Ctx(c), subject, c.Param("month"))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    stmt,
+	})
+}
+
+// exportStatement streams the :month statement items of the subject resolved
+// by resolve as CSV or JSON, chosen by the format query parameter.
+func exportStatement(c *gin.Context, resolve func(*gin.Context) (model.StatementSubject, error)) {
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "csv")))
+	if format != "csv" && format != "json" {
+		helper.RespondError(c, errkind.InvalidRequestErr(errors.Errorf("unsupported export format %q, use csv or json", format)))
+		return
+	}
+	subject, err := resolve(c)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	month := c.Param("month")
+	if _, _, err := model.ParseStatementMonth(month); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+
+	name := "statement-" + month
+	if subject.UUID != "" {
+		name += "-" + subject.Scope + "-" + subject.UUID
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	c.Header("Cache-Control", "no-store")
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+	}
+	c.Status(http.StatusOK)
+
+	// The status line is already sent, so a failure halfway through can only
+	// be logged; the client sees a truncated file.
+	if err := writeStatementItems(c, subject, month, format); err != nil {
+		gmw.GetLogger(c).Error("statement export interrupted",
+			zap.Error(err),
+			zap.String("scope", subject.Scope),
+			zap.String("subject_uuid", subject.UUID),
+			zap.String("month", month),
+		)
+	}
+}
+
+func writeStatementItems(c *gin.Context, subject model.StatementSubject, month string, format string) error {
+	written := 0
+	if format == "csv" {
+		w := csv.NewWriter(c.Writer)
+		if err := w.Write(statementCSVHeader); err != nil {
+			return errors.Wrap(err, "write csv header")
+		}
+		err := model.StreamStatementItems(gmw.Ctx(c), subject, month, func(item *model.StatementItem) error {
+			if err := w.Write([]string{
+				time.Unix(item.CreatedAt, 0).UTC().Format(time.RFC3339),
+				item.Kind, item.UserUUID, item.Username, item.TokenUUID, item.TokenName, item.ModelName,
+				strconv.Itoa(item.PromptTokens), strconv.Itoa(item.CompletionTokens),
+				strconv.FormatInt(item.Quota, 10), item.RequestId,
+			}); err != nil {
+				return errors.Wrap(err, "write csv row")
+			}
+			written++
+			if written%statementExportFlushEvery == 0 {
+				w.Flush()
+				c.Writer.Flush()
+			}
+			return w.Error()
+		})
+		w.Flush()
+		if err != nil {
+			return err
+		}
+		return errors.Wrap(w.Error(), "flush csv")
+	}
+
+	if _, err := c.Writer.WriteString("["); err != nil {
+		return errors.Wrap(err, "write json array start")
+	}
+	enc := json.NewEncoder(c.Writer)
+	err := model.StreamStatementItems(gmw.Ctx(c), subject, month, func(item *model.StatementItem) error {
+		if written > 0 {
+			if _, err := c.Writer.WriteString(","); err != nil {
+				return errors.Wrap(err, "write json separator")
+			}
+		}
+		if err := enc.Encode(item); err != nil {
+			return errors.Wrap(err, "write json item")
+		}
+		written++
+		if written%statementExportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.Writer.WriteString("]\n")
+	return errors.Wrap(err, "write json array end")
+}
+
+// GetSelfStatement returns the current user's statement for a month, or the
+// statement of one of the user's tokens.
+func GetSelfStatement(c *gin.Context) {
+	respondStatement(c, selfStatementSubject)
+}
+
+// ExportSelfStatement streams the current user's statement items for a month.
+func ExportSelfStatement(c *gin.Context) {
+	exportStatement(c, selfStatementSubject)
+}
+
+// GetOrganizationStatement returns an organization's statement for a month.
+func GetOrganizationStatement(c *gin.Context) {
+	respondStatement(c, orgStatementSubject)
+}
+
+// ExportOrganizationStatement streams an organization's statement items for a month.
+func ExportOrganizationStatement(c *gin.Context) {
+	exportStatement(c, orgStatementSubject)
+}
+
+// GetStatement returns the statement of any user, token or organization for
+// a month; administrators only.
+func GetStatement(c *gin.Context) {
+	respondStatement(c, func(c *gin.Context) (model.StatementSubject, error) {
+		return adminStatementSubject(c, false)
+	})
+}
+
+// ExportStatements streams the statement items of one subject, or of every
+// user when no subject is given; administrators only.
+func ExportStatements(c *gin.Context) {
+	exportStatement(c, func(c *gin.Context) (model.StatementSubject, error) {
+		return adminStatementSubject(c, true)
+	})
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/model"
+)
+
+const statementTestUserUUID = "55555555-5555-4555-8555-555555555555"
+
+// setupStatementTest swaps in an isolated SQLite DB with two users, each with
+// one usage row in March 2025.
+func setupStatementTest(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Token{}, &model.Log{}, &model.FrozenStatement{}))
+
+	originalDB, originalLogDB := model.DB, model.LOG_DB
+	originalUsingSQLite := common.UsingSQLite.Load()
+	model.DB, model.LOG_DB = db, db
+	common.UsingSQLite.Store(true)
+	t.Cleanup(func() {
+		model.DB, model.LOG_DB = originalDB, originalLogDB
+		common.UsingSQLite.Store(originalUsingSQLite)
+	})
+
+	require.NoError(t, db.Create(&model.User{Id: 1, UUID: statementTestUserUUID, Username: "alice", Password: "x", DisplayName: "a", Role: 1, Status: 1, AccessToken: "at-alice", AffCode: "affa"}).Error)
+	require.NoError(t, db.Create(&model.User{Id: 2, UUID: "66666666-6666-4666-8666-666666666666", Username: "bob", Password: "x", DisplayName: "b", Role: 1, Status: 1, AccessToken: "at-bob", AffCode: "affb"}).Error)
+	require.NoError(t, db.Create(&model.Token{Id: 3, UUID: "77777777-7777-4777-8777-777777777777", UserId: 2, Key: "bobkey", Name: "bob"}).Error)
+
+	created := time.Date(2025, 3, 5, 8, 0, 0, 0, time.UTC).Unix()
+	for _, row := range []model.Log{
+		{UserId: 1, Username: "alice", Type: model.LogTypeConsume, CreatedAt: created, ModelName: "gpt-4o", Quota: 120, ChannelId: 1, RequestId: "req-a"},
+		{UserId: 2, Username: "bob", Type: model.LogTypeConsume, CreatedAt: created + 1, ModelName: "claude", Quota: 80, ChannelId: 1, RequestId: "req-b"},
+	} {
+		require.NoError(t, db.Create(&row).Error)
+	}
+}
+
+func callStatementHandler(handler gin.HandlerFunc, userID int, path string, month string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, path, nil)
+	c.Params = gin.Params{{Key: "month", Value: month}}
+	c.Set(ctxkey.Id, userID)
+	handler(c)
+	return w
+}
+
+func TestGetSelfStatement(t *testing.T) {
+	setupStatementTest(t)
+
+	w := callStatementHandler(GetSelfStatement, 1, "/api/user/statements/2025-03", "2025-03")
+	var resp struct {
+		Success bool                 `json:"success"`
+		Data    model.UsageStatement `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.True(t, resp.Success)
+	require.Equal(t, statementTestUserUUID, resp.Data.SubjectUUID)
+	require.Equal(t, int64(120), resp.Data.Totals.SpendQuota)
+
+	// Another user's token is indistinguishable from a missing one.
+	w = callStatementHandler(GetSelfStatement, 1, "/api/user/statements/2025-03?token_uuid=77777777-7777-4777-8777-777777777777", "2025-03")
+	require.Contains(t, w.Body.String(), `"success":false`)
+	require.Contains(t, w.Body.String(), "token not found")
+
+	w = callStatementHandler(GetSelfStatement, 1, "/api/user/statements/2025-3", "2025-3")
+	require.Contains(t, w.Body.String(), "invalid month")
+}
+
+func TestExportSelfStatementCSV(t *testing.T) {
+	setupStatementTest(t)
+
+	w := callStatementHandler(ExportSelfStatement, 1, "/api/user/statements/2025-03/export", "2025-03")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Header().Get("Content-Disposition"), "statement-2025-03-user-"+statementTestUserUUID+".csv")
+
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		statementCSVHeader,
+		{"2025-03-05T08:00:00Z", "usage", "", "alice", "", "", "gpt-4o", "0", "0", "120", "req-a"},
+	}, records)
+}
+
+func TestExportStatementsAcrossUsers(t *testing.T) {
+	setupStatementTest(t)
+
+	w := callStatementHandler(ExportStatements, 1, "/api/statements/2025-03/export?format=json", "2025-03")
+	require.Equal(t, http.StatusOK, w.Code)
+	var items []model.StatementItem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	require.Len(t, items, 2)
+	require.Equal(t, "alice", items[0].Username)
+	require.Equal(t, "bob", items[1].Username)
+
+	w = callStatementHandler(ExportStatements, 1, "/api/statements/2025-03/export?format=xml", "2025-03")
+	require.Contains(t, w.Body.String(), "unsupported export format")
+
+	w = callStatementHandler(GetStatement, 1, "/api/statements/2025-03", "2025-03")
+	require.Contains(t, w.Body.String(), "one of user_uuid, token_uuid or org_uuid is required")
+}
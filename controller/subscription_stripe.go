@@ -0,0 +1,443 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+	stripe "github.com/stripe/stripe-go/v82"
+	"github.com/stripe/stripe-go/v82/client"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/model"
+)
+
+type createStripeSubscriptionRequest struct {
+	PlanID    string `json:"plan_id"`
+	RequestID string `json:"request_id"`
+}
+
+type stripeBillingPortalClient interface {
+	New(params *stripe.BillingPortalSessionParams) (*stripe.BillingPortalSession, error)
+}
+
+var newStripeBillingPortalClient = func(secretKey string) stripeBillingPortalClient {
+	return client.New(secretKey, nil).BillingPortalSessions
+}
+
+// grantingInvoiceReasons are the invoice billing reasons that open a new
+// billing period. Proration invoices of mid-period plan changes grant nothing;
+// the new plan's quota arrives with the next renewal.
+var grantingInvoiceReasons = map[string]bool{
+	"subscription_create": true,
+	"subscription_cycle":  true,
+	"subscription":        true,
+}
+
+func stripeSubscriptionIdempotencyKey(userID int, planID, requestID string) string {
+	return fmt.Sprintf("one-api:stripe:subscription:v1:%d:%s:%s", userID, planID, requestID)
+}
+
+// GetSelfSubscription returns the subscription plans on sale and the
+// authenticated user's newest subscription, which is null when they never subscribed.
+func GetSelfSubscription(c *gin.Context) {
+	sub, err := model.GetLatestSubscriptionForUser(gmw.Ctx(c), c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "failed to load subscription"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{
+		"plans":        model.ListSubscriptionPlans(),
+		"subscription": sub,
+	}})
+}
+
+// CreateStripeSubscriptionCheckout creates a subscription-mode Checkout
+// Session for a plan. Users with a subscription in good standing change or
+// cancel it through the billing portal instead.
+func CreateStripeSubscriptionCheckout(c *gin.Context) {
+	ctx := gmw.Ctx(c)
+	logger := gmw.GetLogger(c)
+
+	if !StripeReady() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "message": "Stripe is not configured"})
+		return
+	}
+
+	var req createStripeSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "invalid subscription request"})
+		return
+	}
+	planID := strings.TrimSpace(req.PlanID)
+	plan, ok := model.GetSubscriptionPlan(planID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "unknown subscription plan"})
+		return
+	}
+
+	userID := c.GetInt("id")
+	current, err := model.GetLatestSubscriptionForUser(ctx, userID)
+	if err != nil {
+		logger.Error("lookup current subscription", zap.Error(err), zap.Int("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "failed to load subscription"})
+		return
+	}
+	// A past-due subscription is still open in Stripe; its payment is fixed in
+	// the billing portal rather than with a second subscription.
+	if current != nil && (model.SubscriptionEntitled(current.Status) || current.Status == model.SubscriptionStatusPastDue) {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "already subscribed; manage the plan in the billing portal"})
+		return
+	}
+
+	base, err := stripePublicBaseURL(true)
+	if err != nil {
+		logger.Error("validate Stripe public base URL", zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "message": "Stripe is not configured"})
+		return
+	}
+
+	requestID := strings.TrimSpace(req.RequestID)
+	if requestID == "" {
+		requestID, err = model.NewPaymentRequestID()
+		if err != nil {
+			logger.Error("generate payment request id", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "failed to create subscription"})
+			return
+		}
+	}
+	if !validStripeRequestID(requestID) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "request_id must contain only letters, digits, '-' or '_' and be at most 64 characters"})
+		return
+	}
+
+	metadata := map[string]string{
+		"user_id": strconv.Itoa(userID),
+		"plan":    planID,
+	}
+	params := &stripe.CheckoutSessionParams{
+		Mode:              stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		ClientReferenceID: stripe.String(strconv.Itoa(userID)),
+		SuccessURL:        stripe.String(base + "/topup?stripe=subscribed&session_id={CHECKOUT_SESSION_ID}"),
+		CancelURL:         stripe.String(base + "/topup?stripe=cancel"),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{{
+			Price:    stripe.String(plan.StripePriceID),
+			Quantity: stripe.Int64(1),
+		}},
+		Metadata:         metadata,
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{Metadata: metadata},
+	}
+	params.SetIdempotencyKey(stripeSubscriptionIdempotencyKey(userID, planID, requestID))
+
+	// Returning subscribers keep their Stripe customer, so the portal shows
+	// every subscription and invoice they had.
+	customerID, err := model.GetStripeCustomerIDForUser(ctx, userID)
+	if err != nil {
+		logger.Warn("lookup Stripe customer", zap.Error(err), zap.Int("user_id", userID))
+	}
+	if customerID != "" {
+		params.Customer = stripe.String(customerID)
+	} else {
+		userEmail, emailErr := model.GetUserEmail(userID)
+		if emailErr != nil {
+			logger.Warn("lookup user email for Stripe customer", zap.Error(emailErr), zap.Int("user_id", userID))
+		}
+		if userEmail = strings.TrimSpace(userEmail); userEmail != "" {
+			params.CustomerEmail = stripe.String(userEmail)
+		}
+	}
+
+	session, err := newStripeCheckoutSessionClient(config.StripeSecretKey).New(params)
+	if err != nil {
+		logger.Error("create Stripe subscription Checkout Session", zap.Error(err), zap.Int("user_id", userID), zap.String("plan", planID))
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "message": "failed to create Stripe Checkout Session"})
+		return
+	}
+	if session == nil || strings.TrimSpace(session.ID) == "" || strings.TrimSpace(session.URL) == "" {
+		logger.Error("Stripe returned an incomplete Checkout Session", zap.Int("user_id", userID), zap.String("plan", planID))
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "message": "failed to create Stripe Checkout Session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    createStripeCheckoutResponse{URL: session.URL, SessionID: session.ID, RequestID: requestID},
+	})
+}
+
+// CreateStripeBillingPortal returns a Stripe customer-portal link where the
+// authenticated user changes, cancels or pays their subscription.
+func CreateStripeBillingPortal(c *gin.Context) {
+	ctx := gmw.Ctx(c)
+	logger := gmw.GetLogger(c)
+
+	if !StripeReady() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "message": "Stripe is not configured"})
+		return
+	}
+	userID := c.GetInt("id")
+	customerID, err := model.GetStripeCustomerIDForUser(ctx, userID)
+	if err != nil {
+		logger.Error("lookup Stripe customer", zap.Error(err), zap.Int("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "failed to load subscription"})
+		return
+	}
+	if customerID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "no subscription to manage"})
+		return
+	}
+	base, err := stripePublicBaseURL(true)
+	if err != nil {
+		logger.Error("validate Stripe public base URL", zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "message": "Stripe is not configured"})
+		return
+	}
+
+	portal, err := newStripeBillingPortalClient(config.StripeSecretKey).New(&stripe.BillingPortalSessionParams{
+		Customer:  stripe.String(customerID),
+		ReturnURL: stripe.String(base + "/topup"),
+	})
+	if err != nil || portal == nil || strings.TrimSpace(portal.URL) == "" {
+		logger.Error("create Stripe billing portal session", zap.Error(err), zap.Int("user_id", userID))
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "message": "failed to create Stripe billing portal session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"url": portal.URL}})
+}
+
+// stripeID is a Stripe reference that is either an id or an expanded object.
+type stripeID string
+
+func (id *stripeID) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*id = stripeID(value)
+		return nil
+	}
+	var object struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return errors.Wrap(err, "decode stripe reference")
+	}
+	*id = stripeID(object.ID)
+	return nil
+}
+
+// stripeSubscriptionObject is the part of a Stripe subscription the webhook
+// reads. Billing periods moved from the subscription to its items in newer
+// API versions; both places are read.
+type stripeSubscriptionObject struct {
+	ID                 string            `json:"id"`
+	Customer           stripeID          `json:"customer"`
+	Status             string            `json:"status"`
+	CancelAtPeriodEnd  bool              `json:"cancel_at_period_end"`
+	CanceledAt         int64             `json:"canceled_at"`
+	CurrentPeriodStart int64             `json:"current_period_start"`
+	CurrentPeriodEnd   int64             `json:"current_period_end"`
+	Metadata           map[string]string `json:"metadata"`
+	Items              struct {
+		Data []struct {
+			CurrentPeriodStart int64 `json:"current_period_start"`
+			CurrentPeriodEnd   int64 `json:"current_period_end"`
+			Price              struct {
+				ID string `json:"id"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// stripeInvoiceObject is the part of a Stripe invoice the webhook reads. The
+// subscription is read from parent.subscription_details in newer API versions
+// and from the top-level fields in older ones.
+type stripeInvoiceObject struct {
+	ID                  string   `json:"id"`
+	Customer            stripeID `json:"customer"`
+	BillingReason       string   `json:"billing_reason"`
+	Subscription        stripeID `json:"subscription"`
+	SubscriptionDetails *struct {
+		Metadata map[string]string `json:"metadata"`
+	} `json:"subscription_details"`
+	Parent *struct {
+		SubscriptionDetails *struct {
+			Subscription stripeID          `json:"subscription"`
+			Metadata     map[string]string `json:"metadata"`
+		} `json:"subscription_details"`
+	} `json:"parent"`
+	PeriodStart int64 `json:"period_start"`
+	PeriodEnd   int64 `json:"period_end"`
+	Lines       struct {
+		Data []struct {
+			Period struct {
+				Start int64 `json:"start"`
+				End   int64 `json:"end"`
+			} `json:"period"`
+		} `json:"data"`
+	} `json:"lines"`
+}
+
+func (inv *stripeInvoiceObject) subscription() (string, map[string]string) {
+	if inv.Parent != nil && inv.Parent.SubscriptionDetails != nil {
+		return string(inv.Parent.SubscriptionDetails.Subscription), inv.Parent.SubscriptionDetails.Metadata
+	}
+	var metadata map[string]string
+	if inv.SubscriptionDetails != nil {
+		metadata = inv.SubscriptionDetails.Metadata
+	}
+	return string(inv.Subscription), metadata
+}
+
+// period returns the billing period the invoice pays for: the latest line
+// period, since a subscription invoice's own period is the one before it.
+func (inv *stripeInvoiceObject) period() (start, end int64) {
+	for _, line := range inv.Lines.Data {
+		if line.Period.Start > start {
+			start, end = line.Period.Start, line.Period.End
+		}
+	}
+	if start == 0 {
+		return inv.PeriodStart, inv.PeriodEnd
+	}
+	return start, end
+}
+
+// subscriptionMetadataState reads the user and plan that checkout stored in
+// the subscription metadata.
+func subscriptionMetadataState(metadata map[string]string) (userID int, planID string) {
+	userID, _ = strconv.Atoi(strings.TrimSpace(metadata["user_id"]))
+	return userID, strings.TrimSpace(metadata["plan"])
+}
+
+// handleSubscriptionEvent mirrors a customer.subscription.* event and moves
+// the subscriber into or out of the plan group.
+func handleSubscriptionEvent(c *gin.Context, event stripe.Event) bool {
+	ctx := gmw.Ctx(c)
+	logger := gmw.GetLogger(c)
+
+	var obj stripeSubscriptionObject
+	if err := json.Unmarshal(event.Data.Raw, &obj); err != nil || obj.ID == "" {
+		logger.Warn("decode Stripe subscription event", zap.Error(err), zap.String("event_id", event.ID))
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return true
+	}
+
+	state := model.StripeSubscriptionState{
+		SubscriptionID:     obj.ID,
+		CustomerID:         string(obj.Customer),
+		Status:             obj.Status,
+		CancelAtPeriodEnd:  obj.CancelAtPeriodEnd,
+		CurrentPeriodStart: obj.CurrentPeriodStart,
+		CurrentPeriodEnd:   obj.CurrentPeriodEnd,
+		CanceledAt:         obj.CanceledAt,
+		EventCreated:       event.Created,
+	}
+	state.UserID, state.PlanID = subscriptionMetadataState(obj.Metadata)
+	if len(obj.Items.Data) > 0 {
+		item := obj.Items.Data[0]
+		if planID, _, ok := model.GetSubscriptionPlanByPriceID(item.Price.ID); ok {
+			state.PlanID = planID
+		}
+		if item.CurrentPeriodStart > 0 {
+			state.CurrentPeriodStart, state.CurrentPeriodEnd = item.CurrentPeriodStart, item.CurrentPeriodEnd
+		}
+	}
+
+	sub, groupChanged, err := model.SyncStripeSubscription(ctx, state)
+	if err != nil {
+		if errors.Is(err, model.ErrSubscriptionNotFound) {
+			// Not created by this gateway's checkout.
+			logger.Warn("Stripe subscription has no user or plan metadata", zap.String("subscription_id", obj.ID), zap.String("event_id", event.ID))
+			c.JSON(http.StatusOK, gin.H{"received": true})
+			return true
+		}
+		logger.Error("sync Stripe subscription", zap.Error(err), zap.String("subscription_id", obj.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "subscription sync failed"})
+		return false
+	}
+	if groupChanged {
+		if cacheErr := model.CacheUpdateUserGroup(ctx, sub.UserId); cacheErr != nil {
+			logger.Warn("refresh user group cache after subscription change", zap.Error(cacheErr), zap.Int("user_id", sub.UserId))
+		}
+		logger.Info("subscription changed user group",
+			zap.Int("user_id", sub.UserId),
+			zap.String("plan", sub.PlanID),
+			zap.String("status", sub.Status),
+			zap.String("group", sub.AppliedGroup))
+	}
+	c.JSON(http.StatusOK, gin.H{"received": true})
+	return true
+}
+
+// handleInvoicePaid grants the plan quota for the billing period a paid
+// subscription invoice opens. Each period is granted once, however often the
+// event is delivered.
+func handleInvoicePaid(c *gin.Context, event stripe.Event) bool {
+	ctx := gmw.Ctx(c)
+	logger := gmw.GetLogger(c)
+
+	var inv stripeInvoiceObject
+	if err := json.Unmarshal(event.Data.Raw, &inv); err != nil {
+		logger.Warn("decode Stripe invoice event", zap.Error(err), zap.String("event_id", event.ID))
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return true
+	}
+	subscriptionID, metadata := inv.subscription()
+	if subscriptionID == "" || !grantingInvoiceReasons[inv.BillingReason] {
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return true
+	}
+	periodStart, periodEnd := inv.period()
+
+	granted, grant, err := model.GrantSubscriptionPeriod(ctx, subscriptionID, inv.ID, periodStart, periodEnd)
+	if errors.Is(err, model.ErrSubscriptionNotFound) {
+		// invoice.paid can arrive before customer.subscription.created.
+		userID, planID := subscriptionMetadataState(metadata)
+		_, groupChanged, syncErr := model.SyncStripeSubscription(ctx, model.StripeSubscriptionState{
+			SubscriptionID: subscriptionID,
+			CustomerID:     string(inv.Customer),
+			UserID:         userID,
+			PlanID:         planID,
+			Status:         model.SubscriptionStatusActive,
+		})
+		if syncErr != nil {
+			logger.Error("create subscription from paid invoice", zap.Error(syncErr), zap.String("subscription_id", subscriptionID), zap.String("invoice_id", inv.ID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "subscription not found"})
+			return false
+		}
+		if groupChanged {
+			if cacheErr := model.CacheUpdateUserGroup(ctx, userID); cacheErr != nil {
+				logger.Warn("refresh user group cache after subscription change", zap.Error(cacheErr), zap.Int("user_id", userID))
+			}
+		}
+		granted, grant, err = model.GrantSubscriptionPeriod(ctx, subscriptionID, inv.ID, periodStart, periodEnd)
+	}
+	if err != nil {
+		logger.Error("grant subscription period", zap.Error(err), zap.String("subscription_id", subscriptionID), zap.String("invoice_id", inv.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "grant failed"})
+		return false
+	}
+	if !granted {
+		c.JSON(http.StatusOK, gin.H{"received": true})
+		return true
+	}
+
+	if cacheErr := model.CacheUpdateUserQuota(ctx, grant.UserId); cacheErr != nil {
+		logger.Warn("refresh user quota cache after subscription grant", zap.Error(cacheErr), zap.Int("user_id", grant.UserId))
+	}
+	planName := grant.PlanID
+	if plan, ok := model.GetSubscriptionPlan(grant.PlanID); ok {
+		planName = plan.Name
+	}
+	remark := fmt.Sprintf("Stripe subscription %s: period grant (%s)", planName, common.LogQuota(grant.Quota))
+	model.RecordTopupLog(ctx, grant.UserId, remark, int(grant.Quota))
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+	return true
+}
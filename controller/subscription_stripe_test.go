@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	stripe "github.com/stripe/stripe-go/v82"
+	stripewebhook "github.com/stripe/stripe-go/v82/webhook"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/model"
+)
+
+const testStripeWebhookSecret = "whsec_test_subscription"
+
+// setupSubscriptionWebhookTest swaps in an isolated SQLite DB with one user in
+// group "default", a "pro" plan, and the test webhook secret.
+func setupSubscriptionWebhookTest(t *testing.T) *model.User {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Log{}, &model.StripeWebhookEvent{}, &model.Subscription{}, &model.SubscriptionGrant{}))
+
+	originalDB, originalLogDB := model.DB, model.LOG_DB
+	originalUsingSQLite := common.UsingSQLite.Load()
+	originalSecret := config.StripeWebhookSecret
+	originalPlans := model.SubscriptionPlans2JSONString()
+	model.DB, model.LOG_DB = db, db
+	common.UsingSQLite.Store(true)
+	config.StripeWebhookSecret = testStripeWebhookSecret
+	t.Cleanup(func() {
+		model.DB, model.LOG_DB = originalDB, originalLogDB
+		common.UsingSQLite.Store(originalUsingSQLite)
+		config.StripeWebhookSecret = originalSecret
+		require.NoError(t, model.UpdateSubscriptionPlansByJSONString(originalPlans))
+	})
+	require.NoError(t, model.UpdateSubscriptionPlansByJSONString(
+		`{"pro": {"name": "Pro", "stripe_price_id": "price_pro", "quota": 25000000, "group": "vip"}}`))
+
+	user := &model.User{Id: 7, Username: "subscriber", Password: "x", DisplayName: "s", Role: 1, Status: 1, Quota: 0, Group: "default"}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+// postStripeEvent delivers an event signed with the test secret to StripeWebhook.
+func postStripeEvent(t *testing.T, id, eventType string, created int64, object map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(map[string]any{
+		"id":          id,
+		"object":      "event",
+		"type":        eventType,
+		"created":     created,
+		"api_version": stripe.APIVersion,
+		"data":        map[string]any{"object": object},
+	})
+	require.NoError(t, err)
+	signed := stripewebhook.GenerateTestSignedPayload(&stripewebhook.UnsignedPayload{Payload: payload, Secret: testStripeWebhookSecret})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/payment/stripe/webhook", bytes.NewReader(signed.Payload))
+	c.Request.Header.Set("Stripe-Signature", signed.Header)
+	StripeWebhook(c)
+	return w
+}
+
+func stripeSubscriptionPayload(userID int, status string) map[string]any {
+	return map[string]any{
+		"id":                   "sub_1",
+		"object":               "subscription",
+		"customer":             "cus_1",
+		"status":               status,
+		"cancel_at_period_end": false,
+		"metadata":             map[string]string{"user_id": fmt.Sprint(userID), "plan": "pro"},
+		"items": map[string]any{"data": []map[string]any{{
+			"current_period_start": 1000,
+			"current_period_end":   2000,
+			"price":                map[string]any{"id": "price_pro"},
+		}}},
+	}
+}
+
+func stripeInvoicePayload(id, reason string, start, end int64) map[string]any {
+	return map[string]any{
+		"id":             id,
+		"object":         "invoice",
+		"customer":       "cus_1",
+		"billing_reason": reason,
+		"parent": map[string]any{"subscription_details": map[string]any{
+			"subscription": "sub_1",
+			"metadata":     map[string]string{"user_id": "7", "plan": "pro"},
+		}},
+		"lines": map[string]any{"data": []map[string]any{{"period": map[string]any{"start": start, "end": end}}}},
+	}
+}
+
+func subscriberState(t *testing.T, id int) (string, int64) {
+	t.Helper()
+	var user model.User
+	require.NoError(t, model.DB.Select("id", "group", "quota").Where("id = ?", id).First(&user).Error)
+	return user.Group, user.Quota
+}
+
+// TestStripeSubscriptionLifecycle walks a subscription from creation through
+// renewals to cancellation, with duplicate and replayed deliveries.
+func TestStripeSubscriptionLifecycle(t *testing.T) {
+	user := setupSubscriptionWebhookTest(t)
+
+	w := postStripeEvent(t, "evt_created", "customer.subscription.created", 100, stripeSubscriptionPayload(user.Id, "active"))
+	require.Equal(t, http.StatusOK, w.Code)
+	group, quota := subscriberState(t, user.Id)
+	require.Equal(t, "vip", group)
+	require.Zero(t, quota)
+
+	// The first invoice grants the first period; a replay of the same event
+	// and a second event for the same period grant nothing.
+	require.Equal(t, http.StatusOK, postStripeEvent(t, "evt_inv_1", "invoice.paid", 101, stripeInvoicePayload("in_1", "subscription_create", 1000, 2000)).Code)
+	w = postStripeEvent(t, "evt_inv_1", "invoice.paid", 101, stripeInvoicePayload("in_1", "subscription_create", 1000, 2000))
+	require.Contains(t, w.Body.String(), `"duplicate":true`)
+	require.Equal(t, http.StatusOK, postStripeEvent(t, "evt_inv_1b", "invoice.paid", 102, stripeInvoicePayload("in_1", "subscription_create", 1000, 2000)).Code)
+	_, quota = subscriberState(t, user.Id)
+	require.Equal(t, int64(25000000), quota)
+
+	// A proration invoice does not open a period.
+	require.Equal(t, http.StatusOK, postStripeEvent(t, "evt_proration", "invoice.paid", 150, stripeInvoicePayload("in_p", "subscription_update", 1500, 2000)).Code)
+	require.Equal(t, http.StatusOK, postStripeEvent(t, "evt_inv_2", "invoice.paid", 200, stripeInvoicePayload("in_2", "subscription_cycle", 2000, 3000)).Code)
+	_, quota = subscriberState(t, user.Id)
+	require.Equal(t, int64(50000000), quota)
+
+	w = postStripeEvent(t, "evt_deleted", "customer.subscription.deleted", 300, stripeSubscriptionPayload(user.Id, "canceled"))
+	require.Equal(t, http.StatusOK, w.Code)
+	group, quota = subscriberState(t, user.Id)
+	require.Equal(t, "default", group)
+	require.Equal(t, int64(50000000), quota, "granted quota is kept after cancellation")
+
+	// A late "active" update from before the cancellation is ignored.
+	require.Equal(t, http.StatusOK, postStripeEvent(t, "evt_late", "customer.subscription.updated", 250, stripeSubscriptionPayload(user.Id, "active")).Code)
+	group, _ = subscriberState(t, user.Id)
+	require.Equal(t, "default", group)
+}
+
+// TestStripeInvoicePaidBeforeSubscriptionCreated creates the subscription from
+// the invoice metadata when invoice.paid arrives first.
+func TestStripeInvoicePaidBeforeSubscriptionCreated(t *testing.T) {
+	user := setupSubscriptionWebhookTest(t)
+
+	require.Equal(t, http.StatusOK, postStripeEvent(t, "evt_inv_1", "invoice.paid", 100, stripeInvoicePayload("in_1", "subscription_create", 1000, 2000)).Code)
+	group, quota := subscriberState(t, user.Id)
+	require.Equal(t, "vip", group)
+	require.Equal(t, int64(25000000), quota)
+
+	require.Equal(t, http.StatusOK, postStripeEvent(t, "evt_created", "customer.subscription.created", 99, stripeSubscriptionPayload(user.Id, "active")).Code)
+	require.Equal(t, http.StatusOK, postStripeEvent(t, "evt_unpaid", "customer.subscription.updated", 400, stripeSubscriptionPayload(user.Id, "unpaid")).Code)
+	group, _ = subscriberState(t, user.Id)
+	require.Equal(t, "default", group)
+}
+
+func TestStripeWebhookRejectsBadSignature(t *testing.T) {
+	setupSubscriptionWebhookTest(t)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/payment/stripe/webhook", bytes.NewReader([]byte(`{"id":"evt_1"}`)))
+	c.Request.Header.Set("Stripe-Signature", "t=1,v1=deadbeef")
+	StripeWebhook(c)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+type fakeBillingPortalClient struct {
+	params *stripe.BillingPortalSessionParams
+}
+
+func (f *fakeBillingPortalClient) New(params *stripe.BillingPortalSessionParams) (*stripe.BillingPortalSession, error) {
+	f.params = params
+	return &stripe.BillingPortalSession{URL: "https://billing.stripe.test/session"}, nil
+}
+
+func TestCreateStripeBillingPortal(t *testing.T) {
+	user := setupSubscriptionWebhookTest(t)
+	originalKey, originalBase := config.StripeSecretKey, config.StripePublicBaseURL
+	originalClient := newStripeBillingPortalClient
+	fake := &fakeBillingPortalClient{}
+	config.StripeSecretKey = "sk_test_portal"
+	config.StripePublicBaseURL = "https://oneapi.example.com"
+	newStripeBillingPortalClient = func(string) stripeBillingPortalClient { return fake }
+	t.Cleanup(func() {
+		config.StripeSecretKey, config.StripePublicBaseURL = originalKey, originalBase
+		newStripeBillingPortalClient = originalClient
+	})
+
+	call := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/user/subscription/stripe/portal", nil)
+		c.Set(ctxkey.Id, user.Id)
+		CreateStripeBillingPortal(c)
+		return w
+	}
+
+	require.Equal(t, http.StatusNotFound, call().Code)
+
+	postStripeEvent(t, "evt_created", "customer.subscription.created", 100, stripeSubscriptionPayload(user.Id, "active"))
+	w := call()
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "https://billing.stripe.test/session")
+	require.Equal(t, "cus_1", *fake.params.Customer)
+	require.Equal(t, "https://oneapi.example.com/topup", *fake.params.ReturnURL)
+}
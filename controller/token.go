@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Laisky/errors/v2"
 	gmw "github.com/Laisky/gin-middlewares/v7"
@@ -23,6 +24,8 @@ import (
 	"github.com/Laisky/one-api/common/network"
 	"github.com/Laisky/one-api/common/random"
 	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/contextfit"
+	"github.com/Laisky/one-api/relay/guardrail"
 )
 
 func GetRequestCost(c *gin.Context) {
@@ -170,10 +173,43 @@ func validateToken(_ *gin.Context, token *model.Token) error {
 		}
 	}
 
+	if token.RateLimitRPM < 0 || token.RateLimitTPM < 0 || token.MaxInFlight < 0 {
+		return errors.Errorf("rate limits cannot be negative")
+	}
+
+	if !model.IsValidBudgetPeriod(token.BudgetPeriod) {
+		return errors.Errorf("budget period must be daily, weekly or monthly")
+	}
+	if token.BudgetQuota < 0 {
+		return errors.Errorf("budget quota cannot be negative")
+	}
+
+	token.GuardrailPolicy = strings.TrimSpace(token.GuardrailPolicy)
+	if token.GuardrailPolicy != "" && !guardrail.HasPolicy(token.GuardrailPolicy) {
+		return errors.Errorf("guardrail policy %q does not exist", token.GuardrailPolicy)
+	}
+
+	token.ContextStrategy = strings.TrimSpace(token.ContextStrategy)
+	if token.ContextStrategy != "" && !contextfit.IsValidStrategy(token.ContextStrategy) {
+		return errors.Errorf("context strategy must be reject, truncate or summarize")
+	}
+
+	scopes, err := model.NormalizeTokenScopes(token.Scopes)
+	if err != nil {
+		return err
+	}
+	token.Scopes = scopes
+
 	return nil
 }
 
 func AddToken(c *gin.Context) {
+	createToken(c, 0)
+}
+
+// createToken binds a token creation payload and inserts it for the current
+// user; orgId > 0 makes the organization the token's owner and payer.
+func createToken(c *gin.Context, orgId int) {
 	token := new(model.Token)
 	err := c.ShouldBindJSON(token)
 	if err != nil {
@@ -197,16 +233,25 @@ func AddToken(c *gin.Context) {
 	}
 
 	cleanToken := model.Token{
-		UserId:         c.GetInt(ctxkey.Id),
-		Name:           token.Name,
-		Key:            random.GenerateKey(),
-		CreatedTime:    helper.GetTimestamp(),
-		AccessedTime:   helper.GetTimestamp(),
-		ExpiredTime:    token.ExpiredTime,
-		RemainQuota:    token.RemainQuota,
-		UnlimitedQuota: token.UnlimitedQuota,
-		Models:         token.Models,
-		Subnet:         token.Subnet,
+		UserId:          c.GetInt(ctxkey.Id),
+		Name:            token.Name,
+		Key:             random.GenerateKey(),
+		CreatedTime:     helper.GetTimestamp(),
+		AccessedTime:    helper.GetTimestamp(),
+		ExpiredTime:     token.ExpiredTime,
+		RemainQuota:     token.RemainQuota,
+		UnlimitedQuota:  token.UnlimitedQuota,
+		Models:          token.Models,
+		Subnet:          token.Subnet,
+		RateLimitRPM:    token.RateLimitRPM,
+		RateLimitTPM:    token.RateLimitTPM,
+		MaxInFlight:     token.MaxInFlight,
+		BudgetPeriod:    token.BudgetPeriod,
+		BudgetQuota:     token.BudgetQuota,
+		GuardrailPolicy: token.GuardrailPolicy,
+		ContextStrategy: token.ContextStrategy,
+		Scopes:          token.Scopes,
+		OrgId:           orgId,
 	}
 	err = cleanToken.Insert(gmw.Ctx(c))
 	if err != nil {
@@ -398,6 +443,7 @@ func processPreConsume(ctx context.Context, _ *gin.Context, token *model.Token,
 
 	logEntry := &model.Log{
 		UserId:    userID,
+		OrgId:     token.OrgId,
 		UserUUID:  token.UserUUID,
 		ModelName: req.AddReason,
 		TokenName: token.Name,
@@ -675,6 +721,7 @@ func processZeroQuotaImmediateConsume(ctx context.Context, token *model.Token, u
 
 	logEntry := &model.Log{
 		UserId:    userID,
+		OrgId:     token.OrgId,
 		UserUUID:  token.UserUUID,
 		ModelName: req.AddReason,
 		TokenName: token.Name,
@@ -975,6 +1022,20 @@ func UpdateToken(c *gin.Context) {
 		}
 	}
 
+	// A member removed from an organization, or demoted to viewer, must not
+	// re-enable the organization tokens that were disabled on the way out.
+	if cleanToken.OrgId > 0 && token.Status == model.TokenStatusEnabled && cleanToken.Status != model.TokenStatusEnabled {
+		role, err := model.GetOrgMemberRole(cleanToken.OrgId, userId)
+		if err != nil {
+			helper.RespondError(c, err)
+			return
+		}
+		if !model.OrgRoleAtLeast(role, model.OrgRoleMember) {
+			helper.RespondError(c, errkind.ForbiddenErr(errors.New("only organization members can enable organization tokens")))
+			return
+		}
+	}
+
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
@@ -984,6 +1045,14 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.RateLimitRPM = token.RateLimitRPM
+		cleanToken.RateLimitTPM = token.RateLimitTPM
+		cleanToken.MaxInFlight = token.MaxInFlight
+		cleanToken.BudgetPeriod = token.BudgetPeriod
+		cleanToken.BudgetQuota = token.BudgetQuota
+		cleanToken.GuardrailPolicy = token.GuardrailPolicy
+		cleanToken.ContextStrategy = token.ContextStrategy
+		cleanToken.Scopes = token.Scopes
 		cleanToken.RemainQuota = token.RemainQuota
 		cleanToken.Status = token.Status
 	}
@@ -1001,7 +1070,8 @@ func UpdateToken(c *gin.Context) {
 }
 
 // GetTokenBalance retrieves the current quota status for the token authenticated in the request.
-// It returns remaining quota, used quota, and whether the quota is unlimited.
+// It returns remaining quota, used quota, and whether the quota is unlimited, plus the
+// current window usage of the token's and its owner's spend budgets when they have one.
 func GetTokenBalance(c *gin.Context) {
 	tokenId := c.GetInt(ctxkey.TokenId)
 	token, err := model.GetTokenById(tokenId)
@@ -1009,15 +1079,27 @@ func GetTokenBalance(c *gin.Context) {
 		helper.RespondError(c, err)
 		return
 	}
+	userBudget, err := model.GetUserBudgetStatus(token.UserId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
 
+	data := gin.H{
+		"remain_quota":    token.RemainQuota,
+		"used_quota":      token.UsedQuota,
+		"unlimited_quota": token.UnlimitedQuota,
+	}
+	if budget := token.BudgetStatus(time.Now()); budget != nil {
+		data["budget"] = budget
+	}
+	if userBudget != nil {
+		data["user_budget"] = userBudget
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data": gin.H{
-			"remain_quota":    token.RemainQuota,
-			"used_quota":      token.UsedQuota,
-			"unlimited_quota": token.UnlimitedQuota,
-		},
+		"data":    data,
 	})
 }
 
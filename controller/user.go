@@ -945,6 +945,41 @@ func UpdateUser(c *gin.Context) {
 		}
 	}
 
+	if rawFieldPresent(raw, "budget_period") {
+		if jsonRawIsNull(raw["budget_period"]) {
+			// nil => no change
+		} else {
+			var period string
+			if err := json.Unmarshal(raw["budget_period"], &period); err != nil {
+				helper.RespondError(c, errkind.InvalidRequestErr(errors.New(invalidParameterMessage)))
+				return
+			}
+			period = strings.TrimSpace(period)
+			if !model.IsValidBudgetPeriod(period) {
+				helper.RespondError(c, errkind.InvalidRequestErr(errors.New("Budget period must be daily, weekly or monthly")))
+				return
+			}
+			updates["budget_period"] = period
+		}
+	}
+
+	if rawFieldPresent(raw, "budget_quota") {
+		if jsonRawIsNull(raw["budget_quota"]) {
+			// nil => no change
+		} else {
+			var budgetQuota int64
+			if err := json.Unmarshal(raw["budget_quota"], &budgetQuota); err != nil {
+				helper.RespondError(c, errkind.InvalidRequestErr(errors.New(invalidParameterMessage)))
+				return
+			}
+			if budgetQuota < 0 {
+				helper.RespondError(c, errkind.InvalidRequestErr(errors.New("Budget quota must be non-negative")))
+				return
+			}
+			updates["budget_quota"] = budgetQuota
+		}
+	}
+
 	if rawFieldPresent(raw, "quota") {
 		if jsonRawIsNull(raw["quota"]) {
 			// nil => no change
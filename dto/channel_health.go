@@ -0,0 +1,17 @@
+package dto
+
+// ChannelHealthResponse is the external shape of the rolling health score of
+// one (channel, model) pair. Latencies are in milliseconds.
+type ChannelHealthResponse struct {
+	ChannelUUID      string  `json:"channel_uuid"`
+	ChannelName      string  `json:"channel_name"`
+	Model            string  `json:"model"`
+	Samples          int     `json:"samples"`
+	SuccessRate      float64 `json:"success_rate"`
+	P50LatencyMs     int64   `json:"p50_latency_ms"`
+	P95LatencyMs     int64   `json:"p95_latency_ms"`
+	P95TTFTMs        int64   `json:"p95_ttft_ms,omitempty"`
+	Score            float64 `json:"score"`
+	WeightMultiplier float64 `json:"weight_multiplier"`
+	LastSeen         int64   `json:"last_seen"`
+}
@@ -0,0 +1,17 @@
+package dto
+
+// ChannelKeyResponse is the external shape of one pooled channel key. The
+// credential itself never crosses the API; only a masked preview is returned.
+type ChannelKeyResponse struct {
+	UUID         string `json:"uuid"`
+	MaskedKey    string `json:"masked_key"`
+	Status       int    `json:"status"`
+	SuspendUntil *int64 `json:"suspend_until"`
+	RequestCount int64  `json:"request_count"`
+	ErrorCount   int64  `json:"error_count"`
+	LastUsedAt   int64  `json:"last_used_at"`
+	LastErrorAt  int64  `json:"last_error_at"`
+	LastError    string `json:"last_error"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
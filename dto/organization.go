@@ -0,0 +1,24 @@
+package dto
+
+// OrganizationResponse is the external shape of an organization. Role is the
+// caller's role in it and is omitted on admin listings.
+type OrganizationResponse struct {
+	UUID         string `json:"uuid"`
+	Name         string `json:"name"`
+	Status       int    `json:"status"`
+	Quota        int64  `json:"quota"`
+	UsedQuota    int64  `json:"used_quota"`
+	RequestCount int    `json:"request_count"`
+	Role         string `json:"role,omitempty"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+// OrganizationMemberResponse is the external shape of one organization member.
+type OrganizationMemberResponse struct {
+	UserUUID    string `json:"user_uuid"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Role        string `json:"role"`
+	CreatedAt   int64  `json:"created_at"`
+}
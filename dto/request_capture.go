@@ -0,0 +1,33 @@
+package dto
+
+// CaptureRuleResponse is the external shape of a capture rule. Exactly one of
+// UserUUID and TokenUUID is set.
+type CaptureRuleResponse struct {
+	UUID      string `json:"uuid"`
+	UserUUID  string `json:"user_uuid,omitempty"`
+	TokenUUID string `json:"token_uuid,omitempty"`
+	ExpiresAt int64  `json:"expires_at"`
+	Remark    string `json:"remark"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// RequestCaptureResponse is the external shape of a request capture. The body
+// fields are omitted from listings and filled when one capture is fetched.
+type RequestCaptureResponse struct {
+	UUID            string `json:"uuid"`
+	RequestId       string `json:"request_id"`
+	UserUUID        string `json:"user_uuid"`
+	TokenUUID       string `json:"token_uuid"`
+	ChannelUUID     string `json:"channel_uuid"`
+	Model           string `json:"model"`
+	Method          string `json:"method"`
+	Path            string `json:"path"`
+	IsStream        bool   `json:"is_stream"`
+	StatusCode      int    `json:"status_code"`
+	InboundRequest  string `json:"inbound_request,omitempty"`
+	UpstreamURL     string `json:"upstream_url,omitempty"`
+	UpstreamRequest string `json:"upstream_request,omitempty"`
+	Response        string `json:"response,omitempty"`
+	Truncated       bool   `json:"truncated"`
+	CreatedAt       int64  `json:"created_at"`
+}
@@ -76,6 +76,24 @@ type TokenResponse struct {
 	UpdatedAt      int64   `json:"updated_at"`
 	Models         *string `json:"models"`
 	Subnet         *string `json:"subnet"`
+	// Per-token limits are omitted when unset (0 = unlimited) so tokens without
+	// limits keep the established response shape.
+	RateLimitRPM int `json:"rate_limit_rpm,omitempty"`
+	RateLimitTPM int `json:"rate_limit_tpm,omitempty"`
+	MaxInFlight  int `json:"max_in_flight,omitempty"`
+	// The spend budget is likewise omitted when unset; its window usage is
+	// reported by /api/token/balance.
+	BudgetPeriod string `json:"budget_period,omitempty"`
+	BudgetQuota  int64  `json:"budget_quota,omitempty"`
+	// GuardrailPolicy is omitted when the token adds no guardrail policy.
+	GuardrailPolicy string `json:"guardrail_policy,omitempty"`
+	// ContextStrategy is omitted when the token does not fit oversized requests.
+	ContextStrategy string `json:"context_strategy,omitempty"`
+	// OrgUUID names the organization owning and paying for the token; it is
+	// omitted for personal tokens.
+	OrgUUID *string `json:"org_uuid,omitempty"`
+	// Scopes is omitted when the token may call every relay endpoint.
+	Scopes string `json:"scopes,omitempty"`
 }
 
 // UserResponse is the external shape of a user. It mirrors the legacy userJSON
@@ -101,6 +119,10 @@ type UserResponse struct {
 	Metadata         UserMetadataResponse `json:"metadata"`
 	CreatedAt        int64                `json:"created_at"`
 	UpdatedAt        int64                `json:"updated_at"`
+	// The spend budget is omitted when unset so users without one keep the
+	// established response shape.
+	BudgetPeriod string `json:"budget_period,omitempty"`
+	BudgetQuota  int64  `json:"budget_quota,omitempty"`
 }
 
 // UserMetadataResponse mirrors model.UserMetadata for the boundary response.
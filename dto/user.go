@@ -24,4 +24,6 @@ type UserAdminUpdatePayload struct {
 	Status           *int                 `json:"status"`
 	MCPToolBlacklist *[]string            `json:"mcp_tool_blacklist"`
 	Metadata         *UserMetadataPayload `json:"metadata"`
+	BudgetPeriod     *string              `json:"budget_period"`
+	BudgetQuota      *int64               `json:"budget_quota"`
 }
@@ -32,6 +32,7 @@ import (
 	"github.com/Laisky/one-api/common/graceful"
 	"github.com/Laisky/one-api/common/logger"
 	"github.com/Laisky/one-api/common/telemetry"
+	"github.com/Laisky/one-api/common/usageexport"
 	"github.com/Laisky/one-api/controller"
 	"github.com/Laisky/one-api/middleware"
 	"github.com/Laisky/one-api/model"
@@ -84,11 +85,22 @@ func main() {
 	// Initialize SQL Database. The bootstrap orchestrator initializes both schemas,
 	// constructs the explicit database topology, and runs external UUID reconciliation
 	// exactly once, so the InitDB/InitLogDB compatibility wrappers are not used here.
+	// Load the channel secret keys before any channel row is read or written.
+	if err := model.InitChannelSecretKeyRing(); err != nil {
+		logger.Logger.Fatal("failed to initialize channel secret keys", zap.Error(err))
+	}
+	// Resolve the token key hash secret before legacy keys are hashed.
+	if err := model.InitTokenKeyHashSecret(); err != nil {
+		logger.Logger.Fatal("failed to initialize token key hash secret", zap.Error(err))
+	}
 	if err := model.InitDatabases(ctx); err != nil {
 		logger.Logger.Fatal("database bootstrap error", zap.Error(err))
 	}
 	model.StartTraceRetentionCleaner(ctx, config.TraceRetentionDays)
 	model.StartAsyncTaskRetentionCleaner(ctx, config.AsyncTaskRetentionDays)
+	model.StartCaptureRetentionCleaner(ctx, config.CaptureRetentionDays)
+	model.StartCaptureRuleSync(ctx)
+	model.StartStatementFreezer(ctx, config.StatementFreezeEnabled && config.IsMasterNode)
 	err = model.CreateRootAccountIfNeed()
 	if err != nil {
 		logger.Logger.Fatal("database init error", zap.Error(err))
@@ -114,6 +126,12 @@ func main() {
 		logger.Logger.Fatal("failed to initialize response state layer", zap.Error(err))
 	}
 
+	// Initialize usage event export. It is a no-op unless a USAGE_EXPORT_* sink
+	// is configured.
+	if err = usageexport.Init(); err != nil {
+		logger.Logger.Fatal("failed to initialize usage event export", zap.Error(err))
+	}
+
 	// Initialize options
 	model.InitOptionMap()
 	if common.IsRedisEnabled() {
@@ -234,6 +252,9 @@ func main() {
 	}
 
 	router.SetRouter(server, buildFS)
+	controller.StartBatchWorker(ctx, server)
+	controller.StartGuardrailModerator(server)
+	controller.StartContextSummarizer(server)
 	port := config.ServerPort
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
@@ -287,6 +308,11 @@ func main() {
 		logger.Logger.Error("graceful drain finished with timeout/error", zap.Error(err))
 	}
 
+	// Flush usage events after billing has drained; undelivered ones are spooled.
+	if err := usageexport.Shutdown(shutdownCtx); err != nil {
+		logger.Logger.Error("failed to flush usage events", zap.Error(err))
+	}
+
 	if otelProviders != nil {
 		if err := otelProviders.Shutdown(shutdownCtx); err != nil {
 			logger.Logger.Error("failed to shutdown OpenTelemetry", zap.Error(err))
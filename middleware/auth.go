@@ -211,6 +211,7 @@ func RootAuth() func(c *gin.Context) {
 //   - Model access permissions
 //   - Quota limits
 //   - Channel-specific access (for admin users)
+//   - Per-token RPM, TPM and in-flight request limits (if configured)
 //
 // Use this for API endpoints that will be accessed programmatically with API tokens.
 func TokenAuth() func(c *gin.Context) {
@@ -238,8 +239,16 @@ func TokenAuth() func(c *gin.Context) {
 			zap.String("masked_key", helper.MaskAPIKey(key)),
 		)
 
-		// Validate the API token against the database
-		token, err := model.ValidateUserToken(ctx, key)
+		// Validate the API token against the database. In-process requests (batch
+		// lines) carry the token id on the request context instead of a key.
+		internalRelay, isInternalRelay := InternalRelayFromContext(c.Request.Context())
+		var token *model.Token
+		var err error
+		if isInternalRelay {
+			token, err = model.ValidateUserTokenById(ctx, internalRelay.TokenId)
+		} else {
+			token, err = model.ValidateUserToken(ctx, key)
+		}
 		if err != nil {
 			AbortWithError(c, http.StatusUnauthorized, err)
 			return
@@ -258,8 +267,9 @@ func TokenAuth() func(c *gin.Context) {
 		// banned user, model restriction) already log token uuid + name.
 		identity.Bind(c, identity.Set{Token: tokenInfo.Token, User: tokenInfo.User})
 
-		// Check IP subnet restrictions (if configured for this token)
-		if token.Subnet != nil && *token.Subnet != "" {
+		// Check IP subnet restrictions (if configured for this token). In-process
+		// requests were already checked when the client submitted the batch.
+		if !isInternalRelay && token.Subnet != nil && *token.Subnet != "" {
 			if !network.IsIpInSubnets(ctx, c.ClientIP(), *token.Subnet) {
 				// The caller presented a valid key from a disallowed network.
 				AbortWithTokenError(c, http.StatusForbidden, errkind.ForbiddenErr(errors.Errorf("This API key can only be used in the specified subnet: %s, current IP: %s", *token.Subnet, c.ClientIP())), tokenInfo)
@@ -286,6 +296,30 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 
+		// Organization tokens stop working as soon as the organization is disabled.
+		if token.OrgId > 0 {
+			orgEnabled, err := model.CacheIsOrganizationEnabled(ctx, token.OrgId)
+			if err != nil {
+				AbortWithTokenError(c, http.StatusInternalServerError, errors.Wrap(err, "failed to get organization"), tokenInfo)
+				return
+			}
+			if !orgEnabled {
+				AbortWithTokenError(c, http.StatusForbidden, errkind.ForbiddenErr(errors.New("Organization has been disabled")), tokenInfo)
+				return
+			}
+		}
+
+		// Scoped tokens may only call the relay endpoints they list.
+		scopes := token.ScopeList()
+		if path := c.Request.URL.Path; !model.TokenScopesAllowPath(scopes, path) {
+			endpoint := model.TokenScopeForPath(path)
+			if endpoint == "" {
+				endpoint = path
+			}
+			AbortWithTokenError(c, http.StatusForbidden, errkind.ForbiddenErr(errors.Errorf("This API key does not have permission to call the %s endpoint", endpoint)), tokenInfo)
+			return
+		}
+
 		// Extract and validate the requested model (for AI/ML API endpoints)
 		requestModel, err := getRequestModel(c)
 		if err != nil && shouldCheckModel(c) {
@@ -314,8 +348,32 @@ func TokenAuth() func(c *gin.Context) {
 		c.Set(ctxkey.TokenId, token.Id)
 		c.Set(ctxkey.TokenUUID, token.UUID)
 		c.Set(ctxkey.TokenName, token.Name)
-		c.Set(ctxkey.TokenQuota, token.RemainQuota)
-		c.Set(ctxkey.TokenQuotaUnlimited, token.UnlimitedQuota)
+		c.Set(ctxkey.GuardrailPolicy, token.GuardrailPolicy)
+		// A summarization call must not be fitted again.
+		if isInternalRelay && internalRelay.ContextSummary {
+			c.Set(ctxkey.ContextStrategy, "")
+		} else {
+			c.Set(ctxkey.ContextStrategy, token.ContextStrategy)
+		}
+		if isInternalRelay && internalRelay.ParentRequestId != "" {
+			c.Set(ctxkey.ParentRequestId, internalRelay.ParentRequestId)
+		}
+		if len(scopes) > 0 {
+			c.Set(ctxkey.TokenScopes, scopes)
+		}
+		c.Set(ctxkey.OrgId, token.OrgId)
+		// Relay handlers skip pre-consume when the token has ample quota, so a
+		// token or user spend budget caps what counts as available; otherwise a
+		// near-exhausted budget would never reach the PreConsumeTokenQuota check.
+		tokenQuota, tokenQuotaUnlimited := token.RemainQuota, token.UnlimitedQuota
+		if headroom, limited := model.BudgetHeadroom(ctx, token, user); limited {
+			if tokenQuotaUnlimited || headroom < tokenQuota {
+				tokenQuota = headroom
+			}
+			tokenQuotaUnlimited = false
+		}
+		c.Set(ctxkey.TokenQuota, tokenQuota)
+		c.Set(ctxkey.TokenQuotaUnlimited, tokenQuotaUnlimited)
 		identity.BindFromGin(c)
 
 		// Handle channel-specific routing (admin feature).
@@ -349,6 +407,18 @@ func TokenAuth() func(c *gin.Context) {
 			c.Set(ctxkey.SpecificChannelId, cid)
 		}
 
+		// Per-token RPM/TPM/in-flight limits. Batch lines were admitted when the
+		// batch was submitted, so the executor is not throttled line by line;
+		// guardrail moderation and context summary calls ride on a request that
+		// was already admitted.
+		if !isInternalRelay || (internalRelay.BatchId == "" && !internalRelay.Guardrail && !internalRelay.ContextSummary) {
+			release, ok := enforceTokenRateLimits(c, token)
+			if !ok {
+				return
+			}
+			defer release()
+		}
+
 		c.Next()
 	}
 }
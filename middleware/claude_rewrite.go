@@ -8,6 +8,7 @@ import (
 
 // RewriteClaudeMessagesPrefix returns a middleware that rewrites any request path
 // starting with the given prefix to the canonical Claude Messages endpoint: /v1/messages.
+// The /count_tokens sub-path is preserved, i.e. it maps to /v1/messages/count_tokens.
 // It then re-dispatches the request to the engine so the canonical route and its
 // middlewares handle it, and aborts the current handler chain.
 //
@@ -24,7 +25,11 @@ func RewriteClaudeMessagesPrefix(prefix string, engine *gin.Engine) gin.HandlerF
 		// Only handle when the incoming path actually matches the prefix.
 		if strings.HasPrefix(path, normalized) {
 			// Rewrite the request path to the canonical endpoint.
-			c.Request.URL.Path = "/v1/messages"
+			if strings.TrimPrefix(path, normalized) == "/count_tokens" {
+				c.Request.URL.Path = "/v1/messages/count_tokens"
+			} else {
+				c.Request.URL.Path = "/v1/messages"
+			}
 			// Re-dispatch to let the canonical route handle the request.
 			engine.HandleContext(c)
 			// Stop further processing in the current chain.
@@ -15,6 +15,7 @@ func setupTestEngine() *gin.Engine {
 	// Canonical handler
 	v1 := r.Group("/v1")
 	v1.POST("/messages", func(c *gin.Context) { c.String(200, "ok") })
+	v1.POST("/messages/count_tokens", func(c *gin.Context) { c.String(200, "count") })
 	return r
 }
 
@@ -55,3 +56,15 @@ func TestRewriteNonMatchingPassThrough(t *testing.T) {
 	require.Equal(t, http.StatusOK, w.Code, "expected 200")
 	require.Equal(t, "healthy", w.Body.String(), "unexpected body")
 }
+
+func TestRewriteClaudeMessagesPrefixKeepsCountTokens(t *testing.T) {
+	t.Parallel()
+	engine := setupTestEngine()
+	engine.Use(RewriteClaudeMessagesPrefix("/v1/v1/messages", engine))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/v1/messages/count_tokens", nil)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "count", w.Body.String())
+}
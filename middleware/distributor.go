@@ -13,6 +13,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 
+	"github.com/Laisky/one-api/common/config"
 	"github.com/Laisky/one-api/common/ctxkey"
 	"github.com/Laisky/one-api/common/errkind"
 	"github.com/Laisky/one-api/common/identity"
@@ -223,6 +224,10 @@ func Distribute() func(c *gin.Context) {
 		relayMode := relaymode.GetByPath(c.Request.URL.Path)
 
 		var requestModel string
+		// servedModel is the model the selected channel will serve; it differs from
+		// requestModel when that is a virtual model or after degrading along a
+		// model fallback chain.
+		var servedModel string
 		var channel *model.Channel
 		channelId := c.GetInt(ctxkey.SpecificChannelId)
 		if channelId != 0 {
@@ -240,7 +245,15 @@ func Distribute() func(c *gin.Context) {
 				return
 			}
 			requestModel = c.GetString(ctxkey.RequestModel)
-			if requestModel != "" && !channel.SupportsModel(requestModel) {
+			servedModel = requestModel
+			// A pinned channel serves the first virtual target it supports.
+			for _, target := range model.ResolveVirtualModel(requestModel) {
+				if channel.SupportsModel(target) {
+					servedModel = target
+					break
+				}
+			}
+			if servedModel != "" && !channel.SupportsModel(servedModel) {
 				// The channel was pinned by the caller (API key suffix), so the
 				// model/channel mismatch is a property of the request itself.
 				AbortWithError(c, http.StatusBadRequest,
@@ -277,6 +290,9 @@ func Distribute() func(c *gin.Context) {
 					lg.Debug("response websocket handshake has no model in pre-upgrade request; selecting channel by group+endpoint")
 				}
 			}
+			// Virtual models are resolved before ability lookup, so an alias needs
+			// no abilities of its own.
+			servedModel = resolveVirtualModel(c, requestModel)
 
 			// ST-005: prefer the channel bound to a referenced gateway response or
 			// conversation (provider affinity). This is a soft preference resolved
@@ -284,7 +300,7 @@ func Distribute() func(c *gin.Context) {
 			// and selection proceeds normally so fallback routes replay canonical items
 			// (rows R01, R02, R05, R07). It never sets SpecificChannelId, so retry and
 			// failover remain enabled (row R03).
-			if pinned := responseStateAffinityChannel(c, relayMode, userGroup, requestModel, isResponseWSHandshake); pinned != nil {
+			if pinned := responseStateAffinityChannel(c, relayMode, userGroup, servedModel, isResponseWSHandshake); pinned != nil {
 				channel = pinned
 				c.Set(ctxkey.ResponseStateAffinityChannelId, pinned.Id)
 			} else {
@@ -294,7 +310,7 @@ func Distribute() func(c *gin.Context) {
 					}
 
 					for {
-						candidate, err := model.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), userGroup, requestModel, ignoreFirstPriority, exclude, false)
+						candidate, err := model.CacheGetRandomSatisfiedChannelExcludingWithContext(gmw.Ctx(c), userGroup, servedModel, ignoreFirstPriority, exclude, false)
 						if err != nil {
 							return nil, errors.Wrap(err, "select channel from cache")
 						}
@@ -329,6 +345,24 @@ func Distribute() func(c *gin.Context) {
 						zap.String("group", userGroup),
 					)
 					channel, err = selectChannel(true, exclude)
+					// Every channel for the served model is unavailable, so move on to
+					// the remaining virtual targets and the admin-defined fallback
+					// chain before giving up.
+					for _, fallbackModel := range FallbackModels(c, requestModel) {
+						if err == nil {
+							break
+						}
+						lg.Info("no channels available for model; trying fallback model",
+							zap.String("model", servedModel),
+							zap.String("fallback_model", fallbackModel),
+							zap.String("group", userGroup),
+						)
+						servedModel = fallbackModel
+						exclude = make(map[int]bool)
+						if channel, err = selectChannel(false, exclude); err != nil {
+							channel, err = selectChannel(true, exclude)
+						}
+					}
 					if err != nil {
 						message := fmt.Sprintf("No available channels for Model %s under Group %s", requestModel, userGroup)
 						// No channel serves this model for this group: an operator
@@ -345,15 +379,37 @@ func Distribute() func(c *gin.Context) {
 			zap.Int("user_id", userId),
 			zap.String("group", userGroup),
 			zap.String("model", requestModel),
+			zap.String("served_model", servedModel),
 			zap.Int("channel_id", channel.Id),
 		)
-		SetupContextForSelectedChannel(c, channel, requestModel)
+		if err := SetupContextForSelectedChannel(c, channel, servedModel); err != nil {
+			AbortWithError(c, http.StatusServiceUnavailable, err)
+			return
+		}
 		c.Next()
 	}
 }
 
-func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
+// SetupContextForSelectedChannel binds channel to the request context for the
+// next relay attempt. It fails without touching the context when the channel
+// uses a key pool and no pooled key can be selected: Channel.Key is not a
+// credential of such a channel, so the attempt must not fall back to it.
+func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) error {
 	lg := gmw.GetLogger(c)
+	// Pooled channels serve each attempt with one key from channel_keys. The
+	// cached channel row is shared, so pin the chosen key onto a copy.
+	channelKeyId := 0
+	poolKey, err := model.SelectChannelKey(gmw.Ctx(c), channel)
+	if err != nil {
+		return errors.Wrapf(err, "select pooled key for channel %s", channel.Name)
+	}
+	if poolKey != nil {
+		pinned := *channel
+		pinned.Key = poolKey.Key
+		channel = &pinned
+		channelKeyId = poolKey.Id
+	}
+	c.Set(ctxkey.ChannelKeyId, channelKeyId)
 	// one channel could relates to multiple groups,
 	// and each groud has individual ratio,
 	// set minimal group ratio as channel_ratio
@@ -364,6 +420,10 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 			minimalRatio = v
 		}
 	}
+	// Batch lines are billed at the configured batch discount.
+	if relay, ok := InternalRelayFromContext(c.Request.Context()); ok && relay.BatchId != "" {
+		minimalRatio *= config.BatchDiscountRatio
+	}
 	lg.Info("set channel ratio",
 		zap.String("channel_name", channel.Name),
 		zap.Float64("channel_ratio", minimalRatio),
@@ -388,7 +448,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	if channel.SystemPrompt != nil && *channel.SystemPrompt != "" {
 		c.Set(ctxkey.SystemPrompt, *channel.SystemPrompt)
 	}
-	c.Set(ctxkey.ModelMapping, channel.GetModelMappingWithContext(gmw.Ctx(c)))
+	bindServedModel(c, channel.GetModelMappingWithContext(gmw.Ctx(c)), modelName)
 	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
 	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
 	if channel.RateLimit != nil {
@@ -424,4 +484,5 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 		}
 	}
 	c.Set(ctxkey.Config, cfg)
+	return nil
 }
@@ -267,6 +267,55 @@ func TestDistributeSpecificChannelAllowsSupportedModel(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rec.Code, "middleware should leave response as OK")
 }
 
+func TestDistributeFailsWhenKeyPoolIsEmpty(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cleanup := setupDistributorTestDB(t)
+	defer cleanup()
+	require.NoError(t, db.AutoMigrate(&model.ChannelKey{}))
+
+	user := &model.User{
+		Id:       30,
+		Username: "tester",
+		Password: "hashed",
+		Group:    "default",
+		Status:   model.UserStatusEnabled,
+	}
+	require.NoError(t, db.Create(user).Error)
+
+	priority := int64(10)
+	channel := &model.Channel{
+		Id:       31,
+		Name:     "pooled",
+		Type:     channeltype.OpenAI,
+		Key:      "sk-channel-row",
+		Models:   "gpt-4o",
+		Group:    "default",
+		Status:   model.ChannelStatusEnabled,
+		Priority: &priority,
+		Config:   `{"key_selection_mode":"round_robin"}`,
+	}
+	require.NoError(t, db.Create(channel).Error)
+	require.NoError(t, channel.AddAbilities())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(`{"model":"gpt-4o"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = req
+
+	c.Set(ctxkey.Id, user.Id)
+	c.Set(ctxkey.RequestModel, "gpt-4o")
+	c.Set(ctxkey.SpecificChannelId, channel.Id)
+	c.Set(ctxkey.TokenId, 7)
+	gmw.SetLogger(c, logger.Logger)
+
+	Distribute()(c)
+
+	assert.True(t, c.IsAborted(), "a pooled channel without keys must not fall back to the channel key")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotContains(t, c.Request.Header.Get("Authorization"), "sk-channel-row")
+}
+
 func TestDistributeAutoSkipsUnsupportedChannel(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	db, cleanup := setupDistributorTestDB(t)
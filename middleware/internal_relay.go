@@ -0,0 +1,41 @@
+package middleware
+
+import "context"
+
+// internalRelayKey is the request-context key carrying an InternalRelay. It is
+// unexported and lives on the request context rather than a header, so only
+// in-process callers can set it; network clients cannot forge it.
+type internalRelayKey struct{}
+
+// InternalRelay identifies a relay request dispatched in-process on behalf of
+// a token, such as one JSONL line of a batch or a guardrail moderation call.
+// TokenAuth authenticates it by token id instead of by the plaintext key.
+type InternalRelay struct {
+	// TokenId is the token whose quota, model allow-list and group apply.
+	TokenId int
+	// BatchId is the public id of the batch that produced the request, if any.
+	BatchId string
+	// Guardrail marks the moderation call of a guardrail policy, made while
+	// the guarded request is being relayed.
+	Guardrail bool
+	// ContextSummary marks the summarization call that shortens an oversized
+	// conversation before it is relayed.
+	ContextSummary bool
+	// ParentRequestId is the request id of the client request the call was made
+	// for, recorded on the sub-request's log.
+	ParentRequestId string
+}
+
+// WithInternalRelay returns a copy of ctx marked as an in-process relay request.
+func WithInternalRelay(ctx context.Context, relay InternalRelay) context.Context {
+	return context.WithValue(ctx, internalRelayKey{}, relay)
+}
+
+// InternalRelayFromContext returns the in-process relay marker stored on ctx.
+func InternalRelayFromContext(ctx context.Context) (InternalRelay, bool) {
+	if ctx == nil {
+		return InternalRelay{}, false
+	}
+	relay, ok := ctx.Value(internalRelayKey{}).(InternalRelay)
+	return relay, ok && relay.TokenId > 0
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/logger"
+)
+
+func TestInternalRelayFromContext(t *testing.T) {
+	_, ok := InternalRelayFromContext(context.Background())
+	require.False(t, ok)
+
+	_, ok = InternalRelayFromContext(WithInternalRelay(context.Background(), InternalRelay{}))
+	require.False(t, ok, "a marker without a token id must not authenticate")
+
+	relay, ok := InternalRelayFromContext(WithInternalRelay(context.Background(), InternalRelay{TokenId: 3, BatchId: "batch_x"}))
+	require.True(t, ok)
+	require.Equal(t, InternalRelay{TokenId: 3, BatchId: "batch_x"}, relay)
+}
+
+func TestRelayRateLimitsSkipInternalRelay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	originalNum, originalDisabled := config.GlobalRelayRateLimitNum, config.RateLimitDisabled
+	originalRedis := common.IsRedisEnabled()
+	config.GlobalRelayRateLimitNum, config.RateLimitDisabled = 1, false
+	common.SetRedisEnabled(false)
+	t.Cleanup(func() {
+		config.GlobalRelayRateLimitNum, config.RateLimitDisabled = originalNum, originalDisabled
+		common.SetRedisEnabled(originalRedis)
+	})
+
+	limit := GlobalRelayRateLimit()
+	serve := func(ctx context.Context) int {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(ctx)
+		gmw.SetLogger(c, logger.Logger)
+		limit(c)
+		return rec.Code
+	}
+
+	// Batch lines carry no API key; they must not share one global bucket.
+	for _, tokenId := range []int{1, 2, 3} {
+		ctx := WithInternalRelay(context.Background(), InternalRelay{TokenId: tokenId, BatchId: "batch_x"})
+		require.Equal(t, http.StatusOK, serve(ctx))
+	}
+
+	require.Equal(t, http.StatusOK, serve(context.Background()))
+	require.Equal(t, http.StatusTooManyRequests, serve(context.Background()))
+}
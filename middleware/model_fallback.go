@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/model"
+)
+
+// FallbackModels returns the models the relay may move on to once every channel
+// of the current one is exhausted. For a virtual model these are its remaining
+// targets, followed by the admin-configured fallback chain of requestModel. Chain
+// models the request's token is not allowed to use are dropped; virtual targets
+// are allowed through the alias.
+func FallbackModels(c *gin.Context, requestModel string) []string {
+	var models []string
+	if targets := c.GetStringSlice(ctxkey.VirtualModelTargets); len(targets) > 1 {
+		models = append(models, targets[1:]...)
+	}
+	allowed := c.GetString(ctxkey.AvailableModels)
+	for _, name := range model.GetModelFallbackChain(requestModel) {
+		if (allowed == "" || isModelInList(name, allowed)) && !slices.Contains(models, name) {
+			models = append(models, name)
+		}
+	}
+	return models
+}
+
+// resolveVirtualModel resolves a virtual requestModel to the target that serves
+// this request and records every target for retries. It returns requestModel
+// unchanged when it is not a virtual model.
+func resolveVirtualModel(c *gin.Context, requestModel string) string {
+	targets := model.ResolveVirtualModel(requestModel)
+	if len(targets) == 0 {
+		return requestModel
+	}
+	c.Set(ctxkey.VirtualModelTargets, targets)
+	return targets[0]
+}
+
+// bindServedModel records which model the selected channel serves and reports it
+// in the response headers. When it is a virtual target or a fallback for the
+// requested model, the requested model is mapped onto it (through the channel's
+// own mapping, if any) so every relay helper sends, prices and logs the served
+// model while the log row keeps the requested model as its origin.
+func bindServedModel(c *gin.Context, channelMapping map[string]string, servedModel string) {
+	c.Set(ctxkey.ModelMapping, channelMapping)
+	if servedModel == "" {
+		return
+	}
+	c.Set(ctxkey.ServedModel, servedModel)
+	c.Header(helper.ServedModelHeader, servedModel)
+
+	requestModel := c.GetString(ctxkey.RequestModel)
+	if requestModel == "" || requestModel == servedModel {
+		return
+	}
+	upstreamModel := servedModel
+	if mapped := channelMapping[servedModel]; mapped != "" {
+		upstreamModel = mapped
+	}
+	mapping := make(map[string]string, len(channelMapping)+1)
+	maps.Copy(mapping, channelMapping)
+	mapping[requestModel] = upstreamModel
+	c.Set(ctxkey.ModelMapping, mapping)
+}
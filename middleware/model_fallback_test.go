@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/channeltype"
+)
+
+func setModelFallbackChains(t *testing.T, chains string) {
+	t.Helper()
+	require.NoError(t, model.UpdateModelFallbackChainsByJSONString(chains))
+	t.Cleanup(func() { _ = model.UpdateModelFallbackChainsByJSONString("") })
+}
+
+func TestFallbackModels_FiltersTokenAllowList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setModelFallbackChains(t, `{"gpt-5":["gpt-5-mini","claude-sonnet-4"]}`)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	require.Equal(t, []string{"gpt-5-mini", "claude-sonnet-4"}, FallbackModels(c, "gpt-5"))
+	require.Empty(t, FallbackModels(c, "gpt-4o"))
+
+	c.Set(ctxkey.AvailableModels, "gpt-5,claude-sonnet-4")
+	require.Equal(t, []string{"claude-sonnet-4"}, FallbackModels(c, "gpt-5"))
+	// Filtering must not corrupt the configured chain.
+	require.Equal(t, []string{"gpt-5-mini", "claude-sonnet-4"}, model.GetModelFallbackChain("gpt-5"))
+}
+
+func TestDistributeFallsBackWhenModelHasNoChannels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cleanup := setupDistributorTestDB(t)
+	defer cleanup()
+
+	originalMemoryCache := config.MemoryCacheEnabled
+	config.MemoryCacheEnabled = false
+	defer func() { config.MemoryCacheEnabled = originalMemoryCache }()
+	setModelFallbackChains(t, `{"gpt-5":["gpt-5-mini"]}`)
+
+	user := &model.User{Id: 5, Username: "fallback", Password: "hashed", Group: "default", Status: model.UserStatusEnabled}
+	require.NoError(t, db.Create(user).Error)
+
+	priority := int64(10)
+	mapping := `{"gpt-5-mini":"gpt-5-mini-2025-08-07"}`
+	channel := &model.Channel{
+		Id:           50,
+		Name:         "mini-only",
+		Type:         channeltype.OpenAI,
+		Models:       "gpt-5-mini",
+		Group:        "default",
+		Status:       model.ChannelStatusEnabled,
+		Priority:     &priority,
+		ModelMapping: &mapping,
+	}
+	require.NoError(t, db.Create(channel).Error)
+	require.NoError(t, channel.AddAbilities())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(`{"model":"gpt-5"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = req
+	c.Set(ctxkey.Id, user.Id)
+	c.Set(ctxkey.RequestModel, "gpt-5")
+	c.Set(ctxkey.TokenId, 7)
+	gmw.SetLogger(c, logger.Logger)
+
+	Distribute()(c)
+
+	require.False(t, c.IsAborted())
+	require.Equal(t, channel.Id, c.GetInt(ctxkey.ChannelId))
+	require.Equal(t, "gpt-5", c.GetString(ctxkey.RequestModel))
+	require.Equal(t, "gpt-5-mini", c.GetString(ctxkey.ServedModel))
+	require.Equal(t, "gpt-5-mini", rec.Header().Get(helper.ServedModelHeader))
+	// The requested model is routed through the channel's own mapping of the fallback.
+	require.Equal(t, "gpt-5-mini-2025-08-07", c.GetStringMapString(ctxkey.ModelMapping)["gpt-5"])
+}
+
+func TestDistributeWithoutFallbackChainReturns503(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cleanup := setupDistributorTestDB(t)
+	defer cleanup()
+
+	originalMemoryCache := config.MemoryCacheEnabled
+	config.MemoryCacheEnabled = false
+	defer func() { config.MemoryCacheEnabled = originalMemoryCache }()
+
+	user := &model.User{Id: 6, Username: "nofallback", Password: "hashed", Group: "default", Status: model.UserStatusEnabled}
+	require.NoError(t, db.Create(user).Error)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(`{"model":"gpt-5"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = req
+	c.Set(ctxkey.Id, user.Id)
+	c.Set(ctxkey.RequestModel, "gpt-5")
+	gmw.SetLogger(c, logger.Logger)
+
+	Distribute()(c)
+
+	require.True(t, c.IsAborted())
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Empty(t, rec.Header().Get(helper.ServedModelHeader))
+}
+
+func TestDistributeResolvesVirtualModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cleanup := setupDistributorTestDB(t)
+	defer cleanup()
+
+	originalMemoryCache := config.MemoryCacheEnabled
+	config.MemoryCacheEnabled = false
+	defer func() { config.MemoryCacheEnabled = originalMemoryCache }()
+	require.NoError(t, model.UpdateVirtualModelsByJSONString(
+		`{"team-default":[{"model":"claude-sonnet-4-5","weight":1},{"model":"gpt-4o","weight":0}]}`))
+	t.Cleanup(func() { _ = model.UpdateVirtualModelsByJSONString("") })
+
+	user := &model.User{Id: 7, Username: "virtual", Password: "hashed", Group: "default", Status: model.UserStatusEnabled}
+	require.NoError(t, db.Create(user).Error)
+
+	// Only the failover target has a channel; the alias itself has no abilities.
+	priority := int64(10)
+	channel := &model.Channel{
+		Id:       70,
+		Name:     "gpt-4o-only",
+		Type:     channeltype.OpenAI,
+		Models:   "gpt-4o",
+		Group:    "default",
+		Status:   model.ChannelStatusEnabled,
+		Priority: &priority,
+	}
+	require.NoError(t, db.Create(channel).Error)
+	require.NoError(t, channel.AddAbilities())
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(`{"model":"team-default"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = req
+	c.Set(ctxkey.Id, user.Id)
+	c.Set(ctxkey.RequestModel, "team-default")
+	c.Set(ctxkey.AvailableModels, "team-default")
+	gmw.SetLogger(c, logger.Logger)
+
+	Distribute()(c)
+
+	require.False(t, c.IsAborted())
+	require.Equal(t, channel.Id, c.GetInt(ctxkey.ChannelId))
+	require.Equal(t, "team-default", c.GetString(ctxkey.RequestModel))
+	require.Equal(t, "gpt-4o", c.GetString(ctxkey.ServedModel))
+	require.Equal(t, "gpt-4o", rec.Header().Get(helper.ServedModelHeader))
+	require.Equal(t, "gpt-4o", c.GetStringMapString(ctxkey.ModelMapping)["team-default"])
+	require.Equal(t, []string{"claude-sonnet-4-5", "gpt-4o"}, c.GetStringSlice(ctxkey.VirtualModelTargets))
+}
@@ -174,7 +174,21 @@ func UploadRateLimit() func(c *gin.Context) {
 }
 
 func GlobalRelayRateLimit() func(c *gin.Context) {
-	return rateLimitFactory(config.GlobalRelayRateLimitNum, config.GlobalRelayRateLimitDuration, "GR")
+	return skipInternalRelay(rateLimitFactory(config.GlobalRelayRateLimitNum, config.GlobalRelayRateLimitDuration, "GR"))
+}
+
+// skipInternalRelay exempts in-process relay requests (batch lines, guardrail
+// moderation and context summary calls) from a relay limiter. They carry no API
+// key, so the key-hashed buckets would pool every tenant into one, and like the
+// per-token limits in TokenAuth they ride on work that was already admitted.
+func skipInternalRelay(limit func(c *gin.Context)) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if _, ok := InternalRelayFromContext(c.Request.Context()); ok {
+			c.Next()
+			return
+		}
+		limit(c)
+	}
 }
 
 // ConversationsRateLimit throttles the gateway Conversations API per
@@ -199,7 +213,7 @@ func ConversationsRateLimit() func(c *gin.Context) {
 // exceeded the response explains that the throttling is caused by the low balance,
 // so the client knows to top up.
 func LowBalanceRelayRateLimit() func(c *gin.Context) {
-	return func(c *gin.Context) {
+	return skipInternalRelay(func(c *gin.Context) {
 		// Mirror the other relay limiters: disabled only via the explicit
 		// RATE_LIMIT_DISABLED toggle (never tied to DEBUG, which is logging-only).
 		if config.RateLimitDisabled {
@@ -250,8 +264,9 @@ func LowBalanceRelayRateLimit() func(c *gin.Context) {
 		// Read the live balance (kept current as the user spends) rather than the
 		// cached user-object snapshot, so the throttle reacts promptly when a user
 		// drains their balance. Fall back to the snapshot if the lookup fails.
+		// Organization tokens spend the organization pool, so its balance decides.
 		balance := user.Quota
-		if liveQuota, err := model.CacheGetUserQuota(gmw.Ctx(c), user.Id); err == nil {
+		if liveQuota, err := model.CacheGetPayerQuota(gmw.Ctx(c), user.Id, c.GetInt(ctxkey.OrgId)); err == nil {
 			balance = liveQuota
 		} else {
 			gmw.GetLogger(c).Warn("low-balance limiter: live quota lookup failed, using cached snapshot",
@@ -287,7 +302,7 @@ func LowBalanceRelayRateLimit() func(c *gin.Context) {
 		}
 
 		c.Next()
-	}
+	})
 }
 
 func ChannelRateLimit() func(c *gin.Context) {
@@ -295,7 +310,7 @@ func ChannelRateLimit() func(c *gin.Context) {
 	if config.ChannelRateLimitEnabled {
 		maxRequestNum = 1
 	}
-	return rateLimitFactory(maxRequestNum, config.ChannelRateLimitDuration, "CR")
+	return skipInternalRelay(rateLimitFactory(maxRequestNum, config.ChannelRateLimitDuration, "CR"))
 }
 
 // TotpRateLimit limits TOTP verification attempts to 1 per second per user
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	dbmodel "github.com/Laisky/one-api/model"
+)
+
+// TestTokenAuthEnforcesScopes verifies that a scoped token reaches only the
+// relay endpoints it lists, while non-relay routes such as /v1/models stay open.
+func TestTokenAuthEnforcesScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&dbmodel.User{}, &dbmodel.Token{}))
+	userUUID := "018f0000-0000-7000-8000-000000000301"
+	require.NoError(t, db.Create(&dbmodel.User{
+		Id:       1,
+		UUID:     userUUID,
+		Username: "search",
+		Password: "password-hash",
+		Role:     dbmodel.RoleCommonUser,
+		Status:   dbmodel.UserStatusEnabled,
+		Group:    "default",
+	}).Error)
+	require.NoError(t, db.Create(&dbmodel.Token{
+		Id:             1,
+		UUID:           "018f0000-0000-7000-8000-000000000302",
+		UserId:         1,
+		UserUUID:       &userUUID,
+		Key:            "scopedtoken",
+		Status:         dbmodel.TokenStatusEnabled,
+		Name:           "embeddings-only",
+		ExpiredTime:    -1,
+		RemainQuota:    1,
+		UnlimitedQuota: true,
+		Scopes:         "embeddings",
+	}).Error)
+
+	originalDB := dbmodel.DB
+	originalSQLite := common.UsingSQLite.Load()
+	originalPrefix := config.TokenKeyPrefix
+	dbmodel.DB = db
+	common.UsingSQLite.Store(true)
+	config.TokenKeyPrefix = "sk-"
+	t.Cleanup(func() {
+		dbmodel.DB = originalDB
+		common.UsingSQLite.Store(originalSQLite)
+		config.TokenKeyPrefix = originalPrefix
+	})
+
+	engine := gin.New()
+	engine.Use(TokenAuth())
+	handler := func(c *gin.Context) {
+		scopes, ok := c.Get(ctxkey.TokenScopes)
+		require.True(t, ok)
+		require.Equal(t, []string{"embeddings"}, scopes)
+		c.Status(http.StatusNoContent)
+	}
+	engine.GET("/v1/models", handler)
+	engine.POST("/v1/embeddings", handler)
+	engine.POST("/v1/chat/completions", handler)
+	engine.POST("/v1/images/generations", handler)
+	engine.POST("/v1/voice/clones", handler)
+	engine.POST("/v1/files", handler)
+	engine.POST("/v1/batches", handler)
+	engine.POST("/v1/fine_tuning/jobs", handler)
+
+	cases := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/v1/models", http.StatusNoContent},
+		{http.MethodPost, "/v1/embeddings", http.StatusNoContent},
+		{http.MethodPost, "/v1/chat/completions", http.StatusForbidden},
+		{http.MethodPost, "/v1/images/generations", http.StatusForbidden},
+		{http.MethodPost, "/v1/voice/clones", http.StatusForbidden},
+		{http.MethodPost, "/v1/files", http.StatusForbidden},
+		{http.MethodPost, "/v1/batches", http.StatusForbidden},
+		{http.MethodPost, "/v1/fine_tuning/jobs", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"model":"text-embedding-3-small","input":"hi"}`))
+			req.Header.Set("Authorization", "Bearer sk-scopedtoken")
+			req.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+			require.Equal(t, tc.want, recorder.Code, recorder.Body.String())
+			if tc.want == http.StatusForbidden {
+				require.Contains(t, recorder.Body.String(), "does not have permission to call")
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/model"
+)
+
+// tokenInFlightReleaseTimeout bounds the release of an in-flight slot, which
+// runs detached from the request context.
+const tokenInFlightReleaseTimeout = 5 * time.Second
+
+// enforceTokenRateLimits applies the token's requests-per-minute, tokens-per-minute
+// and max in-flight limits, setting the x-ratelimit-* headers on the way.
+// Storage errors fail open so a Redis outage never locks users out.
+//
+// Returns:
+//   - release: frees the in-flight slot; call it once the request finishes. Never nil.
+//   - ok: false when the request was rejected with 429 and the context aborted.
+func enforceTokenRateLimits(c *gin.Context, token *model.Token) (release func(), ok bool) {
+	release = func() {}
+	if config.RateLimitDisabled {
+		return release, true
+	}
+	ctx := gmw.Ctx(c)
+	lg := gmw.GetLogger(c)
+
+	// Concurrency is checked first, so a request rejected for it does not use
+	// up one of the token's requests per minute.
+	if token.MaxInFlight > 0 {
+		acquired, err := model.AcquireTokenInFlight(ctx, token.Id, token.MaxInFlight)
+		switch {
+		case err != nil:
+			lg.Warn("token in-flight check failed, allowing request", zap.Int("token_id", token.Id), zap.Error(err))
+		case !acquired:
+			abortTokenRateLimited(c, "requests", 1,
+				fmt.Sprintf("Too many concurrent requests: limit %d in flight.", token.MaxInFlight))
+			return release, false
+		default:
+			release = func() {
+				// The request context is often canceled by now, e.g. by a client
+				// dropping a stream. Detach from it like billing does, or the
+				// slot would leak until the counter expires.
+				releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tokenInFlightReleaseTimeout)
+				defer cancel()
+				if err := model.ReleaseTokenInFlight(releaseCtx, token.Id); err != nil {
+					lg.Warn("failed to release token in-flight slot", zap.Int("token_id", token.Id), zap.Error(err))
+				}
+			}
+		}
+	}
+	// reject frees the in-flight slot taken above before the request is turned away.
+	reject := func() (func(), bool) {
+		release()
+		return func() {}, false
+	}
+
+	if token.RateLimitRPM > 0 {
+		allowed, used, reset, err := model.TakeTokenRequest(ctx, token.Id, token.RateLimitRPM)
+		switch {
+		case err != nil:
+			lg.Warn("token RPM check failed, allowing request", zap.Int("token_id", token.Id), zap.Error(err))
+		case !allowed:
+			setTokenRateLimitHeaders(c, "requests", token.RateLimitRPM, 0, reset)
+			abortTokenRateLimited(c, "requests", reset,
+				fmt.Sprintf("Rate limit reached for requests: limit %d per minute, used %d.", token.RateLimitRPM, used))
+			return reject()
+		default:
+			setTokenRateLimitHeaders(c, "requests", token.RateLimitRPM, int64(token.RateLimitRPM)-used, reset)
+		}
+	}
+
+	// Tokens are charged from actual usage at post-consume, so a request is only
+	// rejected once earlier requests have already used up the window.
+	if token.RateLimitTPM > 0 {
+		used, reset, err := model.GetTokenTPMWindow(ctx, token.Id)
+		if err != nil {
+			lg.Warn("token TPM check failed, allowing request", zap.Int("token_id", token.Id), zap.Error(err))
+		} else {
+			setTokenRateLimitHeaders(c, "tokens", token.RateLimitTPM, int64(token.RateLimitTPM)-used, reset)
+			if used >= int64(token.RateLimitTPM) {
+				abortTokenRateLimited(c, "tokens", reset,
+					fmt.Sprintf("Rate limit reached for tokens: limit %d per minute, used %d.", token.RateLimitTPM, used))
+				return reject()
+			}
+		}
+	}
+
+	return release, true
+}
+
+// setTokenRateLimitHeaders writes the OpenAI-style x-ratelimit-* headers for one
+// dimension ("requests" or "tokens").
+func setTokenRateLimitHeaders(c *gin.Context, dimension string, limit int, remaining int64, resetSeconds int64) {
+	if remaining < 0 {
+		remaining = 0
+	}
+	c.Header("x-ratelimit-limit-"+dimension, strconv.Itoa(limit))
+	c.Header("x-ratelimit-remaining-"+dimension, strconv.FormatInt(remaining, 10))
+	c.Header("x-ratelimit-reset-"+dimension, (time.Duration(resetSeconds) * time.Second).String())
+}
+
+// abortTokenRateLimited rejects the request with 429 and an OpenAI-shaped error body.
+func abortTokenRateLimited(c *gin.Context, dimension string, resetSeconds int64, message string) {
+	if resetSeconds < 1 {
+		resetSeconds = 1
+	}
+	gmw.GetLogger(c).Warn("token rate limit exceeded",
+		zap.String("dimension", dimension),
+		zap.String("reason", message))
+	c.Header("Retry-After", strconv.FormatInt(resetSeconds, 10))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": gin.H{
+			"message": helper.MessageWithRequestId(message, c.GetString(helper.RequestIdKey)),
+			"type":    dimension,
+			"param":   nil,
+			"code":    "rate_limit_exceeded",
+		},
+	})
+	c.Abort()
+}
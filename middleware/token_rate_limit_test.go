@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/model"
+)
+
+func newTokenRateLimitContext() (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	gmw.SetLogger(c, logger.Logger)
+	return c, rec
+}
+
+func useInMemoryTokenRateLimits(t *testing.T) {
+	t.Helper()
+	originalRedisClient := common.RDB
+	common.RDB = nil
+	t.Cleanup(func() { common.RDB = originalRedisClient })
+}
+
+func TestEnforceTokenRateLimits_RPM(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useInMemoryTokenRateLimits(t)
+	token := &model.Token{Id: 9201, RateLimitRPM: 2}
+
+	for i := range 2 {
+		c, rec := newTokenRateLimitContext()
+		release, ok := enforceTokenRateLimits(c, token)
+		release()
+		require.True(t, ok)
+		require.Equal(t, "2", rec.Header().Get("x-ratelimit-limit-requests"))
+		require.Equal(t, []string{"1", "0"}[i], rec.Header().Get("x-ratelimit-remaining-requests"))
+		require.NotEmpty(t, rec.Header().Get("x-ratelimit-reset-requests"))
+	}
+
+	c, rec := newTokenRateLimitContext()
+	_, ok := enforceTokenRateLimits(c, token)
+	require.False(t, ok)
+	require.True(t, c.IsAborted())
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "0", rec.Header().Get("x-ratelimit-remaining-requests"))
+	require.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	var body struct {
+		Error struct {
+			Message string  `json:"message"`
+			Type    string  `json:"type"`
+			Param   *string `json:"param"`
+			Code    string  `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, "requests", body.Error.Type)
+	require.Equal(t, "rate_limit_exceeded", body.Error.Code)
+	require.Nil(t, body.Error.Param)
+	require.Contains(t, body.Error.Message, "Rate limit reached for requests")
+}
+
+func TestEnforceTokenRateLimits_TPMChargedFromUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useInMemoryTokenRateLimits(t)
+	token := &model.Token{Id: 9202, RateLimitTPM: 1000}
+
+	c, rec := newTokenRateLimitContext()
+	_, ok := enforceTokenRateLimits(c, token)
+	require.True(t, ok)
+	require.Equal(t, "1000", rec.Header().Get("x-ratelimit-remaining-tokens"))
+
+	// Usage recorded at post-consume exhausts the window for the next request.
+	require.NoError(t, model.RecordTokenTPMUsage(context.Background(), token.Id, 1000))
+	c, rec = newTokenRateLimitContext()
+	_, ok = enforceTokenRateLimits(c, token)
+	require.False(t, ok)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "0", rec.Header().Get("x-ratelimit-remaining-tokens"))
+	require.Contains(t, rec.Body.String(), `"type":"tokens"`)
+}
+
+func TestEnforceTokenRateLimits_MaxInFlight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useInMemoryTokenRateLimits(t)
+	token := &model.Token{Id: 9203, MaxInFlight: 1}
+
+	c, _ := newTokenRateLimitContext()
+	release, ok := enforceTokenRateLimits(c, token)
+	require.True(t, ok)
+
+	c, rec := newTokenRateLimitContext()
+	_, ok = enforceTokenRateLimits(c, token)
+	require.False(t, ok)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	release()
+	c, _ = newTokenRateLimitContext()
+	release, ok = enforceTokenRateLimits(c, token)
+	require.True(t, ok)
+	release()
+}
+
+func useRedisTokenRateLimits(t *testing.T) {
+	t.Helper()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(redisServer.Close)
+
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { require.NoError(t, redisClient.Close()) })
+
+	originalRedisEnabled := common.IsRedisEnabled()
+	originalRedisClient := common.RDB
+	common.SetRedisEnabled(true)
+	common.RDB = redisClient
+	t.Cleanup(func() {
+		common.SetRedisEnabled(originalRedisEnabled)
+		common.RDB = originalRedisClient
+	})
+}
+
+func TestEnforceTokenRateLimits_ReleasesAfterClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useRedisTokenRateLimits(t)
+	token := &model.Token{Id: 9204, MaxInFlight: 1}
+
+	c, _ := newTokenRateLimitContext()
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+	release, ok := enforceTokenRateLimits(c, token)
+	require.True(t, ok)
+
+	// The client went away before the request finished.
+	cancel()
+	release()
+
+	c, _ = newTokenRateLimitContext()
+	release, ok = enforceTokenRateLimits(c, token)
+	require.True(t, ok, "the slot of a canceled request must be released")
+	release()
+}
+
+func TestEnforceTokenRateLimits_ConcurrencyRejectionKeepsRPM(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useInMemoryTokenRateLimits(t)
+	token := &model.Token{Id: 9205, RateLimitRPM: 2, MaxInFlight: 1}
+
+	c, _ := newTokenRateLimitContext()
+	release, ok := enforceTokenRateLimits(c, token)
+	require.True(t, ok)
+
+	// Rejected for concurrency: must not use up the second request of the minute.
+	c, _ = newTokenRateLimitContext()
+	_, ok = enforceTokenRateLimits(c, token)
+	require.False(t, ok)
+
+	release()
+	c, rec := newTokenRateLimitContext()
+	release, ok = enforceTokenRateLimits(c, token)
+	require.True(t, ok)
+	require.Equal(t, "0", rec.Header().Get("x-ratelimit-remaining-requests"))
+	release()
+
+	// Rejected for RPM: the in-flight slot taken first is freed again.
+	c, _ = newTokenRateLimitContext()
+	_, ok = enforceTokenRateLimits(c, token)
+	require.False(t, ok)
+	acquired, err := model.AcquireTokenInFlight(context.Background(), token.Id, 1)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	require.NoError(t, model.ReleaseTokenInFlight(context.Background(), token.Id))
+}
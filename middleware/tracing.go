@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 
+	"github.com/Laisky/one-api/common/ctxkey"
 	"github.com/Laisky/one-api/common/tracing"
 	"github.com/Laisky/one-api/model"
 )
@@ -40,8 +43,7 @@ type tracingResponseWriter struct {
 func (w *tracingResponseWriter) Write(data []byte) (int, error) {
 	if w.firstWrite {
 		w.firstWrite = false
-		// Record when we first start sending response to client
-		tracing.RecordTraceTimestamp(w.context, model.TimestampFirstClientResponse)
+		w.recordFirstResponse()
 	}
 	return w.ResponseWriter.Write(data)
 }
@@ -50,8 +52,7 @@ func (w *tracingResponseWriter) Write(data []byte) (int, error) {
 func (w *tracingResponseWriter) WriteHeader(statusCode int) {
 	if w.firstWrite {
 		w.firstWrite = false
-		// Record when we first start sending response to client
-		tracing.RecordTraceTimestamp(w.context, model.TimestampFirstClientResponse)
+		w.recordFirstResponse()
 	}
 	w.ResponseWriter.WriteHeader(statusCode)
 }
@@ -60,8 +61,14 @@ func (w *tracingResponseWriter) WriteHeader(statusCode int) {
 func (w *tracingResponseWriter) WriteString(s string) (int, error) {
 	if w.firstWrite {
 		w.firstWrite = false
-		// Record when we first start sending response to client
-		tracing.RecordTraceTimestamp(w.context, model.TimestampFirstClientResponse)
+		w.recordFirstResponse()
 	}
 	return w.ResponseWriter.WriteString(s)
 }
+
+// recordFirstResponse notes when the response to the client starts, both in
+// the trace and on the context for channel health scoring.
+func (w *tracingResponseWriter) recordFirstResponse() {
+	w.context.Set(ctxkey.FirstResponseAt, time.Now())
+	tracing.RecordTraceTimestamp(w.context, model.TimestampFirstClientResponse)
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/Laisky/one-api/common/helper"
 	"github.com/Laisky/one-api/common/identity"
 	"github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/relaymode"
 )
 
 // AbortWithError aborts the request with an error message
@@ -166,6 +167,15 @@ func getRequestModel(c *gin.Context) (string, error) {
 		return m, nil
 	}
 
+	// Native Gemini carries the model in the path: /v1beta/models/{model}:{action}
+	if relaymode.GetByPath(c.Request.URL.Path) == relaymode.GeminiNative {
+		m, _ := relaymode.ParseGeminiNativePath(c.Request.URL.Path)
+		if m == "" {
+			return "", errors.New("missing model in request path")
+		}
+		return m, nil
+	}
+
 	var modelRequest ModelRequest
 	err := common.UnmarshalBodyReusable(c, &modelRequest)
 	if err != nil {
@@ -211,6 +221,7 @@ const (
 	authSourceAuthorization authTokenSource = "authorization"
 	authSourceXAPIKey       authTokenSource = "x-api-key"
 	authSourceAPIKey        authTokenSource = "api-key"
+	authSourceGoogAPIKey    authTokenSource = "x-goog-api-key"
 	authSourceWebSocket     authTokenSource = "websocket-subprotocol"
 )
 
@@ -236,9 +247,13 @@ type TokenKeyInfo struct {
 //  2. X-Api-Key header — Anthropic-compatible.
 //  3. Api-Key header — Azure OpenAI-compatible. GitHub Copilot's `azure` BYOK
 //     provider type sends the key in this header rather than Authorization.
-//  4. Sec-WebSocket-Protocol subprotocol — OpenAI Realtime over WebSocket, for
+//  4. X-Goog-Api-Key header — Google GenAI SDKs on the native Gemini surface.
+//  5. Sec-WebSocket-Protocol subprotocol — OpenAI Realtime over WebSocket, for
 //     browsers that cannot set custom headers:
 //     "Sec-WebSocket-Protocol: realtime, openai-insecure-api-key.{KEY}, openai-beta.realtime-v1"
+//
+// The `key` query parameter of legacy Gemini REST clients is deliberately not
+// read: keys in URLs end up in access logs, proxies and browser history.
 func extractRawCredential(c *gin.Context) (raw string, source authTokenSource) {
 	if v := strings.TrimSpace(c.Request.Header.Get("Authorization")); v != "" {
 		return v, authSourceAuthorization
@@ -251,6 +266,10 @@ func extractRawCredential(c *gin.Context) (raw string, source authTokenSource) {
 	if v := strings.TrimSpace(c.Request.Header.Get("Api-Key")); v != "" {
 		return v, authSourceAPIKey
 	}
+	// compatible with the Google GenAI SDKs
+	if v := strings.TrimSpace(c.Request.Header.Get("X-Goog-Api-Key")); v != "" {
+		return v, authSourceGoogAPIKey
+	}
 
 	// For WebSocket upgrade requests, also check subprotocol-based auth.
 	// Browsers cannot set custom headers on WebSocket connections, so the
@@ -162,6 +162,7 @@ func TestParseTokenKey_HeaderVariants(t *testing.T) {
 		{"anthropic X-Api-Key", map[string]string{"X-Api-Key": "sk-" + realToken}, authSourceXAPIKey, false},
 		{"azure Api-Key (Copilot azure provider)", map[string]string{"Api-Key": "sk-" + realToken}, authSourceAPIKey, false},
 		{"azure Api-Key without prefix", map[string]string{"Api-Key": realToken}, authSourceAPIKey, false},
+		{"gemini X-Goog-Api-Key", map[string]string{"X-Goog-Api-Key": "sk-" + realToken}, authSourceGoogAPIKey, false},
 	}
 
 	for _, tc := range cases {
@@ -254,6 +255,25 @@ func TestParseTokenKey_HeaderPrecedence(t *testing.T) {
 	require.Equal(t, authSourceAPIKey, got.Source)
 }
 
+// TestParseTokenKey_GeminiQueryKey verifies the `key` query parameter is never
+// read as a credential, not even on the native Gemini surface.
+func TestParseTokenKey_GeminiQueryKey(t *testing.T) {
+	old := config.TokenKeyPrefix
+	config.TokenKeyPrefix = "sk-"
+	defer func() { config.TokenKeyPrefix = old }()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1beta/models/gemini-2.5-flash:generateContent?key=sk-"+realToken, nil)
+	got := parseTokenKey(c)
+	require.Equal(t, authSourceNone, got.Source)
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions?key=sk-"+realToken, nil)
+	got = parseTokenKey(c)
+	require.Equal(t, authSourceNone, got.Source)
+}
+
 // TestParseTokenKey_NoCredential ensures the no-auth case is reported as such
 // (it resolves to 401 downstream, never a 403).
 func TestParseTokenKey_NoCredential(t *testing.T) {
@@ -135,7 +135,7 @@ func getRandomSatisfiedChannel(group string, model string, excludeChannelIds map
 		return nil, errkind.ConfigErr(noSatisfiedChannelError(group, model, excludeIDs))
 	}
 
-	channel := pickWeightedChannel(candidates)
+	channel := pickWeightedChannel(candidates, model)
 	if channel == nil {
 		// Every candidate weight is zero: fall back to uniform random.
 		channel = candidates[rand.Intn(len(candidates))]
@@ -0,0 +1,364 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"slices"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/common/message"
+)
+
+// Budget periods accepted by Token.BudgetPeriod and User.BudgetPeriod. Windows
+// follow the server's local time zone: days start at midnight, weeks on Monday
+// and months on the 1st.
+const (
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodWeekly  = "weekly"
+	BudgetPeriodMonthly = "monthly"
+)
+
+// IsValidBudgetPeriod reports whether period is empty (no budget) or one of
+// the supported budget periods.
+func IsValidBudgetPeriod(period string) bool {
+	switch period {
+	case "", BudgetPeriodDaily, BudgetPeriodWeekly, BudgetPeriodMonthly:
+		return true
+	default:
+		return false
+	}
+}
+
+// budgetWindow returns the [start, end) bounds of the period window that
+// contains now. ok is false for an empty or unknown period.
+func budgetWindow(period string, now time.Time) (start, end time.Time, ok bool) {
+	y, m, d := now.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	switch period {
+	case BudgetPeriodDaily:
+		return day, day.AddDate(0, 0, 1), true
+	case BudgetPeriodWeekly:
+		start = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7), true
+	case BudgetPeriodMonthly:
+		start = time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0), true
+	default:
+		return time.Time{}, time.Time{}, false
+	}
+}
+
+// BudgetStatus is the spend of a token or user within its current budget window.
+type BudgetStatus struct {
+	Period      string `json:"period"`
+	Limit       int64  `json:"limit"`
+	Used        int64  `json:"used"`
+	Remaining   int64  `json:"remaining"`
+	WindowStart int64  `json:"window_start"`
+	WindowEnd   int64  `json:"window_end"`
+}
+
+// budgetState is the persisted budget configuration and window counters shared
+// by tokens and users.
+type budgetState struct {
+	Period          string `gorm:"column:budget_period"`
+	Quota           int64  `gorm:"column:budget_quota"`
+	Used            int64  `gorm:"column:budget_used"`
+	WindowStart     int64  `gorm:"column:budget_window_start"`
+	NotifiedPercent int    `gorm:"column:budget_notified_percent"`
+}
+
+func (t *Token) budget() budgetState {
+	return budgetState{t.BudgetPeriod, t.BudgetQuota, t.BudgetUsed, t.BudgetWindowStart, t.BudgetNotifiedPercent}
+}
+
+func (user *User) budget() budgetState {
+	return budgetState{user.BudgetPeriod, user.BudgetQuota, user.BudgetUsed, user.BudgetWindowStart, user.BudgetNotifiedPercent}
+}
+
+// status projects the stored counters onto the window containing now. Counters
+// left over from an earlier window count as zero. It returns nil when no budget
+// is configured.
+func (b budgetState) status(now time.Time) *BudgetStatus {
+	if b.Quota <= 0 {
+		return nil
+	}
+	start, end, ok := budgetWindow(b.Period, now)
+	if !ok {
+		return nil
+	}
+	used := b.Used
+	if b.WindowStart < start.Unix() {
+		used = 0
+	}
+	return &BudgetStatus{
+		Period:      b.Period,
+		Limit:       b.Quota,
+		Used:        used,
+		Remaining:   max(b.Quota-used, 0),
+		WindowStart: start.Unix(),
+		WindowEnd:   end.Unix(),
+	}
+}
+
+// notifiedPercent is the threshold already notified in the current window.
+func (b budgetState) notifiedPercent(now time.Time) int {
+	start, _, ok := budgetWindow(b.Period, now)
+	if !ok || b.WindowStart < start.Unix() {
+		return 0
+	}
+	return b.NotifiedPercent
+}
+
+// checkBudget returns an error when spending quota more would exceed the
+// current window of b. scope names the budget owner in the message.
+func checkBudget(scope string, b budgetState, quota int64, now time.Time) error {
+	status := b.status(now)
+	if status == nil || status.Used+quota <= status.Limit {
+		return nil
+	}
+	return errors.Errorf("%s %s budget exceeded: limit=%d, used=%d, required=%d, resets at %s",
+		scope, status.Period, status.Limit, status.Used, quota,
+		time.Unix(status.WindowEnd, 0).Format(time.RFC3339))
+}
+
+// BudgetStatus returns the token's usage within its current budget window, or
+// nil when the token has no budget.
+func (t *Token) BudgetStatus(now time.Time) *BudgetStatus {
+	return t.budget().status(now)
+}
+
+// BudgetStatus returns the user's usage within its current budget window, or
+// nil when the user has no budget.
+func (user *User) BudgetStatus(now time.Time) *BudgetStatus {
+	return user.budget().status(now)
+}
+
+// GetUserBudgetStatus reads the user's budget from the database and returns
+// its current window usage, or nil when the user has no budget.
+func GetUserBudgetStatus(userId int) (*BudgetStatus, error) {
+	state, err := loadBudgetState("users", userId)
+	if err != nil {
+		return nil, err
+	}
+	return state.status(time.Now()), nil
+}
+
+// BudgetHeadroom returns the quota that may still be spent before the token's
+// or its owner's budget window is exhausted, whichever is tighter. limited is
+// false when neither has a budget. Both budgets are read from the cached token
+// and user objects; billing drops those copies whenever a charge starts a new
+// window or crosses a notification threshold or the limit (budgetCacheStale),
+// so the cached counters lag by less than one threshold step. The pre-consume
+// check reads the database.
+func BudgetHeadroom(ctx context.Context, token *Token, user *User) (remaining int64, limited bool) {
+	now := time.Now()
+	if status := token.BudgetStatus(now); status != nil {
+		remaining, limited = status.Remaining, true
+	}
+	if user == nil {
+		return remaining, limited
+	}
+	if status := user.BudgetStatus(now); status != nil && (!limited || status.Remaining < remaining) {
+		remaining, limited = status.Remaining, true
+	}
+	return remaining, limited
+}
+
+// budgetCacheStale reports whether charging delta against before, the budget
+// counters as read ahead of the charge, moves them into a new window or across
+// a config.BudgetNotifyPercents threshold or the limit. Only then must cached
+// copies of the counters be dropped: between those points a cached copy lags
+// by less than one threshold step.
+func budgetCacheStale(before budgetState, delta int64, now time.Time) bool {
+	status := before.status(now)
+	if status == nil {
+		return false
+	}
+	if before.WindowStart < status.WindowStart {
+		return true
+	}
+	used := status.Used
+	charged := max(used+delta, 0)
+	for _, percent := range append(slices.Clone(config.BudgetNotifyPercents), 100) {
+		mark := status.Limit * int64(percent)
+		if (used*100 >= mark) != (charged*100 >= mark) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadBudgetState reads the budget columns of one row of table ("tokens" or "users").
+func loadBudgetState(table string, id int) (budgetState, error) {
+	var state budgetState
+	err := DB.Table(table).
+		Select("budget_period", "budget_quota", "budget_used", "budget_window_start", "budget_notified_percent").
+		Where("id = ?", id).Take(&state).Error
+	if err != nil {
+		return budgetState{}, errors.Wrapf(err, "load budget of %s %d", table, id)
+	}
+	return state, nil
+}
+
+// budgetResetCondition matches a row whose stored window predates the current
+// one. It takes the current daily, weekly and monthly window starts.
+const budgetResetCondition = "((budget_period = 'daily' AND budget_window_start < ?)" +
+	" OR (budget_period = 'weekly' AND budget_window_start < ?)" +
+	" OR (budget_period = 'monthly' AND budget_window_start < ?))"
+
+// chargeBudget adds delta (negative for a refund) to the current window of a
+// row of table ("tokens" or "users"), starting a new window when the stored
+// one has ended. Rows without a budget are left untouched. It reports whether
+// a budget was charged.
+//
+// The assignments read the pre-update budget_window_start, which MySQL only
+// guarantees when budget_window_start is assigned last.
+func chargeBudget(ctx context.Context, table string, id int, delta int64, now time.Time) (bool, error) {
+	if delta == 0 {
+		return false, nil
+	}
+	var starts [3]int64
+	for i, period := range []string{BudgetPeriodDaily, BudgetPeriodWeekly, BudgetPeriodMonthly} {
+		start, _, _ := budgetWindow(period, now)
+		starts[i] = start.Unix()
+	}
+	sql := fmt.Sprintf("UPDATE %s SET"+
+		" budget_used = CASE WHEN %s THEN ? WHEN budget_used + ? < 0 THEN 0 ELSE budget_used + ? END,"+
+		" budget_notified_percent = CASE WHEN %s THEN 0 ELSE budget_notified_percent END,"+
+		" budget_window_start = CASE"+
+		" WHEN budget_period = 'daily' AND budget_window_start < ? THEN ?"+
+		" WHEN budget_period = 'weekly' AND budget_window_start < ? THEN ?"+
+		" WHEN budget_period = 'monthly' AND budget_window_start < ? THEN ?"+
+		" ELSE budget_window_start END"+
+		" WHERE id = ? AND budget_quota > 0",
+		table, budgetResetCondition, budgetResetCondition)
+	result := DB.WithContext(ctx).Exec(sql,
+		starts[0], starts[1], starts[2], max(delta, 0), delta, delta,
+		starts[0], starts[1], starts[2],
+		starts[0], starts[0], starts[1], starts[1], starts[2], starts[2],
+		id)
+	if result.Error != nil {
+		return false, errors.Wrapf(result.Error, "charge budget of %s %d", table, id)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// chargeTokenBudget charges the token's budget, if any, and notifies its owner
+// when a soft limit is crossed. token carries the counters as read before the
+// charge. Failures are logged: the quota itself has already been settled, so
+// the request must not fail on account of the budget.
+func chargeTokenBudget(ctx context.Context, token *Token, delta int64) {
+	if token.BudgetQuota <= 0 {
+		return
+	}
+	subject := fmt.Sprintf("token \"%s\"", html.EscapeString(token.Name))
+	if chargeBudgetAndNotify(ctx, "tokens", token.Id, token.UserId, subject, delta) &&
+		budgetCacheStale(token.budget(), delta, time.Now()) {
+		// The auth middleware reads the counters from the token cache.
+		clearTokenCache(ctx, token.KeyHash)
+	}
+}
+
+// chargeUserBudget charges the user's budget, if any, and notifies the user
+// when a soft limit is crossed. before is the user's budget as read ahead of
+// the charge. Failures are logged, as in chargeTokenBudget.
+func chargeUserBudget(ctx context.Context, userId int, before budgetState, delta int64) {
+	if before.Quota <= 0 {
+		return
+	}
+	if chargeBudgetAndNotify(ctx, "users", userId, userId, "account", delta) &&
+		budgetCacheStale(before, delta, time.Now()) {
+		// The auth middleware reads the counters from the user cache.
+		clearUserObjectCache(ctx, userId)
+	}
+}
+
+// loadAndChargeUserBudget reads the user's budget and charges it, for billing
+// paths that have not read the user row yet.
+func loadAndChargeUserBudget(ctx context.Context, userId int, delta int64) {
+	before, err := loadBudgetState("users", userId)
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to load user spend budget", zap.Int("user_id", userId), zap.Error(err))
+		return
+	}
+	chargeUserBudget(ctx, userId, before, delta)
+}
+
+// chargeBudgetAndNotify charges one budget and reports whether it had one.
+func chargeBudgetAndNotify(ctx context.Context, table string, id int, userId int, subject string, delta int64) bool {
+	lg := logger.FromContext(ctx)
+	now := time.Now()
+	charged, err := chargeBudget(ctx, table, id, delta, now)
+	if err != nil {
+		lg.Error("failed to charge spend budget", zap.String("table", table), zap.Int("id", id), zap.Error(err))
+		return false
+	}
+	if !charged || delta < 0 || len(config.BudgetNotifyPercents) == 0 {
+		return charged
+	}
+	if err := notifyBudgetThreshold(ctx, table, id, userId, subject, now); err != nil {
+		lg.Warn("failed to send spend budget notification", zap.String("table", table), zap.Int("id", id), zap.Error(err))
+	}
+	return true
+}
+
+// notifyBudgetThreshold emails the owner once per window for the highest
+// config.BudgetNotifyPercents threshold the current usage has reached. The
+// conditional update on budget_notified_percent makes sure concurrent requests
+// crossing the same threshold send a single notification.
+func notifyBudgetThreshold(ctx context.Context, table string, id int, userId int, subject string, now time.Time) error {
+	state, err := loadBudgetState(table, id)
+	if err != nil {
+		return err
+	}
+	status := state.status(now)
+	if status == nil {
+		return nil
+	}
+	reached := 0
+	for _, percent := range config.BudgetNotifyPercents {
+		if status.Used*100 >= status.Limit*int64(percent) {
+			reached = percent
+		}
+	}
+	if reached == 0 || reached <= state.notifiedPercent(now) {
+		return nil
+	}
+	result := DB.WithContext(ctx).Table(table).
+		Where("id = ? AND budget_notified_percent < ? AND budget_window_start = ?", id, reached, status.WindowStart).
+		Update("budget_notified_percent", reached)
+	if result.Error != nil {
+		return errors.Wrapf(result.Error, "claim budget notification of %s %d", table, id)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	email, err := GetUserEmail(userId)
+	if err != nil {
+		return errors.Wrapf(err, "get email of user %d", userId)
+	}
+	if email == "" {
+		return nil
+	}
+	title := "Spend Budget Reminder"
+	content := message.EmailTemplate(title, fmt.Sprintf(`
+		<p>Hello!</p>
+		<p>Your %s has used <strong>%d%%</strong> of its %s spend budget: %d of %d quota.</p>
+		<p>The budget resets at %s.</p>
+	`, subject, reached, status.Period, status.Used, status.Limit,
+		time.Unix(status.WindowEnd, 0).Format(time.RFC1123)))
+	go func() {
+		if err := message.SendEmail(title, email, content); err != nil {
+			logger.FromContext(ctx).Error("failed to send spend budget email", zap.Int("user_id", userId), zap.Error(err))
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,169 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/common/helper"
+)
+
+func TestBudgetWindow(t *testing.T) {
+	// Thursday 2026-10-15 13:45 UTC.
+	now := time.Date(2026, time.October, 15, 13, 45, 0, 0, time.UTC)
+
+	start, end, ok := budgetWindow(BudgetPeriodDaily, now)
+	require.True(t, ok)
+	require.Equal(t, time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC), start)
+	require.Equal(t, time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC), end)
+
+	start, end, ok = budgetWindow(BudgetPeriodWeekly, now)
+	require.True(t, ok)
+	require.Equal(t, time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC), start, "weeks start on Monday")
+	require.Equal(t, time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC), end)
+
+	sunday := time.Date(2026, time.October, 18, 23, 0, 0, 0, time.UTC)
+	start, _, _ = budgetWindow(BudgetPeriodWeekly, sunday)
+	require.Equal(t, time.Date(2026, time.October, 12, 0, 0, 0, 0, time.UTC), start)
+
+	start, end, ok = budgetWindow(BudgetPeriodMonthly, now)
+	require.True(t, ok)
+	require.Equal(t, time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC), start)
+	require.Equal(t, time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC), end)
+
+	_, _, ok = budgetWindow("", now)
+	require.False(t, ok)
+}
+
+func TestBudgetStatusIgnoresStaleWindow(t *testing.T) {
+	now := time.Date(2026, time.October, 15, 13, 45, 0, 0, time.UTC)
+	state := budgetState{
+		Period:      BudgetPeriodMonthly,
+		Quota:       100,
+		Used:        90,
+		WindowStart: time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC).Unix(),
+	}
+
+	status := state.status(now)
+	require.NotNil(t, status)
+	require.Equal(t, int64(0), status.Used)
+	require.Equal(t, int64(100), status.Remaining)
+	require.NoError(t, checkBudget("token", state, 100, now))
+	require.Error(t, checkBudget("token", state, 101, now))
+
+	require.Nil(t, budgetState{Period: BudgetPeriodDaily}.status(now), "a zero quota disables the budget")
+}
+
+func TestBudgetCacheStale(t *testing.T) {
+	previousPercents := config.BudgetNotifyPercents
+	config.BudgetNotifyPercents = []int{80}
+	t.Cleanup(func() { config.BudgetNotifyPercents = previousPercents })
+
+	now := time.Date(2026, time.October, 15, 13, 45, 0, 0, time.UTC)
+	current := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC).Unix()
+	state := budgetState{Period: BudgetPeriodMonthly, Quota: 100, Used: 10, WindowStart: current}
+
+	require.False(t, budgetCacheStale(state, 20, now), "a charge between thresholds keeps the cache")
+	require.True(t, budgetCacheStale(state, 70, now), "crossing a notification threshold drops the cache")
+	state.Used = 90
+	require.True(t, budgetCacheStale(state, 10, now), "reaching the limit drops the cache")
+	require.True(t, budgetCacheStale(state, -20, now), "a refund back under a threshold drops the cache")
+
+	state.WindowStart = time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC).Unix()
+	require.True(t, budgetCacheStale(state, 1, now), "a new window drops the cache")
+	require.False(t, budgetCacheStale(budgetState{}, 1, now), "tokens without a budget have nothing to drop")
+}
+
+func createBudgetTestToken(t *testing.T, userQuota int64, token *Token) (*User, *Token) {
+	t.Helper()
+	user := &User{
+		Username: fmt.Sprintf("test-budget-%d", time.Now().UnixNano()),
+		Password: "testpassword12345",
+		Status:   UserStatusEnabled,
+		Role:     RoleCommonUser,
+		Quota:    userQuota,
+	}
+	require.NoError(t, DB.Create(user).Error)
+
+	token.UserId = user.Id
+	token.Key = fmt.Sprintf("test-budget-%d", time.Now().UnixNano())
+	token.Name = "test budget"
+	token.Status = TokenStatusEnabled
+	token.CreatedTime = helper.GetTimestamp()
+	token.AccessedTime = helper.GetTimestamp()
+	require.NoError(t, DB.Create(token).Error)
+	return user, token
+}
+
+func TestPreConsumeTokenQuotaEnforcesTokenBudget(t *testing.T) {
+	setupTestDatabase(t)
+	previousBatchUpdateEnabled := config.BatchUpdateEnabled
+	previousPercents := config.BudgetNotifyPercents
+	config.BatchUpdateEnabled = false
+	config.BudgetNotifyPercents = []int{50}
+	t.Cleanup(func() {
+		config.BatchUpdateEnabled = previousBatchUpdateEnabled
+		config.BudgetNotifyPercents = previousPercents
+	})
+
+	ctx := context.Background()
+	_, token := createBudgetTestToken(t, 1000, &Token{
+		UnlimitedQuota: true,
+		BudgetPeriod:   BudgetPeriodMonthly,
+		BudgetQuota:    100,
+		// Leftovers of an earlier month must not count against this one.
+		BudgetUsed:        100,
+		BudgetWindowStart: time.Now().AddDate(0, -2, 0).Unix(),
+	})
+
+	require.NoError(t, PreConsumeTokenQuota(ctx, token.Id, 60))
+	state, err := loadBudgetState("tokens", token.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(60), state.Used)
+	require.Equal(t, 50, state.NotifiedPercent, "crossing 50% claims the notification once")
+
+	err = PreConsumeTokenQuota(ctx, token.Id, 60)
+	require.Error(t, err)
+	require.Equal(t, errkind.InsufficientQuota, errkind.Of(err))
+	require.Contains(t, err.Error(), "token monthly budget exceeded")
+
+	// A refund at post-consume gives the budget back.
+	require.NoError(t, PostConsumeTokenQuota(ctx, token.Id, -60))
+	state, err = loadBudgetState("tokens", token.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), state.Used)
+	require.NoError(t, PreConsumeTokenQuota(ctx, token.Id, 60))
+}
+
+func TestPreConsumeTokenQuotaEnforcesUserBudget(t *testing.T) {
+	setupTestDatabase(t)
+	previousBatchUpdateEnabled := config.BatchUpdateEnabled
+	config.BatchUpdateEnabled = false
+	t.Cleanup(func() { config.BatchUpdateEnabled = previousBatchUpdateEnabled })
+
+	ctx := context.Background()
+	user, token := createBudgetTestToken(t, 1000, &Token{RemainQuota: 1000})
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).
+		Updates(map[string]any{"budget_period": BudgetPeriodDaily, "budget_quota": 50}).Error)
+
+	require.NoError(t, PreConsumeTokenQuota(ctx, token.Id, 30))
+	require.NoError(t, PostConsumeTokenQuota(ctx, token.Id, 10))
+
+	status, err := GetUserBudgetStatus(user.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(40), status.Used)
+	require.Equal(t, int64(10), status.Remaining)
+
+	err = PreConsumeTokenQuota(ctx, token.Id, 20)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "user daily budget exceeded")
+
+	var persisted User
+	require.NoError(t, DB.First(&persisted, user.Id).Error)
+	require.Equal(t, int64(960), persisted.Quota, "a rejected request must not debit quota")
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/Laisky/one-api/common"
 	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/helper"
 	"github.com/Laisky/one-api/common/identity"
 	"github.com/Laisky/one-api/common/logger"
 	"github.com/Laisky/one-api/common/random"
@@ -31,48 +32,38 @@ var (
 	GroupModelsCacheSeconds     = config.SyncFrequency
 )
 
+// CacheGetTokenByKey loads the token whose plaintext key is key. Tokens are
+// stored, and cached in Redis, under the HMAC of the key (HashTokenKey), so
+// neither the database nor the cache ever holds the plaintext.
 func CacheGetTokenByKey(ctx context.Context, key string) (*Token, error) {
 	lg := logger.FromContext(ctx)
-	keyCol := "`key`"
-	if common.UsingPostgreSQL.Load() {
-		keyCol = `"key"`
-	}
-	var token Token
+	keyHash := HashTokenKey(key)
 	if !common.IsRedisEnabled() {
-		if DB == nil {
-			return nil, errors.New("database not initialized")
-		}
-		err := DB.Where(keyCol+" = ?", key).First(&token).Error
-		if err != nil {
-			return nil, errors.Wrapf(err, "get token by key %s", key)
-		}
-		return &token, nil
+		return getTokenByKeyHash(ctx, key, keyHash)
 	}
-	tokenObjectString, err := common.RedisGet(ctx, fmt.Sprintf("token:%s", key))
+	var token Token
+	tokenObjectString, err := common.RedisGet(ctx, fmt.Sprintf("token:%s", keyHash))
 	if err != nil {
-		if DB == nil {
-			return nil, errors.Wrap(err, "database not initialized")
-		}
-		err := DB.Where(keyCol+" = ?", key).First(&token).Error
+		dbToken, err := getTokenByKeyHash(ctx, key, keyHash)
 		if err != nil {
-			return nil, errors.Wrapf(err, "get token by key %s", key)
+			return nil, err
 		}
+		token = *dbToken
 		// Cache the raw token row. With Token.MarshalJSON retired, the default
-		// serialization already keeps the raw stored key (the response-time
-		// prefix now lives in Token.ToResponse, not in json.Marshal) and carries
-		// the internal id, which is exactly what the cache needs. (This file is
-		// allowlisted in the noentityresponse analyzer: marshaling the raw entity
-		// for the internal cache is intentional here.)
+		// serialization carries the internal id and the key hash, which is
+		// exactly what the cache needs; the transient plaintext Key is empty on
+		// loaded rows and omitted. (This file is allowlisted in the
+		// noentityresponse analyzer: marshaling the raw entity for the internal
+		// cache is intentional here.)
 		jsonBytes, err := json.Marshal(token)
 		if err != nil {
 			return nil, identity.Tag(
 				errors.Wrapf(err, "marshal token %d for cache", token.Id),
 				token.Ref(), token.OwnerRef())
 		}
-		err = common.RedisSet(ctx, fmt.Sprintf("token:%s", key), string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
+		err = common.RedisSet(ctx, fmt.Sprintf("token:%s", keyHash), string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
 		if err != nil {
-			// The raw token key is a credential and must never reach the log; the
-			// token reference (id + uuid + name) is what an operator can act on.
+			// The token reference (id + uuid + name) is what an operator can act on.
 			lg.Warn("Redis set token failed, continuing without cache",
 				append(token.Ref().Zap(), zap.Error(err))...)
 		}
@@ -81,7 +72,7 @@ func CacheGetTokenByKey(ctx context.Context, key string) (*Token, error) {
 
 	err = json.Unmarshal([]byte(tokenObjectString), &token)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unmarshal cached token for key %s", key)
+		return nil, errors.Wrapf(err, "unmarshal cached token for key hash %s", helper.MaskAPIKey(keyHash))
 	}
 	return &token, nil
 }
@@ -130,6 +121,18 @@ func CacheGetUserById(ctx context.Context, id int) (*User, error) {
 	return user, nil
 }
 
+// clearUserObjectCache drops the cached user object of id, so the next
+// CacheGetUserById reads the database.
+func clearUserObjectCache(ctx context.Context, id int) {
+	if !common.IsRedisEnabled() {
+		return
+	}
+	if err := common.RedisDel(ctx, fmt.Sprintf("user_obj:%d", id)); err != nil {
+		logger.FromContext(ctx).Warn("failed to clear user object cache, continuing",
+			zap.Int("user_id", id), zap.Error(err))
+	}
+}
+
 func CacheGetUserGroup(ctx context.Context, id int) (group string, err error) {
 	lg := logger.FromContext(ctx)
 	if !common.IsRedisEnabled() {
@@ -222,6 +225,20 @@ func CacheUpdateUserQuota(ctx context.Context, id int) error {
 	return nil
 }
 
+// CacheUpdateUserGroup drops the cached group and user object of id after its
+// group changed, so the next request reads the new group.
+func CacheUpdateUserGroup(ctx context.Context, id int) error {
+	if !common.IsRedisEnabled() {
+		return nil
+	}
+	for _, key := range []string{fmt.Sprintf("user_group:%d", id), fmt.Sprintf("user_obj:%d", id)} {
+		if err := common.RedisDel(ctx, key); err != nil {
+			return errors.Wrapf(err, "drop cached group for user %d", id)
+		}
+	}
+	return nil
+}
+
 func CacheDecreaseUserQuota(ctx context.Context, id int, quota int64) error {
 	if !common.IsRedisEnabled() {
 		return nil
@@ -233,6 +250,117 @@ func CacheDecreaseUserQuota(ctx context.Context, id int, quota int64) error {
 	return nil
 }
 
+// CacheGetOrgQuota returns the remaining quota pool of an organization,
+// served from Redis when enabled.
+func CacheGetOrgQuota(ctx context.Context, id int) (quota int64, err error) {
+	if !common.IsRedisEnabled() {
+		return GetOrgQuota(id)
+	}
+	quotaString, err := common.RedisGet(ctx, fmt.Sprintf("org_quota:%d", id))
+	if err == nil {
+		quota, err = strconv.ParseInt(quotaString, 10, 64)
+		if err == nil && quota > config.PreConsumedQuota {
+			return quota, nil
+		}
+	}
+	// Missing, unparsable or nearly exhausted: refresh from the database.
+	if err := CacheUpdateOrgQuota(ctx, id); err != nil {
+		logger.FromContext(ctx).Warn("Redis set organization quota failed, continuing without cache", zap.Int("org_id", id), zap.Error(err))
+	}
+	return GetOrgQuota(id)
+}
+
+// CacheUpdateOrgQuota refreshes the cached quota pool of an organization.
+func CacheUpdateOrgQuota(ctx context.Context, id int) error {
+	if !common.IsRedisEnabled() {
+		return nil
+	}
+	quota, err := GetOrgQuota(id)
+	if err != nil {
+		return errors.Wrapf(err, "get database quota for organization %d", id)
+	}
+	err = common.RedisSet(ctx, fmt.Sprintf("org_quota:%d", id), fmt.Sprintf("%d", quota), time.Duration(UserId2QuotaCacheSeconds)*time.Second)
+	if err != nil {
+		return errors.Wrapf(err, "set cached quota for organization %d", id)
+	}
+	return nil
+}
+
+// CacheDecreaseOrgQuota decreases the cached quota pool of an organization.
+func CacheDecreaseOrgQuota(ctx context.Context, id int, quota int64) error {
+	if !common.IsRedisEnabled() {
+		return nil
+	}
+	err := common.RedisDecrease(ctx, fmt.Sprintf("org_quota:%d", id), quota)
+	if err != nil {
+		return errors.Wrapf(err, "decrease cached quota for organization %d", id)
+	}
+	return nil
+}
+
+// CacheGetPayerQuota returns the quota available to a request: the pool of
+// orgId when the token is owned by an organization (orgId > 0), otherwise the
+// balance of userId.
+func CacheGetPayerQuota(ctx context.Context, userId int, orgId int) (int64, error) {
+	if orgId > 0 {
+		return CacheGetOrgQuota(ctx, orgId)
+	}
+	return CacheGetUserQuota(ctx, userId)
+}
+
+// CacheUpdatePayerQuota refreshes the cached quota of whoever pays for a
+// request; see CacheGetPayerQuota.
+func CacheUpdatePayerQuota(ctx context.Context, userId int, orgId int) error {
+	if orgId > 0 {
+		return CacheUpdateOrgQuota(ctx, orgId)
+	}
+	return CacheUpdateUserQuota(ctx, userId)
+}
+
+// CacheDecreasePayerQuota decreases the cached quota of whoever pays for a
+// request; see CacheGetPayerQuota.
+func CacheDecreasePayerQuota(ctx context.Context, userId int, orgId int, quota int64) error {
+	if orgId > 0 {
+		return CacheDecreaseOrgQuota(ctx, orgId, quota)
+	}
+	return CacheDecreaseUserQuota(ctx, userId, quota)
+}
+
+// CacheIsOrganizationEnabled reports whether an organization may serve
+// requests, caching the answer like CacheIsUserEnabled.
+func CacheIsOrganizationEnabled(ctx context.Context, orgId int) (bool, error) {
+	if !common.IsRedisEnabled() {
+		return IsOrganizationEnabled(orgId)
+	}
+	enabled, err := common.RedisGet(ctx, fmt.Sprintf("org_enabled:%d", orgId))
+	if err == nil {
+		return enabled == "1", nil
+	}
+	orgEnabled, err := IsOrganizationEnabled(orgId)
+	if err != nil {
+		return false, errors.Wrapf(err, "check organization %d enabled", orgId)
+	}
+	enabled = "0"
+	if orgEnabled {
+		enabled = "1"
+	}
+	if err := common.RedisSet(ctx, fmt.Sprintf("org_enabled:%d", orgId), enabled, time.Duration(UserId2StatusCacheSeconds)*time.Second); err != nil {
+		logger.FromContext(ctx).Warn("Redis set organization enabled failed, continuing without cache", zap.Int("org_id", orgId), zap.Error(err))
+	}
+	return orgEnabled, nil
+}
+
+// CacheInvalidateOrgEnabled drops the cached status of an organization after
+// it was changed or deleted.
+func CacheInvalidateOrgEnabled(ctx context.Context, orgId int) {
+	if !common.IsRedisEnabled() {
+		return
+	}
+	if err := common.RedisDel(ctx, fmt.Sprintf("org_enabled:%d", orgId)); err != nil {
+		logger.FromContext(ctx).Warn("failed to invalidate cached organization status", zap.Int("org_id", orgId), zap.Error(err))
+	}
+}
+
 func CacheIsUserEnabled(ctx context.Context, userId int) (bool, error) {
 	lg := logger.FromContext(ctx)
 	if !common.IsRedisEnabled() {
@@ -327,6 +455,11 @@ var group2model2channels map[string]map[string][]*Channel
 // Guarded by channelSyncLock. It makes channel log enrichment free for code that
 // holds only an integer channel id. It contains ENABLED channels only.
 var channelId2channel map[int]*Channel
+
+// channelId2keys holds the enabled pooled keys of every cached channel, ordered
+// by id, so SelectChannelKey serves requests without querying channel_keys.
+// Guarded by channelSyncLock and rebuilt together with channelId2channel.
+var channelId2keys map[int][]*ChannelKey
 var channelSyncLock sync.RWMutex
 
 func InitChannelCache() {
@@ -358,6 +491,15 @@ func InitChannelCache() {
 		}
 	}
 
+	var enabledKeys []*ChannelKey
+	DB.Where("status = ?", ChannelKeyStatusEnabled).Order("id asc").Find(&enabledKeys)
+	newChannelId2keys := make(map[int][]*ChannelKey)
+	for _, key := range enabledKeys {
+		if _, channelExists := newChannelId2channel[key.ChannelId]; channelExists {
+			newChannelId2keys[key.ChannelId] = append(newChannelId2keys[key.ChannelId], key)
+		}
+	}
+
 	newGroup2model2channels := make(map[string]map[string][]*Channel)
 
 	// Iterate over channels that are confirmed to be enabled
@@ -396,6 +538,7 @@ func InitChannelCache() {
 	channelSyncLock.Lock()
 	group2model2channels = newGroup2model2channels
 	channelId2channel = newChannelId2channel
+	channelId2keys = newChannelId2keys
 	channelSyncLock.Unlock()
 	logger.Logger.Info("channels synced from database, considering suspensions")
 }
@@ -421,6 +564,65 @@ func cachedChannelById(id int) *Channel {
 	return channelId2channel[id]
 }
 
+// cachedChannelKeys returns the enabled pooled keys of a cached channel. ok is
+// false when the memory cache is off or the channel is not in the snapshot, in
+// which case the caller must read the pool from the database.
+//
+// Parameters:
+//   - channelId: owning channel primary key.
+//
+// Return values:
+//   - []*ChannelKey: the cached keys ordered by id; shared, never mutate them.
+//   - bool: whether the snapshot covers the channel.
+func cachedChannelKeys(channelId int) ([]*ChannelKey, bool) {
+	if !config.MemoryCacheEnabled {
+		return nil, false
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	if _, ok := channelId2channel[channelId]; !ok {
+		return nil, false
+	}
+	return channelId2keys[channelId], true
+}
+
+// refreshCachedChannelKeys reloads the enabled pooled keys of one cached
+// channel, so a key that was added, disabled, suspended or failed takes effect
+// on the next request of this instance instead of at the next cache sync.
+//
+// Parameters:
+//   - ctx: request context used for the query and logging.
+//   - channelId: owning channel primary key.
+func refreshCachedChannelKeys(ctx context.Context, channelId int) {
+	if _, ok := cachedChannelKeys(channelId); !ok {
+		return
+	}
+	var keys []*ChannelKey
+	if err := DB.WithContext(ctx).
+		Where("channel_id = ? AND status = ?", channelId, ChannelKeyStatusEnabled).
+		Order("id asc").Find(&keys).Error; err != nil {
+		logger.FromContext(ctx).Warn("failed to refresh cached channel keys",
+			zap.Int("channel_id", channelId), zap.Error(err))
+		return
+	}
+	channelSyncLock.Lock()
+	if channelId2keys != nil {
+		channelId2keys[channelId] = keys
+	}
+	channelSyncLock.Unlock()
+}
+
+// refreshCachedChannelKeysOf is refreshCachedChannelKeys for callers that only
+// hold the id of a pooled key.
+func refreshCachedChannelKeysOf(ctx context.Context, keyId int) {
+	if !config.MemoryCacheEnabled {
+		return
+	}
+	if channelId := channelKeyOwner(ctx, keyId); channelId > 0 {
+		refreshCachedChannelKeys(ctx, channelId)
+	}
+}
+
 func SyncChannelCache(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
@@ -535,12 +737,12 @@ func CacheGetRandomSatisfiedChannelWithContext(ctx context.Context, group string
 
 	var channel *Channel
 	if ignoreFirstPriority && endIdx < len(candidateChannels) {
-		channel = pickWeightedChannel(candidateChannels[endIdx:])
+		channel = pickWeightedChannel(candidateChannels[endIdx:], model)
 		if channel == nil {
 			channel = candidateChannels[random.RandRange(endIdx, len(candidateChannels))]
 		}
 	} else {
-		channel = pickWeightedChannel(candidateChannels[:endIdx])
+		channel = pickWeightedChannel(candidateChannels[:endIdx], model)
 		if channel == nil {
 			channel = candidateChannels[rand.Intn(endIdx)]
 		}
@@ -629,7 +831,7 @@ func CacheGetRandomSatisfiedChannelExcludingWithContext(ctx context.Context, gro
 
 		// If there are lower priority channels available, select from them
 		if endIdx < len(candidateChannels) {
-			channel := pickWeightedChannel(candidateChannels[endIdx:])
+			channel := pickWeightedChannel(candidateChannels[endIdx:], model)
 			if channel == nil {
 				channel = candidateChannels[random.RandRange(endIdx, len(candidateChannels))]
 			}
@@ -667,7 +869,7 @@ func CacheGetRandomSatisfiedChannelExcludingWithContext(ctx context.Context, gro
 			return nil, errors.New("no channels with maximum priority available")
 		}
 
-		channel := pickWeightedChannel(maxPriorityChannels)
+		channel := pickWeightedChannel(maxPriorityChannels, model)
 		if channel == nil {
 			channel = maxPriorityChannels[rand.Intn(len(maxPriorityChannels))]
 		}
@@ -682,14 +884,23 @@ func CacheGetRandomSatisfiedChannelExcludingWithContext(ctx context.Context, gro
 // back to uniform random. Both routing paths — this cache path and the DB path's
 // getRandomSatisfiedChannel — feed their candidate channels through this helper, so
 // they weight identically.
-func pickWeightedChannel(channels []*Channel) *Channel {
+//
+// When channels serving modelName have health scores (see
+// SetChannelWeightMultipliers), each configured weight is scaled by the
+// channel's health multiplier, so a slow or failing channel loses part of its
+// share of the tier.
+func pickWeightedChannel(channels []*Channel, modelName string) *Channel {
 	if len(channels) == 0 {
 		return nil
 	}
 
+	multipliers := weightMultipliers(modelName, channels)
 	weights := make([]uint, len(channels))
 	for i, ch := range channels {
 		weights[i] = ch.GetWeight()
+		if multipliers != nil {
+			weights[i] = healthAdjustedWeight(weights[i], multipliers[i])
+		}
 	}
 
 	idx := weightedIndex(weights, rand.Int63n)
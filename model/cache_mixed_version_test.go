@@ -41,6 +41,10 @@ import (
 //	                     id/user_id" note is describing a gain that never applied
 //	                     to the cache path).
 //
+// Since token keys are hashed at rest, the token entry lives under
+// "token:<key hash>" instead and its payload swaps "key" for "key_hash" and
+// "key_prefix"; the token tests below pin that delta.
+//
 // So §3.3.5's literal claim ("payloads only ever gain keys") DOES NOT HOLD: the
 // user payload strictly SHRINKS by three keys. The safety conclusion it draws
 // nevertheless holds, for a different and stronger reason — each dropped key was
@@ -416,15 +420,14 @@ func TestMixedVersionUserCache_CurrentPayloadReadByPreRefactorReader(t *testing.
 	require.Empty(t, oldReader.VerificationCode)
 }
 
-// TestMixedVersionTokenCache_OldPayloadReadByCurrentCode proves the
-// old-payload -> new-binary direction for "token:<key>" through the real
-// CacheGetTokenByKey path. No matching DB row exists, so a NoError result can
-// only come from the planted cache entry.
+// TestMixedVersionTokenCache_OldPayloadReadByCurrentCode proves the current
+// reader still decodes the pre-refactor token payload shape through the real
+// CacheGetTokenByKey path. The entry is planted under "token:<key hash>", the
+// only cache key the current binary reads; no matching DB row exists, so a
+// NoError result can only come from the planted cache entry.
 //
-// The load-bearing detail: the pre-refactor writer used `type plainToken Token`
-// to keep the RAW (unprefixed) key in Redis. The post-refactor reader must still
-// read that raw key back verbatim — the response-time "sk-" prefix now lives in
-// Token.ToResponse, not in json.Marshal.
+// The legacy payload still carries the plaintext "key", which decodes into the
+// transient Token.Key field; every other field must round-trip unchanged.
 func TestMixedVersionTokenCache_OldPayloadReadByCurrentCode(t *testing.T) {
 	ctx := setupMixedVersionCacheTest(t)
 
@@ -437,7 +440,7 @@ func TestMixedVersionTokenCache_OldPayloadReadByCurrentCode(t *testing.T) {
 	planted, err := json.Marshal(fixture)
 	require.NoError(t, err)
 
-	require.NoError(t, common.RedisSet(ctx, fmt.Sprintf("token:%s", tokenKey), string(planted), 300*time.Second))
+	require.NoError(t, common.RedisSet(ctx, fmt.Sprintf("token:%s", HashTokenKey(tokenKey)), string(planted), 300*time.Second))
 
 	got, err := CacheGetTokenByKey(ctx, tokenKey)
 	require.NoError(t, err, "legacy token payload must decode; no DB row exists, so this proves the cache path")
@@ -448,7 +451,6 @@ func TestMixedVersionTokenCache_OldPayloadReadByCurrentCode(t *testing.T) {
 	require.Equal(t, "018f0000-0000-7000-8000-000000000002", got.UUID)
 	require.NotNil(t, got.UserUUID)
 	require.Equal(t, "018f0000-0000-7000-8000-000000000001", *got.UserUUID)
-	require.Equal(t, tokenKey, got.Key, "the cached key must round-trip RAW (unprefixed)")
 	require.Equal(t, TokenStatusEnabled, got.Status)
 	require.Equal(t, "primary", got.Name)
 	require.EqualValues(t, 1700000000, got.CreatedTime)
@@ -466,10 +468,10 @@ func TestMixedVersionTokenCache_OldPayloadReadByCurrentCode(t *testing.T) {
 }
 
 // TestMixedVersionTokenCache_CurrentPayloadReadByPreRefactorReader proves the
-// new-payload -> old-binary direction for "token:<key>": the current
-// CacheGetTokenByKey populates the entry on a miss, and the payload's key set is
-// required to be IDENTICAL to the pre-refactor fixture's (the token cache never
-// went through Token.MarshalJSON, so retiring it changed nothing here).
+// current token payload is keyed by hash and never carries the plaintext key:
+// relative to the pre-refactor fixture it drops "key" and gains only
+// "key_hash" and "key_prefix", while the fields the old reader depended on
+// still decode.
 func TestMixedVersionTokenCache_CurrentPayloadReadByPreRefactorReader(t *testing.T) {
 	ctx := setupMixedVersionCacheTest(t)
 
@@ -493,17 +495,20 @@ func TestMixedVersionTokenCache_CurrentPayloadReadByPreRefactorReader(t *testing
 	require.NotZero(t, token.Id)
 	t.Cleanup(func() { DB.Exec("DELETE FROM tokens WHERE id = ?", token.Id) })
 
-	// Cache miss -> the current binary writes the entry.
+	// Cache miss -> the current binary writes the entry under the key hash.
 	_, err := CacheGetTokenByKey(ctx, token.Key)
 	require.NoError(t, err)
-	rawPayload, err := common.RedisGet(ctx, fmt.Sprintf("token:%s", token.Key))
+	_, err = common.RedisGet(ctx, fmt.Sprintf("token:%s", token.Key))
+	require.Error(t, err, "the plaintext key must never be used as a cache key")
+	rawPayload, err := common.RedisGet(ctx, fmt.Sprintf("token:%s", token.KeyHash))
 	require.NoError(t, err, "current binary must have populated the token cache")
+	require.NotContains(t, rawPayload, token.Key, "the cached payload must not carry the plaintext key")
 
 	fixtureBytes, _ := loadJSONFixture(t, preRefactorTokenFixture)
 	oldKeys := jsonKeySet(t, fixtureBytes)
 	newKeys := jsonKeySet(t, []byte(rawPayload))
-	require.Equal(t, oldKeys, newKeys,
-		"the token cache payload key set must be unchanged across the refactor")
+	require.Equal(t, []string{"key"}, keysMissingFrom(oldKeys, newKeys))
+	require.Equal(t, []string{"key_hash", "key_prefix"}, keysMissingFrom(newKeys, oldKeys))
 
 	var oldReader struct {
 		Id     int    `json:"id"`
@@ -515,6 +520,6 @@ func TestMixedVersionTokenCache_CurrentPayloadReadByPreRefactorReader(t *testing
 		"pre-refactor reader must not fail on the current token payload")
 	require.Equal(t, token.Id, oldReader.Id)
 	require.Equal(t, 42, oldReader.UserId)
-	require.Equal(t, token.Key, oldReader.Key, "the raw key must still be cached unprefixed for the old reader")
+	require.Empty(t, oldReader.Key)
 	require.Equal(t, TokenStatusEnabled, oldReader.Status)
 }
@@ -110,6 +110,12 @@ type ChannelConfig struct {
 	// (including the realtime endpoint); SDK-based channels (e.g. AWS Bedrock,
 	// Vertex AI) ignore it.
 	EndpointURLs map[string]string `json:"endpoint_urls,omitempty"`
+	// KeySelectionMode enables the channel key pool (see ChannelKey) and selects
+	// how a key is chosen per request: round_robin, random, or least_errored.
+	// When empty, the channel serves every request with Channel.Key.
+	KeySelectionMode string `json:"key_selection_mode,omitempty"`
+	// Mock shapes the synthesized responses of a Mock channel.
+	Mock *MockChannelConfig `json:"mock,omitempty"`
 }
 
 type ModelConfig struct {
@@ -377,6 +383,34 @@ func (channel *Channel) Insert() error {
 	return nil
 }
 
+// InsertWithKeyPool creates a pooled channel and its key pool in one transaction.
+// Parameters: keys are the pooled credentials; duplicates and blanks are skipped.
+// Returns: a wrapped validation or persistence error.
+func (channel *Channel) InsertWithKeyPool(keys []string) error {
+	if err := channel.NormalizeHiddenModels(); err != nil {
+		return identity.Tag(
+			errors.Wrapf(err, "failed to normalize hidden models for channel: name=%s, type=%d", channel.Name, channel.Type),
+			channel.Ref())
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(channel).Error; err != nil {
+			return errors.Wrapf(err, "insert channel: name=%s, type=%d", channel.Name, channel.Type)
+		}
+		if err := addAbilitiesWithDB(tx, channel); err != nil {
+			return errors.Wrapf(err, "add abilities for channel: id=%d, name=%s", channel.Id, channel.Name)
+		}
+		if _, err := addChannelKeysWithDB(tx, channel.Id, keys); err != nil {
+			return errors.Wrapf(err, "add key pool for channel: id=%d, name=%s", channel.Id, channel.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return identity.Tag(errors.Wrap(err, "persist pooled channel transaction"), channel.Ref())
+	}
+	InvalidateChannelModelCaches(channel.Group)
+	return nil
+}
+
 func (channel *Channel) Update() error {
 	return channel.UpdateWithContext(context.Background())
 }
@@ -394,11 +428,16 @@ func (channel *Channel) UpdateWithContext(ctx context.Context) error {
 	clearTestingModel := false
 	var existing Channel
 	if channel.Id != 0 {
-		if err := DB.Select("id", "models", "testing_model", "group").First(&existing, "id = ?", channel.Id).Error; err != nil {
+		if err := DB.Select("id", "models", "testing_model", "group", "key", "config").First(&existing, "id = ?", channel.Id).Error; err != nil {
 			return identity.Tag(
 				errors.Wrapf(err, "load existing channel %d before update", channel.Id),
 				channel.Ref())
 		}
+		if err := channel.keepMaskedSecrets(&existing); err != nil {
+			return identity.Tag(
+				errors.Wrapf(err, "restore masked secrets of channel %d", channel.Id),
+				channel.Ref())
+		}
 	}
 	// Determine models to validate against: new value if provided, else existing
 	modelsForValidation := channel.Models
@@ -543,6 +582,9 @@ func (channel *Channel) Delete() error {
 			errors.Wrapf(err, "delete abilities for channel %d", channel.Id),
 			channel.Ref())
 	}
+	if err := deleteChannelKeysWithDB(DB, channel.Id); err != nil {
+		return identity.Tag(err, channel.Ref())
+	}
 	InvalidateChannelModelCaches(oldGroups)
 	return nil
 }
@@ -662,10 +704,17 @@ func updateChannelUsedQuota(ctx context.Context, id int, quota int64) {
 
 func DeleteChannelByStatus(status int64) (int64, error) {
 	var channels []Channel
-	_ = DB.Select("group").Where("status = ?", status).Find(&channels).Error
+	_ = DB.Select("id", "group").Where("status = ?", status).Find(&channels).Error
 	groups := make([]string, 0, len(channels))
+	ids := make([]int, 0, len(channels))
 	for _, channel := range channels {
 		groups = append(groups, channel.Group)
+		ids = append(ids, channel.Id)
+	}
+	if len(ids) > 0 {
+		if err := DB.Where("channel_id IN ?", ids).Delete(&ChannelKey{}).Error; err != nil {
+			return 0, errors.Wrap(err, "delete key pools of removed channels")
+		}
 	}
 	result := DB.Where("status = ?", status).Delete(&Channel{})
 	if result.Error == nil {
@@ -676,10 +725,17 @@ func DeleteChannelByStatus(status int64) (int64, error) {
 
 func DeleteDisabledChannel() (int64, error) {
 	var channels []Channel
-	_ = DB.Select("group").Where("status = ? or status = ?", ChannelStatusAutoDisabled, ChannelStatusManuallyDisabled).Find(&channels).Error
+	_ = DB.Select("id", "group").Where("status = ? or status = ?", ChannelStatusAutoDisabled, ChannelStatusManuallyDisabled).Find(&channels).Error
 	groups := make([]string, 0, len(channels))
+	ids := make([]int, 0, len(channels))
 	for _, channel := range channels {
 		groups = append(groups, channel.Group)
+		ids = append(ids, channel.Id)
+	}
+	if len(ids) > 0 {
+		if err := DB.Where("channel_id IN ?", ids).Delete(&ChannelKey{}).Error; err != nil {
+			return 0, errors.Wrap(err, "delete key pools of removed channels")
+		}
 	}
 	result := DB.Where("status = ? or status = ?", ChannelStatusAutoDisabled, ChannelStatusManuallyDisabled).Delete(&Channel{})
 	if result.Error == nil {
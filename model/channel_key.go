@@ -0,0 +1,428 @@
+package model
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/identity"
+)
+
+const (
+	// ChannelKeyStatusEnabled marks a pooled key as eligible for selection.
+	ChannelKeyStatusEnabled = 1
+	// ChannelKeyStatusManuallyDisabled marks a key an administrator switched off.
+	ChannelKeyStatusManuallyDisabled = 2
+	// ChannelKeyStatusAutoDisabled marks a key the health policy switched off.
+	ChannelKeyStatusAutoDisabled = 3
+)
+
+const (
+	// KeySelectionRoundRobin cycles through available keys in insertion order.
+	KeySelectionRoundRobin = "round_robin"
+	// KeySelectionRandom picks a uniformly random available key.
+	KeySelectionRandom = "random"
+	// KeySelectionLeastErrored picks the available key whose last error is oldest.
+	KeySelectionLeastErrored = "least_errored"
+)
+
+// channelKeyLastErrorMaxLen bounds the persisted last_error snippet.
+const channelKeyLastErrorMaxLen = 512
+
+// ChannelKey is one upstream credential inside a channel's key pool. A channel
+// whose ChannelConfig.KeySelectionMode is set serves every request with one of
+// its pooled keys instead of Channel.Key, so health (suspension, auto-disable)
+// and usage counters are tracked per key rather than per channel row.
+type ChannelKey struct {
+	Id           int        `json:"-"`
+	UUID         string     `json:"uuid" gorm:"type:char(36);column:uuid;index"`
+	ChannelId    int        `json:"-" gorm:"index;not null"`
+	Key          string     `json:"-" gorm:"type:text"`
+	KeyPreview   string     `json:"-" gorm:"type:varchar(32);default:''"` // masked form kept so lists never decrypt Key
+	Status       int        `json:"status" gorm:"default:1"`
+	SuspendUntil *time.Time `json:"suspend_until,omitempty"`
+	RequestCount int64      `json:"request_count" gorm:"bigint;default:0"`
+	ErrorCount   int64      `json:"error_count" gorm:"bigint;default:0"`
+	LastUsedAt   int64      `json:"last_used_at" gorm:"bigint;default:0"`
+	LastErrorAt  int64      `json:"last_error_at" gorm:"bigint;default:0"`
+	LastError    string     `json:"last_error" gorm:"type:text"`
+	CreatedAt    int64      `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
+	UpdatedAt    int64      `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
+}
+
+// TableName returns the database table name for ChannelKey.
+func (ChannelKey) TableName() string {
+	return "channel_keys"
+}
+
+// BeforeCreate assigns a server-generated UUID to a pooled key before insertion.
+// Parameters:
+//   - tx: GORM transaction supplied by the create callback.
+//
+// Return values:
+//   - error: non-nil only if UUID generation fails.
+func (key *ChannelKey) BeforeCreate(tx *gorm.DB) error {
+	return ensureUUID(&key.UUID)
+}
+
+// IsAvailable reports whether the key is enabled and not suspended at now.
+func (key *ChannelKey) IsAvailable(now time.Time) bool {
+	if key == nil || key.Status != ChannelKeyStatusEnabled {
+		return false
+	}
+	return key.SuspendUntil == nil || !key.SuspendUntil.After(now)
+}
+
+// IsValidKeySelectionMode reports whether mode is a supported pool selection mode.
+// The empty string is valid and means the channel does not use a key pool.
+func IsValidKeySelectionMode(mode string) bool {
+	switch mode {
+	case "", KeySelectionRoundRobin, KeySelectionRandom, KeySelectionLeastErrored:
+		return true
+	default:
+		return false
+	}
+}
+
+// KeySelectionMode returns the configured pool selection mode, or "" when the
+// channel uses its single Channel.Key.
+func (channel *Channel) KeySelectionMode() string {
+	if channel == nil {
+		return ""
+	}
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(cfg.KeySelectionMode)
+}
+
+// UsesKeyPool reports whether requests on this channel draw from channel_keys.
+func (channel *Channel) UsesKeyPool() bool {
+	return channel.KeySelectionMode() != ""
+}
+
+// WithSingleKey returns a copy of channel pinned to key, with the key pool
+// switched off, so probes such as the per-key channel test exercise exactly
+// that credential.
+func (channel *Channel) WithSingleKey(key *ChannelKey) (*Channel, error) {
+	pinned := *channel
+	pinned.Key = key.Key
+	cfg, err := pinned.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.KeySelectionMode = ""
+	if err := pinned.storeConfig(cfg); err != nil {
+		return nil, err
+	}
+	return &pinned, nil
+}
+
+// SplitChannelKeys splits a multi-line key payload into trimmed, de-duplicated
+// non-empty keys while preserving input order.
+func SplitChannelKeys(raw string) []string {
+	seen := make(map[string]struct{})
+	keys := make([]string, 0)
+	for line := range strings.SplitSeq(raw, "\n") {
+		key := strings.TrimSpace(line)
+		if key == "" {
+			continue
+		}
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// GetChannelKeys lists every pooled key of a channel in insertion order.
+func GetChannelKeys(ctx context.Context, channelId int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	if err := DB.WithContext(ctx).Where("channel_id = ?", channelId).Order("id asc").Find(&keys).Error; err != nil {
+		return nil, identity.Tag(
+			errors.Wrapf(err, "list keys for channel %d", channelId),
+			LookupChannelRef(ctx, channelId))
+	}
+	return keys, nil
+}
+
+// GetChannelKeyById loads one pooled key by its internal id.
+func GetChannelKeyById(ctx context.Context, keyId int) (*ChannelKey, error) {
+	key := &ChannelKey{}
+	if err := DB.WithContext(ctx).First(key, "id = ?", keyId).Error; err != nil {
+		return nil, errors.Wrapf(err, "get channel key %d", keyId)
+	}
+	return key, nil
+}
+
+// GetChannelKeyByUUID loads one pooled key, scoped to its owning channel so a
+// key reference can never address another channel's credential.
+func GetChannelKeyByUUID(ctx context.Context, channelId int, uuid string) (*ChannelKey, error) {
+	uuid = strings.TrimSpace(uuid)
+	if uuid == "" {
+		return nil, errkind.InvalidRequestErr(errors.New("key uuid is empty"))
+	}
+	key := &ChannelKey{}
+	err := DB.WithContext(ctx).Where("channel_id = ? AND uuid = ?", channelId, uuid).First(key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errkind.NotFoundErr(errors.Wrapf(err, "key %s not found in channel %d", uuid, channelId))
+		}
+		return nil, errors.Wrapf(err, "get key %s for channel %d", uuid, channelId)
+	}
+	return key, nil
+}
+
+// AddChannelKeys appends keys to a channel's pool, skipping values already in it.
+// Returns the newly inserted rows.
+func AddChannelKeys(ctx context.Context, channelId int, keys []string) ([]*ChannelKey, error) {
+	rows, err := addChannelKeysWithDB(DB.WithContext(ctx), channelId, keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > 0 {
+		refreshCachedChannelKeys(ctx, channelId)
+	}
+	return rows, nil
+}
+
+// addChannelKeysWithDB inserts pooled keys through db so channel creation can
+// persist the channel row and its pool in one transaction.
+func addChannelKeysWithDB(db *gorm.DB, channelId int, keys []string) ([]*ChannelKey, error) {
+	if channelId <= 0 {
+		return nil, errors.New("channel id must be specified when adding keys")
+	}
+	var existing []string
+	if err := db.Model(&ChannelKey{}).Where("channel_id = ?", channelId).Pluck("key", &existing).Error; err != nil {
+		return nil, errors.Wrapf(err, "load existing keys for channel %d", channelId)
+	}
+	known := make(map[string]struct{}, len(existing))
+	for _, k := range existing {
+		plaintext, err := OpenChannelSecret(k)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decrypt existing keys for channel %d", channelId)
+		}
+		known[plaintext] = struct{}{}
+	}
+
+	rows := make([]*ChannelKey, 0, len(keys))
+	for _, k := range keys {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		if _, dup := known[k]; dup {
+			continue
+		}
+		known[k] = struct{}{}
+		rows = append(rows, &ChannelKey{ChannelId: channelId, Key: k, Status: ChannelKeyStatusEnabled})
+	}
+	if len(rows) == 0 {
+		return rows, nil
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		return nil, errors.Wrapf(err, "insert %d keys for channel %d", len(rows), channelId)
+	}
+	return rows, nil
+}
+
+// UpdateChannelKeyStatus sets a pooled key's status and clears any suspension
+// when the key is re-enabled.
+func UpdateChannelKeyStatus(ctx context.Context, keyId int, status int) error {
+	updates := map[string]any{"status": status}
+	if status == ChannelKeyStatusEnabled {
+		updates["suspend_until"] = nil
+	}
+	if err := DB.WithContext(ctx).Model(&ChannelKey{}).Where("id = ?", keyId).Updates(updates).Error; err != nil {
+		return errors.Wrapf(err, "update status of channel key %d", keyId)
+	}
+	refreshCachedChannelKeysOf(ctx, keyId)
+	return nil
+}
+
+// SuspendChannelKey takes one pooled key out of rotation for duration. It is the
+// key-level counterpart of SuspendAbility for 429/5xx cooldowns.
+func SuspendChannelKey(ctx context.Context, keyId int, duration time.Duration) error {
+	if keyId <= 0 {
+		return errors.New("channel key id must be specified for suspending key")
+	}
+	suspendTime := time.Now().UTC().Add(duration)
+	result := DB.WithContext(ctx).Model(&ChannelKey{}).Where("id = ?", keyId).Update("suspend_until", suspendTime)
+	if result.Error != nil {
+		return errors.Wrapf(result.Error, "suspend channel key %d", keyId)
+	}
+	if result.RowsAffected != 1 {
+		return errors.Errorf("suspend channel key %d affected %d rows instead of 1", keyId, result.RowsAffected)
+	}
+	refreshCachedChannelKeysOf(ctx, keyId)
+	return nil
+}
+
+// DeleteChannelKey removes one pooled key.
+func DeleteChannelKey(ctx context.Context, keyId int) error {
+	channelId := channelKeyOwner(ctx, keyId)
+	if err := DB.WithContext(ctx).Delete(&ChannelKey{}, "id = ?", keyId).Error; err != nil {
+		return errors.Wrapf(err, "delete channel key %d", keyId)
+	}
+	refreshCachedChannelKeys(ctx, channelId)
+	return nil
+}
+
+// channelKeyOwner returns the id of the channel owning a pooled key, or 0 when
+// the key does not exist.
+func channelKeyOwner(ctx context.Context, keyId int) int {
+	var channelIds []int
+	if err := DB.WithContext(ctx).Model(&ChannelKey{}).Where("id = ?", keyId).
+		Pluck("channel_id", &channelIds).Error; err != nil || len(channelIds) == 0 {
+		return 0
+	}
+	return channelIds[0]
+}
+
+// deleteChannelKeysWithDB removes a channel's whole pool through db.
+func deleteChannelKeysWithDB(db *gorm.DB, channelId int) error {
+	if err := db.Where("channel_id = ?", channelId).Delete(&ChannelKey{}).Error; err != nil {
+		return errors.Wrapf(err, "delete keys for channel %d", channelId)
+	}
+	return nil
+}
+
+// CountAvailableChannelKeys returns how many keys of the channel are enabled and
+// not suspended right now.
+func CountAvailableChannelKeys(ctx context.Context, channelId int) (int64, error) {
+	var count int64
+	err := DB.WithContext(ctx).Model(&ChannelKey{}).
+		Where("channel_id = ? AND status = ? AND (suspend_until IS NULL OR suspend_until < ?)",
+			channelId, ChannelKeyStatusEnabled, time.Now().UTC()).
+		Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrapf(err, "count available keys for channel %d", channelId)
+	}
+	return count, nil
+}
+
+// CountEnabledChannelKeys returns how many keys of the channel are enabled,
+// regardless of temporary suspension.
+func CountEnabledChannelKeys(ctx context.Context, channelId int) (int64, error) {
+	var count int64
+	err := DB.WithContext(ctx).Model(&ChannelKey{}).
+		Where("channel_id = ? AND status = ?", channelId, ChannelKeyStatusEnabled).
+		Count(&count).Error
+	if err != nil {
+		return 0, errors.Wrapf(err, "count enabled keys for channel %d", channelId)
+	}
+	return count, nil
+}
+
+// RecordChannelKeyOutcome bumps a pooled key's usage counters after a relay
+// attempt. errMsg is only used when success is false.
+func RecordChannelKeyOutcome(ctx context.Context, keyId int, success bool, errMsg string) error {
+	if keyId <= 0 {
+		return nil
+	}
+	now := helper.GetTimestamp()
+	updates := map[string]any{
+		"request_count": gorm.Expr("request_count + ?", 1),
+		"last_used_at":  now,
+	}
+	if !success {
+		if len(errMsg) > channelKeyLastErrorMaxLen {
+			errMsg = errMsg[:channelKeyLastErrorMaxLen]
+		}
+		updates["error_count"] = gorm.Expr("error_count + ?", 1)
+		updates["last_error_at"] = now
+		updates["last_error"] = errMsg
+	}
+	if err := DB.WithContext(ctx).Model(&ChannelKey{}).Where("id = ?", keyId).Updates(updates).Error; err != nil {
+		return errors.Wrapf(err, "record outcome for channel key %d", keyId)
+	}
+	if !success {
+		// least_errored ranks keys by LastErrorAt.
+		refreshCachedChannelKeysOf(ctx, keyId)
+	}
+	return nil
+}
+
+// channelKeyCursors holds the per-channel round-robin position.
+var channelKeyCursors sync.Map // map[int]*atomic.Uint64
+
+// nextChannelKeyCursor returns the next round-robin position for channelId.
+func nextChannelKeyCursor(channelId int) uint64 {
+	v, _ := channelKeyCursors.LoadOrStore(channelId, new(atomic.Uint64))
+	return v.(*atomic.Uint64).Add(1) - 1
+}
+
+// SelectChannelKey picks the key that should serve the next request on channel.
+// It returns (nil, nil) when the channel does not use a key pool. The pool is
+// read from the channel cache when it covers the channel. When every
+// enabled key is suspended, the key whose suspension ends first is returned so
+// the channel degrades instead of failing closed; ability-level routing already
+// decides whether the channel should be tried at all.
+func SelectChannelKey(ctx context.Context, channel *Channel) (*ChannelKey, error) {
+	mode := channel.KeySelectionMode()
+	if mode == "" {
+		return nil, nil
+	}
+	enabled, cached := cachedChannelKeys(channel.Id)
+	if !cached {
+		if err := DB.WithContext(ctx).
+			Where("channel_id = ? AND status = ?", channel.Id, ChannelKeyStatusEnabled).
+			Order("id asc").Find(&enabled).Error; err != nil {
+			return nil, identity.Tag(
+				errors.Wrapf(err, "load enabled keys for channel %d", channel.Id),
+				channel.Ref())
+		}
+	}
+	if len(enabled) == 0 {
+		return nil, identity.Tag(
+			errkind.ConfigErr(errors.Errorf("channel %d has no enabled keys in its pool", channel.Id)),
+			channel.Ref())
+	}
+	return pickChannelKey(channel.Id, mode, enabled, time.Now()), nil
+}
+
+// pickChannelKey applies mode to the enabled keys of a channel. enabled must be
+// non-empty and ordered by id.
+func pickChannelKey(channelId int, mode string, enabled []*ChannelKey, now time.Time) *ChannelKey {
+	available := make([]*ChannelKey, 0, len(enabled))
+	for _, key := range enabled {
+		if key.IsAvailable(now) {
+			available = append(available, key)
+		}
+	}
+	if len(available) == 0 {
+		soonest := enabled[0]
+		for _, key := range enabled[1:] {
+			if key.SuspendUntil != nil && soonest.SuspendUntil != nil && key.SuspendUntil.Before(*soonest.SuspendUntil) {
+				soonest = key
+			}
+		}
+		return soonest
+	}
+
+	switch mode {
+	case KeySelectionRandom:
+		return available[rand.Intn(len(available))]
+	case KeySelectionLeastErrored:
+		best := available[0]
+		for _, key := range available[1:] {
+			if key.LastErrorAt < best.LastErrorAt {
+				best = key
+			}
+		}
+		return best
+	default:
+		return available[nextChannelKeyCursor(channelId)%uint64(len(available))]
+	}
+}
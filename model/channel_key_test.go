@@ -0,0 +1,210 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common/config"
+)
+
+func setupChannelKeyTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&Channel{}, &Ability{}, &ChannelKey{}))
+
+	originalDB := DB
+	DB = db
+	t.Cleanup(func() { DB = originalDB })
+}
+
+func newPooledChannel(t *testing.T, mode string, keys ...string) *Channel {
+	t.Helper()
+	channel := &Channel{Name: "pool", Status: ChannelStatusEnabled, Models: "gpt-4o", Group: "default"}
+	require.NoError(t, channel.storeConfig(ChannelConfig{KeySelectionMode: mode}))
+	require.NoError(t, DB.Create(channel).Error)
+	_, err := AddChannelKeys(context.Background(), channel.Id, keys)
+	require.NoError(t, err)
+	return channel
+}
+
+func TestSplitChannelKeys(t *testing.T) {
+	require.Equal(t, []string{"a", "b", "c"}, SplitChannelKeys(" a\n\nb\r\na\nc \n"))
+	require.Empty(t, SplitChannelKeys("\n \n"))
+}
+
+func TestAddChannelKeys_DeduplicatesAndAssignsUUID(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	ctx := context.Background()
+	channel := newPooledChannel(t, KeySelectionRoundRobin, "k1", "k2")
+
+	added, err := AddChannelKeys(ctx, channel.Id, []string{"k2", "k3"})
+	require.NoError(t, err)
+	require.Len(t, added, 1)
+	require.Equal(t, "k3", added[0].Key)
+	require.NotEmpty(t, added[0].UUID)
+
+	keys, err := GetChannelKeys(ctx, channel.Id)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+}
+
+func TestSelectChannelKey_NotPooled(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	channel := &Channel{Name: "plain", Key: "sk-plain"}
+	require.NoError(t, DB.Create(channel).Error)
+
+	key, err := SelectChannelKey(context.Background(), channel)
+	require.NoError(t, err)
+	require.Nil(t, key)
+}
+
+func TestSelectChannelKey_RoundRobinSkipsUnavailable(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	ctx := context.Background()
+	channel := newPooledChannel(t, KeySelectionRoundRobin, "k1", "k2", "k3")
+	keys, err := GetChannelKeys(ctx, channel.Id)
+	require.NoError(t, err)
+
+	require.NoError(t, UpdateChannelKeyStatus(ctx, keys[1].Id, ChannelKeyStatusManuallyDisabled))
+
+	seen := make(map[string]int)
+	for range 4 {
+		key, err := SelectChannelKey(ctx, channel)
+		require.NoError(t, err)
+		seen[key.Key]++
+	}
+	require.Equal(t, map[string]int{"k1": 2, "k3": 2}, seen)
+
+	require.NoError(t, SuspendChannelKey(ctx, keys[0].Id, time.Minute))
+	for range 3 {
+		key, err := SelectChannelKey(ctx, channel)
+		require.NoError(t, err)
+		require.Equal(t, "k3", key.Key)
+	}
+}
+
+func TestSelectChannelKey_LeastErrored(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	ctx := context.Background()
+	channel := newPooledChannel(t, KeySelectionLeastErrored, "k1", "k2")
+	keys, err := GetChannelKeys(ctx, channel.Id)
+	require.NoError(t, err)
+
+	require.NoError(t, RecordChannelKeyOutcome(ctx, keys[0].Id, false, "upstream 500"))
+	key, err := SelectChannelKey(ctx, channel)
+	require.NoError(t, err)
+	require.Equal(t, "k2", key.Key)
+
+	reloaded, err := GetChannelKeyById(ctx, keys[0].Id)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, reloaded.RequestCount)
+	require.EqualValues(t, 1, reloaded.ErrorCount)
+	require.Equal(t, "upstream 500", reloaded.LastError)
+}
+
+func TestSelectChannelKey_AllSuspendedFallsBackToSoonest(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	ctx := context.Background()
+	channel := newPooledChannel(t, KeySelectionRandom, "k1", "k2")
+	keys, err := GetChannelKeys(ctx, channel.Id)
+	require.NoError(t, err)
+
+	require.NoError(t, SuspendChannelKey(ctx, keys[0].Id, time.Hour))
+	require.NoError(t, SuspendChannelKey(ctx, keys[1].Id, time.Minute))
+
+	available, err := CountAvailableChannelKeys(ctx, channel.Id)
+	require.NoError(t, err)
+	require.Zero(t, available)
+
+	key, err := SelectChannelKey(ctx, channel)
+	require.NoError(t, err)
+	require.Equal(t, "k2", key.Key)
+}
+
+func TestSelectChannelKey_NoEnabledKeys(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	ctx := context.Background()
+	channel := newPooledChannel(t, KeySelectionRoundRobin, "k1")
+	keys, err := GetChannelKeys(ctx, channel.Id)
+	require.NoError(t, err)
+	require.NoError(t, UpdateChannelKeyStatus(ctx, keys[0].Id, ChannelKeyStatusAutoDisabled))
+
+	_, err = SelectChannelKey(ctx, channel)
+	require.Error(t, err)
+
+	enabled, err := CountEnabledChannelKeys(ctx, channel.Id)
+	require.NoError(t, err)
+	require.Zero(t, enabled)
+}
+
+func TestSelectChannelKey_ReadsChannelCache(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	originalMemoryCacheEnabled := config.MemoryCacheEnabled
+	config.MemoryCacheEnabled = true
+	channelSyncLock.RLock()
+	originalGroup2model2channels, originalChannels, originalKeys := group2model2channels, channelId2channel, channelId2keys
+	channelSyncLock.RUnlock()
+	t.Cleanup(func() {
+		config.MemoryCacheEnabled = originalMemoryCacheEnabled
+		channelSyncLock.Lock()
+		group2model2channels, channelId2channel, channelId2keys = originalGroup2model2channels, originalChannels, originalKeys
+		channelSyncLock.Unlock()
+	})
+
+	ctx := context.Background()
+	channel := newPooledChannel(t, KeySelectionLeastErrored, "k1", "k2", "k3")
+	keys, err := GetChannelKeys(ctx, channel.Id)
+	require.NoError(t, err)
+	InitChannelCache()
+
+	// A row removed behind the model's back stays selectable until the next sync.
+	require.NoError(t, DB.Delete(&ChannelKey{}, "id = ?", keys[0].Id).Error)
+	key, err := SelectChannelKey(ctx, channel)
+	require.NoError(t, err)
+	require.Equal(t, "k1", key.Key)
+
+	// Changes made through the model apply to the next selection.
+	require.NoError(t, RecordChannelKeyOutcome(ctx, keys[1].Id, false, "upstream 500"))
+	key, err = SelectChannelKey(ctx, channel)
+	require.NoError(t, err)
+	require.Equal(t, "k3", key.Key)
+
+	require.NoError(t, UpdateChannelKeyStatus(ctx, keys[2].Id, ChannelKeyStatusManuallyDisabled))
+	key, err = SelectChannelKey(ctx, channel)
+	require.NoError(t, err)
+	require.Equal(t, "k2", key.Key)
+
+	require.NoError(t, DeleteChannelKey(ctx, keys[1].Id))
+	_, err = SelectChannelKey(ctx, channel)
+	require.Error(t, err)
+
+	_, err = AddChannelKeys(ctx, channel.Id, []string{"k4"})
+	require.NoError(t, err)
+	key, err = SelectChannelKey(ctx, channel)
+	require.NoError(t, err)
+	require.Equal(t, "k4", key.Key)
+}
+
+func TestChannelDelete_RemovesKeyPool(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	ctx := context.Background()
+	channel := newPooledChannel(t, KeySelectionRoundRobin, "k1", "k2")
+
+	require.NoError(t, channel.Delete())
+	keys, err := GetChannelKeys(ctx, channel.Id)
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
+
+func TestChannelKeyToResponse_MasksKey(t *testing.T) {
+	until := time.Unix(1700000000, 0)
+	resp := (&ChannelKey{UUID: "u", Key: "sk-abcdefghijklmnop", SuspendUntil: &until}).ToResponse()
+	require.NotContains(t, resp.MaskedKey, "ghijkl")
+	require.Equal(t, int64(1700000000), *resp.SuspendUntil)
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/dto"
+	"github.com/Laisky/one-api/relay/state"
+)
+
+// ToResponse builds the external boundary DTO for a pooled channel key.
+//
+// Return values:
+//   - dto.ChannelKeyResponse: UUID-only shape with a masked credential preview;
+//     SuspendUntil is a unix-seconds timestamp, nil when the key is not suspended.
+func (key *ChannelKey) ToResponse() dto.ChannelKeyResponse {
+	if key == nil {
+		return dto.ChannelKeyResponse{}
+	}
+	// The preview is recorded when the key is written, so listing keys never
+	// decrypts them. Plaintext rows without one are masked directly, and sealed
+	// rows without one get the fully masked form.
+	maskedKey := key.KeyPreview
+	if maskedKey == "" {
+		plaintext := key.Key
+		if state.IsSealed(plaintext) {
+			plaintext = ""
+		}
+		maskedKey = helper.MaskAPIKey(plaintext)
+	}
+	out := dto.ChannelKeyResponse{
+		UUID:         key.UUID,
+		MaskedKey:    maskedKey,
+		Status:       key.Status,
+		RequestCount: key.RequestCount,
+		ErrorCount:   key.ErrorCount,
+		LastUsedAt:   key.LastUsedAt,
+		LastErrorAt:  key.LastErrorAt,
+		LastError:    key.LastError,
+		CreatedAt:    key.CreatedAt,
+		UpdatedAt:    key.UpdatedAt,
+	}
+	if key.SuspendUntil != nil {
+		until := key.SuspendUntil.Unix()
+		out.SuspendUntil = &until
+	}
+	return out
+}
+
+// ChannelKeysToResponses maps pooled keys to their external DTOs.
+func ChannelKeysToResponses(keys []*ChannelKey) []dto.ChannelKeyResponse {
+	out := make([]dto.ChannelKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, k.ToResponse())
+	}
+	return out
+}
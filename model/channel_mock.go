@@ -0,0 +1,106 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/relay/channeltype"
+)
+
+const (
+	// MockFormatOpenAI makes a Mock channel answer like OpenAI Chat Completions.
+	MockFormatOpenAI = "openai"
+	// MockFormatClaude makes a Mock channel answer like Anthropic Messages.
+	MockFormatClaude = "claude"
+	// MockFormatGemini makes a Mock channel answer like Gemini generateContent.
+	MockFormatGemini = "gemini"
+)
+
+const (
+	// MockFaultRateLimit answers 429 with a provider-shaped rate limit error.
+	MockFaultRateLimit = "rate_limit"
+	// MockFaultServerError answers 500 with a provider-shaped server error.
+	MockFaultServerError = "server_error"
+	// MockFaultTimeout never answers and fails once the relay timeout elapses.
+	MockFaultTimeout = "timeout"
+	// MockFaultMalformedSSE answers 200 and then sends a broken body.
+	MockFaultMalformedSSE = "malformed_sse"
+)
+
+// MockChannelConfig shapes the responses a Mock channel synthesizes. The zero
+// value answers every request immediately in the OpenAI format.
+type MockChannelConfig struct {
+	// Format is the upstream wire format: openai (default), claude or gemini.
+	Format string `json:"format,omitempty"`
+	// Content is the assistant reply. Empty echoes the last user message.
+	Content string `json:"content,omitempty"`
+	// DisableToolCalls answers with text even when the request offers tools.
+	DisableToolCalls bool `json:"disable_tool_calls,omitempty"`
+	// LatencyMs delays the response headers.
+	LatencyMs int `json:"latency_ms,omitempty"`
+	// ChunkDelayMs delays each streamed chunk after the first one.
+	ChunkDelayMs int `json:"chunk_delay_ms,omitempty"`
+	// Fault is the failure to inject: rate_limit, server_error, timeout or malformed_sse.
+	Fault string `json:"fault,omitempty"`
+	// FaultEvery injects the fault into every Nth request to the channel.
+	FaultEvery int `json:"fault_every,omitempty"`
+	// FaultRate injects the fault into this share of requests, between 0 and 1.
+	// When both FaultEvery and FaultRate are zero, every request fails.
+	FaultRate float64 `json:"fault_rate,omitempty"`
+}
+
+// MockFormat returns the normalized wire format, defaulting to openai.
+func (cfg *MockChannelConfig) MockFormat() string {
+	if cfg == nil {
+		return MockFormatOpenAI
+	}
+	if format := strings.ToLower(strings.TrimSpace(cfg.Format)); format != "" {
+		return format
+	}
+	return MockFormatOpenAI
+}
+
+// Validate checks the format, fault and timing fields.
+func (cfg *MockChannelConfig) Validate() error {
+	if cfg == nil {
+		return nil
+	}
+	switch cfg.MockFormat() {
+	case MockFormatOpenAI, MockFormatClaude, MockFormatGemini:
+	default:
+		return errors.Errorf("unknown mock format %q", cfg.Format)
+	}
+	switch strings.TrimSpace(cfg.Fault) {
+	case "", MockFaultRateLimit, MockFaultServerError, MockFaultTimeout, MockFaultMalformedSSE:
+	default:
+		return errors.Errorf("unknown mock fault %q", cfg.Fault)
+	}
+	if cfg.LatencyMs < 0 || cfg.ChunkDelayMs < 0 || cfg.FaultEvery < 0 {
+		return errors.New("mock latency_ms, chunk_delay_ms and fault_every must not be negative")
+	}
+	if cfg.FaultRate < 0 || cfg.FaultRate > 1 {
+		return errors.New("mock fault_rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// ValidateMockConfig checks the mock settings of a Mock channel. Other channel
+// types must not carry them.
+func (channel *Channel) ValidateMockConfig() error {
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return errkind.InvalidRequestErr(err)
+	}
+	if cfg.Mock == nil {
+		return nil
+	}
+	if channel.Type != channeltype.Mock {
+		return errkind.InvalidRequestErr(errors.New("mock config is only allowed on Mock channels"))
+	}
+	if err := cfg.Mock.Validate(); err != nil {
+		return errkind.InvalidRequestErr(err)
+	}
+	return nil
+}
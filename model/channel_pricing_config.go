@@ -24,6 +24,14 @@ type ModelConfigLocal struct {
 	Image             *ImagePricingLocal     `json:"image,omitempty"`
 	Embedding         *EmbeddingPricingLocal `json:"embedding,omitempty"`
 	TimeWindows       []TimeWindowLocal      `json:"time_windows,omitempty"`
+	// SupportedFeatures overrides the adaptor's capability flags for this channel,
+	// and can opt the model into gateway-side emulations such as
+	// "structured_outputs_emulation".
+	SupportedFeatures []string `json:"supported_features,omitempty"`
+	// ContextLength and MaxOutputTokens override the adaptor's context window
+	// metadata for this channel; 0 keeps the adaptor value.
+	ContextLength   int32 `json:"context_length,omitempty"`
+	MaxOutputTokens int32 `json:"max_output_tokens,omitempty"`
 }
 
 // TimeWindowLocal mirrors adaptor.TimeWindow for channel JSON persistence.
@@ -126,6 +134,8 @@ func normalizeModelConfigLocal(cfg ModelConfigLocal) (ModelConfigLocal, error) {
 		CacheWrite5mRatio: cfg.CacheWrite5mRatio,
 		CacheWrite1hRatio: cfg.CacheWrite1hRatio,
 		MaxTokens:         cfg.MaxTokens,
+		ContextLength:     cfg.ContextLength,
+		MaxOutputTokens:   cfg.MaxOutputTokens,
 	}
 	if len(cfg.Tiers) > 0 {
 		normalized.Tiers = append([]ModelRatioTierLocal(nil), cfg.Tiers...)
@@ -145,9 +155,35 @@ func normalizeModelConfigLocal(cfg ModelConfigLocal) (ModelConfigLocal, error) {
 	if len(timeWindows) > 0 {
 		normalized.TimeWindows = timeWindows
 	}
+	normalized.SupportedFeatures = normalizeSupportedFeaturesLocal(cfg.SupportedFeatures)
 	return normalized, nil
 }
 
+// normalizeSupportedFeaturesLocal lowercases and trims capability flags, dropping
+// blanks and duplicates while keeping the first-seen order.
+func normalizeSupportedFeaturesLocal(features []string) []string {
+	if len(features) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(features))
+	normalized := make([]string, 0, len(features))
+	for _, feature := range features {
+		feature = strings.ToLower(strings.TrimSpace(feature))
+		if feature == "" {
+			continue
+		}
+		if _, ok := seen[feature]; ok {
+			continue
+		}
+		seen[feature] = struct{}{}
+		normalized = append(normalized, feature)
+	}
+	if len(normalized) == 0 {
+		return nil
+	}
+	return normalized
+}
+
 // normalizeTimeWindowsLocal trims and validates time-window schedules for channel JSON.
 // Parameters: windows is the user-authored list whose order defines precedence.
 // Returns: the normalized list, or an error describing the invalid window field.
@@ -285,6 +321,12 @@ func (channel *Channel) validateModelPriceConfigs(configs map[string]ModelConfig
 		if config.MaxTokens < 0 {
 			return errors.Errorf("negative MaxTokens for model %s: %d", modelName, config.MaxTokens)
 		}
+		if config.ContextLength < 0 {
+			return errors.Errorf("negative context_length for model %s: %d", modelName, config.ContextLength)
+		}
+		if config.MaxOutputTokens < 0 {
+			return errors.Errorf("negative max_output_tokens for model %s: %d", modelName, config.MaxOutputTokens)
+		}
 
 		hasVideoData, err := validateVideoPricingLocal(config.Video, modelName)
 		if err != nil {
@@ -315,6 +357,9 @@ func (channel *Channel) validateModelPriceConfigs(configs map[string]ModelConfig
 			config.CacheWrite1hRatio == 0 &&
 			len(config.Tiers) == 0 &&
 			config.MaxTokens == 0 &&
+			config.ContextLength == 0 &&
+			config.MaxOutputTokens == 0 &&
+			len(config.SupportedFeatures) == 0 &&
 			!hasVideoData &&
 			!hasAudioData &&
 			!hasImageData &&
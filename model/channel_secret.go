@@ -0,0 +1,528 @@
+package model
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/relay/state"
+)
+
+// channelSecretRing holds the master keys of channel credential encryption.
+// Nil means encryption is not configured and credentials are stored as given.
+var channelSecretRing atomic.Pointer[state.KeyRing]
+
+// InitChannelSecretKeyRing loads the channel secret master keys from
+// CHANNEL_SECRET_KEYS or, when that is empty, from CHANNEL_SECRET_KEY_FILE. With
+// neither set, channel credentials keep being stored in plaintext.
+//
+// Return values:
+//   - error: wrapped error when the key file cannot be read or the key
+//     specification is malformed.
+func InitChannelSecretKeyRing() error {
+	spec := config.ChannelSecretKeys
+	source := "CHANNEL_SECRET_KEYS"
+	if spec == "" && config.ChannelSecretKeyFile != "" {
+		data, err := os.ReadFile(config.ChannelSecretKeyFile)
+		if err != nil {
+			return errors.Wrap(err, "read CHANNEL_SECRET_KEY_FILE")
+		}
+		spec = strings.TrimSpace(string(data))
+		source = "CHANNEL_SECRET_KEY_FILE"
+	}
+	if spec == "" {
+		SetChannelSecretKeyRing(nil)
+		logger.Logger.Warn("channel secret encryption disabled: set CHANNEL_SECRET_KEYS or CHANNEL_SECRET_KEY_FILE to encrypt channel credentials at rest")
+		return nil
+	}
+	ring, err := state.ParseKeyRing(spec)
+	if err != nil {
+		return errors.Wrapf(err, "parse %s", source)
+	}
+	SetChannelSecretKeyRing(ring)
+	logger.Logger.Info("channel secret encryption enabled",
+		zap.String("source", source),
+		zap.String("primary_key_version", ring.PrimaryVersion()))
+	return nil
+}
+
+// SetChannelSecretKeyRing replaces the channel secret master keys. A nil ring
+// disables encryption of newly written credentials.
+func SetChannelSecretKeyRing(ring *state.KeyRing) {
+	channelSecretRing.Store(ring)
+}
+
+// ChannelSecretEncryptionEnabled reports whether channel credentials are
+// encrypted when written.
+func ChannelSecretEncryptionEnabled() bool {
+	return channelSecretRing.Load() != nil
+}
+
+// sealChannelSecret encrypts one credential for storage. Empty values, values
+// that are already sealed, and every value while encryption is disabled are
+// returned unchanged.
+func sealChannelSecret(value string) (string, error) {
+	ring := channelSecretRing.Load()
+	if ring == nil || value == "" || state.IsSealed(value) {
+		return value, nil
+	}
+	sealed, err := ring.Seal(value)
+	if err != nil {
+		return "", errors.Wrap(err, "seal channel secret")
+	}
+	return sealed, nil
+}
+
+// OpenChannelSecret returns the plaintext of a stored channel credential.
+// Plaintext written before encryption was enabled is returned unchanged.
+//
+// Parameters:
+//   - value: the stored credential.
+//
+// Return values:
+//   - string: the plaintext credential.
+//   - error: when the value is sealed but no key ring is configured, or its key
+//     version is unknown, or the ciphertext is corrupt.
+func OpenChannelSecret(value string) (string, error) {
+	if !state.IsSealed(value) {
+		return value, nil
+	}
+	ring := channelSecretRing.Load()
+	if ring == nil {
+		return "", errors.New("channel secret is encrypted but CHANNEL_SECRET_KEYS is not configured")
+	}
+	plaintext, err := ring.Open(value)
+	if err != nil {
+		return "", errors.Wrap(err, "open channel secret")
+	}
+	return plaintext, nil
+}
+
+// secretFields lists the config fields that carry upstream credentials.
+func (cfg *ChannelConfig) secretFields() []*string {
+	return []*string{&cfg.SK, &cfg.AK, &cfg.VertexAIADC}
+}
+
+// OpenSecrets returns a copy of cfg whose credential fields are decrypted.
+//
+// Return values:
+//   - ChannelConfig: the decrypted copy.
+//   - error: the first OpenChannelSecret failure.
+func (cfg ChannelConfig) OpenSecrets() (ChannelConfig, error) {
+	for _, field := range cfg.secretFields() {
+		plaintext, err := OpenChannelSecret(*field)
+		if err != nil {
+			return cfg, err
+		}
+		*field = plaintext
+	}
+	return cfg, nil
+}
+
+// sealSecrets encrypts the channel key and the credential fields of its config
+// in place. It runs before every save, so no write path can store plaintext
+// once encryption is configured.
+func (channel *Channel) sealSecrets() error {
+	if !ChannelSecretEncryptionEnabled() {
+		return nil
+	}
+	sealed, err := sealChannelSecret(channel.Key)
+	if err != nil {
+		return err
+	}
+	channel.Key = sealed
+
+	if channel.Config == "" {
+		return nil
+	}
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		// Leave a config the model cannot parse untouched; validation elsewhere
+		// reports it.
+		return nil
+	}
+	changed := false
+	for _, field := range cfg.secretFields() {
+		sealed, err := sealChannelSecret(*field)
+		if err != nil {
+			return err
+		}
+		if sealed != *field {
+			*field = sealed
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return channel.storeConfig(cfg)
+}
+
+// BeforeSave encrypts the channel credentials before they are written.
+//
+// Parameters:
+//   - tx: GORM transaction supplied by the save callback.
+//
+// Return values:
+//   - error: non-nil when a credential cannot be sealed.
+func (channel *Channel) BeforeSave(tx *gorm.DB) error {
+	return channel.sealSecrets()
+}
+
+// BeforeSave records the masked preview of a plaintext pooled key and encrypts
+// the key before it is written.
+//
+// Parameters:
+//   - tx: GORM transaction supplied by the save callback.
+//
+// Return values:
+//   - error: non-nil when the key cannot be sealed.
+func (key *ChannelKey) BeforeSave(tx *gorm.DB) error {
+	if key.Key != "" && !state.IsSealed(key.Key) {
+		key.KeyPreview = helper.MaskAPIKey(key.Key)
+	}
+	sealed, err := sealChannelSecret(key.Key)
+	if err != nil {
+		return err
+	}
+	key.Key = sealed
+	return nil
+}
+
+// WithMaskedSecrets returns a copy of the channel whose key and config
+// credentials are replaced by the mask placeholder, for API responses.
+func (channel *Channel) WithMaskedSecrets() *Channel {
+	if channel == nil {
+		return nil
+	}
+	masked := *channel
+	masked.Key = common.MaskSecret(channel.Key)
+	if cfg, err := channel.LoadConfig(); err == nil {
+		for _, field := range cfg.secretFields() {
+			*field = common.MaskSecret(*field)
+		}
+		if err := masked.storeConfig(cfg); err != nil {
+			masked.Config = ""
+		}
+	} else {
+		masked.Config = ""
+	}
+	return &masked
+}
+
+// WithRevealedSecrets returns a copy of the channel whose key and config
+// credentials are decrypted.
+//
+// Return values:
+//   - *Channel: the decrypted copy.
+//   - error: the first OpenChannelSecret failure.
+func (channel *Channel) WithRevealedSecrets() (*Channel, error) {
+	revealed := *channel
+	key, err := OpenChannelSecret(channel.Key)
+	if err != nil {
+		return nil, err
+	}
+	revealed.Key = key
+	if revealed.Config == "" {
+		return &revealed, nil
+	}
+	cfg, err := revealed.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg, err = cfg.OpenSecrets(); err != nil {
+		return nil, err
+	}
+	if err := revealed.storeConfig(cfg); err != nil {
+		return nil, err
+	}
+	return &revealed, nil
+}
+
+// keepMaskedSecrets swaps mask placeholders that a client echoed back from a
+// masked response for the stored credentials, so saving an edited channel
+// never overwrites a secret with the mask.
+func (channel *Channel) keepMaskedSecrets(existing *Channel) error {
+	if common.IsMaskedSecret(channel.Key) {
+		channel.Key = existing.Key
+	}
+	if channel.Config == "" {
+		return nil
+	}
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return nil
+	}
+	stored, err := existing.LoadConfig()
+	if err != nil {
+		return err
+	}
+	storedFields := stored.secretFields()
+	changed := false
+	for i, field := range cfg.secretFields() {
+		if common.IsMaskedSecret(*field) {
+			*field = *storedFields[i]
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return channel.storeConfig(cfg)
+}
+
+// ChannelSecretStatus summarizes how stored channel credentials are protected.
+type ChannelSecretStatus struct {
+	// EncryptionEnabled reports whether a master key ring is configured.
+	EncryptionEnabled bool `json:"encryption_enabled"`
+	// PrimaryKeyVersion is the master key version that wraps new secrets.
+	PrimaryKeyVersion string `json:"primary_key_version"`
+	// Plaintext counts credentials that are stored unencrypted.
+	Plaintext int `json:"plaintext"`
+	// KeyVersions counts encrypted credentials per master key version.
+	KeyVersions map[string]int `json:"key_versions"`
+	// Job describes the latest re-encryption run, nil before the first one.
+	Job *ChannelSecretJob `json:"job"`
+}
+
+// ChannelSecretJob records the progress of a re-encryption run.
+type ChannelSecretJob struct {
+	Running    bool   `json:"running"`
+	StartedAt  int64  `json:"started_at"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+	Channels   int    `json:"channels"`
+	Keys       int    `json:"keys"`
+	Error      string `json:"error,omitempty"`
+}
+
+// channelSecretBatchSize bounds how many rows one re-encryption query reads.
+const channelSecretBatchSize = 200
+
+var (
+	channelSecretJobLock sync.Mutex
+	channelSecretJob     *ChannelSecretJob
+)
+
+// StartChannelSecretReencryption starts a background job that moves every
+// channel credential onto the primary master key: plaintext is sealed, and
+// sealed values under an older key get their data key rewrapped.
+//
+// Parameters:
+//   - ctx: detached context controlling the job.
+//
+// Return values:
+//   - error: errkind.InvalidRequestErr when encryption is not configured or a
+//     job is already running.
+func StartChannelSecretReencryption(ctx context.Context) error {
+	if !ChannelSecretEncryptionEnabled() {
+		return errkind.InvalidRequestErr(errors.New("channel secret encryption is not configured: set CHANNEL_SECRET_KEYS or CHANNEL_SECRET_KEY_FILE"))
+	}
+	channelSecretJobLock.Lock()
+	defer channelSecretJobLock.Unlock()
+	if channelSecretJob != nil && channelSecretJob.Running {
+		return errkind.InvalidRequestErr(errors.New("a channel secret re-encryption job is already running"))
+	}
+	job := &ChannelSecretJob{Running: true, StartedAt: helper.GetTimestamp()}
+	channelSecretJob = job
+	go func() {
+		channels, keys, err := ReencryptChannelSecrets(ctx)
+		channelSecretJobLock.Lock()
+		defer channelSecretJobLock.Unlock()
+		job.Running = false
+		job.FinishedAt = helper.GetTimestamp()
+		job.Channels = channels
+		job.Keys = keys
+		if err != nil {
+			job.Error = err.Error()
+			logger.Logger.Error("channel secret re-encryption failed", zap.Error(err))
+			return
+		}
+		logger.Logger.Info("channel secret re-encryption finished",
+			zap.Int("channels", channels), zap.Int("keys", keys))
+	}()
+	return nil
+}
+
+// ReencryptChannelSecrets moves every channel and pooled key credential onto
+// the primary master key, in id-ordered batches.
+//
+// Parameters:
+//   - ctx: context controlling the reads and writes.
+//
+// Return values:
+//   - int: number of channel rows rewritten.
+//   - int: number of pooled key rows rewritten.
+//   - error: wrapped database or decryption error.
+func ReencryptChannelSecrets(ctx context.Context) (int, int, error) {
+	ring := channelSecretRing.Load()
+	if ring == nil {
+		return 0, 0, errors.New("channel secret encryption is not configured")
+	}
+	channels := 0
+	lastId := 0
+	for {
+		var rows []*Channel
+		if err := DB.WithContext(ctx).Select("id", "key", "config").Where("id > ?", lastId).
+			Order("id").Limit(channelSecretBatchSize).Find(&rows).Error; err != nil {
+			return channels, 0, errors.Wrapf(err, "read channels after id %d", lastId)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		for _, row := range rows {
+			lastId = row.Id
+			updates, err := rewrapChannelRow(ring, row)
+			if err != nil {
+				return channels, 0, errors.Wrapf(err, "re-encrypt channel %d", row.Id)
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			if err := DB.WithContext(ctx).Model(&Channel{}).Where("id = ?", row.Id).
+				UpdateColumns(updates).Error; err != nil {
+				return channels, 0, errors.Wrapf(err, "save re-encrypted channel %d", row.Id)
+			}
+			channels++
+		}
+	}
+
+	keys := 0
+	lastId = 0
+	for {
+		var rows []*ChannelKey
+		if err := DB.WithContext(ctx).Select("id", "key").Where("id > ?", lastId).
+			Order("id").Limit(channelSecretBatchSize).Find(&rows).Error; err != nil {
+			return channels, keys, errors.Wrapf(err, "read channel keys after id %d", lastId)
+		}
+		if len(rows) == 0 {
+			break
+		}
+		for _, row := range rows {
+			lastId = row.Id
+			rewrapped, changed, err := ring.Rewrap(row.Key)
+			if err != nil {
+				return channels, keys, errors.Wrapf(err, "re-encrypt channel key %d", row.Id)
+			}
+			if !changed {
+				continue
+			}
+			updates := map[string]any{"key": rewrapped}
+			if !state.IsSealed(row.Key) {
+				updates["key_preview"] = helper.MaskAPIKey(row.Key)
+			}
+			if err := DB.WithContext(ctx).Model(&ChannelKey{}).Where("id = ?", row.Id).
+				UpdateColumns(updates).Error; err != nil {
+				return channels, keys, errors.Wrapf(err, "save re-encrypted channel key %d", row.Id)
+			}
+			keys++
+		}
+	}
+
+	if channels > 0 || keys > 0 {
+		InitChannelCache()
+	}
+	return channels, keys, nil
+}
+
+// rewrapChannelRow returns the column updates that move one channel's
+// credentials onto the primary key; it is empty when nothing changes.
+func rewrapChannelRow(ring *state.KeyRing, row *Channel) (map[string]any, error) {
+	updates := map[string]any{}
+	key, changed, err := ring.Rewrap(row.Key)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		updates["key"] = key
+	}
+	if row.Config == "" {
+		return updates, nil
+	}
+	cfg, err := row.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	configChanged := false
+	for _, field := range cfg.secretFields() {
+		rewrapped, changed, err := ring.Rewrap(*field)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			*field = rewrapped
+			configChanged = true
+		}
+	}
+	if configChanged {
+		if err := row.storeConfig(cfg); err != nil {
+			return nil, err
+		}
+		updates["config"] = row.Config
+	}
+	return updates, nil
+}
+
+// GetChannelSecretStatus counts stored credentials by protection state and
+// reports the latest re-encryption job.
+//
+// Parameters:
+//   - ctx: context controlling the reads.
+//
+// Return values:
+//   - *ChannelSecretStatus: the summary.
+//   - error: wrapped database error.
+func GetChannelSecretStatus(ctx context.Context) (*ChannelSecretStatus, error) {
+	status := &ChannelSecretStatus{KeyVersions: map[string]int{}}
+	if ring := channelSecretRing.Load(); ring != nil {
+		status.EncryptionEnabled = true
+		status.PrimaryKeyVersion = ring.PrimaryVersion()
+	}
+	count := func(value string) {
+		switch {
+		case value == "":
+		case state.IsSealed(value):
+			status.KeyVersions[state.KeyVersion(value)]++
+		default:
+			status.Plaintext++
+		}
+	}
+
+	var channels []*Channel
+	if err := DB.WithContext(ctx).Select("id", "key", "config").Find(&channels).Error; err != nil {
+		return nil, errors.Wrap(err, "read channel secrets")
+	}
+	for _, channel := range channels {
+		count(channel.Key)
+		if cfg, err := channel.LoadConfig(); err == nil {
+			for _, field := range cfg.secretFields() {
+				count(*field)
+			}
+		}
+	}
+	var keys []string
+	if err := DB.WithContext(ctx).Model(&ChannelKey{}).Pluck("key", &keys).Error; err != nil {
+		return nil, errors.Wrap(err, "read channel key secrets")
+	}
+	for _, key := range keys {
+		count(key)
+	}
+
+	channelSecretJobLock.Lock()
+	if channelSecretJob != nil {
+		job := *channelSecretJob
+		status.Job = &job
+	}
+	channelSecretJobLock.Unlock()
+	return status, nil
+}
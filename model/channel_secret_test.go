@@ -0,0 +1,174 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/relay/state"
+)
+
+const (
+	testChannelSecretKeyV1 = "v1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	testChannelSecretKeyV2 = "v2:ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+// withChannelSecretKeyRing installs the key ring parsed from spec for one test;
+// an empty spec disables encryption.
+func withChannelSecretKeyRing(t *testing.T, spec string) {
+	t.Helper()
+	original := channelSecretRing.Load()
+	var ring *state.KeyRing
+	if spec != "" {
+		var err error
+		ring, err = state.ParseKeyRing(spec)
+		require.NoError(t, err)
+	}
+	SetChannelSecretKeyRing(ring)
+	t.Cleanup(func() { SetChannelSecretKeyRing(original) })
+}
+
+// rawChannelSecrets reads the stored key and config of a channel, bypassing hooks.
+func rawChannelSecrets(t *testing.T, id int) (string, ChannelConfig) {
+	t.Helper()
+	row := &Channel{}
+	require.NoError(t, DB.Select("id", "key", "config").First(row, "id = ?", id).Error)
+	cfg, err := row.LoadConfig()
+	require.NoError(t, err)
+	return row.Key, cfg
+}
+
+func TestChannelSecretsSealedAtRest(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	withChannelSecretKeyRing(t, testChannelSecretKeyV1)
+
+	channel := &Channel{Name: "secret", Key: "sk-upstream-secret", Status: ChannelStatusEnabled, Models: "gpt-4o", Group: "default"}
+	require.NoError(t, channel.storeConfig(ChannelConfig{Region: "us-east-1", AK: "AKIAEXAMPLE", SK: "aws-secret"}))
+	require.NoError(t, DB.Create(channel).Error)
+
+	key, cfg := rawChannelSecrets(t, channel.Id)
+	require.True(t, state.IsSealed(key))
+	require.True(t, state.IsSealed(cfg.AK))
+	require.True(t, state.IsSealed(cfg.SK))
+	require.Equal(t, "us-east-1", cfg.Region, "non-secret config fields stay readable")
+	require.Equal(t, "v1", state.KeyVersion(key))
+
+	plaintext, err := OpenChannelSecret(key)
+	require.NoError(t, err)
+	require.Equal(t, "sk-upstream-secret", plaintext)
+	opened, err := cfg.OpenSecrets()
+	require.NoError(t, err)
+	require.Equal(t, "AKIAEXAMPLE", opened.AK)
+	require.Equal(t, "aws-secret", opened.SK)
+
+	stored := &Channel{}
+	require.NoError(t, DB.First(stored, "id = ?", channel.Id).Error)
+	revealed, err := stored.WithRevealedSecrets()
+	require.NoError(t, err)
+	require.Equal(t, "sk-upstream-secret", revealed.Key)
+
+	masked := stored.WithMaskedSecrets()
+	require.True(t, common.IsMaskedSecret(masked.Key))
+	maskedCfg, err := masked.LoadConfig()
+	require.NoError(t, err)
+	require.True(t, common.IsMaskedSecret(maskedCfg.SK))
+	require.True(t, common.IsMaskedSecret(maskedCfg.AK))
+	require.Equal(t, "us-east-1", maskedCfg.Region)
+	require.Equal(t, key, stored.Key, "masking returns a copy")
+
+	withChannelSecretKeyRing(t, "")
+	_, err = OpenChannelSecret(key)
+	require.Error(t, err, "a sealed value cannot be opened without the key ring")
+	plaintext, err = OpenChannelSecret("sk-legacy")
+	require.NoError(t, err)
+	require.Equal(t, "sk-legacy", plaintext, "legacy plaintext passes through")
+}
+
+func TestChannelKeepMaskedSecrets(t *testing.T) {
+	existing := &Channel{Key: "enc:v1:stored-key"}
+	require.NoError(t, existing.storeConfig(ChannelConfig{AK: "stored-ak", SK: "stored-sk"}))
+
+	update := &Channel{Key: common.MaskSecret("x")}
+	require.NoError(t, update.storeConfig(ChannelConfig{AK: "new-ak", SK: common.MaskSecret("x")}))
+	require.NoError(t, update.keepMaskedSecrets(existing))
+
+	require.Equal(t, existing.Key, update.Key)
+	cfg, err := update.LoadConfig()
+	require.NoError(t, err)
+	require.Equal(t, "new-ak", cfg.AK)
+	require.Equal(t, "stored-sk", cfg.SK)
+}
+
+func TestChannelKeyPoolSealedAtRest(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	withChannelSecretKeyRing(t, testChannelSecretKeyV1)
+	ctx := context.Background()
+	channel := newPooledChannel(t, KeySelectionRoundRobin, "sk-pool-key-000001", "sk-pool-key-000002")
+
+	added, err := AddChannelKeys(ctx, channel.Id, []string{"sk-pool-key-000002", "sk-pool-key-000003"})
+	require.NoError(t, err)
+	require.Len(t, added, 1, "duplicates are detected against decrypted keys")
+
+	keys, err := GetChannelKeys(ctx, channel.Id)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+	for _, key := range keys {
+		require.True(t, state.IsSealed(key.Key))
+	}
+	require.Equal(t, "sk-poo...0001", keys[0].ToResponse().MaskedKey)
+}
+
+func TestReencryptChannelSecrets(t *testing.T) {
+	setupChannelKeyTestDB(t)
+	ctx := context.Background()
+
+	// Rows written before encryption was configured stay plaintext.
+	withChannelSecretKeyRing(t, "")
+	channel := &Channel{Name: "legacy", Key: "sk-legacy-secret", Status: ChannelStatusEnabled, Models: "gpt-4o", Group: "default"}
+	require.NoError(t, channel.storeConfig(ChannelConfig{SK: "legacy-sk"}))
+	require.NoError(t, DB.Create(channel).Error)
+	require.NoError(t, DB.Create(&ChannelKey{ChannelId: channel.Id, Key: "sk-legacy-pool"}).Error)
+
+	withChannelSecretKeyRing(t, testChannelSecretKeyV1)
+	status, err := GetChannelSecretStatus(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, status.Plaintext)
+
+	channels, keys, err := ReencryptChannelSecrets(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, channels)
+	require.Equal(t, 1, keys)
+	key, cfg := rawChannelSecrets(t, channel.Id)
+	require.Equal(t, "v1", state.KeyVersion(key))
+	require.Equal(t, "v1", state.KeyVersion(cfg.SK))
+
+	// Rotating to v2 rewraps every value; v1 stays configured for reading.
+	withChannelSecretKeyRing(t, testChannelSecretKeyV2+","+testChannelSecretKeyV1)
+	channels, keys, err = ReencryptChannelSecrets(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, channels)
+	require.Equal(t, 1, keys)
+
+	status, err = GetChannelSecretStatus(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, status.Plaintext)
+	require.Equal(t, map[string]int{"v2": 3}, status.KeyVersions)
+
+	// After rotation the old key can be dropped.
+	withChannelSecretKeyRing(t, testChannelSecretKeyV2)
+	key, cfg = rawChannelSecrets(t, channel.Id)
+	plaintext, err := OpenChannelSecret(key)
+	require.NoError(t, err)
+	require.Equal(t, "sk-legacy-secret", plaintext)
+	opened, err := cfg.OpenSecrets()
+	require.NoError(t, err)
+	require.Equal(t, "legacy-sk", opened.SK)
+
+	// A second run finds nothing to do.
+	channels, keys, err = ReencryptChannelSecrets(ctx)
+	require.NoError(t, err)
+	require.Zero(t, channels)
+	require.Zero(t, keys)
+}
@@ -905,3 +905,29 @@ func TestChannel_validateModelPriceConfigs(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+// TestModelPriceConfigsSupportedFeatures verifies capability flags are normalized
+// and count as meaningful configuration on their own.
+func TestModelPriceConfigsSupportedFeatures(t *testing.T) {
+	channel := &Channel{}
+	err := channel.SetModelPriceConfigs(map[string]ModelConfigLocal{
+		"ernie-4.0": {SupportedFeatures: []string{" Tools ", "structured_outputs_emulation", "tools", ""}},
+	})
+	require.NoError(t, err)
+
+	cfg := channel.GetModelPriceConfigs()["ernie-4.0"]
+	require.Equal(t, []string{"tools", "structured_outputs_emulation"}, cfg.SupportedFeatures)
+}
+
+func TestModelPriceConfigsContextWindow(t *testing.T) {
+	channel := &Channel{}
+	require.NoError(t, channel.SetModelPriceConfigs(map[string]ModelConfigLocal{
+		"llama3:8b": {ContextLength: 8192, MaxOutputTokens: 2048},
+	}))
+	cfg := channel.GetModelPriceConfigs()["llama3:8b"]
+	require.Equal(t, int32(8192), cfg.ContextLength)
+	require.Equal(t, int32(2048), cfg.MaxOutputTokens)
+
+	err := channel.SetModelPriceConfigs(map[string]ModelConfigLocal{"llama3:8b": {ContextLength: -1}})
+	require.ErrorContains(t, err, "negative context_length")
+}
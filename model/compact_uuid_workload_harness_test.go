@@ -204,7 +204,7 @@ func compactWorkloadInsert(ctx context.Context, db *gorm.DB, table string,
 		err = handle.Exec("INSERT INTO users (id, username, password, uuid, status) VALUES (?, ?, 'x', ?, ?)",
 			id, fmt.Sprintf("wk-user-%d-%d", worker, seq), uuid, 1+seq%2).Error
 	case "tokens":
-		err = handle.Exec("INSERT INTO tokens (id, user_id, key, name, uuid) VALUES (?, 1, ?, 'wk', ?)",
+		err = handle.Exec("INSERT INTO tokens (id, user_id, key_hash, name, uuid) VALUES (?, 1, ?, 'wk', ?)",
 			id, fmt.Sprintf("wk-token-%d-%d", worker, seq), uuid).Error
 	case "channels":
 		err = handle.Exec("INSERT INTO channels (id, name, uuid) VALUES (?, ?, ?)",
@@ -55,6 +55,8 @@ type Log struct {
 	CachedPromptTokens int `json:"cached_prompt_tokens" gorm:"default:0;index"`
 	// Metadata holds provider-specific attributes serialized as JSON (e.g., cache write tokens).
 	Metadata LogMetadata `json:"metadata,omitempty" gorm:"type:text"`
+	// OrgId is the organization that paid for the entry, 0 for personal spend.
+	OrgId int `json:"org_id,omitempty" gorm:"index;default:0"`
 }
 
 // LogMetadata stores structured provider-specific attributes associated with a log entry.
@@ -146,11 +148,29 @@ const (
 	LogMetadataKeyUpstreamAPIFormat = "upstream_api_format"
 	// LogMetadataKeyUpstreamEndpoint records the final URL sent to the upstream provider.
 	LogMetadataKeyUpstreamEndpoint = "upstream_endpoint"
+	// LogMetadataKeyServedModel records the fallback model that answered when it
+	// differs from the requested origin model.
+	LogMetadataKeyServedModel = "served_model"
 	// LogMetadataKeyEstimatedCharge marks a consume log whose quota is the
 	// pre-consumed estimate rather than measured usage, because the upstream
 	// reported none. The charge is real and already debited; the flag tells an
 	// operator the token counts on the row are not authoritative.
 	LogMetadataKeyEstimatedCharge = "estimated_charge"
+	// LogMetadataKeyResponseCacheHit marks a consume log whose response was
+	// served from the exact-match response cache and billed at the cache-hit ratio.
+	LogMetadataKeyResponseCacheHit = "response_cache_hit"
+	// LogMetadataKeyGuardrail lists the guardrail violations found on the
+	// request or response, each with its stage, filter, action and detail.
+	LogMetadataKeyGuardrail = "guardrail"
+	// LogMetadataKeyContextFit describes how an oversized conversation was
+	// fitted into the model context window.
+	LogMetadataKeyContextFit = "context_fit"
+	// LogMetadataKeyParentRequestId links an in-process sub-request, such as a
+	// context summary, to the client request it was made for.
+	LogMetadataKeyParentRequestId = "parent_request_id"
+	// LogMetadataKeyRefundedQuota records the pre-consumed quota returned when
+	// a consume log is voided by a refund.
+	LogMetadataKeyRefundedQuota = "refunded_quota"
 )
 
 // ToolUsageEntry captures per-tool usage metadata for logging.
@@ -641,6 +661,23 @@ func RecordTopupLog(ctx context.Context, userId int, content string, quota int)
 	recordLogHelper(ctx, log)
 }
 
+// RecordOrgLog writes a top-up or manage entry against an organization's
+// pool. The acting user is recorded as well, so the entry shows up in both the
+// organization's and the user's logs.
+func RecordOrgLog(ctx context.Context, orgId int, userId int, logType int, content string, quota int64) {
+	log := &Log{
+		UserId:    userId,
+		OrgId:     orgId,
+		Username:  GetUsernameById(userId),
+		CreatedAt: helper.GetTimestamp(),
+		Type:      logType,
+		Content:   content,
+		Quota:     int(quota),
+	}
+	FillLogUserUUIDByID(ctx, log)
+	recordLogHelper(ctx, log)
+}
+
 // RecordTopupLogWithIDs records a topup log with explicit requestId/traceId.
 func RecordTopupLogWithIDs(ctx context.Context, userId int, content string, quota int, requestId string, traceId string) {
 	log := &Log{
@@ -658,13 +695,15 @@ func RecordTopupLogWithIDs(ctx context.Context, userId int, content string, quot
 }
 
 // RecordConsumeLog stores a model consumption log and populates audit fields automatically.
+// The usage event is exported even when consume logging is disabled.
 func RecordConsumeLog(ctx context.Context, log *Log) {
+	log.CreatedAt = helper.GetTimestamp()
+	log.Type = LogTypeConsume
+	defer publishUsageEvent(log)
 	if !config.IsLogConsumeEnabled() {
 		return
 	}
 	log.Username = GetUsernameById(log.UserId)
-	log.CreatedAt = helper.GetTimestamp()
-	log.Type = LogTypeConsume
 	recordLogHelper(ctx, log)
 }
 
@@ -682,6 +721,16 @@ func RecordToolLog(ctx context.Context, log *Log) {
 	recordLogHelper(ctx, log)
 }
 
+// RecordGuardrailLog stores a LogTypeSystem row for a relay request rejected
+// by a guardrail policy. Nothing was forwarded or charged, so the row carries
+// no quota; the violations are in Metadata under LogMetadataKeyGuardrail.
+func RecordGuardrailLog(ctx context.Context, log *Log) {
+	log.Username = GetUsernameById(log.UserId)
+	log.CreatedAt = helper.GetTimestamp()
+	log.Type = LogTypeSystem
+	recordLogHelper(ctx, log)
+}
+
 // RecordToolLogs emits one LogTypeTool row per tool invocation captured in the
 // provided summary. Billing/audit fields are inherited from base, but
 // model-specific fields (model_name, quota, prompt/completion tokens) are
@@ -929,6 +978,7 @@ func ReconcileConsumeLogDetailed(ctx context.Context, logID int, detail ConsumeL
 		zap.Int("completion_tokens", detail.CompletionTokens),
 		zap.Int("cached_prompt_tokens", detail.CachedPromptTokens),
 	)
+	publishReconciledUsageEvent(ctx, logID)
 	return nil
 }
 
@@ -1074,25 +1124,7 @@ func GetAllLogsCount(logType int, startTimestamp int64, endTimestamp int64, mode
 
 // GetUserLogs lists logs belonging to a specific user with optional filtering and ordering.
 func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, sortBy string, sortOrder string) (logs []*Log, err error) {
-	var tx *gorm.DB
-	if logType == LogTypeUnknown {
-		tx = LOG_DB.Where("user_id = ?", userId)
-	} else {
-		tx = LOG_DB.Where("user_id = ? and type = ?", userId, logType)
-	}
-	if modelName != "" {
-		tx = tx.Where("model_name = ?", modelName)
-	}
-	if tokenName != "" {
-		tx = tx.Where("token_name = ?", tokenName)
-	}
-	if startTimestamp != 0 {
-		tx = tx.Where("created_at >= ?", startTimestamp)
-	}
-	if endTimestamp != 0 {
-		tx = tx.Where("created_at <= ?", endTimestamp)
-	}
-	tx = excludeProvisionalScope(tx)
+	tx := ownerLogsScope("user_id", userId, logType, startTimestamp, endTimestamp, modelName, tokenName)
 
 	// Apply sorting with timeout for sorting queries
 	orderClause := GetLogOrderClause(sortBy, sortOrder)
@@ -1114,11 +1146,21 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 
 // GetUserLogsCount provides the number of logs for a user that satisfy the given filters.
 func GetUserLogsCount(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string) (count int64, err error) {
-	var tx *gorm.DB
-	if logType == LogTypeUnknown {
-		tx = LOG_DB.Where("user_id = ?", userId)
-	} else {
-		tx = LOG_DB.Where("user_id = ? and type = ?", userId, logType)
+	tx := ownerLogsScope("user_id", userId, logType, startTimestamp, endTimestamp, modelName, tokenName)
+	err = tx.Model(&Log{}).Count(&count).Error
+	if err != nil {
+		return 0, identity.Tag(errors.Wrapf(err, "count user %d logs", userId), LookupUserRef(context.Background(), userId))
+	}
+	return count, nil
+}
+
+// ownerLogsScope selects the non-provisional logs whose ownerColumn ("user_id"
+// or "org_id") equals id, narrowed by the filters shared by the self and
+// organization log listings. A zero filter value disables that filter.
+func ownerLogsScope(ownerColumn string, id int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string) *gorm.DB {
+	tx := LOG_DB.Where(ownerColumn+" = ?", id)
+	if logType != LogTypeUnknown {
+		tx = tx.Where("type = ?", logType)
 	}
 	if modelName != "" {
 		tx = tx.Where("model_name = ?", modelName)
@@ -1132,11 +1174,33 @@ func GetUserLogsCount(userId int, logType int, startTimestamp int64, endTimestam
 	if endTimestamp != 0 {
 		tx = tx.Where("created_at <= ?", endTimestamp)
 	}
-	tx = excludeProvisionalScope(tx)
+	return excludeProvisionalScope(tx)
+}
 
-	err = tx.Model(&Log{}).Count(&count).Error
-	if err != nil {
-		return 0, identity.Tag(errors.Wrapf(err, "count user %d logs", userId), LookupUserRef(context.Background(), userId))
+// GetOrgLogs lists the logs paid by an organization, with the filters and
+// sorting of GetUserLogs.
+func GetOrgLogs(orgId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, sortBy string, sortOrder string) (logs []*Log, err error) {
+	tx := ownerLogsScope("org_id", orgId, logType, startTimestamp, endTimestamp, modelName, tokenName)
+	orderClause := GetLogOrderClause(sortBy, sortOrder)
+	if sortBy != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		tx = tx.WithContext(ctx)
+	}
+	if err = tx.Order(orderClause).Limit(num).Offset(startIdx).Find(&logs).Error; err != nil {
+		return nil, errors.Wrapf(err, "get organization %d logs", orgId)
+	}
+	if err := fillLogChannelNames(logs); err != nil {
+		return nil, errors.Wrapf(err, "fill organization %d log channel names", orgId)
+	}
+	return logs, nil
+}
+
+// GetOrgLogsCount provides the number of organization logs that satisfy the given filters.
+func GetOrgLogsCount(orgId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string) (count int64, err error) {
+	tx := ownerLogsScope("org_id", orgId, logType, startTimestamp, endTimestamp, modelName, tokenName)
+	if err = tx.Model(&Log{}).Count(&count).Error; err != nil {
+		return 0, errors.Wrapf(err, "count organization %d logs", orgId)
 	}
 	return count, nil
 }
@@ -1218,6 +1282,33 @@ func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelNa
 	return quota
 }
 
+// SumOrgUsedQuota returns the quota an organization paid within the filter
+// scope, mirroring SumUsedQuota for one organization.
+func SumOrgUsedQuota(orgId int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, channel int) (quota int64) {
+	ifnull := "ifnull"
+	if common.UsingPostgreSQL.Load() {
+		ifnull = "COALESCE"
+	}
+	tx := LOG_DB.Table("logs").Select(fmt.Sprintf("%s(sum(quota),0)", ifnull)).Where("org_id = ?", orgId)
+	if tokenName != "" {
+		tx = tx.Where("token_name = ?", tokenName)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if channel != 0 {
+		tx = tx.Where("channel_id = ?", channel)
+	}
+	tx.Where("type = ?", LogTypeConsume).Scan(&quota)
+	return quota
+}
+
 // SumUsedToken returns the total number of prompt and completion tokens consumed within the filter scope.
 func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string) (token int) {
 	ifnull := "ifnull"
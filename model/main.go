@@ -303,6 +303,10 @@ func initPrimaryDatabase() error {
 		return errors.Wrap(err, "migrate custom channels")
 	}
 
+	if err = MigrateTokenKeysToHash(context.Background()); err != nil {
+		return errors.Wrap(err, "migrate token keys to hashes")
+	}
+
 	if err = MigrateAllChannelModelConfigs(); err != nil {
 		logger.Logger.Error("failed to migrate channel ModelConfigs", zap.Error(err))
 		// Don't fail startup for this migration, just log the error
@@ -340,6 +344,24 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Ability{}); err != nil {
 		return errors.Wrapf(err, "failed to migrate Ability")
 	}
+	if err = DB.AutoMigrate(&ChannelKey{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate ChannelKey")
+	}
+	if err = DB.AutoMigrate(&Organization{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate Organization")
+	}
+	if err = DB.AutoMigrate(&OrganizationMember{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate OrganizationMember")
+	}
+	if err = DB.AutoMigrate(&RelayFile{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate RelayFile")
+	}
+	if err = DB.AutoMigrate(&RelayBatch{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate RelayBatch")
+	}
+	if err = DB.AutoMigrate(&RelayBatchItem{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate RelayBatchItem")
+	}
 	// In split mode LOG_DB is the only authoritative owner of logs, so the primary must not
 	// gain or keep evolving a stale logs table. migrateLOGDB owns that schema instead. A
 	// logs table left over from a unified deployment is simply ignored; every log read and
@@ -358,6 +380,12 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Trace{}); err != nil {
 		return errors.Wrapf(err, "failed to migrate Trace")
 	}
+	if err = DB.AutoMigrate(&CaptureRule{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate CaptureRule")
+	}
+	if err = DB.AutoMigrate(&RequestCapture{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate RequestCapture")
+	}
 	if err = DB.AutoMigrate(&AsyncTaskBinding{}); err != nil {
 		return errors.Wrapf(err, "failed to migrate AsyncTaskBinding")
 	}
@@ -378,6 +406,15 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&StripeWebhookEvent{}); err != nil {
 		return errors.Wrapf(err, "failed to migrate StripeWebhookEvent")
 	}
+	if err = DB.AutoMigrate(&Subscription{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate Subscription")
+	}
+	if err = DB.AutoMigrate(&SubscriptionGrant{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate SubscriptionGrant")
+	}
+	if err = DB.AutoMigrate(&FrozenStatement{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate FrozenStatement")
+	}
 	if err = DB.AutoMigrate(&DataMigration{}); err != nil {
 		return errors.Wrapf(err, "failed to migrate DataMigration")
 	}
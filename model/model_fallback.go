@@ -0,0 +1,97 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/Laisky/one-api/common/logger"
+)
+
+var modelFallbackChainsLock sync.RWMutex
+
+// modelFallbackChains maps a requested model to the ordered models the relay may
+// degrade to once every channel for it is exhausted, e.g.
+// {"gpt-5": ["gpt-5-mini", "claude-sonnet-4"]}. It is loaded from the
+// ModelFallbackChains option.
+var modelFallbackChains = map[string][]string{}
+
+// ParseModelFallbackChains decodes and validates a ModelFallbackChains option value.
+// An empty value clears every chain.
+//
+// Parameters:
+//   - jsonStr: JSON object mapping a model name to its ordered fallback models.
+//
+// Returns:
+//   - map[string][]string: the normalized chains, with names trimmed and empty chains dropped.
+//   - error: when the JSON is malformed, a name is blank, a chain lists a model twice,
+//     or a chain falls back to its own model.
+func ParseModelFallbackChains(jsonStr string) (map[string][]string, error) {
+	chains := map[string][]string{}
+	if strings.TrimSpace(jsonStr) == "" {
+		return chains, nil
+	}
+
+	var raw map[string][]string
+	if err := json.Unmarshal([]byte(jsonStr), &raw); err != nil {
+		return nil, errors.Wrap(err, "unmarshal model fallback chains")
+	}
+	for from, to := range raw {
+		from = strings.TrimSpace(from)
+		if from == "" {
+			return nil, errors.New("model fallback chain has an empty model name")
+		}
+		chain := make([]string, 0, len(to))
+		for _, name := range to {
+			name = strings.TrimSpace(name)
+			switch {
+			case name == "":
+				return nil, errors.Errorf("model fallback chain for %q has an empty model name", from)
+			case name == from:
+				return nil, errors.Errorf("model fallback chain for %q falls back to itself", from)
+			case slices.Contains(chain, name):
+				return nil, errors.Errorf("model fallback chain for %q lists %q twice", from, name)
+			}
+			chain = append(chain, name)
+		}
+		if len(chain) > 0 {
+			chains[from] = chain
+		}
+	}
+	return chains, nil
+}
+
+// ModelFallbackChains2JSONString serializes the active fallback chains for OptionMap.
+func ModelFallbackChains2JSONString() string {
+	modelFallbackChainsLock.RLock()
+	defer modelFallbackChainsLock.RUnlock()
+	jsonBytes, err := json.Marshal(modelFallbackChains)
+	if err != nil {
+		logger.Logger.Error("error marshalling model fallback chains", zap.Error(err))
+	}
+	return string(jsonBytes)
+}
+
+// UpdateModelFallbackChainsByJSONString replaces the active fallback chains.
+func UpdateModelFallbackChainsByJSONString(jsonStr string) error {
+	chains, err := ParseModelFallbackChains(jsonStr)
+	if err != nil {
+		return errors.Wrap(err, "update model fallback chains")
+	}
+	modelFallbackChainsLock.Lock()
+	defer modelFallbackChainsLock.Unlock()
+	modelFallbackChains = chains
+	return nil
+}
+
+// GetModelFallbackChain returns a copy of the fallback models configured for
+// modelName, in the order they should be tried, or nil when none are configured.
+func GetModelFallbackChain(modelName string) []string {
+	modelFallbackChainsLock.RLock()
+	defer modelFallbackChainsLock.RUnlock()
+	return slices.Clone(modelFallbackChains[modelName])
+}
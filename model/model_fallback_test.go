@@ -0,0 +1,41 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModelFallbackChains(t *testing.T) {
+	chains, err := ParseModelFallbackChains(`{" gpt-5 ":["gpt-5-mini"," claude-sonnet-4"],"o3":[]}`)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{"gpt-5": {"gpt-5-mini", "claude-sonnet-4"}}, chains)
+
+	chains, err = ParseModelFallbackChains("  ")
+	require.NoError(t, err)
+	require.Empty(t, chains)
+
+	for _, bad := range []string{
+		`not json`,
+		`{"":["gpt-5-mini"]}`,
+		`{"gpt-5":[""]}`,
+		`{"gpt-5":["gpt-5"]}`,
+		`{"gpt-5":["gpt-5-mini","gpt-5-mini"]}`,
+	} {
+		_, err := ParseModelFallbackChains(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestUpdateModelFallbackChains(t *testing.T) {
+	t.Cleanup(func() { _ = UpdateModelFallbackChainsByJSONString("") })
+
+	require.NoError(t, UpdateModelFallbackChainsByJSONString(`{"gpt-5":["gpt-5-mini"]}`))
+	require.Equal(t, []string{"gpt-5-mini"}, GetModelFallbackChain("gpt-5"))
+	require.Nil(t, GetModelFallbackChain("gpt-5-mini"))
+	require.JSONEq(t, `{"gpt-5":["gpt-5-mini"]}`, ModelFallbackChains2JSONString())
+
+	// An invalid value keeps the previous chains.
+	require.Error(t, UpdateModelFallbackChainsByJSONString(`{"gpt-5":["gpt-5"]}`))
+	require.Equal(t, []string{"gpt-5-mini"}, GetModelFallbackChain("gpt-5"))
+}
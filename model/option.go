@@ -12,6 +12,7 @@ import (
 	"github.com/Laisky/one-api/common/config"
 	"github.com/Laisky/one-api/common/logger"
 	billingratio "github.com/Laisky/one-api/relay/billing/ratio"
+	"github.com/Laisky/one-api/relay/guardrail"
 )
 
 // Option stores one runtime configuration value by key.
@@ -52,6 +53,7 @@ func InitOptionMap() {
 	config.OptionMap["DisplayInCurrencyEnabled"] = strconv.FormatBool(config.DisplayInCurrencyEnabled)
 	config.OptionMap["DisplayTokenStatEnabled"] = strconv.FormatBool(config.DisplayTokenStatEnabled)
 	config.OptionMap["ChannelDisableThreshold"] = strconv.FormatFloat(config.ChannelDisableThreshold, 'f', -1, 64)
+	config.OptionMap["ChannelHealthMaxAdjustment"] = strconv.FormatFloat(config.ChannelHealthMaxAdjustment, 'f', -1, 64)
 	config.OptionMap["EmailDomainRestrictionEnabled"] = strconv.FormatBool(config.EmailDomainRestrictionEnabled)
 	config.OptionMap["EmailDomainWhitelist"] = strings.Join(config.EmailDomainWhitelist, ",")
 	config.OptionMap["SMTPServer"] = ""
@@ -95,6 +97,10 @@ func InitOptionMap() {
 	config.OptionMap["QuotaRemindThreshold"] = strconv.FormatInt(config.QuotaRemindThreshold, 10)
 	config.OptionMap["PreConsumedQuota"] = strconv.FormatInt(config.PreConsumedQuota, 10)
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
+	config.OptionMap["ModelFallbackChains"] = ModelFallbackChains2JSONString()
+	config.OptionMap["VirtualModels"] = VirtualModels2JSONString()
+	config.OptionMap["SubscriptionPlans"] = SubscriptionPlans2JSONString()
+	config.OptionMap["GuardrailPolicies"] = guardrail.Policies2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
@@ -315,12 +321,22 @@ func updateOptionMap(key string, value string) (err error) {
 		return nil
 	case "GroupRatio":
 		err = billingratio.UpdateGroupRatioByJSONString(value)
+	case "ModelFallbackChains":
+		err = UpdateModelFallbackChainsByJSONString(value)
+	case "VirtualModels":
+		err = UpdateVirtualModelsByJSONString(value)
+	case "SubscriptionPlans":
+		err = UpdateSubscriptionPlansByJSONString(value)
+	case "GuardrailPolicies":
+		err = guardrail.UpdatePoliciesByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
 		config.ChatLink = value
 	case "ChannelDisableThreshold":
 		config.ChannelDisableThreshold, _ = strconv.ParseFloat(value, 64)
+	case "ChannelHealthMaxAdjustment":
+		config.ChannelHealthMaxAdjustment, _ = strconv.ParseFloat(strings.TrimSpace(value), 64)
 	case "QuotaPerUnit":
 		config.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
 	case "Theme":
@@ -331,7 +347,7 @@ func updateOptionMap(key string, value string) (err error) {
 		config.Theme = value
 	}
 	if err != nil {
-		return errors.Wrap(err, "update group ratio configuration")
+		return errors.Wrapf(err, "update option %q", key)
 	}
 	return nil
 }
@@ -0,0 +1,516 @@
+package model
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/common/logger"
+)
+
+const (
+	OrganizationStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	OrganizationStatusDisabled = 2
+)
+
+const (
+	// OrgRoleOwner manages the organization itself, including its admins,
+	// status and deletion.
+	OrgRoleOwner = "owner"
+	// OrgRoleAdmin manages members, viewers and every organization token.
+	OrgRoleAdmin = "admin"
+	// OrgRoleMember creates and uses organization tokens and may contribute
+	// personal quota to the pool.
+	OrgRoleMember = "member"
+	// OrgRoleViewer may only read the organization, its members, logs and stats.
+	OrgRoleViewer = "viewer"
+)
+
+// orgRoleRank orders organization roles; a higher rank includes every
+// permission of the lower ones.
+var orgRoleRank = map[string]int{
+	OrgRoleViewer: 1,
+	OrgRoleMember: 2,
+	OrgRoleAdmin:  3,
+	OrgRoleOwner:  4,
+}
+
+// IsValidOrgRole reports whether role is one of the organization roles.
+func IsValidOrgRole(role string) bool {
+	_, ok := orgRoleRank[role]
+	return ok
+}
+
+// OrgRoleAtLeast reports whether role grants at least the permissions of min.
+// Unknown roles grant nothing.
+func OrgRoleAtLeast(role, min string) bool {
+	rank, ok := orgRoleRank[role]
+	return ok && rank >= orgRoleRank[min]
+}
+
+// Organization is a team of users sharing one quota pool. Tokens owned by an
+// organization (Token.OrgId) are charged against Organization.Quota instead of
+// the quota of the member who created them.
+type Organization struct {
+	Id           int    `json:"id"`
+	UUID         string `json:"uuid" gorm:"type:char(36);column:uuid;index"`
+	Name         string `json:"name" gorm:"type:varchar(64);index"`
+	Status       int    `json:"status" gorm:"default:1"`
+	Quota        int64  `json:"quota" gorm:"bigint;default:0"`
+	UsedQuota    int64  `json:"used_quota" gorm:"bigint;default:0"`
+	RequestCount int    `json:"request_count" gorm:"default:0"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
+	UpdatedAt    int64  `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
+}
+
+// BeforeCreate assigns a server-generated UUID to an organization before insertion.
+func (org *Organization) BeforeCreate(tx *gorm.DB) error {
+	return ensureUUID(&org.UUID)
+}
+
+// OrganizationMember grants one user a role in one organization.
+type OrganizationMember struct {
+	Id        int    `json:"-"`
+	OrgId     int    `json:"-" gorm:"uniqueIndex:idx_org_member_user,priority:1;not null"`
+	UserId    int    `json:"-" gorm:"uniqueIndex:idx_org_member_user,priority:2;index;not null"`
+	Role      string `json:"role" gorm:"type:varchar(16);not null"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
+}
+
+// OrganizationMemberDetail is a membership joined with the member's user row.
+type OrganizationMemberDetail struct {
+	UserId      int
+	UserUUID    string
+	Username    string
+	DisplayName string
+	Role        string
+	CreatedAt   int64
+}
+
+// UserOrganization is an organization together with the role the listing
+// user holds in it.
+type UserOrganization struct {
+	Organization
+	Role string
+}
+
+// ValidateOrganizationName trims name and checks it fits the name column.
+func ValidateOrganizationName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errkind.InvalidRequestErr(errors.New("organization name is required"))
+	}
+	if len(name) > 64 {
+		return "", errkind.InvalidRequestErr(errors.New("organization name must not exceed 64 characters"))
+	}
+	return name, nil
+}
+
+// CreateOrganization inserts an enabled organization with ownerId as its
+// first owner.
+func CreateOrganization(ctx context.Context, name string, ownerId int) (*Organization, error) {
+	org := &Organization{Name: name, Status: OrganizationStatusEnabled}
+	err := DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return errors.Wrap(err, "create organization")
+		}
+		member := &OrganizationMember{OrgId: org.Id, UserId: ownerId, Role: OrgRoleOwner}
+		if err := tx.Create(member).Error; err != nil {
+			return errors.Wrapf(err, "add owner %d to organization %d", ownerId, org.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// GetOrganizationById loads one organization.
+func GetOrganizationById(id int) (*Organization, error) {
+	if id <= 0 {
+		return nil, errkind.NotFoundErr(errors.New("organization not found"))
+	}
+	org := &Organization{}
+	if err := DB.First(org, "id = ?", id).Error; err != nil {
+		return nil, errors.Wrapf(err, "get organization %d", id)
+	}
+	return org, nil
+}
+
+// GetOrgIdByUUID resolves an organization UUID to its internal id.
+func GetOrgIdByUUID(uuid string) (int, error) {
+	var org Organization
+	if err := DB.Select("id").First(&org, "uuid = ?", uuid).Error; err != nil {
+		return 0, errors.Wrapf(err, "get organization by uuid %s", uuid)
+	}
+	return org.Id, nil
+}
+
+// GetAllOrganizations lists every organization, newest first.
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	if err = DB.Model(&Organization{}).Count(&total).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "count organizations")
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "list organizations")
+	}
+	return orgs, total, nil
+}
+
+// GetUserOrganizations lists the organizations userId belongs to, with the
+// user's role in each.
+func GetUserOrganizations(userId int) ([]*UserOrganization, error) {
+	var orgs []*UserOrganization
+	err := DB.Table("organizations").
+		Select("organizations.*, organization_members.role AS role").
+		Joins("JOIN organization_members ON organization_members.org_id = organizations.id").
+		Where("organization_members.user_id = ?", userId).
+		Order("organizations.id desc").
+		Scan(&orgs).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "list organizations of user %d", userId)
+	}
+	return orgs, nil
+}
+
+// UpdateOrganization persists the name and status of org.
+func UpdateOrganization(ctx context.Context, org *Organization) error {
+	err := DB.WithContext(ctx).Model(&Organization{}).Where("id = ?", org.Id).
+		Updates(map[string]any{"name": org.Name, "status": org.Status}).Error
+	if err != nil {
+		return errors.Wrapf(err, "update organization %d", org.Id)
+	}
+	CacheInvalidateOrgEnabled(ctx, org.Id)
+	return nil
+}
+
+// DeleteOrganization removes an organization and its memberships. It refuses
+// while the organization still owns tokens, and returns the remaining pool to
+// refundUserId so no quota is lost.
+func DeleteOrganization(ctx context.Context, orgId int, refundUserId int) error {
+	var tokens int64
+	if err := DB.WithContext(ctx).Model(&Token{}).Where("org_id = ?", orgId).Count(&tokens).Error; err != nil {
+		return errors.Wrapf(err, "count tokens of organization %d", orgId)
+	}
+	if tokens > 0 {
+		return errkind.InvalidRequestErr(errors.Errorf("organization still owns %d tokens; delete them first", tokens))
+	}
+	err := DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var org Organization
+		if err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).First(&org, "id = ?", orgId).Error; err != nil {
+			return errors.Wrapf(err, "get organization %d", orgId)
+		}
+		if org.Quota > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", refundUserId).
+				Update("quota", gorm.Expr("quota + ?", org.Quota)).Error; err != nil {
+				return errors.Wrapf(err, "return organization %d quota to user %d", orgId, refundUserId)
+			}
+		}
+		if err := tx.Where("org_id = ?", orgId).Delete(&OrganizationMember{}).Error; err != nil {
+			return errors.Wrapf(err, "delete members of organization %d", orgId)
+		}
+		if err := tx.Delete(&Organization{}, orgId).Error; err != nil {
+			return errors.Wrapf(err, "delete organization %d", orgId)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	CacheInvalidateOrgEnabled(ctx, orgId)
+	if err := CacheUpdateUserQuota(ctx, refundUserId); err != nil {
+		logger.FromContext(ctx).Warn("failed to refresh user quota cache after organization deletion", zap.Error(err))
+	}
+	return nil
+}
+
+// GetOrgMemberRole returns the role of userId in orgId, or "" when the user
+// is not a member.
+func GetOrgMemberRole(orgId int, userId int) (string, error) {
+	var member OrganizationMember
+	err := DB.Where("org_id = ? AND user_id = ?", orgId, userId).Limit(1).Find(&member).Error
+	if err != nil {
+		return "", errors.Wrapf(err, "get role of user %d in organization %d", userId, orgId)
+	}
+	return member.Role, nil
+}
+
+// GetOrgMembers lists the members of an organization, oldest first.
+func GetOrgMembers(orgId int) ([]*OrganizationMemberDetail, error) {
+	var members []*OrganizationMemberDetail
+	err := DB.Table("organization_members").
+		Select("organization_members.user_id, users.uuid AS user_uuid, users.username, users.display_name, organization_members.role, organization_members.created_at").
+		Joins("JOIN users ON users.id = organization_members.user_id").
+		Where("organization_members.org_id = ?", orgId).
+		Order("organization_members.id asc").
+		Scan(&members).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "list members of organization %d", orgId)
+	}
+	return members, nil
+}
+
+// AddOrgMember grants userId a role in orgId.
+func AddOrgMember(ctx context.Context, orgId int, userId int, role string) error {
+	existing, err := GetOrgMemberRole(orgId, userId)
+	if err != nil {
+		return err
+	}
+	if existing != "" {
+		return errkind.InvalidRequestErr(errors.New("user is already a member of this organization"))
+	}
+	member := &OrganizationMember{OrgId: orgId, UserId: userId, Role: role}
+	if err := DB.WithContext(ctx).Create(member).Error; err != nil {
+		return errors.Wrapf(err, "add user %d to organization %d", userId, orgId)
+	}
+	return nil
+}
+
+// UpdateOrgMemberRole changes the role of userId in orgId. Demoting a member
+// to viewer disables the organization tokens they created, since viewers may
+// not spend the pool.
+func UpdateOrgMemberRole(ctx context.Context, orgId int, userId int, role string) error {
+	return DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		current, err := lockOrgMember(tx, orgId, userId)
+		if err != nil {
+			return err
+		}
+		if current.Role == OrgRoleOwner && role != OrgRoleOwner {
+			if err := ensureAnotherOrgOwner(tx, orgId); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&OrganizationMember{}).Where("id = ?", current.Id).Update("role", role).Error; err != nil {
+			return errors.Wrapf(err, "update role of user %d in organization %d", userId, orgId)
+		}
+		if !OrgRoleAtLeast(role, OrgRoleMember) {
+			return disableOrgMemberTokens(tx, orgId, userId)
+		}
+		return nil
+	})
+}
+
+// RemoveOrgMember revokes the membership of userId in orgId and disables the
+// organization tokens they created.
+func RemoveOrgMember(ctx context.Context, orgId int, userId int) error {
+	return DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		current, err := lockOrgMember(tx, orgId, userId)
+		if err != nil {
+			return err
+		}
+		if current.Role == OrgRoleOwner {
+			if err := ensureAnotherOrgOwner(tx, orgId); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&OrganizationMember{}, current.Id).Error; err != nil {
+			return errors.Wrapf(err, "remove user %d from organization %d", userId, orgId)
+		}
+		return disableOrgMemberTokens(tx, orgId, userId)
+	})
+}
+
+func lockOrgMember(tx *gorm.DB, orgId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Where("org_id = ? AND user_id = ?", orgId, userId).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errkind.NotFoundErr(errors.New("user is not a member of this organization"))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get user %d in organization %d", userId, orgId)
+	}
+	return &member, nil
+}
+
+// ensureAnotherOrgOwner refuses to drop the last owner of an organization.
+func ensureAnotherOrgOwner(tx *gorm.DB, orgId int) error {
+	var owners int64
+	if err := tx.Model(&OrganizationMember{}).Where("org_id = ? AND role = ?", orgId, OrgRoleOwner).Count(&owners).Error; err != nil {
+		return errors.Wrapf(err, "count owners of organization %d", orgId)
+	}
+	if owners <= 1 {
+		return errkind.InvalidRequestErr(errors.New("an organization must keep at least one owner"))
+	}
+	return nil
+}
+
+func disableOrgMemberTokens(tx *gorm.DB, orgId int, userId int) error {
+	var keys []string
+	if err := tx.Model(&Token{}).Where("org_id = ? AND user_id = ? AND status = ?", orgId, userId, TokenStatusEnabled).
+		Pluck("key_hash", &keys).Error; err != nil {
+		return errors.Wrapf(err, "list organization %d tokens of user %d", orgId, userId)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := tx.Model(&Token{}).Where("org_id = ? AND user_id = ?", orgId, userId).
+		Update("status", TokenStatusDisabled).Error; err != nil {
+		return errors.Wrapf(err, "disable organization %d tokens of user %d", orgId, userId)
+	}
+	for _, key := range keys {
+		clearTokenCache(tx.Statement.Context, key)
+	}
+	return nil
+}
+
+// GetOrgTokens lists the tokens owned by an organization. A userId > 0 narrows
+// the list to the tokens that user created.
+func GetOrgTokens(orgId int, userId int, startIdx int, num int) (tokens []*Token, total int64, err error) {
+	tx := DB.Model(&Token{}).Where("org_id = ?", orgId)
+	if userId > 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "count tokens of organization %d", orgId)
+	}
+	if err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "list tokens of organization %d", orgId)
+	}
+	return tokens, total, nil
+}
+
+// GetOrgQuota returns the remaining quota pool of an organization.
+func GetOrgQuota(id int) (quota int64, err error) {
+	err = DB.Model(&Organization{}).Where("id = ?", id).Select("quota").Find(&quota).Error
+	if err != nil {
+		return 0, errors.Wrapf(err, "get quota for organization %d", id)
+	}
+	return quota, nil
+}
+
+// IsOrganizationEnabled reports whether the organization exists and is enabled.
+func IsOrganizationEnabled(id int) (bool, error) {
+	var status int
+	err := DB.Model(&Organization{}).Where("id = ?", id).Select("status").Find(&status).Error
+	if err != nil {
+		return false, errors.Wrapf(err, "get status for organization %d", id)
+	}
+	return status == OrganizationStatusEnabled, nil
+}
+
+// IncreaseOrgQuota increases the quota pool of an organization.
+// ctx is the context for the operation; if nil, context.Background() is used.
+func IncreaseOrgQuota(ctx context.Context, id int, quota int64) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if quota < 0 {
+		return errors.New("quota cannot be negative!")
+	}
+	if config.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeOrgQuota, id, quota)
+		return nil
+	}
+	return increaseOrgQuota(ctx, id, quota)
+}
+
+func increaseOrgQuota(ctx context.Context, id int, quota int64) error {
+	err := runWithSQLiteBusyRetry(ctx, func() error {
+		return DB.Model(&Organization{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		return errors.Wrapf(err, "increase quota for organization %d", id)
+	}
+	return nil
+}
+
+// DecreaseOrgQuota decreases the quota pool of an organization.
+// ctx is the context for the operation; if nil, context.Background() is used.
+func DecreaseOrgQuota(ctx context.Context, id int, quota int64) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if quota < 0 {
+		return errors.New("quota cannot be negative!")
+	}
+	if config.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeOrgQuota, id, -quota)
+		return nil
+	}
+	var result *gorm.DB
+	err := runWithSQLiteBusyRetry(ctx, func() error {
+		result = DB.Model(&Organization{}).
+			Where("id = ? AND quota >= ?", id, quota).
+			Update("quota", gorm.Expr("quota - ?", quota))
+		return result.Error
+	})
+	if err != nil {
+		return errors.Wrapf(err, "decrease quota for organization %d", id)
+	}
+	if result.RowsAffected == 0 {
+		// Unclassified for the same reason as decreaseUserQuota: the funds
+		// check happens upfront in PreConsumeTokenQuota.
+		return errors.Errorf("insufficient organization quota for organization %d", id)
+	}
+	return nil
+}
+
+// TransferUserQuotaToOrg moves quota from a user's personal balance into an
+// organization pool.
+func TransferUserQuotaToOrg(ctx context.Context, userId int, orgId int, quota int64) error {
+	if quota <= 0 {
+		return errkind.InvalidRequestErr(errors.New("quota must be positive"))
+	}
+	err := DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).
+			Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return errors.Wrapf(result.Error, "decrease quota for user %d", userId)
+		}
+		if result.RowsAffected == 0 {
+			return errkind.Quota(errors.Errorf("insufficient user quota to transfer %d", quota))
+		}
+		if err := tx.Model(&Organization{}).Where("id = ?", orgId).
+			Update("quota", gorm.Expr("quota + ?", quota)).Error; err != nil {
+			return errors.Wrapf(err, "increase quota for organization %d", orgId)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	lg := logger.FromContext(ctx)
+	if err := CacheUpdateUserQuota(ctx, userId); err != nil {
+		lg.Warn("failed to refresh user quota cache after organization transfer", zap.Error(err))
+	}
+	if err := CacheUpdateOrgQuota(ctx, orgId); err != nil {
+		lg.Warn("failed to refresh organization quota cache after transfer", zap.Error(err))
+	}
+	return nil
+}
+
+// UpdateOrgUsedQuotaAndRequestCount adds one billed request to the usage
+// statistics of an organization.
+func UpdateOrgUsedQuotaAndRequestCount(ctx context.Context, id int, quota int64) {
+	if config.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeOrgUsedQuota, id, quota)
+		addNewRecord(BatchUpdateTypeOrgRequestCount, id, 1)
+		return
+	}
+	updateOrgUsedQuotaAndRequestCount(ctx, id, quota, 1)
+}
+
+func updateOrgUsedQuotaAndRequestCount(ctx context.Context, id int, quota int64, count int) {
+	err := DB.Model(&Organization{}).Where("id = ?", id).Updates(
+		map[string]any{
+			"used_quota":    gorm.Expr("used_quota + ?", quota),
+			"request_count": gorm.Expr("request_count + ?", count),
+		},
+	).Error
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to update organization used quota and request count - statistics may be inaccurate",
+			zap.Int("org_id", id),
+			zap.Int64("quota", quota),
+			zap.Int("count", count),
+			zap.Error(err))
+	}
+}
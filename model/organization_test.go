@@ -0,0 +1,142 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/helper"
+)
+
+func createOrgTestUser(t *testing.T, quota int64) *User {
+	t.Helper()
+	suffix := time.Now().UnixNano()
+	user := &User{
+		Username:    fmt.Sprintf("test-org-%d", suffix),
+		Password:    "testpassword12345",
+		AccessToken: fmt.Sprintf("test-org-%d", suffix),
+		AffCode:     fmt.Sprintf("t%d", suffix%1_000_000_000),
+		Status:      UserStatusEnabled,
+		Role:        RoleCommonUser,
+		Quota:       quota,
+	}
+	require.NoError(t, DB.Create(user).Error)
+	return user
+}
+
+func createOrgTestToken(t *testing.T, orgId int, userId int, remainQuota int64) *Token {
+	t.Helper()
+	token := &Token{
+		UserId:       userId,
+		OrgId:        orgId,
+		Key:          fmt.Sprintf("test-org-%d", time.Now().UnixNano()),
+		Name:         "test org token",
+		Status:       TokenStatusEnabled,
+		RemainQuota:  remainQuota,
+		CreatedTime:  helper.GetTimestamp(),
+		AccessedTime: helper.GetTimestamp(),
+	}
+	require.NoError(t, DB.Create(token).Error)
+	return token
+}
+
+func TestOrgRoleAtLeast(t *testing.T) {
+	require.True(t, OrgRoleAtLeast(OrgRoleOwner, OrgRoleAdmin))
+	require.True(t, OrgRoleAtLeast(OrgRoleMember, OrgRoleMember))
+	require.False(t, OrgRoleAtLeast(OrgRoleViewer, OrgRoleMember))
+	require.False(t, OrgRoleAtLeast("", OrgRoleViewer), "non-members hold no role")
+	require.False(t, IsValidOrgRole("superuser"))
+}
+
+func TestOrganizationMembershipGuardsLastOwner(t *testing.T) {
+	setupTestDatabase(t)
+	ctx := context.Background()
+	owner := createOrgTestUser(t, 0)
+	member := createOrgTestUser(t, 0)
+
+	org, err := CreateOrganization(ctx, "test-org-members", owner.Id)
+	require.NoError(t, err)
+	require.NotEmpty(t, org.UUID)
+
+	role, err := GetOrgMemberRole(org.Id, owner.Id)
+	require.NoError(t, err)
+	require.Equal(t, OrgRoleOwner, role)
+
+	require.NoError(t, AddOrgMember(ctx, org.Id, member.Id, OrgRoleMember))
+	require.Error(t, AddOrgMember(ctx, org.Id, member.Id, OrgRoleViewer), "duplicate memberships are rejected")
+
+	require.Error(t, UpdateOrgMemberRole(ctx, org.Id, owner.Id, OrgRoleAdmin), "the last owner cannot be demoted")
+	require.Error(t, RemoveOrgMember(ctx, org.Id, owner.Id), "the last owner cannot leave")
+
+	require.NoError(t, UpdateOrgMemberRole(ctx, org.Id, member.Id, OrgRoleOwner))
+	require.NoError(t, RemoveOrgMember(ctx, org.Id, owner.Id), "another owner remains")
+
+	orgs, err := GetUserOrganizations(member.Id)
+	require.NoError(t, err)
+	require.Len(t, orgs, 1)
+	require.Equal(t, OrgRoleOwner, orgs[0].Role)
+}
+
+func TestRemoveOrgMemberDisablesTheirTokens(t *testing.T) {
+	setupTestDatabase(t)
+	ctx := context.Background()
+	owner := createOrgTestUser(t, 0)
+	member := createOrgTestUser(t, 0)
+	org, err := CreateOrganization(ctx, "test-org-tokens", owner.Id)
+	require.NoError(t, err)
+	require.NoError(t, AddOrgMember(ctx, org.Id, member.Id, OrgRoleMember))
+
+	memberToken := createOrgTestToken(t, org.Id, member.Id, 100)
+	ownerToken := createOrgTestToken(t, org.Id, owner.Id, 100)
+
+	require.NoError(t, RemoveOrgMember(ctx, org.Id, member.Id))
+
+	reloaded, err := GetTokenById(memberToken.Id)
+	require.NoError(t, err)
+	require.Equal(t, TokenStatusDisabled, reloaded.Status)
+	reloaded, err = GetTokenById(ownerToken.Id)
+	require.NoError(t, err)
+	require.Equal(t, TokenStatusEnabled, reloaded.Status)
+
+	require.Error(t, DeleteOrganization(ctx, org.Id, owner.Id), "organizations owning tokens cannot be deleted")
+}
+
+func TestOrgTokenChargesOrganizationPool(t *testing.T) {
+	setupTestDatabase(t)
+	previousBatchUpdateEnabled := config.BatchUpdateEnabled
+	config.BatchUpdateEnabled = false
+	t.Cleanup(func() { config.BatchUpdateEnabled = previousBatchUpdateEnabled })
+
+	ctx := context.Background()
+	owner := createOrgTestUser(t, 1000)
+	org, err := CreateOrganization(ctx, "test-org-billing", owner.Id)
+	require.NoError(t, err)
+
+	require.Error(t, TransferUserQuotaToOrg(ctx, owner.Id, org.Id, 5000), "cannot transfer more than the balance")
+	require.NoError(t, TransferUserQuotaToOrg(ctx, owner.Id, org.Id, 400))
+
+	token := createOrgTestToken(t, org.Id, owner.Id, 1000)
+	require.NoError(t, PreConsumeTokenQuota(ctx, token.Id, 100))
+	require.NoError(t, PostConsumeTokenQuota(ctx, token.Id, 50))
+
+	orgQuota, err := GetOrgQuota(org.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(250), orgQuota)
+
+	var user User
+	require.NoError(t, DB.First(&user, owner.Id).Error)
+	require.Equal(t, int64(600), user.Quota, "organization tokens never debit the member's own balance")
+
+	err = PreConsumeTokenQuota(ctx, token.Id, 300)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "insufficient organization quota")
+
+	require.NoError(t, DB.Delete(&Token{}, token.Id).Error)
+	require.NoError(t, DeleteOrganization(ctx, org.Id, owner.Id))
+	require.NoError(t, DB.First(&user, owner.Id).Error)
+	require.Equal(t, int64(850), user.Quota, "deleting the organization refunds its pool")
+}
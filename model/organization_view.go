@@ -0,0 +1,58 @@
+package model
+
+import "github.com/Laisky/one-api/dto"
+
+// ToResponse builds the external boundary DTO for an organization; role is the
+// caller's role in it, or "" when the listing is not caller-specific.
+func (org *Organization) ToResponse(role string) dto.OrganizationResponse {
+	if org == nil {
+		return dto.OrganizationResponse{}
+	}
+	return dto.OrganizationResponse{
+		UUID:         org.UUID,
+		Name:         org.Name,
+		Status:       org.Status,
+		Quota:        org.Quota,
+		UsedQuota:    org.UsedQuota,
+		RequestCount: org.RequestCount,
+		Role:         role,
+		CreatedAt:    org.CreatedAt,
+		UpdatedAt:    org.UpdatedAt,
+	}
+}
+
+// OrganizationsToResponses maps organizations to their external DTOs without
+// a caller role.
+func OrganizationsToResponses(orgs []*Organization) []dto.OrganizationResponse {
+	out := make([]dto.OrganizationResponse, 0, len(orgs))
+	for _, org := range orgs {
+		out = append(out, org.ToResponse(""))
+	}
+	return out
+}
+
+// UserOrganizationsToResponses maps a user's organizations to their external
+// DTOs, each carrying the user's role.
+func UserOrganizationsToResponses(orgs []*UserOrganization) []dto.OrganizationResponse {
+	out := make([]dto.OrganizationResponse, 0, len(orgs))
+	for _, org := range orgs {
+		out = append(out, org.Organization.ToResponse(org.Role))
+	}
+	return out
+}
+
+// OrganizationMembersToResponses maps organization members to their external
+// DTOs; internal user ids never cross the API.
+func OrganizationMembersToResponses(members []*OrganizationMemberDetail) []dto.OrganizationMemberResponse {
+	out := make([]dto.OrganizationMemberResponse, 0, len(members))
+	for _, m := range members {
+		out = append(out, dto.OrganizationMemberResponse{
+			UserUUID:    m.UserUUID,
+			Username:    m.Username,
+			DisplayName: m.DisplayName,
+			Role:        m.Role,
+			CreatedAt:   m.CreatedAt,
+		})
+	}
+	return out
+}
@@ -20,6 +20,10 @@ const (
 	RedemptionCodeStatusUsed     = 3 // also don't use 0
 )
 
+// redemptionLogContentSuffix ends the top-up log content of a redeemed code;
+// statements use it to tell redemptions from other top-ups.
+const redemptionLogContentSuffix = "using redemption code"
+
 type Redemption struct {
 	Id           int     `json:"id"`
 	UUID         string  `json:"uuid" gorm:"type:char(36);column:uuid"`
@@ -190,7 +194,7 @@ func Redeem(ctx context.Context, key string, userId int) (quota int64, err error
 			errors.Wrap(err, "Redeem failed"),
 			redemption.Ref(), LookupUserRef(ctx, userId))
 	}
-	RecordLog(ctx, userId, LogTypeTopup, fmt.Sprintf("Recharged %s using redemption code", common.LogQuota(redemption.Quota)))
+	RecordTopupLog(ctx, userId, fmt.Sprintf("Recharged %s %s", common.LogQuota(redemption.Quota), redemptionLogContentSuffix), int(redemption.Quota))
 	return redemption.Quota, nil
 }
 
@@ -0,0 +1,371 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/random"
+)
+
+// Batch statuses, matching the OpenAI Batch object.
+const (
+	RelayBatchStatusValidating = "validating"
+	RelayBatchStatusFailed     = "failed"
+	RelayBatchStatusInProgress = "in_progress"
+	RelayBatchStatusFinalizing = "finalizing"
+	RelayBatchStatusCompleted  = "completed"
+	RelayBatchStatusExpired    = "expired"
+	RelayBatchStatusCancelling = "cancelling"
+	RelayBatchStatusCancelled  = "cancelled"
+)
+
+// relayBatchIDPrefix matches the OpenAI batch id shape so SDKs accept it.
+const relayBatchIDPrefix = "batch_"
+
+// relayBatchActiveStatuses are the statuses the executor still has work for.
+var relayBatchActiveStatuses = []string{
+	RelayBatchStatusValidating,
+	RelayBatchStatusInProgress,
+	RelayBatchStatusFinalizing,
+	RelayBatchStatusCancelling,
+}
+
+// RelayBatch is an OpenAI-compatible batch executed locally: every input line
+// is replayed through the relay pipeline by the batch executor. Records are
+// owner-scoped like RelayFile. LeaseOwner/LeaseUntil let exactly one node work
+// on a batch at a time; an expired lease is reclaimed by any node.
+type RelayBatch struct {
+	Id               int    `json:"-"`
+	BatchId          string `json:"id" gorm:"size:64;uniqueIndex;not null"`
+	UserId           int    `json:"-" gorm:"index;not null"`
+	TokenId          int    `json:"-" gorm:"index"`
+	Endpoint         string `json:"endpoint" gorm:"size:64"`
+	InputFileId      string `json:"input_file_id" gorm:"size:64"`
+	CompletionWindow string `json:"completion_window" gorm:"size:16"`
+	Status           string `json:"status" gorm:"size:16;index"`
+	OutputFileId     string `json:"output_file_id" gorm:"size:64"`
+	ErrorFileId      string `json:"error_file_id" gorm:"size:64"`
+	Metadata         string `json:"metadata" gorm:"type:text"`
+	Errors           string `json:"errors" gorm:"type:text"`
+	RequestTotal     int    `json:"request_total"`
+	RequestCompleted int    `json:"request_completed"`
+	RequestFailed    int    `json:"request_failed"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+	LeaseOwner       string `json:"-" gorm:"size:64"`
+	LeaseUntil       int64  `json:"-" gorm:"bigint;index"`
+}
+
+// TableName returns the database table name for RelayBatch.
+func (RelayBatch) TableName() string {
+	return "relay_batches"
+}
+
+// RelayBatchItem is the result of one executed batch line. Items are written
+// as lines finish so an interrupted batch resumes where it stopped, and are
+// folded into the output and error files when the batch is finalized.
+type RelayBatchItem struct {
+	Id       int    `json:"-"`
+	BatchId  int    `json:"-" gorm:"uniqueIndex:idx_relay_batch_item_line;not null"`
+	Line     int    `json:"line" gorm:"uniqueIndex:idx_relay_batch_item_line"`
+	CustomId string `json:"custom_id" gorm:"size:255"`
+	Failed   bool   `json:"failed"`
+	Result   string `json:"result" gorm:"type:text"`
+}
+
+// TableName returns the database table name for RelayBatchItem.
+func (RelayBatchItem) TableName() string {
+	return "relay_batch_items"
+}
+
+// NewRelayBatchID returns a fresh public batch id.
+func NewRelayBatchID() string {
+	return relayBatchIDPrefix + random.GetUUID()
+}
+
+// IsTerminal reports whether the batch has reached a final status.
+func (batch *RelayBatch) IsTerminal() bool {
+	switch batch.Status {
+	case RelayBatchStatusFailed, RelayBatchStatusCompleted, RelayBatchStatusExpired, RelayBatchStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// CreateRelayBatch inserts a new batch in the validating status.
+func CreateRelayBatch(ctx context.Context, batch *RelayBatch) error {
+	if batch == nil {
+		return errors.New("relay batch cannot be nil")
+	}
+	if batch.UserId <= 0 {
+		return errors.New("relay batch requires user id")
+	}
+	if batch.BatchId == "" {
+		batch.BatchId = NewRelayBatchID()
+	}
+	if batch.CreatedAt == 0 {
+		batch.CreatedAt = helper.GetTimestamp()
+	}
+	batch.Status = RelayBatchStatusValidating
+	if err := DB.WithContext(ctx).Create(batch).Error; err != nil {
+		return errors.Wrapf(err, "create relay batch %s", batch.BatchId)
+	}
+	return nil
+}
+
+// GetRelayBatch returns an owner's batch. It returns gorm.ErrRecordNotFound
+// for unknown and foreign ids alike.
+func GetRelayBatch(ctx context.Context, userId, tokenId int, batchId string) (*RelayBatch, error) {
+	batch := &RelayBatch{}
+	err := DB.WithContext(ctx).
+		Where("user_id = ? AND token_id = ? AND batch_id = ?", userId, tokenId, strings.TrimSpace(batchId)).
+		First(batch).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get relay batch %s", batchId)
+	}
+	return batch, nil
+}
+
+// getRelayBatchById reloads a batch by its primary key.
+func getRelayBatchById(ctx context.Context, id int) (*RelayBatch, error) {
+	batch := &RelayBatch{}
+	if err := DB.WithContext(ctx).First(batch, "id = ?", id).Error; err != nil {
+		return nil, errors.Wrapf(err, "get relay batch #%d", id)
+	}
+	return batch, nil
+}
+
+// GetRelayBatchStatus returns the current status of a batch by primary key.
+// The executor polls it between lines to notice cancellation.
+func GetRelayBatchStatus(ctx context.Context, id int) (string, error) {
+	batch, err := getRelayBatchById(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return batch.Status, nil
+}
+
+// ListRelayBatches lists an owner's batches newest first. after is an optional
+// batch id cursor.
+func ListRelayBatches(ctx context.Context, userId, tokenId int, after string, limit int) ([]*RelayBatch, error) {
+	db := DB.WithContext(ctx).Where("user_id = ? AND token_id = ?", userId, tokenId)
+	if after != "" {
+		cursor, err := GetRelayBatch(ctx, userId, tokenId, after)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("id < ?", cursor.Id)
+	}
+	var batches []*RelayBatch
+	if err := db.Order("id desc").Limit(limit).Find(&batches).Error; err != nil {
+		return nil, errors.Wrap(err, "list relay batches")
+	}
+	return batches, nil
+}
+
+// CancelRelayBatch moves an owner's running batch to cancelling; the executor
+// then finalizes it with the lines finished so far. Batches that already
+// reached a final status, or are already cancelling, are returned unchanged.
+func CancelRelayBatch(ctx context.Context, userId, tokenId int, batchId string) (*RelayBatch, error) {
+	batch, err := GetRelayBatch(ctx, userId, tokenId, batchId)
+	if err != nil {
+		return nil, err
+	}
+	err = DB.WithContext(ctx).Model(&RelayBatch{}).
+		Where("id = ? AND status IN ?", batch.Id, []string{RelayBatchStatusValidating, RelayBatchStatusInProgress}).
+		Updates(map[string]any{
+			"status":        RelayBatchStatusCancelling,
+			"cancelling_at": helper.GetTimestamp(),
+		}).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "cancel relay batch %s", batchId)
+	}
+	return getRelayBatchById(ctx, batch.Id)
+}
+
+// ClaimRelayBatch leases the oldest batch that still has work and whose lease
+// is free or expired. It returns nil when there is nothing to claim.
+// Parameters:
+//   - owner: identifier of the claiming node, stored as the lease owner.
+//   - lease: how long the claim stays valid unless renewed.
+func ClaimRelayBatch(ctx context.Context, owner string, lease time.Duration) (*RelayBatch, error) {
+	now := time.Now()
+	var candidates []*RelayBatch
+	err := DB.WithContext(ctx).
+		Where("status IN ? AND lease_until < ?", relayBatchActiveStatuses, now.UnixMilli()).
+		Order("id asc").
+		Limit(8).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "find claimable relay batches")
+	}
+	for _, candidate := range candidates {
+		// Compare-and-set on the previous lease so two nodes never both win.
+		tx := DB.WithContext(ctx).Model(&RelayBatch{}).
+			Where("id = ? AND lease_until = ?", candidate.Id, candidate.LeaseUntil).
+			Updates(map[string]any{
+				"lease_owner": owner,
+				"lease_until": now.Add(lease).UnixMilli(),
+			})
+		if tx.Error != nil {
+			return nil, errors.Wrapf(tx.Error, "claim relay batch %s", candidate.BatchId)
+		}
+		if tx.RowsAffected == 1 {
+			return getRelayBatchById(ctx, candidate.Id)
+		}
+	}
+	return nil, nil
+}
+
+// RenewRelayBatchLease extends a lease held by owner. It fails when another
+// node has taken the batch over.
+func RenewRelayBatchLease(ctx context.Context, id int, owner string, lease time.Duration) error {
+	tx := DB.WithContext(ctx).Model(&RelayBatch{}).
+		Where("id = ? AND lease_owner = ?", id, owner).
+		Update("lease_until", time.Now().Add(lease).UnixMilli())
+	if tx.Error != nil {
+		return errors.Wrapf(tx.Error, "renew relay batch lease #%d", id)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.Errorf("relay batch lease #%d is no longer held by %s", id, owner)
+	}
+	return nil
+}
+
+// ReleaseRelayBatchLease gives up a lease so another node can claim the batch
+// immediately.
+func ReleaseRelayBatchLease(ctx context.Context, id int, owner string) error {
+	err := DB.WithContext(ctx).Model(&RelayBatch{}).
+		Where("id = ? AND lease_owner = ?", id, owner).
+		Updates(map[string]any{"lease_owner": "", "lease_until": 0}).Error
+	if err != nil {
+		return errors.Wrapf(err, "release relay batch lease #%d", id)
+	}
+	return nil
+}
+
+// TransitionRelayBatch applies updates to a batch whose lease is held by owner
+// and whose status is still from. It reports false, without error, when the
+// status changed concurrently (for example the client cancelled the batch).
+func TransitionRelayBatch(ctx context.Context, id int, owner, from string, updates map[string]any) (bool, error) {
+	tx := DB.WithContext(ctx).Model(&RelayBatch{}).
+		Where("id = ? AND lease_owner = ? AND status = ?", id, owner, from).
+		Updates(updates)
+	if tx.Error != nil {
+		return false, errors.Wrapf(tx.Error, "update relay batch #%d", id)
+	}
+	return tx.RowsAffected == 1, nil
+}
+
+// SaveRelayBatchItem records the result of one line and bumps the batch's
+// completed or failed counter. Saving the same line twice keeps the first
+// result and counts it once.
+func SaveRelayBatchItem(ctx context.Context, item *RelayBatchItem) error {
+	return DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(item)
+		if result.Error != nil {
+			return errors.Wrapf(result.Error, "save relay batch item %d of batch #%d", item.Line, item.BatchId)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		column := "request_completed"
+		if item.Failed {
+			column = "request_failed"
+		}
+		err := tx.Model(&RelayBatch{}).
+			Where("id = ?", item.BatchId).
+			UpdateColumn(column, gorm.Expr(column+" + ?", 1)).Error
+		if err != nil {
+			return errors.Wrapf(err, "count relay batch item of batch #%d", item.BatchId)
+		}
+		return nil
+	})
+}
+
+// GetRelayBatchItemLines returns the line numbers of a batch that already have
+// a recorded result.
+func GetRelayBatchItemLines(ctx context.Context, batchId int) (map[int]bool, error) {
+	var lines []int
+	err := DB.WithContext(ctx).Model(&RelayBatchItem{}).
+		Where("batch_id = ?", batchId).
+		Pluck("line", &lines).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "list relay batch item lines of batch #%d", batchId)
+	}
+	done := make(map[int]bool, len(lines))
+	for _, line := range lines {
+		done[line] = true
+	}
+	return done, nil
+}
+
+// GetRelayBatchItems returns every recorded result of a batch in line order.
+func GetRelayBatchItems(ctx context.Context, batchId int) ([]*RelayBatchItem, error) {
+	var items []*RelayBatchItem
+	err := DB.WithContext(ctx).
+		Where("batch_id = ?", batchId).
+		Order("line asc").
+		Find(&items).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "list relay batch items of batch #%d", batchId)
+	}
+	return items, nil
+}
+
+// FinalizeRelayBatch atomically stores the output and error files (either may
+// be nil), applies the final updates to the batch and drops its item rows.
+func FinalizeRelayBatch(ctx context.Context, id int, owner string, output, errorFile *RelayFile, updates map[string]any) error {
+	return DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, file := range []*RelayFile{output, errorFile} {
+			if file == nil {
+				continue
+			}
+			if file.FileId == "" {
+				file.FileId = NewRelayFileID()
+			}
+			if file.CreatedAt == 0 {
+				file.CreatedAt = helper.GetTimestamp()
+			}
+			file.Bytes = int64(len(file.Content))
+			if err := createRelayFile(tx, file); err != nil {
+				return err
+			}
+		}
+		if output != nil {
+			updates["output_file_id"] = output.FileId
+		}
+		if errorFile != nil {
+			updates["error_file_id"] = errorFile.FileId
+		}
+		updates["lease_owner"] = ""
+		updates["lease_until"] = 0
+		result := tx.Model(&RelayBatch{}).
+			Where("id = ? AND lease_owner = ?", id, owner).
+			Updates(updates)
+		if result.Error != nil {
+			return errors.Wrapf(result.Error, "finalize relay batch #%d", id)
+		}
+		if result.RowsAffected == 0 {
+			return errors.Errorf("relay batch lease #%d is no longer held by %s", id, owner)
+		}
+		if err := tx.Where("batch_id = ?", id).Delete(&RelayBatchItem{}).Error; err != nil {
+			return errors.Wrapf(err, "delete relay batch items of batch #%d", id)
+		}
+		return nil
+	})
+}
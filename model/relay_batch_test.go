@@ -0,0 +1,113 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupRelayBatchTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&RelayFile{}, &RelayBatch{}, &RelayBatchItem{}))
+
+	originalDB := DB
+	DB = db
+	t.Cleanup(func() { DB = originalDB })
+}
+
+func TestRelayFile_OwnerScoped(t *testing.T) {
+	setupRelayBatchTestDB(t)
+	ctx := context.Background()
+
+	file := &RelayFile{UserId: 1, TokenId: 10, Purpose: RelayFilePurposeBatch, Filename: "in.jsonl", Content: []byte("{}\n")}
+	require.NoError(t, CreateRelayFile(ctx, file))
+	require.Regexp(t, `^file-[0-9a-f]{32}$`, file.FileId)
+	require.EqualValues(t, 3, file.Bytes)
+
+	got, err := GetRelayFile(ctx, 1, 10, file.FileId)
+	require.NoError(t, err)
+	require.Empty(t, got.Content)
+	withContent, err := GetRelayFileContent(ctx, 1, 10, file.FileId)
+	require.NoError(t, err)
+	require.Equal(t, []byte("{}\n"), withContent.Content)
+
+	// Another token of the same user cannot see the file.
+	_, err = GetRelayFile(ctx, 1, 11, file.FileId)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	require.ErrorIs(t, DeleteRelayFile(ctx, 2, 10, file.FileId), gorm.ErrRecordNotFound)
+
+	require.NoError(t, DeleteRelayFile(ctx, 1, 10, file.FileId))
+	_, err = GetRelayFile(ctx, 1, 10, file.FileId)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestRelayBatch_ClaimLeaseAndFinalize(t *testing.T) {
+	setupRelayBatchTestDB(t)
+	ctx := context.Background()
+
+	batch := &RelayBatch{UserId: 1, TokenId: 10, Endpoint: "/v1/chat/completions", InputFileId: "file-x", CompletionWindow: "24h"}
+	require.NoError(t, CreateRelayBatch(ctx, batch))
+	require.Equal(t, RelayBatchStatusValidating, batch.Status)
+
+	claimed, err := ClaimRelayBatch(ctx, "node-a", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+	require.Equal(t, batch.BatchId, claimed.BatchId)
+
+	// The lease is held, so a second node finds nothing to claim.
+	other, err := ClaimRelayBatch(ctx, "node-b", time.Minute)
+	require.NoError(t, err)
+	require.Nil(t, other)
+	require.Error(t, RenewRelayBatchLease(ctx, batch.Id, "node-b", time.Minute))
+
+	moved, err := TransitionRelayBatch(ctx, batch.Id, "node-a", RelayBatchStatusValidating, map[string]any{"status": RelayBatchStatusInProgress})
+	require.NoError(t, err)
+	require.True(t, moved)
+
+	require.NoError(t, SaveRelayBatchItem(ctx, &RelayBatchItem{BatchId: batch.Id, Line: 0, CustomId: "a", Result: `{"a":1}`}))
+	require.NoError(t, SaveRelayBatchItem(ctx, &RelayBatchItem{BatchId: batch.Id, Line: 1, CustomId: "b", Failed: true, Result: `{"b":1}`}))
+	// A duplicate save keeps the first result and is not counted twice.
+	require.NoError(t, SaveRelayBatchItem(ctx, &RelayBatchItem{BatchId: batch.Id, Line: 0, CustomId: "a", Result: `{"a":2}`}))
+
+	progress, err := GetRelayBatch(ctx, 1, 10, batch.BatchId)
+	require.NoError(t, err)
+	require.Equal(t, 1, progress.RequestCompleted)
+	require.Equal(t, 1, progress.RequestFailed)
+	lines, err := GetRelayBatchItemLines(ctx, batch.Id)
+	require.NoError(t, err)
+	require.Equal(t, map[int]bool{0: true, 1: true}, lines)
+
+	output := &RelayFile{UserId: 1, TokenId: 10, Purpose: RelayFilePurposeBatchOutput, Content: []byte("{\"a\":1}\n")}
+	require.NoError(t, FinalizeRelayBatch(ctx, batch.Id, "node-a", output, nil, map[string]any{"status": RelayBatchStatusCompleted}))
+
+	final, err := GetRelayBatch(ctx, 1, 10, batch.BatchId)
+	require.NoError(t, err)
+	require.True(t, final.IsTerminal())
+	require.Equal(t, output.FileId, final.OutputFileId)
+	require.Empty(t, final.LeaseOwner)
+	items, err := GetRelayBatchItems(ctx, batch.Id)
+	require.NoError(t, err)
+	require.Empty(t, items)
+}
+
+func TestCancelRelayBatch(t *testing.T) {
+	setupRelayBatchTestDB(t)
+	ctx := context.Background()
+
+	batch := &RelayBatch{UserId: 1, TokenId: 10, Endpoint: "/v1/embeddings", CompletionWindow: "24h"}
+	require.NoError(t, CreateRelayBatch(ctx, batch))
+
+	_, err := CancelRelayBatch(ctx, 1, 99, batch.BatchId)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	cancelled, err := CancelRelayBatch(ctx, 1, 10, batch.BatchId)
+	require.NoError(t, err)
+	require.Equal(t, RelayBatchStatusCancelling, cancelled.Status)
+	require.NotZero(t, cancelled.CancellingAt)
+}
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/random"
+)
+
+const (
+	// RelayFilePurposeBatch marks a JSONL file uploaded as /v1/batches input.
+	RelayFilePurposeBatch = "batch"
+	// RelayFilePurposeBatchOutput marks an output or error file written by the
+	// batch executor.
+	RelayFilePurposeBatchOutput = "batch_output"
+)
+
+// relayFileIDPrefix matches the OpenAI file id shape so SDKs accept it.
+const relayFileIDPrefix = "file-"
+
+// RelayFile is a file stored for the OpenAI-compatible /v1/files API. The
+// content lives in the primary database so every node can serve it. Records
+// are owner-scoped: a file is only visible to the (user, token) pair that
+// created it, and a foreign id is indistinguishable from a missing one.
+type RelayFile struct {
+	Id        int    `json:"-"`
+	FileId    string `json:"id" gorm:"size:64;uniqueIndex;not null"`
+	UserId    int    `json:"-" gorm:"index;not null"`
+	TokenId   int    `json:"-" gorm:"index"`
+	Purpose   string `json:"purpose" gorm:"size:32;index"`
+	Filename  string `json:"filename" gorm:"size:255"`
+	Bytes     int64  `json:"bytes" gorm:"bigint"`
+	Content   []byte `json:"-"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// TableName returns the database table name for RelayFile.
+func (RelayFile) TableName() string {
+	return "relay_files"
+}
+
+// NewRelayFileID returns a fresh public file id.
+func NewRelayFileID() string {
+	return relayFileIDPrefix + random.GetUUID()
+}
+
+// CreateRelayFile inserts a file, filling in the public id, size and creation
+// time when they are unset.
+func CreateRelayFile(ctx context.Context, file *RelayFile) error {
+	if file == nil {
+		return errors.New("relay file cannot be nil")
+	}
+	if file.UserId <= 0 {
+		return errors.New("relay file requires user id")
+	}
+	if file.FileId == "" {
+		file.FileId = NewRelayFileID()
+	}
+	if file.CreatedAt == 0 {
+		file.CreatedAt = helper.GetTimestamp()
+	}
+	file.Bytes = int64(len(file.Content))
+	return createRelayFile(DB.WithContext(ctx), file)
+}
+
+func createRelayFile(tx *gorm.DB, file *RelayFile) error {
+	if err := tx.Create(file).Error; err != nil {
+		return errors.Wrapf(err, "create relay file %s", file.FileId)
+	}
+	return nil
+}
+
+// relayFileOwnerScope restricts a query to one owner's files.
+func relayFileOwnerScope(userId, tokenId int) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ? AND token_id = ?", userId, tokenId)
+	}
+}
+
+// GetRelayFile returns the metadata of an owner's file without its content.
+// It returns gorm.ErrRecordNotFound for unknown and foreign ids alike.
+func GetRelayFile(ctx context.Context, userId, tokenId int, fileId string) (*RelayFile, error) {
+	file := &RelayFile{}
+	err := DB.WithContext(ctx).
+		Scopes(relayFileOwnerScope(userId, tokenId)).
+		Omit("content").
+		Where("file_id = ?", strings.TrimSpace(fileId)).
+		First(file).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get relay file %s", fileId)
+	}
+	return file, nil
+}
+
+// GetRelayFileContent returns an owner's file including its content.
+func GetRelayFileContent(ctx context.Context, userId, tokenId int, fileId string) (*RelayFile, error) {
+	file := &RelayFile{}
+	err := DB.WithContext(ctx).
+		Scopes(relayFileOwnerScope(userId, tokenId)).
+		Where("file_id = ?", strings.TrimSpace(fileId)).
+		First(file).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get relay file content %s", fileId)
+	}
+	return file, nil
+}
+
+// ListRelayFiles lists an owner's files newest first, without content.
+// Parameters:
+//   - purpose: optional purpose filter.
+//   - after: optional file id cursor; only files created before it are listed.
+//   - limit: maximum number of files to return.
+func ListRelayFiles(ctx context.Context, userId, tokenId int, purpose, after string, limit int) ([]*RelayFile, error) {
+	db := DB.WithContext(ctx).Scopes(relayFileOwnerScope(userId, tokenId)).Omit("content")
+	if purpose != "" {
+		db = db.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		cursor, err := GetRelayFile(ctx, userId, tokenId, after)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("id < ?", cursor.Id)
+	}
+	var files []*RelayFile
+	if err := db.Order("id desc").Limit(limit).Find(&files).Error; err != nil {
+		return nil, errors.Wrap(err, "list relay files")
+	}
+	return files, nil
+}
+
+// DeleteRelayFile removes an owner's file. It returns gorm.ErrRecordNotFound
+// when the owner has no file with that id.
+func DeleteRelayFile(ctx context.Context, userId, tokenId int, fileId string) error {
+	tx := DB.WithContext(ctx).
+		Scopes(relayFileOwnerScope(userId, tokenId)).
+		Where("file_id = ?", strings.TrimSpace(fileId)).
+		Delete(&RelayFile{})
+	if tx.Error != nil {
+		return errors.Wrapf(tx.Error, "delete relay file %s", fileId)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.Wrapf(gorm.ErrRecordNotFound, "delete relay file %s", fileId)
+	}
+	return nil
+}
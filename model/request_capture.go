@@ -0,0 +1,348 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/common/logger"
+)
+
+const (
+	// MaxCaptureRuleDuration bounds how long one capture rule stays active.
+	MaxCaptureRuleDuration = 7 * 24 * time.Hour
+	// captureRuleRefreshInterval is how often the background sync reloads the
+	// rule snapshot, so rules created on another node take effect without a
+	// restart.
+	captureRuleRefreshInterval    = 10 * time.Second
+	captureRetentionSweepInterval = time.Hour
+)
+
+// CaptureRule turns on request capture for one user or one token until
+// ExpiresAt. Exactly one of UserId and TokenId is set.
+type CaptureRule struct {
+	Id        int    `json:"-"`
+	UUID      string `json:"uuid" gorm:"type:char(36);column:uuid;index"`
+	UserId    int    `json:"-" gorm:"index;default:0"`
+	UserUUID  string `json:"user_uuid,omitempty" gorm:"type:char(36);column:user_uuid"`
+	TokenId   int    `json:"-" gorm:"index;default:0"`
+	TokenUUID string `json:"token_uuid,omitempty" gorm:"type:char(36);column:token_uuid"`
+	ExpiresAt int64  `json:"expires_at" gorm:"bigint;index"` // unix milliseconds
+	CreatedBy int    `json:"-"`
+	Remark    string `json:"remark" gorm:"size:255"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
+}
+
+// BeforeCreate assigns a server-generated UUID to a capture rule before insertion.
+func (rule *CaptureRule) BeforeCreate(tx *gorm.DB) error {
+	return ensureUUID(&rule.UUID)
+}
+
+// RequestCapture stores the bodies of one captured relay request. RequestId
+// links it to the consume log row of the same request. Bodies are sanitized
+// before storage and capped at CAPTURE_MAX_BODY_BYTES each.
+//
+// The body columns use size tags rather than dialect types so MySQL gets a
+// MEDIUMTEXT while PostgreSQL and SQLite get TEXT.
+type RequestCapture struct {
+	Id              int    `json:"-"`
+	UUID            string `json:"uuid" gorm:"type:char(36);column:uuid;index"`
+	RequestId       string `json:"request_id" gorm:"size:64;index"`
+	UserId          int    `json:"-" gorm:"index"`
+	UserUUID        string `json:"user_uuid" gorm:"type:char(36);column:user_uuid"`
+	TokenId         int    `json:"-" gorm:"index"`
+	TokenUUID       string `json:"token_uuid" gorm:"type:char(36);column:token_uuid"`
+	ChannelId       int    `json:"-"`
+	ChannelUUID     string `json:"channel_uuid" gorm:"type:char(36);column:channel_uuid"`
+	Model           string `json:"model" gorm:"size:255"`
+	Method          string `json:"method" gorm:"size:16"`
+	Path            string `json:"path" gorm:"size:512"`
+	IsStream        bool   `json:"is_stream"`
+	StatusCode      int    `json:"status_code"`
+	InboundRequest  string `json:"inbound_request" gorm:"size:16777216"`
+	UpstreamURL     string `json:"upstream_url" gorm:"size:2048"`
+	UpstreamRequest string `json:"upstream_request" gorm:"size:16777216"`
+	Response        string `json:"response" gorm:"size:16777216"`
+	Truncated       bool   `json:"truncated"`
+	CreatedAt       int64  `json:"created_at" gorm:"bigint;autoCreateTime:milli;index"`
+}
+
+// BeforeCreate assigns a server-generated UUID to a request capture before insertion.
+func (capture *RequestCapture) BeforeCreate(tx *gorm.DB) error {
+	return ensureUUID(&capture.UUID)
+}
+
+// SetUpstreamRequest records the converted request sent to the channel. The
+// relay may call it once per attempt; the last attempt wins.
+func (capture *RequestCapture) SetUpstreamRequest(url string, body string, truncated bool) {
+	capture.UpstreamURL = url
+	capture.UpstreamRequest = body
+	capture.Truncated = capture.Truncated || truncated
+}
+
+// CaptureBody prepares a request or response body for storage. JSON bodies are
+// passed through common.SanitizePayloadForLogging, which redacts credential
+// fields and base64 payloads; other text is truncated; binary bodies such as
+// multipart uploads are replaced by a placeholder.
+//
+// Parameters:
+//   - body: the raw body.
+//   - contentType: the body's Content-Type header, possibly empty.
+//
+// Returns:
+//   - string: the body to store.
+//   - bool: whether it was cut at CAPTURE_MAX_BODY_BYTES.
+func CaptureBody(body []byte, contentType string) (string, bool) {
+	if len(body) == 0 {
+		return "", false
+	}
+	limit := config.CaptureMaxBodyBytes
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "" || strings.Contains(mediaType, "json"):
+		sanitized, truncated := common.SanitizePayloadForLogging(body, limit)
+		return string(sanitized), truncated
+	case strings.HasPrefix(mediaType, "text/"):
+		if len(body) > limit {
+			return string(body[:limit]), true
+		}
+		return string(body), false
+	default:
+		return fmt.Sprintf("[%s body, %d bytes]", mediaType, len(body)), false
+	}
+}
+
+// captureRules is the snapshot of active rules consulted on every relay
+// request. It is replaced wholesale by ReloadCaptureRules, so readers never
+// lock or touch the database.
+var captureRules atomic.Pointer[[]CaptureRule]
+
+// CreateCaptureRule stores rule, which names its user or token, so that their
+// requests are captured for duration.
+func CreateCaptureRule(ctx context.Context, rule *CaptureRule, duration time.Duration) (*CaptureRule, error) {
+	if (rule.UserId > 0) == (rule.TokenId > 0) {
+		return nil, errkind.InvalidRequestErr(errors.New("a capture rule needs exactly one of user or token"))
+	}
+	if duration <= 0 || duration > MaxCaptureRuleDuration {
+		return nil, errkind.InvalidRequestErr(errors.New("capture duration must be positive and at most 7 days"))
+	}
+	if len(rule.Remark) > 255 {
+		return nil, errkind.InvalidRequestErr(errors.New("remark must not exceed 255 characters"))
+	}
+	rule.ExpiresAt = time.Now().Add(duration).UnixMilli()
+	if err := DB.WithContext(ctx).Create(rule).Error; err != nil {
+		return nil, errors.Wrap(err, "create capture rule")
+	}
+	reloadCaptureRulesAfterChange(ctx)
+	return rule, nil
+}
+
+// GetCaptureRules lists the rules that have not expired yet, newest first.
+func GetCaptureRules(ctx context.Context) ([]*CaptureRule, error) {
+	var rules []*CaptureRule
+	err := DB.WithContext(ctx).
+		Where("expires_at > ?", time.Now().UnixMilli()).
+		Order("id desc").Find(&rules).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "list capture rules")
+	}
+	return rules, nil
+}
+
+// DeleteCaptureRuleByUUID removes a rule, ending its capture at once on this
+// node and within captureRuleRefreshInterval elsewhere.
+func DeleteCaptureRuleByUUID(ctx context.Context, uuid string) error {
+	tx := DB.WithContext(ctx).Where("uuid = ?", uuid).Delete(&CaptureRule{})
+	if tx.Error != nil {
+		return errors.Wrapf(tx.Error, "delete capture rule %s", uuid)
+	}
+	if tx.RowsAffected == 0 {
+		return errkind.NotFoundErr(errors.New("capture rule not found"))
+	}
+	reloadCaptureRulesAfterChange(ctx)
+	return nil
+}
+
+// ReloadCaptureRules replaces the in-memory snapshot with the rules that have
+// not expired yet. On error the previous snapshot stays in place.
+func ReloadCaptureRules(ctx context.Context) error {
+	var rules []CaptureRule
+	err := DB.WithContext(ctx).
+		Select("user_id", "token_id", "expires_at").
+		Where("expires_at > ?", time.Now().UnixMilli()).
+		Find(&rules).Error
+	if err != nil {
+		return errors.Wrap(err, "reload capture rules")
+	}
+	captureRules.Store(&rules)
+	return nil
+}
+
+// reloadCaptureRulesAfterChange applies a rule change on this node at once;
+// a failure is only logged because the background sync retries it.
+func reloadCaptureRulesAfterChange(ctx context.Context) {
+	if err := ReloadCaptureRules(ctx); err != nil {
+		logger.Logger.Warn("failed to reload capture rules after a change", zap.Error(err))
+	}
+}
+
+// StartCaptureRuleSync loads the capture rules and keeps reloading them every
+// captureRuleRefreshInterval until ctx is done.
+func StartCaptureRuleSync(ctx context.Context) {
+	if err := ReloadCaptureRules(ctx); err != nil {
+		logger.Logger.Warn("failed to load capture rules", zap.Error(err))
+	}
+
+	ticker := time.NewTicker(captureRuleRefreshInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := ReloadCaptureRules(ctx); err != nil {
+					logger.Logger.Warn("failed to reload capture rules", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// ShouldCaptureRequest reports whether an active rule covers userId or
+// tokenId. It only reads the snapshot kept by StartCaptureRuleSync.
+func ShouldCaptureRequest(userId, tokenId int) bool {
+	rules := captureRules.Load()
+	if rules == nil {
+		return false
+	}
+	now := time.Now().UnixMilli()
+	for _, rule := range *rules {
+		if rule.ExpiresAt <= now {
+			continue
+		}
+		if (rule.UserId > 0 && rule.UserId == userId) || (rule.TokenId > 0 && rule.TokenId == tokenId) {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveRequestCapture persists a finished capture.
+func SaveRequestCapture(ctx context.Context, capture *RequestCapture) error {
+	if err := DB.WithContext(ctx).Create(capture).Error; err != nil {
+		return errors.Wrapf(err, "save request capture for request %s", capture.RequestId)
+	}
+	return nil
+}
+
+// RequestCaptureFilter narrows a capture listing; zero values match everything.
+type RequestCaptureFilter struct {
+	RequestId string
+	UserId    int
+	TokenId   int
+}
+
+// GetRequestCaptures lists captures matching filter without their bodies,
+// newest first.
+func GetRequestCaptures(ctx context.Context, filter RequestCaptureFilter, startIdx, num int) (captures []*RequestCapture, total int64, err error) {
+	query := DB.WithContext(ctx).Model(&RequestCapture{})
+	if filter.RequestId != "" {
+		query = query.Where("request_id = ?", filter.RequestId)
+	}
+	if filter.UserId > 0 {
+		query = query.Where("user_id = ?", filter.UserId)
+	}
+	if filter.TokenId > 0 {
+		query = query.Where("token_id = ?", filter.TokenId)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "count request captures")
+	}
+	err = query.Omit("inbound_request", "upstream_request", "response").
+		Order("id desc").Limit(num).Offset(startIdx).Find(&captures).Error
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "list request captures")
+	}
+	return captures, total, nil
+}
+
+// GetRequestCaptureByUUID loads one capture with its bodies.
+func GetRequestCaptureByUUID(ctx context.Context, uuid string) (*RequestCapture, error) {
+	capture := &RequestCapture{}
+	err := DB.WithContext(ctx).First(capture, "uuid = ?", uuid).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errkind.NotFoundErr(errors.New("request capture not found"))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get request capture %s", uuid)
+	}
+	return capture, nil
+}
+
+// StartCaptureRetentionCleaner launches a background worker that removes captures older than retentionDays and expired capture rules.
+func StartCaptureRetentionCleaner(ctx context.Context, retentionDays int) {
+	if retentionDays <= 0 {
+		logger.Logger.Debug("capture retention disabled", zap.Int("capture_retention_days", retentionDays))
+		return
+	}
+
+	cleanup := func() {
+		deleted, err := CleanExpiredCaptures(retentionDays)
+		if err != nil {
+			logger.Logger.Warn("capture retention cleanup failed", zap.Error(err))
+			return
+		}
+		if deleted > 0 {
+			logger.Logger.Info("deleted expired request captures", zap.Int64("deleted_rows", deleted), zap.Int("capture_retention_days", retentionDays))
+		}
+	}
+
+	cleanup()
+
+	ticker := time.NewTicker(captureRetentionSweepInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Logger.Info("capture retention cleaner stopped")
+				return
+			case <-ticker.C:
+				cleanup()
+			}
+		}
+	}()
+
+	logger.Logger.Info("capture retention cleaner started", zap.Int("capture_retention_days", retentionDays))
+}
+
+// CleanExpiredCaptures deletes captures created more than retentionDays ago and rules that have expired.
+func CleanExpiredCaptures(retentionDays int) (int64, error) {
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+
+	now := time.Now().UTC()
+	if err := DB.Where("expires_at <= ?", now.UnixMilli()).Delete(&CaptureRule{}).Error; err != nil {
+		return 0, errors.Wrap(err, "delete expired capture rules")
+	}
+
+	cutoff := now.Add(-time.Duration(retentionDays) * 24 * time.Hour).UnixMilli()
+	tx := DB.Where("created_at < ?", cutoff).Delete(&RequestCapture{})
+	if tx.Error != nil {
+		return 0, errors.Wrap(tx.Error, "delete expired request captures")
+	}
+	return tx.RowsAffected, nil
+}
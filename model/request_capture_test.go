@@ -0,0 +1,83 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/config"
+)
+
+func TestCaptureRulesGateRequests(t *testing.T) {
+	setupTestDatabase(t)
+	require.NoError(t, DB.Exec("DELETE FROM capture_rules").Error)
+	ctx := context.Background()
+	require.NoError(t, ReloadCaptureRules(ctx))
+
+	_, err := CreateCaptureRule(ctx, &CaptureRule{UserId: 1, TokenId: 2}, time.Hour)
+	require.Error(t, err, "a rule names a user or a token, not both")
+	_, err = CreateCaptureRule(ctx, &CaptureRule{TokenId: 2}, 8*24*time.Hour)
+	require.Error(t, err, "rules are time-boxed")
+
+	require.False(t, ShouldCaptureRequest(901, 902))
+	rule, err := CreateCaptureRule(ctx, &CaptureRule{TokenId: 902, Remark: "ticket 42"}, time.Hour)
+	require.NoError(t, err)
+	require.NotEmpty(t, rule.UUID)
+	require.True(t, ShouldCaptureRequest(0, 902))
+	require.False(t, ShouldCaptureRequest(902, 0), "token rules do not match user ids")
+
+	rules, err := GetCaptureRules(ctx)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+
+	require.NoError(t, DeleteCaptureRuleByUUID(ctx, rule.UUID))
+	require.False(t, ShouldCaptureRequest(0, 902))
+	require.Error(t, DeleteCaptureRuleByUUID(ctx, rule.UUID))
+}
+
+func TestCleanExpiredCaptures(t *testing.T) {
+	setupTestDatabase(t)
+	require.NoError(t, DB.Exec("DELETE FROM request_captures WHERE request_id LIKE 'test-capture-%'").Error)
+	ctx := context.Background()
+
+	retentionDays := 7
+	for _, id := range []string{"test-capture-old", "test-capture-new"} {
+		require.NoError(t, SaveRequestCapture(ctx, &RequestCapture{RequestId: id, Response: "{}"}))
+	}
+	oldTimestamp := time.Now().UTC().Add(-time.Duration(retentionDays+1) * 24 * time.Hour).UnixMilli()
+	require.NoError(t, DB.Model(&RequestCapture{}).Where("request_id = ?", "test-capture-old").Update("created_at", oldTimestamp).Error)
+
+	expired := &CaptureRule{UserId: 903}
+	require.NoError(t, DB.Create(expired).Error)
+
+	deleted, err := CleanExpiredCaptures(retentionDays)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+
+	captures, total, err := GetRequestCaptures(ctx, RequestCaptureFilter{RequestId: "test-capture-new"}, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	require.Empty(t, captures[0].Response, "listings omit the bodies")
+
+	var rules int64
+	require.NoError(t, DB.Model(&CaptureRule{}).Where("id = ?", expired.Id).Count(&rules).Error)
+	require.Zero(t, rules, "expired rules are removed")
+}
+
+func TestCaptureBody(t *testing.T) {
+	stored, truncated := CaptureBody([]byte(`{"model":"gpt-4o","api_key":"sk-secret"}`), "application/json; charset=utf-8")
+	require.False(t, truncated)
+	require.NotContains(t, stored, "sk-secret")
+	require.Contains(t, stored, "gpt-4o")
+
+	stored, _ = CaptureBody([]byte("--boundary\r\nbinary"), "multipart/form-data; boundary=boundary")
+	require.Equal(t, "[multipart/form-data body, 18 bytes]", stored)
+
+	long := strings.Repeat("a", config.CaptureMaxBodyBytes+10)
+	stored, truncated = CaptureBody([]byte(long), "text/plain")
+	require.True(t, truncated)
+	require.Len(t, stored, config.CaptureMaxBodyBytes)
+}
@@ -0,0 +1,62 @@
+package model
+
+import "github.com/Laisky/one-api/dto"
+
+// ToResponse builds the external boundary DTO for a capture rule.
+func (rule *CaptureRule) ToResponse() dto.CaptureRuleResponse {
+	if rule == nil {
+		return dto.CaptureRuleResponse{}
+	}
+	return dto.CaptureRuleResponse{
+		UUID:      rule.UUID,
+		UserUUID:  rule.UserUUID,
+		TokenUUID: rule.TokenUUID,
+		ExpiresAt: rule.ExpiresAt,
+		Remark:    rule.Remark,
+		CreatedAt: rule.CreatedAt,
+	}
+}
+
+// CaptureRulesToResponses maps capture rules to their external DTOs.
+func CaptureRulesToResponses(rules []*CaptureRule) []dto.CaptureRuleResponse {
+	out := make([]dto.CaptureRuleResponse, 0, len(rules))
+	for _, rule := range rules {
+		out = append(out, rule.ToResponse())
+	}
+	return out
+}
+
+// ToResponse builds the external boundary DTO for a request capture,
+// including whichever bodies were loaded.
+func (capture *RequestCapture) ToResponse() dto.RequestCaptureResponse {
+	if capture == nil {
+		return dto.RequestCaptureResponse{}
+	}
+	return dto.RequestCaptureResponse{
+		UUID:            capture.UUID,
+		RequestId:       capture.RequestId,
+		UserUUID:        capture.UserUUID,
+		TokenUUID:       capture.TokenUUID,
+		ChannelUUID:     capture.ChannelUUID,
+		Model:           capture.Model,
+		Method:          capture.Method,
+		Path:            capture.Path,
+		IsStream:        capture.IsStream,
+		StatusCode:      capture.StatusCode,
+		InboundRequest:  capture.InboundRequest,
+		UpstreamURL:     capture.UpstreamURL,
+		UpstreamRequest: capture.UpstreamRequest,
+		Response:        capture.Response,
+		Truncated:       capture.Truncated,
+		CreatedAt:       capture.CreatedAt,
+	}
+}
+
+// RequestCapturesToResponses maps request captures to their external DTOs.
+func RequestCapturesToResponses(captures []*RequestCapture) []dto.RequestCaptureResponse {
+	out := make([]dto.RequestCaptureResponse, 0, len(captures))
+	for _, capture := range captures {
+		out = append(out, capture.ToResponse())
+	}
+	return out
+}
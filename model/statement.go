@@ -0,0 +1,617 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Laisky/one-api/common/errkind"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/logger"
+)
+
+const (
+	// StatementScopeUser covers the personal spend of one user; usage paid by
+	// an organization is on the organization's statement instead.
+	StatementScopeUser = "user"
+	// StatementScopeToken covers the usage of one token.
+	StatementScopeToken = "token"
+	// StatementScopeOrg covers the usage paid by one organization and its top-ups.
+	StatementScopeOrg = "org"
+	// StatementScopeAll selects every log row; it is only used by the admin
+	// bulk export and is never frozen.
+	StatementScopeAll = "all"
+)
+
+const (
+	// StatementItemUsage is a charge for a relayed request or an external tool call.
+	StatementItemUsage = "usage"
+	// StatementItemTopup is a quota credit from an admin, Stripe or a subscription grant.
+	StatementItemTopup = "topup"
+	// StatementItemRedemption is a quota credit from a redemption code.
+	StatementItemRedemption = "redemption"
+	// StatementItemRefund is a charge voided after the request failed; its
+	// quota is the amount returned.
+	StatementItemRefund = "refund"
+)
+
+const (
+	statementMonthLayout = "2006-01"
+	// statementFreezeGrace delays freezing a closed month so in-flight requests
+	// started before midnight can still be reconciled into it.
+	statementFreezeGrace         = time.Hour
+	statementFreezeSweepInterval = time.Hour
+	// statementFreezeCatchUpMonths is how many closed months the freezer
+	// revisits at startup, so months missed while it was down still freeze.
+	statementFreezeCatchUpMonths = 12
+	statementExportBatchSize     = 500
+	// refundedLogMetadataPattern matches the metadata of a consume log voided
+	// by a pre-consume refund, which records LogMetadataKeyRefundedQuota.
+	refundedLogMetadataPattern = `%"` + LogMetadataKeyRefundedQuota + `"%`
+)
+
+// StatementSubject identifies whose usage a statement covers. ID is the user
+// or organization id and UUID the external UUID of the user, organization or
+// token; frozen statements are keyed by UUID.
+type StatementSubject struct {
+	Scope string
+	ID    int
+	UUID  string
+}
+
+// UsageStatement is the breakdown of one subject's usage over one calendar
+// month (UTC). Quota values are in quota units.
+type UsageStatement struct {
+	Scope       string `json:"scope"`
+	SubjectUUID string `json:"subject_uuid"`
+	Month       string `json:"month"`
+	PeriodStart int64  `json:"period_start"`
+	PeriodEnd   int64  `json:"period_end"`
+	// Frozen is true once the month has closed and the statement was stored;
+	// frozen statements no longer change, even if logs are later deleted.
+	Frozen      bool                 `json:"frozen"`
+	GeneratedAt int64                `json:"generated_at"`
+	Totals      StatementTotals      `json:"totals"`
+	ByModel     []StatementUsageLine `json:"by_model"`
+	ByToken     []StatementUsageLine `json:"by_token"`
+	ByDay       []StatementUsageLine `json:"by_day"`
+	Credits     []StatementCredit    `json:"credits"`
+}
+
+// StatementTotals sums a statement. SpendQuota is the quota charged for usage;
+// the top-up, redemption and refund fields are quota credited back.
+type StatementTotals struct {
+	SpendQuota       int64 `json:"spend_quota"`
+	RequestCount     int64 `json:"request_count"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TopupQuota       int64 `json:"topup_quota"`
+	RedemptionQuota  int64 `json:"redemption_quota"`
+	RefundQuota      int64 `json:"refund_quota"`
+	RefundCount      int64 `json:"refund_count"`
+}
+
+// StatementUsageLine is the spend of one model, token or day. Name is the
+// model name, token name or YYYY-MM-DD day respectively.
+type StatementUsageLine struct {
+	Name             string `json:"name"`
+	TokenUUID        string `json:"token_uuid,omitempty"`
+	RequestCount     int64  `json:"request_count"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// StatementCredit is one top-up or redemption on a statement.
+type StatementCredit struct {
+	CreatedAt int64  `json:"created_at"`
+	Kind      string `json:"kind"`
+	Quota     int64  `json:"quota"`
+	Content   string `json:"content"`
+}
+
+// StatementItem is one line of a statement export.
+type StatementItem struct {
+	CreatedAt        int64  `json:"created_at"`
+	Kind             string `json:"kind"`
+	UserUUID         string `json:"user_uuid"`
+	Username         string `json:"username"`
+	TokenUUID        string `json:"token_uuid"`
+	TokenName        string `json:"token_name"`
+	ModelName        string `json:"model_name"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Quota            int64  `json:"quota"`
+	RequestId        string `json:"request_id"`
+}
+
+// FrozenStatement stores the statement of a closed month so it survives log
+// retention and later log edits.
+type FrozenStatement struct {
+	Id          int    `json:"-"`
+	Scope       string `json:"scope" gorm:"type:varchar(16);uniqueIndex:idx_frozen_statement,priority:1"`
+	SubjectUUID string `json:"subject_uuid" gorm:"type:char(36);uniqueIndex:idx_frozen_statement,priority:2"`
+	Month       string `json:"month" gorm:"type:char(7);uniqueIndex:idx_frozen_statement,priority:3;index"`
+	Data        string `json:"-" gorm:"type:text"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+}
+
+// TableName pins the frozen statement table name.
+func (FrozenStatement) TableName() string {
+	return "frozen_statements"
+}
+
+// ParseStatementMonth parses a YYYY-MM month and returns its UTC bounds as the
+// half-open Unix-second range [start, end). Months that have not started are
+// rejected.
+func ParseStatementMonth(month string) (start int64, end int64, err error) {
+	t, err := time.ParseInLocation(statementMonthLayout, strings.TrimSpace(month), time.UTC)
+	if err != nil {
+		return 0, 0, errkind.InvalidRequestErr(errors.Errorf("invalid month %q, expected YYYY-MM", month))
+	}
+	if t.Unix() > helper.GetTimestamp() {
+		return 0, 0, errkind.InvalidRequestErr(errors.Errorf("month %s has not started", month))
+	}
+	return t.Unix(), t.AddDate(0, 1, 0).Unix(), nil
+}
+
+// statementLogsScope selects the log rows of subject within [start, end).
+func statementLogsScope(ctx context.Context, subject StatementSubject, start int64, end int64) *gorm.DB {
+	tx := LOG_DB.WithContext(ctx).Table("logs").Where("created_at >= ? AND created_at < ?", start, end)
+	switch subject.Scope {
+	case StatementScopeUser:
+		tx = tx.Where("user_id = ? AND org_id = 0", subject.ID)
+	case StatementScopeOrg:
+		tx = tx.Where("org_id = ?", subject.ID)
+	case StatementScopeToken:
+		tx = tx.Where("token_uuid = ?", subject.UUID)
+	}
+	return tx
+}
+
+// statementSpendScope narrows tx to charged usage: relayed requests, and tool
+// rows written by the external consume API. Relay tool rows carry a channel
+// and are already included in their request's consume row, so they are left
+// out to avoid counting the same quota twice. Voided charges are refunds.
+func statementSpendScope(tx *gorm.DB) *gorm.DB {
+	return tx.Where("(type = ? OR (type = ? AND channel_id = 0))", LogTypeConsume, LogTypeTool).
+		Where("COALESCE(metadata, '') NOT LIKE ?", refundedLogMetadataPattern)
+}
+
+// statementLineRow is the scan target of the grouped spend queries.
+type statementLineRow struct {
+	Day              string
+	ModelName        string
+	TokenName        string
+	TokenUUID        string
+	RequestCount     int64
+	Quota            int64
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+func (r statementLineRow) line(name string) StatementUsageLine {
+	return StatementUsageLine{
+		Name:             name,
+		RequestCount:     r.RequestCount,
+		Quota:            r.Quota,
+		PromptTokens:     r.PromptTokens,
+		CompletionTokens: r.CompletionTokens,
+	}
+}
+
+const statementSumColumns = "count(1) as request_count, COALESCE(sum(quota), 0) as quota, " +
+	"COALESCE(sum(prompt_tokens), 0) as prompt_tokens, COALESCE(sum(completion_tokens), 0) as completion_tokens"
+
+// BuildUsageStatement computes the statement of subject for month from the
+// logs. The aggregation runs in the database, so only grouped rows and the
+// month's credits are loaded.
+func BuildUsageStatement(ctx context.Context, subject StatementSubject, month string) (*UsageStatement, error) {
+	start, end, err := ParseStatementMonth(month)
+	if err != nil {
+		return nil, err
+	}
+	stmt := &UsageStatement{
+		Scope:       subject.Scope,
+		SubjectUUID: subject.UUID,
+		Month:       month,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		GeneratedAt: helper.GetTimestamp(),
+		ByModel:     []StatementUsageLine{},
+		ByToken:     []StatementUsageLine{},
+		ByDay:       []StatementUsageLine{},
+		Credits:     []StatementCredit{},
+	}
+
+	var rows []statementLineRow
+	if err := statementSpendScope(statementLogsScope(ctx, subject, start, end)).
+		Select("model_name, " + statementSumColumns).
+		Group("model_name").Order("model_name").Scan(&rows).Error; err != nil {
+		return nil, errors.Wrap(err, "aggregate statement spend by model")
+	}
+	for _, row := range rows {
+		stmt.ByModel = append(stmt.ByModel, row.line(row.ModelName))
+		stmt.Totals.SpendQuota += row.Quota
+		stmt.Totals.RequestCount += row.RequestCount
+		stmt.Totals.PromptTokens += row.PromptTokens
+		stmt.Totals.CompletionTokens += row.CompletionTokens
+	}
+
+	rows = nil
+	if err := statementSpendScope(statementLogsScope(ctx, subject, start, end)).
+		Select("COALESCE(token_uuid, '') as token_uuid, COALESCE(token_name, '') as token_name, " + statementSumColumns).
+		Group("token_uuid, token_name").Order("token_name").Scan(&rows).Error; err != nil {
+		return nil, errors.Wrap(err, "aggregate statement spend by token")
+	}
+	for _, row := range rows {
+		line := row.line(row.TokenName)
+		line.TokenUUID = row.TokenUUID
+		stmt.ByToken = append(stmt.ByToken, line)
+	}
+
+	rows = nil
+	if err := statementSpendScope(statementLogsScope(ctx, subject, start, end)).
+		Select(dayAggregationSelect() + ", " + statementSumColumns).
+		Group("day").Order("day").Scan(&rows).Error; err != nil {
+		return nil, errors.Wrap(err, "aggregate statement spend by day")
+	}
+	for _, row := range rows {
+		stmt.ByDay = append(stmt.ByDay, row.line(row.Day))
+	}
+
+	var credits []Log
+	if err := statementLogsScope(ctx, subject, start, end).
+		Select("created_at", "content", "quota").
+		Where("type = ?", LogTypeTopup).Order("id").Find(&credits).Error; err != nil {
+		return nil, errors.Wrap(err, "list statement credits")
+	}
+	for _, log := range credits {
+		credit := StatementCredit{CreatedAt: log.CreatedAt, Kind: creditKind(log.Content), Quota: int64(log.Quota), Content: log.Content}
+		if credit.Kind == StatementItemRedemption {
+			stmt.Totals.RedemptionQuota += credit.Quota
+		} else {
+			stmt.Totals.TopupQuota += credit.Quota
+		}
+		stmt.Credits = append(stmt.Credits, credit)
+	}
+
+	// Refunds are summed here rather than in SQL because the amount lives in
+	// the row metadata. Rows are read one at a time.
+	refunds, err := statementLogsScope(ctx, subject, start, end).
+		Select("metadata").
+		Where("type = ? AND metadata LIKE ?", LogTypeConsume, refundedLogMetadataPattern).Rows()
+	if err != nil {
+		return nil, errors.Wrap(err, "query statement refunds")
+	}
+	defer refunds.Close()
+	for refunds.Next() {
+		var metadata LogMetadata
+		if err := refunds.Scan(&metadata); err != nil {
+			return nil, errors.Wrap(err, "scan statement refund")
+		}
+		stmt.Totals.RefundCount++
+		stmt.Totals.RefundQuota += refundedQuota(metadata)
+	}
+	if err := refunds.Err(); err != nil {
+		return nil, errors.Wrap(err, "iterate statement refunds")
+	}
+
+	return stmt, nil
+}
+
+// creditKind tells redemption-code top-ups from the others by their log content.
+func creditKind(content string) string {
+	if strings.HasSuffix(content, redemptionLogContentSuffix) {
+		return StatementItemRedemption
+	}
+	return StatementItemTopup
+}
+
+// refundedQuota reads LogMetadataKeyRefundedQuota from a voided consume log.
+func refundedQuota(metadata LogMetadata) int64 {
+	switch v := metadata[LogMetadataKeyRefundedQuota].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case json.Number:
+		n, _ := v.Int64()
+		return n
+	}
+	return 0
+}
+
+// GetUsageStatement returns the frozen statement of subject for month when
+// one exists, and otherwise computes it from the logs.
+func GetUsageStatement(ctx context.Context, subject StatementSubject, month string) (*UsageStatement, error) {
+	if _, _, err := ParseStatementMonth(month); err != nil {
+		return nil, err
+	}
+	if subject.Scope != StatementScopeAll {
+		var frozen FrozenStatement
+		err := DB.WithContext(ctx).
+			Where("scope = ? AND subject_uuid = ? AND month = ?", subject.Scope, subject.UUID, month).
+			First(&frozen).Error
+		switch {
+		case err == nil:
+			stmt := &UsageStatement{}
+			if err := json.Unmarshal([]byte(frozen.Data), stmt); err != nil {
+				return nil, errors.Wrapf(err, "decode frozen %s statement %s", subject.Scope, month)
+			}
+			return stmt, nil
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, errors.Wrapf(err, "get frozen %s statement %s", subject.Scope, month)
+		}
+	}
+	return BuildUsageStatement(ctx, subject, month)
+}
+
+// FreezeUsageStatement computes and stores the statement of subject for a
+// closed month. It reports false when the statement was already frozen.
+func FreezeUsageStatement(ctx context.Context, subject StatementSubject, month string) (bool, error) {
+	_, end, err := ParseStatementMonth(month)
+	if err != nil {
+		return false, err
+	}
+	if end > helper.GetTimestamp() {
+		return false, errors.Errorf("month %s has not closed", month)
+	}
+	var count int64
+	if err := DB.WithContext(ctx).Model(&FrozenStatement{}).
+		Where("scope = ? AND subject_uuid = ? AND month = ?", subject.Scope, subject.UUID, month).
+		Count(&count).Error; err != nil {
+		return false, errors.Wrapf(err, "check frozen %s statement %s", subject.Scope, month)
+	}
+	if count > 0 {
+		return false, nil
+	}
+	return storeFrozenStatement(ctx, subject, month)
+}
+
+// storeFrozenStatement builds the statement of subject for month and stores
+// it, leaving an existing frozen copy untouched.
+func storeFrozenStatement(ctx context.Context, subject StatementSubject, month string) (bool, error) {
+	stmt, err := BuildUsageStatement(ctx, subject, month)
+	if err != nil {
+		return false, err
+	}
+	stmt.Frozen = true
+	data, err := json.Marshal(stmt)
+	if err != nil {
+		return false, errors.Wrap(err, "encode statement")
+	}
+	result := DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&FrozenStatement{
+		Scope:       subject.Scope,
+		SubjectUUID: subject.UUID,
+		Month:       month,
+		Data:        string(data),
+		CreatedAt:   helper.GetTimestamp(),
+	})
+	if result.Error != nil {
+		return false, errors.Wrapf(result.Error, "store frozen %s statement %s", subject.Scope, month)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// frozenStatementSubjects returns the scope and subject UUID of every
+// statement already frozen for month.
+func frozenStatementSubjects(ctx context.Context, month string) (map[StatementSubject]bool, error) {
+	var rows []FrozenStatement
+	if err := DB.WithContext(ctx).Model(&FrozenStatement{}).
+		Select("scope", "subject_uuid").
+		Where("month = ?", month).
+		Find(&rows).Error; err != nil {
+		return nil, errors.Wrapf(err, "list frozen statements %s", month)
+	}
+	frozen := make(map[StatementSubject]bool, len(rows))
+	for _, row := range rows {
+		frozen[StatementSubject{Scope: row.Scope, UUID: row.SubjectUUID}] = true
+	}
+	return frozen, nil
+}
+
+// statementSubjects lists every user, organization and token with log rows
+// in [start, end).
+func statementSubjects(ctx context.Context, start int64, end int64) ([]StatementSubject, error) {
+	window := func() *gorm.DB {
+		return LOG_DB.WithContext(ctx).Table("logs").Where("created_at >= ? AND created_at < ?", start, end)
+	}
+	var subjects []StatementSubject
+
+	var userIDs []int
+	if err := window().Where("org_id = 0 AND user_id > 0").Distinct("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, errors.Wrap(err, "list statement users")
+	}
+	for _, id := range userIDs {
+		userUUID, err := GetUserUUIDByID(id)
+		if err != nil || userUUID == "" {
+			logger.Logger.Warn("skip statement of user without uuid", zap.Int("user_id", id), zap.Error(err))
+			continue
+		}
+		subjects = append(subjects, StatementSubject{Scope: StatementScopeUser, ID: id, UUID: userUUID})
+	}
+
+	var orgIDs []int
+	if err := window().Where("org_id > 0").Distinct("org_id").Pluck("org_id", &orgIDs).Error; err != nil {
+		return nil, errors.Wrap(err, "list statement organizations")
+	}
+	for _, id := range orgIDs {
+		org, err := GetOrganizationById(id)
+		if err != nil {
+			logger.Logger.Warn("skip statement of missing organization", zap.Int("org_id", id), zap.Error(err))
+			continue
+		}
+		subjects = append(subjects, StatementSubject{Scope: StatementScopeOrg, ID: id, UUID: org.UUID})
+	}
+
+	var tokenUUIDs []string
+	if err := window().Where("token_uuid IS NOT NULL AND token_uuid != ''").Distinct("token_uuid").Pluck("token_uuid", &tokenUUIDs).Error; err != nil {
+		return nil, errors.Wrap(err, "list statement tokens")
+	}
+	for _, tokenUUID := range tokenUUIDs {
+		subjects = append(subjects, StatementSubject{Scope: StatementScopeToken, UUID: tokenUUID})
+	}
+	return subjects, nil
+}
+
+// FreezeClosedMonthStatements freezes the statements of every subject with
+// usage in the given number of closed months before now, newest first. The
+// month that just closed is skipped until statementFreezeGrace has passed.
+// Subjects already frozen for a month are not rebuilt. It returns the number
+// of statements stored.
+func FreezeClosedMonthStatements(ctx context.Context, now time.Time, months int) (int, error) {
+	now = now.UTC()
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if now.Sub(end) < statementFreezeGrace {
+		end = end.AddDate(0, -1, 0)
+		months--
+	}
+	frozen := 0
+	for ; months > 0; months-- {
+		start := end.AddDate(0, -1, 0)
+		stored, err := freezeMonthStatements(ctx, start, end)
+		frozen += stored
+		if err != nil {
+			return frozen, err
+		}
+		end = start
+	}
+	return frozen, nil
+}
+
+// freezeMonthStatements freezes the statements of the month [start, end) for
+// every subject with usage in it that has none frozen yet.
+func freezeMonthStatements(ctx context.Context, start time.Time, end time.Time) (int, error) {
+	month := start.Format(statementMonthLayout)
+	done, err := frozenStatementSubjects(ctx, month)
+	if err != nil {
+		return 0, err
+	}
+	subjects, err := statementSubjects(ctx, start.Unix(), end.Unix())
+	if err != nil {
+		return 0, err
+	}
+	frozen := 0
+	for _, subject := range subjects {
+		if done[StatementSubject{Scope: subject.Scope, UUID: subject.UUID}] {
+			continue
+		}
+		stored, err := storeFrozenStatement(ctx, subject, month)
+		if err != nil {
+			return frozen, errors.Wrapf(err, "freeze %s statement %s for %s", subject.Scope, month, subject.UUID)
+		}
+		if stored {
+			frozen++
+		}
+	}
+	return frozen, nil
+}
+
+// StartStatementFreezer launches a background worker that freezes the
+// statements of the previous month once it has closed. At startup it also
+// freezes the statementFreezeCatchUpMonths months before.
+func StartStatementFreezer(ctx context.Context, enabled bool) {
+	if !enabled {
+		logger.Logger.Debug("statement freezer disabled")
+		return
+	}
+
+	freeze := func(months int) {
+		frozen, err := FreezeClosedMonthStatements(ctx, time.Now(), months)
+		if err != nil {
+			logger.Logger.Warn("statement freeze failed", zap.Error(err))
+			return
+		}
+		if frozen > 0 {
+			logger.Logger.Info("froze monthly statements", zap.Int("statements", frozen))
+		}
+	}
+
+	// Catch up on months missed while the freezer was down, then only watch
+	// the month that closed last.
+	freeze(statementFreezeCatchUpMonths)
+
+	ticker := time.NewTicker(statementFreezeSweepInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Logger.Info("statement freezer stopped")
+				return
+			case <-ticker.C:
+				freeze(1)
+			}
+		}
+	}()
+
+	logger.Logger.Info("statement freezer started")
+}
+
+// StreamStatementItems calls fn for every usage, top-up, redemption and
+// refund row of subject within month, oldest first. Rows are read in
+// id-ordered batches so exports never hold the whole month in memory.
+// Returning an error from fn stops the iteration with that error.
+func StreamStatementItems(ctx context.Context, subject StatementSubject, month string, fn func(*StatementItem) error) error {
+	start, end, err := ParseStatementMonth(month)
+	if err != nil {
+		return err
+	}
+	lastID := 0
+	for {
+		var batch []Log
+		if err := statementLogsScope(ctx, subject, start, end).
+			Where("(type = ? OR type = ? OR (type = ? AND channel_id = 0))", LogTypeConsume, LogTypeTopup, LogTypeTool).
+			Where("id > ?", lastID).
+			Order("id").Limit(statementExportBatchSize).Find(&batch).Error; err != nil {
+			return errors.Wrap(err, "read statement items")
+		}
+		for i := range batch {
+			if err := fn(statementItemFromLog(&batch[i])); err != nil {
+				return err
+			}
+		}
+		if len(batch) < statementExportBatchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].Id
+	}
+}
+
+func statementItemFromLog(log *Log) *StatementItem {
+	item := &StatementItem{
+		CreatedAt:        log.CreatedAt,
+		Kind:             StatementItemUsage,
+		Username:         log.Username,
+		TokenName:        log.TokenName,
+		ModelName:        log.ModelName,
+		PromptTokens:     log.PromptTokens,
+		CompletionTokens: log.CompletionTokens,
+		Quota:            int64(log.Quota),
+		RequestId:        log.RequestId,
+	}
+	if log.UserUUID != nil {
+		item.UserUUID = *log.UserUUID
+	}
+	if log.TokenUUID != nil {
+		item.TokenUUID = *log.TokenUUID
+	}
+	switch {
+	case log.Type == LogTypeTopup:
+		item.Kind = creditKind(log.Content)
+	case log.Type == LogTypeConsume && log.Metadata[LogMetadataKeyRefundedQuota] != nil:
+		item.Kind = StatementItemRefund
+		item.Quota = refundedQuota(log.Metadata)
+	}
+	return item
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common"
+)
+
+const (
+	statementTestMonth     = "2025-03"
+	statementTestUserUUID  = "11111111-1111-4111-8111-111111111111"
+	statementTestOrgUUID   = "22222222-2222-4222-8222-222222222222"
+	statementTestTokenMain = "33333333-3333-4333-8333-333333333333"
+	statementTestTokenCI   = "44444444-4444-4444-8444-444444444444"
+)
+
+// setupStatementTestDB installs one in-memory SQLite DB as both DB and LOG_DB
+// and seeds a user, an organization and a month of logs.
+func setupStatementTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&User{}, &Organization{}, &Log{}, &FrozenStatement{}))
+
+	prevDB, prevLogDB := DB, LOG_DB
+	prevSQLite := common.UsingSQLite.Load()
+	DB, LOG_DB = db, db
+	common.UsingSQLite.Store(true)
+	t.Cleanup(func() {
+		DB, LOG_DB = prevDB, prevLogDB
+		common.UsingSQLite.Store(prevSQLite)
+	})
+
+	require.NoError(t, db.Create(&User{Id: 1, UUID: statementTestUserUUID, Username: "alice", Password: "x", DisplayName: "a", Role: 1, Status: 1}).Error)
+	require.NoError(t, db.Create(&Organization{Id: 9, UUID: statementTestOrgUUID, Name: "acme"}).Error)
+
+	day := func(d int) int64 { return time.Date(2025, 3, d, 12, 0, 0, 0, time.UTC).Unix() }
+	main, ci := statementTestTokenMain, statementTestTokenCI
+	logs := []Log{
+		{Type: LogTypeConsume, CreatedAt: day(3), ModelName: "gpt-4o", TokenName: "main", TokenUUID: &main, Quota: 100, PromptTokens: 10, CompletionTokens: 5, ChannelId: 5},
+		{Type: LogTypeConsume, CreatedAt: day(3), ModelName: "gpt-4o", TokenName: "ci", TokenUUID: &ci, Quota: 50, PromptTokens: 4, CompletionTokens: 2, ChannelId: 5},
+		{Type: LogTypeConsume, CreatedAt: day(10), ModelName: "claude", TokenName: "main", TokenUUID: &main, Quota: 30, PromptTokens: 3, CompletionTokens: 1, ChannelId: 6},
+		// A relay tool row repeats quota already on its consume row.
+		{Type: LogTypeTool, CreatedAt: day(10), ModelName: "web_search", TokenName: "main", TokenUUID: &main, Quota: 20, ChannelId: 6},
+		// An external consume API charge has no channel.
+		{Type: LogTypeTool, CreatedAt: day(10), ModelName: "crawler", TokenName: "main", TokenUUID: &main, Quota: 7},
+		{Type: LogTypeConsume, CreatedAt: day(11), ModelName: "gpt-4o", TokenName: "main", TokenUUID: &main, Content: "refunded: upstream unavailable", ChannelId: 5,
+			Metadata: LogMetadata{LogMetadataKeyRefundedQuota: 40}},
+		{Type: LogTypeTopup, CreatedAt: day(1), Content: "Admin top-up", Quota: 1000},
+		{Type: LogTypeTopup, CreatedAt: day(2), Content: "Recharged $0.001 " + redemptionLogContentSuffix, Quota: 500},
+		// Spend paid by the organization is not on the personal statement.
+		{Type: LogTypeConsume, CreatedAt: day(12), ModelName: "gpt-4o", Quota: 999, OrgId: 9, ChannelId: 5},
+		{Type: LogTypeConsume, CreatedAt: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC).Unix(), ModelName: "gpt-4o", Quota: 1, ChannelId: 5},
+	}
+	for i := range logs {
+		logs[i].UserId = 1
+		require.NoError(t, db.Create(&logs[i]).Error)
+	}
+}
+
+var statementTestUser = StatementSubject{Scope: StatementScopeUser, ID: 1, UUID: statementTestUserUUID}
+
+func TestBuildUsageStatementForUser(t *testing.T) {
+	setupStatementTestDB(t)
+
+	stmt, err := BuildUsageStatement(context.Background(), statementTestUser, statementTestMonth)
+	require.NoError(t, err)
+	require.False(t, stmt.Frozen)
+	require.Equal(t, StatementTotals{
+		SpendQuota: 187, RequestCount: 4, PromptTokens: 17, CompletionTokens: 8,
+		TopupQuota: 1000, RedemptionQuota: 500, RefundQuota: 40, RefundCount: 1,
+	}, stmt.Totals)
+
+	require.Equal(t, []StatementUsageLine{
+		{Name: "claude", RequestCount: 1, Quota: 30, PromptTokens: 3, CompletionTokens: 1},
+		{Name: "crawler", RequestCount: 1, Quota: 7},
+		{Name: "gpt-4o", RequestCount: 2, Quota: 150, PromptTokens: 14, CompletionTokens: 7},
+	}, stmt.ByModel)
+	require.Equal(t, []StatementUsageLine{
+		{Name: "ci", TokenUUID: statementTestTokenCI, RequestCount: 1, Quota: 50, PromptTokens: 4, CompletionTokens: 2},
+		{Name: "main", TokenUUID: statementTestTokenMain, RequestCount: 3, Quota: 137, PromptTokens: 13, CompletionTokens: 6},
+	}, stmt.ByToken)
+	require.Len(t, stmt.ByDay, 2)
+	require.Equal(t, "2025-03-03", stmt.ByDay[0].Name)
+	require.Equal(t, int64(150), stmt.ByDay[0].Quota)
+	require.Equal(t, "2025-03-10", stmt.ByDay[1].Name)
+	require.Equal(t, int64(37), stmt.ByDay[1].Quota)
+
+	require.Len(t, stmt.Credits, 2)
+	require.Equal(t, StatementItemTopup, stmt.Credits[0].Kind)
+	require.Equal(t, StatementItemRedemption, stmt.Credits[1].Kind)
+}
+
+func TestBuildUsageStatementForTokenAndOrg(t *testing.T) {
+	setupStatementTestDB(t)
+	ctx := context.Background()
+
+	stmt, err := BuildUsageStatement(ctx, StatementSubject{Scope: StatementScopeToken, UUID: statementTestTokenCI}, statementTestMonth)
+	require.NoError(t, err)
+	require.Equal(t, int64(50), stmt.Totals.SpendQuota)
+	require.Empty(t, stmt.Credits)
+
+	stmt, err = BuildUsageStatement(ctx, StatementSubject{Scope: StatementScopeOrg, ID: 9, UUID: statementTestOrgUUID}, statementTestMonth)
+	require.NoError(t, err)
+	require.Equal(t, int64(999), stmt.Totals.SpendQuota)
+}
+
+func TestParseStatementMonth(t *testing.T) {
+	start, end, err := ParseStatementMonth("2024-02")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC).Unix(), start)
+	require.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Unix(), end)
+
+	for _, invalid := range []string{"2024-13", "2024/02", "", time.Now().AddDate(0, 2, 0).Format("2006-01")} {
+		_, _, err := ParseStatementMonth(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+// TestFreezeClosedMonthStatements freezes every subject once and serves the
+// frozen copy after the logs are gone.
+func TestFreezeClosedMonthStatements(t *testing.T) {
+	setupStatementTestDB(t)
+	ctx := context.Background()
+
+	frozen, err := FreezeClosedMonthStatements(ctx, time.Date(2025, 4, 1, 0, 30, 0, 0, time.UTC), 1)
+	require.NoError(t, err)
+	require.Zero(t, frozen, "the month is still in its grace period")
+
+	after := time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC)
+	frozen, err = FreezeClosedMonthStatements(ctx, after, 1)
+	require.NoError(t, err)
+	require.Equal(t, 4, frozen, "one user, one organization and two tokens")
+	frozen, err = FreezeClosedMonthStatements(ctx, after, 1)
+	require.NoError(t, err)
+	require.Zero(t, frozen)
+
+	require.NoError(t, LOG_DB.Where("1 = 1").Delete(&Log{}).Error)
+	stmt, err := GetUsageStatement(ctx, statementTestUser, statementTestMonth)
+	require.NoError(t, err)
+	require.True(t, stmt.Frozen)
+	require.Equal(t, int64(187), stmt.Totals.SpendQuota)
+}
+
+// TestFreezeClosedMonthStatementsSkipsFrozenAndCatchesUp rebuilds nothing for
+// subjects already frozen and freezes older months that were missed.
+func TestFreezeClosedMonthStatementsSkipsFrozenAndCatchesUp(t *testing.T) {
+	setupStatementTestDB(t)
+	ctx := context.Background()
+
+	var logQueries int
+	require.NoError(t, LOG_DB.Callback().Query().After("gorm:query").Register("test:count_log_queries", func(tx *gorm.DB) {
+		if tx.Statement.Table == "logs" {
+			logQueries++
+		}
+	}))
+
+	t.Cleanup(func() { _ = LOG_DB.Callback().Query().Remove("test:count_log_queries") })
+
+	// Three months after the statement month: the catch-up still reaches it.
+	later := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	frozen, err := FreezeClosedMonthStatements(ctx, later, 1)
+	require.NoError(t, err)
+	require.Zero(t, frozen, "nothing was used in May")
+	frozen, err = FreezeClosedMonthStatements(ctx, later, 3)
+	require.NoError(t, err)
+	require.Equal(t, 5, frozen, "the March subjects and the one using April")
+
+	// Only the subject listings hit the logs once everything is frozen.
+	logQueries = 0
+	frozen, err = FreezeClosedMonthStatements(ctx, later, 3)
+	require.NoError(t, err)
+	require.Zero(t, frozen)
+	require.Equal(t, 9, logQueries, "three subject listings for each of the three months")
+}
+
+func TestStreamStatementItems(t *testing.T) {
+	setupStatementTestDB(t)
+
+	var items []*StatementItem
+	require.NoError(t, StreamStatementItems(context.Background(), statementTestUser, statementTestMonth, func(item *StatementItem) error {
+		items = append(items, item)
+		return nil
+	}))
+
+	kinds := make([]string, 0, len(items))
+	for _, item := range items {
+		kinds = append(kinds, item.Kind)
+	}
+	require.Equal(t, []string{
+		StatementItemUsage, StatementItemUsage, StatementItemUsage, StatementItemUsage,
+		StatementItemRefund, StatementItemTopup, StatementItemRedemption,
+	}, kinds)
+	require.Equal(t, int64(40), items[4].Quota)
+	require.Equal(t, statementTestTokenMain, items[0].TokenUUID)
+}
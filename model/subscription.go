@@ -0,0 +1,485 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common/logger"
+)
+
+const (
+	// SubscriptionStatusActive is a subscription whose latest period is paid.
+	SubscriptionStatusActive = "active"
+	// SubscriptionStatusTrialing is a subscription in its free trial.
+	SubscriptionStatusTrialing = "trialing"
+	// SubscriptionStatusPastDue is a subscription whose renewal failed while
+	// Stripe still retries the payment.
+	SubscriptionStatusPastDue = "past_due"
+	// SubscriptionStatusCanceled is a subscription that ended.
+	SubscriptionStatusCanceled = "canceled"
+)
+
+// ErrSubscriptionNotFound is returned when a Stripe subscription has no local row.
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// SubscriptionPlan is a recurring tier sold through Stripe. Every paid billing
+// period grants Quota, and while the subscription is in good standing the
+// subscriber is moved to Group.
+type SubscriptionPlan struct {
+	// Name is the label shown to users.
+	Name string `json:"name"`
+	// StripePriceID is the recurring Stripe price (price_...) the plan sells.
+	StripePriceID string `json:"stripe_price_id"`
+	// Quota is granted once per paid billing period.
+	Quota int64 `json:"quota"`
+	// Group is the user group of subscribers. Empty leaves the group alone.
+	Group string `json:"group,omitempty"`
+}
+
+// SubscriptionPlanView is a plan as listed to users.
+type SubscriptionPlanView struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Quota int64  `json:"quota"`
+	Group string `json:"group,omitempty"`
+}
+
+var subscriptionPlansLock sync.RWMutex
+
+// subscriptionPlans maps a plan id to its plan, e.g.
+// {"pro": {"name": "Pro", "stripe_price_id": "price_123", "quota": 25000000, "group": "vip"}}.
+// It is loaded from the SubscriptionPlans option.
+var subscriptionPlans = map[string]SubscriptionPlan{}
+
+// ParseSubscriptionPlans decodes and validates a SubscriptionPlans option
+// value. An empty value removes every plan.
+//
+// Parameters:
+//   - jsonStr: JSON object mapping a plan id to its plan.
+//
+// Returns:
+//   - map[string]SubscriptionPlan: the plans with ids, names, prices and groups trimmed.
+//   - error: when the JSON is malformed, an id or price is blank, two plans
+//     share a price, or a quota is negative.
+func ParseSubscriptionPlans(jsonStr string) (map[string]SubscriptionPlan, error) {
+	result := map[string]SubscriptionPlan{}
+	if strings.TrimSpace(jsonStr) == "" {
+		return result, nil
+	}
+
+	var raw map[string]SubscriptionPlan
+	if err := json.Unmarshal([]byte(jsonStr), &raw); err != nil {
+		return nil, errors.Wrap(err, "unmarshal subscription plans")
+	}
+	prices := make(map[string]string, len(raw))
+	for id, plan := range raw {
+		id = strings.TrimSpace(id)
+		plan.Name = strings.TrimSpace(plan.Name)
+		plan.StripePriceID = strings.TrimSpace(plan.StripePriceID)
+		plan.Group = strings.TrimSpace(plan.Group)
+		switch {
+		case id == "":
+			return nil, errors.New("subscription plan has an empty id")
+		case len(id) > 64:
+			return nil, errors.Errorf("subscription plan id %q is longer than 64 characters", id)
+		case plan.StripePriceID == "":
+			return nil, errors.Errorf("subscription plan %q has no stripe_price_id", id)
+		case plan.Quota < 0:
+			return nil, errors.Errorf("subscription plan %q has a negative quota", id)
+		case len(plan.Group) > 32:
+			return nil, errors.Errorf("subscription plan %q group is longer than 32 characters", id)
+		}
+		if other, ok := prices[plan.StripePriceID]; ok {
+			return nil, errors.Errorf("subscription plans %q and %q share price %q", other, id, plan.StripePriceID)
+		}
+		prices[plan.StripePriceID] = id
+		if plan.Name == "" {
+			plan.Name = id
+		}
+		result[id] = plan
+	}
+	return result, nil
+}
+
+// UpdateSubscriptionPlansByJSONString replaces the plans with those in jsonStr.
+func UpdateSubscriptionPlansByJSONString(jsonStr string) error {
+	plans, err := ParseSubscriptionPlans(jsonStr)
+	if err != nil {
+		return errors.Wrap(err, "parse subscription plans")
+	}
+	subscriptionPlansLock.Lock()
+	subscriptionPlans = plans
+	subscriptionPlansLock.Unlock()
+	return nil
+}
+
+// SubscriptionPlans2JSONString encodes the plans for the option map.
+func SubscriptionPlans2JSONString() string {
+	subscriptionPlansLock.RLock()
+	defer subscriptionPlansLock.RUnlock()
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(subscriptionPlans); err != nil {
+		logger.Logger.Error("failed to marshal subscription plans", zap.Error(err))
+		return "{}"
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// GetSubscriptionPlan returns the plan with id.
+func GetSubscriptionPlan(id string) (SubscriptionPlan, bool) {
+	subscriptionPlansLock.RLock()
+	defer subscriptionPlansLock.RUnlock()
+	plan, ok := subscriptionPlans[strings.TrimSpace(id)]
+	return plan, ok
+}
+
+// GetSubscriptionPlanByPriceID returns the id and plan selling priceID.
+func GetSubscriptionPlanByPriceID(priceID string) (string, SubscriptionPlan, bool) {
+	subscriptionPlansLock.RLock()
+	defer subscriptionPlansLock.RUnlock()
+	for id, plan := range subscriptionPlans {
+		if plan.StripePriceID == priceID {
+			return id, plan, true
+		}
+	}
+	return "", SubscriptionPlan{}, false
+}
+
+// ListSubscriptionPlans returns every plan ordered by quota, then id.
+func ListSubscriptionPlans() []SubscriptionPlanView {
+	subscriptionPlansLock.RLock()
+	defer subscriptionPlansLock.RUnlock()
+	views := make([]SubscriptionPlanView, 0, len(subscriptionPlans))
+	for id, plan := range subscriptionPlans {
+		views = append(views, SubscriptionPlanView{ID: id, Name: plan.Name, Quota: plan.Quota, Group: plan.Group})
+	}
+	sort.Slice(views, func(i, j int) bool {
+		if views[i].Quota != views[j].Quota {
+			return views[i].Quota < views[j].Quota
+		}
+		return views[i].ID < views[j].ID
+	})
+	return views
+}
+
+// Subscription mirrors one Stripe subscription of a user. Status is Stripe's
+// subscription status. AppliedGroup is the plan group the user was moved to,
+// and PreviousGroup the group they had before, restored on downgrade.
+type Subscription struct {
+	Id                   int    `json:"-" gorm:"primaryKey"`
+	UserId               int    `json:"-" gorm:"index"`
+	PlanID               string `json:"plan_id" gorm:"type:varchar(64)"`
+	StripeCustomerID     string `json:"-" gorm:"type:varchar(191);index"`
+	StripeSubscriptionID string `json:"-" gorm:"type:varchar(191);uniqueIndex"`
+	Status               string `json:"status" gorm:"type:varchar(32);index"`
+	CancelAtPeriodEnd    bool   `json:"cancel_at_period_end"`
+	CurrentPeriodStart   int64  `json:"current_period_start" gorm:"bigint"`
+	CurrentPeriodEnd     int64  `json:"current_period_end" gorm:"bigint"`
+	AppliedGroup         string `json:"applied_group" gorm:"type:varchar(32)"`
+	PreviousGroup        string `json:"previous_group" gorm:"type:varchar(32)"`
+	// LastEventAt is the creation time (Unix seconds) of the newest Stripe
+	// event applied, so events delivered out of order do not roll the state back.
+	LastEventAt int64 `json:"-" gorm:"bigint"`
+	CreatedAt   int64 `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
+	UpdatedAt   int64 `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
+	CanceledAt  int64 `json:"canceled_at" gorm:"bigint"`
+}
+
+// TableName returns the database table name for Subscription.
+func (Subscription) TableName() string {
+	return "subscriptions"
+}
+
+// SubscriptionGrant records the quota granted for one billing period. The
+// unique (subscription, period start) pair makes every period grant once.
+type SubscriptionGrant struct {
+	Id             int    `json:"id" gorm:"primaryKey"`
+	SubscriptionId int    `json:"subscription_id" gorm:"uniqueIndex:idx_subscription_grants_period,priority:1"`
+	PeriodStart    int64  `json:"period_start" gorm:"bigint;uniqueIndex:idx_subscription_grants_period,priority:2"`
+	PeriodEnd      int64  `json:"period_end" gorm:"bigint"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	PlanID         string `json:"plan_id" gorm:"type:varchar(64)"`
+	InvoiceID      string `json:"-" gorm:"type:varchar(191)"`
+	Quota          int64  `json:"quota" gorm:"bigint"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
+}
+
+// TableName returns the database table name for SubscriptionGrant.
+func (SubscriptionGrant) TableName() string {
+	return "subscription_grants"
+}
+
+// SubscriptionEntitled reports whether status keeps the plan group. Only paid
+// and trialing subscriptions do; a past-due subscription loses the group until
+// Stripe collects the renewal, as do canceled, unpaid, paused and never-paid
+// ones.
+func SubscriptionEntitled(status string) bool {
+	switch status {
+	case SubscriptionStatusActive, SubscriptionStatusTrialing:
+		return true
+	default:
+		return false
+	}
+}
+
+// StripeSubscriptionState is the state of a Stripe subscription carried by a
+// webhook event.
+type StripeSubscriptionState struct {
+	SubscriptionID     string
+	CustomerID         string
+	UserID             int
+	PlanID             string
+	Status             string
+	CancelAtPeriodEnd  bool
+	CurrentPeriodStart int64
+	CurrentPeriodEnd   int64
+	CanceledAt         int64
+	// EventCreated is the creation time of the event, in Unix seconds.
+	EventCreated int64
+}
+
+// SyncStripeSubscription stores state and moves the user into or out of the
+// plan group to match it.
+//
+// Parameters:
+//   - ctx: scopes the database calls.
+//   - state: the subscription state. UserID and PlanID are only needed the
+//     first time a subscription is seen; later events keep the stored values
+//     when they are empty.
+//
+// Returns:
+//   - *Subscription: the stored subscription.
+//   - bool: whether the user's group changed.
+//   - error: ErrSubscriptionNotFound when an unknown subscription names no
+//     user or plan, or a wrapped database error.
+func SyncStripeSubscription(ctx context.Context, state StripeSubscriptionState) (sub *Subscription, groupChanged bool, err error) {
+	state.SubscriptionID = strings.TrimSpace(state.SubscriptionID)
+	if state.SubscriptionID == "" {
+		return nil, false, errors.New("stripe subscription id is empty")
+	}
+	err = DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var found Subscription
+		e := tx.Where("stripe_subscription_id = ?", state.SubscriptionID).First(&found).Error
+		switch {
+		case errors.Is(e, gorm.ErrRecordNotFound):
+			if state.UserID <= 0 || state.PlanID == "" {
+				return ErrSubscriptionNotFound
+			}
+			found = Subscription{
+				UserId:               state.UserID,
+				PlanID:               state.PlanID,
+				StripeSubscriptionID: state.SubscriptionID,
+			}
+		case e != nil:
+			return errors.Wrap(e, "load subscription")
+		case state.EventCreated > 0 && state.EventCreated < found.LastEventAt:
+			// A newer event already updated the subscription.
+			sub = &found
+			return nil
+		}
+
+		if state.PlanID != "" {
+			found.PlanID = state.PlanID
+		}
+		if state.CustomerID != "" {
+			found.StripeCustomerID = state.CustomerID
+		}
+		if state.Status != "" {
+			found.Status = state.Status
+		}
+		found.CancelAtPeriodEnd = state.CancelAtPeriodEnd
+		if state.CurrentPeriodStart > 0 {
+			found.CurrentPeriodStart = state.CurrentPeriodStart
+			found.CurrentPeriodEnd = state.CurrentPeriodEnd
+		}
+		if state.CanceledAt > 0 {
+			found.CanceledAt = state.CanceledAt
+		}
+		if state.EventCreated > found.LastEventAt {
+			found.LastEventAt = state.EventCreated
+		}
+
+		changed, e := applySubscriptionGroup(tx, &found)
+		if e != nil {
+			return e
+		}
+		groupChanged = changed
+		if e := tx.Save(&found).Error; e != nil {
+			return errors.Wrap(e, "save subscription")
+		}
+		sub = &found
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return sub, groupChanged, nil
+}
+
+// applySubscriptionGroup moves the user into the plan group while the
+// subscription is entitled, and back to the previous group once it is not.
+// The previous group is only restored when the user is still in the group the
+// subscription applied, so a group an admin set meanwhile is kept.
+func applySubscriptionGroup(tx *gorm.DB, sub *Subscription) (bool, error) {
+	target := ""
+	if plan, ok := GetSubscriptionPlan(sub.PlanID); ok && SubscriptionEntitled(sub.Status) {
+		target = plan.Group
+	}
+	if target == sub.AppliedGroup {
+		return false, nil
+	}
+
+	var user User
+	if err := tx.Select("id", "group").Where("id = ?", sub.UserId).First(&user).Error; err != nil {
+		return false, errors.Wrapf(err, "load group of user %d", sub.UserId)
+	}
+	next := user.Group
+	switch {
+	case target != "" && sub.AppliedGroup == "":
+		sub.PreviousGroup = user.Group
+		next = target
+	case target != "":
+		// The plan or its group changed while subscribed.
+		if user.Group == sub.AppliedGroup {
+			next = target
+		}
+	default:
+		if user.Group == sub.AppliedGroup {
+			next = sub.PreviousGroup
+			if next == "" {
+				next = "default"
+			}
+		}
+	}
+	sub.AppliedGroup = target
+	if next == user.Group {
+		return false, nil
+	}
+	if err := tx.Model(&User{}).Where("id = ?", sub.UserId).Update("group", next).Error; err != nil {
+		return false, errors.Wrapf(err, "update group of user %d", sub.UserId)
+	}
+	return true, nil
+}
+
+// errSubscriptionPeriodGranted rolls back a grant that lost the race for its period.
+var errSubscriptionPeriodGranted = errors.New("subscription period already granted")
+
+// GrantSubscriptionPeriod credits the plan quota for one paid billing period.
+//
+// Parameters:
+//   - ctx: scopes the database calls.
+//   - subscriptionID: the Stripe subscription id.
+//   - invoiceID: the paid Stripe invoice, kept for reference.
+//   - periodStart, periodEnd: the billing period, in Unix seconds.
+//
+// Returns:
+//   - bool: true when this call granted the quota, false when the period was
+//     granted before.
+//   - *SubscriptionGrant: the new grant, nil when nothing was granted.
+//   - error: ErrSubscriptionNotFound for an unknown subscription, or an error
+//     when the plan is no longer configured or the user is missing.
+func GrantSubscriptionPeriod(ctx context.Context, subscriptionID, invoiceID string, periodStart, periodEnd int64) (granted bool, grant *SubscriptionGrant, err error) {
+	err = DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var sub Subscription
+		if e := tx.Where("stripe_subscription_id = ?", subscriptionID).First(&sub).Error; e != nil {
+			if errors.Is(e, gorm.ErrRecordNotFound) {
+				return ErrSubscriptionNotFound
+			}
+			return errors.Wrap(e, "load subscription for grant")
+		}
+		var existing int64
+		if e := tx.Model(&SubscriptionGrant{}).
+			Where("subscription_id = ? AND period_start = ?", sub.Id, periodStart).
+			Count(&existing).Error; e != nil {
+			return errors.Wrap(e, "count subscription grants")
+		}
+		if existing > 0 {
+			return nil
+		}
+		plan, ok := GetSubscriptionPlan(sub.PlanID)
+		if !ok {
+			return errors.Errorf("subscription plan %q is not configured", sub.PlanID)
+		}
+
+		row := &SubscriptionGrant{
+			SubscriptionId: sub.Id,
+			PeriodStart:    periodStart,
+			PeriodEnd:      periodEnd,
+			UserId:         sub.UserId,
+			PlanID:         sub.PlanID,
+			InvoiceID:      invoiceID,
+			Quota:          plan.Quota,
+		}
+		if e := tx.Create(row).Error; e != nil {
+			if isDuplicateKeyError(e) {
+				return errSubscriptionPeriodGranted
+			}
+			return errors.Wrap(e, "create subscription grant")
+		}
+		if plan.Quota > 0 {
+			res := tx.Model(&User{}).Where("id = ?", sub.UserId).Update("quota", gorm.Expr("quota + ?", plan.Quota))
+			if res.Error != nil {
+				return errors.Wrapf(res.Error, "increase quota for user %d", sub.UserId)
+			}
+			if res.RowsAffected != 1 {
+				return errors.Errorf("user %d of subscription %d not found", sub.UserId, sub.Id)
+			}
+		}
+		if periodStart >= sub.CurrentPeriodStart {
+			if e := tx.Model(&sub).Updates(map[string]any{
+				"current_period_start": periodStart,
+				"current_period_end":   periodEnd,
+			}).Error; e != nil {
+				return errors.Wrap(e, "update subscription period")
+			}
+		}
+		granted = true
+		grant = row
+		return nil
+	})
+	if errors.Is(err, errSubscriptionPeriodGranted) {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return granted, grant, nil
+}
+
+// GetLatestSubscriptionForUser returns the user's newest subscription, or nil
+// when they never subscribed.
+func GetLatestSubscriptionForUser(ctx context.Context, userID int) (*Subscription, error) {
+	var sub Subscription
+	err := DB.WithContext(ctx).Where("user_id = ?", userID).Order("id desc").First(&sub).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "lookup latest subscription")
+	}
+	return &sub, nil
+}
+
+// GetStripeCustomerIDForUser returns the Stripe customer of the user's newest
+// subscription, or "" when they have none.
+func GetStripeCustomerIDForUser(ctx context.Context, userID int) (string, error) {
+	var customerID string
+	err := DB.WithContext(ctx).Model(&Subscription{}).
+		Where("user_id = ? AND stripe_customer_id <> ''", userID).
+		Order("id desc").Limit(1).
+		Pluck("stripe_customer_id", &customerID).Error
+	if err != nil {
+		return "", errors.Wrap(err, "lookup stripe customer")
+	}
+	return customerID, nil
+}
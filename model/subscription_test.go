@@ -0,0 +1,159 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setupSubscriptionTestDB installs an in-memory SQLite DB with one user in group "default".
+func setupSubscriptionTestDB(t *testing.T) *User {
+	t.Helper()
+	setupPaymentTestDB(t)
+	require.NoError(t, DB.AutoMigrate(&Subscription{}, &SubscriptionGrant{}))
+
+	prev := SubscriptionPlans2JSONString()
+	t.Cleanup(func() { require.NoError(t, UpdateSubscriptionPlansByJSONString(prev)) })
+	require.NoError(t, UpdateSubscriptionPlansByJSONString(`{
+		"pro": {"name": "Pro", "stripe_price_id": "price_pro", "quota": 25000000, "group": "vip"},
+		"team": {"name": "Team", "stripe_price_id": "price_team", "quota": 100000000, "group": "team"}}`))
+
+	user := &User{Id: 1, Username: "sub-user", Password: "x", DisplayName: "s", Role: 1, Status: 1, Quota: 100, Group: "default"}
+	require.NoError(t, DB.Create(user).Error)
+	return user
+}
+
+func userGroupAndQuota(t *testing.T, id int) (string, int64) {
+	t.Helper()
+	var user User
+	require.NoError(t, DB.Select("id", "group", "quota").Where("id = ?", id).First(&user).Error)
+	return user.Group, user.Quota
+}
+
+func TestParseSubscriptionPlans(t *testing.T) {
+	plans, err := ParseSubscriptionPlans(`{" pro ": {"stripe_price_id": " price_pro ", "quota": 10, "group": "vip"}}`)
+	require.NoError(t, err)
+	require.Equal(t, SubscriptionPlan{Name: "pro", StripePriceID: "price_pro", Quota: 10, Group: "vip"}, plans["pro"])
+
+	plans, err = ParseSubscriptionPlans("")
+	require.NoError(t, err)
+	require.Empty(t, plans)
+
+	for _, invalid := range []string{
+		`{"pro": {"quota": 10}}`,
+		`{"pro": {"stripe_price_id": "price_pro", "quota": -1}}`,
+		`{"a": {"stripe_price_id": "price_x"}, "b": {"stripe_price_id": "price_x"}}`,
+		`{"": {"stripe_price_id": "price_x"}}`,
+		`[]`,
+	} {
+		_, err := ParseSubscriptionPlans(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+// TestSyncStripeSubscriptionMovesGroup upgrades the user while the subscription
+// is in good standing and restores the previous group once it is not.
+func TestSyncStripeSubscriptionMovesGroup(t *testing.T) {
+	user := setupSubscriptionTestDB(t)
+	ctx := context.Background()
+
+	sub, changed, err := SyncStripeSubscription(ctx, StripeSubscriptionState{
+		SubscriptionID: "sub_1", CustomerID: "cus_1", UserID: user.Id, PlanID: "pro",
+		Status: SubscriptionStatusActive, EventCreated: 100,
+	})
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "vip", sub.AppliedGroup)
+	require.Equal(t, "default", sub.PreviousGroup)
+	group, _ := userGroupAndQuota(t, user.Id)
+	require.Equal(t, "vip", group)
+
+	// Past due drops the group until the renewal is paid.
+	_, changed, err = SyncStripeSubscription(ctx, StripeSubscriptionState{SubscriptionID: "sub_1", Status: SubscriptionStatusPastDue, EventCreated: 200})
+	require.NoError(t, err)
+	require.True(t, changed)
+	group, _ = userGroupAndQuota(t, user.Id)
+	require.Equal(t, "default", group)
+
+	// A paid renewal restores it.
+	_, changed, err = SyncStripeSubscription(ctx, StripeSubscriptionState{SubscriptionID: "sub_1", Status: SubscriptionStatusActive, EventCreated: 250})
+	require.NoError(t, err)
+	require.True(t, changed)
+	group, _ = userGroupAndQuota(t, user.Id)
+	require.Equal(t, "vip", group)
+
+	// Plan changes move the user to the new plan's group.
+	_, changed, err = SyncStripeSubscription(ctx, StripeSubscriptionState{SubscriptionID: "sub_1", PlanID: "team", Status: SubscriptionStatusActive, EventCreated: 300})
+	require.NoError(t, err)
+	require.True(t, changed)
+	group, _ = userGroupAndQuota(t, user.Id)
+	require.Equal(t, "team", group)
+
+	// An event older than the last one applied is ignored.
+	_, changed, err = SyncStripeSubscription(ctx, StripeSubscriptionState{SubscriptionID: "sub_1", Status: "unpaid", EventCreated: 250})
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	sub, changed, err = SyncStripeSubscription(ctx, StripeSubscriptionState{SubscriptionID: "sub_1", Status: "unpaid", EventCreated: 400})
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Empty(t, sub.AppliedGroup)
+	group, _ = userGroupAndQuota(t, user.Id)
+	require.Equal(t, "default", group)
+
+	// Unknown subscriptions without user and plan are not ours.
+	_, _, err = SyncStripeSubscription(ctx, StripeSubscriptionState{SubscriptionID: "sub_other", Status: SubscriptionStatusActive})
+	require.ErrorIs(t, err, ErrSubscriptionNotFound)
+}
+
+// TestSyncStripeSubscriptionKeepsAdminGroup leaves a group set by an admin
+// during the subscription in place on cancellation.
+func TestSyncStripeSubscriptionKeepsAdminGroup(t *testing.T) {
+	user := setupSubscriptionTestDB(t)
+	ctx := context.Background()
+
+	_, _, err := SyncStripeSubscription(ctx, StripeSubscriptionState{SubscriptionID: "sub_1", UserID: user.Id, PlanID: "pro", Status: SubscriptionStatusActive})
+	require.NoError(t, err)
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("group", "partner").Error)
+
+	_, changed, err := SyncStripeSubscription(ctx, StripeSubscriptionState{SubscriptionID: "sub_1", Status: SubscriptionStatusCanceled})
+	require.NoError(t, err)
+	require.False(t, changed)
+	group, _ := userGroupAndQuota(t, user.Id)
+	require.Equal(t, "partner", group)
+}
+
+// TestGrantSubscriptionPeriodOncePerPeriod credits each billing period once.
+func TestGrantSubscriptionPeriodOncePerPeriod(t *testing.T) {
+	user := setupSubscriptionTestDB(t)
+	ctx := context.Background()
+
+	_, _, err := GrantSubscriptionPeriod(ctx, "sub_1", "in_1", 1000, 2000)
+	require.ErrorIs(t, err, ErrSubscriptionNotFound)
+
+	_, _, err = SyncStripeSubscription(ctx, StripeSubscriptionState{SubscriptionID: "sub_1", UserID: user.Id, PlanID: "pro", Status: SubscriptionStatusActive})
+	require.NoError(t, err)
+
+	granted, grant, err := GrantSubscriptionPeriod(ctx, "sub_1", "in_1", 1000, 2000)
+	require.NoError(t, err)
+	require.True(t, granted)
+	require.Equal(t, int64(25000000), grant.Quota)
+	require.Equal(t, "pro", grant.PlanID)
+
+	granted, _, err = GrantSubscriptionPeriod(ctx, "sub_1", "in_1_retry", 1000, 2000)
+	require.NoError(t, err)
+	require.False(t, granted)
+
+	granted, _, err = GrantSubscriptionPeriod(ctx, "sub_1", "in_2", 2000, 3000)
+	require.NoError(t, err)
+	require.True(t, granted)
+
+	_, quota := userGroupAndQuota(t, user.Id)
+	require.Equal(t, int64(100+2*25000000), quota)
+
+	sub, err := GetLatestSubscriptionForUser(ctx, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(2000), sub.CurrentPeriodStart)
+	require.Equal(t, int64(3000), sub.CurrentPeriodEnd)
+}
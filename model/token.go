@@ -3,6 +3,7 @@ package model
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/Laisky/errors/v2"
 	"github.com/Laisky/zap"
@@ -29,7 +30,9 @@ type Token struct {
 	UUID           string  `json:"uuid" gorm:"type:char(36);column:uuid"`
 	UserId         int     `json:"user_id"`
 	UserUUID       *string `json:"user_uuid" gorm:"type:char(36);column:user_uuid;index"`
-	Key            string  `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Key            string  `json:"key,omitempty" gorm:"-"` // plaintext, only set on a freshly created token
+	KeyHash        string  `json:"key_hash" gorm:"type:char(64);uniqueIndex"`
+	KeyPrefix      string  `json:"key_prefix" gorm:"type:varchar(16);default:''"`
 	Status         int     `json:"status" gorm:"default:1"`
 	Name           string  `json:"name" gorm:"index" `
 	CreatedTime    int64   `json:"created_time" gorm:"bigint"`
@@ -42,6 +45,41 @@ type Token struct {
 	UpdatedAt      int64   `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
 	Models         *string `json:"models" gorm:"type:text"`  // allowed models
 	Subnet         *string `json:"subnet" gorm:"default:''"` // allowed subnet
+	// RateLimitRPM caps requests per minute; 0 means unlimited.
+	RateLimitRPM int `json:"rate_limit_rpm,omitempty" gorm:"default:0"`
+	// RateLimitTPM caps prompt plus completion tokens per minute, charged from
+	// actual usage at post-consume; 0 means unlimited.
+	RateLimitTPM int `json:"rate_limit_tpm,omitempty" gorm:"default:0"`
+	// MaxInFlight caps concurrent requests; 0 means unlimited.
+	MaxInFlight int `json:"max_in_flight,omitempty" gorm:"default:0"`
+	// BudgetPeriod is the recurring spend window ("daily", "weekly" or
+	// "monthly"); empty means the token has no budget.
+	BudgetPeriod string `json:"budget_period,omitempty" gorm:"type:varchar(16);default:''"`
+	// BudgetQuota caps the quota spent within one window; 0 means no budget.
+	BudgetQuota int64 `json:"budget_quota,omitempty" gorm:"bigint;default:0"`
+	// BudgetUsed is the quota spent in the window starting at BudgetWindowStart.
+	BudgetUsed int64 `json:"budget_used,omitempty" gorm:"bigint;default:0"`
+	// BudgetWindowStart is the unix time the window of BudgetUsed began.
+	BudgetWindowStart int64 `json:"budget_window_start,omitempty" gorm:"bigint;default:0"`
+	// BudgetNotifiedPercent is the highest soft-limit threshold already
+	// notified within that window.
+	BudgetNotifiedPercent int `json:"budget_notified_percent,omitempty" gorm:"default:0"`
+	// GuardrailPolicy names a GuardrailPolicies entry applied to requests made
+	// with this token, on top of the policy of the owner's group.
+	GuardrailPolicy string `json:"guardrail_policy,omitempty" gorm:"type:varchar(64);default:''"`
+	// ContextStrategy is how oversized chat requests made with this token are
+	// fitted into the model context window: reject, truncate or summarize.
+	// Empty leaves requests untouched unless the client asks per request.
+	ContextStrategy string `json:"context_strategy,omitempty" gorm:"type:varchar(16);default:''"`
+	// OrgId is the organization owning the token, or 0 for a personal token.
+	// Organization tokens are charged against the organization's quota pool;
+	// UserId stays the member who created the token.
+	OrgId   int     `json:"org_id,omitempty" gorm:"index;default:0"`
+	OrgUUID *string `json:"org_uuid,omitempty" gorm:"type:char(36);column:org_uuid"`
+	// Scopes is the comma-separated list of relay endpoints the token may
+	// call, named like ChannelConfig.SupportedEndpoints; empty allows every
+	// endpoint.
+	Scopes string `json:"scopes,omitempty" gorm:"type:varchar(512);default:''"`
 }
 
 var tokenSortFields = map[string]string{
@@ -56,19 +94,19 @@ var tokenSortFields = map[string]string{
 	"updated_at":   "updated_at",
 }
 
-func clearTokenCache(ctx context.Context, key string) {
+// clearTokenCache drops the cached token stored under keyHash, the HMAC of the
+// token key (see HashTokenKey).
+func clearTokenCache(ctx context.Context, keyHash string) {
 	if common.IsRedisEnabled() {
 		if ctx == nil {
 			ctx = context.Background()
 		}
-		err := common.RedisDel(ctx, fmt.Sprintf("token:%s", key))
+		err := common.RedisDel(ctx, fmt.Sprintf("token:%s", keyHash))
 		if err != nil {
-			// The raw API key must never appear verbatim in a log (same invariant
-			// enforced in ValidateUserToken below). No identity reference is
-			// resolved here: this runs on every token write and a lookup by key
-			// would add a query to a hot path.
+			// No identity reference is resolved here: this runs on every token
+			// write and a lookup by key would add a query to a hot path.
 			logger.FromContext(ctx).Warn("failed to clear token cache, continuing",
-				zap.String("key", helper.MaskAPIKey(key)), zap.Error(err))
+				zap.String("key_hash", helper.MaskAPIKey(keyHash)), zap.Error(err))
 		}
 	}
 }
@@ -199,6 +237,30 @@ func ValidateUserToken(ctx context.Context, key string) (token *Token, err error
 			errors.Wrapf(err, "failed to get token by key: %s", maskedKey))
 	}
 
+	return checkTokenUsable(ctx, token)
+}
+
+// ValidateUserTokenById loads a token by its primary key and applies the same
+// status, expiry and quota checks as ValidateUserToken. It serves in-process
+// callers, such as the batch executor, that act on behalf of a token without
+// holding its plaintext key.
+func ValidateUserTokenById(ctx context.Context, id int) (*Token, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	token, err := GetTokenById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errkind.UnauthorizedErr(err)
+		}
+		return nil, errkind.ServerErr(err)
+	}
+	return checkTokenUsable(ctx, token)
+}
+
+// checkTokenUsable rejects tokens that are disabled, expired or out of quota,
+// persisting the derived status when Redis is not in front of the database.
+func checkTokenUsable(ctx context.Context, token *Token) (*Token, error) {
 	switch token.Status {
 	case TokenStatusExhausted:
 		// Specifically about funds.
@@ -231,7 +293,7 @@ func ValidateUserToken(ctx context.Context, key string) (token *Token, err error
 			// For consistency with other operations, let SelectUpdate handle it if it's called.
 			// However, SelectUpdate is only called if Redis is NOT enabled in this block.
 			// So, if Redis IS enabled, and token is expired, we should clear it.
-			clearTokenCache(ctx, token.Key)
+			clearTokenCache(ctx, token.KeyHash)
 		}
 		return nil, errkind.ForbiddenErr(identity.Tag(
 			errors.Errorf("token %s (#%d) has expired at timestamp %d", token.Name, token.Id, token.ExpiredTime),
@@ -248,7 +310,7 @@ func ValidateUserToken(ctx context.Context, key string) (token *Token, err error
 			}
 		} else {
 			// If Redis IS enabled, and token is exhausted, we should clear it.
-			clearTokenCache(ctx, token.Key)
+			clearTokenCache(ctx, token.KeyHash)
 		}
 		// Out of funds: the caller's condition, not a server fault.
 		return nil, errkind.Quota(identity.Tag(
@@ -309,10 +371,19 @@ func (t *Token) Insert(ctx context.Context) error {
 			t.UserUUID = &userUUID
 		}
 	}
+	if t.OrgUUID == nil && t.OrgId > 0 {
+		org, err := GetOrganizationById(t.OrgId)
+		if err != nil {
+			return identity.Tag(
+				errors.Wrapf(err, "get token organization uuid: org_id=%d", t.OrgId),
+				identity.NewUserRef(t.UserId, "", ""))
+		}
+		t.OrgUUID = &org.UUID
+	}
 	var err error
 	err = DB.Create(t).Error
 	if err == nil {
-		clearTokenCache(ctx, t.Key)
+		clearTokenCache(ctx, t.KeyHash)
 		return nil
 	}
 	return identity.Tag(
@@ -326,9 +397,10 @@ func (t *Token) Update(ctx context.Context) error {
 		ctx = context.Background()
 	}
 	var err error
-	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(t).Error
+	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet",
+		"rate_limit_rpm", "rate_limit_tpm", "max_in_flight", "budget_period", "budget_quota", "guardrail_policy", "context_strategy", "scopes").Updates(t).Error
 	if err == nil {
-		clearTokenCache(ctx, t.Key)
+		clearTokenCache(ctx, t.KeyHash)
 		return nil
 	}
 	return identity.Tag(
@@ -343,7 +415,7 @@ func (t *Token) SelectUpdate(ctx context.Context) error {
 	// This can update zero values
 	err := DB.Model(t).Select("accessed_time", "status").Updates(t).Error
 	if err == nil {
-		clearTokenCache(ctx, t.Key)
+		clearTokenCache(ctx, t.KeyHash)
 		return nil
 	}
 	return identity.Tag(
@@ -358,7 +430,7 @@ func (t *Token) Delete(ctx context.Context) error {
 	var err error
 	err = DB.Delete(t).Error
 	if err == nil {
-		clearTokenCache(ctx, t.Key)
+		clearTokenCache(ctx, t.KeyHash)
 		return nil
 	}
 	return identity.Tag(
@@ -438,7 +510,7 @@ func increaseTokenQuota(ctx context.Context, id int, quota int64) (err error) {
 
 	token, fetchErr := GetTokenById(id)
 	if fetchErr == nil && token != nil {
-		clearTokenCache(ctx, token.Key)
+		clearTokenCache(ctx, token.KeyHash)
 	} else if fetchErr != nil {
 		// Error path only: LookupTokenRef consults the context identity first and
 		// only falls back to a narrow SELECT.
@@ -494,7 +566,7 @@ func decreaseTokenQuota(ctx context.Context, id int, quota int64) (err error) {
 
 	token, fetchErr := GetTokenById(id)
 	if fetchErr == nil && token != nil {
-		clearTokenCache(ctx, token.Key)
+		clearTokenCache(ctx, token.KeyHash)
 	} else if fetchErr != nil {
 		// Error path only: LookupTokenRef consults the context identity first and
 		// only falls back to a narrow SELECT.
@@ -522,12 +594,30 @@ func PreConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err er
 			errors.Errorf("insufficient token quota: required=%d, available=%d, tokenId=%d", quota, token.RemainQuota, tokenId),
 			token.Ref(), token.OwnerRef()))
 	}
-	userQuota, err := GetUserQuota(token.UserId)
+	now := time.Now()
+	if err := checkBudget("token", token.budget(), quota, now); err != nil {
+		return errkind.Quota(identity.Tag(err, token.Ref(), token.OwnerRef()))
+	}
+	var owner User
+	err = DB.Model(&User{}).Where("id = ?", token.UserId).
+		Select("quota", "budget_period", "budget_quota", "budget_used", "budget_window_start", "budget_notified_percent").Find(&owner).Error
 	if err != nil {
 		return identity.Tag(
 			errors.Wrapf(err, "failed to get user quota for pre-consume: userId=%d, tokenId=%d", token.UserId, tokenId),
 			token.Ref(), token.OwnerRef())
 	}
+	if err := checkBudget("user", owner.budget(), quota, now); err != nil {
+		return errkind.Quota(identity.Tag(err, token.Ref(), token.OwnerRef()))
+	}
+	if token.OrgId > 0 {
+		if err := preConsumeOrgQuota(ctx, token, quota); err != nil {
+			return err
+		}
+		chargeTokenBudget(ctx, token, quota)
+		chargeUserBudget(ctx, token.UserId, owner.budget(), quota)
+		return nil
+	}
+	userQuota := owner.Quota
 	if userQuota < quota {
 		// Running out of funds is the caller's condition, not a server fault: it
 		// must log at WARN without a stack, whatever HTTP status the transport uses.
@@ -592,14 +682,56 @@ func PreConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err er
 			errors.Wrapf(err, "decrease quota for user %d in pre-consume", token.UserId),
 			token.Ref(), token.OwnerRef())
 	}
+	chargeTokenBudget(ctx, token, quota)
+	chargeUserBudget(ctx, token.UserId, owner.budget(), quota)
 	return nil
 }
 
-// PostConsumeTokenQuota atomically adjusts the owning user's quota and the
-// token quota by quota. Positive values consume quota, negative values refund
+// preConsumeOrgQuota is the organization branch of PreConsumeTokenQuota: it
+// checks and debits the pool of token.OrgId instead of the creator's balance.
+// Organization pools send no reminder emails; members follow the pool through
+// GET /api/organization/:id.
+func preConsumeOrgQuota(ctx context.Context, token *Token, quota int64) error {
+	orgQuota, err := GetOrgQuota(token.OrgId)
+	if err != nil {
+		return identity.Tag(
+			errors.Wrapf(err, "failed to get organization quota for pre-consume: orgId=%d, tokenId=%d", token.OrgId, token.Id),
+			token.Ref(), token.OwnerRef())
+	}
+	if orgQuota < quota {
+		return errkind.Quota(identity.Tag(
+			errors.Errorf("insufficient organization quota: required=%d, available=%d, orgId=%d, tokenId=%d", quota, orgQuota, token.OrgId, token.Id),
+			token.Ref(), token.OwnerRef()))
+	}
+	if !token.UnlimitedQuota {
+		if err := DecreaseTokenQuota(ctx, token.Id, quota); err != nil {
+			return identity.Tag(
+				errors.Wrapf(err, "decrease quota for token %d", token.Id),
+				token.Ref(), token.OwnerRef())
+		}
+	}
+	if err := DecreaseOrgQuota(ctx, token.OrgId, quota); err != nil {
+		return identity.Tag(
+			errors.Wrapf(err, "decrease quota for organization %d in pre-consume", token.OrgId),
+			token.Ref(), token.OwnerRef())
+	}
+	return nil
+}
+
+// PostConsumeTokenQuota atomically adjusts the paying balance (the owning
+// organization's pool for organization tokens, otherwise the owning user's
+// quota) and the token quota by quota. Positive values consume quota, negative values refund
 // quota, and zero leaves balances unchanged. It returns a wrapped error when
 // either balance cannot be adjusted.
 func PostConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err error) {
+	return PostConsumeTokenUsage(ctx, tokenId, quota, 0)
+}
+
+// PostConsumeTokenUsage is PostConsumeTokenQuota for a finished relay request:
+// it also charges usedTokens against the token's tokens-per-minute window. The
+// window is only written for tokens with a TPM limit, and a failure to write it
+// is logged rather than returned.
+func PostConsumeTokenUsage(ctx context.Context, tokenId int, quota int64, usedTokens int64) (err error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -609,14 +741,28 @@ func PostConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err e
 			errors.Wrapf(err, "get token %d for post-consume", tokenId),
 			identity.NewTokenRef(tokenId, "", ""))
 	}
+	if usedTokens > 0 && token.RateLimitTPM > 0 && !config.RateLimitDisabled {
+		if err := RecordTokenTPMUsage(ctx, tokenId, usedTokens); err != nil {
+			logger.FromContext(ctx).Warn("failed to record token TPM usage",
+				append(token.Ref().Zap(), zap.Int64("tokens", usedTokens), zap.Error(err))...)
+		}
+	}
 	if quota == 0 {
 		return nil
 	}
 	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, token.UserId, -quota)
+		if token.OrgId > 0 {
+			addNewRecord(BatchUpdateTypeOrgQuota, token.OrgId, -quota)
+		} else {
+			addNewRecord(BatchUpdateTypeUserQuota, token.UserId, -quota)
+		}
 		if !token.UnlimitedQuota {
 			addNewRecord(BatchUpdateTypeTokenQuota, tokenId, -quota)
 		}
+		// Budgets are charged directly even in batch mode: a window must see
+		// the spend before the next pre-consume check, not after the next flush.
+		chargeTokenBudget(ctx, token, quota)
+		loadAndChargeUserBudget(ctx, token.UserId, quota)
 		return nil
 	}
 
@@ -630,7 +776,9 @@ func PostConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err e
 			errors.Wrapf(err, "adjust quotas in post-consume for token %d", tokenId),
 			token.Ref(), token.OwnerRef())
 	}
-	clearTokenCache(ctx, token.Key)
+	chargeTokenBudget(ctx, token, quota)
+	loadAndChargeUserBudget(ctx, token.UserId, quota)
+	clearTokenCache(ctx, token.KeyHash)
 	return nil
 }
 
@@ -639,16 +787,30 @@ func PostConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err e
 // debit and negative for a refund. It returns an error when either row is
 // missing, has insufficient quota, or cannot be updated.
 func adjustPostConsumeQuota(tx *gorm.DB, token *Token, quota int64) error {
-	userQuery := tx.Model(&User{}).Where("id = ?", token.UserId)
-	if quota > 0 {
-		userQuery = userQuery.Where("quota >= ?", quota)
-	}
-	userResult := userQuery.Update("quota", gorm.Expr("quota - ?", quota))
-	if userResult.Error != nil {
-		return errors.Wrapf(userResult.Error, "adjust quota for user %d", token.UserId)
-	}
-	if userResult.RowsAffected == 0 {
-		return errors.Errorf("insufficient user quota or missing user %d", token.UserId)
+	if token.OrgId > 0 {
+		orgQuery := tx.Model(&Organization{}).Where("id = ?", token.OrgId)
+		if quota > 0 {
+			orgQuery = orgQuery.Where("quota >= ?", quota)
+		}
+		orgResult := orgQuery.Update("quota", gorm.Expr("quota - ?", quota))
+		if orgResult.Error != nil {
+			return errors.Wrapf(orgResult.Error, "adjust quota for organization %d", token.OrgId)
+		}
+		if orgResult.RowsAffected == 0 {
+			return errors.Errorf("insufficient organization quota or missing organization %d", token.OrgId)
+		}
+	} else {
+		userQuery := tx.Model(&User{}).Where("id = ?", token.UserId)
+		if quota > 0 {
+			userQuery = userQuery.Where("quota >= ?", quota)
+		}
+		userResult := userQuery.Update("quota", gorm.Expr("quota - ?", quota))
+		if userResult.Error != nil {
+			return errors.Wrapf(userResult.Error, "adjust quota for user %d", token.UserId)
+		}
+		if userResult.RowsAffected == 0 {
+			return errors.Errorf("insufficient user quota or missing user %d", token.UserId)
+		}
 	}
 
 	if token.UnlimitedQuota {
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/Laisky/one-api/common/config"
+)
+
+// tokenKeyHashSecretLabel separates the token key hash secret derived from
+// SESSION_SECRET from every other use of that secret.
+const tokenKeyHashSecretLabel = "one-api token key hash v1"
+
+// tokenKeyDisplayPrefixLen is how many leading characters of a token key are
+// kept in plaintext so users can tell their keys apart.
+const tokenKeyDisplayPrefixLen = 8
+
+// stripLegacyTokenKeyPrefix removes the "sk-" and "laisky-" prefixes that some
+// historical rows stored as part of the key.
+func stripLegacyTokenKeyPrefix(key string) string {
+	key = strings.TrimPrefix(key, "sk-")
+	return strings.TrimPrefix(key, "laisky-")
+}
+
+// HashTokenKey returns the hex HMAC-SHA256 of a token key under
+// config.TokenKeyHashSecret. It is the only form of the key stored at rest and
+// the lookup key of the token cache.
+func HashTokenKey(key string) string {
+	mac := hmac.New(sha256.New, []byte(config.TokenKeyHashSecret))
+	mac.Write([]byte(stripLegacyTokenKeyPrefix(key)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// InitTokenKeyHashSecret resolves the HMAC secret token keys are hashed with.
+// TOKEN_KEY_HASH_SECRET wins; otherwise the secret is derived from an
+// explicitly configured SESSION_SECRET. A random per-boot SESSION_SECRET is
+// never used, because every stored hash would stop matching after a restart.
+// It must run before the database is migrated.
+//
+// Return values:
+//   - error: when neither a hash secret nor an explicit SESSION_SECRET is set.
+func InitTokenKeyHashSecret() error {
+	if config.TokenKeyHashSecret != "" {
+		return nil
+	}
+	session := config.SessionSecretEnvValue
+	if session == "" || session == "random_string" {
+		return errors.New("TOKEN_KEY_HASH_SECRET is empty and SESSION_SECRET is not set explicitly; " +
+			"set one of them to a stable random string")
+	}
+	mac := hmac.New(sha256.New, []byte(session))
+	mac.Write([]byte(tokenKeyHashSecretLabel))
+	config.TokenKeyHashSecret = hex.EncodeToString(mac.Sum(nil))
+	return nil
+}
+
+// tokenKeyDisplayPrefix returns the leading characters of key kept for display.
+func tokenKeyDisplayPrefix(key string) string {
+	key = stripLegacyTokenKeyPrefix(key)
+	if len(key) > tokenKeyDisplayPrefixLen {
+		return key[:tokenKeyDisplayPrefixLen]
+	}
+	return key
+}
+
+// SetKey assigns a new plaintext key to the token and derives its stored hash
+// and display prefix. The plaintext stays on the struct only so it can be shown
+// once in the creation response; it is never persisted.
+func (t *Token) SetKey(key string) {
+	t.Key = key
+	t.KeyHash = HashTokenKey(key)
+	t.KeyPrefix = tokenKeyDisplayPrefix(key)
+}
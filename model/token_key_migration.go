@@ -0,0 +1,323 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/env"
+	"github.com/Laisky/one-api/common/logger"
+)
+
+const (
+	// tokenKeyHashMigrationKey marks that every token row carries a key hash and
+	// the legacy plaintext tokens.key column has been dropped by the finalizer.
+	tokenKeyHashMigrationKey = "token_key_hash_v1"
+	// tokenKeyHashBatchSize bounds how many legacy rows one backfill query reads.
+	tokenKeyHashBatchSize = 1000
+	// legacyTokenKeyIndex is the unique index GORM created on tokens.key.
+	legacyTokenKeyIndex = "idx_tokens_key"
+)
+
+// tokenKeyHashFinalizerEnabled controls whether this process may drop the
+// plaintext tokens.key column after the backfill. It must be enabled only after
+// every instance runs a release that hashes keys and rollback to a release that
+// reads plaintext keys is no longer needed.
+var tokenKeyHashFinalizerEnabled = env.Bool("TOKEN_KEY_HASH_FINALIZER", false)
+
+// tokenKeyHashMigrated caches a completed tokenKeyHashMigrationKey marker so the
+// legacy lookup in getTokenByKeyHash stops querying once the migration is done.
+var tokenKeyHashMigrated atomic.Bool
+
+// legacyTokenKeyRow carries one token row id and its plaintext legacy key.
+type legacyTokenKeyRow struct {
+	Id  int     `gorm:"column:id"`
+	Key *string `gorm:"column:legacy_key"`
+}
+
+// legacyTokenKeyColumn returns the dialect-quoted legacy tokens.key column;
+// "key" is a reserved word on MySQL and PostgreSQL.
+func legacyTokenKeyColumn() string {
+	if common.UsingPostgreSQL.Load() {
+		return `"key"`
+	}
+	return "`key`"
+}
+
+// legacyTokenKeyColumnExists reports whether tokens still has the plaintext key
+// column. It reads the column list rather than using Migrator.HasColumn, whose
+// SQLite implementation pattern-matches the table DDL and also matches the
+// "PRIMARY KEY" clause.
+//
+// Parameters:
+//   - ctx: context controlling the metadata query.
+//
+// Return values:
+//   - bool: true when tokens.key exists.
+//   - error: wrapped database error when the columns cannot be read.
+func legacyTokenKeyColumnExists(ctx context.Context) (bool, error) {
+	columns, err := DB.WithContext(ctx).Migrator().ColumnTypes("tokens")
+	if err != nil {
+		return false, errors.Wrap(err, "read tokens columns")
+	}
+	for _, column := range columns {
+		if strings.EqualFold(column.Name(), "key") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MigrateTokenKeysToHash fills key_hash and key_prefix for rows written before
+// keys were hashed, in id-ordered batches. The plaintext tokens.key column is
+// left in place so a rollback, or an older instance still serving during a
+// rolling deploy, keeps authenticating every key; it is dropped only by
+// FinalizeTokenKeyHashMigration, which runs here when TOKEN_KEY_HASH_FINALIZER
+// is set. Every step is idempotent, and until the column is dropped
+// getTokenByKeyHash upgrades legacy rows on first use.
+//
+// Parameters:
+//   - ctx: context controlling the migration reads, writes and DDL.
+//
+// Return values:
+//   - error: wrapped database error when a batch, the DDL or the marker fails,
+//     or an error when legacy keys exist but no hash secret is configured.
+func MigrateTokenKeysToHash(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	complete, err := isDataMigrationComplete(ctx, DB, tokenKeyHashMigrationKey)
+	if err != nil {
+		return errors.Wrap(err, "check token key hash migration marker")
+	}
+	if complete {
+		tokenKeyHashMigrated.Store(true)
+		return nil
+	}
+
+	hasLegacyColumn, err := legacyTokenKeyColumnExists(ctx)
+	if err != nil {
+		return err
+	}
+	if !hasLegacyColumn {
+		return markTokenKeyHashMigrationComplete(ctx)
+	}
+
+	hashed, err := backfillTokenKeyHashes(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Logger.Info("token keys backfilled to hashes", zap.Int("hashed_rows", hashed))
+	if !tokenKeyHashFinalizerEnabled {
+		logger.Logger.Info("plaintext tokens.key column kept until TOKEN_KEY_HASH_FINALIZER is enabled")
+		return nil
+	}
+	return FinalizeTokenKeyHashMigration(ctx)
+}
+
+// FinalizeTokenKeyHashMigration drops the plaintext tokens.key column and
+// records the completion marker. It backfills again first, so keys created by
+// older instances since the last backfill are not lost. Dropping the column
+// cannot be undone: run it only after every instance hashes keys and no
+// rollback to a plaintext-key release is planned.
+//
+// Parameters:
+//   - ctx: context controlling the backfill, the DDL and the marker write.
+//
+// Return values:
+//   - error: wrapped database error when the backfill, the DDL or the marker fails.
+func FinalizeTokenKeyHashMigration(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	hasLegacyColumn, err := legacyTokenKeyColumnExists(ctx)
+	if err != nil {
+		return err
+	}
+	if hasLegacyColumn {
+		hashed, err := backfillTokenKeyHashes(ctx)
+		if err != nil {
+			return err
+		}
+		if err := dropLegacyTokenKeyColumn(ctx); err != nil {
+			return err
+		}
+		logger.Logger.Info("plaintext token key column dropped", zap.Int("hashed_rows", hashed))
+	}
+	return markTokenKeyHashMigrationComplete(ctx)
+}
+
+// markTokenKeyHashMigrationComplete records the completion marker and caches it.
+func markTokenKeyHashMigrationComplete(ctx context.Context) error {
+	if err := markDataMigrationComplete(ctx, DB, tokenKeyHashMigrationKey); err != nil {
+		return errors.Wrap(err, "mark token key hash migration complete")
+	}
+	tokenKeyHashMigrated.Store(true)
+	return nil
+}
+
+// backfillTokenKeyHashes hashes every legacy key that has no key_hash yet. It
+// refuses to run without a hash secret, since an unkeyed hash of a key is no
+// better than the key itself against offline guessing.
+//
+// Parameters:
+//   - ctx: context controlling the batch reads and writes.
+//
+// Return values:
+//   - int: number of rows updated.
+//   - error: wrapped database error when a batch fails, or an error when no
+//     hash secret is configured.
+func backfillTokenKeyHashes(ctx context.Context) (int, error) {
+	if config.TokenKeyHashSecret == "" {
+		return 0, errors.New("token key hash secret is empty, set TOKEN_KEY_HASH_SECRET or SESSION_SECRET")
+	}
+	keyCol := legacyTokenKeyColumn()
+	hashed := 0
+	lastId := 0
+	for {
+		var rows []legacyTokenKeyRow
+		err := DB.WithContext(ctx).Table("tokens").
+			Select("id, "+keyCol+" AS legacy_key").
+			Where("id > ? AND (key_hash IS NULL OR key_hash = '')", lastId).
+			Order("id").
+			Limit(tokenKeyHashBatchSize).
+			Scan(&rows).Error
+		if err != nil {
+			return hashed, errors.Wrapf(err, "read legacy token keys after id %d", lastId)
+		}
+		if len(rows) == 0 {
+			return hashed, nil
+		}
+		for _, row := range rows {
+			lastId = row.Id
+			if row.Key == nil || strings.TrimSpace(*row.Key) == "" {
+				continue
+			}
+			updated, err := hashLegacyTokenKey(ctx, row.Id, *row.Key)
+			if err != nil {
+				return hashed, err
+			}
+			if updated {
+				hashed++
+			}
+		}
+	}
+}
+
+// hashLegacyTokenKey stores the hash and display prefix of one legacy key and
+// evicts the cache entry the previous release stored under the plaintext key.
+//
+// Parameters:
+//   - ctx: context controlling the write.
+//   - id: token row id.
+//   - key: plaintext key read from the legacy column.
+//
+// Return values:
+//   - bool: true when this call wrote the hash; false when another writer won.
+//   - error: wrapped database error when the update fails.
+func hashLegacyTokenKey(ctx context.Context, id int, key string) (bool, error) {
+	token := Token{}
+	token.SetKey(key)
+	result := DB.WithContext(ctx).Model(&Token{}).
+		Where("id = ? AND (key_hash IS NULL OR key_hash = '')", id).
+		Updates(map[string]any{"key_hash": token.KeyHash, "key_prefix": token.KeyPrefix})
+	if result.Error != nil {
+		return false, errors.Wrapf(result.Error, "hash legacy key of token %d", id)
+	}
+	clearTokenCache(ctx, key)
+	return result.RowsAffected > 0, nil
+}
+
+// dropLegacyTokenKeyColumn removes the plaintext tokens.key column. SQLite
+// refuses to drop an indexed column, so its unique index goes first; MySQL and
+// PostgreSQL drop the index together with the column.
+//
+// Parameters:
+//   - ctx: context controlling the DDL.
+//
+// Return values:
+//   - error: wrapped database error when the DDL fails.
+func dropLegacyTokenKeyColumn(ctx context.Context) error {
+	db := DB.WithContext(ctx)
+	if common.UsingSQLite.Load() && db.Migrator().HasIndex("tokens", legacyTokenKeyIndex) {
+		if err := db.Exec("DROP INDEX IF EXISTS " + legacyTokenKeyIndex).Error; err != nil {
+			return errors.Wrap(err, "drop legacy token key index")
+		}
+	}
+	if err := db.Exec("ALTER TABLE tokens DROP COLUMN " + legacyTokenKeyColumn()).Error; err != nil {
+		return errors.Wrap(err, "drop legacy token key column")
+	}
+	return nil
+}
+
+// getTokenByKeyHash loads a token by the hash of its key. While the migration
+// marker is missing, a miss falls back to the legacy plaintext column and
+// upgrades the row in place, so keys keep working on nodes that start before
+// the master node has migrated.
+//
+// Parameters:
+//   - ctx: context controlling the lookups.
+//   - key: plaintext key presented by the client.
+//   - keyHash: HashTokenKey(key).
+//
+// Return values:
+//   - *Token: the matching token.
+//   - error: wrapping gorm.ErrRecordNotFound when no token matches.
+func getTokenByKeyHash(ctx context.Context, key string, keyHash string) (*Token, error) {
+	if DB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	var token Token
+	err := DB.WithContext(ctx).Where("key_hash = ?", keyHash).First(&token).Error
+	if err == nil {
+		return &token, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) || tokenKeyHashMigrationDone(ctx) {
+		return nil, errors.Wrap(err, "get token by key hash")
+	}
+
+	var row legacyTokenKeyRow
+	err = DB.WithContext(ctx).Table("tokens").
+		Select("id, "+legacyTokenKeyColumn()+" AS legacy_key").
+		Where(legacyTokenKeyColumn()+" = ?", key).
+		Limit(1).
+		Scan(&row).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "get token by legacy key")
+	}
+	if row.Id == 0 {
+		return nil, errors.Wrap(gorm.ErrRecordNotFound, "get token by key hash")
+	}
+	if _, err := hashLegacyTokenKey(ctx, row.Id, key); err != nil {
+		return nil, err
+	}
+	if err := DB.WithContext(ctx).First(&token, "id = ?", row.Id).Error; err != nil {
+		return nil, errors.Wrapf(err, "reload token %d after key hash upgrade", row.Id)
+	}
+	return &token, nil
+}
+
+// tokenKeyHashMigrationDone reports whether no legacy plaintext key can be
+// left: the migration marker exists or the legacy column is already gone. A
+// positive answer is remembered for the life of the process.
+func tokenKeyHashMigrationDone(ctx context.Context) bool {
+	if tokenKeyHashMigrated.Load() {
+		return true
+	}
+	complete, err := isDataMigrationComplete(ctx, DB, tokenKeyHashMigrationKey)
+	if err == nil && !complete {
+		hasLegacyColumn, columnErr := legacyTokenKeyColumnExists(ctx)
+		complete = columnErr == nil && !hasLegacyColumn
+	}
+	if err == nil && complete {
+		tokenKeyHashMigrated.Store(true)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/config"
+)
+
+// withTokenKeyHashSecret sets config.TokenKeyHashSecret for one test.
+func withTokenKeyHashSecret(t *testing.T, secret string) {
+	t.Helper()
+	original := config.TokenKeyHashSecret
+	config.TokenKeyHashSecret = secret
+	t.Cleanup(func() { config.TokenKeyHashSecret = original })
+}
+
+// withTokenKeyHashMigrationReset clears the cached migration flag for one test.
+func withTokenKeyHashMigrationReset(t *testing.T) {
+	t.Helper()
+	original := tokenKeyHashMigrated.Load()
+	tokenKeyHashMigrated.Store(false)
+	t.Cleanup(func() { tokenKeyHashMigrated.Store(original) })
+}
+
+func TestHashTokenKey(t *testing.T) {
+	withTokenKeyHashSecret(t, "test-secret")
+	const key = "AbCdEfGhIjKlMnOpQrStUvWxYz0123456789AbCdEfGhIjKl"
+
+	hash := HashTokenKey(key)
+	require.Len(t, hash, 64)
+	require.NotContains(t, hash, key)
+	require.Equal(t, hash, HashTokenKey("sk-"+key), "the sk- prefix must not change the hash")
+	require.Equal(t, hash, HashTokenKey("laisky-"+key), "the legacy laisky- prefix must not change the hash")
+	require.NotEqual(t, hash, HashTokenKey(key+"x"))
+
+	config.TokenKeyHashSecret = "other-secret"
+	require.NotEqual(t, hash, HashTokenKey(key), "the hash must be keyed by the server secret")
+}
+
+func TestTokenSetKeyAndResponseMasking(t *testing.T) {
+	withTokenKeyHashSecret(t, "test-secret")
+	const key = "AbCdEfGhIjKlMnOpQrStUvWxYz0123456789AbCdEfGhIjKl"
+
+	token := &Token{}
+	token.SetKey(key)
+	require.Equal(t, key, token.Key)
+	require.Equal(t, HashTokenKey(key), token.KeyHash)
+	require.Equal(t, "AbCdEfGh", token.KeyPrefix)
+	require.Equal(t, "sk-"+key, token.ToResponse().Key, "a freshly created token returns its full key")
+
+	stored := &Token{KeyHash: token.KeyHash, KeyPrefix: token.KeyPrefix}
+	require.Equal(t, "sk-AbCdEfGh...", stored.ToResponse().Key, "a stored token returns only its display prefix")
+}
+
+func TestTokenInsertNeverPersistsPlaintextKey(t *testing.T) {
+	setupTestDatabase(t)
+	user := createOrgTestUser(t, 0)
+	const key = "ZyXwVuTsRqPoNmLkJiHgFeDcBa9876543210ZyXwVuTsRqPo"
+
+	token := &Token{UserId: user.Id, Name: "test-token-key-hash", Key: key, Status: TokenStatusEnabled, RemainQuota: 1}
+	require.NoError(t, token.Insert(context.Background()))
+	require.Equal(t, HashTokenKey(key), token.KeyHash)
+
+	var row map[string]any
+	require.NoError(t, DB.Table("tokens").Where("id = ?", token.Id).Take(&row).Error)
+	for column, value := range row {
+		if s, ok := value.(string); ok {
+			require.NotContains(t, s, key, "column %s must not hold the plaintext key", column)
+		}
+	}
+
+	got, err := ValidateUserToken(context.Background(), key)
+	require.NoError(t, err)
+	require.Equal(t, token.Id, got.Id)
+	require.Empty(t, got.Key, "a token loaded from storage has no plaintext key")
+}
+
+// seedLegacyTokenKeys recreates the pre-hash tokens.key column with its unique
+// index and inserts rows that carry only a plaintext key.
+func seedLegacyTokenKeys(t *testing.T, keys ...string) {
+	t.Helper()
+	require.NoError(t, DB.Exec("ALTER TABLE tokens ADD COLUMN `key` char(48)").Error)
+	require.NoError(t, DB.Exec("CREATE UNIQUE INDEX "+legacyTokenKeyIndex+" ON tokens (`key`)").Error)
+	require.NoError(t, DB.Exec("INSERT INTO users (id, username, password, access_token, aff_code) VALUES (1, 'legacy', 'password-hash', 'legacy-access', 'legacy-aff')").Error)
+	for i, key := range keys {
+		require.NoError(t, DB.Exec("INSERT INTO tokens (id, user_id, `key`, name, status, remain_quota) VALUES (?, 1, ?, ?, ?, 1)",
+			i+1, key, "legacy-"+key[:4], TokenStatusEnabled).Error)
+	}
+}
+
+func TestMigrateTokenKeysToHash(t *testing.T) {
+	db := setupMigrationTestDB(t)
+	withTestDBGlobals(t, db, db)
+	require.NoError(t, migrateDB())
+	withTokenKeyHashSecret(t, "test-secret")
+	withTokenKeyHashMigrationReset(t)
+	ctx := context.Background()
+
+	keys := []string{
+		"aaaaAAAAbbbbBBBBccccCCCCddddDDDDeeeeEEEEffffFFFF",
+		"ggggGGGGhhhhHHHHiiiiIIIIjjjjJJJJkkkkKKKKllllLLLL",
+		"mmmmMMMMnnnnNNNNooooOOOOppppPPPPqqqqQQQQrrrrRRRR",
+	}
+	seedLegacyTokenKeys(t, keys...)
+
+	hasLegacyColumn, err := legacyTokenKeyColumnExists(ctx)
+	require.NoError(t, err)
+	require.True(t, hasLegacyColumn)
+
+	// Before the migration runs, a legacy key still authenticates and the row
+	// is upgraded in place.
+	token, err := getTokenByKeyHash(ctx, keys[0], HashTokenKey(keys[0]))
+	require.NoError(t, err)
+	require.Equal(t, 1, token.Id)
+	require.Equal(t, HashTokenKey(keys[0]), token.KeyHash)
+	require.Equal(t, "aaaaAAAA", token.KeyPrefix)
+
+	require.NoError(t, MigrateTokenKeysToHash(ctx))
+
+	// The backfill keeps the plaintext column so older instances and a
+	// rollback keep working.
+	hasLegacyColumn, err = legacyTokenKeyColumnExists(ctx)
+	require.NoError(t, err)
+	require.True(t, hasLegacyColumn, "the backfill must not drop the plaintext column")
+	complete, err := isDataMigrationComplete(ctx, DB, tokenKeyHashMigrationKey)
+	require.NoError(t, err)
+	require.False(t, complete)
+	var unhashed int64
+	require.NoError(t, DB.Table("tokens").Where("key_hash IS NULL OR key_hash = ''").Count(&unhashed).Error)
+	require.Zero(t, unhashed)
+
+	// A key written by an older instance after the backfill is picked up by
+	// the finalizer.
+	const lateKey = "ssssSSSSttttTTTTuuuuUUUUvvvvVVVVwwwwWWWWxxxxXXXX"
+	require.NoError(t, DB.Exec("INSERT INTO tokens (id, user_id, `key`, name, status, remain_quota) VALUES (4, 1, ?, 'legacy-late', ?, 1)",
+		lateKey, TokenStatusEnabled).Error)
+	keys = append(keys, lateKey)
+
+	require.NoError(t, FinalizeTokenKeyHashMigration(ctx))
+
+	hasLegacyColumn, err = legacyTokenKeyColumnExists(ctx)
+	require.NoError(t, err)
+	require.False(t, hasLegacyColumn, "the finalizer must drop the plaintext column")
+	complete, err = isDataMigrationComplete(ctx, DB, tokenKeyHashMigrationKey)
+	require.NoError(t, err)
+	require.True(t, complete)
+
+	for i, key := range keys {
+		token, err := getTokenByKeyHash(ctx, key, HashTokenKey(key))
+		require.NoError(t, err)
+		require.Equal(t, i+1, token.Id)
+		require.True(t, strings.HasPrefix(key, token.KeyPrefix))
+	}
+	_, err = getTokenByKeyHash(ctx, "unknown", HashTokenKey("unknown"))
+	require.Error(t, err)
+
+	// A second run is a no-op.
+	require.NoError(t, MigrateTokenKeysToHash(ctx))
+}
+
+func TestMigrateTokenKeysToHashRequiresSecret(t *testing.T) {
+	db := setupMigrationTestDB(t)
+	withTestDBGlobals(t, db, db)
+	require.NoError(t, migrateDB())
+	withTokenKeyHashSecret(t, "")
+	withTokenKeyHashMigrationReset(t)
+
+	seedLegacyTokenKeys(t, "aaaaAAAAbbbbBBBBccccCCCCddddDDDDeeeeEEEEffffFFFF")
+	require.Error(t, MigrateTokenKeysToHash(context.Background()))
+}
+
+func TestInitTokenKeyHashSecret(t *testing.T) {
+	originalSession := config.SessionSecretEnvValue
+	t.Cleanup(func() { config.SessionSecretEnvValue = originalSession })
+
+	withTokenKeyHashSecret(t, "explicit")
+	config.SessionSecretEnvValue = "session"
+	require.NoError(t, InitTokenKeyHashSecret())
+	require.Equal(t, "explicit", config.TokenKeyHashSecret)
+
+	config.TokenKeyHashSecret = ""
+	require.NoError(t, InitTokenKeyHashSecret())
+	derived := config.TokenKeyHashSecret
+	require.NotEmpty(t, derived)
+	require.NotEqual(t, "session", derived, "the session secret must not be reused as is")
+
+	config.TokenKeyHashSecret = ""
+	config.SessionSecretEnvValue = ""
+	require.Error(t, InitTokenKeyHashSecret())
+}
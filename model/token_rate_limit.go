@@ -0,0 +1,196 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/random"
+)
+
+// TokenRateLimitWindowSeconds is the sliding window behind a token's RPM and TPM limits.
+const TokenRateLimitWindowSeconds int64 = 60
+
+// tokenInFlightTTL bounds how long a Redis in-flight counter survives without
+// traffic, so slots leaked by a crashed process eventually free themselves.
+const tokenInFlightTTL = 10 * time.Minute
+
+// tokenRateLimiter backs the per-token limits when Redis is not enabled.
+var tokenRateLimiter common.InMemoryRateLimiter
+
+func init() {
+	tokenRateLimiter.Init(time.Duration(TokenRateLimitWindowSeconds) * time.Second)
+}
+
+func tokenRequestsKey(tokenId int) string { return fmt.Sprintf("rateLimit:TKR:%d", tokenId) }
+func tokenTokensKey(tokenId int) string   { return fmt.Sprintf("rateLimit:TKT:%d", tokenId) }
+func tokenInFlightKey(tokenId int) string { return fmt.Sprintf("rateLimit:TKC:%d", tokenId) }
+
+func tokenRateLimitUsesRedis() bool {
+	return common.IsRedisEnabled() && common.RDB != nil
+}
+
+// takeTokenRequestScript prunes the RPM window, counts it and records the new
+// request only when the count is below the limit, all in one atomic step, so
+// parallel requests cannot all pass the check before any of them is recorded.
+//
+// KEYS[1]: window key. ARGV: now (ms), window (ms), limit, member, ttl (s).
+// Returns {allowed (0/1), requests in the window, score of the oldest request}.
+var takeTokenRequestScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - tonumber(ARGV[2]))
+local used = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if used < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('EXPIRE', KEYS[1], ARGV[5])
+	used = used + 1
+	allowed = 1
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local oldestScore = now
+if oldest[2] then
+	oldestScore = tonumber(oldest[2])
+end
+return {allowed, used, oldestScore}
+`)
+
+// TakeTokenRequest counts one request against the token's RPM window when
+// fewer than limit requests were issued within the last
+// TokenRateLimitWindowSeconds. The check and the record are one atomic
+// operation. It returns whether the request was admitted, the requests in the
+// window including this one when admitted, and the seconds until the oldest
+// one expires.
+func TakeTokenRequest(ctx context.Context, tokenId int, limit int) (allowed bool, used int64, resetSeconds int64, err error) {
+	key := tokenRequestsKey(tokenId)
+	if !tokenRateLimitUsesRedis() {
+		allowed, used, resetSeconds = tokenRateLimiter.TakeUsage(key, 1, int64(limit), TokenRateLimitWindowSeconds)
+		return allowed, used, resetSeconds, nil
+	}
+
+	nowMs := time.Now().UnixMilli()
+	windowMs := TokenRateLimitWindowSeconds * 1000
+	member := fmt.Sprintf("%d:%s:1", nowMs, random.GetRandomString(8))
+	result, err := takeTokenRequestScript.Run(ctx, common.RDB, []string{key},
+		nowMs, windowMs, limit, member, TokenRateLimitWindowSeconds).Int64Slice()
+	if err != nil {
+		return false, 0, 0, errors.Wrapf(err, "take rate limit window %s", key)
+	}
+	if len(result) != 3 {
+		return false, 0, 0, errors.Errorf("take rate limit window %s: unexpected script result %v", key, result)
+	}
+	resetSeconds = (windowMs - (nowMs - result[2]) + 999) / 1000
+	return result[0] == 1, result[1], resetSeconds, nil
+}
+
+// GetTokenTPMWindow returns how many tokens the token consumed within the last
+// TokenRateLimitWindowSeconds and the seconds until the oldest usage expires.
+func GetTokenTPMWindow(ctx context.Context, tokenId int) (used int64, resetSeconds int64, err error) {
+	return tokenWindowUsage(ctx, tokenTokensKey(tokenId))
+}
+
+// RecordTokenTPMUsage charges tokens consumed by a finished request against the
+// token's TPM window. It is called at post-consume with the actual usage.
+func RecordTokenTPMUsage(ctx context.Context, tokenId int, tokens int64) error {
+	if tokenId <= 0 || tokens <= 0 {
+		return nil
+	}
+	return addTokenWindowUsage(ctx, tokenTokensKey(tokenId), tokens)
+}
+
+// AcquireTokenInFlight takes one of the token's maxInFlight concurrent request
+// slots and reports whether one was free. A successful acquire must be paired
+// with ReleaseTokenInFlight.
+func AcquireTokenInFlight(ctx context.Context, tokenId int, maxInFlight int) (bool, error) {
+	key := tokenInFlightKey(tokenId)
+	if !tokenRateLimitUsesRedis() {
+		return tokenRateLimiter.Acquire(key, maxInFlight), nil
+	}
+
+	current, err := common.RDB.Incr(ctx, key).Result()
+	if err != nil {
+		return false, errors.Wrapf(err, "increase in-flight counter for token %d", tokenId)
+	}
+	common.RDB.Expire(ctx, key, tokenInFlightTTL)
+	if current > int64(maxInFlight) {
+		if err := common.RDB.Decr(ctx, key).Err(); err != nil {
+			return false, errors.Wrapf(err, "roll back in-flight counter for token %d", tokenId)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// ReleaseTokenInFlight returns a slot taken by AcquireTokenInFlight.
+func ReleaseTokenInFlight(ctx context.Context, tokenId int) error {
+	key := tokenInFlightKey(tokenId)
+	if !tokenRateLimitUsesRedis() {
+		tokenRateLimiter.Release(key)
+		return nil
+	}
+
+	current, err := common.RDB.Decr(ctx, key).Result()
+	if err != nil {
+		return errors.Wrapf(err, "decrease in-flight counter for token %d", tokenId)
+	}
+	if current <= 0 {
+		common.RDB.Del(ctx, key)
+	}
+	return nil
+}
+
+// tokenWindowUsage sums the weights recorded under key within the sliding window.
+// In Redis the window is a sorted set scored by millisecond timestamps whose
+// members are "<unique>:<weight>".
+func tokenWindowUsage(ctx context.Context, key string) (used int64, resetSeconds int64, err error) {
+	if !tokenRateLimitUsesRedis() {
+		used, resetSeconds = tokenRateLimiter.WindowUsage(key, TokenRateLimitWindowSeconds)
+		return used, resetSeconds, nil
+	}
+
+	nowMs := time.Now().UnixMilli()
+	windowMs := TokenRateLimitWindowSeconds * 1000
+	if err := common.RDB.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(nowMs-windowMs, 10)).Err(); err != nil {
+		return 0, 0, errors.Wrapf(err, "prune rate limit window %s", key)
+	}
+	hits, err := common.RDB.ZRangeWithScores(ctx, key, 0, -1).Result()
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "read rate limit window %s", key)
+	}
+	if len(hits) == 0 {
+		return 0, 0, nil
+	}
+	for _, hit := range hits {
+		member, _ := hit.Member.(string)
+		weight, err := strconv.ParseInt(member[strings.LastIndex(member, ":")+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		used += weight
+	}
+	oldestMs := int64(hits[0].Score)
+	resetSeconds = (windowMs - (nowMs - oldestMs) + 999) / 1000
+	return used, resetSeconds, nil
+}
+
+// addTokenWindowUsage records weight units under key at the current time.
+func addTokenWindowUsage(ctx context.Context, key string, weight int64) error {
+	if !tokenRateLimitUsesRedis() {
+		tokenRateLimiter.AddUsage(key, weight)
+		return nil
+	}
+
+	nowMs := time.Now().UnixMilli()
+	member := fmt.Sprintf("%d:%s:%d", nowMs, random.GetRandomString(8), weight)
+	if err := common.RDB.ZAdd(ctx, key, &redis.Z{Score: float64(nowMs), Member: member}).Err(); err != nil {
+		return errors.Wrapf(err, "record rate limit usage %s", key)
+	}
+	common.RDB.Expire(ctx, key, time.Duration(TokenRateLimitWindowSeconds)*time.Second)
+	return nil
+}
@@ -0,0 +1,158 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/helper"
+)
+
+func useTokenRateLimitRedis(t *testing.T) {
+	t.Helper()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(redisServer.Close)
+
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { require.NoError(t, redisClient.Close()) })
+
+	originalRedisEnabled := common.IsRedisEnabled()
+	originalRedisClient := common.RDB
+	common.SetRedisEnabled(true)
+	common.RDB = redisClient
+	t.Cleanup(func() {
+		common.SetRedisEnabled(originalRedisEnabled)
+		common.RDB = originalRedisClient
+	})
+}
+
+func exerciseTokenRateLimits(t *testing.T, tokenId int) {
+	t.Helper()
+	ctx := context.Background()
+
+	allowed, used, _, err := TakeTokenRequest(ctx, tokenId, 2)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.EqualValues(t, 1, used)
+	allowed, used, reset, err := TakeTokenRequest(ctx, tokenId, 2)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.EqualValues(t, 2, used)
+	require.Positive(t, reset)
+	require.LessOrEqual(t, reset, TokenRateLimitWindowSeconds)
+	allowed, used, _, err = TakeTokenRequest(ctx, tokenId, 2)
+	require.NoError(t, err)
+	require.False(t, allowed, "a full window must reject without recording")
+	require.EqualValues(t, 2, used)
+
+	require.NoError(t, RecordTokenTPMUsage(ctx, tokenId, 1200))
+	require.NoError(t, RecordTokenTPMUsage(ctx, tokenId, 0))
+	require.NoError(t, RecordTokenTPMUsage(ctx, tokenId, 300))
+	used, _, err = GetTokenTPMWindow(ctx, tokenId)
+	require.NoError(t, err)
+	require.EqualValues(t, 1500, used)
+
+	ok, err := AcquireTokenInFlight(ctx, tokenId, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = AcquireTokenInFlight(ctx, tokenId, 1)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, ReleaseTokenInFlight(ctx, tokenId))
+	ok, err = AcquireTokenInFlight(ctx, tokenId, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, ReleaseTokenInFlight(ctx, tokenId))
+}
+
+func TestTokenRateLimits_InMemory(t *testing.T) {
+	originalRedisClient := common.RDB
+	common.RDB = nil
+	t.Cleanup(func() { common.RDB = originalRedisClient })
+
+	exerciseTokenRateLimits(t, 9101)
+}
+
+func TestTokenRateLimits_Redis(t *testing.T) {
+	useTokenRateLimitRedis(t)
+
+	exerciseTokenRateLimits(t, 9102)
+}
+
+func TestTakeTokenRequest_ConcurrentNeverExceedsLimit(t *testing.T) {
+	useTokenRateLimitRedis(t)
+	ctx := context.Background()
+	const limit = 5
+
+	var admitted atomic.Int64
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			allowed, _, _, err := TakeTokenRequest(ctx, 9103, limit)
+			if err == nil && allowed {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, limit, admitted.Load())
+}
+
+func TestPostConsumeTokenUsageRecordsTPMOnlyForLimitedTokens(t *testing.T) {
+	setupTestDatabase(t)
+	useTokenRateLimitRedis(t)
+	ctx := context.Background()
+
+	previousBatchUpdateEnabled := config.BatchUpdateEnabled
+	config.BatchUpdateEnabled = false
+	t.Cleanup(func() { config.BatchUpdateEnabled = previousBatchUpdateEnabled })
+
+	user := &User{
+		Username: fmt.Sprintf("test-tpm-usage-%d", time.Now().UnixNano()),
+		Password: "testpassword12345",
+		Status:   UserStatusEnabled,
+		Role:     RoleCommonUser,
+		Quota:    1000,
+	}
+	require.NoError(t, DB.Create(user).Error)
+
+	newToken := func(name string, tpm int) *Token {
+		token := &Token{
+			UserId:       user.Id,
+			Key:          fmt.Sprintf("test-tpm-usage-%s-%d", name, time.Now().UnixNano()),
+			Status:       TokenStatusEnabled,
+			Name:         name,
+			CreatedTime:  helper.GetTimestamp(),
+			AccessedTime: helper.GetTimestamp(),
+			RemainQuota:  1000,
+			RateLimitTPM: tpm,
+		}
+		require.NoError(t, DB.Create(token).Error)
+		return token
+	}
+	unlimited := newToken("unlimited", 0)
+	limited := newToken("limited", 1000)
+
+	require.NoError(t, PostConsumeTokenUsage(ctx, unlimited.Id, 10, 300))
+	require.NoError(t, PostConsumeTokenUsage(ctx, limited.Id, 10, 300))
+
+	exists, err := common.RDB.Exists(ctx, tokenTokensKey(unlimited.Id)).Result()
+	require.NoError(t, err)
+	require.Zero(t, exists, "tokens without a TPM limit must not be recorded")
+
+	used, _, err := GetTokenTPMWindow(ctx, limited.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(300), used)
+}
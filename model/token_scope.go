@@ -0,0 +1,95 @@
+package model
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/Laisky/one-api/relay/channeltype"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+// NormalizeTokenScopes validates a comma-separated scope list and returns it
+// lowercased, de-duplicated and in input order. Scope names are the endpoint
+// names of ChannelConfig.SupportedEndpoints plus the scope-only names of
+// channeltype.TokenScopeNames.
+//
+// Parameters:
+//   - raw: the scope list supplied by the client.
+//
+// Return values:
+//   - string: the canonical list; empty when raw names no scope.
+//   - error: when raw contains an unknown scope name.
+func NormalizeTokenScopes(raw string) (string, error) {
+	scopes := splitTokenScopes(raw)
+	for _, scope := range scopes {
+		if !channeltype.IsTokenScopeName(scope) {
+			return "", errors.Errorf("unknown scope %q, valid scopes are: %s",
+				scope, strings.Join(channeltype.TokenScopeNames(), ", "))
+		}
+	}
+	return strings.Join(scopes, ","), nil
+}
+
+// splitTokenScopes splits a comma-separated scope list into trimmed,
+// lowercased, de-duplicated names.
+func splitTokenScopes(raw string) []string {
+	scopes := make([]string, 0)
+	for part := range strings.SplitSeq(raw, ",") {
+		scope := strings.ToLower(strings.TrimSpace(part))
+		if scope == "" || slices.Contains(scopes, scope) {
+			continue
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes
+}
+
+// ScopeList returns the relay endpoints the token may call, or nil when the
+// token is not restricted.
+func (t *Token) ScopeList() []string {
+	if t == nil {
+		return nil
+	}
+	scopes := splitTokenScopes(t.Scopes)
+	if len(scopes) == 0 {
+		return nil
+	}
+	return scopes
+}
+
+// modelListingPath reports whether path lists or retrieves models. Listing is
+// open to scoped tokens because ListModels already filters by scope.
+func modelListingPath(path string) bool {
+	return path == "/v1/models" || strings.HasPrefix(path, "/v1/models/")
+}
+
+// TokenScopeForPath returns the token scope that covers a request path: the
+// scope of its relay mode, or of its gateway API (files, batches,
+// conversations, MCP). It is empty when no scope covers the path, such as the
+// channel proxy and the unimplemented assistants and fine-tuning routes.
+func TokenScopeForPath(path string) string {
+	if mode := relaymode.GetByPath(path); mode != relaymode.Unknown {
+		return channeltype.RelayModeToScopeName(mode)
+	}
+	return channeltype.GatewayPathToScopeName(path)
+}
+
+// TokenScopesAllowPath reports whether a scope list permits a request path.
+// An empty list permits everything, and model listing is always permitted.
+// Any other path no scope covers is denied to scoped tokens.
+//
+// Parameters:
+//   - scopes: the token's scope list, as returned by Token.ScopeList.
+//   - path: the request URL path.
+//
+// Return values:
+//   - bool: true when the request may proceed.
+func TokenScopesAllowPath(scopes []string, path string) bool {
+	if len(scopes) == 0 || modelListingPath(path) {
+		return true
+	}
+	name := TokenScopeForPath(path)
+	return name != "" && slices.Contains(scopes, name)
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTokenScopes(t *testing.T) {
+	scopes, err := NormalizeTokenScopes(" Embeddings, rerank,embeddings ,, ")
+	require.NoError(t, err)
+	require.Equal(t, "embeddings,rerank", scopes)
+
+	scopes, err = NormalizeTokenScopes("")
+	require.NoError(t, err)
+	require.Empty(t, scopes)
+
+	_, err = NormalizeTokenScopes("embeddings,fine_tuning")
+	require.ErrorContains(t, err, `unknown scope "fine_tuning"`)
+}
+
+func TestTokenScopesAllowPath(t *testing.T) {
+	unrestricted := &Token{}
+	require.Nil(t, unrestricted.ScopeList())
+	require.True(t, TokenScopesAllowPath(unrestricted.ScopeList(), "/v1/images/generations"))
+	require.True(t, TokenScopesAllowPath(unrestricted.ScopeList(), "/v1/files"))
+
+	token := &Token{Scopes: "chat_completions,voice_clone,batches"}
+	scopes := token.ScopeList()
+	require.True(t, TokenScopesAllowPath(scopes, "/v1/chat/completions"))
+	require.True(t, TokenScopesAllowPath(scopes, "/v1/voice/clones"))
+	require.True(t, TokenScopesAllowPath(scopes, "/v1/batches/batch_1/cancel"))
+	require.True(t, TokenScopesAllowPath(scopes, "/v1/models"), "model listing is filtered, not denied")
+	require.False(t, TokenScopesAllowPath(scopes, "/v1/embeddings"))
+	require.False(t, TokenScopesAllowPath(scopes, "/v1/videos"))
+	require.False(t, TokenScopesAllowPath(scopes, "/v1/files"))
+	require.False(t, TokenScopesAllowPath(scopes, "/v1/conversations"))
+	require.False(t, TokenScopesAllowPath(scopes, "/v1/oneapi/proxy/1/anything"), "paths no scope covers are denied")
+	require.False(t, TokenScopesAllowPath(scopes, "/v1/assistants"), "paths no scope covers are denied")
+}
@@ -1,53 +1,67 @@
 package model
 
 import (
-	"strings"
-
 	"github.com/Laisky/one-api/common/config"
 	"github.com/Laisky/one-api/dto"
 )
 
 // ToResponse builds the external boundary DTO for an API token. It replaces the
-// retired Token.MarshalJSON whitelist and carries the key-prefix normalization
-// verbatim: the stored key is stripped of any known legacy prefix and the
-// configured prefix is applied at response time only (the DB value is not
-// modified). No internal integer id or user_id crosses the API.
+// retired Token.MarshalJSON whitelist. Only a freshly created token still holds
+// its plaintext key, which is returned with the configured prefix; every other
+// response carries the masked display prefix, since the database stores only
+// the key hash. No internal integer id or user_id crosses the API.
 //
 // Parameters: none (pointer receiver).
 //
 // Return values:
-//   - dto.TokenResponse: the UUID-only external shape with a prefixed key. A
-//     nil receiver yields the zero shape.
+//   - dto.TokenResponse: the UUID-only external shape with a prefixed full or
+//     masked key. A nil receiver yields the zero shape.
 func (t *Token) ToResponse() dto.TokenResponse {
 	if t == nil {
 		return dto.TokenResponse{}
 	}
 	return dto.TokenResponse{
-		UUID:           t.UUID,
-		UserUUID:       t.UserUUID,
-		Key:            normalizeTokenKeyForResponse(t.Key),
-		Status:         t.Status,
-		Name:           t.Name,
-		CreatedTime:    t.CreatedTime,
-		AccessedTime:   t.AccessedTime,
-		ExpiredTime:    t.ExpiredTime,
-		RemainQuota:    t.RemainQuota,
-		UnlimitedQuota: t.UnlimitedQuota,
-		UsedQuota:      t.UsedQuota,
-		CreatedAt:      t.CreatedAt,
-		UpdatedAt:      t.UpdatedAt,
-		Models:         t.Models,
-		Subnet:         t.Subnet,
+		UUID:            t.UUID,
+		UserUUID:        t.UserUUID,
+		Key:             t.responseKey(),
+		Status:          t.Status,
+		Name:            t.Name,
+		CreatedTime:     t.CreatedTime,
+		AccessedTime:    t.AccessedTime,
+		ExpiredTime:     t.ExpiredTime,
+		RemainQuota:     t.RemainQuota,
+		UnlimitedQuota:  t.UnlimitedQuota,
+		UsedQuota:       t.UsedQuota,
+		CreatedAt:       t.CreatedAt,
+		UpdatedAt:       t.UpdatedAt,
+		Models:          t.Models,
+		Subnet:          t.Subnet,
+		RateLimitRPM:    t.RateLimitRPM,
+		RateLimitTPM:    t.RateLimitTPM,
+		MaxInFlight:     t.MaxInFlight,
+		BudgetPeriod:    t.BudgetPeriod,
+		BudgetQuota:     t.BudgetQuota,
+		GuardrailPolicy: t.GuardrailPolicy,
+		ContextStrategy: t.ContextStrategy,
+		OrgUUID:         t.OrgUUID,
+		Scopes:          t.Scopes,
+	}
+}
+
+// responseKey returns the full prefixed key of a freshly created token, or the
+// masked display prefix (for example "sk-AbCdEfGh...") of a stored one.
+func (t *Token) responseKey() string {
+	if t.Key != "" {
+		return normalizeTokenKeyForResponse(t.Key)
 	}
+	return normalizeTokenKeyForResponse(t.KeyPrefix) + "..."
 }
 
 // normalizeTokenKeyForResponse strips any known legacy prefix from a stored key
 // and applies the configured token key prefix (defaulting to "sk-"). This is the
 // exact logic previously embedded in Token.MarshalJSON.
 func normalizeTokenKeyForResponse(key string) string {
-	raw := key
-	raw = strings.TrimPrefix(raw, "sk-")
-	raw = strings.TrimPrefix(raw, "laisky-")
+	raw := stripLegacyTokenKeyPrefix(key)
 	prefix := config.TokenKeyPrefix
 	if prefix == "" {
 		prefix = "sk-"
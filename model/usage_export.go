@@ -0,0 +1,61 @@
+package model
+
+import (
+	"context"
+
+	"github.com/Laisky/zap"
+
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/common/usageexport"
+)
+
+// publishUsageEvent hands a finalized consume log to the usage exporter. A log
+// that was not persisted still gets a UUID so the event can be de-duplicated.
+func publishUsageEvent(log *Log) {
+	if log == nil || !usageexport.Enabled() {
+		return
+	}
+	_ = ensureUUID(&log.UUID)
+	usageexport.Publish(usageEventFromLog(log))
+}
+
+// publishReconciledUsageEvent reloads a reconciled consume log, whose caller
+// only holds the finalized billing fields, and exports it. The reload ignores
+// ctx cancellation because reconciliation often runs after the client left.
+func publishReconciledUsageEvent(ctx context.Context, logID int) {
+	if !usageexport.Enabled() {
+		return
+	}
+	row := &Log{}
+	if err := LOG_DB.WithContext(context.WithoutCancel(ctx)).First(row, "id = ?", logID).Error; err != nil {
+		logger.FromContext(ctx).Warn("failed to load reconciled log for usage export",
+			zap.Error(err), zap.Int("log_id", logID))
+		return
+	}
+	usageexport.Publish(usageEventFromLog(row))
+}
+
+// usageEventFromLog maps a consume log row onto the exported event.
+func usageEventFromLog(log *Log) usageexport.Event {
+	return usageexport.Event{
+		EventID:            log.UUID,
+		Type:               usageexport.EventTypeConsume,
+		Timestamp:          log.CreatedAt,
+		LogID:              log.Id,
+		UserUUID:           derefStr(log.UserUUID),
+		TokenUUID:          derefStr(log.TokenUUID),
+		TokenName:          log.TokenName,
+		ChannelUUID:        derefStr(log.ChannelUUID),
+		OrgID:              log.OrgId,
+		Model:              log.ModelName,
+		OriginModel:        log.OriginModelName,
+		PromptTokens:       log.PromptTokens,
+		CompletionTokens:   log.CompletionTokens,
+		CachedPromptTokens: log.CachedPromptTokens,
+		Quota:              int64(log.Quota),
+		ElapsedMs:          log.ElapsedTime,
+		IsStream:           log.IsStream,
+		RequestID:          log.RequestId,
+		TraceID:            log.TraceId,
+	}
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/usageexport"
+)
+
+// recordingUsageSink keeps every exported usage event.
+type recordingUsageSink struct {
+	mu     sync.Mutex
+	events []usageexport.Event
+}
+
+func (s *recordingUsageSink) Name() string { return "recording" }
+
+func (s *recordingUsageSink) Write(_ context.Context, events []usageexport.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *recordingUsageSink) Close() error { return nil }
+
+// withRecordingUsageExporter installs an exporter for one test and returns a
+// function that flushes it and returns the delivered events.
+func withRecordingUsageExporter(t *testing.T) func() []usageexport.Event {
+	t.Helper()
+	sink := &recordingUsageSink{}
+	exporter, err := usageexport.New(usageexport.Options{FlushInterval: time.Hour}, sink)
+	require.NoError(t, err)
+	usageexport.SetExporter(exporter)
+	t.Cleanup(func() {
+		usageexport.SetExporter(nil)
+		_ = exporter.Close(context.Background())
+	})
+	return func() []usageexport.Event {
+		usageexport.SetExporter(nil)
+		require.NoError(t, exporter.Close(context.Background()))
+		return sink.events
+	}
+}
+
+func TestConsumeLogsExportUsageEvents(t *testing.T) {
+	setupTestLogDB(t)
+	flush := withRecordingUsageExporter(t)
+	ctx := context.Background()
+
+	direct := &Log{UserId: 42, ModelName: "gpt-4o", PromptTokens: 10, CompletionTokens: 5, Quota: 150, TraceId: "trace-direct"}
+	SetLogExternalUUIDs(direct, "user-uuid", "channel-uuid", "token-uuid")
+	RecordConsumeLog(ctx, direct)
+
+	provisional := &Log{UserId: 42, ModelName: "gpt-4o-mini", RequestId: "req-2", TraceId: "trace-reconciled"}
+	SetLogExternalUUIDs(provisional, "user-uuid", "channel-uuid", "token-uuid")
+	logID := RecordProvisionalConsumeLog(ctx, provisional, 1000)
+	require.Positive(t, logID)
+	require.NoError(t, ReconcileConsumeLogDetailed(ctx, logID, ConsumeLogReconcileDetail{
+		FinalQuota:       420,
+		PromptTokens:     30,
+		CompletionTokens: 12,
+	}))
+
+	events := flush()
+	require.Len(t, events, 2, "the provisional row is exported only once it is reconciled")
+
+	require.Equal(t, direct.UUID, events[0].EventID)
+	require.Equal(t, usageexport.EventTypeConsume, events[0].Type)
+	require.Equal(t, "user-uuid", events[0].UserUUID)
+	require.Equal(t, "token-uuid", events[0].TokenUUID)
+	require.Equal(t, "channel-uuid", events[0].ChannelUUID)
+	require.Equal(t, int64(150), events[0].Quota)
+	require.Equal(t, 10, events[0].PromptTokens)
+	require.Equal(t, "trace-direct", events[0].TraceID)
+
+	require.Equal(t, logID, events[1].LogID)
+	require.Equal(t, "gpt-4o-mini", events[1].Model)
+	require.Equal(t, int64(420), events[1].Quota)
+	require.Equal(t, 12, events[1].CompletionTokens)
+	require.Equal(t, "trace-reconciled", events[1].TraceID)
+	require.Equal(t, "token-uuid", events[1].TokenUUID)
+}
@@ -61,6 +61,13 @@ type User struct {
 	Metadata         UserMetadata    `json:"metadata" gorm:"type:text;serializer:json"`
 	CreatedAt        int64           `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
 	UpdatedAt        int64           `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
+
+	// Spend budget shared by all of the user's tokens; see Token for the fields.
+	BudgetPeriod          string `json:"budget_period,omitempty" gorm:"type:varchar(16);default:''"`
+	BudgetQuota           int64  `json:"budget_quota,omitempty" gorm:"bigint;default:0"`
+	BudgetUsed            int64  `json:"budget_used,omitempty" gorm:"bigint;default:0"`
+	BudgetWindowStart     int64  `json:"budget_window_start,omitempty" gorm:"bigint;default:0"`
+	BudgetNotifiedPercent int    `json:"budget_notified_percent,omitempty" gorm:"default:0"`
 }
 
 var userSortFields = map[string]string{
@@ -264,7 +271,9 @@ func (user *User) Update(updatePassword bool) error {
 	case UserStatusEnabled:
 		blacklist.UnbanUser(user.Id)
 	}
-	err = DB.Model(user).Omit("uuid", "inviter_uuid").Updates(user).Error
+	// The budget window state is only ever advanced by chargeBudget; a stale
+	// copy loaded before this update must not overwrite it.
+	err = DB.Model(user).Omit("uuid", "inviter_uuid", "budget_used", "budget_window_start", "budget_notified_percent").Updates(user).Error
 	if err != nil {
 		return identity.Tag(
 			errors.Wrapf(err, "failed to update user: id=%d, username=%s", user.Id, user.Username),
@@ -44,6 +44,8 @@ func (user *User) ToResponse() dto.UserResponse {
 		Metadata:         dto.UserMetadataResponse{PasswordLocked: user.Metadata.PasswordLocked},
 		CreatedAt:        user.CreatedAt,
 		UpdatedAt:        user.UpdatedAt,
+		BudgetPeriod:     user.BudgetPeriod,
+		BudgetQuota:      user.BudgetQuota,
 	}
 }
 
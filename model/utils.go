@@ -19,6 +19,9 @@ const (
 	BatchUpdateTypeUsedQuota
 	BatchUpdateTypeChannelUsedQuota
 	BatchUpdateTypeRequestCount
+	BatchUpdateTypeOrgQuota
+	BatchUpdateTypeOrgUsedQuota
+	BatchUpdateTypeOrgRequestCount
 	BatchUpdateTypeCount // if you add a new type, you need to add a new map and a new lock
 )
 
@@ -229,6 +232,17 @@ func batchUpdate(ctx context.Context) {
 				updateUserRequestCount(key, int(value))
 			case BatchUpdateTypeChannelUsedQuota:
 				updateChannelUsedQuota(ctx, key, value)
+			case BatchUpdateTypeOrgQuota:
+				if err := increaseOrgQuota(ctx, key, value); err != nil {
+					lg.Error("failed to batch update organization quota",
+						zap.Int("org_id", key),
+						zap.Int64("value", value),
+						zap.Error(err))
+				}
+			case BatchUpdateTypeOrgUsedQuota:
+				updateOrgUsedQuotaAndRequestCount(ctx, key, value, 0)
+			case BatchUpdateTypeOrgRequestCount:
+				updateOrgUsedQuotaAndRequestCount(ctx, key, 0, int(value))
 			}
 		}
 	}
@@ -83,7 +83,7 @@ func TestOldWriterStillWorksAfterCompletion(t *testing.T) {
 		"INSERT INTO users (id, username, password) VALUES (100, 'old-writer-a', 'password-hash'), (101, 'old-writer-b', 'password-hash')").Error,
 		"an old writer must still be able to create users after completion")
 	require.NoError(t, db.Exec(
-		"INSERT INTO tokens (id, user_id, `key`, name) VALUES (100, 100, 'old-writer-key-a', 'old-a'), (101, 100, 'old-writer-key-b', 'old-b')").Error,
+		"INSERT INTO tokens (id, user_id, key_hash, name) VALUES (100, 100, 'old-writer-key-a', 'old-a'), (101, 100, 'old-writer-key-b', 'old-b')").Error,
 		"an old writer must still be able to create tokens after completion")
 	require.NoError(t, db.Exec(
 		"INSERT INTO logs (id, user_id, type, content) VALUES (100, 100, 1, 'old writer log a'), (101, 100, 1, 'old writer log b')").Error,
@@ -241,11 +241,11 @@ func seedUUIDBatchTokens(t *testing.T, db *gorm.DB, userID int, name string, fir
 		for offset := start; offset < end; offset++ {
 			id := firstID + offset
 			rows = append(rows, map[string]any{
-				"id":      id,
-				"user_id": userID,
-				"key":     fmt.Sprintf("batch-key-%08d", id),
-				"name":    name,
-				"uuid":    uuidForID(id),
+				"id":       id,
+				"user_id":  userID,
+				"key_hash": fmt.Sprintf("batch-key-%08d", id),
+				"name":     name,
+				"uuid":     uuidForID(id),
 			})
 		}
 		require.NoError(t, db.Table("tokens").Create(rows).Error)
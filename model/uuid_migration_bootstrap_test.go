@@ -64,7 +64,7 @@ func seedBootstrapLegacyRows(t *testing.T, db *gorm.DB) {
 	t.Helper()
 	require.NoError(t, db.Exec("INSERT INTO users (id, username, password, inviter_id) VALUES (1, 'root', 'password-hash', 0), (2, 'child', 'password-hash', 1)").Error)
 	require.NoError(t, db.Exec("INSERT INTO channels (id, type, name, models, config) VALUES (1, 1, 'primary', 'gpt-4o', '{}')").Error)
-	require.NoError(t, db.Exec("INSERT INTO tokens (id, user_id, `key`, name) VALUES (1, 1, 'legacy-token-key', 'default')").Error)
+	require.NoError(t, db.Exec("INSERT INTO tokens (id, user_id, key_hash, name) VALUES (1, 1, 'legacy-token-key', 'default')").Error)
 	require.NoError(t, db.Exec("INSERT INTO logs (id, user_id, channel_id, type, token_name, content) VALUES (1, 1, 1, 1, 'default', 'legacy log')").Error)
 }
 
@@ -57,9 +57,8 @@ func seedUUIDRaceLegacyTokens(t *testing.T, db *gorm.DB, count int) {
 		for id := start; id <= end; id++ {
 			rows = append(rows, map[string]any{
 				"id": id, "user_id": id,
-				// "key" is reserved; the map form lets GORM quote it for the dialect.
-				"key":  "legacy-key-" + strconv.Itoa(id),
-				"name": "token-" + strconv.Itoa(id),
+				"key_hash": "legacy-key-" + strconv.Itoa(id),
+				"name":     "token-" + strconv.Itoa(id),
 			})
 		}
 		require.NoError(t, db.Table("tokens").Create(rows).Error)
@@ -200,7 +199,7 @@ func TestConcurrentCatchUpNeverOverwritesPopulatedUUIDs(t *testing.T) {
 		(900, ?, 'pinned-owner', 'password-hash'), (901, ?, 'pinned-other', 'password-hash')`,
 		ownerUUID, otherUUID).Error)
 	// tokens.user_uuid deliberately points at the wrong user: catch-up must not repair it.
-	require.NoError(t, db.Exec("INSERT INTO tokens (id, uuid, user_id, user_uuid, `key`, name) VALUES (900, ?, 900, ?, 'pinned-key', 'pinned')",
+	require.NoError(t, db.Exec("INSERT INTO tokens (id, uuid, user_id, user_uuid, key_hash, name) VALUES (900, ?, 900, ?, 'pinned-key', 'pinned')",
 		tokenUUID, otherUUID).Error)
 
 	_, errs := runUUIDRaceCatchUpWorkers(topology, uuidRaceWorkerCount)
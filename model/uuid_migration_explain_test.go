@@ -66,11 +66,11 @@ func seedUUIDLiveTokens(t *testing.T, db *gorm.DB, total int) {
 			// equally selective, and the planner would then be free to pick either index —
 			// proving nothing about composite-index usability.
 			rows = append(rows, map[string]any{
-				"id":      id,
-				"user_id": ((id - 1) % uuidPlanTokenUsers) + 1,
-				"key":     "plan-token-key-" + strconv.Itoa(id),
-				"name":    "plan-token-" + strconv.Itoa((id-1)/uuidPlanTokenUsers),
-				"uuid":    uuidMultiDBFixtureUUID(1000000 + id),
+				"id":       id,
+				"user_id":  ((id - 1) % uuidPlanTokenUsers) + 1,
+				"key_hash": "plan-token-key-" + strconv.Itoa(id),
+				"name":     "plan-token-" + strconv.Itoa((id-1)/uuidPlanTokenUsers),
+				"uuid":     uuidMultiDBFixtureUUID(1000000 + id),
 			})
 		}
 		require.NoError(t, db.Table("tokens").Create(rows).Error, "seed tokens %d..%d", start, end)
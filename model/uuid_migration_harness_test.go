@@ -338,7 +338,7 @@ func seedLegacyUUIDRows(t *testing.T, db *gorm.DB) {
 		"id": 1, "type": 1, "name": "primary", "models": "gpt-4o", "config": "{}",
 	}).Error)
 	require.NoError(t, db.Table("tokens").Create(map[string]any{
-		"id": 1, "user_id": 1, "key": "legacy-token-key", "name": "default",
+		"id": 1, "user_id": 1, "key_hash": "legacy-token-key", "name": "default",
 	}).Error)
 	require.NoError(t, db.Table("logs").Create(map[string]any{
 		"id": 1, "user_id": 1, "channel_id": 1, "type": 1, "token_name": "default", "content": "legacy log",
@@ -66,7 +66,7 @@ func TestUUIDMigrationProgressLogsExposeNoSecrets(t *testing.T) {
 	)
 	require.NoError(t, db.Exec("INSERT INTO users (id, username, password) VALUES (1, 'root', ?)", secretPassword).Error)
 	require.NoError(t, db.Exec("INSERT INTO channels (id, type, name, models, config) VALUES (1, 1, 'c', 'gpt-4o', '{}')").Error)
-	require.NoError(t, db.Exec("INSERT INTO tokens (id, user_id, `key`, name) VALUES (1, 1, ?, 'default')", secretTokenKey).Error)
+	require.NoError(t, db.Exec("INSERT INTO tokens (id, user_id, key_hash, name) VALUES (1, 1, ?, 'default')", secretTokenKey).Error)
 	require.NoError(t, db.Exec("INSERT INTO logs (id, user_id, channel_id, type, token_name, content) VALUES (1, 1, 1, 1, 'default', ?)", secretContent).Error)
 
 	output := captureUUIDMigrationLogs(t, func(ctx context.Context) {
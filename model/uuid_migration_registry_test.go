@@ -297,7 +297,7 @@ func seedUUIDRegistryLegacyFixture(t *testing.T, db *gorm.DB) {
 		"INSERT INTO channels (id, uuid, type, name, models, config) VALUES (?, ?, 1, 'uuid-registry-owner-channel', 'gpt-4o', '{}')",
 		uuidRegistryOwnerID, uuidRegistryOwnerChannelUUID).Error)
 	require.NoError(t, db.Exec(
-		"INSERT INTO tokens (id, uuid, user_id, user_uuid, `key`, name) VALUES (?, ?, ?, ?, 'uuid-registry-owner-key', ?)",
+		"INSERT INTO tokens (id, uuid, user_id, user_uuid, key_hash, name) VALUES (?, ?, ?, ?, 'uuid-registry-owner-key', ?)",
 		uuidRegistryOwnerID, uuidRegistryOwnerTokenUUID, uuidRegistryOwnerID, uuidRegistryOwnerUserUUID,
 		uuidRegistryOwnerTokenName).Error)
 	require.NoError(t, db.Exec(
@@ -316,9 +316,9 @@ func seedUUIDRegistryLegacyFixture(t *testing.T, db *gorm.DB) {
 			"(?, '', 'uuid-registry-empty-user', 'password-hash', ?, '')",
 		uuidRegistryNullRowID, uuidRegistryOwnerID, uuidRegistryEmptyRowID, uuidRegistryOwnerID).Error)
 
-	// tokens: owned uuid plus user_uuid. `key` is reserved, so it stays quoted.
+	// tokens: owned uuid plus user_uuid.
 	require.NoError(t, db.Exec(
-		"INSERT INTO tokens (id, uuid, user_id, user_uuid, `key`, name) VALUES "+
+		"INSERT INTO tokens (id, uuid, user_id, user_uuid, key_hash, name) VALUES "+
 			"(?, NULL, ?, NULL, 'uuid-registry-null-token-key', 'uuid-registry-null-token'), "+
 			"(?, '', ?, '', 'uuid-registry-empty-token-key', 'uuid-registry-empty-token')",
 		uuidRegistryNullRowID, uuidRegistryOwnerID, uuidRegistryEmptyRowID, uuidRegistryOwnerID).Error)
@@ -15,7 +15,7 @@ func seedUnifiedLegacyRows(t *testing.T, db *gorm.DB) {
 	t.Helper()
 	require.NoError(t, db.Exec("INSERT INTO users (id, username, password, inviter_id) VALUES (1, 'root', 'password-hash', 0), (2, 'child', 'password-hash', 1)").Error)
 	require.NoError(t, db.Exec("INSERT INTO channels (id, type, name, models, config) VALUES (1, 1, 'primary', 'gpt-4o', '{}')").Error)
-	require.NoError(t, db.Exec("INSERT INTO tokens (id, user_id, `key`, name) VALUES (1, 1, 'legacy-token-key', 'default')").Error)
+	require.NoError(t, db.Exec("INSERT INTO tokens (id, user_id, key_hash, name) VALUES (1, 1, 'legacy-token-key', 'default')").Error)
 	require.NoError(t, db.Exec("INSERT INTO logs (id, user_id, channel_id, type, token_name, content) VALUES (1, 1, 1, 1, 'default', 'legacy log')").Error)
 	require.NoError(t, db.Exec("INSERT INTO redemptions (id, user_id, `key`, name) VALUES (1, 1, 'legacy-redemption-key', 'gift')").Error)
 }
@@ -74,7 +74,7 @@ func TestSplitFinalizerBackfillsCrossDatabaseUUIDs(t *testing.T) {
 
 	require.NoError(t, primary.Exec("INSERT INTO users (id, username, password) VALUES (1, 'root', 'password-hash')").Error)
 	require.NoError(t, primary.Exec("INSERT INTO channels (id, type, name, models, config) VALUES (1, 1, 'primary', 'gpt-4o', '{}')").Error)
-	require.NoError(t, primary.Exec("INSERT INTO tokens (id, user_id, `key`, name) VALUES (1, 1, 'legacy-token-key', 'default')").Error)
+	require.NoError(t, primary.Exec("INSERT INTO tokens (id, user_id, key_hash, name) VALUES (1, 1, 'legacy-token-key', 'default')").Error)
 	require.NoError(t, primary.Exec("INSERT INTO token_transactions (id, transaction_id, token_id, user_id, status, pre_quota, log_id) VALUES (1, 'txn-split-log', 1, 1, 1, 10, 77)").Error)
 	require.NoError(t, logDB.Exec("INSERT INTO logs (id, user_id, channel_id, type, token_name, content) VALUES (77, 1, 1, 1, 'default', 'split log')").Error)
 
@@ -371,7 +371,7 @@ func TestOrphansAndAmbiguityDoNotBlockCompletion(t *testing.T) {
 	require.NoError(t, db.Exec("INSERT INTO users (id, username, password) VALUES (1, 'root', 'password-hash')").Error)
 	require.NoError(t, db.Exec("INSERT INTO channels (id, type, name, models, config) VALUES (1, 1, 'c', 'gpt-4o', '{}')").Error)
 	// Two tokens share one (user_id, name): the key is permanently ambiguous.
-	require.NoError(t, db.Exec("INSERT INTO tokens (id, user_id, `key`, name) VALUES (1, 1, 'k1', 'dup'), (2, 1, 'k2', 'dup'), (3, 1, 'k3', 'unique')").Error)
+	require.NoError(t, db.Exec("INSERT INTO tokens (id, user_id, key_hash, name) VALUES (1, 1, 'k1', 'dup'), (2, 1, 'k2', 'dup'), (3, 1, 'k3', 'unique')").Error)
 	require.NoError(t, db.Exec(`INSERT INTO logs (id, user_id, channel_id, type, token_name, content) VALUES
 		(1, 999, 1, 1, 'unique', 'orphan user'),
 		(2, 1, 1, 1, 'dup', 'ambiguous token'),
@@ -431,7 +431,7 @@ func TestConditionalUpdateRechecksObservedReference(t *testing.T) {
 	t.Run("token name", func(t *testing.T) {
 		db, topology := newUnifiedTestTopology(t)
 		require.NoError(t, db.Exec("INSERT INTO users (id, uuid, username, password) VALUES (1, '018f0000-0000-7000-8000-000000000001', 'root', 'password-hash')").Error)
-		require.NoError(t, db.Exec("INSERT INTO tokens (id, uuid, user_id, `key`, name) VALUES (1, '018f0000-0000-7000-8000-000000000003', 1, 'k', 'alpha')").Error)
+		require.NoError(t, db.Exec("INSERT INTO tokens (id, uuid, user_id, key_hash, name) VALUES (1, '018f0000-0000-7000-8000-000000000003', 1, 'k', 'alpha')").Error)
 		require.NoError(t, db.Exec("INSERT INTO logs (id, user_id, type, token_name, content) VALUES (1, 1, 1, 'alpha', 'renamed')").Error)
 
 		run := &uuidMigrationRun{topology: topology, mode: uuidMigrationModeCatchUp}
@@ -460,7 +460,7 @@ func TestPopulatedUUIDsAreNeverOverwritten(t *testing.T) {
 	otherUUID := "018f0000-0000-7000-8000-000000000002"
 	require.NoError(t, db.Exec("INSERT INTO users (id, uuid, username, password) VALUES (1, ?, 'root', 'password-hash'), (2, ?, 'other', 'password-hash')", ownedUUID, otherUUID).Error)
 	// tokens.user_uuid deliberately points at the wrong user; catch-up must not silently fix it.
-	require.NoError(t, db.Exec("INSERT INTO tokens (id, uuid, user_id, user_uuid, `key`, name) VALUES (1, '018f0000-0000-7000-8000-000000000003', 1, ?, 'k', 'n')", otherUUID).Error)
+	require.NoError(t, db.Exec("INSERT INTO tokens (id, uuid, user_id, user_uuid, key_hash, name) VALUES (1, '018f0000-0000-7000-8000-000000000003', 1, ?, 'k', 'n')", otherUUID).Error)
 
 	runCatchUp(t, topology)
 
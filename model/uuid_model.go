@@ -34,13 +34,17 @@ func (user *User) BeforeCreate(tx *gorm.DB) error {
 	return ensureUUID(&user.UUID)
 }
 
-// BeforeCreate assigns a server-generated UUID to a token before insertion.
+// BeforeCreate assigns a server-generated UUID to a token before insertion and
+// derives the stored key hash when only a plaintext key was set.
 // Parameters:
 //   - tx: GORM transaction supplied by the create callback.
 //
 // Return values:
 //   - error: non-nil only if UUID generation fails.
 func (t *Token) BeforeCreate(tx *gorm.DB) error {
+	if t.KeyHash == "" && t.Key != "" {
+		t.SetKey(t.Key)
+	}
 	return ensureUUID(&t.UUID)
 }
 
@@ -184,7 +184,7 @@ func TestUUIDMigrationTokenResolutionIsBounded(t *testing.T) {
 	rows := make([]map[string]any, 0, duplicates)
 	for id := 1; id <= duplicates; id++ {
 		rows = append(rows, map[string]any{
-			"id": id, "user_id": 1, "key": "dup-key-" + strconv.Itoa(id), "name": "ambiguous",
+			"id": id, "user_id": 1, "key_hash": "dup-key-" + strconv.Itoa(id), "name": "ambiguous",
 			"uuid": fmt.Sprintf("018f0000-0000-7000-8000-%012d", id),
 		})
 	}
@@ -482,7 +482,7 @@ func seedUUIDScaleReferenceRows(t *testing.T, db *gorm.DB) {
 // Return values: none.
 func seedUUIDScaleTokens(t *testing.T, db *gorm.DB, tokenRows int) {
 	t.Helper()
-	seedUUIDScaleRows(t, db, "tokens", []string{"id", "user_id", "key", "name", "status"}, tokenRows, func(id int) []any {
+	seedUUIDScaleRows(t, db, "tokens", []string{"id", "user_id", "key_hash", "name", "status"}, tokenRows, func(id int) []any {
 		name := fmt.Sprintf("scale-token-%d", id)
 		return []any{id, 1, name, name, TokenStatusEnabled}
 	})
@@ -0,0 +1,203 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/Laisky/one-api/common/logger"
+)
+
+// VirtualModelTarget is one model a virtual model routes to. Weight is the
+// relative share of requests the target receives; a zero weight keeps the
+// target as failover only.
+type VirtualModelTarget struct {
+	Model  string `json:"model"`
+	Weight int    `json:"weight"`
+}
+
+var virtualModelsLock sync.RWMutex
+
+// virtualModels maps a gateway-level alias to the models it resolves to, e.g.
+// {"team-default": [{"model": "claude-sonnet-4-5", "weight": 1}]}. It is loaded
+// from the VirtualModels option.
+var virtualModels = map[string][]VirtualModelTarget{}
+
+// ParseVirtualModels decodes and validates a VirtualModels option value. Each
+// alias maps either to a single model name or to a list of weighted targets:
+//
+//	{"team-default": "claude-sonnet-4-5",
+//	 "chat-ab": [{"model": "gpt-4o", "weight": 90}, {"model": "claude-sonnet-4-5", "weight": 10}]}
+//
+// An empty value clears every virtual model.
+//
+// Parameters:
+//   - jsonStr: JSON object mapping an alias to its target or targets.
+//
+// Returns:
+//   - map[string][]VirtualModelTarget: the normalized targets, names trimmed and
+//     a missing weight on a single target set to 1.
+//   - error: when the JSON is malformed, a name is blank, an alias targets itself
+//     or another alias, a target is listed twice, or no target has a positive weight.
+func ParseVirtualModels(jsonStr string) (map[string][]VirtualModelTarget, error) {
+	result := map[string][]VirtualModelTarget{}
+	if strings.TrimSpace(jsonStr) == "" {
+		return result, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(jsonStr), &raw); err != nil {
+		return nil, errors.Wrap(err, "unmarshal virtual models")
+	}
+	for alias, value := range raw {
+		alias = strings.TrimSpace(alias)
+		if alias == "" {
+			return nil, errors.New("virtual model has an empty name")
+		}
+		targets, err := parseVirtualModelTargets(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "virtual model %q", alias)
+		}
+		total := 0
+		seen := make([]string, 0, len(targets))
+		for i := range targets {
+			targets[i].Model = strings.TrimSpace(targets[i].Model)
+			name := targets[i].Model
+			switch {
+			case name == "":
+				return nil, errors.Errorf("virtual model %q has a target with an empty model name", alias)
+			case name == alias:
+				return nil, errors.Errorf("virtual model %q targets itself", alias)
+			case slices.Contains(seen, name):
+				return nil, errors.Errorf("virtual model %q lists %q twice", alias, name)
+			case targets[i].Weight < 0:
+				return nil, errors.Errorf("virtual model %q has a negative weight for %q", alias, name)
+			}
+			seen = append(seen, name)
+			total += targets[i].Weight
+		}
+		if total <= 0 {
+			return nil, errors.Errorf("virtual model %q needs a target with a positive weight", alias)
+		}
+		result[alias] = targets
+	}
+	for alias, targets := range result {
+		for _, target := range targets {
+			if _, nested := result[target.Model]; nested {
+				return nil, errors.Errorf("virtual model %q targets virtual model %q", alias, target.Model)
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseVirtualModelTargets accepts a model name or a list of weighted targets.
+func parseVirtualModelTargets(value json.RawMessage) ([]VirtualModelTarget, error) {
+	value = bytes.TrimSpace(value)
+	if len(value) > 0 && value[0] == '"' {
+		var name string
+		if err := json.Unmarshal(value, &name); err != nil {
+			return nil, errors.Wrap(err, "unmarshal target")
+		}
+		return []VirtualModelTarget{{Model: name, Weight: 1}}, nil
+	}
+	var targets []VirtualModelTarget
+	if err := json.Unmarshal(value, &targets); err != nil {
+		return nil, errors.Wrap(err, "unmarshal targets")
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("no targets")
+	}
+	if len(targets) == 1 && targets[0].Weight == 0 {
+		targets[0].Weight = 1
+	}
+	return targets, nil
+}
+
+// VirtualModels2JSONString serializes the active virtual models for OptionMap.
+func VirtualModels2JSONString() string {
+	virtualModelsLock.RLock()
+	defer virtualModelsLock.RUnlock()
+	jsonBytes, err := json.Marshal(virtualModels)
+	if err != nil {
+		logger.Logger.Error("error marshalling virtual models", zap.Error(err))
+	}
+	return string(jsonBytes)
+}
+
+// UpdateVirtualModelsByJSONString replaces the active virtual models.
+func UpdateVirtualModelsByJSONString(jsonStr string) error {
+	parsed, err := ParseVirtualModels(jsonStr)
+	if err != nil {
+		return errors.Wrap(err, "update virtual models")
+	}
+	virtualModelsLock.Lock()
+	defer virtualModelsLock.Unlock()
+	virtualModels = parsed
+	return nil
+}
+
+// GetVirtualModelTargets returns a copy of the targets of alias in configured
+// order, or nil when alias is not a virtual model.
+func GetVirtualModelTargets(alias string) []VirtualModelTarget {
+	virtualModelsLock.RLock()
+	defer virtualModelsLock.RUnlock()
+	return slices.Clone(virtualModels[alias])
+}
+
+// GetVirtualModelNames returns every configured alias, sorted.
+func GetVirtualModelNames() []string {
+	virtualModelsLock.RLock()
+	defer virtualModelsLock.RUnlock()
+	names := make([]string, 0, len(virtualModels))
+	for alias := range virtualModels {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveVirtualModel picks the target that serves one request for alias. The
+// first returned model is drawn at random in proportion to the weights; the
+// rest follow by descending weight and act as failover for the request.
+//
+// Parameters:
+//   - alias: the model name requested by the client.
+//
+// Returns:
+//   - []string: the target models in the order they should be tried, or nil
+//     when alias is not a virtual model.
+func ResolveVirtualModel(alias string) []string {
+	targets := GetVirtualModelTargets(alias)
+	if len(targets) == 0 {
+		return nil
+	}
+	total := 0
+	for _, target := range targets {
+		total += target.Weight
+	}
+	pick := rand.IntN(total)
+	picked := 0
+	for i, target := range targets {
+		if pick < target.Weight {
+			picked = i
+			break
+		}
+		pick -= target.Weight
+	}
+
+	ordered := []string{targets[picked].Model}
+	rest := slices.Delete(targets, picked, picked+1)
+	sort.SliceStable(rest, func(i, j int) bool { return rest[i].Weight > rest[j].Weight })
+	for _, target := range rest {
+		ordered = append(ordered, target.Model)
+	}
+	return ordered
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVirtualModels(t *testing.T) {
+	models, err := ParseVirtualModels(`{" team-default ":" claude-sonnet-4-5","chat-ab":[{"model":"gpt-4o","weight":90},{"model":"claude-sonnet-4-5","weight":10}],"solo":[{"model":"gpt-4o"}]}`)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]VirtualModelTarget{
+		"team-default": {{Model: "claude-sonnet-4-5", Weight: 1}},
+		"chat-ab":      {{Model: "gpt-4o", Weight: 90}, {Model: "claude-sonnet-4-5", Weight: 10}},
+		"solo":         {{Model: "gpt-4o", Weight: 1}},
+	}, models)
+
+	models, err = ParseVirtualModels("  ")
+	require.NoError(t, err)
+	require.Empty(t, models)
+
+	for _, bad := range []string{
+		`not json`,
+		`{"":"gpt-4o"}`,
+		`{"alias":""}`,
+		`{"alias":[]}`,
+		`{"alias":"alias"}`,
+		`{"alias":[{"model":"gpt-4o","weight":1},{"model":"gpt-4o","weight":2}]}`,
+		`{"alias":[{"model":"gpt-4o","weight":-1},{"model":"o3","weight":2}]}`,
+		`{"alias":[{"model":"gpt-4o","weight":0},{"model":"o3","weight":0}]}`,
+		`{"alias":"other","other":"gpt-4o"}`,
+	} {
+		_, err := ParseVirtualModels(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestResolveVirtualModel(t *testing.T) {
+	t.Cleanup(func() { _ = UpdateVirtualModelsByJSONString("") })
+
+	require.NoError(t, UpdateVirtualModelsByJSONString(
+		`{"chat-ab":[{"model":"a","weight":3},{"model":"b","weight":1},{"model":"backup","weight":0}]}`))
+	require.Equal(t, []string{"chat-ab"}, GetVirtualModelNames())
+	require.Nil(t, ResolveVirtualModel("a"))
+
+	picks := map[string]int{}
+	for range 4000 {
+		order := ResolveVirtualModel("chat-ab")
+		require.Len(t, order, 3)
+		require.ElementsMatch(t, []string{"a", "b", "backup"}, order)
+		require.Equal(t, "backup", order[2], "a zero-weight target is failover only")
+		picks[order[0]]++
+	}
+	require.Zero(t, picks["backup"])
+	require.InDelta(t, 3000, picks["a"], 200)
+	require.InDelta(t, 1000, picks["b"], 200)
+
+	// Resolving must not reorder the configured targets.
+	require.Equal(t, []VirtualModelTarget{{"a", 3}, {"b", 1}, {"backup", 0}}, GetVirtualModelTargets("chat-ab"))
+
+	// An invalid value keeps the previous virtual models.
+	require.Error(t, UpdateVirtualModelsByJSONString(`{"chat-ab":"chat-ab"}`))
+	require.Len(t, GetVirtualModelTargets("chat-ab"), 3)
+}
@@ -1,5 +1,7 @@
 package model
 
+import "sync/atomic"
+
 // maxRoutingWeight caps a single candidate's contribution to the weighted-random
 // total. Real deployments use tiny weights (single/double digits); the cap exists
 // only so a pathologically large configured value can never overflow the int64
@@ -54,3 +56,46 @@ func weightedIndex(weights []uint, draw func(n int64) int64) int {
 	// in-range fallback for a misbehaving draw rather than a panic.
 	return len(weights) - 1
 }
+
+// channelHealthWeightScale multiplies configured weights before a weight
+// multiplier is applied, so fractional multipliers survive the conversion back
+// to integer routing weights.
+const channelHealthWeightScale = 1000
+
+// ChannelWeightMultipliers returns the routing weight multiplier of each
+// channel serving modelName, or nil to route by the configured weights alone.
+type ChannelWeightMultipliers func(modelName string, channels []*Channel) []float64
+
+// channelWeightMultipliers is installed by the monitor package, which owns the
+// channel health metrics; routing uses the configured weights until then.
+var channelWeightMultipliers atomic.Pointer[ChannelWeightMultipliers]
+
+// SetChannelWeightMultipliers installs the source of routing weight
+// multipliers. A nil fn restores routing by configured weights.
+func SetChannelWeightMultipliers(fn ChannelWeightMultipliers) {
+	if fn == nil {
+		channelWeightMultipliers.Store(nil)
+		return
+	}
+	channelWeightMultipliers.Store(&fn)
+}
+
+// weightMultipliers calls the installed multiplier source, if any.
+func weightMultipliers(modelName string, channels []*Channel) []float64 {
+	fn := channelWeightMultipliers.Load()
+	if fn == nil || modelName == "" {
+		return nil
+	}
+	multipliers := (*fn)(modelName, channels)
+	if len(multipliers) != len(channels) {
+		return nil
+	}
+	return multipliers
+}
+
+// healthAdjustedWeight scales a configured weight by a health multiplier.
+// Weights are first multiplied by channelHealthWeightScale so that multipliers
+// below 1 keep their precision.
+func healthAdjustedWeight(weight uint, multiplier float64) uint {
+	return uint(float64(clampRoutingWeight(weight)) * channelHealthWeightScale * multiplier)
+}
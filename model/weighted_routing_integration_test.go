@@ -442,7 +442,7 @@ func TestWeightedRouting_ConcurrentSelection(t *testing.T) {
 				} else {
 					local := make([]*Channel, len(channels))
 					copy(local, channels)
-					ch = pickWeightedChannel(local)
+					ch = pickWeightedChannel(local, model)
 				}
 				if err != nil {
 					errs <- err
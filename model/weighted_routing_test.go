@@ -160,7 +160,7 @@ func TestPickWeightedChannel_NilWeightTreatedAsZero(t *testing.T) {
 		{Id: 2, Weight: uintPtr(5)},
 	}
 	for range 200 {
-		got := pickWeightedChannel(channels)
+		got := pickWeightedChannel(channels, "")
 		require.NotNil(t, got)
 		require.Equal(t, 2, got.Id)
 	}
@@ -175,7 +175,7 @@ func TestPickWeightedChannel_DistributionApproximatelyMatchesWeights(t *testing.
 	counts := map[int]int{}
 	const n = 20000
 	for range n {
-		got := pickWeightedChannel(channels)
+		got := pickWeightedChannel(channels, "")
 		require.NotNil(t, got)
 		counts[got.Id]++
 	}
@@ -185,14 +185,14 @@ func TestPickWeightedChannel_DistributionApproximatelyMatchesWeights(t *testing.
 
 func TestPickWeightedChannel_EmptyAndAllZeroReturnNil(t *testing.T) {
 	t.Parallel()
-	require.Nil(t, pickWeightedChannel(nil))
-	require.Nil(t, pickWeightedChannel([]*Channel{}))
+	require.Nil(t, pickWeightedChannel(nil, ""))
+	require.Nil(t, pickWeightedChannel([]*Channel{}, ""))
 
 	channels := []*Channel{
 		{Id: 1, Weight: uintPtr(0)},
 		{Id: 2, Weight: nil},
 	}
-	require.Nil(t, pickWeightedChannel(channels), "all-zero weights must signal uniform fallback via nil")
+	require.Nil(t, pickWeightedChannel(channels, ""), "all-zero weights must signal uniform fallback via nil")
 }
 
 func TestPickWeightedChannel_WeightedSelection(t *testing.T) {
@@ -203,8 +203,35 @@ func TestPickWeightedChannel_WeightedSelection(t *testing.T) {
 		{Id: 3, Weight: uintPtr(0)},
 	}
 	for range 200 {
-		got := pickWeightedChannel(channels)
+		got := pickWeightedChannel(channels, "")
 		require.NotNil(t, got)
 		require.Equal(t, 2, got.Id, "only the positively-weighted channel may be chosen")
 	}
 }
+
+func TestPickWeightedChannelAppliesWeightMultipliers(t *testing.T) {
+	channels := []*Channel{
+		{Id: 1, Weight: uintPtr(1)},
+		{Id: 2, Weight: uintPtr(1)},
+	}
+	SetChannelWeightMultipliers(func(modelName string, channels []*Channel) []float64 {
+		if modelName != "claude-sonnet-4" {
+			return nil
+		}
+		return []float64{1, 0.25}
+	})
+	t.Cleanup(func() { SetChannelWeightMultipliers(nil) })
+
+	counts := map[int]int{}
+	const n = 20000
+	for range n {
+		counts[pickWeightedChannel(channels, "claude-sonnet-4").Id]++
+	}
+	require.InDelta(t, 0.8, float64(counts[1])/n, 0.03, "weights 1 and 0.25 give channel 1 80%% of traffic")
+
+	counts = map[int]int{}
+	for range n {
+		counts[pickWeightedChannel(channels, "other-model").Id]++
+	}
+	require.InDelta(t, 0.5, float64(counts[1])/n, 0.03, "no multipliers keep the configured weights")
+}
@@ -104,3 +104,43 @@ func EnableChannel(channelId int, channelName string) {
 	)
 	notifyRootUser(subject, content)
 }
+
+// DisableChannelKey auto-disables one pooled key of a channel & notifies. When no
+// enabled key remains in the pool, the channel itself is disabled so routing
+// stops selecting it.
+func DisableChannelKey(channelId int, channelName string, keyId int, reason string) {
+	ctx := context.Background()
+	if err := model.UpdateChannelKeyStatus(ctx, keyId, model.ChannelKeyStatusAutoDisabled); err != nil {
+		logger.Logger.Error("failed to disable channel key", zap.Error(err))
+		return
+	}
+	ref := resolveChannelRef(channelId, channelName)
+	keyRef := ""
+	if key, err := model.GetChannelKeyById(ctx, keyId); err == nil {
+		keyRef = key.UUID
+	}
+	logger.Logger.Info("channel key has been disabled",
+		ref.AppendZap([]zap.Field{zap.String("channel_key_uuid", keyRef), zap.String("reason", reason)})...)
+
+	remaining, err := model.CountEnabledChannelKeys(ctx, channelId)
+	if err != nil {
+		logger.Logger.Error("failed to count enabled channel keys", zap.Error(err))
+		return
+	}
+	if remaining == 0 {
+		DisableChannel(channelId, channelName, "all keys in the pool are disabled; last failure: "+reason)
+		return
+	}
+
+	subject := "Channel Key Status Change Reminder"
+	content := message.EmailTemplate(
+		subject,
+		fmt.Sprintf(`
+            <p>Hello!</p>
+            <p>Key <strong>%s</strong> of <strong>%s</strong> has been disabled. %d key(s) remain enabled.</p>
+            <p>Reason for disabling:</p>
+            <p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">%s</p>
+        `, keyRef, ref.String(), remaining, reason),
+	)
+	notifyRootUser(subject, content)
+}
@@ -0,0 +1,311 @@
+package monitor
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/model"
+)
+
+// channelHealthIdleTimeout is how long a (channel, model) pair may go without
+// a relay outcome before its score is considered stale. Stale pairs neither
+// affect routing nor serve as the latency reference for their model.
+const channelHealthIdleTimeout = 30 * time.Minute
+
+// ChannelHealth is the rolling health of one (channel, model) pair, computed
+// from the most recent relay outcomes of this instance. It complements the
+// per-channel success queue of metric.go, which only decides auto-disabling,
+// with per-model latency for routing. ChannelHealthToResponses maps it to the
+// external DTO.
+type ChannelHealth struct {
+	ChannelId int
+	Model     string
+	// Samples is the number of outcomes in the rolling window.
+	Samples int
+	// SuccessRate is the share of successful outcomes in the window.
+	SuccessRate float64
+	P50Latency  time.Duration
+	P95Latency  time.Duration
+	// P95TTFT is the p95 time from sending the upstream request to the first
+	// byte streamed to the client; 0 when the pair has served no streams.
+	P95TTFT time.Duration
+	// Score in [0, 1] is the success rate scaled by how the pair's p95 latency
+	// and time to first byte compare with the fastest channel serving the model.
+	Score float64
+	// WeightMultiplier is the factor routing currently applies to the
+	// channel's configured weight for this model.
+	WeightMultiplier float64
+	LastSeen         time.Time
+}
+
+type channelHealthSample struct {
+	success bool
+	latency time.Duration
+	ttft    time.Duration
+}
+
+// channelHealthWindow is the ring buffer of one pair's recent outcomes, with
+// its statistics cached until the next outcome arrives.
+type channelHealthWindow struct {
+	samples  []channelHealthSample
+	next     int
+	lastSeen time.Time
+	dirty    bool
+	stats    channelHealthStats
+}
+
+type channelHealthStats struct {
+	samples     int
+	successRate float64
+	p50Latency  time.Duration
+	p95Latency  time.Duration
+	p95TTFT     time.Duration
+}
+
+// channelHealthReference is the fastest p95 latency and time to first byte
+// among the fresh, sufficiently sampled channels serving one model.
+type channelHealthReference struct {
+	p95Latency time.Duration
+	p95TTFT    time.Duration
+}
+
+func init() {
+	model.SetChannelWeightMultipliers(channelHealthMultipliers)
+}
+
+var (
+	channelHealthLock sync.Mutex
+	// channelHealth maps model name -> channel id -> rolling window.
+	channelHealth = map[string]map[int]*channelHealthWindow{}
+)
+
+// RecordChannelHealth adds one relay outcome of channelId serving modelName.
+// latency is the upstream response time of the attempt, or 0 when unknown;
+// ttft is the time to the first byte of a successful stream and 0 otherwise.
+// Latencies of failed attempts are ignored, since fast failures would otherwise
+// look healthy.
+func RecordChannelHealth(channelId int, modelName string, success bool, latency, ttft time.Duration) {
+	size := config.ChannelHealthWindow
+	if channelId <= 0 || modelName == "" || size <= 0 {
+		return
+	}
+	sample := channelHealthSample{success: success}
+	if success {
+		sample.latency, sample.ttft = latency, ttft
+	}
+
+	channelHealthLock.Lock()
+	defer channelHealthLock.Unlock()
+	byChannel := channelHealth[modelName]
+	if byChannel == nil {
+		byChannel = map[int]*channelHealthWindow{}
+		channelHealth[modelName] = byChannel
+	}
+	window := byChannel[channelId]
+	if window == nil {
+		window = &channelHealthWindow{}
+		byChannel[channelId] = window
+	}
+	window.add(sample, size)
+	window.lastSeen = time.Now()
+}
+
+// ResetChannelHealth forgets every recorded outcome of channelId, e.g. after
+// its credentials or endpoint changed. channelId 0 clears all channels.
+func ResetChannelHealth(channelId int) {
+	channelHealthLock.Lock()
+	defer channelHealthLock.Unlock()
+	for modelName, byChannel := range channelHealth {
+		if channelId == 0 {
+			delete(channelHealth, modelName)
+			continue
+		}
+		delete(byChannel, channelId)
+		if len(byChannel) == 0 {
+			delete(channelHealth, modelName)
+		}
+	}
+}
+
+// ListChannelHealth returns the health of every tracked (channel, model) pair,
+// optionally narrowed to one channel (channelId > 0) and one model (modelName
+// not empty), ordered by channel id then model.
+func ListChannelHealth(channelId int, modelName string) []ChannelHealth {
+	now := time.Now()
+	channelHealthLock.Lock()
+	defer channelHealthLock.Unlock()
+
+	result := []ChannelHealth{}
+	for name, byChannel := range channelHealth {
+		if modelName != "" && name != modelName {
+			continue
+		}
+		ref := channelHealthReferenceFor(byChannel, now)
+		for id, window := range byChannel {
+			if channelId > 0 && id != channelId {
+				continue
+			}
+			stats := window.statistics()
+			result = append(result, ChannelHealth{
+				ChannelId:        id,
+				Model:            name,
+				Samples:          stats.samples,
+				SuccessRate:      stats.successRate,
+				P50Latency:       stats.p50Latency,
+				P95Latency:       stats.p95Latency,
+				P95TTFT:          stats.p95TTFT,
+				Score:            stats.score(ref),
+				WeightMultiplier: window.multiplier(ref, now),
+				LastSeen:         window.lastSeen,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ChannelId != result[j].ChannelId {
+			return result[i].ChannelId < result[j].ChannelId
+		}
+		return result[i].Model < result[j].Model
+	})
+	return result
+}
+
+// channelHealthMultipliers returns the routing weight multiplier of each
+// channel serving modelName, or nil when health-aware routing is disabled or
+// none of the channels has a usable score. It is installed as the model
+// package's ChannelWeightMultipliers.
+func channelHealthMultipliers(modelName string, channels []*model.Channel) []float64 {
+	if config.ChannelHealthMaxAdjustment <= 0 || modelName == "" {
+		return nil
+	}
+	now := time.Now()
+	channelHealthLock.Lock()
+	defer channelHealthLock.Unlock()
+	byChannel := channelHealth[modelName]
+	if len(byChannel) == 0 {
+		return nil
+	}
+
+	ref := channelHealthReferenceFor(byChannel, now)
+	multipliers := make([]float64, len(channels))
+	adjusted := false
+	for i, ch := range channels {
+		multipliers[i] = 1
+		if window := byChannel[ch.Id]; window != nil {
+			multipliers[i] = window.multiplier(ref, now)
+			adjusted = adjusted || multipliers[i] < 1
+		}
+	}
+	if !adjusted {
+		return nil
+	}
+	return multipliers
+}
+
+// channelHealthReferenceFor finds the fastest fresh, sufficiently sampled
+// channel latencies of one model. Callers must hold channelHealthLock.
+func channelHealthReferenceFor(byChannel map[int]*channelHealthWindow, now time.Time) channelHealthReference {
+	var ref channelHealthReference
+	for _, window := range byChannel {
+		if !window.scored(now) {
+			continue
+		}
+		stats := window.statistics()
+		if stats.p95Latency > 0 && (ref.p95Latency == 0 || stats.p95Latency < ref.p95Latency) {
+			ref.p95Latency = stats.p95Latency
+		}
+		if stats.p95TTFT > 0 && (ref.p95TTFT == 0 || stats.p95TTFT < ref.p95TTFT) {
+			ref.p95TTFT = stats.p95TTFT
+		}
+	}
+	return ref
+}
+
+func (w *channelHealthWindow) add(sample channelHealthSample, size int) {
+	w.dirty = true
+	if len(w.samples) < size {
+		w.samples = append(w.samples, sample)
+		return
+	}
+	if len(w.samples) > size {
+		// The window was shrunk at runtime: keep the most recent samples.
+		w.samples = slices.Concat(w.samples[w.next:], w.samples[:w.next])
+		w.samples = w.samples[len(w.samples)-size:]
+		w.next = 0
+	}
+	w.samples[w.next%size] = sample
+	w.next = (w.next + 1) % size
+}
+
+// scored reports whether the window is fresh and large enough to steer routing.
+func (w *channelHealthWindow) scored(now time.Time) bool {
+	return len(w.samples) >= config.ChannelHealthMinSamples && now.Sub(w.lastSeen) <= channelHealthIdleTimeout
+}
+
+// multiplier is the factor applied to the channel's configured weight. It
+// never drops below 1 - ChannelHealthMaxAdjustment.
+func (w *channelHealthWindow) multiplier(ref channelHealthReference, now time.Time) float64 {
+	maxAdjustment := config.ChannelHealthMaxAdjustment
+	if maxAdjustment <= 0 || !w.scored(now) {
+		return 1
+	}
+	return max(w.statistics().score(ref), 1-min(maxAdjustment, 1))
+}
+
+func (w *channelHealthWindow) statistics() channelHealthStats {
+	if !w.dirty {
+		return w.stats
+	}
+	var successes int
+	var latencies, ttfts []time.Duration
+	for _, sample := range w.samples {
+		if !sample.success {
+			continue
+		}
+		successes++
+		if sample.latency > 0 {
+			latencies = append(latencies, sample.latency)
+		}
+		if sample.ttft > 0 {
+			ttfts = append(ttfts, sample.ttft)
+		}
+	}
+	w.stats = channelHealthStats{
+		samples:    len(w.samples),
+		p50Latency: healthPercentile(latencies, 0.50),
+		p95Latency: healthPercentile(latencies, 0.95),
+		p95TTFT:    healthPercentile(ttfts, 0.95),
+	}
+	if len(w.samples) > 0 {
+		w.stats.successRate = float64(successes) / float64(len(w.samples))
+	}
+	w.dirty = false
+	return w.stats
+}
+
+// score is the success rate scaled by the ratio of the reference latencies to
+// the pair's own; a pair as fast as the reference keeps its success rate.
+func (s channelHealthStats) score(ref channelHealthReference) float64 {
+	speed := 1.0
+	if s.p95Latency > 0 && ref.p95Latency > 0 {
+		speed = min(float64(ref.p95Latency)/float64(s.p95Latency), 1)
+	}
+	if s.p95TTFT > 0 && ref.p95TTFT > 0 {
+		speed = (speed + min(float64(ref.p95TTFT)/float64(s.p95TTFT), 1)) / 2
+	}
+	return s.successRate * speed
+}
+
+// healthPercentile returns the nearest-rank q-th percentile of values, sorting them
+// in place. It returns 0 for an empty slice.
+func healthPercentile(values []time.Duration, q float64) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	slices.Sort(values)
+	rank := int(math.Ceil(q*float64(len(values)))) - 1
+	return values[min(max(rank, 0), len(values)-1)]
+}
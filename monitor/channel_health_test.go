@@ -0,0 +1,93 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/model"
+)
+
+func setChannelHealthConfig(t *testing.T, window, minSamples int, maxAdjustment float64) {
+	t.Helper()
+	prevWindow, prevMin, prevMax := config.ChannelHealthWindow, config.ChannelHealthMinSamples, config.ChannelHealthMaxAdjustment
+	config.ChannelHealthWindow, config.ChannelHealthMinSamples, config.ChannelHealthMaxAdjustment = window, minSamples, maxAdjustment
+	ResetChannelHealth(0)
+	t.Cleanup(func() {
+		config.ChannelHealthWindow, config.ChannelHealthMinSamples, config.ChannelHealthMaxAdjustment = prevWindow, prevMin, prevMax
+		ResetChannelHealth(0)
+	})
+}
+
+func recordHealthOutcomes(channelId int, modelName string, successes, failures int, latency, ttft time.Duration) {
+	for range successes {
+		RecordChannelHealth(channelId, modelName, true, latency, ttft)
+	}
+	for range failures {
+		RecordChannelHealth(channelId, modelName, false, time.Millisecond, 0)
+	}
+}
+
+func TestChannelHealthScores(t *testing.T) {
+	setChannelHealthConfig(t, 10, 5, 0.5)
+
+	recordHealthOutcomes(1, "gpt-4o", 10, 0, time.Second, 200*time.Millisecond)
+	recordHealthOutcomes(2, "gpt-4o", 8, 2, 3*time.Second, 0)
+	recordHealthOutcomes(3, "gpt-4o", 2, 0, 10*time.Second, 0)
+	recordHealthOutcomes(1, "gpt-4o-mini", 5, 0, 500*time.Millisecond, 0)
+
+	health := ListChannelHealth(0, "gpt-4o")
+	require.Len(t, health, 3)
+
+	require.Equal(t, 1, health[0].ChannelId)
+	require.Equal(t, 10, health[0].Samples)
+	require.Equal(t, 1.0, health[0].SuccessRate)
+	require.Equal(t, time.Second, health[0].P95Latency)
+	require.Equal(t, 200*time.Millisecond, health[0].P95TTFT)
+	require.Equal(t, 1.0, health[0].Score)
+	require.Equal(t, 1.0, health[0].WeightMultiplier)
+
+	// 80% success at three times the reference latency.
+	require.InDelta(t, 0.8/3, health[1].Score, 1e-9)
+	require.Equal(t, 0.5, health[1].WeightMultiplier, "the multiplier is floored at 1 - max adjustment")
+
+	// Too few samples to steer routing yet.
+	require.Equal(t, 2, health[2].Samples)
+	require.Equal(t, 1.0, health[2].WeightMultiplier)
+
+	require.Len(t, ListChannelHealth(1, ""), 2)
+	require.Equal(t, "gpt-4o-mini", ListChannelHealth(1, "gpt-4o-mini")[0].Model)
+
+	// The window only keeps the latest outcomes.
+	recordHealthOutcomes(2, "gpt-4o", 0, 10, 0, 0)
+	health = ListChannelHealth(2, "gpt-4o")
+	require.Equal(t, 10, health[0].Samples)
+	require.Zero(t, health[0].SuccessRate)
+
+	ResetChannelHealth(2)
+	require.Empty(t, ListChannelHealth(2, ""))
+	require.Len(t, ListChannelHealth(0, ""), 3)
+}
+
+func TestChannelHealthMultipliers(t *testing.T) {
+	setChannelHealthConfig(t, 20, 10, 0.8)
+	channels := []*model.Channel{{Id: 1}, {Id: 2}, {Id: 3}}
+	recordHealthOutcomes(1, "claude-sonnet-4", 20, 0, time.Second, 0)
+	recordHealthOutcomes(2, "claude-sonnet-4", 20, 0, 4*time.Second, 0)
+
+	require.Equal(t, []float64{1, 0.25, 1}, channelHealthMultipliers("claude-sonnet-4", channels))
+	require.Nil(t, channelHealthMultipliers("other-model", channels))
+
+	// Successes without a known upstream latency still count, but do not set
+	// the latency reference.
+	recordHealthOutcomes(3, "claude-sonnet-4", 20, 0, 0, 0)
+	health := ListChannelHealth(3, "claude-sonnet-4")
+	require.Len(t, health, 1)
+	require.Zero(t, health[0].P95Latency)
+	require.Equal(t, 1.0, health[0].Score)
+
+	config.ChannelHealthMaxAdjustment = 0
+	require.Nil(t, channelHealthMultipliers("claude-sonnet-4", channels), "0 disables health-aware routing")
+}
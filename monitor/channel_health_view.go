@@ -0,0 +1,31 @@
+package monitor
+
+import (
+	"context"
+
+	"github.com/Laisky/one-api/dto"
+	"github.com/Laisky/one-api/model"
+)
+
+// ChannelHealthToResponses maps health scores to their external DTOs,
+// resolving each channel id to its UUID and name.
+func ChannelHealthToResponses(ctx context.Context, health []ChannelHealth) []dto.ChannelHealthResponse {
+	out := make([]dto.ChannelHealthResponse, 0, len(health))
+	for _, h := range health {
+		ref := model.LookupChannelRef(ctx, h.ChannelId)
+		out = append(out, dto.ChannelHealthResponse{
+			ChannelUUID:      ref.UUID,
+			ChannelName:      ref.Name,
+			Model:            h.Model,
+			Samples:          h.Samples,
+			SuccessRate:      h.SuccessRate,
+			P50LatencyMs:     h.P50Latency.Milliseconds(),
+			P95LatencyMs:     h.P95Latency.Milliseconds(),
+			P95TTFTMs:        h.P95TTFT.Milliseconds(),
+			Score:            h.Score,
+			WeightMultiplier: h.WeightMultiplier,
+			LastSeen:         h.LastSeen.Unix(),
+		})
+	}
+	return out
+}
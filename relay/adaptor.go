@@ -20,6 +20,7 @@ import (
 	"github.com/Laisky/one-api/relay/adaptor/gemini"
 	"github.com/Laisky/one-api/relay/adaptor/groq"
 	"github.com/Laisky/one-api/relay/adaptor/mistral"
+	"github.com/Laisky/one-api/relay/adaptor/mock"
 	"github.com/Laisky/one-api/relay/adaptor/moonshot"
 	"github.com/Laisky/one-api/relay/adaptor/nvidia"
 	"github.com/Laisky/one-api/relay/adaptor/ollama"
@@ -101,6 +102,8 @@ func GetAdaptor(apiType int) adaptor.Adaptor {
 		return &cerebras.Adaptor{}
 	case apitype.Azure:
 		return &azure.Adaptor{}
+	case apitype.Mock:
+		return &mock.Adaptor{}
 	}
 
 	return nil
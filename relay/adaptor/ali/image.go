@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/Laisky/errors/v2"
@@ -15,12 +14,12 @@ import (
 	"github.com/Laisky/one-api/common/client"
 	"github.com/Laisky/one-api/common/helper"
 	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/meta"
 	"github.com/Laisky/one-api/relay/model"
 )
 
-func ImageHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
-	apiKey := c.Request.Header.Get("Authorization")
-	apiKey = strings.TrimPrefix(apiKey, "Bearer ")
+func ImageHandler(c *gin.Context, resp *http.Response, relayMeta *meta.Meta) (*model.ErrorWithStatusCode, *model.Usage) {
+	apiKey := relayMeta.APIKey
 	responseFormat := c.GetString("response_format")
 
 	var aliTaskResponse TaskResponse
@@ -277,9 +277,13 @@ func GetModelCapabilities(modelName string) ProviderCapabilities {
 		adaptorType = AwsClaude
 	}
 
-	// If model is not in registry, return minimal capabilities
+	// Models outside the registry go through the Converse adaptor
 	if adaptorType == 0 {
 		return ProviderCapabilities{
+			SupportsTools:           true, // Converse maps function tools and tool_choice
+			SupportsResponseFormat:  false,
+			SupportsThinking:        true, // forwarded as additional model request fields
+			SupportsStop:            true,
 			SupportsImageGeneration: false,
 			SupportsEmbedding:       false,
 		}
@@ -3,6 +3,7 @@ package aws
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -21,7 +22,6 @@ import (
 	"github.com/Laisky/one-api/common/ctxkey"
 	"github.com/Laisky/one-api/common/helper"
 	"github.com/Laisky/one-api/common/tracing"
-	"github.com/Laisky/one-api/model"
 	"github.com/Laisky/one-api/relay/adaptor/anthropic"
 	"github.com/Laisky/one-api/relay/adaptor/aws/utils"
 	"github.com/Laisky/one-api/relay/adaptor/openai"
@@ -76,31 +76,53 @@ func AwsModelID(requestModel string) (string, error) {
 }
 
 func AwsClaudeModelTransArn(c *gin.Context, awsCli *bedrockruntime.Client) string {
-	reqModelID := c.GetString(ctxkey.RequestModel)
-
-	// First, try to get ARN from channel's inference profile ARN mapping
-	if channelModel, ok := c.Get(ctxkey.ChannelModel); ok {
-		if channel, ok := channelModel.(*model.Channel); ok {
-			arnMap := channel.GetInferenceProfileArnMapWithContext(gmw.Ctx(c))
-			if arnMap != nil {
-				if arn, exists := arnMap[reqModelID]; exists && arn != "" {
-					gmw.GetLogger(c).Debug("using channel inference profile ARN",
-						zap.String("request_model", reqModelID),
-						zap.String("arn", arn),
-					)
-					return arn
-				}
-			}
-		}
-	}
-
-	// No ARN mapping found in channel configuration
-	return ""
+	return utils.InferenceProfileArn(c, c.GetString(ctxkey.RequestModel))
 }
 
 // Deprecated: FastClaudeModelTransArn is no longer used
 // ARN mapping is now handled through channel configuration
 
+// CountTokens counts the input tokens of an Anthropic Messages payload with the
+// Bedrock CountTokens API. The payload is rewritten into the InvokeModel body
+// shape: the model field is dropped, and anthropic_version and max_tokens are
+// filled in when absent.
+func CountTokens(ctx context.Context, awsCli *bedrockruntime.Client, modelName string, body []byte) (int, error) {
+	if awsCli == nil {
+		return 0, errors.New("aws client is not initialized")
+	}
+	awsModelID, err := AwsModelID(modelName)
+	if err != nil {
+		return 0, errors.Wrap(err, "AwsModelID")
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0, errors.Wrap(err, "unmarshal count tokens request")
+	}
+	delete(payload, "model")
+	if _, ok := payload["anthropic_version"]; !ok {
+		payload["anthropic_version"] = "bedrock-2023-05-31"
+	}
+	if _, ok := payload["max_tokens"]; !ok {
+		payload["max_tokens"] = config.DefaultMaxToken
+	}
+	invokeBody, err := json.Marshal(payload)
+	if err != nil {
+		return 0, errors.Wrap(err, "marshal count tokens request")
+	}
+
+	out, err := awsCli.CountTokens(ctx, &bedrockruntime.CountTokensInput{
+		ModelId: aws.String(awsModelID),
+		Input: &types.CountTokensInputMemberInvokeModel{
+			Value: types.InvokeModelTokensRequest{Body: invokeBody},
+		},
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "CountTokens")
+	}
+	return int(aws.ToInt32(out.InputTokens)), nil
+}
+
 // buildClaudeUsage converts an unmarshaled Bedrock Claude response into the
 // billing usage snapshot. Bedrock's input_tokens EXCLUDES the cache-read and
 // cache-creation buckets, so those are mapped into dedicated fields instead of
@@ -0,0 +1,58 @@
+package aws
+
+import (
+	"github.com/Laisky/errors/v2"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/relay/adaptor/aws/utils"
+	"github.com/Laisky/one-api/relay/meta"
+	"github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+var _ utils.AwsAdapter = new(Adaptor)
+
+// Adaptor implements the AWS Bedrock adapter on top of the model-agnostic
+// Converse and ConverseStream APIs.
+//
+// It serves every Bedrock model that has no dedicated subpackage: the request
+// model name is sent as the Bedrock model ID, or replaced by the inference
+// profile ARN configured for it on the channel.
+type Adaptor struct {
+}
+
+// ConvertRequest converts an OpenAI-compatible chat request into a Converse
+// request and stores it in the context for DoResponse.
+//
+// Embeddings are rejected because the Converse API only generates text.
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if relayMode == relaymode.Embeddings {
+		return nil, errors.New("the Bedrock Converse API does not support embeddings")
+	}
+
+	converseReq, err := ConvertRequest(*request)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert request to Converse")
+	}
+
+	c.Set(ctxkey.RequestModel, request.Model)
+	c.Set(ctxkey.ConvertedRequest, converseReq)
+	c.Set(ctxkey.RelayMode, relayMode)
+	return converseReq, nil
+}
+
+// DoResponse sends the converted request through Converse or ConverseStream
+// and writes the OpenAI-compatible response.
+func (a *Adaptor) DoResponse(c *gin.Context, awsCli *bedrockruntime.Client, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.IsStream {
+		err, usage = StreamHandler(c, awsCli)
+	} else {
+		err, usage = Handler(c, awsCli, meta.ActualModelName)
+	}
+	return
+}
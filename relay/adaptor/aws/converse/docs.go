@@ -0,0 +1,32 @@
+// Package aws provides the generic AWS Bedrock adapter built on the Converse API.
+//
+// The parent registry uses this adapter for every model without a dedicated
+// subpackage, so a newly released Bedrock model works as soon as its model ID
+// is listed on an AWS channel. Because the Converse API is model-agnostic, one
+// conversion covers the whole catalogue:
+//
+//   - System and developer messages become system content blocks
+//   - Text, image_url and file parts become text, image and document blocks
+//   - Assistant tool_calls and tool messages become toolUse and toolResult
+//     blocks, with consecutive turns of one role merged as Converse requires
+//   - An Anthropic-style cache_control marker on a content part adds a
+//     cachePoint block after it
+//   - Function tools and tool_choice become the tool configuration
+//   - Claude-style thinking is forwarded in additionalModelRequestFields
+//
+// Responses, streamed or not, are converted back to OpenAI chat completions
+// with text, reasoning content and tool calls. Usage includes prompt cache
+// reads and writes.
+//
+// # Model ID Resolution
+//
+// The request model name is the Bedrock model ID, unless the channel's
+// InferenceProfileArnMap assigns it an inference profile ARN. Plain model IDs
+// are promoted to a cross-region inference profile when the channel region
+// has one.
+//
+// # References
+//
+//   - https://docs.aws.amazon.com/bedrock/latest/userguide/conversation-inference.html
+//   - https://docs.aws.amazon.com/bedrock/latest/userguide/prompt-caching.html
+package aws
@@ -0,0 +1,710 @@
+package aws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/image"
+	"github.com/Laisky/one-api/common/tracing"
+	"github.com/Laisky/one-api/relay/adaptor/aws/internal/streamfinalizer"
+	"github.com/Laisky/one-api/relay/adaptor/aws/utils"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+// documentNameDisallowed matches the characters Bedrock rejects in document
+// names; only letters, digits, single spaces, hyphens, parentheses and square
+// brackets are allowed.
+var documentNameDisallowed = regexp.MustCompile(`[^A-Za-z0-9\-()\[\] ]+`)
+
+// documentFormats maps file extensions and MIME types to Bedrock document formats.
+var documentFormats = map[string]types.DocumentFormat{
+	"pdf":  types.DocumentFormatPdf,
+	"csv":  types.DocumentFormatCsv,
+	"doc":  types.DocumentFormatDoc,
+	"docx": types.DocumentFormatDocx,
+	"xls":  types.DocumentFormatXls,
+	"xlsx": types.DocumentFormatXlsx,
+	"html": types.DocumentFormatHtml,
+	"htm":  types.DocumentFormatHtml,
+	"txt":  types.DocumentFormatTxt,
+	"md":   types.DocumentFormatMd,
+
+	"application/pdf":    types.DocumentFormatPdf,
+	"text/csv":           types.DocumentFormatCsv,
+	"application/msword": types.DocumentFormatDoc,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": types.DocumentFormatDocx,
+	"application/vnd.ms-excel": types.DocumentFormatXls,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": types.DocumentFormatXlsx,
+	"text/html":     types.DocumentFormatHtml,
+	"text/plain":    types.DocumentFormatTxt,
+	"text/markdown": types.DocumentFormatMd,
+}
+
+// contentPart is one part of an OpenAI message content, flagged when the
+// client marked it with an Anthropic-style cache_control breakpoint.
+type contentPart struct {
+	relaymodel.MessageContent
+	cachePoint bool
+}
+
+// ConvertRequest converts an OpenAI-compatible chat request into a Converse request.
+//
+// System and developer messages become system blocks, tool results become user
+// turns and consecutive turns of the same role are merged, as Converse requires
+// strictly alternating roles. Images and documents are sent inline, and a
+// cache_control marker on a content part adds a cache point after it.
+func ConvertRequest(request relaymodel.GeneralOpenAIRequest) (*Request, error) {
+	converseReq := &Request{
+		InferenceConfig: inferenceConfig(request),
+		ToolConfig:      toolConfig(request.Tools, request.ToolChoice),
+	}
+
+	for _, message := range request.Messages {
+		switch message.Role {
+		case "system", "developer":
+			for _, part := range messageParts(message.Content) {
+				if part.Type == relaymodel.ContentTypeText && part.Text != nil && *part.Text != "" {
+					converseReq.System = append(converseReq.System, &types.SystemContentBlockMemberText{Value: *part.Text})
+				}
+				if part.cachePoint {
+					converseReq.System = append(converseReq.System, &types.SystemContentBlockMemberCachePoint{
+						Value: types.CachePointBlock{Type: types.CachePointTypeDefault},
+					})
+				}
+			}
+		case "tool":
+			converseReq.Messages = appendTurn(converseReq.Messages, types.ConversationRoleUser, []types.ContentBlock{
+				&types.ContentBlockMemberToolResult{Value: types.ToolResultBlock{
+					ToolUseId: aws.String(message.ToolCallId),
+					Content:   []types.ToolResultContentBlock{&types.ToolResultContentBlockMemberText{Value: message.StringContent()}},
+					Status:    types.ToolResultStatusSuccess,
+				}},
+			})
+		case "assistant":
+			blocks, err := assistantBlocks(message)
+			if err != nil {
+				return nil, err
+			}
+			converseReq.Messages = appendTurn(converseReq.Messages, types.ConversationRoleAssistant, blocks)
+		default:
+			blocks, err := contentBlocks(messageParts(message.Content))
+			if err != nil {
+				return nil, err
+			}
+			converseReq.Messages = appendTurn(converseReq.Messages, types.ConversationRoleUser, blocks)
+		}
+	}
+
+	if request.Thinking != nil {
+		converseReq.AdditionalModelRequestFields = document.NewLazyDocument(map[string]any{
+			"thinking": request.Thinking,
+		})
+	}
+
+	return converseReq, nil
+}
+
+// appendTurn appends blocks as a turn of role, merging them into the previous
+// turn when it has the same role. Empty turns are dropped.
+func appendTurn(messages []types.Message, role types.ConversationRole, blocks []types.ContentBlock) []types.Message {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, types.Message{Role: role, Content: blocks})
+}
+
+// messageParts splits a message content into parts, keeping the cache_control
+// markers that relaymodel.Message.ParseContent drops.
+func messageParts(content any) []contentPart {
+	items, ok := content.([]any)
+	if !ok {
+		var parts []contentPart
+		for _, part := range (relaymodel.Message{Content: content}).ParseContent() {
+			parts = append(parts, contentPart{MessageContent: part})
+		}
+		return parts
+	}
+
+	var parts []contentPart
+	for _, item := range items {
+		itemMap, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		// OpenAI nests file parts as {"type":"file","file":{...}}; flatten them
+		// into the shape ParseContent understands.
+		if file, ok := itemMap["file"].(map[string]any); ok && itemMap["type"] == relaymodel.ContentTypeFile {
+			flat := map[string]any{"type": relaymodel.ContentTypeFile}
+			for key, value := range file {
+				flat[key] = value
+			}
+			item = flat
+		}
+		parsed := (relaymodel.Message{Content: []any{item}}).ParseContent()
+		for _, part := range parsed {
+			parts = append(parts, contentPart{MessageContent: part})
+		}
+		if itemMap["cache_control"] != nil && len(parsed) > 0 {
+			parts[len(parts)-1].cachePoint = true
+		}
+	}
+	return parts
+}
+
+// contentBlocks converts user content parts to Converse content blocks.
+func contentBlocks(parts []contentPart) ([]types.ContentBlock, error) {
+	var blocks []types.ContentBlock
+	for _, part := range parts {
+		switch part.Type {
+		case relaymodel.ContentTypeText:
+			if part.Text != nil && *part.Text != "" {
+				blocks = append(blocks, &types.ContentBlockMemberText{Value: *part.Text})
+			}
+		case relaymodel.ContentTypeImageURL:
+			if part.ImageURL == nil {
+				continue
+			}
+			block, err := imageBlock(part.ImageURL.Url)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, block)
+		case relaymodel.ContentTypeFile:
+			block, err := documentBlock(part.FileData, part.Filename)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, block)
+		}
+		if part.cachePoint && len(blocks) > 0 {
+			blocks = append(blocks, &types.ContentBlockMemberCachePoint{
+				Value: types.CachePointBlock{Type: types.CachePointTypeDefault},
+			})
+		}
+	}
+	return blocks, nil
+}
+
+// assistantBlocks converts an assistant history message. Reasoning is only
+// replayed when it carries a signature, since Bedrock rejects unsigned
+// reasoning blocks.
+func assistantBlocks(message relaymodel.Message) ([]types.ContentBlock, error) {
+	var blocks []types.ContentBlock
+	if message.Signature != nil && *message.Signature != "" {
+		var reasoning string
+		for _, text := range []*string{message.Thinking, message.ReasoningContent, message.Reasoning} {
+			if text != nil && *text != "" {
+				reasoning = *text
+				break
+			}
+		}
+		if reasoning != "" {
+			blocks = append(blocks, &types.ContentBlockMemberReasoningContent{
+				Value: &types.ReasoningContentBlockMemberReasoningText{Value: types.ReasoningTextBlock{
+					Text:      aws.String(reasoning),
+					Signature: message.Signature,
+				}},
+			})
+		}
+	}
+
+	textBlocks, err := contentBlocks(messageParts(message.Content))
+	if err != nil {
+		return nil, err
+	}
+	blocks = append(blocks, textBlocks...)
+
+	for _, toolCall := range message.ToolCalls {
+		if toolCall.Function == nil {
+			continue
+		}
+		input, err := toolCallInput(toolCall.Function.Arguments)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse arguments of tool call %s", toolCall.Id)
+		}
+		blocks = append(blocks, &types.ContentBlockMemberToolUse{Value: types.ToolUseBlock{
+			ToolUseId: aws.String(toolCall.Id),
+			Name:      aws.String(toolCall.Function.Name),
+			Input:     document.NewLazyDocument(input),
+		}})
+	}
+	return blocks, nil
+}
+
+// toolCallInput decodes OpenAI tool call arguments, which arrive as a JSON
+// string or an already decoded value, into a Converse tool input.
+func toolCallInput(arguments any) (any, error) {
+	switch value := arguments.(type) {
+	case nil:
+		return map[string]any{}, nil
+	case string:
+		if strings.TrimSpace(value) == "" {
+			return map[string]any{}, nil
+		}
+		var input any
+		if err := json.Unmarshal([]byte(value), &input); err != nil {
+			return nil, errors.Wrap(err, "unmarshal tool call arguments")
+		}
+		return input, nil
+	default:
+		return value, nil
+	}
+}
+
+// imageBlock loads an image_url part, either a data URL or a remote image.
+func imageBlock(url string) (types.ContentBlock, error) {
+	mimeType, data, err := image.GetImageFromUrl(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "get image")
+	}
+	imageBytes, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode image")
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0])), "image/")
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	switch types.ImageFormat(format) {
+	case types.ImageFormatPng, types.ImageFormatJpeg, types.ImageFormatGif, types.ImageFormatWebp:
+	default:
+		return nil, errors.Errorf("unsupported image type %q", mimeType)
+	}
+
+	return &types.ContentBlockMemberImage{Value: types.ImageBlock{
+		Format: types.ImageFormat(format),
+		Source: &types.ImageSourceMemberBytes{Value: imageBytes},
+	}}, nil
+}
+
+// documentBlock converts a file part carrying a base64 data URL into a
+// document block. The format comes from the file extension, falling back to
+// the data URL's MIME type.
+func documentBlock(fileData, filename string) (types.ContentBlock, error) {
+	header, data, found := strings.Cut(fileData, ",")
+	if !found || !strings.HasPrefix(header, "data:") {
+		return nil, errors.New("file parts must carry file_data as a base64 data URL")
+	}
+	fileBytes, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode file data")
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))
+	mimeType := strings.ToLower(strings.Split(strings.TrimPrefix(header, "data:"), ";")[0])
+	format, ok := documentFormats[ext]
+	if !ok {
+		if format, ok = documentFormats[mimeType]; !ok {
+			return nil, errors.Errorf("unsupported document type %q", mimeType)
+		}
+	}
+
+	return &types.ContentBlockMemberDocument{Value: types.DocumentBlock{
+		Format: format,
+		Name:   aws.String(documentName(filename)),
+		Source: &types.DocumentSourceMemberBytes{Value: fileBytes},
+	}}, nil
+}
+
+// documentName turns a filename into a name Bedrock accepts.
+func documentName(filename string) string {
+	name := strings.TrimSuffix(path.Base(filename), path.Ext(filename))
+	name = documentNameDisallowed.ReplaceAllString(name, " ")
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || name == "." {
+		return "document"
+	}
+	return name
+}
+
+// inferenceConfig maps max tokens, temperature, top_p and stop sequences.
+func inferenceConfig(request relaymodel.GeneralOpenAIRequest) *types.InferenceConfiguration {
+	maxTokens := request.MaxTokens
+	if maxTokens == 0 && request.MaxCompletionTokens != nil {
+		maxTokens = *request.MaxCompletionTokens
+	}
+	if maxTokens == 0 {
+		maxTokens = config.DefaultMaxToken
+	}
+
+	inference := &types.InferenceConfiguration{
+		MaxTokens: aws.Int32(int32(maxTokens)),
+	}
+	if request.Temperature != nil {
+		inference.Temperature = aws.Float32(float32(*request.Temperature))
+	}
+	if request.TopP != nil {
+		inference.TopP = aws.Float32(float32(*request.TopP))
+	}
+	switch stop := request.Stop.(type) {
+	case string:
+		inference.StopSequences = []string{stop}
+	case []string:
+		inference.StopSequences = stop
+	case []any:
+		for _, item := range stop {
+			if s, ok := item.(string); ok {
+				inference.StopSequences = append(inference.StopSequences, s)
+			}
+		}
+	}
+	return inference
+}
+
+// toolConfig converts function tools and tool_choice. Converse has no "none"
+// choice, so tool_choice "none" sends no tools at all.
+func toolConfig(tools []relaymodel.Tool, toolChoice any) *types.ToolConfiguration {
+	if toolChoice == "none" {
+		return nil
+	}
+
+	var converseTools []types.Tool
+	for _, tool := range tools {
+		if tool.Function == nil || (tool.Type != "" && tool.Type != "function") {
+			continue
+		}
+		parameters := tool.Function.Parameters
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		spec := types.ToolSpecification{
+			Name:        aws.String(tool.Function.Name),
+			InputSchema: &types.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(parameters)},
+		}
+		if tool.Function.Description != "" {
+			spec.Description = aws.String(tool.Function.Description)
+		}
+		converseTools = append(converseTools, &types.ToolMemberToolSpec{Value: spec})
+	}
+	if len(converseTools) == 0 {
+		return nil
+	}
+
+	toolConfig := &types.ToolConfiguration{Tools: converseTools}
+	switch choice := toolChoice.(type) {
+	case string:
+		switch choice {
+		case "required", "any":
+			toolConfig.ToolChoice = &types.ToolChoiceMemberAny{}
+		case "auto":
+			toolConfig.ToolChoice = &types.ToolChoiceMemberAuto{}
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				toolConfig.ToolChoice = &types.ToolChoiceMemberTool{Value: types.SpecificToolChoice{Name: aws.String(name)}}
+			}
+		}
+	}
+	return toolConfig
+}
+
+// modelID resolves the Bedrock model ID of the request. An inference profile
+// ARN configured on the channel wins; otherwise the request model is used as
+// the model ID, promoted to a cross-region profile where one exists.
+func modelID(c *gin.Context, awsCli *bedrockruntime.Client) string {
+	requestModel := c.GetString(ctxkey.RequestModel)
+	if arn := utils.InferenceProfileArn(c, requestModel); arn != "" {
+		return arn
+	}
+	return utils.ConvertModelID2CrossRegionProfile(gmw.Ctx(c), requestModel, awsCli.Options().Region)
+}
+
+// convertedRequest returns the Converse request stored by ConvertRequest.
+func convertedRequest(c *gin.Context) (*Request, error) {
+	converseReq, ok := c.Get(ctxkey.ConvertedRequest)
+	if !ok {
+		return nil, errors.New("request not found")
+	}
+	req, ok := converseReq.(*Request)
+	if !ok {
+		return nil, errors.Errorf("unexpected converted request type %T", converseReq)
+	}
+	return req, nil
+}
+
+// Handler calls the Converse API and writes an OpenAI-compatible chat completion.
+func Handler(c *gin.Context, awsCli *bedrockruntime.Client, modelName string) (*relaymodel.ErrorWithStatusCode, *relaymodel.Usage) {
+	req, err := convertedRequest(c)
+	if err != nil {
+		return utils.WrapErr(err), nil
+	}
+
+	awsResp, err := awsCli.Converse(gmw.Ctx(c), &bedrockruntime.ConverseInput{
+		ModelId:                      aws.String(modelID(c, awsCli)),
+		Messages:                     req.Messages,
+		System:                       req.System,
+		InferenceConfig:              req.InferenceConfig,
+		ToolConfig:                   req.ToolConfig,
+		AdditionalModelRequestFields: req.AdditionalModelRequestFields,
+	})
+	if err != nil {
+		return utils.WrapErr(errors.Wrap(err, "Converse")), nil
+	}
+
+	response := convertResponse(c, awsResp, modelName)
+	c.JSON(http.StatusOK, response)
+	return nil, &response.Usage
+}
+
+// convertResponse converts a Converse output into an OpenAI chat completion.
+func convertResponse(c *gin.Context, awsResp *bedrockruntime.ConverseOutput, modelName string) *openai.TextResponse {
+	message := relaymodel.Message{Role: "assistant"}
+	var content, reasoning strings.Builder
+	if output, ok := awsResp.Output.(*types.ConverseOutputMemberMessage); ok {
+		for _, block := range output.Value.Content {
+			switch value := block.(type) {
+			case *types.ContentBlockMemberText:
+				content.WriteString(value.Value)
+			case *types.ContentBlockMemberReasoningContent:
+				if text, ok := value.Value.(*types.ReasoningContentBlockMemberReasoningText); ok {
+					reasoning.WriteString(aws.ToString(text.Value.Text))
+					if text.Value.Signature != nil {
+						message.Signature = text.Value.Signature
+					}
+				}
+			case *types.ContentBlockMemberToolUse:
+				arguments := "{}"
+				if value.Value.Input != nil {
+					if raw, err := value.Value.Input.MarshalSmithyDocument(); err == nil {
+						arguments = string(raw)
+					}
+				}
+				message.ToolCalls = append(message.ToolCalls, relaymodel.Tool{
+					Id:   aws.ToString(value.Value.ToolUseId),
+					Type: "function",
+					Function: &relaymodel.Function{
+						Name:      aws.ToString(value.Value.Name),
+						Arguments: arguments,
+					},
+				})
+			}
+		}
+	}
+	message.Content = content.String()
+	if reasoning.Len() > 0 {
+		message.SetReasoningContent(c.Query("reasoning_format"), reasoning.String())
+	}
+
+	finishReason := "stop"
+	if reason := convertStopReason(awsResp.StopReason); reason != nil {
+		finishReason = *reason
+	}
+
+	return &openai.TextResponse{
+		Id:      tracing.GenerateChatCompletionID(c),
+		Model:   modelName,
+		Object:  "chat.completion",
+		Created: helper.GetTimestamp(),
+		Choices: []openai.TextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: finishReason,
+		}},
+		Usage: convertUsage(awsResp.Usage),
+	}
+}
+
+// convertUsage maps Converse token usage, including prompt cache reads and
+// writes. Like the Claude adaptor, input tokens exclude cached tokens.
+func convertUsage(tokenUsage *types.TokenUsage) relaymodel.Usage {
+	var usage relaymodel.Usage
+	if tokenUsage == nil {
+		return usage
+	}
+	usage.PromptTokens = int(aws.ToInt32(tokenUsage.InputTokens))
+	usage.CompletionTokens = int(aws.ToInt32(tokenUsage.OutputTokens))
+	usage.TotalTokens = int(aws.ToInt32(tokenUsage.TotalTokens))
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if cacheRead := int(aws.ToInt32(tokenUsage.CacheReadInputTokens)); cacheRead > 0 {
+		usage.PromptTokensDetails = &relaymodel.UsagePromptTokensDetails{CachedTokens: cacheRead}
+	}
+	usage.CacheWrite5mTokens = int(aws.ToInt32(tokenUsage.CacheWriteInputTokens))
+	return usage
+}
+
+// convertStopReason maps a Converse stop reason to an OpenAI finish reason.
+func convertStopReason(reason types.StopReason) *string {
+	if reason == "" {
+		return nil
+	}
+	finishReason := string(reason)
+	switch reason {
+	case types.StopReasonEndTurn, types.StopReasonStopSequence:
+		finishReason = "stop"
+	case types.StopReasonToolUse:
+		finishReason = "tool_calls"
+	case types.StopReasonMaxTokens, types.StopReasonModelContextWindowExceeded:
+		finishReason = "length"
+	case types.StopReasonContentFiltered, types.StopReasonGuardrailIntervened:
+		finishReason = "content_filter"
+	}
+	return &finishReason
+}
+
+// StreamHandler calls the ConverseStream API and relays its events as
+// OpenAI-compatible chat completion chunks.
+//
+// Tool calls are numbered in the order they start, independent of the
+// Converse content block index, so clients see indexes 0, 1, ...
+func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.ErrorWithStatusCode, *relaymodel.Usage) {
+	lg := gmw.GetLogger(c)
+	createdTime := helper.GetTimestamp()
+	req, err := convertedRequest(c)
+	if err != nil {
+		return utils.WrapErr(err), nil
+	}
+
+	awsResp, err := awsCli.ConverseStream(gmw.Ctx(c), &bedrockruntime.ConverseStreamInput{
+		ModelId:                      aws.String(modelID(c, awsCli)),
+		Messages:                     req.Messages,
+		System:                       req.System,
+		InferenceConfig:              req.InferenceConfig,
+		ToolConfig:                   req.ToolConfig,
+		AdditionalModelRequestFields: req.AdditionalModelRequestFields,
+	})
+	if err != nil {
+		return utils.WrapErr(errors.Wrap(err, "ConverseStream")), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	common.SetEventStreamHeaders(c)
+
+	var usage relaymodel.Usage
+	id := tracing.GenerateChatCompletionID(c)
+	modelName := c.GetString(ctxkey.RequestModel)
+	toolIndexes := make(map[int32]int)
+	finalizer := streamfinalizer.NewFinalizer(modelName, createdTime, &usage, lg, func(payload []byte) bool {
+		// Decode the final chunk so it goes through the Response API rewrite
+		// bridge like every other chunk.
+		var chunk openai.ChatCompletionsStreamResponse
+		if err := json.Unmarshal(payload, &chunk); err != nil {
+			lg.Error("error unmarshalling final stream response", zap.Error(err))
+			return false
+		}
+		if err := openai_compatible.RenderStreamChunkWithBridge(c, &chunk); err != nil {
+			lg.Error("error rendering final stream response", zap.Error(err))
+			return false
+		}
+		return true
+	})
+	finalizer.SetID(id)
+
+	render := func(delta relaymodel.Message) bool {
+		delta.Role = "assistant"
+		chunk := &openai.ChatCompletionsStreamResponse{
+			Id:      id,
+			Object:  "chat.completion.chunk",
+			Created: createdTime,
+			Model:   modelName,
+			Choices: []openai.ChatCompletionsStreamResponseChoice{{Index: 0, Delta: delta}},
+		}
+		if err := openai_compatible.RenderStreamChunkWithBridge(c, chunk); err != nil {
+			lg.Error("error rendering stream response", zap.Error(err))
+		}
+		return true
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		event, ok := <-stream.Events()
+		if !ok {
+			if !finalizer.FinalizeOnClose() {
+				return false
+			}
+			openai_compatible.FinalizeStreamWithBridge(c, &usage)
+			return false
+		}
+
+		switch v := event.(type) {
+		case *types.ConverseStreamOutputMemberContentBlockStart:
+			toolUse, ok := v.Value.Start.(*types.ContentBlockStartMemberToolUse)
+			if !ok || v.Value.ContentBlockIndex == nil {
+				return true
+			}
+			index := len(toolIndexes)
+			toolIndexes[*v.Value.ContentBlockIndex] = index
+			return render(relaymodel.Message{ToolCalls: []relaymodel.Tool{{
+				Id:       aws.ToString(toolUse.Value.ToolUseId),
+				Type:     "function",
+				Function: &relaymodel.Function{Name: aws.ToString(toolUse.Value.Name)},
+				Index:    &index,
+			}}})
+
+		case *types.ConverseStreamOutputMemberContentBlockDelta:
+			switch delta := v.Value.Delta.(type) {
+			case *types.ContentBlockDeltaMemberText:
+				if delta.Value != "" {
+					return render(relaymodel.Message{Content: delta.Value})
+				}
+			case *types.ContentBlockDeltaMemberReasoningContent:
+				switch reasoning := delta.Value.(type) {
+				case *types.ReasoningContentBlockDeltaMemberText:
+					if reasoning.Value != "" {
+						var message relaymodel.Message
+						message.SetReasoningContent(c.Query("reasoning_format"), reasoning.Value)
+						return render(message)
+					}
+				case *types.ReasoningContentBlockDeltaMemberSignature:
+					// Clients must send the signature back with the reasoning
+					// on the next turn, as with the non-stream response.
+					if reasoning.Value != "" {
+						signature := reasoning.Value
+						return render(relaymodel.Message{Signature: &signature})
+					}
+				}
+			case *types.ContentBlockDeltaMemberToolUse:
+				if v.Value.ContentBlockIndex == nil || delta.Value.Input == nil {
+					return true
+				}
+				index, ok := toolIndexes[*v.Value.ContentBlockIndex]
+				if !ok {
+					return true
+				}
+				return render(relaymodel.Message{ToolCalls: []relaymodel.Tool{{
+					Function: &relaymodel.Function{Arguments: *delta.Value.Input},
+					Index:    &index,
+				}}})
+			}
+			return true
+
+		case *types.ConverseStreamOutputMemberMessageStop:
+			return finalizer.RecordStop(convertStopReason(v.Value.StopReason))
+
+		case *types.ConverseStreamOutputMemberMetadata:
+			return finalizer.RecordMetadata(v.Value.Usage)
+
+		default:
+			return true
+		}
+	})
+
+	return nil, &usage
+}
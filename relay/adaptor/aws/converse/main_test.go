@@ -0,0 +1,220 @@
+package aws
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+// pngDataURL is a 1x1 transparent PNG.
+const pngDataURL = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="
+
+// newTestClient returns a Bedrock runtime client that talks to a local
+// stand-in for the runtime endpoint.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *bedrockruntime.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return bedrockruntime.New(bedrockruntime.Options{
+		Region:       "eu-north-9",
+		BaseEndpoint: aws.String(srv.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("ak", "sk", ""),
+	})
+}
+
+// streamRecorder adds the CloseNotify method gin.Context.Stream requires.
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (streamRecorder) CloseNotify() <-chan bool { return make(chan bool) }
+
+func newTestContext(t *testing.T) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(streamRecorder{w})
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c, w
+}
+
+func TestConvertRequestMapsContentToolsAndCachePoints(t *testing.T) {
+	t.Parallel()
+	var request relaymodel.GeneralOpenAIRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "amazon.nova-pro-v1:0",
+		"max_completion_tokens": 256,
+		"stop": ["END"],
+		"thinking": {"type": "enabled", "budget_tokens": 2048},
+		"messages": [
+			{"role": "system", "content": [{"type": "text", "text": "long policy", "cache_control": {"type": "ephemeral"}}]},
+			{"role": "user", "content": [
+				{"type": "text", "text": "describe"},
+				{"type": "image_url", "image_url": {"url": "`+pngDataURL+`"}},
+				{"type": "file", "file": {"filename": "q3 report.v2.pdf", "file_data": "data:application/pdf;base64,JVBERi0="}, "cache_control": {"type": "ephemeral"}}
+			]},
+			{"role": "assistant", "content": "", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"a\"}"}},
+				{"id": "call_2", "type": "function", "function": {"name": "lookup", "arguments": ""}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "one"},
+			{"role": "tool", "tool_call_id": "call_2", "content": "two"},
+			{"role": "user", "content": "thanks"}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}],
+		"tool_choice": "required"
+	}`), &request))
+
+	converted, err := ConvertRequest(request)
+	require.NoError(t, err)
+
+	require.Len(t, converted.System, 2)
+	require.IsType(t, &types.SystemContentBlockMemberCachePoint{}, converted.System[1])
+
+	require.Len(t, converted.Messages, 3, "tool results and the next user turn merge into one turn")
+	user := converted.Messages[0].Content
+	require.Len(t, user, 4)
+	require.Equal(t, types.ImageFormatPng, user[1].(*types.ContentBlockMemberImage).Value.Format)
+	doc := user[2].(*types.ContentBlockMemberDocument).Value
+	require.Equal(t, types.DocumentFormatPdf, doc.Format)
+	require.Equal(t, "q3 report v2", aws.ToString(doc.Name))
+	require.IsType(t, &types.ContentBlockMemberCachePoint{}, user[3])
+
+	require.Len(t, converted.Messages[1].Content, 2)
+	require.Equal(t, "call_2", aws.ToString(converted.Messages[1].Content[1].(*types.ContentBlockMemberToolUse).Value.ToolUseId))
+
+	last := converted.Messages[2]
+	require.Equal(t, types.ConversationRoleUser, last.Role)
+	require.Len(t, last.Content, 3)
+	require.Equal(t, "call_2", aws.ToString(last.Content[1].(*types.ContentBlockMemberToolResult).Value.ToolUseId))
+
+	require.Equal(t, int32(256), aws.ToInt32(converted.InferenceConfig.MaxTokens))
+	require.Equal(t, []string{"END"}, converted.InferenceConfig.StopSequences)
+	require.IsType(t, &types.ToolChoiceMemberAny{}, converted.ToolConfig.ToolChoice)
+	require.NotNil(t, converted.AdditionalModelRequestFields)
+
+	request.ToolChoice = "none"
+	converted, err = ConvertRequest(request)
+	require.NoError(t, err)
+	require.Nil(t, converted.ToolConfig)
+}
+
+func TestHandlerUsesInferenceProfileArn(t *testing.T) {
+	t.Parallel()
+	const arn = "arn:aws:bedrock:eu-north-9:123456789012:application-inference-profile/abc123"
+	var gotPath string
+	var gotBody map[string]any
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"output": {"message": {"role": "assistant", "content": [
+				{"reasoningContent": {"reasoningText": {"text": "thinking", "signature": "sig"}}},
+				{"text": "Checking."},
+				{"toolUse": {"toolUseId": "tool_1", "name": "lookup", "input": {"q": "a"}}}
+			]}},
+			"stopReason": "tool_use",
+			"usage": {"inputTokens": 10, "outputTokens": 5, "totalTokens": 115, "cacheReadInputTokens": 60, "cacheWriteInputTokens": 40},
+			"metrics": {"latencyMs": 1}
+		}`))
+	})
+
+	c, w := newTestContext(t)
+	arnMap := `{"my-model": "` + arn + `"}`
+	c.Set(ctxkey.ChannelModel, &model.Channel{InferenceProfileArnMap: &arnMap})
+
+	adaptor := &Adaptor{}
+	_, err := adaptor.ConvertRequest(c, relaymode.ChatCompletions, &relaymodel.GeneralOpenAIRequest{
+		Model:    "my-model",
+		Messages: []relaymodel.Message{{Role: "user", Content: "hi"}},
+	})
+	require.NoError(t, err)
+
+	usage, relayErr := adaptor.DoResponse(c, cli, &meta.Meta{ActualModelName: "my-model"})
+	require.Nil(t, relayErr)
+	require.Equal(t, "/model/"+arn+"/converse", gotPath)
+	require.Contains(t, gotBody, "inferenceConfig")
+
+	require.Equal(t, 10, usage.PromptTokens)
+	require.Equal(t, 60, usage.PromptTokensDetails.CachedTokens)
+	require.Equal(t, 40, usage.CacheWrite5mTokens)
+
+	var resp openai.TextResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "tool_calls", resp.Choices[0].FinishReason)
+	require.Equal(t, "Checking.", resp.Choices[0].Content)
+	require.Equal(t, "thinking", *resp.Choices[0].Reasoning)
+	require.Len(t, resp.Choices[0].ToolCalls, 1)
+	require.Equal(t, `{"q":"a"}`, resp.Choices[0].ToolCalls[0].Function.Arguments)
+}
+
+// writeEvent encodes one ConverseStream event in the AWS event stream format.
+func writeEvent(t *testing.T, w io.Writer, eventType string, payload string) {
+	t.Helper()
+	var headers eventstream.Headers
+	headers.Set(":message-type", eventstream.StringValue("event"))
+	headers.Set(":event-type", eventstream.StringValue(eventType))
+	headers.Set(":content-type", eventstream.StringValue("application/json"))
+	require.NoError(t, eventstream.NewEncoder().Encode(w, eventstream.Message{Headers: headers, Payload: []byte(payload)}))
+}
+
+func TestStreamHandlerRelaysTextReasoningAndTools(t *testing.T) {
+	t.Parallel()
+	var gotPath string
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		writeEvent(t, w, "messageStart", `{"role":"assistant"}`)
+		writeEvent(t, w, "contentBlockDelta", `{"contentBlockIndex":0,"delta":{"reasoningContent":{"text":"hmm"}}}`)
+		writeEvent(t, w, "contentBlockDelta", `{"contentBlockIndex":0,"delta":{"reasoningContent":{"signature":"sig-1"}}}`)
+		writeEvent(t, w, "contentBlockDelta", `{"contentBlockIndex":1,"delta":{"text":"Hello"}}`)
+		writeEvent(t, w, "contentBlockStart", `{"contentBlockIndex":2,"start":{"toolUse":{"toolUseId":"tool_1","name":"lookup"}}}`)
+		writeEvent(t, w, "contentBlockDelta", `{"contentBlockIndex":2,"delta":{"toolUse":{"input":"{\"q\":1}"}}}`)
+		writeEvent(t, w, "messageStop", `{"stopReason":"tool_use"}`)
+		writeEvent(t, w, "metadata", `{"usage":{"inputTokens":7,"outputTokens":3,"totalTokens":10},"metrics":{"latencyMs":1}}`)
+	})
+
+	c, w := newTestContext(t)
+	adaptor := &Adaptor{}
+	_, err := adaptor.ConvertRequest(c, relaymode.ChatCompletions, &relaymodel.GeneralOpenAIRequest{
+		Model:    "vendor.some-model-v1:0",
+		Stream:   true,
+		Messages: []relaymodel.Message{{Role: "user", Content: "hi"}},
+	})
+	require.NoError(t, err)
+
+	usage, relayErr := adaptor.DoResponse(c, cli, &meta.Meta{ActualModelName: "vendor.some-model-v1:0", IsStream: true})
+	require.Nil(t, relayErr)
+	require.Equal(t, "/model/vendor.some-model-v1:0/converse-stream", gotPath)
+	require.Equal(t, 7, usage.PromptTokens)
+	require.Equal(t, 3, usage.CompletionTokens)
+
+	body := w.Body.String()
+	require.Contains(t, body, `"reasoning":"hmm"`)
+	require.Contains(t, body, `"signature":"sig-1"`)
+	require.Contains(t, body, `"content":"Hello"`)
+	require.Contains(t, body, `"id":"tool_1"`)
+	require.Contains(t, body, `"index":0`)
+	require.Contains(t, body, `"arguments":"{\"q\":1}"`)
+	require.Contains(t, body, `"finish_reason":"tool_calls"`)
+	require.Contains(t, body, "data: [DONE]")
+}
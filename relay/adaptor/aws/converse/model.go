@@ -0,0 +1,19 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// Request is an OpenAI-compatible request converted to the Converse API.
+//
+// It holds every Converse field except the model ID, which is only resolved in
+// DoResponse because it depends on the channel's region and inference profile
+// ARN mapping.
+type Request struct {
+	Messages                     []types.Message
+	System                       []types.SystemContentBlock
+	InferenceConfig              *types.InferenceConfiguration
+	ToolConfig                   *types.ToolConfiguration
+	AdditionalModelRequestFields document.Interface
+}
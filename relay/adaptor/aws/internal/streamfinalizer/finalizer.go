@@ -65,6 +65,15 @@ func (f *Finalizer) RecordMetadata(streamUsage *types.TokenUsage) bool {
 		if streamUsage.TotalTokens != nil {
 			f.usage.TotalTokens = int(*streamUsage.TotalTokens)
 		}
+		// Prompt cache tokens are billed apart from InputTokens, which excludes them.
+		if streamUsage.CacheReadInputTokens != nil && *streamUsage.CacheReadInputTokens > 0 {
+			f.usage.PromptTokensDetails = &relaymodel.UsagePromptTokensDetails{
+				CachedTokens: int(*streamUsage.CacheReadInputTokens),
+			}
+		}
+		if streamUsage.CacheWriteInputTokens != nil {
+			f.usage.CacheWrite5mTokens = int(*streamUsage.CacheWriteInputTokens)
+		}
 	}
 	f.metadataReceived = true
 	return f.emitFinal(false)
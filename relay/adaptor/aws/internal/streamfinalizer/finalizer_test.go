@@ -137,3 +137,23 @@ func TestFinalizerNotDuplicate(t *testing.T) {
 	require.True(t, f.FinalizeOnClose(), "finalize on close returned false")
 	require.Len(t, cap.payloads, 1, "expected no additional chunks")
 }
+
+func TestFinalizerRecordsCacheTokens(t *testing.T) {
+	t.Parallel()
+	usage := relaymodel.Usage{}
+	cap := &capturedRender{allow: true}
+	f := NewFinalizer("test-model", 123, &usage, zap.NewNop(), cap.render)
+	f.SetID("chatcmpl-1")
+
+	require.True(t, f.RecordMetadata(&types.TokenUsage{
+		InputTokens:           aws.Int32(10),
+		OutputTokens:          aws.Int32(5),
+		TotalTokens:           aws.Int32(115),
+		CacheReadInputTokens:  aws.Int32(60),
+		CacheWriteInputTokens: aws.Int32(40),
+	}))
+	require.Equal(t, 10, usage.PromptTokens)
+	require.NotNil(t, usage.PromptTokensDetails)
+	require.Equal(t, 60, usage.PromptTokensDetails.CachedTokens)
+	require.Equal(t, 40, usage.CacheWrite5mTokens)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/Laisky/one-api/common/logger"
 	claude "github.com/Laisky/one-api/relay/adaptor/aws/claude"
 	cohere "github.com/Laisky/one-api/relay/adaptor/aws/cohere"
+	converse "github.com/Laisky/one-api/relay/adaptor/aws/converse"
 	deepseek "github.com/Laisky/one-api/relay/adaptor/aws/deepseek"
 	llama3 "github.com/Laisky/one-api/relay/adaptor/aws/llama3"
 	mistral "github.com/Laisky/one-api/relay/adaptor/aws/mistral"
@@ -28,6 +29,9 @@ const (
 	AwsOpenAI
 	AwsQwen
 	AwsWriter
+	// AwsConverse serves every model without a dedicated subpackage through
+	// the generic Converse API.
+	AwsConverse
 )
 
 var (
@@ -78,6 +82,8 @@ func init() {
 	awsCohereArnMatch = matchCohere
 }
 
+// GetAdaptor returns the sub-adaptor for a model. Models without a dedicated
+// subpackage, including raw Bedrock model IDs, use the Converse adaptor.
 func GetAdaptor(model string) utils.AwsAdapter {
 	adaptorType := adaptors[model]
 	if awsArnMatch.MatchString(model) {
@@ -86,6 +92,10 @@ func GetAdaptor(model string) utils.AwsAdapter {
 		adaptorType = AwsCohere
 	}
 
+	if adaptorType == 0 {
+		adaptorType = AwsConverse
+	}
+
 	switch adaptorType {
 	case AwsClaude:
 		return &claude.Adaptor{}
@@ -103,6 +113,8 @@ func GetAdaptor(model string) utils.AwsAdapter {
 		return &qwen.Adaptor{}
 	case AwsWriter:
 		return &writer.Adaptor{}
+	case AwsConverse:
+		return &converse.Adaptor{}
 	default:
 		return nil
 	}
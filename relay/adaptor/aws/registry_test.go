@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	converse "github.com/Laisky/one-api/relay/adaptor/aws/converse"
 	qwen "github.com/Laisky/one-api/relay/adaptor/aws/qwen"
 )
 
@@ -16,3 +17,15 @@ func TestGetAdaptorReturnsQwenAdaptor(t *testing.T) {
 	_, ok := adaptor.(*qwen.Adaptor)
 	require.True(t, ok, "expected adaptor type *qwen.Adaptor, got %T", adaptor)
 }
+
+func TestGetAdaptorFallsBackToConverse(t *testing.T) {
+	t.Parallel()
+	adaptor := GetAdaptor("amazon.nova-pro-v1:0")
+	_, ok := adaptor.(*converse.Adaptor)
+	require.True(t, ok, "expected adaptor type *converse.Adaptor, got %T", adaptor)
+
+	capabilities := GetModelCapabilities("amazon.nova-pro-v1:0")
+	require.True(t, capabilities.SupportsTools)
+	require.True(t, capabilities.SupportsStop)
+	require.False(t, capabilities.SupportsEmbedding)
+}
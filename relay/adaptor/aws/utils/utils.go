@@ -3,6 +3,12 @@ package utils
 import (
 	"net/http"
 
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/model"
 	relaymodel "github.com/Laisky/one-api/relay/model"
 )
 
@@ -15,3 +21,24 @@ func WrapErr(err error) *relaymodel.ErrorWithStatusCode {
 		},
 	}
 }
+
+// InferenceProfileArn returns the inference profile ARN that the channel's
+// InferenceProfileArnMap assigns to requestModel, or "" when there is none.
+func InferenceProfileArn(c *gin.Context, requestModel string) string {
+	channelModel, ok := c.Get(ctxkey.ChannelModel)
+	if !ok {
+		return ""
+	}
+	channel, ok := channelModel.(*model.Channel)
+	if !ok {
+		return ""
+	}
+	arn := channel.GetInferenceProfileArnMapWithContext(gmw.Ctx(c))[requestModel]
+	if arn != "" {
+		gmw.GetLogger(c).Debug("using channel inference profile ARN",
+			zap.String("request_model", requestModel),
+			zap.String("arn", arn),
+		)
+	}
+	return arn
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/Laisky/errors/v2"
 	gmw "github.com/Laisky/gin-middlewares/v7"
@@ -11,6 +12,7 @@ import (
 	"github.com/Laisky/zap"
 	"github.com/gin-gonic/gin"
 
+	"github.com/Laisky/one-api/common"
 	"github.com/Laisky/one-api/common/client"
 	"github.com/Laisky/one-api/common/ctxkey"
 	"github.com/Laisky/one-api/common/identity"
@@ -146,6 +148,7 @@ func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.
 	if err = applyChannelCustomHeaders(req, meta); err != nil {
 		return nil, errors.Wrap(err, "apply channel custom headers")
 	}
+	captureUpstreamRequest(c, req)
 
 	// Prepare tagged logger and propagate to context.
 	// The request-scoped logger is already bound with the full user/token/channel
@@ -196,6 +199,40 @@ func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.
 	return resp, nil
 }
 
+// captureUpstreamRequest records the converted request on the request capture,
+// if the relay is capturing this request. Bodies that cannot be re-read, such
+// as streamed multipart uploads, are recorded as a placeholder.
+func captureUpstreamRequest(c *gin.Context, req *http.Request) {
+	value, ok := c.Get(ctxkey.RequestCapture)
+	if !ok {
+		return
+	}
+	capture, ok := value.(*model.RequestCapture)
+	if !ok {
+		return
+	}
+	url := common.SanitizeURLForLogging(req.URL.String())
+	if req.GetBody == nil {
+		if req.Body == nil || req.Body == http.NoBody {
+			capture.SetUpstreamRequest(url, "", false)
+		} else {
+			capture.SetUpstreamRequest(url, "[streamed body not captured]", false)
+		}
+		return
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return
+	}
+	stored, truncated := model.CaptureBody(raw, req.Header.Get("Content-Type"))
+	capture.SetUpstreamRequest(url, stored, truncated)
+}
+
 func DoRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	// keep logger from context if available
 	httpClient := client.HTTPClient
@@ -206,6 +243,7 @@ func DoRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 			httpClient = http.DefaultClient
 		}
 	}
+	sentAt := time.Now()
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "perform upstream request")
@@ -213,6 +251,8 @@ func DoRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	c.Set(ctxkey.UpstreamRequestAt, sentAt)
+	c.Set(ctxkey.UpstreamResponseAt, time.Now())
 
 	// Optionally: Record when first response is received from upstream (non-standard event)
 	tracing.RecordTraceTimestamp(c, model.TimestampFirstUpstreamResponse)
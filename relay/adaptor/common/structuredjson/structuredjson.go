@@ -1,6 +1,7 @@
 package structuredjson
 
 import (
+	"encoding/json"
 	"sort"
 	"strings"
 
@@ -15,9 +16,22 @@ func EnsureInstruction(request *model.GeneralOpenAIRequest) {
 		return
 	}
 
-	schema := request.ResponseFormat.JsonSchema
-	instruction := buildInstruction(schema)
+	ensureSystemInstruction(request, buildInstruction(request.ResponseFormat.JsonSchema))
+}
+
+// EnsureSchemaInstruction is like EnsureInstruction but embeds the complete JSON
+// Schema, for gateways that validate the reply instead of trusting the model.
+func EnsureSchemaInstruction(request *model.GeneralOpenAIRequest) {
+	if request == nil || request.ResponseFormat == nil || request.ResponseFormat.JsonSchema == nil {
+		return
+	}
+
+	ensureSystemInstruction(request, buildSchemaInstruction(request.ResponseFormat.JsonSchema))
+}
 
+// ensureSystemInstruction appends instruction to a leading string system message,
+// or prepends a new system message when there is none.
+func ensureSystemInstruction(request *model.GeneralOpenAIRequest, instruction string) {
 	if len(request.Messages) > 0 && request.Messages[0].Role == "system" && request.Messages[0].IsStringContent() {
 		existing := request.Messages[0].StringContent()
 		trimmed := strings.TrimSpace(existing)
@@ -76,3 +90,29 @@ func buildInstruction(schema *model.JSONSchema) string {
 
 	return message
 }
+
+func buildSchemaInstruction(schema *model.JSONSchema) string {
+	if schema == nil || len(schema.Schema) == 0 {
+		return buildInstruction(schema)
+	}
+	encoded, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return buildInstruction(schema)
+	}
+
+	var builder strings.Builder
+	if schema.Description != "" {
+		builder.WriteString(schema.Description)
+		builder.WriteString("\n\n")
+	}
+	builder.WriteString("Respond ONLY with a single JSON value that validates against this JSON Schema")
+	if schema.Name != "" {
+		builder.WriteString(" (")
+		builder.WriteString(schema.Name)
+		builder.WriteString(")")
+	}
+	builder.WriteString(":\n")
+	builder.Write(encoded)
+	builder.WriteString("\nDo not include commentary, markdown fences, or keys the schema does not allow.")
+	return builder.String()
+}
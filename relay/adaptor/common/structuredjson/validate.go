@@ -0,0 +1,366 @@
+package structuredjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// maxRefDepth bounds $ref expansion so recursive schemas cannot loop forever.
+const maxRefDepth = 64
+
+// ValidationError describes the first location where a document violates its schema.
+type ValidationError struct {
+	// Path is a JSONPath-style pointer to the offending value, e.g. "$.items[2].name".
+	Path string
+	// Message explains the violated constraint.
+	Message string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks value, a document decoded by encoding/json, against a JSON Schema.
+//
+// It implements the subset used by OpenAI structured outputs: type, enum, const,
+// properties, required, additionalProperties, items, anyOf, oneOf, allOf, local
+// $ref pointers, and the string, number and array bounds. Unknown keywords are
+// ignored. A nil or empty schema accepts every document.
+func Validate(schema map[string]any, value any) error {
+	v := validator{root: schema}
+	return v.validate(schema, value, "$", 0)
+}
+
+type validator struct {
+	root map[string]any
+}
+
+func (v validator) validate(schema map[string]any, value any, path string, depth int) error {
+	if len(schema) == 0 {
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok && ref != "" {
+		if depth >= maxRefDepth {
+			return &ValidationError{Path: path, Message: "schema $ref nesting is too deep"}
+		}
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			return &ValidationError{Path: path, Message: err.Error()}
+		}
+		if err := v.validate(target, value, path, depth+1); err != nil {
+			return err
+		}
+	}
+
+	if rawType, ok := schema["type"]; ok {
+		types := schemaTypes(rawType)
+		if len(types) > 0 && !matchesAnyType(types, value) {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), jsonType(value))}
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &ValidationError{Path: path, Message: "value is not one of the allowed enum values"}
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		return &ValidationError{Path: path, Message: "value does not match const"}
+	}
+
+	if err := v.validateCombinators(schema, value, path, depth); err != nil {
+		return err
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		return v.validateObject(schema, typed, path, depth)
+	case []any:
+		return v.validateArray(schema, typed, path, depth)
+	case string:
+		return validateString(schema, typed, path)
+	case float64:
+		return validateNumber(schema, typed, path)
+	}
+	return nil
+}
+
+func (v validator) validateCombinators(schema map[string]any, value any, path string, depth int) error {
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, raw := range all {
+			sub, _ := raw.(map[string]any)
+			if err := v.validate(sub, value, path, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok && len(anyOf) > 0 {
+		var firstErr error
+		matched := false
+		for _, raw := range anyOf {
+			sub, _ := raw.(map[string]any)
+			err := v.validate(sub, value, path, depth+1)
+			if err == nil {
+				matched = true
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if !matched {
+			return &ValidationError{Path: path, Message: "value matches none of the anyOf schemas (first mismatch: " + firstErr.Error() + ")"}
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok && len(oneOf) > 0 {
+		matches := 0
+		for _, raw := range oneOf {
+			sub, _ := raw.(map[string]any)
+			if v.validate(sub, value, path, depth+1) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("value matches %d of the oneOf schemas, want exactly 1", matches)}
+		}
+	}
+	return nil
+}
+
+func (v validator) validateObject(schema map[string]any, object map[string]any, path string, depth int) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, raw := range required {
+			name, _ := raw.(string)
+			if name == "" {
+				continue
+			}
+			if _, present := object[name]; !present {
+				return &ValidationError{Path: path, Message: "missing required property " + strconv.Quote(name)}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := path + "." + key
+		if rawProp, ok := properties[key]; ok {
+			propSchema, _ := rawProp.(map[string]any)
+			if err := v.validate(propSchema, object[key], childPath, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return &ValidationError{Path: path, Message: "unexpected property " + strconv.Quote(key)}
+			}
+		case map[string]any:
+			if err := v.validate(additional, object[key], childPath, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v validator) validateArray(schema map[string]any, array []any, path string, depth int) error {
+	if minItems, ok := schemaNumber(schema, "minItems"); ok && float64(len(array)) < minItems {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected at least %v items, got %d", minItems, len(array))}
+	}
+	if maxItems, ok := schemaNumber(schema, "maxItems"); ok && float64(len(array)) > maxItems {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected at most %v items, got %d", maxItems, len(array))}
+	}
+	items, _ := schema["items"].(map[string]any)
+	if len(items) == 0 {
+		return nil
+	}
+	for idx, item := range array {
+		if err := v.validate(items, item, fmt.Sprintf("%s[%d]", path, idx), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateString(schema map[string]any, value string, path string) error {
+	length := float64(utf8.RuneCountInString(value))
+	if minLength, ok := schemaNumber(schema, "minLength"); ok && length < minLength {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected at least %v characters", minLength)}
+	}
+	if maxLength, ok := schemaNumber(schema, "maxLength"); ok && length > maxLength {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected at most %v characters", maxLength)}
+	}
+	if pattern, ok := schema["pattern"].(string); ok && pattern != "" {
+		// Patterns outside Go's RE2 dialect are skipped rather than failing every response.
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+			return &ValidationError{Path: path, Message: "value does not match pattern " + strconv.Quote(pattern)}
+		}
+	}
+	return nil
+}
+
+func validateNumber(schema map[string]any, value float64, path string) error {
+	if minimum, ok := schemaNumber(schema, "minimum"); ok && value < minimum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected a value >= %v", minimum)}
+	}
+	if maximum, ok := schemaNumber(schema, "maximum"); ok && value > maximum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected a value <= %v", maximum)}
+	}
+	if minimum, ok := schemaNumber(schema, "exclusiveMinimum"); ok && value <= minimum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected a value > %v", minimum)}
+	}
+	if maximum, ok := schemaNumber(schema, "exclusiveMaximum"); ok && value >= maximum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected a value < %v", maximum)}
+	}
+	return nil
+}
+
+// resolveRef follows a local JSON pointer such as "#/$defs/step" from the root schema.
+func (v validator) resolveRef(ref string) (map[string]any, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, errors.Errorf("unsupported $ref %q: only local references are allowed", ref)
+	}
+	var current any = v.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		node, ok := current.(map[string]any)
+		if !ok {
+			return nil, errors.Errorf("unresolvable $ref %q", ref)
+		}
+		if current, ok = node[token]; !ok {
+			return nil, errors.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	target, ok := current.(map[string]any)
+	if !ok {
+		return nil, errors.Errorf("$ref %q does not point to a schema", ref)
+	}
+	return target, nil
+}
+
+func schemaTypes(raw any) []string {
+	switch typed := raw.(type) {
+	case string:
+		return []string{typed}
+	case []any:
+		types := make([]string, 0, len(typed))
+		for _, item := range typed {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func matchesAnyType(types []string, value any) bool {
+	actual := jsonType(value)
+	for _, expected := range types {
+		if expected == actual {
+			return true
+		}
+		if expected == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType names the JSON Schema type of a decoded value; whole numbers report "integer".
+func jsonType(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if typed == math.Trunc(typed) && !math.IsInf(typed, 0) {
+			return "integer"
+		}
+		return "number"
+	case json.Number:
+		if _, err := typed.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func schemaNumber(schema map[string]any, key string) (float64, bool) {
+	value, ok := schema[key].(float64)
+	return value, ok
+}
+
+// ExtractJSON returns the JSON document embedded in a model reply together with
+// its decoded value.
+//
+// Models driven by a prompt instruction often wrap their answer in a markdown
+// fence or a sentence of prose, so the outermost object or array is recovered
+// when the whole reply is not valid JSON.
+func ExtractJSON(text string) (string, any, error) {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return "", nil, errors.New("response is empty")
+	}
+	if strings.HasPrefix(trimmed, "```") {
+		trimmed = strings.TrimPrefix(trimmed, "```")
+		if newline := strings.IndexByte(trimmed, '\n'); newline >= 0 {
+			trimmed = trimmed[newline+1:]
+		}
+		trimmed = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(trimmed), "```"))
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(trimmed), &value); err == nil {
+		return trimmed, value, nil
+	}
+
+	start := strings.IndexAny(trimmed, "{[")
+	if start >= 0 {
+		closing := "}"
+		if trimmed[start] == '[' {
+			closing = "]"
+		}
+		if end := strings.LastIndex(trimmed, closing); end > start {
+			candidate := trimmed[start : end+1]
+			if err := json.Unmarshal([]byte(candidate), &value); err == nil {
+				return candidate, value, nil
+			}
+		}
+	}
+	return "", nil, errors.New("response is not valid JSON")
+}
@@ -0,0 +1,87 @@
+package structuredjson
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"type": "string", "enum": ["a", "b"]}, "maxItems": 2},
+			"next": {"anyOf": [{"type": "null"}, {"$ref": "#/$defs/step"}]}
+		},
+		"required": ["name", "age"],
+		"additionalProperties": false,
+		"$defs": {
+			"step": {"type": "object", "properties": {"id": {"type": "number"}}, "required": ["id"]}
+		}
+	}`), &schema))
+
+	cases := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{name: "valid", doc: `{"name":"x","age":3,"tags":["a"],"next":{"id":1.5}}`},
+		{name: "null branch", doc: `{"name":"x","age":3,"next":null}`},
+		{name: "missing required", doc: `{"name":"x"}`, wantErr: `$: missing required property "age"`},
+		{name: "fractional integer", doc: `{"name":"x","age":1.5}`, wantErr: "$.age: expected integer, got number"},
+		{name: "below minimum", doc: `{"name":"x","age":-1}`, wantErr: "$.age: expected a value >= 0"},
+		{name: "extra property", doc: `{"name":"x","age":1,"extra":true}`, wantErr: `$: unexpected property "extra"`},
+		{name: "enum item", doc: `{"name":"x","age":1,"tags":["c"]}`, wantErr: "$.tags[0]: value is not one of the allowed enum values"},
+		{name: "too many items", doc: `{"name":"x","age":1,"tags":["a","b","a"]}`, wantErr: "$.tags: expected at most 2 items, got 3"},
+		{name: "ref mismatch", doc: `{"name":"x","age":1,"next":{}}`, wantErr: "$.next: value matches none of the anyOf schemas"},
+		{name: "wrong root type", doc: `[1]`, wantErr: "$: expected object, got array"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var value any
+			require.NoError(t, json.Unmarshal([]byte(tc.doc), &value))
+			err := Validate(schema, value)
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", text: ` {"a":1} `, want: `{"a":1}`},
+		{name: "fenced", text: "```json\n{\"a\":1}\n```", want: `{"a":1}`},
+		{name: "prose", text: `Here you go: {"a":{"b":[1]}} Hope it helps.`, want: `{"a":{"b":[1]}}`},
+		{name: "array", text: `Result: [1, 2]`, want: `[1, 2]`},
+		{name: "empty", text: "  ", wantErr: true},
+		{name: "not json", text: "no idea", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, value, err := ExtractJSON(tc.text)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+			require.NotNil(t, value)
+		})
+	}
+}
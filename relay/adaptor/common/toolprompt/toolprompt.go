@@ -0,0 +1,390 @@
+// Package toolprompt emulates function calling for models without native tool
+// support. Tool definitions are described in a system instruction, earlier tool
+// calls and tool results are replayed as plain text, and the model's reply is
+// scanned for <tool_call> blocks that are converted back into OpenAI tool calls.
+package toolprompt
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/Laisky/one-api/common/random"
+	"github.com/Laisky/one-api/relay/model"
+)
+
+const (
+	callOpenTag    = "<tool_call>"
+	callCloseTag   = "</tool_call>"
+	resultCloseTag = "</tool_result>"
+)
+
+// FunctionTools returns the function tools among tools, skipping hosted tools
+// such as web_search that the model is not expected to call itself.
+func FunctionTools(tools []model.Tool) []model.Tool {
+	functions := make([]model.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Function == nil || tool.Function.Name == "" {
+			continue
+		}
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		functions = append(functions, tool)
+	}
+	return functions
+}
+
+// Rewrite returns a copy of request in which tools live in the prompt instead of
+// the tools field. The original request is left untouched so callers can keep
+// appending structured tool calls and results to it between rounds.
+//
+// A tool_choice of "none" only drops the tools; "required" or a named function
+// makes the instruction demand a call.
+func Rewrite(request *model.GeneralOpenAIRequest) *model.GeneralOpenAIRequest {
+	if request == nil {
+		return nil
+	}
+	rewritten := *request
+	tools := FunctionTools(request.Tools)
+	rewritten.Tools = nil
+	rewritten.ToolChoice = nil
+	rewritten.ParallelTooCalls = nil
+	rewritten.Messages = RewriteHistory(request.Messages)
+
+	if len(tools) > 0 && !isToolChoiceNone(request.ToolChoice) {
+		rewritten.Messages = prependSystemInstruction(rewritten.Messages, Instruction(tools, request.ToolChoice))
+	}
+	return &rewritten
+}
+
+// Instruction describes tools and the <tool_call> reply format.
+func Instruction(tools []model.Tool, toolChoice any) string {
+	var builder strings.Builder
+	builder.WriteString("You can call the following tools to help answer the user.\n\n")
+	for _, tool := range tools {
+		builder.WriteString("- ")
+		builder.WriteString(tool.Function.Name)
+		if description := strings.TrimSpace(tool.Function.Description); description != "" {
+			builder.WriteString(": ")
+			builder.WriteString(description)
+		}
+		builder.WriteString("\n")
+		if tool.Function.Parameters != nil {
+			if encoded, err := json.Marshal(tool.Function.Parameters); err == nil {
+				builder.WriteString("  Parameters JSON Schema: ")
+				builder.Write(encoded)
+				builder.WriteString("\n")
+			}
+		}
+	}
+
+	builder.WriteString("\nTo call a tool, reply with one block per call in exactly this form:\n")
+	builder.WriteString(callOpenTag)
+	builder.WriteString("\n{\"name\": \"<tool name>\", \"arguments\": {<arguments as a JSON object>}}\n")
+	builder.WriteString(callCloseTag)
+	builder.WriteString("\nAfter the blocks, stop and wait: results come back in <tool_result> blocks.")
+
+	switch name := forcedToolName(toolChoice); {
+	case name != "":
+		builder.WriteString("\nYou must call the ")
+		builder.WriteString(name)
+		builder.WriteString(" tool now.")
+	case toolChoice == "required":
+		builder.WriteString("\nYou must call at least one tool now.")
+	default:
+		builder.WriteString("\nIf no tool is needed, answer the user directly without any <tool_call> block.")
+	}
+	return builder.String()
+}
+
+// RewriteHistory replays assistant tool calls as <tool_call> blocks and turns
+// tool messages into user messages carrying <tool_result> blocks. Consecutive
+// tool results are merged so the conversation keeps alternating roles.
+func RewriteHistory(messages []model.Message) []model.Message {
+	callNames := make(map[string]string)
+	rewritten := make([]model.Message, 0, len(messages))
+	mergingResults := false
+	for _, message := range messages {
+		switch {
+		case message.Role == "assistant" && len(message.ToolCalls) > 0:
+			var builder strings.Builder
+			if text := strings.TrimSpace(message.StringContent()); text != "" {
+				builder.WriteString(text)
+				builder.WriteString("\n")
+			}
+			for _, call := range message.ToolCalls {
+				if call.Function == nil {
+					continue
+				}
+				callNames[call.Id] = call.Function.Name
+				builder.WriteString(formatCall(call.Function.Name, call.Function.Arguments))
+				builder.WriteString("\n")
+			}
+			message.Content = strings.TrimSpace(builder.String())
+			message.ToolCalls = nil
+			rewritten = append(rewritten, message)
+			mergingResults = false
+		case message.Role == "tool":
+			block := formatResult(callNames[message.ToolCallId], message.ToolCallId, message.StringContent())
+			if mergingResults {
+				last := &rewritten[len(rewritten)-1]
+				last.Content = last.StringContent() + "\n" + block
+				continue
+			}
+			rewritten = append(rewritten, model.Message{Role: "user", Content: block})
+			mergingResults = true
+		default:
+			rewritten = append(rewritten, message)
+			mergingResults = false
+		}
+	}
+	return rewritten
+}
+
+// Parse extracts tool calls from a model reply. It accepts <tool_call> blocks
+// holding either {"name", "arguments"} JSON or <name>/<arguments> tags, and a
+// reply that is nothing but such a JSON object, a list of them, or a
+// {"tool_calls": [...]} wrapper. Calls to tools that were not offered are left
+// in the text. content is the reply without the recognized calls.
+func Parse(text string, tools []model.Tool) (content string, calls []model.Tool) {
+	known := make(map[string]bool, len(tools))
+	for _, tool := range FunctionTools(tools) {
+		known[tool.Function.Name] = true
+	}
+	if len(known) == 0 {
+		return text, nil
+	}
+
+	if strings.Contains(text, callOpenTag) {
+		var remaining strings.Builder
+		rest := text
+		for {
+			start := strings.Index(rest, callOpenTag)
+			if start < 0 {
+				remaining.WriteString(rest)
+				break
+			}
+			remaining.WriteString(rest[:start])
+			body := rest[start+len(callOpenTag):]
+			block := rest[start:]
+			end := strings.Index(body, callCloseTag)
+			if end >= 0 {
+				block = rest[start : start+len(callOpenTag)+end+len(callCloseTag)]
+				rest = body[end+len(callCloseTag):]
+				body = body[:end]
+			} else {
+				// Models often stop generating before the closing tag.
+				rest = ""
+			}
+			if call, ok := parseCallBody(body, known); ok {
+				calls = append(calls, call)
+				continue
+			}
+			remaining.WriteString(block)
+		}
+		if len(calls) > 0 {
+			return strings.TrimSpace(remaining.String()), calls
+		}
+		return text, nil
+	}
+
+	if calls = parseBareJSON(stripFence(text), known); len(calls) > 0 {
+		return "", calls
+	}
+	return text, nil
+}
+
+var (
+	xmlNameRe      = regexp.MustCompile(`(?s)<name>\s*(.*?)\s*</name>`)
+	xmlArgumentsRe = regexp.MustCompile(`(?s)<(arguments|parameters)>\s*(.*?)\s*</(?:arguments|parameters)>`)
+)
+
+// parseCallBody decodes the inside of one <tool_call> block.
+func parseCallBody(body string, known map[string]bool) (model.Tool, bool) {
+	body = stripFence(body)
+	var object map[string]any
+	if err := json.Unmarshal([]byte(body), &object); err == nil {
+		return callFromObject(object, known)
+	}
+
+	nameMatch := xmlNameRe.FindStringSubmatch(body)
+	if nameMatch == nil || !known[nameMatch[1]] {
+		return model.Tool{}, false
+	}
+	arguments := "{}"
+	if argsMatch := xmlArgumentsRe.FindStringSubmatch(body); argsMatch != nil {
+		raw := stripFence(argsMatch[2])
+		if !json.Valid([]byte(raw)) {
+			return model.Tool{}, false
+		}
+		arguments = raw
+	}
+	return newCall(nameMatch[1], arguments), true
+}
+
+// parseBareJSON recognizes replies that are only a call object, a list of call
+// objects, or an object with a tool_calls list.
+func parseBareJSON(text string, known map[string]bool) []model.Tool {
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil
+	}
+	var items []any
+	switch typed := value.(type) {
+	case []any:
+		items = typed
+	case map[string]any:
+		if list, ok := typed["tool_calls"].([]any); ok {
+			items = list
+		} else {
+			items = []any{typed}
+		}
+	}
+
+	calls := make([]model.Tool, 0, len(items))
+	for _, item := range items {
+		object, ok := item.(map[string]any)
+		if !ok {
+			return nil
+		}
+		// Accept the OpenAI wire shape {"type":"function","function":{...}} too.
+		if function, ok := object["function"].(map[string]any); ok {
+			object = function
+		}
+		call, ok := callFromObject(object, known)
+		if !ok {
+			return nil
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+func callFromObject(object map[string]any, known map[string]bool) (model.Tool, bool) {
+	name, _ := object["name"].(string)
+	if !known[name] {
+		return model.Tool{}, false
+	}
+	raw, ok := object["arguments"]
+	if !ok {
+		raw = object["parameters"]
+	}
+	switch typed := raw.(type) {
+	case nil:
+		return newCall(name, "{}"), true
+	case string:
+		if !json.Valid([]byte(typed)) {
+			return model.Tool{}, false
+		}
+		return newCall(name, typed), true
+	default:
+		encoded, err := json.Marshal(typed)
+		if err != nil {
+			return model.Tool{}, false
+		}
+		return newCall(name, string(encoded)), true
+	}
+}
+
+func newCall(name, arguments string) model.Tool {
+	return model.Tool{
+		Id:   "call_" + random.GetRandomString(24),
+		Type: "function",
+		Function: &model.Function{
+			Name:      name,
+			Arguments: arguments,
+		},
+	}
+}
+
+func formatCall(name string, arguments any) string {
+	var encodedArgs json.RawMessage
+	switch typed := arguments.(type) {
+	case nil:
+		encodedArgs = json.RawMessage("{}")
+	case string:
+		if json.Valid([]byte(typed)) && strings.TrimSpace(typed) != "" {
+			encodedArgs = json.RawMessage(typed)
+		} else {
+			encodedArgs = json.RawMessage("{}")
+		}
+	default:
+		encoded, err := json.Marshal(typed)
+		if err != nil {
+			encoded = []byte("{}")
+		}
+		encodedArgs = encoded
+	}
+	encoded, _ := json.Marshal(struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}{Name: name, Arguments: encodedArgs})
+	return callOpenTag + "\n" + string(encoded) + "\n" + callCloseTag
+}
+
+func formatResult(name, id, content string) string {
+	var builder strings.Builder
+	builder.WriteString("<tool_result")
+	if name != "" {
+		builder.WriteString(` name="`)
+		builder.WriteString(name)
+		builder.WriteString(`"`)
+	}
+	if id != "" {
+		builder.WriteString(` id="`)
+		builder.WriteString(id)
+		builder.WriteString(`"`)
+	}
+	builder.WriteString(">\n")
+	builder.WriteString(content)
+	builder.WriteString("\n")
+	builder.WriteString(resultCloseTag)
+	return builder.String()
+}
+
+// prependSystemInstruction appends instruction to a leading string system
+// message, or prepends a new system message when there is none.
+func prependSystemInstruction(messages []model.Message, instruction string) []model.Message {
+	if len(messages) > 0 && messages[0].Role == "system" && messages[0].IsStringContent() {
+		updated := append([]model.Message(nil), messages...)
+		if existing := strings.TrimSpace(updated[0].StringContent()); existing != "" {
+			updated[0].Content = existing + "\n\n" + instruction
+		} else {
+			updated[0].Content = instruction
+		}
+		return updated
+	}
+	return append([]model.Message{{Role: "system", Content: instruction}}, messages...)
+}
+
+func stripFence(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "```") {
+		return trimmed
+	}
+	trimmed = strings.TrimPrefix(trimmed, "```")
+	if newline := strings.IndexByte(trimmed, '\n'); newline >= 0 {
+		trimmed = trimmed[newline+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(trimmed), "```"))
+}
+
+func isToolChoiceNone(toolChoice any) bool {
+	choice, ok := toolChoice.(string)
+	return ok && choice == "none"
+}
+
+// forcedToolName returns the function named by an object tool_choice.
+func forcedToolName(toolChoice any) string {
+	choice, ok := toolChoice.(map[string]any)
+	if !ok {
+		return ""
+	}
+	if function, ok := choice["function"].(map[string]any); ok {
+		name, _ := function["name"].(string)
+		return name
+	}
+	name, _ := choice["name"].(string)
+	return name
+}
@@ -0,0 +1,130 @@
+package toolprompt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/relay/model"
+)
+
+func weatherTools() []model.Tool {
+	return []model.Tool{
+		{Type: "function", Function: &model.Function{
+			Name:        "get_weather",
+			Description: "Look up the weather",
+			Parameters:  map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+		}},
+		{Type: "web_search"},
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	t.Parallel()
+	parallel := true
+	request := &model.GeneralOpenAIRequest{
+		Model: "baichuan2-turbo",
+		Messages: []model.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Weather in Paris and Rome?"},
+			{Role: "assistant", ToolCalls: []model.Tool{
+				{Id: "call_a", Type: "function", Function: &model.Function{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+				{Id: "call_b", Type: "function", Function: &model.Function{Name: "get_weather", Arguments: `{"city":"Rome"}`}},
+			}},
+			{Role: "tool", ToolCallId: "call_a", Content: "sunny"},
+			{Role: "tool", ToolCallId: "call_b", Content: "rainy"},
+		},
+		Tools:            weatherTools(),
+		ToolChoice:       "required",
+		ParallelTooCalls: &parallel,
+	}
+
+	rewritten := Rewrite(request)
+	require.Nil(t, rewritten.Tools)
+	require.Nil(t, rewritten.ToolChoice)
+	require.Nil(t, rewritten.ParallelTooCalls)
+	require.Len(t, request.Tools, 2, "the original request must not change")
+	require.Len(t, request.Messages, 5)
+
+	require.Len(t, rewritten.Messages, 4)
+	system := rewritten.Messages[0].StringContent()
+	require.Contains(t, system, "Be brief.")
+	require.Contains(t, system, "- get_weather: Look up the weather")
+	require.Contains(t, system, `"city"`)
+	require.Contains(t, system, "You must call at least one tool now.")
+	require.NotContains(t, system, "web_search")
+
+	assistant := rewritten.Messages[2]
+	require.Empty(t, assistant.ToolCalls)
+	require.Contains(t, assistant.StringContent(), `{"name":"get_weather","arguments":{"city":"Rome"}}`)
+
+	results := rewritten.Messages[3]
+	require.Equal(t, "user", results.Role)
+	require.Contains(t, results.StringContent(), "<tool_result name=\"get_weather\" id=\"call_a\">\nsunny\n</tool_result>")
+	require.Contains(t, results.StringContent(), "rainy")
+
+	request.ToolChoice = "none"
+	require.Equal(t, "Be brief.", Rewrite(request).Messages[0].StringContent())
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	tools := weatherTools()
+	cases := []struct {
+		name        string
+		text        string
+		wantContent string
+		wantArgs    []string
+	}{
+		{
+			name:        "json block",
+			text:        "Let me check.\n<tool_call>\n{\"name\": \"get_weather\", \"arguments\": {\"city\": \"Paris\"}}\n</tool_call>",
+			wantContent: "Let me check.",
+			wantArgs:    []string{`{"city":"Paris"}`},
+		},
+		{
+			name:     "xml block without closing tag",
+			text:     "<tool_call><name>get_weather</name><arguments>{\"city\":\"Rome\"}</arguments>",
+			wantArgs: []string{`{"city":"Rome"}`},
+		},
+		{
+			name:     "two blocks with string arguments",
+			text:     "<tool_call>{\"name\":\"get_weather\",\"arguments\":\"{\\\"city\\\":\\\"A\\\"}\"}</tool_call><tool_call>```json\n{\"name\":\"get_weather\"}\n```</tool_call>",
+			wantArgs: []string{`{"city":"A"}`, `{}`},
+		},
+		{
+			name:     "bare fenced object",
+			text:     "```json\n{\"name\":\"get_weather\",\"parameters\":{\"city\":\"Oslo\"}}\n```",
+			wantArgs: []string{`{"city":"Oslo"}`},
+		},
+		{
+			name:     "openai wrapper",
+			text:     `{"tool_calls":[{"type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Lima\"}"}}]}`,
+			wantArgs: []string{`{"city":"Lima"}`},
+		},
+		{
+			name:        "unknown tool stays text",
+			text:        "<tool_call>{\"name\":\"rm_rf\",\"arguments\":{}}</tool_call>",
+			wantContent: "<tool_call>{\"name\":\"rm_rf\",\"arguments\":{}}</tool_call>",
+		},
+		{
+			name:        "plain answer",
+			text:        `{"city":"Paris"}`,
+			wantContent: `{"city":"Paris"}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			content, calls := Parse(tc.text, tools)
+			require.Equal(t, tc.wantContent, content)
+			require.Len(t, calls, len(tc.wantArgs))
+			for idx, call := range calls {
+				require.Equal(t, "function", call.Type)
+				require.Regexp(t, `^call_[A-Za-z0-9]{24}$`, call.Id)
+				require.Equal(t, "get_weather", call.Function.Name)
+				require.JSONEq(t, tc.wantArgs[idx], call.Function.Arguments.(string))
+			}
+		})
+	}
+}
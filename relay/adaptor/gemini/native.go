@@ -0,0 +1,691 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
+	"github.com/Laisky/one-api/relay/model"
+)
+
+// Native Gemini actions served on /v1beta/models/{model}:{action}.
+const (
+	ActionGenerateContent       = "generateContent"
+	ActionStreamGenerateContent = "streamGenerateContent"
+	ActionCountTokens           = "countTokens"
+	ActionEmbedContent          = "embedContent"
+)
+
+// EmbedContentResponse is the native Gemini embedContent response body.
+type EmbedContentResponse struct {
+	Embedding EmbeddingData `json:"embedding"`
+}
+
+// The Gemini REST API accepts both camelCase and snake_case field names, and
+// the Google GenAI SDKs send camelCase. ChatRequest mixes both spellings in its
+// JSON tags, so inbound payloads are normalized onto those tags before decoding.
+var (
+	nativeRequestKeyAliases = map[string]string{
+		"systemInstruction": "system_instruction",
+		"generationConfig":  "generation_config",
+		"safetySettings":    "safety_settings",
+		"toolConfig":        "tool_config",
+	}
+	nativeToolKeyAliases = map[string]string{
+		"functionDeclarations": "function_declarations",
+	}
+	nativeToolConfigKeyAliases = map[string]string{
+		"functionCallingConfig": "function_calling_config",
+	}
+	nativeFunctionCallingKeyAliases = map[string]string{
+		"allowedFunctionNames": "allowed_function_names",
+	}
+	nativeGenerationConfigKeyAliases = map[string]string{
+		"response_mime_type":  "responseMimeType",
+		"response_schema":     "responseSchema",
+		"top_p":               "topP",
+		"top_k":               "topK",
+		"max_output_tokens":   "maxOutputTokens",
+		"candidate_count":     "candidateCount",
+		"stop_sequences":      "stopSequences",
+		"response_modalities": "responseModalities",
+	}
+	nativePartKeyAliases = map[string]string{
+		"inline_data":       "inlineData",
+		"file_data":         "fileData",
+		"function_call":     "functionCall",
+		"function_response": "functionResponse",
+	}
+	nativeBlobKeyAliases = map[string]string{
+		"mime_type": "mimeType",
+		"file_uri":  "fileUri",
+	}
+	nativeEmbeddingKeyAliases = map[string]string{
+		"task_type":             "taskType",
+		"output_dimensionality": "outputDimensionality",
+	}
+)
+
+// ParseNativeChatRequest decodes a native generateContent/countTokens payload.
+// countTokens bodies that wrap the request in generateContentRequest are unwrapped.
+func ParseNativeChatRequest(body []byte) (*ChatRequest, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, errors.Wrap(err, "unmarshal gemini request")
+	}
+	if inner, ok := firstMapValue(raw, "generateContentRequest", "generate_content_request"); ok {
+		raw = inner
+	}
+
+	renameKeys(raw, nativeRequestKeyAliases)
+	if cfg, ok := raw["generation_config"].(map[string]any); ok {
+		renameKeys(cfg, nativeGenerationConfigKeyAliases)
+	}
+	if toolConfig, ok := raw["tool_config"].(map[string]any); ok {
+		renameKeys(toolConfig, nativeToolConfigKeyAliases)
+		if fcc, ok := toolConfig["function_calling_config"].(map[string]any); ok {
+			renameKeys(fcc, nativeFunctionCallingKeyAliases)
+		}
+	}
+	if tools, ok := raw["tools"].([]any); ok {
+		for _, tool := range tools {
+			if toolMap, ok := tool.(map[string]any); ok {
+				renameKeys(toolMap, nativeToolKeyAliases)
+			}
+		}
+	}
+	if system, ok := raw["system_instruction"].(map[string]any); ok {
+		normalizeNativeContent(system)
+	}
+	if contents, ok := raw["contents"].([]any); ok {
+		for _, content := range contents {
+			if contentMap, ok := content.(map[string]any); ok {
+				normalizeNativeContent(contentMap)
+			}
+		}
+	}
+
+	normalized, err := json.Marshal(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal normalized gemini request")
+	}
+	var request ChatRequest
+	if err := json.Unmarshal(normalized, &request); err != nil {
+		return nil, errors.Wrap(err, "decode gemini request")
+	}
+	return &request, nil
+}
+
+// ParseNativeEmbeddingRequest decodes a native embedContent payload.
+func ParseNativeEmbeddingRequest(body []byte) (*EmbeddingRequest, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, errors.Wrap(err, "unmarshal gemini embedding request")
+	}
+	renameKeys(raw, nativeEmbeddingKeyAliases)
+	if content, ok := raw["content"].(map[string]any); ok {
+		normalizeNativeContent(content)
+	}
+
+	normalized, err := json.Marshal(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal normalized gemini embedding request")
+	}
+	var request EmbeddingRequest
+	if err := json.Unmarshal(normalized, &request); err != nil {
+		return nil, errors.Wrap(err, "decode gemini embedding request")
+	}
+	return &request, nil
+}
+
+// NativeRequestToOpenAI converts a native Gemini chat request into the internal
+// OpenAI-compatible request so it can be served by any channel. Function calls
+// are assigned synthetic ids and paired with later functionResponse parts by name.
+func NativeRequestToOpenAI(request *ChatRequest, modelName string) (*model.GeneralOpenAIRequest, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	out := &model.GeneralOpenAIRequest{Model: modelName}
+
+	if request.SystemInstruction != nil {
+		if text := joinPartText(request.SystemInstruction.Parts); text != "" {
+			out.Messages = append(out.Messages, model.Message{Role: "system", Content: text})
+		}
+	}
+
+	pendingCalls := make(map[string][]string)
+	for contentIdx, content := range request.Contents {
+		if content.Role == "model" {
+			message := model.Message{Role: "assistant"}
+			var text strings.Builder
+			for partIdx, part := range content.Parts {
+				switch {
+				case part.FunctionCall != nil:
+					args, err := json.Marshal(part.FunctionCall.Arguments)
+					if err != nil {
+						return nil, errors.Wrapf(err, "marshal arguments of function call %q", part.FunctionCall.FunctionName)
+					}
+					id := fmt.Sprintf("call_%d_%d", contentIdx, partIdx)
+					pendingCalls[part.FunctionCall.FunctionName] = append(pendingCalls[part.FunctionCall.FunctionName], id)
+					message.ToolCalls = append(message.ToolCalls, model.Tool{
+						Id:   id,
+						Type: "function",
+						Function: &model.Function{
+							Name:      part.FunctionCall.FunctionName,
+							Arguments: string(args),
+						},
+					})
+				case part.Thought:
+					// Prior reasoning is not replayed to non-Gemini upstreams.
+				case part.Text != "":
+					text.WriteString(part.Text)
+				}
+			}
+			if text.Len() > 0 {
+				message.Content = text.String()
+			}
+			out.Messages = append(out.Messages, message)
+			continue
+		}
+
+		var contentParts []model.MessageContent
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				id := fmt.Sprintf("call_%s", name)
+				if ids := pendingCalls[name]; len(ids) > 0 {
+					id, pendingCalls[name] = ids[0], ids[1:]
+				}
+				result, err := json.Marshal(part.FunctionResponse.Response)
+				if err != nil {
+					return nil, errors.Wrapf(err, "marshal response of function %q", name)
+				}
+				out.Messages = append(out.Messages, model.Message{
+					Role:       "tool",
+					ToolCallId: id,
+					Content:    string(result),
+				})
+			case part.InlineData != nil:
+				if !isGeminiImageMimeType(part.InlineData.MimeType) {
+					return nil, errors.Errorf("unsupported inline data mime type %q for this model", part.InlineData.MimeType)
+				}
+				contentParts = append(contentParts, model.MessageContent{
+					Type: model.ContentTypeImageURL,
+					ImageURL: &model.ImageURL{
+						Url: fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data),
+					},
+				})
+			case part.FileData != nil:
+				if !isGeminiImageMimeType(part.FileData.MimeType) {
+					return nil, errors.Errorf("unsupported file data mime type %q for this model", part.FileData.MimeType)
+				}
+				contentParts = append(contentParts, model.MessageContent{
+					Type:     model.ContentTypeImageURL,
+					ImageURL: &model.ImageURL{Url: part.FileData.FileURI},
+				})
+			case part.Text != "":
+				text := part.Text
+				contentParts = append(contentParts, model.MessageContent{Type: model.ContentTypeText, Text: &text})
+			}
+		}
+		if len(contentParts) == 0 {
+			continue
+		}
+		message := model.Message{Role: "user", Content: contentParts}
+		if onlyTextParts(contentParts) {
+			message.Content = joinContentText(contentParts)
+		}
+		out.Messages = append(out.Messages, message)
+	}
+
+	cfg := request.GenerationConfig
+	out.Temperature = cfg.Temperature
+	out.TopP = cfg.TopP
+	if cfg.TopK > 0 {
+		topK := int(cfg.TopK)
+		out.TopK = &topK
+	}
+	out.MaxTokens = cfg.MaxOutputTokens
+	if len(cfg.StopSequences) > 0 {
+		out.Stop = cfg.StopSequences
+	}
+	if cfg.CandidateCount > 1 {
+		n := cfg.CandidateCount
+		out.N = &n
+	}
+	if strings.EqualFold(cfg.ResponseMimeType, "application/json") {
+		if schema, ok := cfg.ResponseSchema.(map[string]any); ok {
+			out.ResponseFormat = &model.ResponseFormat{
+				Type:       "json_schema",
+				JsonSchema: &model.JSONSchema{Name: "response", Schema: schema},
+			}
+		} else {
+			out.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+		}
+	}
+
+	for _, tool := range request.Tools {
+		if tool.FunctionDeclarations == nil {
+			continue
+		}
+		raw, err := json.Marshal(tool.FunctionDeclarations)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal function declarations")
+		}
+		var declarations []struct {
+			Name                 string `json:"name"`
+			Description          string `json:"description"`
+			Parameters           any    `json:"parameters"`
+			ParametersJSONSchema any    `json:"parametersJsonSchema"`
+		}
+		if err := json.Unmarshal(raw, &declarations); err != nil {
+			return nil, errors.Wrap(err, "decode function declarations")
+		}
+		for _, declaration := range declarations {
+			params := declaration.Parameters
+			if params == nil {
+				params = declaration.ParametersJSONSchema
+			}
+			out.Tools = append(out.Tools, model.Tool{
+				Type: "function",
+				Function: &model.Function{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  params,
+				},
+			})
+		}
+	}
+
+	if request.ToolConfig != nil && len(out.Tools) > 0 {
+		fcc := request.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(fcc.Mode) {
+		case "NONE":
+			out.ToolChoice = "none"
+		case "ANY":
+			if len(fcc.AllowedFunctionNames) == 1 {
+				out.ToolChoice = map[string]any{
+					"type":     "function",
+					"function": map[string]any{"name": fcc.AllowedFunctionNames[0]},
+				}
+			} else {
+				out.ToolChoice = "required"
+			}
+		case "AUTO":
+			out.ToolChoice = "auto"
+		}
+	}
+
+	return out, nil
+}
+
+// NativeEmbeddingRequestToOpenAI converts a native embedContent request into the
+// internal OpenAI-compatible embeddings request.
+func NativeEmbeddingRequestToOpenAI(request *EmbeddingRequest, modelName string) (*model.GeneralOpenAIRequest, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	text := joinPartText(request.Content.Parts)
+	if text == "" {
+		return nil, errors.New("embedContent requires text content")
+	}
+	return &model.GeneralOpenAIRequest{
+		Model:      modelName,
+		Input:      text,
+		Dimensions: request.OutputDimensionality,
+	}, nil
+}
+
+// OpenAIResponseToNative converts an OpenAI-compatible chat completion into a
+// native generateContent response.
+func OpenAIResponseToNative(response *openai_compatible.SlimTextResponse, modelName string) *ChatResponse {
+	out := &ChatResponse{ModelVersion: modelName, Candidates: []ChatCandidate{}}
+	if response == nil {
+		return out
+	}
+	for _, choice := range response.Choices {
+		parts := messageToNativeParts(&choice.Message)
+		out.Candidates = append(out.Candidates, ChatCandidate{
+			Content:      ChatContent{Role: "model", Parts: parts},
+			FinishReason: openAIFinishReasonToNative(choice.FinishReason),
+			Index:        int64(choice.Index),
+		})
+	}
+	out.UsageMetadata = usageToNativeMetadata(&response.Usage)
+	return out
+}
+
+// OpenAIEmbeddingToNative extracts the first embedding vector of an OpenAI
+// embeddings response as a native embedContent response.
+func OpenAIEmbeddingToNative(body []byte) (*EmbedContentResponse, error) {
+	var response struct {
+		Data []struct {
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, errors.Wrap(err, "unmarshal embedding response")
+	}
+	if len(response.Data) == 0 {
+		return nil, errors.New("embedding response contains no data")
+	}
+	return &EmbedContentResponse{Embedding: EmbeddingData{Values: response.Data[0].Embedding}}, nil
+}
+
+// UsageFromMetadata maps Gemini usageMetadata into model.Usage. It returns nil
+// when metadata is nil.
+func UsageFromMetadata(metadata *UsageMetadata) *model.Usage {
+	return geminiUsageMetadataToOpenAIUsage(metadata)
+}
+
+// RewriteNativeAction replaces the :action suffix of an upstream Gemini or
+// Vertex AI model URL, so that native requests reuse the adaptor's URL building
+// (API version, project, region, custom base URL). Streaming actions request SSE.
+func RewriteNativeAction(rawURL string, action string, stream bool) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrap(err, "parse upstream url")
+	}
+	idx := strings.LastIndex(parsed.Path, ":")
+	if idx < 0 || idx < strings.LastIndex(parsed.Path, "/") {
+		return "", errors.Errorf("upstream url %q has no model action", parsed.Path)
+	}
+	parsed.Path = parsed.Path[:idx+1] + action
+	parsed.RawPath = ""
+	query := parsed.Query()
+	if stream {
+		query.Set("alt", "sse")
+	} else {
+		query.Del("alt")
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// OpenAIStreamConverter turns OpenAI-compatible chat completion chunks into
+// native streamGenerateContent chunks. Tool call arguments arrive in fragments
+// and are emitted as whole functionCall parts together with the finish reason;
+// the final chunk carries usageMetadata.
+type OpenAIStreamConverter struct {
+	modelName string
+	toolCalls []*streamToolCall
+	final     *ChatResponse
+	usage     *model.Usage
+}
+
+type streamToolCall struct {
+	index int
+	name  string
+	args  strings.Builder
+}
+
+// NewOpenAIStreamConverter creates a converter that stamps modelName onto chunks.
+func NewOpenAIStreamConverter(modelName string) *OpenAIStreamConverter {
+	return &OpenAIStreamConverter{modelName: modelName}
+}
+
+// Convert consumes one upstream chunk and returns the native chunks ready to be
+// sent. The finishing chunk is held back until Finish so that usage can be attached.
+func (s *OpenAIStreamConverter) Convert(chunk *openai_compatible.ChatCompletionsStreamResponse) []*ChatResponse {
+	if chunk == nil {
+		return nil
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+
+	var out []*ChatResponse
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		for _, call := range choice.Delta.ToolCalls {
+			s.appendToolCall(call)
+		}
+
+		var parts []Part
+		if reasoning := messageReasoning(&choice.Delta); reasoning != "" {
+			parts = append(parts, Part{Text: reasoning, Thought: true})
+		}
+		if text := choice.Delta.StringContent(); text != "" {
+			parts = append(parts, Part{Text: text})
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			parts = append(parts, s.flushToolCalls()...)
+			s.final = s.newChunk(parts, openAIFinishReasonToNative(*choice.FinishReason))
+			continue
+		}
+		if len(parts) > 0 {
+			out = append(out, s.newChunk(parts, ""))
+		}
+	}
+	return out
+}
+
+// SetUsage records the authoritative usage computed by the upstream handler.
+func (s *OpenAIStreamConverter) SetUsage(usage *model.Usage) {
+	if usage != nil {
+		s.usage = usage
+	}
+}
+
+// Finish returns the terminal native chunk with finish reason and usage.
+func (s *OpenAIStreamConverter) Finish() *ChatResponse {
+	final := s.final
+	if final == nil {
+		final = s.newChunk(s.flushToolCalls(), "STOP")
+	}
+	s.final = nil
+	final.UsageMetadata = usageToNativeMetadata(s.usage)
+	return final
+}
+
+func (s *OpenAIStreamConverter) appendToolCall(call model.Tool) {
+	index := len(s.toolCalls)
+	if call.Index != nil {
+		index = *call.Index
+	}
+	var pending *streamToolCall
+	for _, existing := range s.toolCalls {
+		if existing.index == index {
+			pending = existing
+			break
+		}
+	}
+	if pending == nil {
+		pending = &streamToolCall{index: index}
+		s.toolCalls = append(s.toolCalls, pending)
+	}
+	if call.Function == nil {
+		return
+	}
+	if call.Function.Name != "" {
+		pending.name = call.Function.Name
+	}
+	if args, ok := call.Function.Arguments.(string); ok {
+		pending.args.WriteString(args)
+	}
+}
+
+func (s *OpenAIStreamConverter) flushToolCalls() []Part {
+	parts := make([]Part, 0, len(s.toolCalls))
+	for _, call := range s.toolCalls {
+		parts = append(parts, Part{FunctionCall: &FunctionCall{
+			FunctionName: call.name,
+			Arguments:    decodeToolArguments(call.args.String()),
+		}})
+	}
+	s.toolCalls = nil
+	return parts
+}
+
+func (s *OpenAIStreamConverter) newChunk(parts []Part, finishReason string) *ChatResponse {
+	if parts == nil {
+		parts = []Part{}
+	}
+	return &ChatResponse{
+		ModelVersion: s.modelName,
+		Candidates: []ChatCandidate{{
+			Content:      ChatContent{Role: "model", Parts: parts},
+			FinishReason: finishReason,
+		}},
+	}
+}
+
+func messageToNativeParts(message *model.Message) []Part {
+	parts := []Part{}
+	if reasoning := messageReasoning(message); reasoning != "" {
+		parts = append(parts, Part{Text: reasoning, Thought: true})
+	}
+	if text := message.StringContent(); text != "" {
+		parts = append(parts, Part{Text: text})
+	}
+	for _, call := range message.ToolCalls {
+		if call.Function == nil {
+			continue
+		}
+		args, _ := call.Function.Arguments.(string)
+		parts = append(parts, Part{FunctionCall: &FunctionCall{
+			FunctionName: call.Function.Name,
+			Arguments:    decodeToolArguments(args),
+		}})
+	}
+	return parts
+}
+
+func messageReasoning(message *model.Message) string {
+	switch {
+	case message.ReasoningContent != nil && *message.ReasoningContent != "":
+		return *message.ReasoningContent
+	case message.Reasoning != nil && *message.Reasoning != "":
+		return *message.Reasoning
+	case message.Thinking != nil && *message.Thinking != "":
+		return *message.Thinking
+	}
+	return ""
+}
+
+func decodeToolArguments(args string) any {
+	if strings.TrimSpace(args) == "" {
+		return map[string]any{}
+	}
+	var decoded any
+	if err := json.Unmarshal([]byte(args), &decoded); err != nil {
+		return args
+	}
+	return decoded
+}
+
+func openAIFinishReasonToNative(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	case "":
+		return ""
+	default:
+		return "STOP"
+	}
+}
+
+func usageToNativeMetadata(usage *model.Usage) *UsageMetadata {
+	if usage == nil || (usage.PromptTokens == 0 && usage.CompletionTokens == 0) {
+		return nil
+	}
+	metadata := &UsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.TotalTokens,
+	}
+	if metadata.TotalTokenCount == 0 {
+		metadata.TotalTokenCount = usage.PromptTokens + usage.CompletionTokens
+	}
+	if usage.PromptTokensDetails != nil {
+		metadata.CachedContentTokenCount = usage.PromptTokensDetails.CachedTokens
+	}
+	if usage.CompletionTokensDetails != nil && usage.CompletionTokensDetails.ReasoningTokens > 0 {
+		reasoning := usage.CompletionTokensDetails.ReasoningTokens
+		metadata.ThoughtsTokenCount = reasoning
+		metadata.CandidatesTokenCount = max(usage.CompletionTokens-reasoning, 0)
+	}
+	return metadata
+}
+
+func normalizeNativeContent(content map[string]any) {
+	parts, ok := content["parts"].([]any)
+	if !ok {
+		return
+	}
+	for _, part := range parts {
+		partMap, ok := part.(map[string]any)
+		if !ok {
+			continue
+		}
+		renameKeys(partMap, nativePartKeyAliases)
+		for _, key := range []string{"inlineData", "fileData"} {
+			if blob, ok := partMap[key].(map[string]any); ok {
+				renameKeys(blob, nativeBlobKeyAliases)
+			}
+		}
+	}
+}
+
+// renameKeys moves values from alias keys to their canonical keys without
+// overwriting a canonical key that is already present.
+func renameKeys(raw map[string]any, aliases map[string]string) {
+	for alias, canonical := range aliases {
+		value, ok := raw[alias]
+		if !ok {
+			continue
+		}
+		delete(raw, alias)
+		if _, exists := raw[canonical]; !exists {
+			raw[canonical] = value
+		}
+	}
+}
+
+func firstMapValue(raw map[string]any, keys ...string) (map[string]any, bool) {
+	for _, key := range keys {
+		if value, ok := raw[key].(map[string]any); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func joinPartText(parts []Part) string {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Text != "" && !part.Thought {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func onlyTextParts(parts []model.MessageContent) bool {
+	for _, part := range parts {
+		if part.Type != model.ContentTypeText {
+			return false
+		}
+	}
+	return true
+}
+
+func joinContentText(parts []model.MessageContent) string {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Text != nil {
+			texts = append(texts, *part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
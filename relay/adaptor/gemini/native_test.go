@@ -0,0 +1,138 @@
+package gemini
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
+	"github.com/Laisky/one-api/relay/model"
+)
+
+func TestParseNativeChatRequest_NormalizesCamelCase(t *testing.T) {
+	body := []byte(`{
+		"systemInstruction": {"parts": [{"text": "be brief"}]},
+		"contents": [
+			{"role": "user", "parts": [{"text": "weather?"}, {"inline_data": {"mime_type": "image/png", "data": "AAAA"}}]},
+			{"role": "model", "parts": [{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}]},
+			{"role": "user", "parts": [{"functionResponse": {"name": "get_weather", "response": {"temp": 21}}}]}
+		],
+		"generationConfig": {"temperature": 0.2, "max_output_tokens": 64, "responseMimeType": "application/json"},
+		"tools": [{"functionDeclarations": [{"name": "get_weather", "parameters": {"type": "object"}}]}],
+		"toolConfig": {"functionCallingConfig": {"mode": "ANY", "allowedFunctionNames": ["get_weather"]}}
+	}`)
+
+	request, err := ParseNativeChatRequest(body)
+	require.NoError(t, err)
+	require.NotNil(t, request.SystemInstruction)
+	require.Len(t, request.Contents, 3)
+	require.NotNil(t, request.Contents[0].Parts[1].InlineData)
+	require.Equal(t, "image/png", request.Contents[0].Parts[1].InlineData.MimeType)
+	require.Equal(t, 64, request.GenerationConfig.MaxOutputTokens)
+	require.NotNil(t, request.ToolConfig)
+	require.Equal(t, []string{"get_weather"}, request.ToolConfig.FunctionCallingConfig.AllowedFunctionNames)
+
+	chat, err := NativeRequestToOpenAI(request, "gpt-4o")
+	require.NoError(t, err)
+	require.Equal(t, "gpt-4o", chat.Model)
+	require.Len(t, chat.Messages, 4)
+	require.Equal(t, "system", chat.Messages[0].Role)
+	require.Equal(t, "assistant", chat.Messages[2].Role)
+	require.Len(t, chat.Messages[2].ToolCalls, 1)
+	require.Equal(t, "tool", chat.Messages[3].Role)
+	require.Equal(t, chat.Messages[2].ToolCalls[0].Id, chat.Messages[3].ToolCallId)
+	require.Equal(t, `{"temp":21}`, chat.Messages[3].Content)
+	require.Equal(t, 64, chat.MaxTokens)
+	require.Equal(t, "json_object", chat.ResponseFormat.Type)
+	require.Len(t, chat.Tools, 1)
+	require.Equal(t, map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}}, chat.ToolChoice)
+}
+
+func TestParseNativeChatRequest_UnwrapsCountTokensRequest(t *testing.T) {
+	request, err := ParseNativeChatRequest([]byte(`{"generateContentRequest": {"model": "models/x", "contents": [{"role": "user", "parts": [{"text": "hi"}]}]}}`))
+	require.NoError(t, err)
+	require.Len(t, request.Contents, 1)
+	require.Equal(t, "hi", request.Contents[0].Parts[0].Text)
+}
+
+func TestOpenAIResponseToNative(t *testing.T) {
+	reasoning := "thinking"
+	resp := OpenAIResponseToNative(&openai_compatible.SlimTextResponse{
+		Choices: []openai_compatible.TextResponseChoice{{
+			Message: model.Message{
+				Role:             "assistant",
+				Content:          "hello",
+				ReasoningContent: &reasoning,
+				ToolCalls: []model.Tool{{
+					Type:     "function",
+					Function: &model.Function{Name: "lookup", Arguments: `{"q":"x"}`},
+				}},
+			},
+			FinishReason: "length",
+		}},
+		Usage: model.Usage{
+			PromptTokens:            10,
+			CompletionTokens:        8,
+			TotalTokens:             18,
+			CompletionTokensDetails: &model.UsageCompletionTokensDetails{ReasoningTokens: 3},
+		},
+	}, "gemini-2.5-flash")
+
+	require.Len(t, resp.Candidates, 1)
+	parts := resp.Candidates[0].Content.Parts
+	require.Len(t, parts, 3)
+	require.True(t, parts[0].Thought)
+	require.Equal(t, "hello", parts[1].Text)
+	require.Equal(t, "lookup", parts[2].FunctionCall.FunctionName)
+	require.Equal(t, map[string]any{"q": "x"}, parts[2].FunctionCall.Arguments)
+	require.Equal(t, "MAX_TOKENS", resp.Candidates[0].FinishReason)
+	require.Equal(t, 5, resp.UsageMetadata.CandidatesTokenCount)
+	require.Equal(t, 3, resp.UsageMetadata.ThoughtsTokenCount)
+	require.Equal(t, 18, resp.UsageMetadata.TotalTokenCount)
+}
+
+func TestOpenAIStreamConverter_AccumulatesToolCalls(t *testing.T) {
+	converter := NewOpenAIStreamConverter("gemini-2.5-flash")
+	index := 0
+	stop := "tool_calls"
+
+	out := converter.Convert(&openai_compatible.ChatCompletionsStreamResponse{
+		Choices: []openai_compatible.ChatCompletionsStreamResponseChoice{{Delta: model.Message{Content: "hi"}}},
+	})
+	require.Len(t, out, 1)
+	require.Equal(t, "hi", out[0].Candidates[0].Content.Parts[0].Text)
+
+	out = converter.Convert(&openai_compatible.ChatCompletionsStreamResponse{
+		Choices: []openai_compatible.ChatCompletionsStreamResponseChoice{{Delta: model.Message{ToolCalls: []model.Tool{{
+			Index: &index, Function: &model.Function{Name: "lookup", Arguments: `{"q":`},
+		}}}}},
+	})
+	require.Empty(t, out)
+	out = converter.Convert(&openai_compatible.ChatCompletionsStreamResponse{
+		Choices: []openai_compatible.ChatCompletionsStreamResponseChoice{{
+			Delta:        model.Message{ToolCalls: []model.Tool{{Index: &index, Function: &model.Function{Arguments: `"x"}`}}}},
+			FinishReason: &stop,
+		}},
+	})
+	require.Empty(t, out)
+
+	converter.SetUsage(&model.Usage{PromptTokens: 4, CompletionTokens: 2, TotalTokens: 6})
+	final := converter.Finish()
+	require.Equal(t, "STOP", final.Candidates[0].FinishReason)
+	require.Len(t, final.Candidates[0].Content.Parts, 1)
+	require.Equal(t, map[string]any{"q": "x"}, final.Candidates[0].Content.Parts[0].FunctionCall.Arguments)
+	require.Equal(t, 6, final.UsageMetadata.TotalTokenCount)
+}
+
+func TestRewriteNativeAction(t *testing.T) {
+	got, err := RewriteNativeAction("https://example.com/v1beta/models/gemini-2.5-flash:generateContent", ActionStreamGenerateContent, true)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse", got)
+
+	got, err = RewriteNativeAction("https://example.com/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse", ActionCountTokens, false)
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/v1beta/models/gemini-2.5-flash:countTokens", got)
+
+	_, err = RewriteNativeAction("https://example.com/v1/chat/completions", ActionCountTokens, false)
+	require.Error(t, err)
+}
@@ -0,0 +1,297 @@
+// Package mock implements the Mock channel type, an in-process upstream that
+// synthesizes responses instead of calling a provider. It lets one-api run end
+// to end without real credentials, so the regression harness and CI can
+// exercise retries, suspension, billing and failover deterministically.
+//
+// The channel's config.mock block selects the wire format the mock answers
+// in: openai (Chat Completions), claude (Anthropic Messages) or gemini
+// (generateContent). Requests are converted and responses are parsed by the
+// same code as the real OpenAI-compatible, Anthropic and Gemini adaptors; only
+// the network round trip is replaced.
+//
+// Replies echo the last user message unless a fixed content is configured.
+// When the request offers tools, the mock calls one of them with arguments
+// built from its schema; a structured-output request gets a JSON object built
+// from the response schema. Usage counts the prompt as the relay did and the
+// reply with the model's tokenizer. Latency, per-chunk delays and faults
+// (429, 500, timeouts, malformed bodies) are configurable.
+package mock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/tracing"
+	dbmodel "github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/adaptor"
+	"github.com/Laisky/one-api/relay/adaptor/anthropic"
+	"github.com/Laisky/one-api/relay/adaptor/gemini"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
+	"github.com/Laisky/one-api/relay/meta"
+	"github.com/Laisky/one-api/relay/model"
+)
+
+type Adaptor struct {
+	adaptor.DefaultPricingMethods
+	config dbmodel.MockChannelConfig
+}
+
+func (a *Adaptor) Init(meta *meta.Meta) {
+	if meta != nil && meta.Config.Mock != nil {
+		a.config = *meta.Config.Mock
+	}
+}
+
+func (a *Adaptor) format() string {
+	return a.config.MockFormat()
+}
+
+// GetRequestURL returns a mock:// URL naming the format and the endpoint the
+// real provider would be called on. It is only recorded in logs and traces.
+func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	switch a.format() {
+	case dbmodel.MockFormatClaude:
+		return "mock://claude/v1/messages", nil
+	case dbmodel.MockFormatGemini:
+		action := "generateContent"
+		if meta.IsStream {
+			action = "streamGenerateContent?alt=sse"
+		}
+		return fmt.Sprintf("mock://gemini/v1beta/models/%s:%s", meta.ActualModelName, action), nil
+	default:
+		return "mock://openai/v1/chat/completions", nil
+	}
+}
+
+// SetupRequestHeader is a no-op: nothing leaves the process.
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	switch a.format() {
+	case dbmodel.MockFormatClaude:
+		return (&anthropic.Adaptor{}).ConvertRequest(c, relayMode, request)
+	case dbmodel.MockFormatGemini:
+		return (&gemini.Adaptor{}).ConvertRequest(c, relayMode, request)
+	default:
+		return request, nil
+	}
+}
+
+func (a *Adaptor) ConvertImageRequest(c *gin.Context, request *model.ImageRequest) (any, error) {
+	return nil, errors.New("mock channel does not support image generation")
+}
+
+// ConvertClaudeRequest passes Claude Messages requests through in the claude
+// format and converts them like the OpenAI-compatible or Gemini adaptors do
+// otherwise.
+func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, request *model.ClaudeRequest) (any, error) {
+	switch a.format() {
+	case dbmodel.MockFormatClaude:
+		return (&anthropic.Adaptor{}).ConvertClaudeRequest(c, request)
+	case dbmodel.MockFormatGemini:
+		return (&gemini.Adaptor{}).ConvertClaudeRequest(c, request)
+	default:
+		return openai_compatible.ConvertClaudeRequest(c, request)
+	}
+}
+
+// DoRequest answers the converted request in-process, after the configured
+// latency, and injects the configured fault.
+func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
+	fullRequestURL, err := a.GetRequestURL(meta)
+	if err != nil {
+		return nil, errors.Wrap(err, "get request url failed")
+	}
+	meta.UpstreamRequestURL = fullRequestURL
+
+	var body []byte
+	if requestBody != nil {
+		if body, err = io.ReadAll(requestBody); err != nil {
+			return nil, errors.Wrap(err, "read mock request body")
+		}
+	}
+	tracing.RecordTraceTimestamp(c, dbmodel.TimestampRequestForwarded)
+	c.Set(ctxkey.UpstreamRequestPossiblyForwarded, true)
+
+	resp, err := a.serve(gmw.Ctx(c), meta, body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "upstream request failed for channel mock (id: %d)", meta.ChannelId)
+	}
+	tracing.RecordTraceTimestamp(c, dbmodel.TimestampFirstUpstreamResponse)
+	return resp, nil
+}
+
+// serve builds the upstream response for body.
+func (a *Adaptor) serve(ctx context.Context, meta *meta.Meta, body []byte) (*http.Response, error) {
+	fault := pickFault(&a.config, meta.ChannelId)
+	if err := sleep(ctx, time.Duration(a.config.LatencyMs)*time.Millisecond); err != nil {
+		return nil, err
+	}
+
+	format := a.format()
+	switch fault {
+	case dbmodel.MockFaultRateLimit:
+		resp := newResponse(http.StatusTooManyRequests, "application/json", errorBody(format, http.StatusTooManyRequests, "mock rate limit exceeded"))
+		resp.Header.Set("Retry-After", "1")
+		return resp, nil
+	case dbmodel.MockFaultServerError:
+		return newResponse(http.StatusInternalServerError, "application/json", errorBody(format, http.StatusInternalServerError, "mock upstream server error")), nil
+	case dbmodel.MockFaultTimeout:
+		wait := timeoutDuration()
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+		return nil, errors.Wrapf(os.ErrDeadlineExceeded, "mock upstream did not answer within %s", wait)
+	}
+
+	var (
+		req *request
+		err error
+	)
+	switch format {
+	case dbmodel.MockFormatClaude:
+		req, err = parseClaudeRequest(body)
+	case dbmodel.MockFormatGemini:
+		req, err = parseGeminiRequest(body)
+	default:
+		req, err = parseOpenAIRequest(body)
+	}
+	if err != nil {
+		return newResponse(http.StatusBadRequest, "application/json", errorBody(format, http.StatusBadRequest, err.Error())), nil
+	}
+	r := newReply(req, &a.config, meta.ActualModelName, meta.PromptTokens, func(text string) int {
+		return openai.CountTokenText(text, meta.ActualModelName)
+	})
+	malformed := fault == dbmodel.MockFaultMalformedSSE
+
+	if !meta.IsStream {
+		var payload []byte
+		switch format {
+		case dbmodel.MockFormatClaude:
+			payload = r.claudeBody()
+		case dbmodel.MockFormatGemini:
+			payload = r.geminiBody()
+		default:
+			payload = r.openAIBody()
+		}
+		if malformed {
+			payload = payload[:len(payload)/2]
+		}
+		return newResponse(http.StatusOK, "application/json", payload), nil
+	}
+
+	var events []string
+	switch format {
+	case dbmodel.MockFormatClaude:
+		events = r.claudeEvents()
+	case dbmodel.MockFormatGemini:
+		events = r.geminiEvents()
+	default:
+		events = r.openAIEvents()
+	}
+	if malformed {
+		// One valid event, then a truncated one, and the stream ends without
+		// its terminator.
+		events = append(events[:1], "data: {\"malformed\": \n\n")
+	}
+	return a.streamResponse(ctx, events), nil
+}
+
+// streamResponse sends events through a pipe, waiting chunk_delay_ms between
+// them, so clients observe real streaming.
+func (a *Adaptor) streamResponse(ctx context.Context, events []string) *http.Response {
+	reader, writer := io.Pipe()
+	delay := time.Duration(a.config.ChunkDelayMs) * time.Millisecond
+	go func() {
+		for i, event := range events {
+			if i > 0 {
+				if err := sleep(ctx, delay); err != nil {
+					_ = writer.CloseWithError(err)
+					return
+				}
+			}
+			if _, err := writer.Write([]byte(event)); err != nil {
+				return
+			}
+		}
+		_ = writer.Close()
+	}()
+
+	resp := newResponse(http.StatusOK, "text/event-stream", nil)
+	resp.Body = reader
+	return resp
+}
+
+func newResponse(status int, contentType string, body []byte) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", contentType)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	switch a.format() {
+	case dbmodel.MockFormatClaude:
+		return (&anthropic.Adaptor{}).DoResponse(c, resp, meta)
+	case dbmodel.MockFormatGemini:
+		return (&gemini.Adaptor{}).DoResponse(c, resp, meta)
+	default:
+		return openai_compatible.HandleClaudeMessagesResponse(c, resp, meta, func(c *gin.Context, resp *http.Response, promptTokens int, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+			if meta.IsStream {
+				return openai_compatible.StreamHandler(c, resp, promptTokens, modelName)
+			}
+			return openai_compatible.Handler(c, resp, promptTokens, modelName)
+		})
+	}
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return adaptor.GetModelListFromPricing(ModelRatios)
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return "mock"
+}
+
+// GetDefaultModelPricing returns the pricing of the default mock models.
+func (a *Adaptor) GetDefaultModelPricing() map[string]adaptor.ModelConfig {
+	return ModelRatios
+}
+
+func (a *Adaptor) GetModelRatio(modelName string) float64 {
+	if price, exists := ModelRatios[modelName]; exists {
+		return price.Ratio
+	}
+	return a.DefaultPricingMethods.GetModelRatio(modelName)
+}
+
+func (a *Adaptor) GetCompletionRatio(modelName string) float64 {
+	if price, exists := ModelRatios[modelName]; exists {
+		return price.CompletionRatio
+	}
+	return a.DefaultPricingMethods.GetCompletionRatio(modelName)
+}
@@ -0,0 +1,277 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common/config"
+	dbmodel "github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/apitype"
+	"github.com/Laisky/one-api/relay/channeltype"
+	"github.com/Laisky/one-api/relay/meta"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+const weatherTool = `{"type":"function","function":{"name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"},"unit":{"type":"string","enum":["celsius","fahrenheit"]}},"required":["city"]}}}`
+
+// newMockContext returns a relay context backed by a throwaway trace database,
+// which DoRequest records upstream timestamps in.
+func newMockContext(t *testing.T) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	prev := dbmodel.DB
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&dbmodel.Trace{}))
+	dbmodel.DB = db
+	t.Cleanup(func() { dbmodel.DB = prev })
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c, recorder
+}
+
+func newMockMeta(cfg *dbmodel.MockChannelConfig, stream bool) *meta.Meta {
+	return &meta.Meta{
+		Mode:            relaymode.ChatCompletions,
+		ChannelType:     channeltype.Mock,
+		ChannelId:       1,
+		APIType:         apitype.Mock,
+		Config:          dbmodel.ChannelConfig{Mock: cfg},
+		IsStream:        stream,
+		ActualModelName: "mock-chat",
+		PromptTokens:    7,
+		RequestURLPath:  "/v1/chat/completions",
+	}
+}
+
+func TestChannelTypeMapsToMockAPIType(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, apitype.Mock, channeltype.ToAPIType(channeltype.Mock))
+	require.Equal(t, "mock", channeltype.IdToName(channeltype.Mock))
+}
+
+func TestOpenAIFormatEchoesAndReportsUsage(t *testing.T) {
+	c, recorder := newMockContext(t)
+	m := newMockMeta(nil, false)
+	a := &Adaptor{}
+	a.Init(m)
+
+	resp, err := a.DoRequest(c, m, strings.NewReader(`{"model":"mock-chat","messages":[{"role":"user","content":"hello mock"}]}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "mock://openai/v1/chat/completions", m.UpstreamRequestURL)
+
+	usage, bizErr := a.DoResponse(c, resp, m)
+	require.Nil(t, bizErr)
+	require.Equal(t, 7, usage.PromptTokens)
+	require.Positive(t, usage.CompletionTokens)
+
+	var body struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, "hello mock", body.Choices[0].Message.Content)
+}
+
+func TestOpenAIFormatStreamsToolCall(t *testing.T) {
+	c, recorder := newMockContext(t)
+	m := newMockMeta(&dbmodel.MockChannelConfig{ChunkDelayMs: 1}, true)
+	a := &Adaptor{}
+	a.Init(m)
+
+	resp, err := a.DoRequest(c, m, strings.NewReader(`{"model":"mock-chat","stream":true,"messages":[{"role":"user","content":"weather?"}],"tools":[`+weatherTool+`]}`))
+	require.NoError(t, err)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	usage, bizErr := a.DoResponse(c, resp, m)
+	require.Nil(t, bizErr)
+	require.Equal(t, 7, usage.PromptTokens)
+	require.Positive(t, usage.CompletionTokens)
+
+	out := recorder.Body.String()
+	require.Contains(t, out, `"name":"get_weather"`)
+	require.Contains(t, out, `"finish_reason":"tool_calls"`)
+	require.Contains(t, out, "data: [DONE]")
+
+	// The argument deltas concatenate into arguments that satisfy the schema.
+	var arguments strings.Builder
+	for line := range strings.SplitSeq(out, "\n") {
+		payload, ok := strings.CutPrefix(line, "data: ")
+		if !ok || payload == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					ToolCalls []struct {
+						Function struct {
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(payload), &chunk))
+		for _, choice := range chunk.Choices {
+			for _, call := range choice.Delta.ToolCalls {
+				arguments.WriteString(call.Function.Arguments)
+			}
+		}
+	}
+	require.JSONEq(t, `{"city":"mock","unit":"celsius"}`, arguments.String())
+}
+
+func TestToolResultGetsTextAnswer(t *testing.T) {
+	req, err := parseOpenAIRequest([]byte(`{"messages":[
+		{"role":"user","content":"weather?"},
+		{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"sunny"}],
+		"tools":[` + weatherTool + `]}`))
+	require.NoError(t, err)
+	require.Nil(t, req.toolToCall())
+	require.Equal(t, "weather?", req.replyText(""))
+}
+
+func TestClaudeFormatStreamsUsage(t *testing.T) {
+	c, recorder := newMockContext(t)
+	m := newMockMeta(&dbmodel.MockChannelConfig{Format: dbmodel.MockFormatClaude, Content: "fixed reply"}, true)
+	a := &Adaptor{}
+	a.Init(m)
+
+	resp, err := a.DoRequest(c, m, strings.NewReader(`{"model":"mock-chat","stream":true,"max_tokens":64,"messages":[{"role":"user","content":[{"type":"text","text":"hi"}]}]}`))
+	require.NoError(t, err)
+	usage, bizErr := a.DoResponse(c, resp, m)
+	require.Nil(t, bizErr)
+	require.Equal(t, 7, usage.PromptTokens)
+	require.Positive(t, usage.CompletionTokens)
+	require.Contains(t, recorder.Body.String(), "fixed")
+}
+
+func TestGeminiFormatStructuredOutput(t *testing.T) {
+	c, recorder := newMockContext(t)
+	m := newMockMeta(&dbmodel.MockChannelConfig{Format: dbmodel.MockFormatGemini}, false)
+	a := &Adaptor{}
+	a.Init(m)
+
+	resp, err := a.DoRequest(c, m, strings.NewReader(`{"contents":[{"role":"user","parts":[{"text":"classify"}]}],
+		"generation_config":{"responseMimeType":"application/json","responseSchema":{"type":"object","properties":{"topic":{"type":"string"},"confidence":{"type":"number","minimum":0,"maximum":1}}}}}`))
+	require.NoError(t, err)
+	require.Contains(t, m.UpstreamRequestURL, "mock://gemini/v1beta/models/mock-chat:generateContent")
+	usage, bizErr := a.DoResponse(c, resp, m)
+	require.Nil(t, bizErr)
+	require.Equal(t, 7, usage.PromptTokens)
+
+	var body struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.JSONEq(t, `{"topic":"mock","confidence":0.5}`, body.Choices[0].Message.Content)
+}
+
+func TestFaultInjection(t *testing.T) {
+	body := `{"model":"mock-chat","messages":[{"role":"user","content":"hi"}]}`
+
+	t.Run("rate limit every second request", func(t *testing.T) {
+		c, _ := newMockContext(t)
+		m := newMockMeta(&dbmodel.MockChannelConfig{Fault: dbmodel.MockFaultRateLimit, FaultEvery: 2}, false)
+		m.ChannelId = 1001
+		a := &Adaptor{}
+		a.Init(m)
+
+		var statuses []int
+		for range 4 {
+			resp, err := a.DoRequest(c, m, strings.NewReader(body))
+			require.NoError(t, err)
+			statuses = append(statuses, resp.StatusCode)
+		}
+		require.Equal(t, []int{200, 429, 200, 429}, statuses)
+	})
+
+	t.Run("claude server error", func(t *testing.T) {
+		c, _ := newMockContext(t)
+		m := newMockMeta(&dbmodel.MockChannelConfig{Format: dbmodel.MockFormatClaude, Fault: dbmodel.MockFaultServerError}, false)
+		a := &Adaptor{}
+		a.Init(m)
+
+		resp, err := a.DoRequest(c, m, strings.NewReader(body))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		raw, _ := io.ReadAll(resp.Body)
+		require.JSONEq(t, `{"type":"error","error":{"type":"api_error","message":"mock upstream server error"}}`, string(raw))
+	})
+
+	t.Run("malformed stream", func(t *testing.T) {
+		c, _ := newMockContext(t)
+		m := newMockMeta(&dbmodel.MockChannelConfig{Fault: dbmodel.MockFaultMalformedSSE}, true)
+		a := &Adaptor{}
+		a.Init(m)
+
+		resp, err := a.DoRequest(c, m, strings.NewReader(body))
+		require.NoError(t, err)
+		raw, _ := io.ReadAll(resp.Body)
+		require.True(t, bytes.HasSuffix(raw, []byte("data: {\"malformed\": \n\n")))
+		require.NotContains(t, string(raw), "[DONE]")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		original := config.RelayTimeout
+		config.RelayTimeout = 1
+		t.Cleanup(func() { config.RelayTimeout = original })
+
+		c, _ := newMockContext(t)
+		m := newMockMeta(&dbmodel.MockChannelConfig{Fault: dbmodel.MockFaultTimeout}, false)
+		a := &Adaptor{}
+		a.Init(m)
+
+		_, err := a.DoRequest(c, m, strings.NewReader(body))
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	})
+}
+
+func TestSampleFromSchema(t *testing.T) {
+	t.Parallel()
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"object","properties":{
+		"name":{"type":"string"},
+		"count":{"type":"integer","minimum":3},
+		"tags":{"type":"array","items":{"type":"string","enum":["a","b"]}},
+		"ok":{"type":"boolean"},
+		"nested":{"anyOf":[{"type":"object","properties":{"x":{"type":"number"}}},{"type":"null"}]}}}`), &schema))
+	raw, err := json.Marshal(sampleFromSchema(schema))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"name":"mock","count":3,"tags":["a"],"ok":true,"nested":{"x":0.5}}`, string(raw))
+}
+
+func TestValidateMockConfig(t *testing.T) {
+	t.Parallel()
+	require.NoError(t, (&dbmodel.MockChannelConfig{Format: "Claude", Fault: dbmodel.MockFaultTimeout, FaultRate: 0.5}).Validate())
+	require.Error(t, (&dbmodel.MockChannelConfig{Format: "cohere"}).Validate())
+	require.Error(t, (&dbmodel.MockChannelConfig{Fault: "explode"}).Validate())
+	require.Error(t, (&dbmodel.MockChannelConfig{FaultRate: 1.5}).Validate())
+
+	channel := &dbmodel.Channel{Type: channeltype.OpenAI, Config: `{"mock":{"format":"openai"}}`}
+	require.Error(t, channel.ValidateMockConfig())
+	channel.Type = channeltype.Mock
+	require.NoError(t, channel.ValidateMockConfig())
+}
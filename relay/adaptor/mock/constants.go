@@ -0,0 +1,35 @@
+package mock
+
+import (
+	"github.com/Laisky/one-api/relay/adaptor"
+	"github.com/Laisky/one-api/relay/billing/ratio"
+)
+
+// mockFeatures lists what the mock synthesizes for every model.
+var mockFeatures = []string{"tools", "json_mode", "structured_outputs"}
+
+// ModelRatios prices the default mock models. The prices are round numbers so
+// billing assertions are easy to compute; a Mock channel also serves any other
+// model name it is configured with, at the default price.
+var ModelRatios = map[string]adaptor.ModelConfig{
+	"mock-chat": {
+		Ratio:             1 * ratio.MilliTokensUsd,
+		CompletionRatio:   2,
+		ContextLength:     128000,
+		MaxOutputTokens:   16384,
+		InputModalities:   []string{"text"},
+		OutputModalities:  []string{"text"},
+		SupportedFeatures: mockFeatures,
+		Description:       "Offline mock model that echoes the last user message; priced at $1/M input and $2/M output tokens.",
+	},
+	"mock-chat-large": {
+		Ratio:             10 * ratio.MilliTokensUsd,
+		CompletionRatio:   3,
+		ContextLength:     1000000,
+		MaxOutputTokens:   65536,
+		InputModalities:   []string{"text"},
+		OutputModalities:  []string{"text"},
+		SupportedFeatures: mockFeatures,
+		Description:       "Offline mock model that echoes the last user message; priced at $10/M input and $30/M output tokens.",
+	},
+}
@@ -0,0 +1,63 @@
+package mock
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/one-api/common/config"
+	dbmodel "github.com/Laisky/one-api/model"
+)
+
+// defaultTimeout is how long the timeout fault waits when RELAY_TIMEOUT is unset.
+const defaultTimeout = 30 * time.Second
+
+// requestCounters counts requests per channel id for fault_every.
+var requestCounters sync.Map
+
+// pickFault returns the fault to inject into this request, or "".
+func pickFault(cfg *dbmodel.MockChannelConfig, channelID int) string {
+	fault := strings.TrimSpace(cfg.Fault)
+	if fault == "" {
+		return ""
+	}
+	switch {
+	case cfg.FaultEvery > 0:
+		value, _ := requestCounters.LoadOrStore(channelID, new(atomic.Int64))
+		if value.(*atomic.Int64).Add(1)%int64(cfg.FaultEvery) != 0 {
+			return ""
+		}
+	case cfg.FaultRate > 0 && cfg.FaultRate < 1:
+		if rand.Float64() >= cfg.FaultRate {
+			return ""
+		}
+	}
+	return fault
+}
+
+// timeoutDuration is how long the timeout fault keeps the request waiting:
+// the relay's upstream timeout, as a real unresponsive upstream would.
+func timeoutDuration() time.Duration {
+	if config.RelayTimeout > 0 {
+		return time.Duration(config.RelayTimeout) * time.Second
+	}
+	return defaultTimeout
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
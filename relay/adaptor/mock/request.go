@@ -0,0 +1,351 @@
+package mock
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// maxEchoLength caps how much of the last user message an echo reply repeats.
+const maxEchoLength = 200
+
+// tool is a function the request offers to the model.
+type tool struct {
+	Name   string
+	Schema map[string]any
+}
+
+// request is the part of an upstream request the mock needs to answer it,
+// decoded from any of the three wire formats.
+type request struct {
+	// LastUserText is the text of the last user message.
+	LastUserText string
+	// Tools are the functions the request offers.
+	Tools []tool
+	// ForcedTool is the tool the request requires, if any.
+	ForcedTool string
+	// ToolsDisabled is set when the request forbids tool calls.
+	ToolsDisabled bool
+	// AfterToolResult is set when the last message carries a tool result.
+	AfterToolResult bool
+	// ResponseSchema is the JSON schema the reply must follow, if any.
+	ResponseSchema map[string]any
+	// JSONMode asks for a JSON object without a schema.
+	JSONMode bool
+}
+
+// toolToCall returns the tool the reply calls, or nil for a text reply. A tool
+// is called whenever tools are offered, unless the request forbids it or the
+// last message already answers a tool call.
+func (r *request) toolToCall() *tool {
+	if r.ToolsDisabled || r.AfterToolResult || len(r.Tools) == 0 {
+		return nil
+	}
+	for i := range r.Tools {
+		if r.ForcedTool != "" && r.Tools[i].Name == r.ForcedTool {
+			return &r.Tools[i]
+		}
+	}
+	return &r.Tools[0]
+}
+
+// replyText returns the assistant text for a text reply.
+func (r *request) replyText(content string) string {
+	switch {
+	case r.ResponseSchema != nil:
+		raw, _ := json.Marshal(sampleFromSchema(r.ResponseSchema))
+		return string(raw)
+	case r.JSONMode:
+		raw, _ := json.Marshal(map[string]string{"content": r.echo(content)})
+		return string(raw)
+	default:
+		return r.echo(content)
+	}
+}
+
+func (r *request) echo(content string) string {
+	if content != "" {
+		return content
+	}
+	text := strings.TrimSpace(r.LastUserText)
+	if text == "" {
+		return "This is a mock response."
+	}
+	if runes := []rune(text); len(runes) > maxEchoLength {
+		text = string(runes[:maxEchoLength])
+	}
+	return text
+}
+
+type openAIRequest struct {
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Tools []struct {
+		Function struct {
+			Name       string         `json:"name"`
+			Parameters map[string]any `json:"parameters"`
+		} `json:"function"`
+	} `json:"tools"`
+	ToolChoice     json.RawMessage `json:"tool_choice"`
+	ResponseFormat *struct {
+		Type       string `json:"type"`
+		JSONSchema *struct {
+			Schema map[string]any `json:"schema"`
+		} `json:"json_schema"`
+	} `json:"response_format"`
+}
+
+// parseOpenAIRequest decodes a Chat Completions request.
+func parseOpenAIRequest(body []byte) (*request, error) {
+	var raw openAIRequest
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, errors.Wrap(err, "decode chat completions request")
+	}
+	req := &request{}
+	for i, message := range raw.Messages {
+		if message.Role == "user" {
+			req.LastUserText = contentText(message.Content)
+		}
+		if i == len(raw.Messages)-1 {
+			req.AfterToolResult = message.Role == "tool" || message.Role == "function"
+		}
+	}
+	for _, t := range raw.Tools {
+		req.Tools = append(req.Tools, tool{Name: t.Function.Name, Schema: t.Function.Parameters})
+	}
+	var choice string
+	if json.Unmarshal(raw.ToolChoice, &choice) == nil {
+		req.ToolsDisabled = choice == "none"
+	} else {
+		var named struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		}
+		if json.Unmarshal(raw.ToolChoice, &named) == nil {
+			req.ForcedTool = named.Function.Name
+		}
+	}
+	if format := raw.ResponseFormat; format != nil {
+		switch {
+		case format.Type == "json_schema" && format.JSONSchema != nil && format.JSONSchema.Schema != nil:
+			req.ResponseSchema = format.JSONSchema.Schema
+		case format.Type == "json_object" || format.Type == "json_schema":
+			req.JSONMode = true
+		}
+	}
+	return req, nil
+}
+
+type claudeRequest struct {
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Tools []struct {
+		Name        string         `json:"name"`
+		InputSchema map[string]any `json:"input_schema"`
+	} `json:"tools"`
+	ToolChoice *struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"tool_choice"`
+}
+
+// parseClaudeRequest decodes an Anthropic Messages request.
+func parseClaudeRequest(body []byte) (*request, error) {
+	var raw claudeRequest
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, errors.Wrap(err, "decode claude messages request")
+	}
+	req := &request{}
+	for i, message := range raw.Messages {
+		var blocks []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		_ = json.Unmarshal(message.Content, &blocks)
+		hasToolResult := false
+		for _, block := range blocks {
+			hasToolResult = hasToolResult || block.Type == "tool_result"
+		}
+		if message.Role == "user" {
+			if text := contentText(message.Content); text != "" || !hasToolResult {
+				req.LastUserText = text
+			}
+		}
+		if i == len(raw.Messages)-1 {
+			req.AfterToolResult = hasToolResult
+		}
+	}
+	for _, t := range raw.Tools {
+		if t.Name != "" {
+			req.Tools = append(req.Tools, tool{Name: t.Name, Schema: t.InputSchema})
+		}
+	}
+	if choice := raw.ToolChoice; choice != nil {
+		req.ToolsDisabled = choice.Type == "none"
+		if choice.Type == "tool" {
+			req.ForcedTool = choice.Name
+		}
+	}
+	return req, nil
+}
+
+type geminiRequest struct {
+	Contents []struct {
+		Role  string `json:"role"`
+		Parts []struct {
+			Text             string          `json:"text"`
+			FunctionResponse json.RawMessage `json:"functionResponse"`
+		} `json:"parts"`
+	} `json:"contents"`
+	Tools []struct {
+		FunctionDeclarations []struct {
+			Name       string         `json:"name"`
+			Parameters map[string]any `json:"parameters"`
+		} `json:"function_declarations"`
+	} `json:"tools"`
+	ToolConfig *struct {
+		FunctionCallingConfig struct {
+			Mode                 string   `json:"mode"`
+			AllowedFunctionNames []string `json:"allowed_function_names"`
+		} `json:"function_calling_config"`
+	} `json:"tool_config"`
+	GenerationConfig struct {
+		ResponseMimeType string         `json:"responseMimeType"`
+		ResponseSchema   map[string]any `json:"responseSchema"`
+	} `json:"generation_config"`
+}
+
+// parseGeminiRequest decodes a Gemini generateContent request.
+func parseGeminiRequest(body []byte) (*request, error) {
+	var raw geminiRequest
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, errors.Wrap(err, "decode gemini request")
+	}
+	req := &request{}
+	for i, content := range raw.Contents {
+		var text strings.Builder
+		hasToolResult := false
+		for _, part := range content.Parts {
+			text.WriteString(part.Text)
+			hasToolResult = hasToolResult || len(part.FunctionResponse) > 0
+		}
+		if content.Role == "user" && text.Len() > 0 {
+			req.LastUserText = text.String()
+		}
+		if i == len(raw.Contents)-1 {
+			req.AfterToolResult = hasToolResult
+		}
+	}
+	for _, t := range raw.Tools {
+		for _, declaration := range t.FunctionDeclarations {
+			req.Tools = append(req.Tools, tool{Name: declaration.Name, Schema: declaration.Parameters})
+		}
+	}
+	if cfg := raw.ToolConfig; cfg != nil {
+		mode := strings.ToUpper(cfg.FunctionCallingConfig.Mode)
+		req.ToolsDisabled = mode == "NONE"
+		if mode == "ANY" && len(cfg.FunctionCallingConfig.AllowedFunctionNames) > 0 {
+			req.ForcedTool = cfg.FunctionCallingConfig.AllowedFunctionNames[0]
+		}
+	}
+	if raw.GenerationConfig.ResponseSchema != nil {
+		req.ResponseSchema = raw.GenerationConfig.ResponseSchema
+	} else if raw.GenerationConfig.ResponseMimeType == "application/json" {
+		req.JSONMode = true
+	}
+	return req, nil
+}
+
+// contentText returns the text of a message content that is either a string
+// or a list of typed parts.
+func contentText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &parts) != nil {
+		return ""
+	}
+	var builder strings.Builder
+	for _, part := range parts {
+		if part.Type == "text" || part.Type == "input_text" {
+			builder.WriteString(part.Text)
+		}
+	}
+	return builder.String()
+}
+
+// sampleFromSchema builds the smallest value that satisfies a JSON schema, so
+// tool arguments and structured replies validate against the caller's schema.
+func sampleFromSchema(schema map[string]any) any {
+	if values, ok := schema["enum"].([]any); ok && len(values) > 0 {
+		return values[0]
+	}
+	if value, ok := schema["const"]; ok {
+		return value
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		if options, ok := schema[key].([]any); ok && len(options) > 0 {
+			if option, ok := options[0].(map[string]any); ok {
+				return sampleFromSchema(option)
+			}
+		}
+	}
+
+	schemaType, _ := schema["type"].(string)
+	if types, ok := schema["type"].([]any); ok && len(types) > 0 {
+		schemaType, _ = types[0].(string)
+	}
+	switch strings.ToLower(schemaType) {
+	case "object", "":
+		properties, _ := schema["properties"].(map[string]any)
+		if schemaType == "" && properties == nil {
+			return "mock"
+		}
+		object := make(map[string]any, len(properties))
+		for name, property := range properties {
+			if propertySchema, ok := property.(map[string]any); ok {
+				object[name] = sampleFromSchema(propertySchema)
+			}
+		}
+		return object
+	case "array":
+		items, _ := schema["items"].(map[string]any)
+		if items == nil {
+			return []any{}
+		}
+		return []any{sampleFromSchema(items)}
+	case "number":
+		return numberInRange(schema, 0.5)
+	case "integer":
+		return int(numberInRange(schema, 1))
+	case "boolean":
+		return true
+	case "null":
+		return nil
+	default:
+		return "mock"
+	}
+}
+
+// numberInRange returns fallback, moved inside the schema's minimum and
+// maximum when it lies outside them.
+func numberInRange(schema map[string]any, fallback float64) float64 {
+	if minimum, ok := schema["minimum"].(float64); ok && fallback < minimum {
+		fallback = minimum
+	}
+	if maximum, ok := schema["maximum"].(float64); ok && fallback > maximum {
+		fallback = maximum
+	}
+	return fallback
+}
@@ -0,0 +1,337 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/random"
+	dbmodel "github.com/Laisky/one-api/model"
+)
+
+// reply is the synthesized answer, rendered into a wire format by the
+// format-specific writers below.
+type reply struct {
+	ID               string
+	Model            string
+	Created          int64
+	Text             string
+	ToolCall         *toolCall
+	PromptTokens     int
+	CompletionTokens int
+}
+
+type toolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// newReply answers req with either a tool call or a text reply.
+func newReply(req *request, cfg *dbmodel.MockChannelConfig, modelName string, promptTokens int, countTokens func(string) int) *reply {
+	r := &reply{
+		ID:           random.GetUUID(),
+		Model:        modelName,
+		Created:      helper.GetTimestamp(),
+		PromptTokens: promptTokens,
+	}
+	if called := req.toolToCall(); called != nil && !cfg.DisableToolCalls {
+		arguments, _ := json.Marshal(sampleFromSchema(called.Schema))
+		r.ToolCall = &toolCall{ID: "call_" + random.GetUUID(), Name: called.Name, Arguments: string(arguments)}
+		r.CompletionTokens = countTokens(called.Name + r.ToolCall.Arguments)
+		return r
+	}
+	r.Text = req.replyText(cfg.Content)
+	r.CompletionTokens = countTokens(r.Text)
+	return r
+}
+
+// textChunks splits the reply text into one streamed chunk per word.
+func (r *reply) textChunks() []string {
+	if r.Text == "" {
+		return nil
+	}
+	return strings.SplitAfter(r.Text, " ")
+}
+
+// argumentChunks splits the tool arguments in two, so clients exercise the
+// concatenation of argument deltas.
+func (r *reply) argumentChunks() []string {
+	arguments := r.ToolCall.Arguments
+	half := len(arguments) / 2
+	if half == 0 {
+		return []string{arguments}
+	}
+	return []string{arguments[:half], arguments[half:]}
+}
+
+// sseEvent frames payload as one server-sent event, with an optional event name.
+func sseEvent(event string, payload any) string {
+	raw, _ := json.Marshal(payload)
+	if event != "" {
+		return fmt.Sprintf("event: %s\ndata: %s\n\n", event, raw)
+	}
+	return fmt.Sprintf("data: %s\n\n", raw)
+}
+
+func openAIUsage(r *reply) map[string]any {
+	return map[string]any{
+		"prompt_tokens":     r.PromptTokens,
+		"completion_tokens": r.CompletionTokens,
+		"total_tokens":      r.PromptTokens + r.CompletionTokens,
+	}
+}
+
+func (r *reply) openAIFinishReason() string {
+	if r.ToolCall != nil {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// openAIBody renders a Chat Completions response.
+func (r *reply) openAIBody() []byte {
+	message := map[string]any{"role": "assistant", "content": r.Text}
+	if r.ToolCall != nil {
+		message["content"] = nil
+		message["tool_calls"] = []map[string]any{{
+			"id":   r.ToolCall.ID,
+			"type": "function",
+			"function": map[string]any{
+				"name":      r.ToolCall.Name,
+				"arguments": r.ToolCall.Arguments,
+			},
+		}}
+	}
+	raw, _ := json.Marshal(map[string]any{
+		"id":      "chatcmpl-" + r.ID,
+		"object":  "chat.completion",
+		"created": r.Created,
+		"model":   r.Model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       message,
+			"finish_reason": r.openAIFinishReason(),
+		}},
+		"usage": openAIUsage(r),
+	})
+	return raw
+}
+
+// openAIEvents renders a Chat Completions stream, ending with a usage chunk
+// and [DONE].
+func (r *reply) openAIEvents() []string {
+	chunk := func(delta map[string]any, finishReason any) string {
+		return sseEvent("", map[string]any{
+			"id":      "chatcmpl-" + r.ID,
+			"object":  "chat.completion.chunk",
+			"created": r.Created,
+			"model":   r.Model,
+			"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+		})
+	}
+
+	events := []string{chunk(map[string]any{"role": "assistant", "content": ""}, nil)}
+	for _, text := range r.textChunks() {
+		events = append(events, chunk(map[string]any{"content": text}, nil))
+	}
+	if r.ToolCall != nil {
+		events = append(events, chunk(map[string]any{"tool_calls": []map[string]any{{
+			"index":    0,
+			"id":       r.ToolCall.ID,
+			"type":     "function",
+			"function": map[string]any{"name": r.ToolCall.Name, "arguments": ""},
+		}}}, nil))
+		for _, arguments := range r.argumentChunks() {
+			events = append(events, chunk(map[string]any{"tool_calls": []map[string]any{{
+				"index":    0,
+				"function": map[string]any{"arguments": arguments},
+			}}}, nil))
+		}
+	}
+	events = append(events, chunk(map[string]any{}, r.openAIFinishReason()))
+	events = append(events, sseEvent("", map[string]any{
+		"id":      "chatcmpl-" + r.ID,
+		"object":  "chat.completion.chunk",
+		"created": r.Created,
+		"model":   r.Model,
+		"choices": []any{},
+		"usage":   openAIUsage(r),
+	}))
+	return append(events, "data: [DONE]\n\n")
+}
+
+func (r *reply) claudeStopReason() string {
+	if r.ToolCall != nil {
+		return "tool_use"
+	}
+	return "end_turn"
+}
+
+func (r *reply) claudeToolInput() any {
+	var input any
+	_ = json.Unmarshal([]byte(r.ToolCall.Arguments), &input)
+	return input
+}
+
+// claudeBody renders an Anthropic Messages response.
+func (r *reply) claudeBody() []byte {
+	content := []map[string]any{}
+	if r.Text != "" {
+		content = append(content, map[string]any{"type": "text", "text": r.Text})
+	}
+	if r.ToolCall != nil {
+		content = append(content, map[string]any{
+			"type":  "tool_use",
+			"id":    "toolu_" + r.ToolCall.ID,
+			"name":  r.ToolCall.Name,
+			"input": r.claudeToolInput(),
+		})
+	}
+	raw, _ := json.Marshal(map[string]any{
+		"id":            "msg_" + r.ID,
+		"type":          "message",
+		"role":          "assistant",
+		"model":         r.Model,
+		"content":       content,
+		"stop_reason":   r.claudeStopReason(),
+		"stop_sequence": nil,
+		"usage": map[string]any{
+			"input_tokens":  r.PromptTokens,
+			"output_tokens": r.CompletionTokens,
+		},
+	})
+	return raw
+}
+
+// claudeEvents renders an Anthropic Messages stream.
+func (r *reply) claudeEvents() []string {
+	events := []string{sseEvent("message_start", map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id":            "msg_" + r.ID,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         r.Model,
+			"content":       []any{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         map[string]any{"input_tokens": r.PromptTokens, "output_tokens": 1},
+		},
+	})}
+	index := 0
+	if r.Text != "" {
+		events = append(events, sseEvent("content_block_start", map[string]any{
+			"type": "content_block_start", "index": index,
+			"content_block": map[string]any{"type": "text", "text": ""},
+		}))
+		for _, text := range r.textChunks() {
+			events = append(events, sseEvent("content_block_delta", map[string]any{
+				"type": "content_block_delta", "index": index,
+				"delta": map[string]any{"type": "text_delta", "text": text},
+			}))
+		}
+		events = append(events, sseEvent("content_block_stop", map[string]any{"type": "content_block_stop", "index": index}))
+		index++
+	}
+	if r.ToolCall != nil {
+		events = append(events, sseEvent("content_block_start", map[string]any{
+			"type": "content_block_start", "index": index,
+			"content_block": map[string]any{"type": "tool_use", "id": "toolu_" + r.ToolCall.ID, "name": r.ToolCall.Name, "input": map[string]any{}},
+		}))
+		for _, arguments := range r.argumentChunks() {
+			events = append(events, sseEvent("content_block_delta", map[string]any{
+				"type": "content_block_delta", "index": index,
+				"delta": map[string]any{"type": "input_json_delta", "partial_json": arguments},
+			}))
+		}
+		events = append(events, sseEvent("content_block_stop", map[string]any{"type": "content_block_stop", "index": index}))
+	}
+	events = append(events, sseEvent("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": r.claudeStopReason(), "stop_sequence": nil},
+		"usage": map[string]any{"output_tokens": r.CompletionTokens},
+	}))
+	return append(events, sseEvent("message_stop", map[string]any{"type": "message_stop"}))
+}
+
+func geminiUsage(r *reply) map[string]any {
+	return map[string]any{
+		"promptTokenCount":     r.PromptTokens,
+		"candidatesTokenCount": r.CompletionTokens,
+		"totalTokenCount":      r.PromptTokens + r.CompletionTokens,
+	}
+}
+
+func (r *reply) geminiParts() []map[string]any {
+	if r.ToolCall != nil {
+		return []map[string]any{{"functionCall": map[string]any{"name": r.ToolCall.Name, "args": r.claudeToolInput()}}}
+	}
+	return []map[string]any{{"text": r.Text}}
+}
+
+func (r *reply) geminiChunk(parts []map[string]any, final bool) map[string]any {
+	candidate := map[string]any{
+		"content": map[string]any{"role": "model", "parts": parts},
+		"index":   0,
+	}
+	chunk := map[string]any{
+		"candidates":   []map[string]any{candidate},
+		"modelVersion": r.Model,
+		"responseId":   r.ID,
+	}
+	if final {
+		candidate["finishReason"] = "STOP"
+		chunk["usageMetadata"] = geminiUsage(r)
+	}
+	return chunk
+}
+
+// geminiBody renders a generateContent response.
+func (r *reply) geminiBody() []byte {
+	raw, _ := json.Marshal(r.geminiChunk(r.geminiParts(), true))
+	return raw
+}
+
+// geminiEvents renders a streamGenerateContent?alt=sse stream. Function calls
+// arrive whole in one chunk, as Gemini sends them.
+func (r *reply) geminiEvents() []string {
+	if r.ToolCall != nil {
+		return []string{sseEvent("", r.geminiChunk(r.geminiParts(), true))}
+	}
+	chunks := r.textChunks()
+	events := make([]string, 0, len(chunks))
+	for i, text := range chunks {
+		events = append(events, sseEvent("", r.geminiChunk([]map[string]any{{"text": text}}, i == len(chunks)-1)))
+	}
+	return events
+}
+
+// errorBody renders a provider-shaped error for status.
+func errorBody(format string, status int, message string) []byte {
+	var payload map[string]any
+	switch format {
+	case dbmodel.MockFormatClaude:
+		errorType := "api_error"
+		if status == http.StatusTooManyRequests {
+			errorType = "rate_limit_error"
+		}
+		payload = map[string]any{"type": "error", "error": map[string]any{"type": errorType, "message": message}}
+	case dbmodel.MockFormatGemini:
+		errorStatus := "INTERNAL"
+		if status == http.StatusTooManyRequests {
+			errorStatus = "RESOURCE_EXHAUSTED"
+		}
+		payload = map[string]any{"error": map[string]any{"code": status, "message": message, "status": errorStatus}}
+	default:
+		errorType, code := "server_error", "server_error"
+		if status == http.StatusTooManyRequests {
+			errorType, code = "rate_limit_error", "rate_limit_exceeded"
+		}
+		payload = map[string]any{"error": map[string]any{"message": message, "type": errorType, "code": code}}
+	}
+	raw, _ := json.Marshal(payload)
+	return raw
+}
@@ -4,13 +4,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 
 	"github.com/Laisky/errors/v2"
 	"github.com/gin-gonic/gin"
 
 	"github.com/Laisky/one-api/common/ctxkey"
 	"github.com/Laisky/one-api/relay/adaptor"
+	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
 	"github.com/Laisky/one-api/relay/meta"
 	"github.com/Laisky/one-api/relay/model"
 	"github.com/Laisky/one-api/relay/relaymode"
@@ -60,68 +60,18 @@ func (a *Adaptor) ConvertImageRequest(_ *gin.Context, request *model.ImageReques
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, request *model.ClaudeRequest) (any, error) {
-	if request == nil {
-		return nil, errors.New("request is nil")
-	}
-
-	// Convert Claude Messages API request to OpenAI format first
-	openaiRequest := &model.GeneralOpenAIRequest{
-		Model:       request.Model,
-		MaxTokens:   request.MaxTokens,
-		Temperature: request.Temperature,
-		TopP:        request.TopP,
-		Stream:      request.Stream != nil && *request.Stream,
-		Stop:        request.StopSequences,
+	// The shared conversion maps tool_use and tool_result blocks to OpenAI tool
+	// calls and tool messages, which ConvertRequest then maps to Ollama's.
+	converted, err := openai_compatible.ConvertClaudeRequest(c, request)
+	if err != nil {
+		return nil, err
 	}
-
-	// Add system message if present
-	if request.System != "" {
-		systemMessage := model.Message{
-			Role:    "system",
-			Content: request.System,
-		}
-		openaiRequest.Messages = append(openaiRequest.Messages, systemMessage)
+	openaiRequest, ok := converted.(*model.GeneralOpenAIRequest)
+	if !ok || openaiRequest == nil {
+		return nil, errors.Errorf("unexpected converted claude request type %T", converted)
 	}
+	openaiRequest.Thinking = request.Thinking
 
-	// Convert messages
-	for _, msg := range request.Messages {
-		openaiMessage := model.Message{
-			Role: msg.Role,
-		}
-
-		// Convert content based on type
-		switch content := msg.Content.(type) {
-		case string:
-			openaiMessage.Content = content
-		case []any:
-			// Extract text from structured content (Ollama mainly supports text)
-			var textParts []string
-			for _, block := range content {
-				if blockMap, ok := block.(map[string]any); ok {
-					if blockType, exists := blockMap["type"]; exists && blockType == "text" {
-						if text, exists := blockMap["text"]; exists {
-							if textStr, ok := text.(string); ok {
-								textParts = append(textParts, textStr)
-							}
-						}
-					}
-				}
-			}
-			if len(textParts) > 0 {
-				openaiMessage.Content = strings.Join(textParts, "\n")
-			}
-		default:
-			openaiMessage.Content = fmt.Sprintf("%v", content)
-		}
-
-		openaiRequest.Messages = append(openaiRequest.Messages, openaiMessage)
-	}
-
-	// Mark this as a Claude Messages conversion for response handling
-	c.Set(ctxkey.ClaudeMessagesConversion, true)
-	c.Set(ctxkey.OriginalClaudeRequest, request)
-
-	// Now convert using Ollama's existing logic
 	return a.ConvertRequest(c, relaymode.ChatCompletions, openaiRequest)
 }
 
@@ -130,6 +80,9 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if isClaudeConversion, exists := c.Get(ctxkey.ClaudeMessagesConversion); exists && isClaudeConversion.(bool) {
+		return handleClaudeResponse(c, resp, meta)
+	}
 	if meta.IsStream {
 		err, usage = StreamHandler(c, resp)
 	} else {
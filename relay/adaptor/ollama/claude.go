@@ -0,0 +1,105 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
+	"github.com/Laisky/one-api/relay/meta"
+	"github.com/Laisky/one-api/relay/model"
+)
+
+// handleClaudeResponse answers a Claude Messages request. The Ollama response
+// is re-encoded as an OpenAI chat completion so the shared Claude converters,
+// which already handle tool_use and thinking blocks, can produce the reply.
+func handleClaudeResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.Usage, *model.ErrorWithStatusCode) {
+	if meta.IsStream {
+		converted := &http.Response{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Body:       newOpenAIStreamReader(c, resp.Body),
+		}
+		return openai_compatible.ConvertOpenAIStreamToClaudeSSE(c, converted, meta.PromptTokens, meta.ActualModelName)
+	}
+
+	ollamaResponse, errResp := readChatResponse(c, resp)
+	if errResp != nil {
+		return nil, errResp
+	}
+	body, err := json.Marshal(responseOllama2OpenAI(c, ollamaResponse))
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+	}
+	claudeResp, errResp := openai_compatible.ConvertOpenAIResponseToClaudeResponse(c, &http.Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	})
+	if errResp != nil {
+		return nil, errResp
+	}
+	// The controller forwards the converted response and bills from its usage.
+	c.Set(ctxkey.ConvertedResponse, claudeResp)
+	return nil, nil
+}
+
+// openAIStreamReader re-encodes an Ollama NDJSON chat stream as OpenAI
+// chat-completion SSE, one chunk per line, ending with [DONE]. The final chunk
+// carries the usage.
+type openAIStreamReader struct {
+	c     *gin.Context
+	src   *bufio.Reader
+	body  io.Closer
+	state streamState
+	buf   bytes.Buffer
+	err   error
+}
+
+func newOpenAIStreamReader(c *gin.Context, body io.ReadCloser) *openAIStreamReader {
+	return &openAIStreamReader{c: c, src: bufio.NewReaderSize(body, 64*1024), body: body}
+}
+
+func (r *openAIStreamReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.src.ReadString('\n')
+		if len(bytes.TrimSpace([]byte(line))) > 0 {
+			// Lines that fail to decode are skipped, as StreamHandler does.
+			if ollamaResponse, decodeErr := decodeStreamLine(line); decodeErr == nil {
+				chunk := streamResponseOllama2OpenAI(r.c, ollamaResponse, &r.state)
+				if ollamaResponse.Done {
+					usage := responseUsage(ollamaResponse)
+					chunk.Usage = &usage
+				}
+				data, marshalErr := json.Marshal(chunk)
+				if marshalErr != nil {
+					return 0, errors.Wrap(marshalErr, "marshal openai stream chunk")
+				}
+				r.buf.WriteString("data: ")
+				r.buf.Write(data)
+				r.buf.WriteString("\n\n")
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				r.buf.WriteString("data: [DONE]\n\n")
+			}
+			r.err = err
+		}
+	}
+	return r.buf.Read(p)
+}
+
+func (r *openAIStreamReader) Close() error {
+	return r.body.Close()
+}
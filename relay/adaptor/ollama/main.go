@@ -16,6 +16,7 @@ import (
 	"github.com/Laisky/one-api/common/config"
 	"github.com/Laisky/one-api/common/helper"
 	"github.com/Laisky/one-api/common/image"
+	"github.com/Laisky/one-api/common/random"
 	"github.com/Laisky/one-api/common/tracing"
 	"github.com/Laisky/one-api/relay/adaptor/openai"
 	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
@@ -35,45 +36,228 @@ func ConvertRequest(request model.GeneralOpenAIRequest) *ChatRequest {
 			NumPredict:       request.MaxTokens,
 			NumCtx:           request.NumCtx,
 		},
-		Stream: request.Stream,
+		Stream:    request.Stream,
+		Tools:     convertTools(request.Tools, request.ToolChoice),
+		Format:    convertResponseFormat(request.ResponseFormat),
+		Think:     convertThink(request),
+		KeepAlive: request.KeepAlive,
+	}
+	if ollamaRequest.Options.NumPredict == 0 && request.MaxCompletionTokens != nil {
+		ollamaRequest.Options.NumPredict = *request.MaxCompletionTokens
 	}
 	if ollamaRequest.Options.NumPredict == 0 {
 		ollamaRequest.Options.NumPredict = config.DefaultMaxToken
 	}
+	if ollamaRequest.KeepAlive == nil {
+		ollamaRequest.KeepAlive = request.ExtraBody["keep_alive"]
+	}
+
+	// Ollama matches a tool result to its call by tool name, not by call id.
+	toolNames := make(map[string]string)
 	for _, message := range request.Messages {
 		openaiContent := message.ParseContent()
 		var imageUrls []string
-		var contentText string
+		var textParts []string
 		for _, part := range openaiContent {
 			switch part.Type {
 			case model.ContentTypeText:
 				if part.Text != nil {
-					contentText = *part.Text
+					textParts = append(textParts, *part.Text)
 				}
 			case model.ContentTypeImageURL:
 				_, data, _ := image.GetImageFromUrl(part.ImageURL.Url)
 				imageUrls = append(imageUrls, data)
 			}
 		}
-		ollamaRequest.Messages = append(ollamaRequest.Messages, Message{
-			Role:    message.Role,
-			Content: contentText,
-			Images:  imageUrls,
-		})
+		ollamaMessage := Message{
+			Role:     message.Role,
+			Content:  strings.Join(textParts, "\n"),
+			Thinking: messageReasoning(message),
+			Images:   imageUrls,
+		}
+		for _, call := range message.ToolCalls {
+			if call.Function == nil {
+				continue
+			}
+			if call.Id != "" {
+				toolNames[call.Id] = call.Function.Name
+			}
+			ollamaMessage.ToolCalls = append(ollamaMessage.ToolCalls, ToolCall{
+				Function: ToolCallFunction{
+					Name:      call.Function.Name,
+					Arguments: toolCallArguments(call.Function.Arguments),
+				},
+			})
+		}
+		if message.Role == "tool" {
+			ollamaMessage.ToolName = toolNames[message.ToolCallId]
+		}
+		ollamaRequest.Messages = append(ollamaRequest.Messages, ollamaMessage)
 	}
 	return &ollamaRequest
 }
 
+// convertTools maps OpenAI function tools to Ollama tools. Ollama has no
+// tool_choice, so "none" is honored by sending no tools; built-in tools such
+// as web_search have no Ollama equivalent and are dropped.
+func convertTools(tools []model.Tool, toolChoice any) []Tool {
+	if choice, ok := toolChoice.(string); ok && choice == "none" {
+		return nil
+	}
+	var converted []Tool
+	for _, tool := range tools {
+		if tool.Function == nil || (tool.Type != "" && tool.Type != "function") {
+			continue
+		}
+		converted = append(converted, Tool{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			},
+		})
+	}
+	return converted
+}
+
+// toolCallArguments returns OpenAI tool call arguments, a JSON string, as the
+// JSON object Ollama expects. Arguments that are not an object become {}.
+func toolCallArguments(arguments any) json.RawMessage {
+	var raw []byte
+	switch v := arguments.(type) {
+	case nil:
+	case string:
+		raw = []byte(strings.TrimSpace(v))
+	default:
+		raw, _ = json.Marshal(v)
+	}
+	if len(raw) == 0 || raw[0] != '{' || !json.Valid(raw) {
+		return json.RawMessage("{}")
+	}
+	return raw
+}
+
+// convertResponseFormat maps response_format to Ollama's format: the schema of
+// a json_schema format, or "json" for json_object.
+func convertResponseFormat(format *model.ResponseFormat) any {
+	if format == nil {
+		return nil
+	}
+	switch format.Type {
+	case "json_schema":
+		if format.JsonSchema != nil && len(format.JsonSchema.Schema) > 0 {
+			return format.JsonSchema.Schema
+		}
+		return "json"
+	case "json_object":
+		return "json"
+	}
+	return nil
+}
+
+// convertThink derives Ollama's think flag from extra_body.think, Claude's
+// thinking block or the reasoning effort. It returns nil to leave the model's
+// default in place.
+func convertThink(request model.GeneralOpenAIRequest) any {
+	if think, ok := request.ExtraBody["think"]; ok {
+		return think
+	}
+	if request.Thinking != nil {
+		return request.Thinking.Type != "disabled"
+	}
+
+	var effort string
+	if request.ReasoningEffort != nil {
+		effort = *request.ReasoningEffort
+	} else if request.Reasoning != nil && request.Reasoning.Effort != nil {
+		effort = *request.Reasoning.Effort
+	}
+	switch effort {
+	case "", "default":
+		return nil
+	case "none":
+		return false
+	}
+	// gpt-oss takes a thinking level and ignores a plain true.
+	if !strings.Contains(strings.ToLower(request.Model), "gpt-oss") {
+		return true
+	}
+	switch effort {
+	case "minimal", "low":
+		return "low"
+	case "medium":
+		return "medium"
+	}
+	return "high"
+}
+
+// messageReasoning returns the reasoning carried on an assistant message in
+// any of the formats clients send it back in.
+func messageReasoning(message model.Message) string {
+	for _, reasoning := range []*string{message.ReasoningContent, message.Reasoning, message.Thinking} {
+		if reasoning != nil && *reasoning != "" {
+			return *reasoning
+		}
+	}
+	return ""
+}
+
+// convertToolCalls maps Ollama tool calls to OpenAI tool calls. Ollama assigns
+// no call ids, so each call gets a fresh one.
+func convertToolCalls(calls []ToolCall) []model.Tool {
+	var tools []model.Tool
+	for _, call := range calls {
+		arguments := string(call.Function.Arguments)
+		if arguments == "" || arguments == "null" {
+			arguments = "{}"
+		}
+		tools = append(tools, model.Tool{
+			Id:   "call_" + random.GetRandomString(24),
+			Type: "function",
+			Function: &model.Function{
+				Name:      call.Function.Name,
+				Arguments: arguments,
+			},
+		})
+	}
+	return tools
+}
+
+// finishReason maps a final Ollama response to an OpenAI finish reason.
+func finishReason(response *ChatResponse, calledTools bool) string {
+	switch {
+	case calledTools:
+		return "tool_calls"
+	case response.DoneReason == "length":
+		return "length"
+	}
+	return constant.StopFinishReason
+}
+
+// reasoningFormat is the field Ollama's thinking is surfaced in, chosen by the
+// reasoning_format query parameter and defaulting to reasoning_content.
+func reasoningFormat(c *gin.Context) string {
+	if format := c.Query("reasoning_format"); format != "" {
+		return format
+	}
+	return string(model.ReasoningFormatReasoningContent)
+}
+
 func responseOllama2OpenAI(c *gin.Context, response *ChatResponse) *openai.TextResponse {
 	choice := openai.TextResponseChoice{
 		Index: 0,
 		Message: model.Message{
-			Role:    response.Message.Role,
-			Content: response.Message.Content,
+			Role:      response.Message.Role,
+			Content:   response.Message.Content,
+			ToolCalls: convertToolCalls(response.Message.ToolCalls),
 		},
 	}
+	if response.Message.Thinking != "" {
+		choice.Message.SetReasoningContent(reasoningFormat(c), response.Message.Thinking)
+	}
 	if response.Done {
-		choice.FinishReason = "stop"
+		choice.FinishReason = finishReason(response, len(choice.Message.ToolCalls) > 0)
 	}
 	fullTextResponse := openai.TextResponse{
 		Id:      tracing.GenerateChatCompletionID(c),
@@ -81,21 +265,45 @@ func responseOllama2OpenAI(c *gin.Context, response *ChatResponse) *openai.TextR
 		Object:  "chat.completion",
 		Created: helper.GetTimestamp(),
 		Choices: []openai.TextResponseChoice{choice},
-		Usage: model.Usage{
-			PromptTokens:     response.PromptEvalCount,
-			CompletionTokens: response.EvalCount,
-			TotalTokens:      response.PromptEvalCount + response.EvalCount,
-		},
+		Usage:   responseUsage(response),
 	}
 	return &fullTextResponse
 }
 
-func streamResponseOllama2OpenAI(c *gin.Context, ollamaResponse *ChatResponse) *openai.ChatCompletionsStreamResponse {
+func responseUsage(response *ChatResponse) model.Usage {
+	return model.Usage{
+		PromptTokens:     response.PromptEvalCount,
+		CompletionTokens: response.EvalCount,
+		TotalTokens:      response.PromptEvalCount + response.EvalCount,
+	}
+}
+
+// streamState carries what a stream conversion must remember across chunks.
+type streamState struct {
+	// toolCalls counts the tool calls emitted so far. Ollama sends each call
+	// whole in a single chunk, so it is both the next call's index and the
+	// signal to finish with tool_calls.
+	toolCalls int
+}
+
+func streamResponseOllama2OpenAI(c *gin.Context, ollamaResponse *ChatResponse, state *streamState) *openai.ChatCompletionsStreamResponse {
 	var choice openai.ChatCompletionsStreamResponseChoice
 	choice.Delta.Role = ollamaResponse.Message.Role
 	choice.Delta.Content = ollamaResponse.Message.Content
+	if ollamaResponse.Message.Thinking != "" {
+		choice.Delta.SetReasoningContent(reasoningFormat(c), ollamaResponse.Message.Thinking)
+	}
+	if toolCalls := convertToolCalls(ollamaResponse.Message.ToolCalls); len(toolCalls) > 0 {
+		for i := range toolCalls {
+			index := state.toolCalls
+			toolCalls[i].Index = &index
+			state.toolCalls++
+		}
+		choice.Delta.ToolCalls = toolCalls
+	}
 	if ollamaResponse.Done {
-		choice.FinishReason = &constant.StopFinishReason
+		reason := finishReason(ollamaResponse, state.toolCalls > 0)
+		choice.FinishReason = &reason
 	}
 	response := openai.ChatCompletionsStreamResponse{
 		Id:      tracing.GenerateChatCompletionID(c),
@@ -107,6 +315,21 @@ func streamResponseOllama2OpenAI(c *gin.Context, ollamaResponse *ChatResponse) *
 	return &response
 }
 
+// decodeStreamLine parses one line of an Ollama NDJSON chat stream.
+func decodeStreamLine(data string) (*ChatResponse, error) {
+	data = strings.TrimSuffix(data, "\n")
+	data = strings.TrimSuffix(data, "\r")
+	if after, ok := strings.CutPrefix(data, "}"); ok {
+		data = after + "}"
+	}
+
+	var ollamaResponse ChatResponse
+	if err := json.Unmarshal([]byte(data), &ollamaResponse); err != nil {
+		return nil, errors.Wrap(err, "unmarshal ollama stream line")
+	}
+	return &ollamaResponse, nil
+}
+
 func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
 	lg := gmw.GetLogger(c)
 	var usage model.Usage
@@ -114,6 +337,7 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 
 	common.SetEventStreamHeaders(c)
 
+	var state streamState
 	var streamErr error
 	for {
 		data, readErr := reader.ReadString('\n')
@@ -128,14 +352,7 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			}
 		}
 
-		data = strings.TrimSuffix(data, "\n")
-		data = strings.TrimSuffix(data, "\r")
-		if after, ok := strings.CutPrefix(data, "}"); ok {
-			data = after + "}"
-		}
-
-		var ollamaResponse ChatResponse
-		err := json.Unmarshal([]byte(data), &ollamaResponse)
+		ollamaResponse, err := decodeStreamLine(data)
 		if err != nil {
 			lg.Error("error unmarshalling stream response", zap.Error(err))
 			continue
@@ -147,7 +364,7 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			usage.TotalTokens = ollamaResponse.PromptEvalCount + ollamaResponse.EvalCount
 		}
 
-		response := streamResponseOllama2OpenAI(c, &ollamaResponse)
+		response := streamResponseOllama2OpenAI(c, ollamaResponse, &state)
 		err = openai_compatible.RenderStreamChunkWithBridge(c, response)
 		if err != nil {
 			lg.Error("error rendering response", zap.Error(err))
@@ -240,23 +457,25 @@ func embeddingResponseOllama2OpenAI(response *EmbeddingResponse) *openai.Embeddi
 	return &openAIEmbeddingResponse
 }
 
-func Handler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+// readChatResponse decodes a non-stream Ollama chat response, turning an
+// error payload into an OpenAI-style error.
+func readChatResponse(c *gin.Context, resp *http.Response) (*ChatResponse, *model.ErrorWithStatusCode) {
 	var ollamaResponse ChatResponse
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+		return nil, openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
 	}
 	gmw.GetLogger(c).Debug("ollama response", zap.ByteString("body", responseBody))
 	err = resp.Body.Close()
 	if err != nil {
-		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+		return nil, openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
 	}
 	err = json.Unmarshal(responseBody, &ollamaResponse)
 	if err != nil {
-		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
 	}
 	if ollamaResponse.Error != "" {
-		return &model.ErrorWithStatusCode{
+		return nil, &model.ErrorWithStatusCode{
 			Error: model.Error{
 				Message:  ollamaResponse.Error,
 				Type:     model.ErrorTypeOllama,
@@ -265,9 +484,17 @@ func Handler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *
 				RawError: errors.New(ollamaResponse.Error),
 			},
 			StatusCode: resp.StatusCode,
-		}, nil
+		}
+	}
+	return &ollamaResponse, nil
+}
+
+func Handler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+	ollamaResponse, errResp := readChatResponse(c, resp)
+	if errResp != nil {
+		return errResp, nil
 	}
-	fullTextResponse := responseOllama2OpenAI(c, &ollamaResponse)
+	fullTextResponse := responseOllama2OpenAI(c, ollamaResponse)
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
 		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
@@ -0,0 +1,142 @@
+package ollama
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/relay/meta"
+	"github.com/Laisky/one-api/relay/model"
+)
+
+func TestConvertRequestMapsToolsFormatAndThinking(t *testing.T) {
+	effort := "none"
+	request := model.GeneralOpenAIRequest{
+		Model:           "qwen3",
+		ReasoningEffort: &effort,
+		KeepAlive:       "10m",
+		Tools: []model.Tool{
+			{Type: "function", Function: &model.Function{Name: "get_weather", Description: "Weather", Parameters: map[string]any{"type": "object"}}},
+			{Type: "web_search"},
+		},
+		ResponseFormat: &model.ResponseFormat{
+			Type:       "json_schema",
+			JsonSchema: &model.JSONSchema{Name: "answer", Schema: map[string]any{"type": "object"}},
+		},
+		Messages: []model.Message{
+			{Role: "user", Content: "Weather in Paris?"},
+			{Role: "assistant", Content: "", ToolCalls: []model.Tool{
+				{Id: "call_1", Type: "function", Function: &model.Function{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+			}},
+			{Role: "tool", ToolCallId: "call_1", Content: "sunny"},
+		},
+	}
+
+	converted := ConvertRequest(request)
+	require.Equal(t, []Tool{{Type: "function", Function: ToolFunction{Name: "get_weather", Description: "Weather", Parameters: map[string]any{"type": "object"}}}}, converted.Tools)
+	require.Equal(t, map[string]any{"type": "object"}, converted.Format)
+	require.Equal(t, false, converted.Think)
+	require.Equal(t, "10m", converted.KeepAlive)
+
+	require.Len(t, converted.Messages, 3)
+	require.Equal(t, "get_weather", converted.Messages[1].ToolCalls[0].Function.Name)
+	require.JSONEq(t, `{"city":"Paris"}`, string(converted.Messages[1].ToolCalls[0].Function.Arguments))
+	require.Equal(t, "get_weather", converted.Messages[2].ToolName)
+	require.Equal(t, "sunny", converted.Messages[2].Content)
+
+	request.ToolChoice = "none"
+	request.ReasoningEffort = nil
+	request.Model = "gpt-oss:20b"
+	effort = "minimal"
+	request.Reasoning = &model.OpenAIResponseReasoning{Effort: &effort}
+	converted = ConvertRequest(request)
+	require.Nil(t, converted.Tools)
+	require.Equal(t, "low", converted.Think)
+}
+
+func TestHandlerReturnsToolCallsAndReasoning(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	body := `{"model":"qwen3","message":{"role":"assistant","content":"","thinking":"need weather",` +
+		`"tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}}]},` +
+		`"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":3}`
+	errResp, usage := Handler(c, &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))})
+	require.Nil(t, errResp)
+	require.Equal(t, 8, usage.TotalTokens)
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				ReasoningContent string       `json:"reasoning_content"`
+				ToolCalls        []model.Tool `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, "tool_calls", resp.Choices[0].FinishReason)
+	require.Equal(t, "need weather", resp.Choices[0].Message.ReasoningContent)
+	call := resp.Choices[0].Message.ToolCalls[0]
+	require.True(t, strings.HasPrefix(call.Id, "call_"))
+	require.Equal(t, "get_weather", call.Function.Name)
+	require.JSONEq(t, `{"city":"Paris"}`, call.Function.Arguments.(string))
+}
+
+func TestStreamHandlerEmitsIndexedToolCalls(t *testing.T) {
+	c, rec := newOllamaStreamCtx(t)
+	stream := `{"model":"qwen3","message":{"role":"assistant","content":"","thinking":"hmm"},"done":false}` + "\n" +
+		`{"model":"qwen3","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"a","arguments":{}}}]},"done":false}` + "\n" +
+		`{"model":"qwen3","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"b","arguments":{"x":1}}}]},"done":false}` + "\n" +
+		`{"model":"qwen3","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":4,"eval_count":2}` + "\n"
+
+	errResp, _ := StreamHandler(c, &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(stream))})
+	require.Nil(t, errResp)
+
+	body := rec.Body.String()
+	require.Contains(t, body, `"reasoning_content":"hmm"`)
+	require.Contains(t, body, `"function":{"name":"a","arguments":"{}"},"index":0`)
+	require.Contains(t, body, `"function":{"name":"b","arguments":"{\"x\":1}"},"index":1`)
+	require.Contains(t, body, `"finish_reason":"tool_calls"`)
+}
+
+// TestOpenAIStreamReader checks the re-encoding the Claude Messages path feeds
+// to the shared Claude SSE converter.
+func TestOpenAIStreamReader(t *testing.T) {
+	c, _ := newOllamaStreamCtx(t)
+	reader := newOpenAIStreamReader(c, cannedOllamaStream([]string{"Hi"}).Body)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+
+	events := strings.Split(strings.TrimSpace(string(data)), "\n\n")
+	require.Len(t, events, 3)
+	require.Contains(t, events[0], `"content":"Hi"`)
+	require.Contains(t, events[1], `"finish_reason":"stop"`)
+	require.Contains(t, events[1], `"usage":{"prompt_tokens":7,"completion_tokens":11,"total_tokens":18}`)
+	require.Equal(t, "data: [DONE]", events[2])
+}
+
+func TestClaudeStreamResponseCarriesToolUse(t *testing.T) {
+	c, rec := newOllamaStreamCtx(t)
+	stream := `{"model":"qwen3","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}}]},"done":false}` + "\n" +
+		`{"model":"qwen3","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":4,"eval_count":2}` + "\n"
+
+	usage, errResp := handleClaudeResponse(c, &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(stream))},
+		&meta.Meta{IsStream: true, ActualModelName: "qwen3"})
+	require.Nil(t, errResp)
+	require.Equal(t, 2, usage.CompletionTokens)
+
+	body := rec.Body.String()
+	require.Contains(t, body, `"type":"tool_use"`)
+	require.Contains(t, body, `"name":"get_weather"`)
+	require.Contains(t, body, `"partial_json":"{\"city\":\"Paris\"}"`)
+}
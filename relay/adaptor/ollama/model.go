@@ -1,5 +1,7 @@
 package ollama
 
+import "encoding/json"
+
 type Options struct {
 	Seed             int      `json:"seed,omitempty"`
 	Temperature      *float64 `json:"temperature,omitempty"`
@@ -12,16 +14,53 @@ type Options struct {
 }
 
 type Message struct {
-	Role    string   `json:"role,omitempty"`
-	Content string   `json:"content,omitempty"`
-	Images  []string `json:"images,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	Thinking  string     `json:"thinking,omitempty"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolName names the tool whose result a role=tool message carries.
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+// Tool is a function the model may call, in Ollama's native tool schema.
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+// ToolCall is a tool invocation on an assistant message. Unlike OpenAI, Ollama
+// has no call id and carries the arguments as a JSON object, not a string.
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Index     int             `json:"index,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
 }
 
 type ChatRequest struct {
 	Model    string    `json:"model,omitempty"`
 	Messages []Message `json:"messages,omitempty"`
-	Stream   bool      `json:"stream"`
-	Options  *Options  `json:"options,omitempty"`
+	Tools    []Tool    `json:"tools,omitempty"`
+	// Format is "json" or a JSON schema object the reply must conform to.
+	Format any  `json:"format,omitempty"`
+	Stream bool `json:"stream"`
+	// Think is a bool, or "low", "medium" or "high" for models such as gpt-oss
+	// that take a thinking level.
+	Think any `json:"think,omitempty"`
+	// KeepAlive is how long the model stays loaded after the request, either a
+	// duration string such as "10m" or a number of seconds.
+	KeepAlive any      `json:"keep_alive,omitempty"`
+	Options   *Options `json:"options,omitempty"`
 }
 
 type ChatResponse struct {
@@ -30,6 +69,7 @@ type ChatResponse struct {
 	Message         Message `json:"message"`
 	Response        string  `json:"response,omitempty"` // for stream response
 	Done            bool    `json:"done,omitempty"`
+	DoneReason      string  `json:"done_reason,omitempty"`
 	TotalDuration   int     `json:"total_duration,omitempty"`
 	LoadDuration    int     `json:"load_duration,omitempty"`
 	PromptEvalCount int     `json:"prompt_eval_count,omitempty"`
@@ -52,9 +52,7 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	apiKey := c.Request.Header.Get("Authorization")
-	apiKey = strings.TrimPrefix(apiKey, "Bearer ")
-	_, secretId, secretKey, err := ParseConfig(apiKey)
+	_, secretId, secretKey, err := ParseConfig(meta.GetByContext(c).APIKey)
 	if err != nil {
 		return nil, errors.Wrap(err, "parse tencent channel config")
 	}
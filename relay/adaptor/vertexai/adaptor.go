@@ -321,6 +321,18 @@ func getModelEndpointType(modelName string) ModelEndpointType {
 	}
 }
 
+// IsGeminiModel reports whether modelName is served by the Vertex AI Gemini
+// generateContent endpoints rather than a partner-model endpoint.
+func IsGeminiModel(modelName string) bool {
+	return getModelEndpointType(modelName) == EndpointTypeGemini
+}
+
+// IsClaudeModel reports whether modelName is served by the Vertex AI Anthropic
+// publisher endpoints.
+func IsClaudeModel(modelName string) bool {
+	return getModelEndpointType(modelName) == EndpointTypeClaude
+}
+
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 	// Validate required VertexAI configuration
 	if meta.Config.VertexAIProjectID == "" {
@@ -13,6 +13,8 @@ import (
 	"github.com/Laisky/one-api/common/logger"
 	"github.com/Laisky/one-api/common/metrics"
 	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/contextfit"
+	"github.com/Laisky/one-api/relay/guardrail"
 )
 
 // billingOpsTimeout is the maximum time allowed for all database operations
@@ -106,8 +108,10 @@ func PostConsumeQuotaWithLog(ctx context.Context, tokenId int, quotaDelta int64,
 		return
 	}
 
-	// Consume remaining quota
-	if err := model.PostConsumeTokenQuota(ctx, tokenId, quotaDelta); err != nil {
+	// Consume remaining quota and charge the actual usage against the token's
+	// tokens-per-minute window.
+	usedTokens := int64(logEntry.PromptTokens + logEntry.CompletionTokens)
+	if err := model.PostConsumeTokenUsage(ctx, tokenId, quotaDelta, usedTokens); err != nil {
 		lg.Error("CRITICAL: upstream request was sent but billing failed - unbilled request detected",
 			zap.Error(err),
 			zap.String("model", logEntry.ModelName),
@@ -116,7 +120,7 @@ func PostConsumeQuotaWithLog(ctx context.Context, tokenId int, quotaDelta int64,
 		metrics.GlobalRecorder.RecordBillingError("database_error", "post_consume_token_quota_with_log", logEntry.UserId, logEntry.ChannelId, logEntry.ModelName)
 		billingSuccess = false
 	}
-	if err := model.CacheUpdateUserQuota(ctx, logEntry.UserId); err != nil {
+	if err := model.CacheUpdatePayerQuota(ctx, logEntry.UserId, logEntry.OrgId); err != nil {
 		lg.Warn("user quota cache update failed - billing completed successfully",
 			zap.Error(err),
 			zap.String("model", logEntry.ModelName),
@@ -157,6 +161,9 @@ func PostConsumeQuotaWithLog(ctx context.Context, tokenId int, quotaDelta int64,
 	// Zero totalQuota is allowed (e.g., free groups or zero ratios) and should not be treated as an error.
 	if totalQuota > 0 {
 		model.UpdateUserUsedQuotaAndRequestCountWithContext(ctx, logEntry.UserId, totalQuota)
+		if logEntry.OrgId > 0 {
+			model.UpdateOrgUsedQuotaAndRequestCount(ctx, logEntry.OrgId, totalQuota)
+		}
 		model.UpdateChannelUsedQuotaWithContext(ctx, logEntry.ChannelId, totalQuota)
 	} else if totalQuota < 0 {
 		// Negative consumption should never happen; flag as error for diagnostics.
@@ -197,6 +204,7 @@ type QuotaConsumeDetail struct {
 	TotalQuota       int64
 	UserId           int
 	UserUUID         string
+	OrgId            int // organization paying for the request; 0 when the user pays
 	ChannelId        int
 	ChannelUUID      string
 	PromptTokens     int
@@ -205,8 +213,11 @@ type QuotaConsumeDetail struct {
 	GroupRatio       float64
 	// OriginModelName is the model name as requested by the client before mapping.
 	// ModelName is the mapped model used for billing.
-	OriginModelName    string
-	ModelName          string
+	OriginModelName string
+	ModelName       string
+	// ServedModelName is the gateway model that answered. It is recorded in the
+	// log metadata when it differs from OriginModelName after a model fallback.
+	ServedModelName    string
 	TokenUUID          string
 	TokenName          string
 	IsStream           bool
@@ -218,6 +229,11 @@ type QuotaConsumeDetail struct {
 	CacheWrite5mTokens int
 	CacheWrite1hTokens int
 	Metadata           model.LogMetadata
+
+	// ContextFit describes the context-window fitting recorded in the log metadata.
+	ContextFit *contextfit.Result
+	// ParentRequestId links the log of a sub-request to its client request.
+	ParentRequestId string
 	// Explicit IDs propagated from gin.Context
 	RequestId string
 	TraceId   string
@@ -239,6 +255,8 @@ type QuotaConsumeDetail struct {
 	// one LogTypeTool row per invocation so the dashboard tool charts can
 	// aggregate strictly on type. The originating consume log row is unchanged.
 	ToolUsageSummary *model.ToolUsageSummary
+	// GuardrailViolations are the guardrail findings recorded in the log metadata.
+	GuardrailViolations []guardrail.Violation
 }
 
 // stringPtrIfNotEmpty returns a string pointer only when value is non-empty.
@@ -317,6 +335,7 @@ func PostConsumeQuotaDetailed(detail QuotaConsumeDetail) {
 		OriginModelName:    detail.OriginModelName,
 		TokenName:          detail.TokenName,
 		TokenUUID:          stringPtrIfNotEmpty(detail.TokenUUID),
+		OrgId:              detail.OrgId,
 		Content:            logContent,
 		IsStream:           detail.IsStream,
 		ElapsedTime:        helper.CalcElapsedTime(detail.StartTime),
@@ -346,6 +365,30 @@ func PostConsumeQuotaDetailed(detail QuotaConsumeDetail) {
 		}
 		metadata[model.LogMetadataKeyUpstreamEndpoint] = detail.UpstreamEndpoint
 	}
+	if detail.ServedModelName != "" && detail.ServedModelName != detail.OriginModelName {
+		if metadata == nil {
+			metadata = model.LogMetadata{}
+		}
+		metadata[model.LogMetadataKeyServedModel] = detail.ServedModelName
+	}
+	if len(detail.GuardrailViolations) > 0 {
+		if metadata == nil {
+			metadata = model.LogMetadata{}
+		}
+		metadata[model.LogMetadataKeyGuardrail] = detail.GuardrailViolations
+	}
+	if detail.ContextFit != nil {
+		if metadata == nil {
+			metadata = model.LogMetadata{}
+		}
+		metadata[model.LogMetadataKeyContextFit] = detail.ContextFit
+	}
+	if detail.ParentRequestId != "" {
+		if metadata == nil {
+			metadata = model.LogMetadata{}
+		}
+		metadata[model.LogMetadataKeyParentRequestId] = detail.ParentRequestId
+	}
 	if len(metadata) > 0 {
 		entry.Metadata = metadata
 	}
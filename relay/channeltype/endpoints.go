@@ -277,7 +277,12 @@ func DefaultEndpointsForChannelType(channelType int) []Endpoint {
 			EndpointClaudeMessages,
 		}
 	case Ollama:
-		return chatAndEmbeddings
+		return []Endpoint{
+			EndpointChatCompletions,
+			EndpointEmbeddings,
+			EndpointResponseAPI,
+			EndpointClaudeMessages,
+		}
 	case LingYiWanWu:
 		return chatOnly
 	case StepFun:
@@ -416,6 +421,15 @@ func DefaultEndpointsForChannelType(channelType int) []Endpoint {
 			EndpointResponseAPI,
 			EndpointClaudeMessages,
 		}
+	case Mock:
+		// The Mock channel synthesizes Chat Completions, Claude Messages or
+		// Gemini responses in-process. Responses API requests use one-api's
+		// Chat Completions fallback.
+		return []Endpoint{
+			EndpointChatCompletions,
+			EndpointResponseAPI,
+			EndpointClaudeMessages,
+		}
 	case Custom, OpenAICompatible:
 		return openAICompatibleBasic
 	case ClaudeCompatible:
@@ -453,3 +467,81 @@ func IsEndpointSupportedByName(endpointName string, supportedEndpointNames []str
 func RelayModeToEndpointName(mode int) string {
 	return EndpointIDToName(Endpoint(mode))
 }
+
+// Token scope names for relay modes that channels do not declare in
+// SupportedEndpoints. Any channel whose adaptor implements such a mode may serve
+// it, so only token scopes can restrict it.
+const (
+	ScopeVoiceClone   = "voice_clone"
+	ScopeGeminiNative = "gemini_native"
+)
+
+// Token scope names for gateway APIs that are not relay modes. They never reach
+// a channel directly, so only token scopes can restrict them.
+const (
+	ScopeFiles         = "files"
+	ScopeBatches       = "batches"
+	ScopeConversations = "conversations"
+	ScopeMCP           = "mcp"
+)
+
+// gatewayScopePrefixes maps gateway route prefixes to the scope that covers them.
+var gatewayScopePrefixes = []struct {
+	prefix string
+	scope  string
+}{
+	{"/v1/files", ScopeFiles},
+	{"/v1/batches", ScopeBatches},
+	{"/v1/conversations", ScopeConversations},
+	{"/mcp", ScopeMCP},
+}
+
+// TokenScopeNames returns every name a token scope list may contain: the
+// endpoint names of AllEndpoints followed by the scope-only names.
+func TokenScopeNames() []string {
+	names := make([]string, 0, len(endpointNameToID)+2+len(gatewayScopePrefixes))
+	for _, e := range AllEndpoints() {
+		names = append(names, e.Name)
+	}
+	names = append(names, ScopeVoiceClone, ScopeGeminiNative)
+	for _, g := range gatewayScopePrefixes {
+		names = append(names, g.scope)
+	}
+	return names
+}
+
+// GatewayPathToScopeName returns the token scope that covers a gateway API
+// path such as /v1/files, or an empty string when the path is not one.
+func GatewayPathToScopeName(path string) string {
+	for _, g := range gatewayScopePrefixes {
+		if path == g.prefix || strings.HasPrefix(path, g.prefix+"/") {
+			return g.scope
+		}
+	}
+	return ""
+}
+
+// IsTokenScopeName reports whether name is a valid token scope.
+func IsTokenScopeName(name string) bool {
+	return slices.Contains(TokenScopeNames(), strings.ToLower(strings.TrimSpace(name)))
+}
+
+// RelayModeToScopeName returns the token scope that covers a relay mode, or an
+// empty string when no scope covers it (e.g. the channel proxy and the legacy
+// edits endpoint).
+func RelayModeToScopeName(mode int) string {
+	switch mode {
+	case relaymode.VoiceClone:
+		return ScopeVoiceClone
+	case relaymode.GeminiNative:
+		return ScopeGeminiNative
+	default:
+		return RelayModeToEndpointName(mode)
+	}
+}
+
+// IsChannelEndpointName reports whether a scope name is also a channel
+// endpoint name, i.e. whether channels can opt out of serving it.
+func IsChannelEndpointName(name string) bool {
+	return EndpointNameToID(name) >= 0
+}
@@ -314,3 +314,25 @@ func TestZhipuDefaultEndpointNames(t *testing.T) {
 	require.Contains(t, names, "chat_completions")
 	require.Contains(t, names, "embeddings")
 }
+
+// TestTokenScopeNames verifies that token scopes reuse the channel endpoint
+// vocabulary and add names for the modes channels do not declare.
+func TestTokenScopeNames(t *testing.T) {
+	t.Parallel()
+	names := TokenScopeNames()
+	for _, ep := range AllEndpoints() {
+		require.Contains(t, names, ep.Name)
+	}
+	require.Contains(t, names, ScopeVoiceClone)
+	require.Contains(t, names, ScopeGeminiNative)
+
+	require.True(t, IsTokenScopeName(" Embeddings "))
+	require.False(t, IsTokenScopeName("fine_tuning"))
+	require.True(t, IsChannelEndpointName("embeddings"))
+	require.False(t, IsChannelEndpointName(ScopeVoiceClone))
+
+	require.Equal(t, "embeddings", RelayModeToScopeName(relaymode.Embeddings))
+	require.Equal(t, ScopeVoiceClone, RelayModeToScopeName(relaymode.VoiceClone))
+	require.Equal(t, ScopeGeminiNative, RelayModeToScopeName(relaymode.GeminiNative))
+	require.Empty(t, RelayModeToScopeName(relaymode.Proxy))
+}
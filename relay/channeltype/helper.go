@@ -65,6 +65,8 @@ func ToAPIType(channelType int) int {
 		apiType = apitype.Cerebras
 	case DeepInfra:
 		apiType = apitype.DeepInfra
+	case Mock:
+		apiType = apitype.Mock
 	}
 
 	return apiType
@@ -196,6 +198,8 @@ func IdToName(channelType int) string {
 		return "cerebras"
 	case DeepInfra:
 		return "deepinfra"
+	case Mock:
+		return "mock"
 	case Dummy:
 		return "dummy"
 	default:
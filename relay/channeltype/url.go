@@ -69,6 +69,7 @@ var ChannelBaseURLConfigs = []ChannelBaseURLConfig{
 	{URL: "https://integrate.api.nvidia.com/v1", Editable: true},                       // 55 NVIDIA
 	{URL: "https://api.cerebras.ai/v1", Editable: false},                               // 56 Cerebras
 	{URL: "https://api.deepinfra.com", Editable: false},                                // 57 DeepInfra
+	{URL: "", Editable: false},                                                         // 58 Mock
 }
 
 // ChannelBaseURLs provides backward compatibility by returning only the URL strings.
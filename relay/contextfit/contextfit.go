@@ -0,0 +1,264 @@
+// Package contextfit fits chat conversations that exceed the model context
+// window. Depending on the strategy an oversized request is rejected before it
+// reaches the upstream, its oldest turns are dropped, or those turns are
+// condensed into a summary written by a configured model.
+//
+// Leading system and developer messages are always kept, and an assistant
+// message with tool calls stays together with the tool results that answer it,
+// so a fitted conversation never carries a tool result without its call.
+package contextfit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/Laisky/one-api/relay/model"
+)
+
+const (
+	// StrategyReject fails oversized requests with a context_length_exceeded error.
+	StrategyReject = "reject"
+	// StrategyTruncate drops the oldest turns until the conversation fits.
+	StrategyTruncate = "truncate"
+	// StrategySummarize replaces the oldest turns with a summary.
+	StrategySummarize = "summarize"
+	// StrategyOff disables fitting for a single request. It is only accepted
+	// in the request header, where it overrides the token's strategy.
+	StrategyOff = "off"
+)
+
+// summaryOverheadTokens covers the wrapper text around a summary.
+const summaryOverheadTokens = 32
+
+// IsValidStrategy reports whether strategy can be stored on a token.
+func IsValidStrategy(strategy string) bool {
+	switch strategy {
+	case StrategyReject, StrategyTruncate, StrategySummarize:
+		return true
+	}
+	return false
+}
+
+// Counter returns the prompt tokens of messages.
+type Counter func(messages []model.Message) int
+
+// ExceededError reports a prompt that cannot be fitted into the context window.
+type ExceededError struct {
+	// PromptTokens is the size of the smallest conversation the strategy could build.
+	PromptTokens int
+	// Budget is the number of prompt tokens the model accepts.
+	Budget int
+}
+
+// Error implements the error interface.
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("prompt is %d tokens but the model context window leaves room for %d prompt tokens", e.PromptTokens, e.Budget)
+}
+
+// Request describes a conversation to fit.
+type Request struct {
+	// Strategy is one of the Strategy constants other than StrategyOff.
+	Strategy string
+	Messages []model.Message
+	// Budget is the number of prompt tokens the model accepts: its context
+	// length minus the tokens reserved for the reply.
+	Budget int
+	Count  Counter
+
+	// The remaining fields are only used by StrategySummarize.
+
+	// SummaryModel is the model asked to write the summary.
+	SummaryModel string
+	// SummaryMaxTokens bounds the summary length.
+	SummaryMaxTokens int
+	// TokenId is the token the summary call is billed to.
+	TokenId int
+	// ParentRequestId is the request id of the client request being fitted.
+	ParentRequestId string
+}
+
+// Result describes a fitted conversation. It is recorded in the consume log
+// metadata of the request.
+type Result struct {
+	// Strategy is the strategy that was applied. It is truncate when a
+	// summary was requested but could not be produced.
+	Strategy           string `json:"strategy"`
+	PromptTokensBefore int    `json:"prompt_tokens_before"`
+	PromptTokensAfter  int    `json:"prompt_tokens_after"`
+	// DroppedMessages counts the messages removed from the conversation,
+	// including the ones replaced by the summary.
+	DroppedMessages int `json:"dropped_messages"`
+	// SummaryRequestId is the request id of the summarization sub-request.
+	SummaryRequestId string `json:"summary_request_id,omitempty"`
+	// SummaryError explains why a requested summary was not used.
+	SummaryError string `json:"summary_error,omitempty"`
+
+	// Messages is the fitted conversation.
+	Messages []model.Message `json:"-"`
+}
+
+// Fit applies req.Strategy to a conversation that may exceed req.Budget.
+//
+// Parameters:
+//   - ctx: request context, passed to the summarizer.
+//   - req: the conversation, its budget and the strategy.
+//
+// Returns:
+//   - *Result: the fitted conversation, or nil when it already fits.
+//   - error: an *ExceededError when the conversation cannot be fitted, or
+//     when the strategy is reject.
+func Fit(ctx context.Context, req Request) (*Result, error) {
+	before := req.Count(req.Messages)
+	if before <= req.Budget {
+		return nil, nil
+	}
+
+	switch req.Strategy {
+	case StrategyReject:
+		return nil, &ExceededError{PromptTokens: before, Budget: req.Budget}
+	case StrategyTruncate:
+		return truncateResult(req, before, "")
+	case StrategySummarize:
+		result, err := summarizeOldTurns(ctx, req, before)
+		if err == nil {
+			return result, nil
+		}
+		var exceeded *ExceededError
+		if errors.As(err, &exceeded) {
+			return nil, err
+		}
+		return truncateResult(req, before, err.Error())
+	}
+	return nil, errors.Errorf("unknown context strategy %q", req.Strategy)
+}
+
+func truncateResult(req Request, before int, summaryErr string) (*Result, error) {
+	messages, dropped, err := truncate(req.Messages, req.Budget, req.Count)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Strategy:           StrategyTruncate,
+		PromptTokensBefore: before,
+		PromptTokensAfter:  req.Count(messages),
+		DroppedMessages:    dropped,
+		SummaryError:       summaryErr,
+		Messages:           messages,
+	}, nil
+}
+
+// unit is a run of messages that is kept or dropped as a whole.
+type unit struct {
+	messages []model.Message
+	// pinned units are never dropped.
+	pinned bool
+}
+
+func (u unit) role() string {
+	return u.messages[0].Role
+}
+
+// splitUnits groups messages into units. System and developer messages are
+// pinned. An assistant message with tool calls absorbs the tool messages that
+// follow it; a stray tool message joins the unit before it.
+func splitUnits(messages []model.Message) []unit {
+	units := make([]unit, 0, len(messages))
+	for _, message := range messages {
+		switch {
+		case message.Role == "system" || message.Role == "developer":
+			units = append(units, unit{messages: []model.Message{message}, pinned: true})
+		case message.Role == "tool" && len(units) > 0 && !units[len(units)-1].pinned:
+			last := &units[len(units)-1]
+			last.messages = append(last.messages, message)
+		default:
+			units = append(units, unit{messages: []model.Message{message}})
+		}
+	}
+	return units
+}
+
+func joinUnits(units []unit) []model.Message {
+	messages := make([]model.Message, 0, len(units))
+	for _, u := range units {
+		messages = append(messages, u.messages...)
+	}
+	return messages
+}
+
+// dropOldest removes the oldest unpinned units until the conversation fits
+// budget. The latest unpinned unit is always kept. The conversation then
+// resumes at a user turn when a later one exists, since several providers
+// reject histories that open with an assistant or tool turn.
+func dropOldest(units []unit, budget int, count Counter) (kept []unit, dropped []unit, fits bool) {
+	kept = units
+	for {
+		if count(joinUnits(kept)) <= budget {
+			fits = true
+			break
+		}
+		idx := firstDroppable(kept)
+		if idx < 0 {
+			break
+		}
+		dropped = append(dropped, kept[idx])
+		kept = append(append([]unit(nil), kept[:idx]...), kept[idx+1:]...)
+	}
+
+	for {
+		idx := firstDroppable(kept)
+		if idx < 0 || kept[idx].role() == "user" || !hasUserUnitAfter(kept, idx) {
+			break
+		}
+		dropped = append(dropped, kept[idx])
+		kept = append(append([]unit(nil), kept[:idx]...), kept[idx+1:]...)
+	}
+	return kept, dropped, fits
+}
+
+// firstDroppable returns the index of the oldest unpinned unit, or -1 when
+// only the latest unpinned unit is left.
+func firstDroppable(units []unit) int {
+	first, unpinned := -1, 0
+	for idx, u := range units {
+		if u.pinned {
+			continue
+		}
+		if first < 0 {
+			first = idx
+		}
+		unpinned++
+	}
+	if unpinned < 2 {
+		return -1
+	}
+	return first
+}
+
+func hasUserUnitAfter(units []unit, idx int) bool {
+	for _, u := range units[idx+1:] {
+		if !u.pinned && u.role() == "user" {
+			return true
+		}
+	}
+	return false
+}
+
+func countMessages(units []unit) int {
+	total := 0
+	for _, u := range units {
+		total += len(u.messages)
+	}
+	return total
+}
+
+// truncate drops the oldest turns of messages until they fit budget.
+func truncate(messages []model.Message, budget int, count Counter) ([]model.Message, int, error) {
+	kept, dropped, fits := dropOldest(splitUnits(messages), budget, count)
+	fitted := joinUnits(kept)
+	if !fits {
+		return nil, 0, &ExceededError{PromptTokens: count(fitted), Budget: budget}
+	}
+	return fitted, countMessages(dropped), nil
+}
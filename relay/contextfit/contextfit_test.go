@@ -0,0 +1,166 @@
+package contextfit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/relay/model"
+)
+
+// countChars counts one token per content character and per tool call, which
+// keeps the budgets in the tests easy to follow.
+func countChars(messages []model.Message) int {
+	total := 0
+	for _, message := range messages {
+		total += len(message.StringContent()) + len(message.ToolCalls)
+	}
+	return total
+}
+
+// agentConversation is a conversation with a tool round trip in its history.
+func agentConversation() []model.Message {
+	return []model.Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "weather in Paris?"},
+		{Role: "assistant", ToolCalls: []model.Tool{{Id: "call_1", Type: "function", Function: &model.Function{Name: "get_weather", Arguments: `{"city":"Paris"}`}}}},
+		{Role: "tool", ToolCallId: "call_1", Content: "sunny"},
+		{Role: "assistant", Content: "It is sunny."},
+		{Role: "user", Content: "and Rome?"},
+	}
+}
+
+func roles(messages []model.Message) []string {
+	out := make([]string, 0, len(messages))
+	for _, message := range messages {
+		out = append(out, message.Role)
+	}
+	return out
+}
+
+func TestIsValidStrategy(t *testing.T) {
+	t.Parallel()
+	require.True(t, IsValidStrategy(StrategyReject))
+	require.True(t, IsValidStrategy(StrategyTruncate))
+	require.True(t, IsValidStrategy(StrategySummarize))
+	require.False(t, IsValidStrategy(StrategyOff), "off is a per-request override only")
+	require.False(t, IsValidStrategy(""))
+}
+
+func TestFitRejectAndNoop(t *testing.T) {
+	t.Parallel()
+	messages := agentConversation()
+	total := countChars(messages)
+
+	result, err := Fit(context.Background(), Request{Strategy: StrategyReject, Messages: messages, Budget: total, Count: countChars})
+	require.NoError(t, err)
+	require.Nil(t, result, "a conversation that fits is left alone")
+
+	_, err = Fit(context.Background(), Request{Strategy: StrategyReject, Messages: messages, Budget: total - 1, Count: countChars})
+	var exceeded *ExceededError
+	require.True(t, errors.As(err, &exceeded))
+	require.Equal(t, total, exceeded.PromptTokens)
+	require.Equal(t, total-1, exceeded.Budget)
+}
+
+func TestFitTruncateKeepsToolPairsTogether(t *testing.T) {
+	t.Parallel()
+	messages := agentConversation()
+
+	// Dropping the first user turn alone is enough, but the conversation must
+	// not open with the orphaned tool round trip.
+	result, err := Fit(context.Background(), Request{Strategy: StrategyTruncate, Messages: messages, Budget: countChars(messages) - 1, Count: countChars})
+	require.NoError(t, err)
+	require.Equal(t, StrategyTruncate, result.Strategy)
+	require.Equal(t, []string{"system", "user"}, roles(result.Messages))
+	require.Equal(t, "and Rome?", result.Messages[1].StringContent())
+	require.Equal(t, 4, result.DroppedMessages)
+	require.Equal(t, countChars(result.Messages), result.PromptTokensAfter)
+
+	// The latest turn is never dropped.
+	_, err = Fit(context.Background(), Request{Strategy: StrategyTruncate, Messages: messages, Budget: 5, Count: countChars})
+	var exceeded *ExceededError
+	require.True(t, errors.As(err, &exceeded))
+	require.Equal(t, len("sys")+len("and Rome?"), exceeded.PromptTokens)
+}
+
+func TestSplitUnitsGroupsToolResults(t *testing.T) {
+	t.Parallel()
+	units := splitUnits(agentConversation())
+	require.Len(t, units, 5)
+	require.True(t, units[0].pinned)
+	require.Equal(t, []string{"assistant", "tool"}, roles(units[2].messages))
+}
+
+func TestFitSummarize(t *testing.T) {
+	var seen SummaryRequest
+	SetSummarizer(func(_ context.Context, req SummaryRequest) (*SummaryResult, error) {
+		seen = req
+		return &SummaryResult{Summary: " Asked about Paris: sunny. ", RequestId: "summary-req"}, nil
+	})
+	t.Cleanup(func() { SetSummarizer(nil) })
+
+	messages := []model.Message{{Role: "system", Content: "sys"}}
+	for range 20 {
+		messages = append(messages, agentConversation()[1:]...)
+	}
+	request := Request{
+		Strategy:         StrategySummarize,
+		Messages:         messages,
+		Budget:           200,
+		Count:            countChars,
+		SummaryModel:     "gpt-4o-mini",
+		SummaryMaxTokens: 50,
+		TokenId:          7,
+		ParentRequestId:  "client-req",
+	}
+	result, err := Fit(context.Background(), request)
+	require.NoError(t, err)
+	require.Equal(t, StrategySummarize, result.Strategy)
+	require.Equal(t, "summary-req", result.SummaryRequestId)
+	require.LessOrEqual(t, result.PromptTokensAfter, 200)
+	require.Equal(t, len(messages)+1-len(result.Messages), result.DroppedMessages)
+
+	require.Equal(t, "sys", result.Messages[0].StringContent())
+	require.Equal(t, "system", result.Messages[1].Role)
+	require.Contains(t, result.Messages[1].StringContent(), "Asked about Paris: sunny.")
+	require.Equal(t, "user", result.Messages[2].Role)
+	require.Equal(t, "and Rome?", result.Messages[len(result.Messages)-1].StringContent())
+
+	require.Equal(t, 7, seen.TokenId)
+	require.Equal(t, "client-req", seen.ParentRequestId)
+	require.Equal(t, "gpt-4o-mini", seen.Model)
+	require.Equal(t, 50, seen.MaxTokens)
+	require.Len(t, seen.Messages, 2)
+	transcript := seen.Messages[1].StringContent()
+	require.Contains(t, transcript, "user: weather in Paris?")
+	require.Contains(t, transcript, `[called get_weather with {"city":"Paris"}]`)
+	require.Contains(t, transcript, "tool: sunny")
+}
+
+func TestFitSummarizeFallsBackToTruncate(t *testing.T) {
+	SetSummarizer(func(context.Context, SummaryRequest) (*SummaryResult, error) {
+		return nil, errors.New("upstream unavailable")
+	})
+	t.Cleanup(func() { SetSummarizer(nil) })
+
+	messages := agentConversation()
+	request := Request{Strategy: StrategySummarize, Messages: messages, Budget: countChars(messages) - 1, Count: countChars}
+
+	result, err := Fit(context.Background(), request)
+	require.NoError(t, err)
+	require.Equal(t, StrategyTruncate, result.Strategy)
+	require.Contains(t, result.SummaryError, "no summary model")
+
+	request.SummaryModel = "gpt-4o-mini"
+	request.Budget = 100
+	request.Messages = append(agentConversation(), agentConversation()[1:]...)
+	request.Messages = append(request.Messages, agentConversation()[1:]...)
+	result, err = Fit(context.Background(), request)
+	require.NoError(t, err)
+	require.Equal(t, StrategyTruncate, result.Strategy)
+	require.Contains(t, result.SummaryError, "upstream unavailable")
+	require.Empty(t, result.SummaryRequestId)
+}
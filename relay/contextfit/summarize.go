@@ -0,0 +1,158 @@
+package contextfit
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/Laisky/one-api/relay/model"
+)
+
+// summaryInstruction is the system prompt of the summarization call.
+const summaryInstruction = "You condense the earlier part of a conversation between a user and an AI assistant so the assistant can continue it without the full history. " +
+	"Keep facts, names, numbers, decisions, tool results that still matter and open questions. " +
+	"Write in the language of the conversation. Reply with the summary only."
+
+// summaryPrefix introduces the summary in the fitted conversation.
+const summaryPrefix = "Summary of the earlier conversation, which was shortened to fit the context window:\n\n"
+
+// SummaryRequest is a summarization call made on behalf of a client request.
+type SummaryRequest struct {
+	// TokenId is the token the call is authenticated and billed as.
+	TokenId int
+	// ParentRequestId is the request id of the client request, recorded on
+	// the log of the call.
+	ParentRequestId string
+	Model           string
+	MaxTokens       int
+	// Messages is the chat conversation asking for the summary.
+	Messages []model.Message
+}
+
+// SummaryResult is the reply of a summarization call.
+type SummaryResult struct {
+	Summary string
+	// RequestId is the request id of the summarization call.
+	RequestId string
+}
+
+// Summarizer runs a summarization call, typically through the chat
+// completions relay.
+type Summarizer func(ctx context.Context, req SummaryRequest) (*SummaryResult, error)
+
+var (
+	summarizerLock sync.RWMutex
+	summarizer     Summarizer
+)
+
+// SetSummarizer installs the function the summarize strategy calls. The relay
+// package cannot reach the HTTP router itself, so the server wires it at
+// startup.
+func SetSummarizer(s Summarizer) {
+	summarizerLock.Lock()
+	defer summarizerLock.Unlock()
+	summarizer = s
+}
+
+func summarize(ctx context.Context, req SummaryRequest) (*SummaryResult, error) {
+	summarizerLock.RLock()
+	s := summarizer
+	summarizerLock.RUnlock()
+	if s == nil {
+		return nil, errors.New("no summarizer is configured")
+	}
+	result, err := s(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "summarize conversation")
+	}
+	if result == nil || strings.TrimSpace(result.Summary) == "" {
+		return nil, errors.New("summarizer returned an empty summary")
+	}
+	return result, nil
+}
+
+// summarizeOldTurns replaces the turns that do not fit with a summary message
+// placed after the leading system messages. Room for the summary is reserved
+// before choosing the turns, and the result is truncated further in the rare
+// case the summary still does not fit.
+func summarizeOldTurns(ctx context.Context, req Request, before int) (*Result, error) {
+	if req.SummaryModel == "" {
+		return nil, errors.New("no summary model is configured")
+	}
+	reserve := req.SummaryMaxTokens + summaryOverheadTokens
+	kept, dropped, fits := dropOldest(splitUnits(req.Messages), req.Budget-reserve, req.Count)
+	if !fits || len(dropped) == 0 {
+		return nil, errors.New("the latest turn leaves no room for a summary")
+	}
+
+	result, err := summarize(ctx, SummaryRequest{
+		TokenId:         req.TokenId,
+		ParentRequestId: req.ParentRequestId,
+		Model:           req.SummaryModel,
+		MaxTokens:       req.SummaryMaxTokens,
+		Messages: []model.Message{
+			{Role: "system", Content: summaryInstruction},
+			{Role: "user", Content: transcript(joinUnits(dropped))},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := model.Message{Role: "system", Content: summaryPrefix + strings.TrimSpace(result.Summary)}
+	insertAt := 0
+	for insertAt < len(kept) && kept[insertAt].pinned {
+		insertAt++
+	}
+	fittedUnits := make([]unit, 0, len(kept)+1)
+	fittedUnits = append(fittedUnits, kept[:insertAt]...)
+	fittedUnits = append(fittedUnits, unit{messages: []model.Message{summary}, pinned: true})
+	fittedUnits = append(fittedUnits, kept[insertAt:]...)
+
+	messages, extraDropped, err := truncate(joinUnits(fittedUnits), req.Budget, req.Count)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Strategy:           StrategySummarize,
+		PromptTokensBefore: before,
+		PromptTokensAfter:  req.Count(messages),
+		DroppedMessages:    countMessages(dropped) + extraDropped,
+		SummaryRequestId:   result.RequestId,
+		Messages:           messages,
+	}, nil
+}
+
+// transcript renders messages as plain text for the summarization prompt.
+// Tool calls and tool results are written inline so the summary can mention
+// them; non-text content parts are omitted.
+func transcript(messages []model.Message) string {
+	var builder strings.Builder
+	for _, message := range messages {
+		text := strings.TrimSpace(message.StringContent())
+		if text == "" && len(message.ToolCalls) == 0 {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\n\n")
+		}
+		builder.WriteString(message.Role)
+		builder.WriteString(": ")
+		builder.WriteString(text)
+		for _, call := range message.ToolCalls {
+			if call.Function == nil {
+				continue
+			}
+			builder.WriteString("\n[called ")
+			builder.WriteString(call.Function.Name)
+			if arguments, ok := call.Function.Arguments.(string); ok && arguments != "" {
+				builder.WriteString(" with ")
+				builder.WriteString(arguments)
+			}
+			builder.WriteString("]")
+		}
+	}
+	return builder.String()
+}
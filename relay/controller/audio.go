@@ -156,7 +156,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, userId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, userId, meta.OrgId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -176,7 +176,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		if err != nil {
 			return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
-		syncUserQuotaCacheAfterPreConsume(ctx, userId, preConsumedQuota, "audio_preconsume")
+		syncUserQuotaCacheAfterPreConsume(ctx, userId, meta.OrgId, preConsumedQuota, "audio_preconsume")
 
 		// Billing audit safety net
 		markPreConsumed(c, preConsumedQuota)
@@ -255,12 +255,10 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 
 	if (relayMode == relaymode.AudioTranscription || relayMode == relaymode.AudioSpeech) && channelType == channeltype.Azure {
 		// https://learn.microsoft.com/en-us/azure/ai-services/openai/whisper-quickstart?tabs=command-line#rest-api
-		apiKey := c.Request.Header.Get("Authorization")
-		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
-		req.Header.Set("api-key", apiKey)
+		req.Header.Set("api-key", meta.APIKey)
 		req.ContentLength = c.Request.ContentLength
 	} else {
-		req.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
+		req.Header.Set("Authorization", "Bearer "+meta.APIKey)
 	}
 	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
 	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
@@ -343,7 +341,8 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		// Reconcile provisional log to 0 since upstream returned error
 		if provLogID > 0 {
 			if err := model.ReconcileConsumeLog(ctx, provLogID, 0,
-				"upstream error, refunded", 0, 0, 0, nil); err != nil {
+				"upstream error, refunded", 0, 0, 0,
+				model.LogMetadata{model.LogMetadataKeyRefundedQuota: preConsumedQuota}); err != nil {
 				lg.Warn("failed to reconcile provisional log on upstream error",
 					zap.Error(err), zap.Int("provisional_log_id", provLogID))
 			}
@@ -373,6 +372,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		logContent := fmt.Sprintf("model rate %.2f, group rate %.2f", modelRatio, groupRatio)
 		entry := &model.Log{
 			UserId:           userId,
+			OrgId:            meta.OrgId,
 			UserUUID:         model.StringPtrIfNotEmpty(meta.UserUUID),
 			ChannelId:        channelId,
 			ChannelUUID:      model.StringPtrIfNotEmpty(meta.ChannelUUID),
@@ -0,0 +1,302 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/model"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+// batchCompletionWindow is the only completion window OpenAI accepts.
+const batchCompletionWindow = "24h"
+
+// batchMaxMetadataPairs mirrors the OpenAI metadata limit.
+const batchMaxMetadataPairs = 16
+
+// batchEndpoints are the relay endpoints a batch may target. Lines are replayed
+// through the normal relay pipeline, so any channel serving the model works.
+var batchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+	"/v1/messages":         true,
+}
+
+// BatchInputLine is one request of a batch input file.
+type BatchInputLine struct {
+	// Line is the zero-based index of the request within the file.
+	Line     int             `json:"-"`
+	CustomId string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// BatchOutputLine is one line of a batch output or error file.
+type BatchOutputLine struct {
+	Id       string               `json:"id"`
+	CustomId string               `json:"custom_id"`
+	Response *BatchOutputResponse `json:"response"`
+	Error    *BatchOutputError    `json:"error"`
+}
+
+// BatchOutputResponse is the relayed response of a batch line.
+type BatchOutputResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestId  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// BatchOutputError describes a batch line that could not be executed.
+type BatchOutputError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// BatchError is an entry of the Batch object's errors list.
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	Line    *int   `json:"line,omitempty"`
+}
+
+// ParseBatchInput parses and validates a batch JSONL file. When endpoint is
+// not empty every line must target it; otherwise lines only need to target a
+// supported endpoint. Blank lines are skipped.
+func ParseBatchInput(content []byte, endpoint string) ([]BatchInputLine, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64<<10), len(content)+1)
+
+	var lines []BatchInputLine
+	seen := make(map[string]bool)
+	fileLine := 0
+	for scanner.Scan() {
+		fileLine++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var line BatchInputLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			return nil, errors.Wrapf(err, "line %d is not valid JSON", fileLine)
+		}
+		switch {
+		case line.CustomId == "":
+			return nil, errors.Errorf("line %d: custom_id is required", fileLine)
+		case seen[line.CustomId]:
+			return nil, errors.Errorf("line %d: duplicate custom_id %q", fileLine, line.CustomId)
+		case !strings.EqualFold(line.Method, http.MethodPost):
+			return nil, errors.Errorf("line %d: method must be POST", fileLine)
+		case !batchEndpoints[line.URL]:
+			return nil, errors.Errorf("line %d: unsupported url %q", fileLine, line.URL)
+		case endpoint != "" && line.URL != endpoint:
+			return nil, errors.Errorf("line %d: url %q does not match the batch endpoint %q", fileLine, line.URL, endpoint)
+		}
+		var body map[string]any
+		if err := json.Unmarshal(line.Body, &body); err != nil || body == nil {
+			return nil, errors.Errorf("line %d: body must be a JSON object", fileLine)
+		}
+		if stream, _ := body["stream"].(bool); stream {
+			return nil, errors.Errorf("line %d: streaming is not supported in batches", fileLine)
+		}
+		seen[line.CustomId] = true
+		line.Line = len(lines)
+		lines = append(lines, line)
+		if len(lines) > config.BatchMaxRequests {
+			return nil, errors.Errorf("batch exceeds the limit of %d requests", config.BatchMaxRequests)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read batch input")
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("batch input file has no requests")
+	}
+	return lines, nil
+}
+
+// batchCreateBody is the POST /v1/batches request body.
+type batchCreateBody struct {
+	InputFileId      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// nullableString renders an empty string as JSON null.
+func nullableString(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+// nullableTimestamp renders a zero timestamp as JSON null.
+func nullableTimestamp(v int64) *int64 {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+// renderBatch converts a stored batch into the OpenAI Batch object.
+func renderBatch(batch *model.RelayBatch) gin.H {
+	var batchErrors any
+	if batch.Errors != "" {
+		var data []BatchError
+		if err := json.Unmarshal([]byte(batch.Errors), &data); err == nil {
+			batchErrors = gin.H{"object": "list", "data": data}
+		}
+	}
+	var metadata any
+	if batch.Metadata != "" {
+		var decoded map[string]string
+		if err := json.Unmarshal([]byte(batch.Metadata), &decoded); err == nil {
+			metadata = decoded
+		}
+	}
+	return gin.H{
+		"id":                batch.BatchId,
+		"object":            "batch",
+		"endpoint":          batch.Endpoint,
+		"errors":            batchErrors,
+		"input_file_id":     batch.InputFileId,
+		"completion_window": batch.CompletionWindow,
+		"status":            batch.Status,
+		"output_file_id":    nullableString(batch.OutputFileId),
+		"error_file_id":     nullableString(batch.ErrorFileId),
+		"created_at":        batch.CreatedAt,
+		"in_progress_at":    nullableTimestamp(batch.InProgressAt),
+		"expires_at":        nullableTimestamp(batch.ExpiresAt),
+		"finalizing_at":     nullableTimestamp(batch.FinalizingAt),
+		"completed_at":      nullableTimestamp(batch.CompletedAt),
+		"failed_at":         nullableTimestamp(batch.FailedAt),
+		"expired_at":        nullableTimestamp(batch.ExpiredAt),
+		"cancelling_at":     nullableTimestamp(batch.CancellingAt),
+		"cancelled_at":      nullableTimestamp(batch.CancelledAt),
+		"request_counts": gin.H{
+			"total":     batch.RequestTotal,
+			"completed": batch.RequestCompleted,
+			"failed":    batch.RequestFailed,
+		},
+		"metadata": metadata,
+	}
+}
+
+// mapRelayBatchError converts a model error into the API error.
+func mapRelayBatchError(err error, id string) *relaymodel.ErrorWithStatusCode {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return stateErrorf("not_found", http.StatusNotFound, "No such Batch object: %s", id)
+	}
+	return stateErrorf("batch_error", http.StatusInternalServerError, "batch operation failed: %v", err)
+}
+
+// BatchCreateHelper handles POST /v1/batches. The input file is checked here;
+// its lines are validated by the batch executor, as with OpenAI.
+func BatchCreateHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	var body batchCreateBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil {
+		return stateErrorf("invalid_request_error", http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	if !batchEndpoints[body.Endpoint] {
+		return stateErrorf("invalid_request_error", http.StatusBadRequest, "unsupported endpoint: %q", body.Endpoint)
+	}
+	if body.CompletionWindow != batchCompletionWindow {
+		return stateErrorf("invalid_request_error", http.StatusBadRequest,
+			"completion_window must be %q", batchCompletionWindow)
+	}
+	if len(body.Metadata) > batchMaxMetadataPairs {
+		return stateErrorf("invalid_request_error", http.StatusBadRequest,
+			"metadata supports at most %d pairs", batchMaxMetadataPairs)
+	}
+
+	ctx := gmw.Ctx(c)
+	userId, tokenId := c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId)
+	inputFile, err := model.GetRelayFile(ctx, userId, tokenId, body.InputFileId)
+	if err != nil {
+		return mapRelayFileError(err, body.InputFileId)
+	}
+	if inputFile.Purpose != model.RelayFilePurposeBatch {
+		return stateErrorf("invalid_request_error", http.StatusBadRequest,
+			"input file %s must have purpose %q", inputFile.FileId, model.RelayFilePurposeBatch)
+	}
+
+	batch := &model.RelayBatch{
+		UserId:           userId,
+		TokenId:          tokenId,
+		Endpoint:         body.Endpoint,
+		InputFileId:      inputFile.FileId,
+		CompletionWindow: body.CompletionWindow,
+		CreatedAt:        helper.GetTimestamp(),
+	}
+	batch.ExpiresAt = batch.CreatedAt + 24*60*60
+	if len(body.Metadata) > 0 {
+		encoded, err := json.Marshal(body.Metadata)
+		if err != nil {
+			return stateErrorf("invalid_request_error", http.StatusBadRequest, "invalid metadata: %v", err)
+		}
+		batch.Metadata = string(encoded)
+	}
+	if err := model.CreateRelayBatch(ctx, batch); err != nil {
+		return mapRelayBatchError(err, batch.BatchId)
+	}
+	return writeJSON(c, http.StatusOK, renderBatch(batch))
+}
+
+// BatchListHelper handles GET /v1/batches.
+func BatchListHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	limit := listLimit(c, 20)
+	after := c.Query("after")
+	batches, err := model.ListRelayBatches(gmw.Ctx(c), c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId), after, limit+1)
+	if err != nil {
+		return mapRelayBatchError(err, after)
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]gin.H, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, renderBatch(batch))
+	}
+	payload := gin.H{"object": "list", "data": data, "has_more": hasMore}
+	if len(batches) > 0 {
+		payload["first_id"] = batches[0].BatchId
+		payload["last_id"] = batches[len(batches)-1].BatchId
+	}
+	return writeJSON(c, http.StatusOK, payload)
+}
+
+// BatchGetHelper handles GET /v1/batches/{id}.
+func BatchGetHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	id := c.Param("id")
+	batch, err := model.GetRelayBatch(gmw.Ctx(c), c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId), id)
+	if err != nil {
+		return mapRelayBatchError(err, id)
+	}
+	return writeJSON(c, http.StatusOK, renderBatch(batch))
+}
+
+// BatchCancelHelper handles POST /v1/batches/{id}/cancel.
+func BatchCancelHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	id := c.Param("id")
+	batch, err := model.CancelRelayBatch(gmw.Ctx(c), c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId), id)
+	if err != nil {
+		return mapRelayBatchError(err, id)
+	}
+	return writeJSON(c, http.StatusOK, renderBatch(batch))
+}
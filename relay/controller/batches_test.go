@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatchInput(t *testing.T) {
+	content := strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[]}}`,
+		``,
+		`{"custom_id":"b","method":"post","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[]}}`,
+	}, "\n")
+	lines, err := ParseBatchInput([]byte(content), "/v1/chat/completions")
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	require.Equal(t, 1, lines[1].Line)
+	require.Equal(t, "b", lines[1].CustomId)
+
+	_, err = ParseBatchInput([]byte(content), "/v1/embeddings")
+	require.ErrorContains(t, err, "does not match the batch endpoint")
+
+	for name, bad := range map[string]string{
+		"duplicate custom_id": `{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":{}}` + "\n" +
+			`{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":{}}`,
+		"unsupported url": `{"custom_id":"a","method":"POST","url":"/v1/files","body":{}}`,
+		"streaming":       `{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"stream":true}}`,
+		"body must be":    `{"custom_id":"a","method":"POST","url":"/v1/embeddings","body":"x"}`,
+		"no requests":     "\n\n",
+	} {
+		_, err := ParseBatchInput([]byte(bad), "")
+		require.ErrorContains(t, err, name)
+	}
+}
@@ -56,6 +56,7 @@ func userVisibleModelName(meta *metalib.Meta, fallback string) string {
 type conservativeRefundSnapshot struct {
 	skipRefund       bool // request may have been forwarded upstream => no-underbilling skip
 	userID           int
+	orgID            int
 	tokenID          int
 	provisionalLogID int
 	requestID        string
@@ -69,6 +70,7 @@ func newConservativeRefundSnapshot(c *gin.Context, quota int64, tokenID int, rea
 	return conservativeRefundSnapshot{
 		skipRefund:       shouldSkipPreConsumedRefund(c),
 		userID:           c.GetInt(ctxkey.Id),
+		orgID:            c.GetInt(ctxkey.OrgId),
 		tokenID:          tokenID,
 		provisionalLogID: c.GetInt(ctxkey.ProvisionalLogId),
 		requestID:        c.GetString(ctxkey.RequestId),
@@ -105,7 +107,8 @@ func (s conservativeRefundSnapshot) refund(ctx context.Context) bool {
 	// Reconcile provisional log to 0 so it doesn't appear as a duplicate entry.
 	if s.provisionalLogID > 0 {
 		if err := model.ReconcileConsumeLog(ctx, s.provisionalLogID, 0,
-			fmt.Sprintf("refunded: %s", s.reason), 0, 0, 0, nil); err != nil {
+			fmt.Sprintf("refunded: %s", s.reason), 0, 0, 0,
+			model.LogMetadata{model.LogMetadataKeyRefundedQuota: s.quota}); err != nil {
 			lg.Warn("failed to reconcile provisional log on refund",
 				zap.Error(err), zap.Int("provisional_log_id", s.provisionalLogID))
 		}
@@ -127,9 +130,7 @@ func (s conservativeRefundSnapshot) refund(ctx context.Context) bool {
 		return false
 	}
 
-	if s.userID > 0 {
-		syncUserQuotaCacheAfterRefund(ctx, s.userID, s.reason)
-	}
+	syncUserQuotaCacheAfterRefund(ctx, s.userID, s.orgID, s.reason)
 	return true
 }
 
@@ -209,6 +210,7 @@ func ResetPerAttemptBillingForRetry(ctx context.Context, c *gin.Context) {
 
 	lg := gmw.GetLogger(c)
 	userID := c.GetInt(ctxkey.Id)
+	orgID := c.GetInt(ctxkey.OrgId)
 	tokenID := c.GetInt(ctxkey.TokenId)
 	amount := c.GetInt64(ctxkey.PreConsumedQuotaAmount)
 	provID := c.GetInt(ctxkey.ProvisionalLogId)
@@ -231,9 +233,10 @@ func ResetPerAttemptBillingForRetry(ctx context.Context, c *gin.Context) {
 		// above), so it neither aborts on request cancellation nor races gin's recycle of c.
 		goDetachedBillingWork(relayctx.Detach(c), "resetPerAttemptBillingForRetry", func(bctx context.Context) {
 			billing.ReturnPreConsumedQuota(bctx, amount, tokenID)
-			syncUserQuotaCacheAfterRefund(bctx, userID, "cross_channel_retry")
+			syncUserQuotaCacheAfterRefund(bctx, userID, orgID, "cross_channel_retry")
 			if provID > 0 {
-				if err := model.ReconcileConsumeLog(bctx, provID, 0, reason, 0, 0, 0, nil); err != nil {
+				if err := model.ReconcileConsumeLog(bctx, provID, 0, reason, 0, 0, 0,
+					model.LogMetadata{model.LogMetadataKeyRefundedQuota: amount}); err != nil {
 					lg.Warn("failed to void provisional log on cross-channel retry refund",
 						zap.Error(errors.Wrapf(err, "reconcile provisional log %d to zero", provID)),
 						zap.Int("provisional_log_id", provID),
@@ -427,6 +430,7 @@ func recordProvisionalLog(c *gin.Context, meta *metalib.Meta, modelName string,
 		ModelName:   modelName,
 		TokenName:   meta.TokenName,
 		TokenUUID:   model.StringPtrIfNotEmpty(meta.TokenUUID),
+		OrgId:       meta.OrgId,
 		IsStream:    meta.IsStream,
 		RequestId:   requestId,
 		TraceId:     traceId,
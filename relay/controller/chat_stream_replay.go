@@ -0,0 +1,72 @@
+package controller
+
+import (
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/render"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+// writeChatResponseAsStream replays a complete chat response to a streaming
+// client, for gateway features that must see the whole reply before sending it.
+func writeChatResponseAsStream(c *gin.Context, response *openai.TextResponse, usage *relaymodel.Usage, includeUsage bool) {
+	common.SetEventStreamHeaders(c)
+	lg := gmw.GetLogger(c)
+	for _, chunk := range chatResponseStreamChunks(response, usage, includeUsage) {
+		if err := render.ObjectData(c, chunk); err != nil {
+			lg.Warn("write replayed stream chunk failed", zap.Error(err))
+		}
+	}
+	render.Done(c)
+}
+
+// chatResponseStreamChunks splits a chat response into chat completion chunks: a
+// role chunk, one chunk with the whole content and tool calls, the final chunk
+// with finish_reason and, when includeUsage is set, a usage chunk.
+func chatResponseStreamChunks(response *openai.TextResponse, usage *relaymodel.Usage, includeUsage bool) []openai.ChatCompletionsStreamResponse {
+	chunk := func(delta relaymodel.Message, finishReason *string) openai.ChatCompletionsStreamResponse {
+		return openai.ChatCompletionsStreamResponse{
+			Id:      response.Id,
+			Object:  "chat.completion.chunk",
+			Created: response.Created,
+			Model:   response.Model,
+			Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: delta, FinishReason: finishReason}},
+		}
+	}
+
+	var chunks []openai.ChatCompletionsStreamResponse
+	if len(response.Choices) > 0 {
+		choice := response.Choices[0]
+		finishReason := choice.FinishReason
+		chunks = append(chunks,
+			chunk(relaymodel.Message{Role: "assistant", Content: ""}, nil),
+			chunk(relaymodel.Message{Content: choice.Content, ToolCalls: streamToolCalls(choice.ToolCalls)}, nil),
+			chunk(relaymodel.Message{}, &finishReason),
+		)
+	}
+	if includeUsage && usage != nil {
+		final := chunk(relaymodel.Message{}, nil)
+		final.Choices = []openai.ChatCompletionsStreamResponseChoice{}
+		final.Usage = usage
+		chunks = append(chunks, final)
+	}
+	return chunks
+}
+
+// streamToolCalls adds the index field that streamed tool call deltas carry.
+func streamToolCalls(calls []relaymodel.Tool) []relaymodel.Tool {
+	if len(calls) == 0 {
+		return nil
+	}
+	indexed := make([]relaymodel.Tool, len(calls))
+	for idx := range calls {
+		indexed[idx] = calls[idx]
+		index := idx
+		indexed[idx].Index = &index
+	}
+	return indexed
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+func TestWriteChatResponseAsStream(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	gmw.SetLogger(c, logger.Logger)
+
+	response := &openai.TextResponse{
+		Id:      "chatcmpl-1",
+		Model:   "ernie-4.0",
+		Created: 1,
+		Choices: []openai.TextResponseChoice{{
+			Message: relaymodel.Message{Role: "assistant", Content: `{"city":"Paris"}`, ToolCalls: []relaymodel.Tool{
+				{Id: "call_1", Type: "function", Function: &relaymodel.Function{Name: "lookup", Arguments: "{}"}},
+			}},
+			FinishReason: "tool_calls",
+		}},
+	}
+	writeChatResponseAsStream(c, response, &relaymodel.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}, true)
+
+	require.Contains(t, recorder.Header().Get("Content-Type"), "text/event-stream")
+	body := recorder.Body.String()
+	require.Contains(t, body, `"object":"chat.completion.chunk"`)
+	require.Contains(t, body, `"content":"{\"city\":\"Paris\"}"`)
+	require.Contains(t, body, `"index":0`)
+	require.Contains(t, body, `"finish_reason":"tool_calls"`)
+	require.Contains(t, body, `"total_tokens":5`)
+	require.True(t, strings.HasSuffix(strings.TrimSpace(body), "data: [DONE]"))
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/Laisky/one-api/relay"
 	"github.com/Laisky/one-api/relay/adaptor/anthropic"
 	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/guardrail"
 	metalib "github.com/Laisky/one-api/relay/meta"
 	relaymodel "github.com/Laisky/one-api/relay/model"
 	"github.com/Laisky/one-api/relay/pricing"
@@ -81,6 +82,9 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	if err := logClientRequestPayload(c, "claude_messages"); err != nil {
 		return openai.ErrorWrapper(err, "invalid_claude_messages_request", http.StatusBadRequest)
 	}
+	if bizErr := applyRequestGuardrail(c, meta, guardrail.FormatClaudeMessages); bizErr != nil {
+		return bizErr
+	}
 
 	// get & validate Claude Messages API request
 	claudeRequest, err := getAndValidateClaudeMessagesRequest(c)
@@ -104,6 +108,11 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	// verbatim; SDK/rebuilding paths use this normalized struct.
 	mergeMidArraySystemMessages(claudeRequest)
 
+	// Claude Messages conversations are not fitted into the context window.
+	if bizErr := rejectUnsupportedContextStrategy(c, "Claude Messages"); bizErr != nil {
+		return bizErr
+	}
+
 	// get channel model ratio
 	channelModelRatio, channelCompletionRatio := getChannelRatios(c)
 	channelModelConfigs := getChannelModelConfigs(c)
@@ -153,8 +162,34 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		requestBody           io.Reader
 		convertedRequest      any
 		passthroughBody       []byte
+		guardrailWriter       *guardrailResponseWriter
 	)
 
+	// A forced structured tool on a model without native structured outputs is
+	// emulated and validated at the gateway.
+	if emulation, chatRequest := planClaudeStructuredOutputEmulation(c, claudeRequest, channelModelConfigs); emulation != nil {
+		emulatedUsage, incrementalCharged, emulateErr := relayClaudeMessagesWithStructuredOutputEmulation(c, meta, chatRequest, emulation, ratio)
+		if emulateErr != nil {
+			_ = returnPreConsumedQuotaConservative(ctx, c, preConsumedQuota, c.GetInt(ctxkey.TokenId), "structured_output_emulation_failed")
+			return emulateErr
+		}
+		usage = emulatedUsage
+		mcpIncrementalCharged = incrementalCharged
+		goto postConsume
+	}
+
+	// Models without native function calling get their tools through the prompt.
+	if claudeRequestNeedsToolCallEmulation(c, meta, claudeRequest) {
+		emulatedUsage, incrementalCharged, emulateErr := relayClaudeMessagesWithToolCallEmulation(c, meta, adaptorInstance, claudeRequest, preConsumedQuota)
+		if emulateErr != nil {
+			_ = returnPreConsumedQuotaConservative(ctx, c, preConsumedQuota, c.GetInt(ctxkey.TokenId), "tool_call_emulation_failed")
+			return emulateErr
+		}
+		usage = emulatedUsage
+		mcpIncrementalCharged = incrementalCharged
+		goto postConsume
+	}
+
 	// Tool Search + MCP integration: when the request contains a tool_search_tool and
 	// there are MCP tools in the catalog, inject them as deferred tools and run a
 	// Claude-native MCP execution loop that handles tool discovery and execution.
@@ -414,6 +449,7 @@ handleResponse:
 		goto postConsume
 	}
 
+	guardrailWriter = beginGuardrailResponseCapture(c, meta)
 	if passthrough, ok := c.Get(ctxkey.ClaudeDirectPassthrough); ok && passthrough.(bool) && meta.IsStream {
 		// Streaming direct passthrough: forward Claude SSE events verbatim
 		// For AWS Bedrock, resp might be nil since it uses SDK calls
@@ -637,6 +673,7 @@ handleResponse:
 			}
 		}
 	}
+	finishGuardrailResponseCapture(c, meta, guardrail.FormatClaudeMessages, guardrailWriter, respErr == nil)
 
 	if respErr != nil {
 		lg.Error("Claude native response handler failed",
@@ -38,7 +38,7 @@ func preConsumeClaudeMessagesQuota(c *gin.Context, request *ClaudeMessagesReques
 	// Check user quota first
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return baseQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -59,7 +59,7 @@ func preConsumeClaudeMessagesQuota(c *gin.Context, request *ClaudeMessagesReques
 		if err != nil {
 			return baseQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
-		syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, baseQuota, "claude_messages_preconsume")
+		syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, meta.OrgId, baseQuota, "claude_messages_preconsume")
 	}
 
 	lg.Debug("pre-consumed quota for Claude Messages",
@@ -114,37 +114,42 @@ func postConsumeClaudeMessagesQuotaWithTraceID(ctx context.Context, requestId st
 	logPromptTokens := computeResult.PromptTokens + computeResult.CachedPromptTokens
 
 	billing.PostConsumeQuotaDetailed(billing.QuotaConsumeDetail{
-		Ctx:                ctx,
-		TokenId:            meta.TokenId,
-		QuotaDelta:         quotaDelta,
-		TotalQuota:         quota,
-		UserId:             meta.UserId,
-		UserUUID:           meta.UserUUID,
-		ChannelId:          meta.ChannelId,
-		ChannelUUID:        meta.ChannelUUID,
-		PromptTokens:       logPromptTokens,
-		CompletionTokens:   computeResult.CompletionTokens,
-		ModelRatio:         computeResult.UsedModelRatio,
-		GroupRatio:         groupRatio,
-		OriginModelName:    meta.OriginModelName,
-		ModelName:          request.Model,
-		TokenUUID:          meta.TokenUUID,
-		TokenName:          meta.TokenName,
-		IsStream:           meta.IsStream,
-		StartTime:          meta.StartTime,
-		SystemPromptReset:  false,
-		CompletionRatio:    computeResult.UsedCompletionRatio,
-		ToolsCost:          usage.ToolsCost,
-		CachedPromptTokens: computeResult.CachedPromptTokens,
-		CacheWrite5mTokens: usage.CacheWrite5mTokens,
-		CacheWrite1hTokens: usage.CacheWrite1hTokens,
-		Metadata:           metadata,
-		RequestId:          requestId,
-		TraceId:            traceId,
-		ProvisionalLogId:   provisionalLogId,
-		UserAPIFormat:      resolveUserAPIFormat(meta.Mode),
-		UpstreamAPIFormat:  apitype.String(meta.APIType),
-		UpstreamEndpoint:   meta.UpstreamRequestURL,
+		Ctx:                 ctx,
+		TokenId:             meta.TokenId,
+		QuotaDelta:          quotaDelta,
+		TotalQuota:          quota,
+		UserId:              meta.UserId,
+		UserUUID:            meta.UserUUID,
+		OrgId:               meta.OrgId,
+		ChannelId:           meta.ChannelId,
+		ChannelUUID:         meta.ChannelUUID,
+		PromptTokens:        logPromptTokens,
+		CompletionTokens:    computeResult.CompletionTokens,
+		ModelRatio:          computeResult.UsedModelRatio,
+		GroupRatio:          groupRatio,
+		OriginModelName:     meta.OriginModelName,
+		ServedModelName:     meta.ServedModelName,
+		GuardrailViolations: meta.GuardrailViolations,
+		ContextFit:          meta.ContextFit,
+		ParentRequestId:     meta.ParentRequestId,
+		ModelName:           request.Model,
+		TokenUUID:           meta.TokenUUID,
+		TokenName:           meta.TokenName,
+		IsStream:            meta.IsStream,
+		StartTime:           meta.StartTime,
+		SystemPromptReset:   false,
+		CompletionRatio:     computeResult.UsedCompletionRatio,
+		ToolsCost:           usage.ToolsCost,
+		CachedPromptTokens:  computeResult.CachedPromptTokens,
+		CacheWrite5mTokens:  usage.CacheWrite5mTokens,
+		CacheWrite1hTokens:  usage.CacheWrite1hTokens,
+		Metadata:            metadata,
+		RequestId:           requestId,
+		TraceId:             traceId,
+		ProvisionalLogId:    provisionalLogId,
+		UserAPIFormat:       resolveUserAPIFormat(meta.Mode),
+		UpstreamAPIFormat:   apitype.String(meta.APIType),
+		UpstreamEndpoint:    meta.UpstreamRequestURL,
 	})
 
 	// Log with context if available
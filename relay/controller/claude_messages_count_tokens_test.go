@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/channeltype"
+)
+
+func setupClaudeCountTokensContext(t *testing.T, recorder *httptest.ResponseRecorder, baseURL string, channelType int) *gin.Context {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(recorder)
+
+	payload := `{"model":"claude-alias","messages":[{"role":"user","content":"How many tokens is this sentence?"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+
+	gmw.SetLogger(c, logger.Logger)
+	c.Set(ctxkey.Channel, channelType)
+	c.Set(ctxkey.ChannelId, 1)
+	c.Set(ctxkey.ModelMapping, map[string]string{"claude-alias": "claude-sonnet-4-5"})
+	c.Set(ctxkey.RequestModel, "claude-alias")
+	c.Set(ctxkey.BaseURL, baseURL)
+	c.Set(ctxkey.ContentType, "application/json")
+	c.Set(ctxkey.ChannelModel, &model.Channel{Id: 1, Type: channelType})
+	c.Set(ctxkey.Config, model.ChannelConfig{})
+	return c
+}
+
+func TestRelayClaudeMessagesCountTokens_ForwardsToAnthropic(t *testing.T) {
+	var gotPath, gotModel string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		var decoded map[string]any
+		_ = json.Unmarshal(body, &decoded)
+		gotModel, _ = decoded["model"].(string)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"input_tokens":42}`))
+	}))
+	defer upstream.Close()
+
+	recorder := httptest.NewRecorder()
+	c := setupClaudeCountTokensContext(t, recorder, upstream.URL, channeltype.Anthropic)
+
+	require.Nil(t, RelayClaudeMessagesCountTokensHelper(c))
+	require.Equal(t, "/v1/messages/count_tokens", gotPath)
+	require.Equal(t, "claude-sonnet-4-5", gotModel)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `{"input_tokens":42}`, recorder.Body.String())
+}
+
+func TestRelayClaudeMessagesCountTokens_FallsBackToLocalEstimate(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	recorder := httptest.NewRecorder()
+	c := setupClaudeCountTokensContext(t, recorder, upstream.URL, channeltype.Anthropic)
+
+	require.Nil(t, RelayClaudeMessagesCountTokensHelper(c))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var resp claudeCountTokensResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	require.Positive(t, resp.InputTokens)
+}
+
+func TestRelayClaudeMessagesCountTokens_PassesUpstreamRejectionThrough(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"messages.0.content: Field required"}}`))
+	}))
+	defer upstream.Close()
+
+	recorder := httptest.NewRecorder()
+	c := setupClaudeCountTokensContext(t, recorder, upstream.URL, channeltype.Anthropic)
+
+	errResp := RelayClaudeMessagesCountTokensHelper(c)
+	require.NotNil(t, errResp, "a rejected request must not be answered with a local estimate")
+	require.Equal(t, http.StatusBadRequest, errResp.StatusCode)
+	require.Contains(t, errResp.Error.Message, "Field required")
+	require.Empty(t, recorder.Body.String())
+}
+
+func TestRelayClaudeMessagesCountTokens_RequiresMessages(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c := setupClaudeCountTokensContext(t, recorder, "http://127.0.0.1:1", channeltype.OpenAI)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(`{"model":"claude-alias","messages":[]}`))
+
+	errResp := RelayClaudeMessagesCountTokensHelper(c)
+	require.NotNil(t, errResp)
+	require.Equal(t, http.StatusBadRequest, errResp.StatusCode)
+}
@@ -1,15 +1,29 @@
 package controller
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
 
+	"github.com/Laisky/errors/v2"
 	gmw "github.com/Laisky/gin-middlewares/v7"
 	"github.com/Laisky/zap"
-
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/relay"
+	"github.com/Laisky/one-api/relay/adaptor"
+	"github.com/Laisky/one-api/relay/adaptor/aws"
+	awsclaude "github.com/Laisky/one-api/relay/adaptor/aws/claude"
 	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/adaptor/vertexai"
+	"github.com/Laisky/one-api/relay/apitype"
+	metalib "github.com/Laisky/one-api/relay/meta"
 	relaymodel "github.com/Laisky/one-api/relay/model"
 )
 
@@ -20,6 +34,188 @@ const claudeFileImageFallbackTokens = 853
 // tokenization of bodies above this size takes hundreds of milliseconds.
 const fastTokenEstimateThreshold = 1 * 1024 * 1024 // 1MB
 
+// claudeCountTokensResponse is the body returned by /v1/messages/count_tokens.
+type claudeCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
+// countTokensRejectedError is a 4xx answer of a provider's count_tokens API.
+// The provider turned the request down, so the answer goes back to the client
+// instead of being masked by a local estimate.
+type countTokensRejectedError struct {
+	relayErr *relaymodel.ErrorWithStatusCode
+}
+
+func (e *countTokensRejectedError) Error() string {
+	return fmt.Sprintf("count_tokens rejected with status %d: %s", e.relayErr.StatusCode, e.relayErr.Error.Message)
+}
+
+// RelayClaudeMessagesCountTokensHelper handles POST /v1/messages/count_tokens.
+// Anthropic, Vertex AI Claude and Bedrock Claude channels answer with the
+// provider's own count; other channels, and native calls that fail on the
+// transport or with a 5xx, get a local tokenizer estimate. A 4xx from the
+// provider is returned to the client. The endpoint never consumes quota.
+func RelayClaudeMessagesCountTokensHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	lg := gmw.GetLogger(c)
+	meta := metalib.GetByContext(c)
+	meta.IsStream = false
+	if err := logClientRequestPayload(c, "claude_messages_count_tokens"); err != nil {
+		return openai.ErrorWrapper(err, "invalid_count_tokens_request", http.StatusBadRequest)
+	}
+
+	request := &ClaudeMessagesRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		return openai.ErrorWrapper(errors.Wrap(err, "unmarshal count tokens request"), "invalid_count_tokens_request", http.StatusBadRequest)
+	}
+	if request.Model == "" {
+		return openai.ErrorWrapper(errors.New("model is required"), "invalid_count_tokens_request", http.StatusBadRequest)
+	}
+	if len(request.Messages) == 0 {
+		return openai.ErrorWrapper(errors.New("messages array cannot be empty"), "invalid_count_tokens_request", http.StatusBadRequest)
+	}
+	meta.OriginModelName = request.Model
+	request.Model = meta.ActualModelName
+	metalib.Set2Context(c, meta)
+
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+
+	inputTokens, native, err := countClaudeTokensNatively(c, meta, body)
+	var rejected *countTokensRejectedError
+	if errors.As(err, &rejected) {
+		return rejected.relayErr
+	}
+	if err != nil {
+		lg.Warn("native count_tokens failed, falling back to local estimate",
+			zap.Error(err),
+			zap.String("model", meta.ActualModelName))
+	}
+	if !native || err != nil {
+		inputTokens = getClaudeMessagesPromptTokens(gmw.Ctx(c), request)
+	}
+
+	c.JSON(http.StatusOK, claudeCountTokensResponse{InputTokens: inputTokens})
+	return nil
+}
+
+// countClaudeTokensNatively asks the channel's provider to count the tokens of
+// body. native is false when the channel has no count_tokens API for the model.
+func countClaudeTokensNatively(c *gin.Context, meta *metalib.Meta, body []byte) (tokens int, native bool, err error) {
+	switch {
+	case meta.APIType == apitype.Anthropic:
+		payload, err := setClaudeCountTokensFields(body, map[string]any{"model": meta.ActualModelName})
+		if err != nil {
+			return 0, true, err
+		}
+		tokens, err = doClaudeCountTokensRequest(c, meta, payload, func(messagesURL string) string {
+			return messagesURL + "/count_tokens"
+		})
+		return tokens, true, err
+	case meta.APIType == apitype.VertexAI && vertexai.IsClaudeModel(meta.ActualModelName):
+		payload, err := setClaudeCountTokensFields(body, map[string]any{
+			"model":             meta.ActualModelName,
+			"anthropic_version": "vertex-2023-10-16",
+		})
+		if err != nil {
+			return 0, true, err
+		}
+		tokens, err = doClaudeCountTokensRequest(c, meta, payload, func(rawPredictURL string) string {
+			idx := strings.LastIndex(rawPredictURL, "/models/")
+			if idx < 0 {
+				return rawPredictURL
+			}
+			return rawPredictURL[:idx] + "/models/count-tokens:rawPredict"
+		})
+		return tokens, true, err
+	case meta.APIType == apitype.AwsClaude:
+		if _, err := awsclaude.AwsModelID(meta.ActualModelName); err != nil {
+			return 0, false, nil
+		}
+		awsAdaptor, ok := relay.GetAdaptor(apitype.AwsClaude).(*aws.Adaptor)
+		if !ok {
+			return 0, false, nil
+		}
+		awsAdaptor.Init(meta)
+		tokens, err = awsclaude.CountTokens(gmw.Ctx(c), awsAdaptor.AwsClient, meta.ActualModelName, body)
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() >= http.StatusBadRequest && respErr.HTTPStatusCode() < http.StatusInternalServerError {
+			return 0, true, &countTokensRejectedError{
+				relayErr: openai.ErrorWrapper(err, "count_tokens_rejected", respErr.HTTPStatusCode()),
+			}
+		}
+		return tokens, true, err
+	default:
+		return 0, false, nil
+	}
+}
+
+// claudeCountTokensAdaptor reuses an adaptor's authentication and transport while
+// pointing the request at the provider's count_tokens endpoint.
+type claudeCountTokensAdaptor struct {
+	adaptor.Adaptor
+	rewriteURL func(string) string
+}
+
+func (a *claudeCountTokensAdaptor) GetRequestURL(meta *metalib.Meta) (string, error) {
+	upstreamURL, err := a.Adaptor.GetRequestURL(meta)
+	if err != nil {
+		return "", errors.Wrap(err, "get upstream url")
+	}
+	return a.rewriteURL(upstreamURL), nil
+}
+
+func doClaudeCountTokensRequest(c *gin.Context, meta *metalib.Meta, payload []byte, rewriteURL func(string) string) (int, error) {
+	requestAdaptor := relay.GetAdaptor(meta.APIType)
+	if requestAdaptor == nil {
+		return 0, errors.Errorf("invalid api type: %d", meta.APIType)
+	}
+	requestAdaptor.Init(meta)
+	countAdaptor := &claudeCountTokensAdaptor{Adaptor: requestAdaptor, rewriteURL: rewriteURL}
+	resp, err := adaptor.DoRequestHelper(countAdaptor, c, meta, bytes.NewReader(payload))
+	if err != nil {
+		return 0, errors.Wrap(err, "do count_tokens request")
+	}
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError {
+		return 0, &countTokensRejectedError{relayErr: RelayErrorHandlerWithContext(c, resp)}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, errors.Wrap(err, "read count_tokens response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.Errorf("count_tokens upstream returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	var parsed claudeCountTokensResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return 0, errors.Wrap(err, "unmarshal count_tokens response")
+	}
+	return parsed.InputTokens, nil
+}
+
+// setClaudeCountTokensFields overwrites top-level fields of a raw JSON payload.
+func setClaudeCountTokensFields(body []byte, fields map[string]any) ([]byte, error) {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal count tokens request")
+	}
+	for key, value := range fields {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "marshal field %s", key)
+		}
+		payload[key] = encoded
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal count tokens request")
+	}
+	return encoded, nil
+}
+
 // estimateClaudeMessagesPromptTokens picks between fast byte-based estimation
 // (for large bodies) and accurate tokenizer-based counting (for small bodies).
 // The fast path uses bodySize/4 as a rough approximation (1 token ≈ 4 bytes on average).
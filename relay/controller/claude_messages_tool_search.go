@@ -558,7 +558,7 @@ func preConsumeQuotaForMCPRound(c *gin.Context, meta *metalib.Meta, quota int64)
 		return nil
 	}
 	ctx := gmw.Ctx(c)
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return errors.Wrap(err, "get user quota for MCP round")
 	}
@@ -568,7 +568,7 @@ func preConsumeQuotaForMCPRound(c *gin.Context, meta *metalib.Meta, quota int64)
 	if err := model.PreConsumeTokenQuota(ctx, meta.TokenId, quota); err != nil {
 		return errors.Wrap(err, "pre-consume token quota for MCP round")
 	}
-	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, quota, "claude_mcp_round_preconsume")
+	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, meta.OrgId, quota, "claude_mcp_round_preconsume")
 	return nil
 }
 
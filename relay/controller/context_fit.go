@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/contextfit"
+	metalib "github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+// contextStrategyHeader lets a client pick the context strategy of one request,
+// overriding the strategy of its token. The value "off" disables fitting.
+const contextStrategyHeader = "X-OneAPI-Context-Strategy"
+
+// resolveContextStrategy returns the context strategy of the request, or ""
+// when oversized requests are relayed as sent.
+func resolveContextStrategy(c *gin.Context) (string, error) {
+	strategy := c.GetString(ctxkey.ContextStrategy)
+	header := strings.ToLower(strings.TrimSpace(c.GetHeader(contextStrategyHeader)))
+	switch {
+	case header == "":
+	case header == contextfit.StrategyOff:
+		strategy = ""
+	case contextfit.IsValidStrategy(header):
+		strategy = header
+	default:
+		return "", errors.Errorf("%s must be reject, truncate, summarize or off, got %q", contextStrategyHeader, header)
+	}
+	return strategy, nil
+}
+
+// contextWindow returns the context length of modelName and the tokens the
+// request reserves for the reply. The channel's ModelConfigs override the
+// adaptor metadata field by field; a context length of 0 means it is unknown.
+func contextWindow(meta *metalib.Meta, request *relaymodel.GeneralOpenAIRequest, channelModelConfigs map[string]model.ModelConfigLocal) (contextLength, reserved int) {
+	var maxOutput int
+	if cfg, ok := channelModelConfigs[request.Model]; ok {
+		contextLength, maxOutput = int(cfg.ContextLength), int(cfg.MaxOutputTokens)
+	}
+	if pricingAdaptor := resolvePricingAdaptor(meta); pricingAdaptor != nil {
+		if cfg, ok := pricingAdaptor.GetDefaultModelPricing()[request.Model]; ok {
+			if contextLength == 0 {
+				contextLength = int(cfg.ContextLength)
+			}
+			if maxOutput == 0 {
+				maxOutput = int(cfg.MaxOutputTokens)
+			}
+		}
+	}
+
+	reserved = request.MaxTokens
+	if request.MaxCompletionTokens != nil {
+		reserved = *request.MaxCompletionTokens
+	}
+	if maxOutput > 0 && reserved > maxOutput {
+		reserved = maxOutput
+	}
+	return contextLength, reserved
+}
+
+// fitChatRequestContext applies the request's context strategy to a chat
+// request whose messages exceed the model context window. The fitted messages
+// replace request.Messages and the outcome is kept on meta.ContextFit for the
+// consume log.
+//
+// A retry on another channel starts from the conversation fitted for the
+// previous one, so a summary is never requested twice for the same request.
+func fitChatRequestContext(c *gin.Context, meta *metalib.Meta, request *relaymodel.GeneralOpenAIRequest, channelModelConfigs map[string]model.ModelConfigLocal) *relaymodel.ErrorWithStatusCode {
+	strategy, err := resolveContextStrategy(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_context_strategy", http.StatusBadRequest)
+	}
+	if strategy == "" {
+		return nil
+	}
+	lg := gmw.GetLogger(c)
+	contextLength, reserved := contextWindow(meta, request, channelModelConfigs)
+	if contextLength <= 0 {
+		lg.Debug("context window of model is unknown, skip context fitting", zap.String("model", request.Model))
+		return nil
+	}
+
+	previous := meta.ContextFit
+	if previous != nil {
+		request.Messages = previous.Messages
+		if strategy == contextfit.StrategySummarize {
+			strategy = contextfit.StrategyTruncate
+		}
+	}
+
+	ctx := gmw.Ctx(c)
+	budget := contextLength - reserved
+	result, err := contextfit.Fit(ctx, contextfit.Request{
+		Strategy: strategy,
+		Messages: request.Messages,
+		Budget:   budget,
+		Count: func(messages []relaymodel.Message) int {
+			return openai.CountTokenMessages(ctx, messages, request.Model)
+		},
+		SummaryModel:     config.ContextSummaryModel,
+		SummaryMaxTokens: config.ContextSummaryMaxTokens,
+		TokenId:          meta.TokenId,
+		ParentRequestId:  c.GetString(ctxkey.RequestId),
+	})
+	if err != nil {
+		var exceeded *contextfit.ExceededError
+		if errors.As(err, &exceeded) {
+			return openai.ErrorWrapper(errors.Errorf(
+				"this model's maximum context length is %d tokens, %d of which are reserved for the reply, but the prompt needs %d tokens (context strategy %s)",
+				contextLength, reserved, exceeded.PromptTokens, strategy), "context_length_exceeded", http.StatusBadRequest)
+		}
+		return openai.ErrorWrapper(err, "context_fit_failed", http.StatusInternalServerError)
+	}
+	if result == nil {
+		return nil
+	}
+
+	if previous != nil {
+		result.Strategy = previous.Strategy
+		result.PromptTokensBefore = previous.PromptTokensBefore
+		result.DroppedMessages += previous.DroppedMessages
+		result.SummaryRequestId = previous.SummaryRequestId
+		if result.SummaryError == "" {
+			result.SummaryError = previous.SummaryError
+		}
+	}
+	request.Messages = result.Messages
+	meta.ContextFit = result
+	lg.Info("fitted oversized conversation into the context window",
+		zap.String("strategy", result.Strategy),
+		zap.Int("context_length", contextLength),
+		zap.Int("reserved_output", reserved),
+		zap.Int("prompt_tokens_before", result.PromptTokensBefore),
+		zap.Int("prompt_tokens_after", result.PromptTokensAfter),
+		zap.Int("dropped_messages", result.DroppedMessages),
+		zap.String("summary_request_id", result.SummaryRequestId),
+		zap.String("summary_error", result.SummaryError))
+	return nil
+}
+
+// rejectUnsupportedContextStrategy fails a request relayed in a format that
+// cannot be fitted while a context strategy is in effect, rather than
+// silently relaying an oversized conversation. Clients opt out with the
+// header value "off".
+func rejectUnsupportedContextStrategy(c *gin.Context, endpoint string) *relaymodel.ErrorWithStatusCode {
+	strategy, err := resolveContextStrategy(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_context_strategy", http.StatusBadRequest)
+	}
+	if strategy == "" {
+		return nil
+	}
+	return openai.ErrorWrapper(errors.Errorf(
+		"context strategy %s is not supported for %s requests; send %s: off to relay the request as sent",
+		strategy, endpoint, contextStrategyHeader), "unsupported_context_strategy", http.StatusBadRequest)
+}
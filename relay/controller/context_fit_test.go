@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/apitype"
+	"github.com/Laisky/one-api/relay/channeltype"
+	"github.com/Laisky/one-api/relay/contextfit"
+	metalib "github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+func contextFitTestContext(t *testing.T, tokenStrategy, header string) *gin.Context {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if header != "" {
+		c.Request.Header.Set(contextStrategyHeader, header)
+	}
+	gmw.SetLogger(c, logger.Logger)
+	c.Set(ctxkey.ContextStrategy, tokenStrategy)
+	return c
+}
+
+// contextFitTestRequest returns a long conversation whose latest turn is short.
+func contextFitTestRequest() *relaymodel.GeneralOpenAIRequest {
+	request := &relaymodel.GeneralOpenAIRequest{
+		Model:    "mock-chat",
+		Messages: []relaymodel.Message{{Role: "system", Content: "You are terse."}},
+	}
+	for range 10 {
+		request.Messages = append(request.Messages,
+			relaymodel.Message{Role: "user", Content: strings.Repeat("tell me more about the history of Rome ", 2)},
+			relaymodel.Message{Role: "assistant", Content: strings.Repeat("Rome was founded long ago and grew ", 2)},
+		)
+	}
+	request.Messages = append(request.Messages, relaymodel.Message{Role: "user", Content: "Thanks!"})
+	return request
+}
+
+func TestResolveContextStrategy(t *testing.T) {
+	strategy, err := resolveContextStrategy(contextFitTestContext(t, contextfit.StrategyReject, ""))
+	require.NoError(t, err)
+	require.Equal(t, contextfit.StrategyReject, strategy)
+
+	strategy, err = resolveContextStrategy(contextFitTestContext(t, contextfit.StrategyReject, " Truncate "))
+	require.NoError(t, err)
+	require.Equal(t, contextfit.StrategyTruncate, strategy)
+
+	strategy, err = resolveContextStrategy(contextFitTestContext(t, contextfit.StrategyReject, "off"))
+	require.NoError(t, err)
+	require.Empty(t, strategy)
+
+	_, err = resolveContextStrategy(contextFitTestContext(t, "", "shrink"))
+	require.Error(t, err)
+}
+
+func TestRejectUnsupportedContextStrategy(t *testing.T) {
+	require.Nil(t, rejectUnsupportedContextStrategy(contextFitTestContext(t, "", ""), "Claude Messages"))
+	require.Nil(t, rejectUnsupportedContextStrategy(contextFitTestContext(t, contextfit.StrategyTruncate, "off"), "Claude Messages"))
+
+	bizErr := rejectUnsupportedContextStrategy(contextFitTestContext(t, contextfit.StrategyTruncate, ""), "Claude Messages")
+	require.NotNil(t, bizErr)
+	require.Equal(t, http.StatusBadRequest, bizErr.StatusCode)
+	require.Equal(t, "unsupported_context_strategy", bizErr.Code)
+	require.Contains(t, bizErr.Message, "Claude Messages")
+
+	bizErr = rejectUnsupportedContextStrategy(contextFitTestContext(t, "", "shrink"), "Claude Messages")
+	require.NotNil(t, bizErr)
+	require.Equal(t, "invalid_context_strategy", bizErr.Code)
+}
+
+func TestContextWindow(t *testing.T) {
+	meta := &metalib.Meta{APIType: apitype.Mock, ChannelType: channeltype.Mock}
+	request := &relaymodel.GeneralOpenAIRequest{Model: "mock-chat", MaxTokens: 100000}
+
+	contextLength, reserved := contextWindow(meta, request, nil)
+	require.Equal(t, 128000, contextLength)
+	require.Equal(t, 16384, reserved, "the reply reservation is capped by the model's output limit")
+
+	completionTokens := 500
+	request.MaxCompletionTokens = &completionTokens
+	contextLength, reserved = contextWindow(meta, request, map[string]model.ModelConfigLocal{"mock-chat": {ContextLength: 8000}})
+	require.Equal(t, 8000, contextLength)
+	require.Equal(t, 500, reserved)
+
+	contextLength, _ = contextWindow(meta, &relaymodel.GeneralOpenAIRequest{Model: "unknown-model"}, nil)
+	require.Zero(t, contextLength)
+}
+
+func TestFitChatRequestContext(t *testing.T) {
+	meta := &metalib.Meta{APIType: apitype.Mock, ChannelType: channeltype.Mock}
+	configs := map[string]model.ModelConfigLocal{"mock-chat": {ContextLength: 300}}
+
+	request := contextFitTestRequest()
+	bizErr := fitChatRequestContext(contextFitTestContext(t, contextfit.StrategyReject, ""), meta, request, configs)
+	require.NotNil(t, bizErr)
+	require.Equal(t, http.StatusBadRequest, bizErr.StatusCode)
+	require.Equal(t, "context_length_exceeded", bizErr.Code)
+	require.Contains(t, bizErr.Message, "maximum context length is 300 tokens")
+	require.Nil(t, meta.ContextFit)
+
+	request = contextFitTestRequest()
+	require.Nil(t, fitChatRequestContext(contextFitTestContext(t, contextfit.StrategyReject, "off"), meta, request, configs))
+	require.Len(t, request.Messages, 22)
+
+	request = contextFitTestRequest()
+	require.Nil(t, fitChatRequestContext(contextFitTestContext(t, contextfit.StrategyReject, "truncate"), meta, request, configs))
+	require.NotNil(t, meta.ContextFit)
+	require.Equal(t, contextfit.StrategyTruncate, meta.ContextFit.Strategy)
+	require.Less(t, len(request.Messages), 22)
+	require.Equal(t, "system", request.Messages[0].Role)
+	require.Equal(t, "user", request.Messages[1].Role)
+	require.Equal(t, "Thanks!", request.Messages[len(request.Messages)-1].StringContent())
+	require.LessOrEqual(t, meta.ContextFit.PromptTokensAfter, 300)
+	first := *meta.ContextFit
+
+	// A retry on a channel with a smaller window continues from the fitted
+	// conversation and keeps the original prompt size in the log metadata.
+	request = contextFitTestRequest()
+	smaller := map[string]model.ModelConfigLocal{"mock-chat": {ContextLength: 150}}
+	require.Nil(t, fitChatRequestContext(contextFitTestContext(t, contextfit.StrategyTruncate, ""), meta, request, smaller))
+	require.Equal(t, first.PromptTokensBefore, meta.ContextFit.PromptTokensBefore)
+	require.Greater(t, meta.ContextFit.DroppedMessages, first.DroppedMessages)
+	require.LessOrEqual(t, meta.ContextFit.PromptTokensAfter, 150)
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/model"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+// uploadableFilePurposes are the purposes a client may upload with. The
+// batch_output purpose is reserved for files written by the batch executor.
+var uploadableFilePurposes = map[string]bool{
+	model.RelayFilePurposeBatch: true,
+	"assistants":                true,
+	"fine-tune":                 true,
+	"vision":                    true,
+	"user_data":                 true,
+	"evals":                     true,
+}
+
+// fileObject is the OpenAI File object.
+type fileObject struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Status    string `json:"status"`
+}
+
+func renderFile(file *model.RelayFile) fileObject {
+	return fileObject{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+	}
+}
+
+// mapRelayFileError converts a model error into the API error. Unknown and
+// foreign ids share the same not-found shape.
+func mapRelayFileError(err error, id string) *relaymodel.ErrorWithStatusCode {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return stateErrorf("not_found", http.StatusNotFound, "No such File object: %s", id)
+	}
+	return stateErrorf("file_error", http.StatusInternalServerError, "file operation failed: %v", err)
+}
+
+// listLimit parses the limit query parameter, clamped to [1, 100].
+func listLimit(c *gin.Context, defaultLimit int) int {
+	limit := defaultLimit
+	if l := c.Query("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	return min(limit, 100)
+}
+
+// FileUploadHelper handles POST /v1/files (multipart: file, purpose).
+func FileUploadHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	purpose := c.PostForm("purpose")
+	if !uploadableFilePurposes[purpose] {
+		return stateErrorf("invalid_request_error", http.StatusBadRequest, "invalid purpose: %q", purpose)
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return stateErrorf("invalid_request_error", http.StatusBadRequest, "file is required: %v", err)
+	}
+	if header.Size > config.FileMaxBytes {
+		return stateErrorf("invalid_request_error", http.StatusRequestEntityTooLarge,
+			"file is %d bytes, the limit is %d bytes", header.Size, config.FileMaxBytes)
+	}
+	reader, err := header.Open()
+	if err != nil {
+		return stateErrorf("invalid_request_error", http.StatusBadRequest, "open uploaded file: %v", err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(io.LimitReader(reader, config.FileMaxBytes+1))
+	if err != nil {
+		return stateErrorf("invalid_request_error", http.StatusBadRequest, "read uploaded file: %v", err)
+	}
+	if int64(len(content)) > config.FileMaxBytes {
+		return stateErrorf("invalid_request_error", http.StatusRequestEntityTooLarge,
+			"file exceeds the limit of %d bytes", config.FileMaxBytes)
+	}
+	if purpose == model.RelayFilePurposeBatch {
+		if _, err := ParseBatchInput(content, ""); err != nil {
+			return stateErrorf("invalid_request_error", http.StatusBadRequest, "invalid batch input file: %v", err)
+		}
+	}
+
+	file := &model.RelayFile{
+		UserId:   c.GetInt(ctxkey.Id),
+		TokenId:  c.GetInt(ctxkey.TokenId),
+		Purpose:  purpose,
+		Filename: header.Filename,
+		Content:  content,
+	}
+	if err := model.CreateRelayFile(gmw.Ctx(c), file); err != nil {
+		return stateErrorf("file_error", http.StatusInternalServerError, "store file: %v", err)
+	}
+	return writeJSON(c, http.StatusOK, renderFile(file))
+}
+
+// FileListHelper handles GET /v1/files.
+func FileListHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	limit := listLimit(c, 100)
+	after := c.Query("after")
+	files, err := model.ListRelayFiles(gmw.Ctx(c), c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId),
+		c.Query("purpose"), after, limit+1)
+	if err != nil {
+		return mapRelayFileError(err, after)
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	data := make([]fileObject, 0, len(files))
+	for _, file := range files {
+		data = append(data, renderFile(file))
+	}
+	payload := gin.H{"object": "list", "data": data, "has_more": hasMore}
+	if len(data) > 0 {
+		payload["first_id"] = data[0].Id
+		payload["last_id"] = data[len(data)-1].Id
+	}
+	return writeJSON(c, http.StatusOK, payload)
+}
+
+// FileGetHelper handles GET /v1/files/{id}.
+func FileGetHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	id := c.Param("id")
+	file, err := model.GetRelayFile(gmw.Ctx(c), c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId), id)
+	if err != nil {
+		return mapRelayFileError(err, id)
+	}
+	return writeJSON(c, http.StatusOK, renderFile(file))
+}
+
+// FileContentHelper handles GET /v1/files/{id}/content.
+func FileContentHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	id := c.Param("id")
+	file, err := model.GetRelayFileContent(gmw.Ctx(c), c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId), id)
+	if err != nil {
+		return mapRelayFileError(err, id)
+	}
+	contentType := "application/octet-stream"
+	if file.Purpose == model.RelayFilePurposeBatch || file.Purpose == model.RelayFilePurposeBatchOutput {
+		contentType = "application/jsonl"
+	}
+	c.Data(http.StatusOK, contentType, file.Content)
+	return nil
+}
+
+// FileDeleteHelper handles DELETE /v1/files/{id}.
+func FileDeleteHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	id := c.Param("id")
+	if err := model.DeleteRelayFile(gmw.Ctx(c), c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId), id); err != nil {
+		return mapRelayFileError(err, id)
+	}
+	return writeJSON(c, http.StatusOK, gin.H{"id": id, "object": "file", "deleted": true})
+}
@@ -0,0 +1,674 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/metrics"
+	"github.com/Laisky/one-api/common/render"
+	commonsse "github.com/Laisky/one-api/common/sse"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay"
+	"github.com/Laisky/one-api/relay/adaptor"
+	"github.com/Laisky/one-api/relay/adaptor/gemini"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
+	"github.com/Laisky/one-api/relay/adaptor/vertexai"
+	"github.com/Laisky/one-api/relay/apitype"
+	"github.com/Laisky/one-api/relay/channeltype"
+	metalib "github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/pricing"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+// RelayGeminiNativeHelper handles the Google Gemini native endpoints
+// (/v1beta/models/{model}:{action}). Gemini and Vertex AI Gemini channels receive
+// the payload verbatim; any other channel is served by converting the request to
+// the OpenAI chat or embeddings format and converting the response back.
+func RelayGeminiNativeHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	meta := metalib.GetByContext(c)
+	// meta is cached on the context and reused across retries, and the converted
+	// path switches Mode to the OpenAI endpoint it relays through.
+	meta.Mode = relaymode.GeminiNative
+	if err := logClientRequestPayload(c, "gemini_native"); err != nil {
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+
+	modelName, action := relaymode.ParseGeminiNativePath(c.Request.URL.Path)
+	if modelName == "" {
+		return openai.ErrorWrapper(errors.New("missing model or action in request path"), "invalid_gemini_request", http.StatusBadRequest)
+	}
+	meta.OriginModelName = modelName
+
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+
+	switch action {
+	case gemini.ActionGenerateContent:
+		return relayGeminiGenerateContent(c, meta, body, false)
+	case gemini.ActionStreamGenerateContent:
+		return relayGeminiGenerateContent(c, meta, body, true)
+	case gemini.ActionCountTokens:
+		return relayGeminiCountTokens(c, meta, body)
+	case gemini.ActionEmbedContent:
+		return relayGeminiEmbedContent(c, meta, body)
+	default:
+		return openai.ErrorWrapper(errors.Errorf("unsupported gemini action %q", action), "unsupported_gemini_action", http.StatusNotFound)
+	}
+}
+
+// geminiNativeURLAdaptor reuses an adaptor's request pipeline (URL building,
+// authentication, proxies) while targeting a specific native Gemini action.
+type geminiNativeURLAdaptor struct {
+	adaptor.Adaptor
+	action string
+	stream bool
+}
+
+func (a *geminiNativeURLAdaptor) GetRequestURL(meta *metalib.Meta) (string, error) {
+	upstreamURL, err := a.Adaptor.GetRequestURL(meta)
+	if err != nil {
+		return "", errors.Wrap(err, "get upstream url")
+	}
+	return gemini.RewriteNativeAction(upstreamURL, a.action, a.stream)
+}
+
+func (a *geminiNativeURLAdaptor) DoRequest(c *gin.Context, meta *metalib.Meta, requestBody io.Reader) (*http.Response, error) {
+	return adaptor.DoRequestHelper(a, c, meta, requestBody)
+}
+
+// servesGeminiNatively reports whether the selected channel speaks the Gemini
+// REST protocol for the requested model.
+func servesGeminiNatively(meta *metalib.Meta) bool {
+	switch meta.APIType {
+	case apitype.Gemini:
+		return true
+	case apitype.VertexAI:
+		return vertexai.IsGeminiModel(meta.ActualModelName)
+	default:
+		return false
+	}
+}
+
+// doGeminiNativeRequest forwards body to the channel's native action endpoint.
+func doGeminiNativeRequest(c *gin.Context, meta *metalib.Meta, action string, stream bool, body []byte) (*http.Response, error) {
+	requestAdaptor := relay.GetAdaptor(meta.APIType)
+	if requestAdaptor == nil {
+		return nil, errors.Errorf("invalid api type: %d", meta.APIType)
+	}
+	requestAdaptor.Init(meta)
+	nativeAdaptor := &geminiNativeURLAdaptor{Adaptor: requestAdaptor, action: action, stream: stream}
+	return nativeAdaptor.DoRequest(c, meta, bytes.NewReader(body))
+}
+
+// rewriteGeminiNativeModelField points the optional model fields of a native
+// payload at the mapped upstream model.
+func rewriteGeminiNativeModelField(body []byte, modelName string) []byte {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return body
+	}
+	upstreamModel, _ := json.Marshal("models/" + modelName)
+	changed := false
+	if _, ok := raw["model"]; ok {
+		raw["model"] = upstreamModel
+		changed = true
+	}
+	for _, key := range []string{"generateContentRequest", "generate_content_request"} {
+		inner, ok := raw[key]
+		if !ok {
+			continue
+		}
+		var innerMap map[string]json.RawMessage
+		if err := json.Unmarshal(inner, &innerMap); err != nil {
+			continue
+		}
+		innerMap["model"] = upstreamModel
+		if encoded, err := json.Marshal(innerMap); err == nil {
+			raw[key] = encoded
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+	rewritten, err := json.Marshal(raw)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// relayGeminiCountTokens answers countTokens. It is never billed: Gemini channels
+// forward to the upstream countTokens endpoint, others return a local estimate.
+func relayGeminiCountTokens(c *gin.Context, meta *metalib.Meta, body []byte) *relaymodel.ErrorWithStatusCode {
+	request, err := gemini.ParseNativeChatRequest(body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	meta.IsStream = false
+
+	if !servesGeminiNatively(meta) {
+		chatRequest, err := gemini.NativeRequestToOpenAI(request, meta.ActualModelName)
+		if err != nil {
+			return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+		}
+		c.JSON(http.StatusOK, gemini.CountTokensResponse{
+			TotalTokens: openai.CountTokenMessages(gmw.Ctx(c), chatRequest.Messages, meta.ActualModelName),
+		})
+		return nil
+	}
+
+	resp, err := doGeminiNativeRequest(c, meta, gemini.ActionCountTokens, false, rewriteGeminiNativeModelField(body, meta.ActualModelName))
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		return RelayErrorHandlerWithContext(c, resp)
+	}
+	return copyGeminiNativeResponse(c, resp)
+}
+
+// copyGeminiNativeResponse writes an upstream JSON response to the client verbatim.
+func copyGeminiNativeResponse(c *gin.Context, resp *http.Response) *relaymodel.ErrorWithStatusCode {
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	c.Data(resp.StatusCode, contentType, responseBody)
+	return nil
+}
+
+// relayGeminiEmbedContent handles embedContent with the embeddings billing pipeline.
+func relayGeminiEmbedContent(c *gin.Context, meta *metalib.Meta, body []byte) *relaymodel.ErrorWithStatusCode {
+	lg := gmw.GetLogger(c)
+	ctx := gmw.Ctx(c)
+
+	nativeRequest, err := gemini.ParseNativeEmbeddingRequest(body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	embeddingRequest, err := gemini.NativeEmbeddingRequestToOpenAI(nativeRequest, meta.ActualModelName)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	meta.Mode = relaymode.Embeddings
+	meta.IsStream = false
+	metalib.Set2Context(c, meta)
+
+	billing, bizErr := preConsumeGeminiNative(c, meta, embeddingRequest)
+	if bizErr != nil {
+		return bizErr
+	}
+	defer billingAuditSafetyNet(c)
+
+	var (
+		resp    *http.Response
+		usage   *relaymodel.Usage
+		capture *responseCaptureWriter
+	)
+	native := servesGeminiNatively(meta)
+	if native {
+		resp, err = doGeminiNativeRequest(c, meta, gemini.ActionEmbedContent, false, rewriteGeminiNativeModelField(body, meta.ActualModelName))
+	} else {
+		resp, err = doGeminiConvertedRequest(c, meta, relaymode.Embeddings, "/v1/embeddings", embeddingRequest)
+	}
+	if err != nil {
+		_ = returnPreConsumedQuotaConservative(ctx, c, billing.preConsumedQuota, meta.TokenId, "do_request_failed")
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	upstreamCapture := wrapUpstreamResponse(resp)
+	billing.recordProvisionalCost(c, embeddingRequest)
+
+	if isErrorHappened(meta, resp) {
+		scheduleConservativeRefund(c, billing.preConsumedQuota, meta.TokenId, "upstream_http_error")
+		return RelayErrorHandlerWithContext(c, resp)
+	}
+
+	var respErr *relaymodel.ErrorWithStatusCode
+	if native {
+		respErr = copyGeminiNativeResponse(c, resp)
+		usage = &relaymodel.Usage{PromptTokens: billing.promptUsage.PromptTokens, TotalTokens: billing.promptUsage.PromptTokens}
+	} else {
+		origWriter := c.Writer
+		capture = newResponseCaptureWriter(origWriter)
+		c.Writer = capture
+		usage, respErr = relay.GetAdaptor(meta.APIType).DoResponse(c, resp, meta)
+		c.Writer = origWriter
+		if respErr == nil {
+			nativeResponse, err := gemini.OpenAIEmbeddingToNative(capture.BodyBytes())
+			if err != nil {
+				respErr = openai.ErrorWrapper(err, "response_rewrite_failed", http.StatusInternalServerError)
+			} else {
+				c.JSON(http.StatusOK, nativeResponse)
+			}
+		}
+	}
+	if upstreamCapture != nil {
+		logUpstreamResponseFromCapture(lg, resp, upstreamCapture, "gemini_embed_content")
+	} else {
+		logUpstreamResponseFromBytes(lg, resp, nil, "gemini_embed_content")
+	}
+	if respErr != nil && usage == nil {
+		scheduleConservativeRefund(c, billing.preConsumedQuota, meta.TokenId, "do_response_failed_without_usage")
+		return respErr
+	}
+
+	meta.Mode = relaymode.GeminiNative
+	billing.settle(c, meta, embeddingRequest, usage)
+	return nil
+}
+
+// relayGeminiGenerateContent handles generateContent and streamGenerateContent.
+// The request is always converted to the OpenAI chat format so that prompt
+// estimation and billing share the chat completion pipeline.
+func relayGeminiGenerateContent(c *gin.Context, meta *metalib.Meta, body []byte, stream bool) *relaymodel.ErrorWithStatusCode {
+	lg := gmw.GetLogger(c)
+	ctx := gmw.Ctx(c)
+
+	nativeRequest, err := gemini.ParseNativeChatRequest(body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	chatRequest, err := gemini.NativeRequestToOpenAI(nativeRequest, meta.ActualModelName)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	chatRequest.Stream = stream
+	if stream {
+		chatRequest.StreamOptions = &relaymodel.StreamOptions{IncludeUsage: true}
+	}
+	meta.Mode = relaymode.ChatCompletions
+	meta.IsStream = stream
+	metalib.Set2Context(c, meta)
+
+	billing, bizErr := preConsumeGeminiNative(c, meta, chatRequest)
+	if bizErr != nil {
+		return bizErr
+	}
+	defer billingAuditSafetyNet(c)
+
+	native := servesGeminiNatively(meta)
+	origWriter := c.Writer
+	var capture *responseCaptureWriter
+	modelVersion := meta.OriginModelName
+	if !native {
+		if stream {
+			c.Set(ctxkey.ResponseStreamRewriteHandler, newChatToGeminiStreamBridge(modelVersion))
+		} else {
+			capture = newResponseCaptureWriter(origWriter)
+			c.Writer = capture
+			defer func() {
+				c.Writer = origWriter
+			}()
+			c.Set(ctxkey.ResponseRewriteHandler, func(gc *gin.Context, status int, textResp *openai_compatible.SlimTextResponse) error {
+				prevWriter := gc.Writer
+				gc.Writer = origWriter
+				defer func() {
+					gc.Writer = prevWriter
+				}()
+				gc.Set(ctxkey.ResponseRewriteApplied, true)
+				gc.JSON(status, gemini.OpenAIResponseToNative(textResp, modelVersion))
+				return nil
+			})
+		}
+	}
+
+	var resp *http.Response
+	if native {
+		action := gemini.ActionGenerateContent
+		if stream {
+			action = gemini.ActionStreamGenerateContent
+		}
+		resp, err = doGeminiNativeRequest(c, meta, action, stream, body)
+	} else {
+		resp, err = doGeminiConvertedRequest(c, meta, relaymode.ChatCompletions, "/v1/chat/completions", chatRequest)
+	}
+	if err != nil {
+		_ = returnPreConsumedQuotaConservative(ctx, c, billing.preConsumedQuota, meta.TokenId, "do_request_failed")
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	upstreamCapture := wrapUpstreamResponse(resp)
+	billing.recordProvisionalCost(c, chatRequest)
+
+	if isErrorHappened(meta, resp) {
+		scheduleConservativeRefund(c, billing.preConsumedQuota, meta.TokenId, "upstream_http_error")
+		return RelayErrorHandlerWithContext(c, resp)
+	}
+
+	var (
+		usage   *relaymodel.Usage
+		respErr *relaymodel.ErrorWithStatusCode
+	)
+	switch {
+	case native && stream:
+		usage, respErr = streamGeminiNativeResponse(c, resp)
+	case native:
+		usage, respErr = forwardGeminiNativeResponse(c, resp)
+	default:
+		c.Set(ctxkey.SkipAdaptorResponseBodyLog, true)
+		usage, respErr = relay.GetAdaptor(meta.APIType).DoResponse(c, resp, meta)
+	}
+	if upstreamCapture != nil {
+		logUpstreamResponseFromCapture(lg, resp, upstreamCapture, "gemini_native")
+	} else {
+		logUpstreamResponseFromBytes(lg, resp, nil, "gemini_native")
+	}
+	if respErr != nil && usage == nil {
+		scheduleConservativeRefund(c, billing.preConsumedQuota, meta.TokenId, "do_response_failed_without_usage")
+		return respErr
+	}
+
+	if respErr == nil && capture != nil {
+		c.Writer = origWriter
+		if !c.GetBool(ctxkey.ResponseRewriteApplied) {
+			// The adaptor rendered its own body instead of calling the rewrite hook.
+			var slim openai_compatible.SlimTextResponse
+			if err := json.Unmarshal(capture.BodyBytes(), &slim); err == nil && len(slim.Choices) > 0 {
+				c.JSON(http.StatusOK, gemini.OpenAIResponseToNative(&slim, modelVersion))
+			} else {
+				c.Data(capture.StatusCode(), "application/json", capture.BodyBytes())
+			}
+			c.Set(ctxkey.ResponseRewriteApplied, true)
+		}
+	}
+
+	if usage == nil || (usage.PromptTokens == 0 && usage.CompletionTokens == 0) {
+		usage = &relaymodel.Usage{PromptTokens: billing.promptUsage.PromptTokens, TotalTokens: billing.promptUsage.PromptTokens}
+	}
+	meta.Mode = relaymode.GeminiNative
+	billing.settle(c, meta, chatRequest, usage)
+	return nil
+}
+
+// doGeminiConvertedRequest sends an OpenAI-format request through the channel's
+// regular adaptor, as if it had arrived on requestPath.
+func doGeminiConvertedRequest(c *gin.Context, meta *metalib.Meta, mode int, requestPath string, request *relaymodel.GeneralOpenAIRequest) (*http.Response, error) {
+	requestAdaptor := relay.GetAdaptor(meta.APIType)
+	if requestAdaptor == nil {
+		return nil, errors.Errorf("invalid api type: %d", meta.APIType)
+	}
+	meta.RequestURLPath = requestPath
+	metalib.Set2Context(c, meta)
+	requestAdaptor.Init(meta)
+
+	convertedRequest, err := requestAdaptor.ConvertRequest(c, mode, request)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert request")
+	}
+	c.Set(ctxkey.ConvertedRequest, convertedRequest)
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal converted request")
+	}
+	return requestAdaptor.DoRequest(c, meta, bytes.NewReader(jsonData))
+}
+
+// forwardGeminiNativeResponse writes a native generateContent response verbatim
+// and extracts its usageMetadata.
+func forwardGeminiNativeResponse(c *gin.Context, resp *http.Response) (*relaymodel.Usage, *relaymodel.ErrorWithStatusCode) {
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	var geminiResponse gemini.ChatResponse
+	if err := json.Unmarshal(responseBody, &geminiResponse); err != nil {
+		return nil, openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	c.Data(resp.StatusCode, "application/json", responseBody)
+	return gemini.UsageFromMetadata(geminiResponse.UsageMetadata), nil
+}
+
+// streamGeminiNativeResponse relays a native SSE stream chunk by chunk and returns
+// the usage from the latest usageMetadata snapshot (Gemini reports running totals).
+func streamGeminiNativeResponse(c *gin.Context, resp *http.Response) (*relaymodel.Usage, *relaymodel.ErrorWithStatusCode) {
+	lg := gmw.GetLogger(c)
+	defer resp.Body.Close()
+
+	common.SetEventStreamHeaders(c)
+	hbr := render.NewHeartbeatLineReader(c, commonsse.NewLineReader(resp.Body, commonsse.DefaultLineBufferSize), render.DefaultHeartbeatInterval)
+	defer hbr.Close()
+
+	var usageMetadata *gemini.UsageMetadata
+	for {
+		line, err := hbr.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				render.LogHeartbeatLineReaderError(c, lg, errors.Wrap(err, "line reader stream"), hbr)
+			}
+			break
+		}
+
+		var data string
+		if line.Oversized {
+			payload, err := io.ReadAll(line.Large)
+			if err != nil {
+				render.LogHeartbeatLineReaderError(c, lg, errors.Wrap(err, "read oversized line"), hbr)
+				break
+			}
+			data = "data: " + string(payload)
+		} else {
+			data = line.Text()
+		}
+		data = strings.TrimSpace(data)
+		if !strings.HasPrefix(data, "data: ") {
+			continue
+		}
+		payload := strings.TrimPrefix(data, "data: ")
+
+		var chunk gemini.ChatResponse
+		if err := json.Unmarshal([]byte(payload), &chunk); err == nil &&
+			chunk.UsageMetadata != nil && chunk.UsageMetadata.TotalTokenCount > 0 {
+			usageMetadata = chunk.UsageMetadata
+		}
+		render.StringData(c, payload)
+	}
+
+	return gemini.UsageFromMetadata(usageMetadata), nil
+}
+
+// geminiNativeBilling carries the pricing snapshot taken at pre-consume time.
+type geminiNativeBilling struct {
+	promptUsage            *relaymodel.Usage
+	preConsumedQuota       int64
+	modelRatio             float64
+	completionRatio        float64
+	groupRatio             float64
+	channelModelRatio      map[string]float64
+	channelCompletionRatio map[string]float64
+	channelModelConfigs    map[string]model.ModelConfigLocal
+	meta                   *metalib.Meta
+}
+
+// preConsumeGeminiNative resolves pricing, estimates the prompt and reserves quota.
+func preConsumeGeminiNative(c *gin.Context, meta *metalib.Meta, request *relaymodel.GeneralOpenAIRequest) (*geminiNativeBilling, *relaymodel.ErrorWithStatusCode) {
+	lg := gmw.GetLogger(c)
+	billing := &geminiNativeBilling{meta: meta}
+	billing.channelModelRatio, billing.channelCompletionRatio = getChannelRatios(c)
+	billing.channelModelConfigs = getChannelModelConfigs(c)
+	pricingAdaptor := resolvePricingAdaptor(meta)
+	billing.modelRatio = pricing.ResolveModelRatioAt(request.Model, billing.channelModelConfigs, billing.channelModelRatio, pricingAdaptor, meta.StartTime)
+	billing.completionRatio = pricing.ResolveCompletionRatioAt(request.Model, billing.channelModelConfigs, billing.channelCompletionRatio, pricingAdaptor, meta.StartTime)
+	billing.groupRatio = c.GetFloat64(ctxkey.ChannelRatio)
+
+	promptUsage, bizErr := estimatePromptUsage(c, meta, request)
+	if bizErr != nil {
+		lg.Warn("estimatePromptUsage failed",
+			zap.Error(bizErr.RawError),
+			zap.Int("status_code", bizErr.StatusCode),
+			zap.String("err_msg", bizErr.Message))
+		return nil, bizErr
+	}
+	billing.promptUsage = promptUsage
+	meta.PromptTokens = promptUsage.PromptTokens
+
+	preConsumedQuota, bizErr := preConsumeQuota(c, request, promptUsage, billing.modelRatio, billing.completionRatio,
+		billing.channelModelRatio, billing.groupRatio, billing.channelModelConfigs, billing.channelCompletionRatio, meta)
+	if bizErr != nil {
+		lg.Warn("preConsumeQuota failed",
+			zap.Error(bizErr.RawError),
+			zap.Int("status_code", bizErr.StatusCode),
+			zap.String("err_msg", bizErr.Message))
+		return nil, bizErr
+	}
+	billing.preConsumedQuota = preConsumedQuota
+	markPreConsumed(c, preConsumedQuota)
+
+	provisionalLogId := recordProvisionalLog(c, meta, request.Model, preConsumedQuota)
+	c.Set(ctxkey.ProvisionalLogId, provisionalLogId)
+	return billing, nil
+}
+
+// recordProvisionalCost records the estimated request cost so that cancelled
+// requests are still tracked and later reconciled.
+func (b *geminiNativeBilling) recordProvisionalCost(c *gin.Context, request *relaymodel.GeneralOpenAIRequest) {
+	requestId := c.GetString(ctxkey.RequestId)
+	if requestId == "" {
+		return
+	}
+	estimated := estimatePreConsumedQuota(request, b.promptUsage, b.modelRatio, b.completionRatio,
+		b.channelModelRatio, b.groupRatio, b.channelModelConfigs, b.channelCompletionRatio, b.meta)
+	if err := model.UpdateUserRequestCostQuotaByRequestID(c.GetInt(ctxkey.Id), requestId, estimated); err != nil {
+		gmw.GetLogger(c).Warn("record provisional user request cost failed", zap.Error(err), zap.String("request_id", requestId))
+	}
+}
+
+// settle refunds the reservation, records metrics and runs post-billing.
+func (b *geminiNativeBilling) settle(c *gin.Context, meta *metalib.Meta, request *relaymodel.GeneralOpenAIRequest, usage *relaymodel.Usage) {
+	lg := gmw.GetLogger(c)
+	ratio := b.modelRatio * b.groupRatio
+
+	_ = returnPreConsumedQuotaConservative(gmw.Ctx(c), c, b.preConsumedQuota, meta.TokenId, "pre_billing_reconcile")
+
+	if usage != nil {
+		userId := strconv.Itoa(meta.UserId)
+		username := c.GetString(ctxkey.Username)
+		if username == "" {
+			username = "unknown"
+		}
+		group := meta.Group
+		if group == "" {
+			group = "default"
+		}
+
+		apiFormat := c.GetString(ctxkey.APIFormat)
+		if apiFormat == "" {
+			apiFormat = "unknown"
+		}
+		apiType := relaymode.String(meta.Mode)
+		tokenId := strconv.Itoa(meta.TokenId)
+
+		metrics.GlobalRecorder.RecordRelayRequest(
+			meta.StartTime,
+			meta.ChannelId,
+			channeltype.IdToName(meta.ChannelType),
+			meta.ActualModelName,
+			userId,
+			group,
+			tokenId,
+			apiFormat,
+			apiType,
+			true,
+			usage.PromptTokens,
+			usage.CompletionTokens,
+			0,
+		)
+
+		userBalance := float64(getUserQuotaFromContext(c))
+		metrics.GlobalRecorder.RecordUserMetrics(
+			userId,
+			username,
+			group,
+			0,
+			usage.PromptTokens,
+			usage.CompletionTokens,
+			userBalance,
+		)
+
+		metrics.GlobalRecorder.RecordModelUsage(meta.ActualModelName, channeltype.IdToName(meta.ChannelType), time.Since(meta.StartTime))
+	}
+
+	quotaId := c.GetInt(ctxkey.Id)
+	requestId := c.GetString(ctxkey.RequestId)
+	markBillingReconciled(c)
+	runPostBillingWithTimeout(detachForBilling(c), "postBillingGeminiNative", lg, postBillingTimeoutInfo{
+		userID:              meta.UserId,
+		channelID:           meta.ChannelId,
+		model:               request.Model,
+		requestID:           requestId,
+		startTime:           meta.StartTime,
+		estimatedQuota:      func() float64 { return float64(usage.PromptTokens+usage.CompletionTokens) * ratio },
+		guardTimeoutLog:     func() bool { return usage != nil },
+		logMessage:          "CRITICAL BILLING TIMEOUT",
+		includeElapsedField: true,
+	}, func(ctx context.Context) {
+		quota := postConsumeQuota(ctx, usage, meta, request, ratio, b.preConsumedQuota, 0, b.modelRatio,
+			b.channelModelRatio, b.groupRatio, false, b.channelModelConfigs, b.channelCompletionRatio)
+		if requestId != "" {
+			if err := model.UpdateUserRequestCostQuotaByRequestID(quotaId, requestId, quota); err != nil {
+				lg.Error("update user request cost failed", zap.Error(err), zap.String("request_id", requestId))
+			}
+		}
+	})
+}
+
+// chatToGeminiStreamBridge rewrites OpenAI chat completion chunks produced by a
+// non-Gemini channel into native streamGenerateContent SSE chunks.
+type chatToGeminiStreamBridge struct {
+	converter *gemini.OpenAIStreamConverter
+	done      bool
+}
+
+func newChatToGeminiStreamBridge(modelName string) *chatToGeminiStreamBridge {
+	return &chatToGeminiStreamBridge{converter: gemini.NewOpenAIStreamConverter(modelName)}
+}
+
+func (b *chatToGeminiStreamBridge) HandleChunk(c *gin.Context, chunk *openai_compatible.ChatCompletionsStreamResponse) (handled bool, doneRendered bool) {
+	for _, out := range b.converter.Convert(chunk) {
+		if err := render.ObjectData(c, out); err != nil {
+			gmw.GetLogger(c).Warn("render gemini stream chunk failed", zap.Error(err))
+		}
+	}
+	return true, false
+}
+
+// HandleUpstreamDone suppresses [DONE]; native Gemini streams simply end.
+func (b *chatToGeminiStreamBridge) HandleUpstreamDone(c *gin.Context) (handled bool, doneRendered bool) {
+	return true, false
+}
+
+func (b *chatToGeminiStreamBridge) HandleDone(c *gin.Context) (handled bool, doneRendered bool) {
+	if !b.done {
+		b.done = true
+		if err := render.ObjectData(c, b.converter.Finish()); err != nil {
+			gmw.GetLogger(c).Warn("render final gemini stream chunk failed", zap.Error(err))
+		}
+	}
+	return true, true
+}
+
+func (b *chatToGeminiStreamBridge) FinalizeUsage(usage *relaymodel.Usage) {
+	b.converter.SetUsage(usage)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+func TestRewriteGeminiNativeModelField(t *testing.T) {
+	body := rewriteGeminiNativeModelField([]byte(`{"model":"models/alias","content":{"parts":[{"text":"hi"}]}}`), "gemini-embedding-001")
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	require.Equal(t, "models/gemini-embedding-001", decoded["model"])
+
+	body = rewriteGeminiNativeModelField([]byte(`{"generateContentRequest":{"contents":[]}}`), "gemini-2.5-flash")
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	require.Equal(t, "models/gemini-2.5-flash", decoded["generateContentRequest"].(map[string]any)["model"])
+
+	original := []byte(`{"contents":[]}`)
+	require.Equal(t, original, rewriteGeminiNativeModelField(original, "gemini-2.5-flash"))
+}
+
+func TestChatToGeminiStreamBridge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest("POST", "/v1beta/models/gpt-4o:streamGenerateContent", nil)
+
+	bridge := newChatToGeminiStreamBridge("gpt-4o")
+	var _ openai_compatible.StreamRewriteHandler = bridge
+
+	stop := "stop"
+	handled, done := bridge.HandleChunk(c, &openai_compatible.ChatCompletionsStreamResponse{
+		Choices: []openai_compatible.ChatCompletionsStreamResponseChoice{{Delta: relaymodel.Message{Content: "Hello"}}},
+	})
+	require.True(t, handled)
+	require.False(t, done)
+	bridge.HandleChunk(c, &openai_compatible.ChatCompletionsStreamResponse{
+		Choices: []openai_compatible.ChatCompletionsStreamResponseChoice{{FinishReason: &stop}},
+	})
+	handled, _ = bridge.HandleUpstreamDone(c)
+	require.True(t, handled)
+	bridge.FinalizeUsage(&relaymodel.Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4})
+	handled, done = bridge.HandleDone(c)
+	require.True(t, handled)
+	require.True(t, done)
+
+	output := recorder.Body.String()
+	require.NotContains(t, output, "[DONE]")
+	lines := strings.Split(strings.TrimSpace(output), "\n\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"text":"Hello"`)
+	require.Contains(t, lines[1], `"finishReason":"STOP"`)
+	require.Contains(t, lines[1], `"totalTokenCount":4`)
+}
@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/tracing"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/guardrail"
+	metalib "github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+// guardrailResponseCaptureLimit bounds the response body buffered for the
+// response-stage guardrail checks; larger responses cannot be checked and are
+// rejected.
+const guardrailResponseCaptureLimit = 4 << 20
+
+// guardrailStageTitles names each guardrail stage in log content.
+var guardrailStageTitles = map[string]string{
+	guardrail.StageRequest:  "Request",
+	guardrail.StageResponse: "Response",
+}
+
+// applyRequestGuardrail runs the guardrail policies bound to the request's
+// group and token on the raw request body, before it is parsed. Redactions
+// replace the cached body, so everything parsed and forwarded afterwards sees
+// the redacted text. Findings are added to meta.GuardrailViolations; a blocked
+// request is logged and rejected with content_policy_violation.
+//
+// The check runs once per client request: retries reuse the redacted body and
+// do not repeat the moderation call.
+func applyRequestGuardrail(c *gin.Context, meta *metalib.Meta, format guardrail.Format) *relaymodel.ErrorWithStatusCode {
+	if c.GetBool(ctxkey.GuardrailChecked) {
+		return nil
+	}
+	engines := guardrail.Resolve(c.GetString(ctxkey.GuardrailPolicy), meta.Group)
+	if len(engines) == 0 {
+		return nil
+	}
+	c.Set(ctxkey.GuardrailChecked, true)
+
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	for _, engine := range engines {
+		result, err := engine.ApplyRequest(gmw.Ctx(c), format, body, meta.TokenId)
+		if err != nil {
+			return openai.ErrorWrapper(err, "invalid_request_body", http.StatusBadRequest)
+		}
+		meta.GuardrailViolations = append(meta.GuardrailViolations, result.Violations...)
+		if result.Body != nil {
+			body = result.Body
+			c.Set(ctxkey.KeyRequestBody, body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			c.Request.ContentLength = int64(len(body))
+		}
+		if result.Blocked != nil {
+			recordGuardrailBlock(c, meta, engine.Name(), guardrail.StageRequest)
+			return openai.ErrorWrapper(
+				errors.Errorf("request blocked by guardrail policy %q: %s filter", engine.Name(), result.Blocked.Filter),
+				"content_policy_violation", http.StatusBadRequest)
+		}
+	}
+	if len(meta.GuardrailViolations) > 0 {
+		gmw.GetLogger(c).Info("guardrail findings on request",
+			zap.Any("violations", meta.GuardrailViolations))
+	}
+	return nil
+}
+
+// recordGuardrailBlock writes the system log row of a request or response
+// rejected by policy; stage is guardrail.StageRequest or StageResponse.
+func recordGuardrailBlock(c *gin.Context, meta *metalib.Meta, policy, stage string) {
+	gmw.GetLogger(c).Info(stage+" blocked by guardrail",
+		zap.String("policy", policy),
+		zap.Any("violations", meta.GuardrailViolations))
+
+	model.RecordGuardrailLog(gmw.Ctx(c), &model.Log{
+		UserId:    meta.UserId,
+		OrgId:     meta.OrgId,
+		UserUUID:  model.StringPtrIfNotEmpty(meta.UserUUID),
+		ModelName: c.GetString(ctxkey.RequestModel),
+		TokenName: meta.TokenName,
+		TokenUUID: model.StringPtrIfNotEmpty(meta.TokenUUID),
+		Content:   fmt.Sprintf("%s blocked by guardrail policy %q", guardrailStageTitles[stage], policy),
+		RequestId: c.GetString(ctxkey.RequestId),
+		TraceId:   tracing.GetTraceIDFromContext(gmw.Ctx(c)),
+		Metadata: model.LogMetadata{
+			model.LogMetadataKeyGuardrail: meta.GuardrailViolations,
+		},
+	})
+}
+
+// guardrailResponseWriter holds the response back from the client until the
+// response-stage guardrail checks have run, so a redacted body replaces the
+// original and a blocked response is never delivered. Once a response exceeds
+// guardrailResponseCaptureLimit the rest of it is discarded, since it can no
+// longer be checked.
+type guardrailResponseWriter struct {
+	gin.ResponseWriter
+	buffer     bytes.Buffer
+	status     int
+	written    bool
+	flushed    bool
+	overflowed bool
+}
+
+// beginGuardrailResponseCapture starts holding the response when a policy
+// bound to the request inspects responses. It returns nil otherwise.
+func beginGuardrailResponseCapture(c *gin.Context, meta *metalib.Meta) *guardrailResponseWriter {
+	for _, engine := range guardrail.Resolve(c.GetString(ctxkey.GuardrailPolicy), meta.Group) {
+		if engine.ChecksResponse() {
+			w := &guardrailResponseWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+			c.Writer = w
+			return w
+		}
+	}
+	return nil
+}
+
+// WriteHeader records the status code until the response is released.
+func (w *guardrailResponseWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow marks the response as written until it is released.
+func (w *guardrailResponseWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+// Write holds data back. Past the limit everything is discarded, while the
+// handler still reads the upstream response to the end for billing.
+func (w *guardrailResponseWriter) Write(data []byte) (int, error) {
+	w.written = true
+	if w.overflowed {
+		return len(data), nil
+	}
+	if w.buffer.Len()+len(data) > guardrailResponseCaptureLimit {
+		w.overflowed = true
+		w.buffer = bytes.Buffer{}
+		return len(data), nil
+	}
+	return w.buffer.Write(data)
+}
+
+// WriteString holds s back like Write.
+func (w *guardrailResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush is deferred until the response is released.
+func (w *guardrailResponseWriter) Flush() {
+	w.flushed = true
+}
+
+// Status returns the status code written so far.
+func (w *guardrailResponseWriter) Status() int {
+	return w.status
+}
+
+// Size returns the number of body bytes held so far.
+func (w *guardrailResponseWriter) Size() int {
+	if !w.written {
+		return w.ResponseWriter.Size()
+	}
+	return w.buffer.Len()
+}
+
+// Written reports whether the handler has started the response.
+func (w *guardrailResponseWriter) Written() bool {
+	return w.written
+}
+
+// release sends the held status and body to the client.
+func (w *guardrailResponseWriter) release(body []byte) error {
+	if !w.written {
+		return nil
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+	if len(body) > 0 {
+		if _, err := w.ResponseWriter.Write(body); err != nil {
+			return errors.Wrap(err, "write held response")
+		}
+	}
+	if w.flushed {
+		w.ResponseWriter.Flush()
+	}
+	return nil
+}
+
+// finishGuardrailResponseCapture restores the client writer and releases the
+// held response. A completed 200 response first goes through the response
+// checks of every policy bound to the request: PII is redacted from the body
+// and a keyword or pattern match replaces the whole response with a
+// content_policy_violation error. A response too large to hold cannot be
+// checked and is rejected the same way, failing closed. The upstream usage is
+// still billed. Findings are added to meta.GuardrailViolations.
+func finishGuardrailResponseCapture(c *gin.Context, meta *metalib.Meta, format guardrail.Format, w *guardrailResponseWriter, completed bool) {
+	if w == nil {
+		return
+	}
+	c.Writer = w.ResponseWriter
+	lg := gmw.GetLogger(c)
+	if w.overflowed {
+		oversize := guardrail.Violation{
+			Stage: guardrail.StageResponse, Filter: guardrail.FilterResponseSize, Action: guardrail.ActionBlocked,
+			Detail: fmt.Sprintf("response exceeds %d bytes and could not be checked", guardrailResponseCaptureLimit),
+		}
+		meta.GuardrailViolations = append(meta.GuardrailViolations, oversize)
+		blockGuardrailResponse(c, meta, responseGuardrailPolicy(c, meta), &oversize)
+		return
+	}
+
+	body := w.buffer.Bytes()
+	if completed && w.status == http.StatusOK {
+		var findings []guardrail.Violation
+		for _, engine := range guardrail.Resolve(c.GetString(ctxkey.GuardrailPolicy), meta.Group) {
+			if !engine.ChecksResponse() {
+				continue
+			}
+			result := engine.ApplyResponse(format, body, meta.IsStream)
+			findings = append(findings, result.Violations...)
+			if result.Body != nil {
+				body = result.Body
+				w.Header().Del("Content-Length")
+			}
+			if result.Blocked != nil {
+				meta.GuardrailViolations = append(meta.GuardrailViolations, findings...)
+				blockGuardrailResponse(c, meta, engine.Name(), result.Blocked)
+				return
+			}
+		}
+		if len(findings) > 0 {
+			lg.Info("guardrail findings on response", zap.Any("violations", findings))
+			meta.GuardrailViolations = append(meta.GuardrailViolations, findings...)
+		}
+	}
+	if err := w.release(body); err != nil {
+		lg.Warn("release guardrail-checked response failed", zap.Error(err))
+	}
+}
+
+// responseGuardrailPolicy returns the name of the first policy bound to the
+// request that checks responses.
+func responseGuardrailPolicy(c *gin.Context, meta *metalib.Meta) string {
+	for _, engine := range guardrail.Resolve(c.GetString(ctxkey.GuardrailPolicy), meta.Group) {
+		if engine.ChecksResponse() {
+			return engine.Name()
+		}
+	}
+	return ""
+}
+
+// blockGuardrailResponse replaces a held response rejected by policy with a
+// content_policy_violation error, for streams as well, and logs the block.
+func blockGuardrailResponse(c *gin.Context, meta *metalib.Meta, policy string, blocked *guardrail.Violation) {
+	recordGuardrailBlock(c, meta, policy, guardrail.StageResponse)
+	bizErr := openai.ErrorWrapper(
+		errors.Errorf("response blocked by guardrail policy %q: %s filter", policy, blocked.Filter),
+		"content_policy_violation", http.StatusBadRequest)
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	c.JSON(bizErr.StatusCode, gin.H{"error": bizErr.Error})
+}
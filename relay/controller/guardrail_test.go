@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/guardrail"
+	metalib "github.com/Laisky/one-api/relay/meta"
+)
+
+func setGuardrailPolicies(t *testing.T, policies string) {
+	t.Helper()
+	require.NoError(t, guardrail.UpdatePoliciesByJSONString(policies))
+	t.Cleanup(func() { require.NoError(t, guardrail.UpdatePoliciesByJSONString("")) })
+}
+
+func TestApplyRequestGuardrailRedactsCachedBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setGuardrailPolicies(t, `{"pii": {"groups": ["default"], "redact_pii": ["email"]}}`)
+	meta := &metalib.Meta{Group: "default", TokenId: 1}
+
+	c, _ := newResponseCacheContext(`{"model":"gpt-4o","messages":[{"role":"user","content":"write to jane@example.com"}]}`, nil)
+	require.Nil(t, applyRequestGuardrail(c, meta, guardrail.FormatChatCompletions))
+
+	body, err := common.GetRequestBody(c)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"model":"gpt-4o","messages":[{"role":"user","content":"write to [REDACTED_EMAIL]"}]}`, string(body))
+	forwarded, err := io.ReadAll(c.Request.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, forwarded)
+	require.Equal(t, []guardrail.Violation{{
+		Stage: guardrail.StageRequest, Filter: guardrail.FilterPII, Action: guardrail.ActionRedacted, Detail: "email", Count: 1,
+	}}, meta.GuardrailViolations)
+
+	// A retry of the same request does not run the filters again.
+	require.Nil(t, applyRequestGuardrail(c, meta, guardrail.FormatChatCompletions))
+	require.Len(t, meta.GuardrailViolations, 1)
+
+	// Requests outside the policy's groups pass untouched.
+	other := &metalib.Meta{Group: "vip"}
+	c, _ = newResponseCacheContext(`{"messages":[{"role":"user","content":"jane@example.com"}]}`, nil)
+	require.Nil(t, applyRequestGuardrail(c, other, guardrail.FormatChatCompletions))
+	require.Empty(t, other.GuardrailViolations)
+}
+
+func TestApplyRequestGuardrailBlocksAndLogs(t *testing.T) {
+	cleanup := setupCacheBillingLogTest(t)
+	defer cleanup()
+	setGuardrailPolicies(t, `{"no-secrets": {"block_keywords": ["project phoenix"]}}`)
+	meta := &metalib.Meta{Group: "default", UserId: 1, TokenId: 1, TokenName: "relay-cache-log-token"}
+
+	c, _ := newResponseCacheContext(`{"model":"claude-sonnet-4","messages":[{"role":"user","content":"Status of Project Phoenix?"}]}`, nil)
+	c.Set(ctxkey.GuardrailPolicy, "no-secrets")
+	c.Set(ctxkey.RequestModel, "claude-sonnet-4")
+	c.Set(ctxkey.RequestId, "guardrail-block-request")
+
+	bizErr := applyRequestGuardrail(c, meta, guardrail.FormatClaudeMessages)
+	require.NotNil(t, bizErr)
+	require.Equal(t, http.StatusBadRequest, bizErr.StatusCode)
+	require.Equal(t, "content_policy_violation", bizErr.Code)
+	require.NotContains(t, bizErr.Message, "phoenix", "the matched keyword is not echoed to the client")
+
+	var saved model.Log
+	require.NoError(t, model.LOG_DB.Where("request_id = ?", "guardrail-block-request").First(&saved).Error)
+	require.Equal(t, model.LogTypeSystem, saved.Type)
+	require.Equal(t, "claude-sonnet-4", saved.ModelName)
+	require.Zero(t, saved.Quota)
+	require.Contains(t, saved.Metadata, model.LogMetadataKeyGuardrail)
+}
+
+func TestGuardrailResponseCaptureRedacts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setGuardrailPolicies(t, `{"pii": {"groups": ["default"], "redact_pii": ["email"], "check_response": true}}`)
+	meta := &metalib.Meta{Group: "default"}
+
+	c, rec := newResponseCacheContext(`{}`, nil)
+	original := c.Writer
+	w := beginGuardrailResponseCapture(c, meta)
+	require.NotNil(t, w)
+	c.JSON(http.StatusOK, gin.H{"choices": []gin.H{{"message": gin.H{"role": "assistant", "content": "Mail jane@example.com."}}}})
+	require.Empty(t, rec.Body.String(), "the response is held until it is checked")
+	finishGuardrailResponseCapture(c, meta, guardrail.FormatChatCompletions, w, true)
+
+	require.Equal(t, original, c.Writer)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"choices":[{"message":{"role":"assistant","content":"Mail [REDACTED_EMAIL]."}}]}`, rec.Body.String())
+	require.Equal(t, []guardrail.Violation{{
+		Stage: guardrail.StageResponse, Filter: guardrail.FilterPII, Action: guardrail.ActionRedacted, Detail: "email", Count: 1,
+	}}, meta.GuardrailViolations)
+
+	require.Nil(t, beginGuardrailResponseCapture(c, &metalib.Meta{Group: "vip"}))
+}
+
+func TestGuardrailResponseCaptureBlocksStream(t *testing.T) {
+	cleanup := setupCacheBillingLogTest(t)
+	defer cleanup()
+	setGuardrailPolicies(t, `{"no-secrets": {"block_keywords": ["internal only"], "check_response": true}}`)
+	meta := &metalib.Meta{Group: "default", UserId: 1, TokenId: 1, IsStream: true}
+
+	c, rec := newResponseCacheContext(`{}`, nil)
+	c.Set(ctxkey.GuardrailPolicy, "no-secrets")
+	c.Set(ctxkey.RequestId, "guardrail-block-response")
+	w := beginGuardrailResponseCapture(c, meta)
+	require.NotNil(t, w)
+	c.Header("Content-Type", "text/event-stream")
+	_, _ = c.Writer.WriteString("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"This is INTERNAL\"}}]}\n\n")
+	c.Writer.Flush()
+	_, _ = c.Writer.WriteString("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\" ONLY.\"}}]}\n\ndata: [DONE]\n\n")
+	finishGuardrailResponseCapture(c, meta, guardrail.FormatChatCompletions, w, true)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), "content_policy_violation")
+	require.NotContains(t, rec.Body.String(), "INTERNAL")
+	require.Equal(t, []guardrail.Violation{{
+		Stage: guardrail.StageResponse, Filter: guardrail.FilterKeyword, Action: guardrail.ActionBlocked, Detail: "internal only",
+	}}, meta.GuardrailViolations)
+
+	var saved model.Log
+	require.NoError(t, model.LOG_DB.Where("request_id = ?", "guardrail-block-response").First(&saved).Error)
+	require.Contains(t, saved.Content, "Response blocked")
+}
+
+func TestGuardrailResponseCaptureBlocksOversize(t *testing.T) {
+	cleanup := setupCacheBillingLogTest(t)
+	defer cleanup()
+	setGuardrailPolicies(t, `{"audit": {"groups": ["default"], "block_keywords": ["secret"], "check_response": true}}`)
+	meta := &metalib.Meta{Group: "default", UserId: 1, TokenId: 1}
+
+	c, rec := newResponseCacheContext(`{}`, nil)
+	c.Set(ctxkey.RequestId, "guardrail-block-oversize")
+	w := beginGuardrailResponseCapture(c, meta)
+	require.NotNil(t, w)
+	_, _ = c.Writer.Write([]byte("secret "))
+	n, err := c.Writer.Write(make([]byte, guardrailResponseCaptureLimit))
+	require.NoError(t, err)
+	require.Equal(t, guardrailResponseCaptureLimit, n, "the handler keeps reading the upstream response")
+	require.Zero(t, rec.Body.Len(), "nothing unchecked reaches the client")
+	finishGuardrailResponseCapture(c, meta, guardrail.FormatChatCompletions, w, true)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "content_policy_violation")
+	require.NotContains(t, rec.Body.String(), "secret ")
+	require.Len(t, meta.GuardrailViolations, 1)
+	require.Equal(t, guardrail.FilterResponseSize, meta.GuardrailViolations[0].Filter)
+	require.Equal(t, guardrail.ActionBlocked, meta.GuardrailViolations[0].Action)
+
+	var saved model.Log
+	require.NoError(t, model.LOG_DB.Where("request_id = ?", "guardrail-block-oversize").First(&saved).Error)
+	require.Contains(t, saved.Content, `Response blocked by guardrail policy "audit"`)
+}
@@ -224,7 +224,7 @@ func preConsumeQuota(
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return preConsumedQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -243,7 +243,7 @@ func preConsumeQuota(
 		if err != nil {
 			return preConsumedQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
-		syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, preConsumedQuota, "chat_preconsume")
+		syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, meta.OrgId, preConsumedQuota, "chat_preconsume")
 	}
 	return preConsumedQuota, nil
 }
@@ -322,40 +322,51 @@ func postConsumeQuota(ctx context.Context,
 	if meta.TokenId > 0 && meta.UserId > 0 && meta.ChannelId > 0 {
 		toolSummary := billingID.toolSummary
 		metadata := model.AppendCacheWriteTokensMetadata(nil, usage.CacheWrite5mTokens, usage.CacheWrite1hTokens)
+		if meta.ResponseCacheHit {
+			if metadata == nil {
+				metadata = model.LogMetadata{}
+			}
+			metadata[model.LogMetadataKeyResponseCacheHit] = true
+		}
 
 		billing.PostConsumeQuotaDetailed(billing.QuotaConsumeDetail{
-			Ctx:                ctx,
-			TokenId:            meta.TokenId,
-			QuotaDelta:         quotaDelta,
-			TotalQuota:         quota,
-			UserId:             meta.UserId,
-			UserUUID:           meta.UserUUID,
-			ChannelId:          meta.ChannelId,
-			ChannelUUID:        meta.ChannelUUID,
-			PromptTokens:       computeResult.PromptTokens,
-			CompletionTokens:   computeResult.CompletionTokens,
-			ModelRatio:         computeResult.UsedModelRatio,
-			GroupRatio:         groupRatio,
-			OriginModelName:    meta.OriginModelName,
-			ModelName:          textRequest.Model,
-			TokenUUID:          meta.TokenUUID,
-			TokenName:          meta.TokenName,
-			IsStream:           meta.IsStream,
-			StartTime:          meta.StartTime,
-			SystemPromptReset:  systemPromptReset,
-			CompletionRatio:    computeResult.UsedCompletionRatio,
-			ToolsCost:          usage.ToolsCost,
-			CachedPromptTokens: computeResult.CachedPromptTokens,
-			CacheWrite5mTokens: usage.CacheWrite5mTokens,
-			CacheWrite1hTokens: usage.CacheWrite1hTokens,
-			Metadata:           metadata,
-			RequestId:          requestId,
-			TraceId:            traceId,
-			ProvisionalLogId:   provisionalLogId,
-			UserAPIFormat:      resolveUserAPIFormat(meta.Mode),
-			UpstreamAPIFormat:  apitype.String(meta.APIType),
-			UpstreamEndpoint:   meta.UpstreamRequestURL,
-			ToolUsageSummary:   toolSummary,
+			Ctx:                 ctx,
+			TokenId:             meta.TokenId,
+			QuotaDelta:          quotaDelta,
+			TotalQuota:          quota,
+			UserId:              meta.UserId,
+			UserUUID:            meta.UserUUID,
+			OrgId:               meta.OrgId,
+			ChannelId:           meta.ChannelId,
+			ChannelUUID:         meta.ChannelUUID,
+			PromptTokens:        computeResult.PromptTokens,
+			CompletionTokens:    computeResult.CompletionTokens,
+			ModelRatio:          computeResult.UsedModelRatio,
+			GroupRatio:          groupRatio,
+			OriginModelName:     meta.OriginModelName,
+			ServedModelName:     meta.ServedModelName,
+			GuardrailViolations: meta.GuardrailViolations,
+			ContextFit:          meta.ContextFit,
+			ParentRequestId:     meta.ParentRequestId,
+			ModelName:           textRequest.Model,
+			TokenUUID:           meta.TokenUUID,
+			TokenName:           meta.TokenName,
+			IsStream:            meta.IsStream,
+			StartTime:           meta.StartTime,
+			SystemPromptReset:   systemPromptReset,
+			CompletionRatio:     computeResult.UsedCompletionRatio,
+			ToolsCost:           usage.ToolsCost,
+			CachedPromptTokens:  computeResult.CachedPromptTokens,
+			CacheWrite5mTokens:  usage.CacheWrite5mTokens,
+			CacheWrite1hTokens:  usage.CacheWrite1hTokens,
+			Metadata:            metadata,
+			RequestId:           requestId,
+			TraceId:             traceId,
+			ProvisionalLogId:    provisionalLogId,
+			UserAPIFormat:       resolveUserAPIFormat(meta.Mode),
+			UpstreamAPIFormat:   apitype.String(meta.APIType),
+			UpstreamEndpoint:    meta.UpstreamRequestURL,
+			ToolUsageSummary:    toolSummary,
 		})
 	} else {
 		gmw.GetLogger(ctx).Error("meta information incomplete, cannot post consume quota",
@@ -442,38 +453,43 @@ func postConsumeQuotaWithTraceID(ctx context.Context, traceId string,
 		metadata := model.AppendCacheWriteTokensMetadata(nil, usage.CacheWrite5mTokens, usage.CacheWrite1hTokens)
 
 		billing.PostConsumeQuotaDetailed(billing.QuotaConsumeDetail{
-			Ctx:                ctx,
-			TokenId:            meta.TokenId,
-			QuotaDelta:         quotaDelta,
-			TotalQuota:         quota,
-			UserId:             meta.UserId,
-			UserUUID:           meta.UserUUID,
-			ChannelId:          meta.ChannelId,
-			ChannelUUID:        meta.ChannelUUID,
-			PromptTokens:       computeResult.PromptTokens,
-			CompletionTokens:   computeResult.CompletionTokens,
-			ModelRatio:         computeResult.UsedModelRatio,
-			GroupRatio:         groupRatio,
-			OriginModelName:    meta.OriginModelName,
-			ModelName:          textRequest.Model,
-			TokenUUID:          meta.TokenUUID,
-			TokenName:          meta.TokenName,
-			IsStream:           meta.IsStream,
-			StartTime:          meta.StartTime,
-			SystemPromptReset:  systemPromptReset,
-			CompletionRatio:    computeResult.UsedCompletionRatio,
-			ToolsCost:          usage.ToolsCost,
-			CachedPromptTokens: computeResult.CachedPromptTokens,
-			CacheWrite5mTokens: usage.CacheWrite5mTokens,
-			CacheWrite1hTokens: usage.CacheWrite1hTokens,
-			Metadata:           metadata,
-			RequestId:          requestId,
-			TraceId:            traceId,
-			ProvisionalLogId:   provisionalLogId,
-			UserAPIFormat:      resolveUserAPIFormat(meta.Mode),
-			UpstreamAPIFormat:  apitype.String(meta.APIType),
-			UpstreamEndpoint:   meta.UpstreamRequestURL,
-			ToolUsageSummary:   toolSummary,
+			Ctx:                 ctx,
+			TokenId:             meta.TokenId,
+			QuotaDelta:          quotaDelta,
+			TotalQuota:          quota,
+			UserId:              meta.UserId,
+			UserUUID:            meta.UserUUID,
+			OrgId:               meta.OrgId,
+			ChannelId:           meta.ChannelId,
+			ChannelUUID:         meta.ChannelUUID,
+			PromptTokens:        computeResult.PromptTokens,
+			CompletionTokens:    computeResult.CompletionTokens,
+			ModelRatio:          computeResult.UsedModelRatio,
+			GroupRatio:          groupRatio,
+			OriginModelName:     meta.OriginModelName,
+			ServedModelName:     meta.ServedModelName,
+			GuardrailViolations: meta.GuardrailViolations,
+			ContextFit:          meta.ContextFit,
+			ParentRequestId:     meta.ParentRequestId,
+			ModelName:           textRequest.Model,
+			TokenUUID:           meta.TokenUUID,
+			TokenName:           meta.TokenName,
+			IsStream:            meta.IsStream,
+			StartTime:           meta.StartTime,
+			SystemPromptReset:   systemPromptReset,
+			CompletionRatio:     computeResult.UsedCompletionRatio,
+			ToolsCost:           usage.ToolsCost,
+			CachedPromptTokens:  computeResult.CachedPromptTokens,
+			CacheWrite5mTokens:  usage.CacheWrite5mTokens,
+			CacheWrite1hTokens:  usage.CacheWrite1hTokens,
+			Metadata:            metadata,
+			RequestId:           requestId,
+			TraceId:             traceId,
+			ProvisionalLogId:    provisionalLogId,
+			UserAPIFormat:       resolveUserAPIFormat(meta.Mode),
+			UpstreamAPIFormat:   apitype.String(meta.APIType),
+			UpstreamEndpoint:    meta.UpstreamRequestURL,
+			ToolUsageSummary:    toolSummary,
 		})
 	} else {
 		gmw.GetLogger(ctx).Error("meta information incomplete, cannot post consume quota",
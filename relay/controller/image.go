@@ -180,7 +180,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	tokenQuota := int64(0)
 	tokenQuotaFloat := 0.0
 
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -260,7 +260,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		if err != nil {
 			lg.Error("error consuming token remain quota", zap.Error(err))
 		}
-		err = model.CacheUpdateUserQuota(bgCtx, meta.UserId)
+		err = model.CacheUpdatePayerQuota(bgCtx, meta.UserId, meta.OrgId)
 		if err != nil {
 			lg.Error("error update user quota cache", zap.Error(err))
 		}
@@ -292,6 +292,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 						zap.Error(err), zap.Int("provisional_log_id", provLogID))
 					model.RecordConsumeLog(bgCtx, &model.Log{
 						UserId:           meta.UserId,
+						OrgId:            meta.OrgId,
 						UserUUID:         model.StringPtrIfNotEmpty(meta.UserUUID),
 						ChannelId:        meta.ChannelId,
 						ChannelUUID:      model.StringPtrIfNotEmpty(meta.ChannelUUID),
@@ -310,6 +311,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			} else {
 				model.RecordConsumeLog(bgCtx, &model.Log{
 					UserId:           meta.UserId,
+					OrgId:            meta.OrgId,
 					UserUUID:         model.StringPtrIfNotEmpty(meta.UserUUID),
 					ChannelId:        meta.ChannelId,
 					ChannelUUID:      model.StringPtrIfNotEmpty(meta.ChannelUUID),
@@ -421,8 +423,12 @@ func reconcileImageFailureBilling(
 	}
 
 	if provisionalLogID > 0 {
+		var metadata model.LogMetadata
+		if finalQuota == 0 && preConsumedQuota > 0 {
+			metadata = model.LogMetadata{model.LogMetadataKeyRefundedQuota: preConsumedQuota}
+		}
 		if err := model.ReconcileConsumeLog(bgCtx, provisionalLogID, finalQuota,
-			logContent, 0, 0, 0, nil); err != nil {
+			logContent, 0, 0, 0, metadata); err != nil {
 			lg.Warn("failed to reconcile provisional image log on upstream error",
 				zap.Error(err), zap.Int("provisional_log_id", provisionalLogID))
 		}
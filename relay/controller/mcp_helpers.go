@@ -145,7 +145,7 @@ func preConsumeMCPRoundQuota(c *gin.Context, meta *metalib.Meta, request *relaym
 	if preConsumedQuota <= 0 {
 		return 0, nil
 	}
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return preConsumedQuota, errors.Wrap(err, "get user quota from cache")
 	}
@@ -155,7 +155,7 @@ func preConsumeMCPRoundQuota(c *gin.Context, meta *metalib.Meta, request *relaym
 	if err := model.PreConsumeTokenQuota(ctx, meta.TokenId, preConsumedQuota); err != nil {
 		return preConsumedQuota, errors.Wrap(err, "pre-consume token quota")
 	}
-	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, preConsumedQuota, "mcp_round_preconsume")
+	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, meta.OrgId, preConsumedQuota, "mcp_round_preconsume")
 	return preConsumedQuota, nil
 }
 
@@ -15,6 +15,7 @@ import (
 	"github.com/Laisky/one-api/model"
 	"github.com/Laisky/one-api/relay"
 	"github.com/Laisky/one-api/relay/adaptor"
+	"github.com/Laisky/one-api/relay/adaptor/common/toolprompt"
 	"github.com/Laisky/one-api/relay/adaptor/openai"
 	"github.com/Laisky/one-api/relay/billing"
 	"github.com/Laisky/one-api/relay/mcp"
@@ -458,9 +459,17 @@ func executeChatMCPToolLoop(c *gin.Context, meta *metalib.Meta, request *relaymo
 }
 
 // doChatRequestOnce executes one upstream chat request and captures the response.
+// Tools are emulated through the prompt when the model cannot call them natively.
 func doChatRequestOnce(c *gin.Context, meta *metalib.Meta, adaptorInstance adaptor.Adaptor, request *relaymodel.GeneralOpenAIRequest) (*openai.TextResponse, *relaymodel.Usage, *relaymodel.ErrorWithStatusCode) {
-	logMCPRequestToolSchemas(c, request)
-	convertedRequest, err := adaptorInstance.ConvertRequest(c, meta.Mode, request)
+	// Models without native function calling get the tools in the prompt; the
+	// caller's request keeps its structured tool calls for the next round.
+	upstreamRequest := request
+	emulateTools := toolCallEmulationNeeded(c, meta, request)
+	if emulateTools {
+		upstreamRequest = toolprompt.Rewrite(request)
+	}
+	logMCPRequestToolSchemas(c, upstreamRequest)
+	convertedRequest, err := adaptorInstance.ConvertRequest(c, meta.Mode, upstreamRequest)
 	if err != nil {
 		return nil, nil, openai.ErrorWrapper(err, "convert_request_failed", 500)
 	}
@@ -490,6 +499,9 @@ func doChatRequestOnce(c *gin.Context, meta *metalib.Meta, adaptorInstance adapt
 	if err := json.Unmarshal(capture.BodyBytes(), &parsed); err != nil {
 		return nil, usage, openai.ErrorWrapper(err, "parse_chat_response_failed", 500)
 	}
+	if emulateTools {
+		restoreEmulatedToolCalls(c, &parsed, request.Tools)
+	}
 	if len(parsed.Choices) > 0 {
 		choice := parsed.Choices[0]
 		toolNames := make([]string, 0, len(choice.Message.ToolCalls))
@@ -290,7 +290,7 @@ func preConsumeOCRQuota(c *gin.Context, perCallQuota int64, meta *metalib.Meta)
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return perCallQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -306,7 +306,7 @@ func preConsumeOCRQuota(c *gin.Context, perCallQuota int64, meta *metalib.Meta)
 	if err := model.PreConsumeTokenQuota(ctx, meta.TokenId, perCallQuota); err != nil {
 		return perCallQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 	}
-	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, perCallQuota, "ocr_preconsume")
+	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, meta.OrgId, perCallQuota, "ocr_preconsume")
 
 	return perCallQuota, nil
 }
@@ -338,6 +338,7 @@ func postConsumeOCRQuota(ctx context.Context,
 	if meta.TokenId > 0 && meta.UserId > 0 && meta.ChannelId > 0 {
 		logEntry := &model.Log{
 			UserId:           meta.UserId,
+			OrgId:            meta.OrgId,
 			ChannelId:        meta.ChannelId,
 			PromptTokens:     promptTokens,
 			CompletionTokens: completionTokens,
@@ -71,6 +71,7 @@ func RelayProxyHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		// Log the proxy request with zero quota
 		model.RecordConsumeLog(ctx, &model.Log{
 			UserId:           userId,
+			OrgId:            meta.OrgId,
 			UserUUID:         model.StringPtrIfNotEmpty(meta.UserUUID),
 			ChannelId:        channelId,
 			ChannelUUID:      model.StringPtrIfNotEmpty(meta.ChannelUUID),
@@ -32,13 +32,15 @@ func getUserObjFromContext(c *gin.Context) *model.User {
 	return nil
 }
 
-// syncUserQuotaCacheAfterPreConsume best-effort synchronizes cached user quota after
-// a successful database pre-consume operation.
-func syncUserQuotaCacheAfterPreConsume(ctx context.Context, userID int, quota int64, source string) {
-	if userID <= 0 || quota <= 0 {
+// syncUserQuotaCacheAfterPreConsume best-effort synchronizes the cached quota of
+// the payer after a successful database pre-consume operation. The payer is the
+// organization orgID when the token is organization-owned (orgID > 0), otherwise
+// the user.
+func syncUserQuotaCacheAfterPreConsume(ctx context.Context, userID int, orgID int, quota int64, source string) {
+	if (userID <= 0 && orgID <= 0) || quota <= 0 {
 		return
 	}
-	if err := model.CacheDecreaseUserQuota(ctx, userID, quota); err != nil {
+	if err := model.CacheDecreasePayerQuota(ctx, userID, orgID, quota); err != nil {
 		gmw.GetLogger(ctx).Warn("failed to sync user quota cache after pre-consume",
 			zap.Int64("quota", quota),
 			zap.String("source", source),
@@ -47,13 +49,14 @@ func syncUserQuotaCacheAfterPreConsume(ctx context.Context, userID int, quota in
 	}
 }
 
-// syncUserQuotaCacheAfterRefund best-effort refreshes cached user quota after a
-// pre-consumed quota refund has been written to the database.
-func syncUserQuotaCacheAfterRefund(ctx context.Context, userID int, source string) {
-	if userID <= 0 {
+// syncUserQuotaCacheAfterRefund best-effort refreshes the cached quota of the
+// payer (see syncUserQuotaCacheAfterPreConsume) after a pre-consumed quota
+// refund has been written to the database.
+func syncUserQuotaCacheAfterRefund(ctx context.Context, userID int, orgID int, source string) {
+	if userID <= 0 && orgID <= 0 {
 		return
 	}
-	if err := model.CacheUpdateUserQuota(ctx, userID); err != nil {
+	if err := model.CacheUpdatePayerQuota(ctx, userID, orgID); err != nil {
 		gmw.GetLogger(ctx).Warn("failed to sync user quota cache after refund",
 			zap.String("source", source),
 			zap.Error(err),
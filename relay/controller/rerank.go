@@ -321,7 +321,7 @@ func preConsumeRerankQuota(c *gin.Context, perCallQuota int64, meta *metalib.Met
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return perCallQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -337,7 +337,7 @@ func preConsumeRerankQuota(c *gin.Context, perCallQuota int64, meta *metalib.Met
 	if err := model.PreConsumeTokenQuota(ctx, meta.TokenId, perCallQuota); err != nil {
 		return perCallQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 	}
-	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, perCallQuota, "rerank_preconsume")
+	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, meta.OrgId, perCallQuota, "rerank_preconsume")
 
 	return perCallQuota, nil
 }
@@ -379,6 +379,7 @@ func postConsumeRerankQuota(ctx context.Context,
 	if meta.TokenId > 0 && meta.UserId > 0 && meta.ChannelId > 0 {
 		logEntry := &model.Log{
 			UserId:           meta.UserId,
+			OrgId:            meta.OrgId,
 			ChannelId:        meta.ChannelId,
 			PromptTokens:     promptTokens,
 			CompletionTokens: completionTokens,
@@ -16,6 +16,7 @@ import (
 	"github.com/Laisky/one-api/model"
 	"github.com/Laisky/one-api/relay"
 	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/guardrail"
 	metalib "github.com/Laisky/one-api/relay/meta"
 	relaymodel "github.com/Laisky/one-api/relay/model"
 	"github.com/Laisky/one-api/relay/pricing"
@@ -34,6 +35,9 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	if err := logClientRequestPayload(c, "response_api"); err != nil {
 		return openai.ErrorWrapper(err, "invalid_response_api_request", http.StatusBadRequest)
 	}
+	if bizErr := applyRequestGuardrail(c, meta, guardrail.FormatResponseAPI); bizErr != nil {
+		return bizErr
+	}
 
 	var channelRecord *model.Channel
 	if channelModel, ok := c.Get(ctxkey.ChannelModel); ok {
@@ -89,6 +93,17 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	// 	lg.Debug("get response api request", zap.ByteString("body", reqBody.([]byte)))
 	// }
 
+	// Function tools and json_schema formats the model cannot handle natively are
+	// emulated on the chat path
+	if responseRequestNeedsToolCallEmulation(c, meta, responseAPIRequest) ||
+		responseRequestNeedsStructuredOutputEmulation(c, meta, responseAPIRequest) {
+		lg.Debug("response api request routed through chat fallback for emulation",
+			zap.String("origin_model", meta.OriginModelName),
+			zap.String("actual_model", meta.ActualModelName),
+		)
+		return relayResponseAPIThroughChat(c, meta, responseAPIRequest)
+	}
+
 	// Route channels without native Response API support through the ChatCompletion fallback
 	if !supportsNativeResponseAPI(meta) {
 		lg.Debug("response api request routed through chat fallback",
@@ -116,6 +131,10 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	} else if divert {
 		return relayResponseAPIThroughChat(c, meta, responseAPIRequest)
 	}
+	// Only the chat fallback can fit the conversation into the context window.
+	if bizErr := rejectUnsupportedContextStrategy(c, "native Response API"); bizErr != nil {
+		return bizErr
+	}
 	// Snapshot the pre-call state so the native result can be committed with its
 	// upstream handle after completion (ST-021). No-op when the feature is inactive.
 	capturePendingStateCommit(c, meta, responseAPIRequest)
@@ -231,6 +250,7 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	c.Set(ctxkey.SkipAdaptorResponseBodyLog, true)
 	var usage *relaymodel.Usage
 	var respErr *relaymodel.ErrorWithStatusCode
+	guardrailWriter := beginGuardrailResponseCapture(c, meta)
 	if supportsDeepSeekNativeResponseAPI(meta) {
 		// The dedicated DeepSeek adaptor handles Chat Completions responses. V4
 		// Flash's native Responses endpoint must retain its SSE/JSON wire format,
@@ -247,6 +267,7 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	} else {
 		usage, respErr = requestAdaptor.DoResponse(c, resp, meta)
 	}
+	finishGuardrailResponseCapture(c, meta, guardrail.FormatResponseAPI, guardrailWriter, respErr == nil)
 	lg.Debug("response api DoResponse returned",
 		zap.Bool("has_usage", usage != nil),
 		zap.Bool("has_error", respErr != nil),
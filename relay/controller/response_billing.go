@@ -40,7 +40,7 @@ func preConsumeResponseAPIQuota(
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return baseQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -56,7 +56,7 @@ func preConsumeResponseAPIQuota(
 	if err != nil {
 		return baseQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 	}
-	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, baseQuota, "response_api_preconsume")
+	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, meta.OrgId, baseQuota, "response_api_preconsume")
 
 	return baseQuota, nil
 }
@@ -192,38 +192,43 @@ func postConsumeResponseAPIQuota(ctx context.Context,
 		}
 
 		postConsumeResponseAPIQuotaDetailed(billing.QuotaConsumeDetail{
-			Ctx:                ctx,
-			TokenId:            meta.TokenId,
-			QuotaDelta:         quotaDelta,
-			TotalQuota:         quota,
-			UserId:             meta.UserId,
-			UserUUID:           meta.UserUUID,
-			ChannelId:          meta.ChannelId,
-			ChannelUUID:        meta.ChannelUUID,
-			PromptTokens:       promptTokens,
-			CompletionTokens:   completionTokens,
-			ModelRatio:         usedModelRatio,
-			GroupRatio:         groupRatio,
-			OriginModelName:    meta.OriginModelName,
-			ModelName:          responseAPIRequest.Model,
-			TokenUUID:          meta.TokenUUID,
-			TokenName:          meta.TokenName,
-			IsStream:           meta.IsStream,
-			StartTime:          meta.StartTime,
-			SystemPromptReset:  false,
-			CompletionRatio:    usedCompletionRatio,
-			ToolsCost:          usage.ToolsCost,
-			CachedPromptTokens: cachedPrompt,
-			CacheWrite5mTokens: usage.CacheWrite5mTokens,
-			CacheWrite1hTokens: usage.CacheWrite1hTokens,
-			Metadata:           metadata,
-			RequestId:          requestId,
-			TraceId:            traceId,
-			ProvisionalLogId:   provisionalLogId,
-			UserAPIFormat:      resolveUserAPIFormat(meta.Mode),
-			UpstreamAPIFormat:  apitype.String(meta.APIType),
-			UpstreamEndpoint:   meta.UpstreamRequestURL,
-			ToolUsageSummary:   toolSummary,
+			Ctx:                 ctx,
+			TokenId:             meta.TokenId,
+			QuotaDelta:          quotaDelta,
+			TotalQuota:          quota,
+			UserId:              meta.UserId,
+			UserUUID:            meta.UserUUID,
+			OrgId:               meta.OrgId,
+			ChannelId:           meta.ChannelId,
+			ChannelUUID:         meta.ChannelUUID,
+			PromptTokens:        promptTokens,
+			CompletionTokens:    completionTokens,
+			ModelRatio:          usedModelRatio,
+			GroupRatio:          groupRatio,
+			OriginModelName:     meta.OriginModelName,
+			ServedModelName:     meta.ServedModelName,
+			GuardrailViolations: meta.GuardrailViolations,
+			ContextFit:          meta.ContextFit,
+			ParentRequestId:     meta.ParentRequestId,
+			ModelName:           responseAPIRequest.Model,
+			TokenUUID:           meta.TokenUUID,
+			TokenName:           meta.TokenName,
+			IsStream:            meta.IsStream,
+			StartTime:           meta.StartTime,
+			SystemPromptReset:   false,
+			CompletionRatio:     usedCompletionRatio,
+			ToolsCost:           usage.ToolsCost,
+			CachedPromptTokens:  cachedPrompt,
+			CacheWrite5mTokens:  usage.CacheWrite5mTokens,
+			CacheWrite1hTokens:  usage.CacheWrite1hTokens,
+			Metadata:            metadata,
+			RequestId:           requestId,
+			TraceId:             traceId,
+			ProvisionalLogId:    provisionalLogId,
+			UserAPIFormat:       resolveUserAPIFormat(meta.Mode),
+			UpstreamAPIFormat:   apitype.String(meta.APIType),
+			UpstreamEndpoint:    meta.UpstreamRequestURL,
+			ToolUsageSummary:    toolSummary,
 		})
 	} else {
 		// Should not happen; log for investigation
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/helper"
+	metalib "github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/relaymode"
+	"github.com/Laisky/one-api/relay/responsecache"
+)
+
+// responseCacheable reports whether the request may be answered from, and
+// stored into, the exact-match response cache: the cache is enabled, the client
+// did not opt out, and the request is deterministic (an embedding, or a chat
+// completion with temperature 0).
+func responseCacheable(c *gin.Context, meta *metalib.Meta, textRequest *relaymodel.GeneralOpenAIRequest) bool {
+	if !config.ResponseCacheEnabled {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(c.GetHeader(helper.ResponseCacheControlHeader))) {
+	case "no-cache", "no-store":
+		return false
+	}
+	switch meta.Mode {
+	case relaymode.Embeddings:
+		return true
+	case relaymode.ChatCompletions:
+		return textRequest.Temperature != nil && *textRequest.Temperature == 0
+	default:
+		return false
+	}
+}
+
+// lookupResponseCache resolves the cache key of a cacheable request and the
+// entry stored under it. key is empty when the request is not cacheable; entry
+// is nil on a miss. Cache errors are logged and treated as a miss.
+func lookupResponseCache(c *gin.Context, meta *metalib.Meta, textRequest *relaymodel.GeneralOpenAIRequest) (key string, entry *responsecache.Entry) {
+	if !responseCacheable(c, meta, textRequest) {
+		return "", nil
+	}
+	lg := gmw.GetLogger(c)
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		lg.Warn("read request body for response cache failed", zap.Error(err))
+		return "", nil
+	}
+	key, err = responsecache.Key(meta.Group, meta.ActualModelName, body)
+	if err != nil {
+		lg.Warn("build response cache key failed", zap.Error(err))
+		return "", nil
+	}
+	entry, err = responsecache.Get(gmw.Ctx(c), key)
+	if err != nil {
+		lg.Warn("response cache lookup failed", zap.Error(err))
+		entry = nil
+	}
+	// A cached stream only answers a streaming request and vice versa; the
+	// "stream" field is part of the key, so this only guards corrupt entries.
+	if entry != nil && entry.Stream != textRequest.Stream {
+		entry = nil
+	}
+	if entry == nil {
+		c.Header(helper.ResponseCacheHeader, "MISS")
+	}
+	return key, entry
+}
+
+// serveCachedResponse writes a cached entry to the client, replaying SSE
+// streams verbatim, and returns the usage to bill.
+func serveCachedResponse(c *gin.Context, entry *responsecache.Entry) *relaymodel.Usage {
+	gmw.GetLogger(c).Info("served response from cache",
+		zap.Bool("stream", entry.Stream),
+		zap.Int64("cached_at", entry.CreatedAt))
+
+	c.Header(helper.ResponseCacheHeader, "HIT")
+	if entry.Stream {
+		common.SetEventStreamHeaders(c)
+	} else if entry.ContentType != "" {
+		c.Header("Content-Type", entry.ContentType)
+	}
+	status := entry.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	c.Status(status)
+	if _, err := c.Writer.Write(entry.Body); err != nil {
+		gmw.GetLogger(c).Warn("write cached response failed", zap.Error(err))
+	}
+	c.Writer.Flush()
+
+	usage := &relaymodel.Usage{}
+	if entry.Usage != nil {
+		*usage = *entry.Usage
+	}
+	return usage
+}
+
+// responseTeeWriter tees the body written to the client so it can be
+// inspected or stored once the response is complete. It stops capturing once
+// the body exceeds limit and reports the capture as overflowed.
+type responseTeeWriter struct {
+	gin.ResponseWriter
+	buffer   bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+// beginResponseCapture installs a responseTeeWriter capturing at most
+// limit bytes on c. Callers restore c.Writer to its ResponseWriter when done.
+func beginResponseCapture(c *gin.Context, limit int) *responseTeeWriter {
+	w := &responseTeeWriter{ResponseWriter: c.Writer, limit: limit}
+	c.Writer = w
+	return w
+}
+
+// Write proxies data to the client while capturing it.
+func (w *responseTeeWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString proxies s to the client while capturing it.
+func (w *responseTeeWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseTeeWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.buffer.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buffer.Reset()
+		return
+	}
+	w.buffer.Write(data)
+}
+
+// storeResponseCache saves a successfully relayed response under key. Non-200
+// responses, oversize bodies and responses without usage are not stored.
+func storeResponseCache(ctx context.Context, key string, w *responseTeeWriter, stream bool, usage *relaymodel.Usage) {
+	if key == "" || w == nil || w.overflow || usage == nil || w.Status() != http.StatusOK {
+		return
+	}
+	usageCopy := *usage
+	entry := &responsecache.Entry{
+		StatusCode:  http.StatusOK,
+		ContentType: w.Header().Get("Content-Type"),
+		Stream:      stream,
+		Body:        bytes.Clone(w.buffer.Bytes()),
+		Usage:       &usageCopy,
+	}
+	if err := responsecache.Set(ctx, key, entry); err != nil {
+		gmw.GetLogger(ctx).Warn("store response cache entry failed", zap.Error(err))
+	}
+}
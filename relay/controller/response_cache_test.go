@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/helper"
+	"github.com/Laisky/one-api/common/logger"
+	metalib "github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+func enableResponseCache(t *testing.T) {
+	t.Helper()
+	originalEnabled := config.ResponseCacheEnabled
+	originalRedisClient := common.RDB
+	config.ResponseCacheEnabled = true
+	common.RDB = nil
+	t.Cleanup(func() {
+		config.ResponseCacheEnabled = originalEnabled
+		common.RDB = originalRedisClient
+	})
+}
+
+func newResponseCacheContext(body string, headers map[string]string) (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(body))
+	for k, v := range headers {
+		c.Request.Header.Set(k, v)
+	}
+	gmw.SetLogger(c, logger.Logger)
+	return c, rec
+}
+
+func TestResponseCacheable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	enableResponseCache(t)
+	zero, warm := 0.0, 0.7
+	chat := &metalib.Meta{Mode: relaymode.ChatCompletions}
+	embeddings := &metalib.Meta{Mode: relaymode.Embeddings}
+
+	c, _ := newResponseCacheContext(`{}`, nil)
+	require.True(t, responseCacheable(c, chat, &relaymodel.GeneralOpenAIRequest{Temperature: &zero}))
+	require.False(t, responseCacheable(c, chat, &relaymodel.GeneralOpenAIRequest{Temperature: &warm}))
+	require.False(t, responseCacheable(c, chat, &relaymodel.GeneralOpenAIRequest{}))
+	require.True(t, responseCacheable(c, embeddings, &relaymodel.GeneralOpenAIRequest{}))
+	require.False(t, responseCacheable(c, &metalib.Meta{Mode: relaymode.Moderations}, &relaymodel.GeneralOpenAIRequest{}))
+
+	c, _ = newResponseCacheContext(`{}`, map[string]string{helper.ResponseCacheControlHeader: "no-cache"})
+	require.False(t, responseCacheable(c, embeddings, &relaymodel.GeneralOpenAIRequest{}))
+
+	config.ResponseCacheEnabled = false
+	c, _ = newResponseCacheContext(`{}`, nil)
+	require.False(t, responseCacheable(c, embeddings, &relaymodel.GeneralOpenAIRequest{}))
+}
+
+func TestResponseCache_StoreThenReplay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	enableResponseCache(t)
+	zero := 0.0
+	body := `{"model":"gpt-4o","temperature":0,"stream":true,"messages":[{"role":"user","content":"ping"}]}`
+	textRequest := &relaymodel.GeneralOpenAIRequest{Model: "gpt-4o", Temperature: &zero, Stream: true}
+	meta := &metalib.Meta{Mode: relaymode.ChatCompletions, Group: "default", ActualModelName: "gpt-4o-2024-08-06-" + t.Name()}
+
+	// First request: a miss whose streamed body is captured and stored.
+	c, rec := newResponseCacheContext(body, nil)
+	key, entry := lookupResponseCache(c, meta, textRequest)
+	require.NotEmpty(t, key)
+	require.Nil(t, entry)
+	require.Equal(t, "MISS", rec.Header().Get(helper.ResponseCacheHeader))
+
+	stream := "data: {\"choices\":[{\"delta\":{\"content\":\"pong\"}}]}\n\ndata: [DONE]\n\n"
+	writer := beginResponseCapture(c, config.ResponseCacheMaxEntryBytes)
+	common.SetEventStreamHeaders(c)
+	_, err := c.Writer.WriteString(stream)
+	require.NoError(t, err)
+	storeResponseCache(context.Background(), key, writer, true, &relaymodel.Usage{PromptTokens: 5, CompletionTokens: 1, TotalTokens: 6})
+
+	// Second identical request: replayed verbatim with the original usage.
+	c, rec = newResponseCacheContext(body, nil)
+	key2, entry := lookupResponseCache(c, meta, textRequest)
+	require.Equal(t, key, key2)
+	require.NotNil(t, entry)
+	usage := serveCachedResponse(c, entry)
+	require.Equal(t, "HIT", rec.Header().Get(helper.ResponseCacheHeader))
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/event-stream")
+	require.Equal(t, stream, rec.Body.String())
+	require.Equal(t, 5, usage.PromptTokens)
+	require.Equal(t, 1, usage.CompletionTokens)
+
+	// Opting out bypasses the stored entry.
+	c, _ = newResponseCacheContext(body, map[string]string{helper.ResponseCacheControlHeader: "no-store"})
+	key, entry = lookupResponseCache(c, meta, textRequest)
+	require.Empty(t, key)
+	require.Nil(t, entry)
+}
+
+func TestResponseCache_SkipsFailedOrOversizeResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	enableResponseCache(t)
+	originalMaxBytes := config.ResponseCacheMaxEntryBytes
+	config.ResponseCacheMaxEntryBytes = 8
+	t.Cleanup(func() { config.ResponseCacheMaxEntryBytes = originalMaxBytes })
+	meta := &metalib.Meta{Mode: relaymode.Embeddings, Group: "default", ActualModelName: "text-embedding-3-small-" + t.Name()}
+	textRequest := &relaymodel.GeneralOpenAIRequest{}
+	usage := &relaymodel.Usage{PromptTokens: 3}
+
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"upstream error", http.StatusBadRequest, `{}`},
+		{"oversize body", http.StatusOK, `{"data":"0123456789"}`},
+	} {
+		body := `{"input":"` + tc.name + `"}`
+		c, _ := newResponseCacheContext(body, nil)
+		key, _ := lookupResponseCache(c, meta, textRequest)
+		writer := beginResponseCapture(c, config.ResponseCacheMaxEntryBytes)
+		c.Status(tc.status)
+		_, err := c.Writer.WriteString(tc.body)
+		require.NoError(t, err)
+		storeResponseCache(context.Background(), key, writer, false, usage)
+
+		c, _ = newResponseCacheContext(body, nil)
+		_, entry := lookupResponseCache(c, meta, textRequest)
+		require.Nil(t, entry, tc.name)
+	}
+}
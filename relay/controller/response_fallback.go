@@ -108,6 +108,11 @@ func relayResponseAPIThroughChat(c *gin.Context, meta *metalib.Meta, responseAPI
 		return openai.ErrorWrapper(errors.New("invalid api type"), "invalid_api_type", http.StatusBadRequest)
 	}
 
+	channelModelConfigs := getChannelModelConfigs(c)
+	if bizErr := fitChatRequestContext(c, meta, chatRequest, channelModelConfigs); bizErr != nil {
+		return bizErr
+	}
+
 	registry, mcpToolNames, regErr := expandMCPBuiltinsInChatRequest(c, meta, channelRecord, requestAdaptor, chatRequest)
 	if regErr != nil {
 		return openai.ErrorWrapper(regErr, "mcp_tool_registry_failed", http.StatusBadRequest)
@@ -127,6 +132,18 @@ func relayResponseAPIThroughChat(c *gin.Context, meta *metalib.Meta, responseAPI
 			meta.IsStream = false
 		}
 	}
+	// Emulated structured outputs and tool calls are checked on the complete
+	// reply, so upstream never streams.
+	var emulation *structuredOutputEmulation
+	emulateTools := false
+	if registry == nil {
+		emulation = planStructuredOutputEmulation(chatRequest, channelModelConfigs)
+		emulateTools = emulation == nil && toolCallEmulationNeeded(c, meta, chatRequest)
+	}
+	if (emulation != nil || emulateTools) && chatRequest.Stream {
+		chatRequest.Stream = false
+		meta.IsStream = false
+	}
 
 	origWriter := c.Writer
 	var capture *responseCaptureWriter
@@ -162,7 +179,6 @@ func relayResponseAPIThroughChat(c *gin.Context, meta *metalib.Meta, responseAPI
 	}
 
 	channelModelRatio, channelCompletionRatio := getChannelRatios(c)
-	channelModelConfigs := getChannelModelConfigs(c)
 	pricingAdaptor := resolvePricingAdaptor(meta)
 	modelRatio := pricing.ResolveModelRatioAt(chatRequest.Model, channelModelConfigs, channelModelRatio, pricingAdaptor, meta.StartTime)
 	completionRatio := pricing.ResolveCompletionRatioAt(chatRequest.Model, channelModelConfigs, channelCompletionRatio, pricingAdaptor, meta.StartTime)
@@ -189,14 +205,32 @@ func relayResponseAPIThroughChat(c *gin.Context, meta *metalib.Meta, responseAPI
 	}
 
 	requestAdaptor.Init(meta)
-	if registry != nil {
+	if registry != nil || emulation != nil || emulateTools {
 		c.Set(ctxkey.ResponseRewriteHandler, nil)
 		c.Set(ctxkey.ResponseStreamRewriteHandler, nil)
-		response, usage, mcpSummary, incrementalCharged, execErr := executeChatMCPToolLoop(c, meta, chatRequest, registry, preConsumedQuota)
+		var response *openai.TextResponse
+		var usage *relaymodel.Usage
+		var mcpSummary *mcpExecutionSummary
+		var incrementalCharged int64
+		var execErr *relaymodel.ErrorWithStatusCode
+		refundReason := "mcp_tool_loop_failed"
+		switch {
+		case registry != nil:
+			response, usage, mcpSummary, incrementalCharged, execErr = executeChatMCPToolLoop(c, meta, chatRequest, registry, preConsumedQuota)
+		case emulation != nil:
+			refundReason = "structured_output_emulation_failed"
+			response, usage, incrementalCharged, execErr = executeStructuredOutputEmulation(c, meta, chatRequest, emulation, ratio)
+		default:
+			refundReason = "tool_call_emulation_failed"
+			response, usage, execErr = doChatRequestOnce(c, meta, requestAdaptor, chatRequest)
+			if execErr == nil && usage != nil {
+				response.Usage = *usage
+			}
+		}
 		meta.IsStream = downstreamStream
 		metalib.Set2Context(c, meta)
 		if execErr != nil {
-			_ = returnPreConsumedQuotaConservative(ctx, c, preConsumedQuota, meta.TokenId, "mcp_tool_loop_failed")
+			_ = returnPreConsumedQuotaConservative(ctx, c, preConsumedQuota, meta.TokenId, refundReason)
 			return execErr
 		}
 		applyOutputImageCharges(c, &usage, meta)
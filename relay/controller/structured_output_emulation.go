@@ -0,0 +1,315 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/config"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay"
+	"github.com/Laisky/one-api/relay/adaptor/common/structuredjson"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
+	"github.com/Laisky/one-api/relay/billing"
+	metalib "github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+// structuredOutputEmulationFeature is the channel ModelConfig.SupportedFeatures
+// flag that enables gateway-side structured outputs for a model.
+const structuredOutputEmulationFeature = "structured_outputs_emulation"
+
+// structuredOutputToolName names the forced tool when the schema has no usable name.
+const structuredOutputToolName = "json_response"
+
+const (
+	// structuredOutputModeTool forces a single function call whose parameters are the schema.
+	structuredOutputModeTool = "tool"
+	// structuredOutputModeInstruction embeds the schema in a system instruction.
+	structuredOutputModeInstruction = "instruction"
+)
+
+// structuredOutputEmulation describes how a json_schema request is emulated for
+// a model that cannot enforce response_format itself.
+type structuredOutputEmulation struct {
+	mode     string
+	schema   *relaymodel.JSONSchema
+	toolName string
+}
+
+// planStructuredOutputEmulation decides whether a chat request needs gateway-side
+// structured outputs.
+//
+// Emulation applies when the request carries a json_schema response_format and
+// the channel's model config lists structured_outputs_emulation without
+// structured_outputs. Models that also list tools get a forced tool call;
+// the others get a schema-bearing system instruction. Requests that bring their
+// own tools always use the instruction so those tools stay callable.
+func planStructuredOutputEmulation(request *relaymodel.GeneralOpenAIRequest, channelModelConfigs map[string]model.ModelConfigLocal) *structuredOutputEmulation {
+	if request == nil || !structuredOutputEmulationEnabled(channelModelConfigs, request.Model) {
+		return nil
+	}
+	format := request.ResponseFormat
+	if format == nil || format.Type != "json_schema" || format.JsonSchema == nil {
+		return nil
+	}
+
+	plan := &structuredOutputEmulation{
+		mode:   structuredOutputModeInstruction,
+		schema: format.JsonSchema,
+	}
+	if slices.Contains(channelModelConfigs[request.Model].SupportedFeatures, "tools") && len(request.Tools) == 0 {
+		plan.mode = structuredOutputModeTool
+		plan.toolName = structuredOutputToolNameFor(format.JsonSchema)
+	}
+	return plan
+}
+
+// structuredOutputEmulationEnabled reports whether the channel's model config
+// opts modelName into gateway-side structured outputs.
+func structuredOutputEmulationEnabled(channelModelConfigs map[string]model.ModelConfigLocal, modelName string) bool {
+	cfg, ok := channelModelConfigs[modelName]
+	if !ok {
+		return false
+	}
+	return slices.Contains(cfg.SupportedFeatures, structuredOutputEmulationFeature) &&
+		!slices.Contains(cfg.SupportedFeatures, "structured_outputs")
+}
+
+// responseRequestNeedsStructuredOutputEmulation reports whether a Response API
+// request asks for a json_schema text format the model cannot enforce, in which
+// case it must be served through the chat fallback.
+func responseRequestNeedsStructuredOutputEmulation(c *gin.Context, meta *metalib.Meta, request *openai.ResponseAPIRequest) bool {
+	if request == nil || request.Text == nil || request.Text.Format == nil ||
+		!strings.EqualFold(request.Text.Format.Type, "json_schema") {
+		return false
+	}
+	modelName := request.Model
+	if meta != nil && meta.ActualModelName != "" {
+		modelName = meta.ActualModelName
+	}
+	return structuredOutputEmulationEnabled(getChannelModelConfigs(c), modelName)
+}
+
+// planClaudeStructuredOutputEmulation plans structured outputs for a Claude
+// Messages request. A single forced tool with an object schema is how Claude
+// clients ask for structured output; the chat conversion promotes it to a
+// json_schema response_format, which is then planned like a chat request. It
+// returns the converted chat request along with the plan, or nil for both.
+func planClaudeStructuredOutputEmulation(c *gin.Context, request *ClaudeMessagesRequest, channelModelConfigs map[string]model.ModelConfigLocal) (*structuredOutputEmulation, *relaymodel.GeneralOpenAIRequest) {
+	if request == nil || !structuredOutputEmulationEnabled(channelModelConfigs, request.Model) {
+		return nil, nil
+	}
+	convertedAny, err := openai_compatible.ConvertClaudeRequest(c, request)
+	if err != nil {
+		// The regular path reports conversion errors.
+		return nil, nil
+	}
+	// The reply is rendered as Claude here, never by the adaptor.
+	c.Set(ctxkey.ClaudeMessagesConversion, false)
+	chatRequest, ok := convertedAny.(*relaymodel.GeneralOpenAIRequest)
+	if !ok {
+		return nil, nil
+	}
+	plan := planStructuredOutputEmulation(chatRequest, channelModelConfigs)
+	if plan == nil {
+		return nil, nil
+	}
+	return plan, chatRequest
+}
+
+// relayClaudeMessagesWithStructuredOutputEmulation serves a Claude Messages
+// request planned by planClaudeStructuredOutputEmulation. The converted chat
+// request goes through executeStructuredOutputEmulation and the validated
+// document is rendered as a Claude text block, as JSON or SSE events.
+func relayClaudeMessagesWithStructuredOutputEmulation(c *gin.Context, meta *metalib.Meta, chatRequest *relaymodel.GeneralOpenAIRequest, plan *structuredOutputEmulation, ratio float64) (*relaymodel.Usage, int64, *relaymodel.ErrorWithStatusCode) {
+	downstreamStream, mode, requestURLPath := meta.IsStream, meta.Mode, meta.RequestURLPath
+	meta.IsStream = false
+	meta.Mode = relaymode.ChatCompletions
+	meta.RequestURLPath = "/v1/chat/completions"
+	response, usage, incrementalCharged, respErr := executeStructuredOutputEmulation(c, meta, chatRequest, plan, ratio)
+	meta.IsStream, meta.Mode, meta.RequestURLPath = downstreamStream, mode, requestURLPath
+	if respErr != nil {
+		return nil, 0, respErr
+	}
+	return usage, incrementalCharged, writeClaudeMessagesFromChatResponse(c, meta, response, usage, downstreamStream)
+}
+
+// structuredOutputToolNameFor derives a function name from the schema name,
+// keeping only the characters every provider accepts.
+func structuredOutputToolNameFor(schema *relaymodel.JSONSchema) string {
+	var builder strings.Builder
+	for _, r := range schema.Name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			builder.WriteRune(r)
+		}
+		if builder.Len() == 64 {
+			break
+		}
+	}
+	if builder.Len() == 0 {
+		return structuredOutputToolName
+	}
+	return builder.String()
+}
+
+// apply rewrites the request for the selected mode and drops response_format,
+// which the upstream would ignore or reject.
+func (p *structuredOutputEmulation) apply(request *relaymodel.GeneralOpenAIRequest) {
+	request.Stream = false
+	request.StreamOptions = nil
+	if p.mode == structuredOutputModeTool {
+		description := p.schema.Description
+		if description == "" {
+			description = "Return the final answer as arguments of this function."
+		}
+		request.Tools = []relaymodel.Tool{{
+			Type: "function",
+			Function: &relaymodel.Function{
+				Name:        p.toolName,
+				Description: description,
+				Parameters:  p.schema.Schema,
+			},
+		}}
+		request.ToolChoice = map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": p.toolName},
+		}
+		parallel := false
+		request.ParallelTooCalls = &parallel
+	} else {
+		structuredjson.EnsureSchemaInstruction(request)
+	}
+	request.ResponseFormat = nil
+}
+
+// candidate returns the text that should hold the JSON document. passthrough is
+// true when the model called one of the client's own tools instead.
+func (p *structuredOutputEmulation) candidate(choice openai.TextResponseChoice) (text string, passthrough bool) {
+	for _, call := range choice.ToolCalls {
+		if call.Function == nil {
+			continue
+		}
+		if p.mode == structuredOutputModeTool && call.Function.Name == p.toolName {
+			switch args := call.Function.Arguments.(type) {
+			case string:
+				return args, false
+			default:
+				encoded, err := json.Marshal(args)
+				if err != nil {
+					return "", false
+				}
+				return string(encoded), false
+			}
+		}
+		if p.mode == structuredOutputModeInstruction {
+			return "", true
+		}
+	}
+	return choice.StringContent(), false
+}
+
+// executeStructuredOutputEmulation sends the rewritten request upstream, validates
+// the reply against the JSON Schema and asks the model to repair an invalid reply
+// at most config.StructuredOutputEmulationMaxRepairs times.
+//
+// The returned response carries the validated document in message.content with
+// finish_reason "stop", as OpenAI returns native structured outputs. Usage is
+// accumulated across attempts; each repair attempt pre-consumes its own quota,
+// priced at ratio and reported as the incremental charge.
+func executeStructuredOutputEmulation(c *gin.Context, meta *metalib.Meta, request *relaymodel.GeneralOpenAIRequest, plan *structuredOutputEmulation, ratio float64) (*openai.TextResponse, *relaymodel.Usage, int64, *relaymodel.ErrorWithStatusCode) {
+	lg := gmw.GetLogger(c)
+	adaptorInstance := relay.GetAdaptor(meta.APIType)
+	if adaptorInstance == nil {
+		return nil, nil, 0, openai.ErrorWrapper(errors.New("invalid api type"), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptorInstance.Init(meta)
+	plan.apply(request)
+
+	maxRepairs := config.StructuredOutputEmulationMaxRepairs
+	if maxRepairs < 0 {
+		maxRepairs = 0
+	}
+
+	var accumulated *relaymodel.Usage
+	var incrementalCharged int64
+	refundRounds := func() {
+		if incrementalCharged > 0 {
+			billing.ReturnPreConsumedQuota(gmw.Ctx(c), incrementalCharged, meta.TokenId)
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRepairs; attempt++ {
+		if attempt > 0 {
+			promptTokens := getPromptTokens(gmw.Ctx(c), request, meta.Mode)
+			roundQuota, err := preConsumeMCPRoundQuota(c, meta, request, promptTokens, ratio)
+			if err != nil {
+				refundRounds()
+				return nil, accumulated, 0, openai.ErrorWrapper(err, "pre_consume_structured_output_repair_failed", http.StatusForbidden)
+			}
+			incrementalCharged += roundQuota
+		}
+
+		response, usage, respErr := doChatRequestOnce(c, meta, adaptorInstance, request)
+		if respErr != nil {
+			refundRounds()
+			return nil, accumulated, 0, respErr
+		}
+		accumulated = mergeUsage(accumulated, usage)
+
+		choice, ok := firstChoice(response)
+		if !ok {
+			lastErr = errors.New("upstream returned no choices")
+			break
+		}
+		text, passthrough := plan.candidate(choice)
+		if passthrough {
+			return response, accumulated, incrementalCharged, nil
+		}
+
+		document, value, err := structuredjson.ExtractJSON(text)
+		if err == nil {
+			err = structuredjson.Validate(plan.schema.Schema, value)
+		}
+		if err == nil {
+			response.Choices[0].Message = relaymodel.Message{Role: "assistant", Content: document}
+			response.Choices[0].FinishReason = "stop"
+			response.Usage = *accumulated
+			return response, accumulated, incrementalCharged, nil
+		}
+
+		lastErr = err
+		lg.Debug("emulated structured output failed validation",
+			zap.Int("attempt", attempt+1),
+			zap.String("mode", plan.mode),
+			zap.Error(err))
+		request.Messages = append(request.Messages,
+			relaymodel.Message{Role: "assistant", Content: text},
+			relaymodel.Message{Role: "user", Content: structuredOutputRepairPrompt(err)},
+		)
+	}
+
+	refundRounds()
+	return nil, accumulated, 0, openai.ErrorWrapper(
+		errors.Wrap(lastErr, "response does not match the requested JSON schema"),
+		"structured_output_validation_failed",
+		http.StatusBadGateway,
+	)
+}
+
+// structuredOutputRepairPrompt asks the model to resend a corrected document.
+func structuredOutputRepairPrompt(validationErr error) string {
+	return "Your previous reply was rejected: " + validationErr.Error() +
+		". Reply again with only the corrected JSON value that satisfies the schema."
+}
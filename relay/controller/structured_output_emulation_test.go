@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/client"
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/apitype"
+	"github.com/Laisky/one-api/relay/channeltype"
+	metalib "github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+// structuredOutputTestRequest returns a chat request asking for a {"city": string} object.
+func structuredOutputTestRequest(t *testing.T) *relaymodel.GeneralOpenAIRequest {
+	t.Helper()
+	var request relaymodel.GeneralOpenAIRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "ernie-4.0",
+		"messages": [{"role": "user", "content": "Where is the Eiffel tower?"}],
+		"response_format": {"type": "json_schema", "json_schema": {"name": "place", "schema": {
+			"type": "object",
+			"properties": {"city": {"type": "string"}},
+			"required": ["city"],
+			"additionalProperties": false
+		}}}
+	}`), &request))
+	return &request
+}
+
+func TestPlanStructuredOutputEmulation(t *testing.T) {
+	t.Parallel()
+	configs := func(features ...string) map[string]model.ModelConfigLocal {
+		return map[string]model.ModelConfigLocal{"ernie-4.0": {SupportedFeatures: features}}
+	}
+
+	require.Nil(t, planStructuredOutputEmulation(structuredOutputTestRequest(t), nil))
+	require.Nil(t, planStructuredOutputEmulation(structuredOutputTestRequest(t), configs("tools")))
+	require.Nil(t, planStructuredOutputEmulation(structuredOutputTestRequest(t), configs(structuredOutputEmulationFeature, "structured_outputs")))
+
+	plan := planStructuredOutputEmulation(structuredOutputTestRequest(t), configs(structuredOutputEmulationFeature))
+	require.NotNil(t, plan)
+	require.Equal(t, structuredOutputModeInstruction, plan.mode)
+
+	plan = planStructuredOutputEmulation(structuredOutputTestRequest(t), configs(structuredOutputEmulationFeature, "tools"))
+	require.NotNil(t, plan)
+	require.Equal(t, structuredOutputModeTool, plan.mode)
+	require.Equal(t, "place", plan.toolName)
+
+	withTools := structuredOutputTestRequest(t)
+	withTools.Tools = []relaymodel.Tool{{Type: "function", Function: &relaymodel.Function{Name: "lookup"}}}
+	plan = planStructuredOutputEmulation(withTools, configs(structuredOutputEmulationFeature, "tools"))
+	require.NotNil(t, plan)
+	require.Equal(t, structuredOutputModeInstruction, plan.mode, "client tools must stay callable")
+}
+
+func TestExecuteStructuredOutputEmulationRepairsInvalidReply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var bodies []map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(raw, &body))
+		bodies = append(bodies, body)
+
+		arguments := `{"town":"Paris"}`
+		if len(bodies) > 1 {
+			arguments = `{"city":"Paris"}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion",
+			"created": 1,
+			"model":   "ernie-4.0",
+			"choices": []map[string]any{{
+				"index": 0,
+				"message": map[string]any{
+					"role":    "assistant",
+					"content": "",
+					"tool_calls": []map[string]any{{
+						"id":       "call_1",
+						"type":     "function",
+						"function": map[string]any{"name": "place", "arguments": arguments},
+					}},
+				},
+				"finish_reason": "tool_calls",
+			}},
+			"usage": map[string]any{"prompt_tokens": 10, "completion_tokens": 4, "total_tokens": 14},
+		})
+	}))
+	t.Cleanup(upstream.Close)
+
+	prevClient := client.HTTPClient
+	client.HTTPClient = upstream.Client()
+	t.Cleanup(func() { client.HTTPClient = prevClient })
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	gmw.SetLogger(c, logger.Logger)
+
+	meta := &metalib.Meta{
+		Mode:            relaymode.ChatCompletions,
+		APIType:         apitype.OpenAI,
+		ChannelType:     channeltype.OpenAICompatible,
+		BaseURL:         upstream.URL,
+		APIKey:          "sk-test",
+		ActualModelName: "ernie-4.0",
+		RequestURLPath:  "/v1/chat/completions",
+	}
+	request := structuredOutputTestRequest(t)
+	plan := &structuredOutputEmulation{mode: structuredOutputModeTool, schema: request.ResponseFormat.JsonSchema, toolName: "place"}
+
+	response, usage, incremental, relayErr := executeStructuredOutputEmulation(c, meta, request, plan, 0)
+	require.Nil(t, relayErr)
+	require.Zero(t, incremental)
+	require.Len(t, bodies, 2, "an invalid first reply triggers one repair request")
+
+	require.NotContains(t, bodies[0], "response_format")
+	require.Equal(t, "place", bodies[0]["tool_choice"].(map[string]any)["function"].(map[string]any)["name"])
+	repairMessages := bodies[1]["messages"].([]any)
+	repair := repairMessages[len(repairMessages)-1].(map[string]any)
+	require.Equal(t, "user", repair["role"])
+	require.Contains(t, repair["content"], `missing required property "city"`)
+
+	require.Equal(t, `{"city":"Paris"}`, response.Choices[0].StringContent())
+	require.Empty(t, response.Choices[0].ToolCalls)
+	require.Equal(t, "stop", response.Choices[0].FinishReason)
+	require.Equal(t, 20, usage.PromptTokens)
+	require.Equal(t, 20, response.Usage.PromptTokens)
+}
+
+func TestResponseRequestNeedsStructuredOutputEmulation(t *testing.T) {
+	c := toolEmulationTestContext(t, httptest.NewRecorder(), `["`+structuredOutputEmulationFeature+`"]`)
+	meta := toolEmulationTestMeta()
+	request := &openai.ResponseAPIRequest{
+		Model: "legacy-chat",
+		Text:  &openai.ResponseTextConfig{Format: &openai.ResponseTextFormat{Type: "json_schema", Name: "place"}},
+	}
+	require.True(t, responseRequestNeedsStructuredOutputEmulation(c, meta, request))
+
+	request.Text.Format.Type = "text"
+	require.False(t, responseRequestNeedsStructuredOutputEmulation(c, meta, request))
+
+	native := toolEmulationTestContext(t, httptest.NewRecorder(), `["structured_outputs"]`)
+	request.Text.Format.Type = "json_schema"
+	require.False(t, responseRequestNeedsStructuredOutputEmulation(native, meta, request))
+}
+
+func TestRelayClaudeMessagesWithStructuredOutputEmulation(t *testing.T) {
+	ensureResponseFallbackFixtures(t)
+	baseURL, bodies := toolEmulationUpstream(t, "Sure: {\"city\":\"Paris\"}")
+	recorder := httptest.NewRecorder()
+	c := toolEmulationTestContext(t, recorder, `["`+structuredOutputEmulationFeature+`"]`)
+	meta := toolEmulationTestMeta()
+	meta.Mode = relaymode.ClaudeMessages
+	meta.BaseURL = baseURL
+
+	claudeRequest := &ClaudeMessagesRequest{
+		Model:     "legacy-chat",
+		MaxTokens: 256,
+		Messages:  []relaymodel.ClaudeMessage{{Role: "user", Content: "Where is the Eiffel tower?"}},
+		Tools: []relaymodel.ClaudeTool{{
+			Name:        "place",
+			Description: "Return the place as JSON.",
+			InputSchema: map[string]any{
+				"type":                 "object",
+				"properties":           map[string]any{"city": map[string]any{"type": "string"}},
+				"required":             []any{"city"},
+				"additionalProperties": false,
+			},
+		}},
+		ToolChoice: map[string]any{"type": "tool", "name": "place"},
+	}
+	plan, chatRequest := planClaudeStructuredOutputEmulation(c, claudeRequest, getChannelModelConfigs(c))
+	require.NotNil(t, plan)
+	require.Equal(t, structuredOutputModeInstruction, plan.mode)
+
+	usage, incremental, relayErr := relayClaudeMessagesWithStructuredOutputEmulation(c, meta, chatRequest, plan, 0)
+	require.Nil(t, relayErr)
+	require.Zero(t, incremental)
+	require.Equal(t, 10, usage.PromptTokens)
+	require.Equal(t, relaymode.ClaudeMessages, meta.Mode)
+	require.NotContains(t, (*bodies)[0], "response_format")
+	require.NotContains(t, (*bodies)[0], "tools")
+
+	var rendered relaymodel.ClaudeResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rendered))
+	require.Len(t, rendered.Content, 1)
+	require.Equal(t, "text", rendered.Content[0].Type)
+	require.JSONEq(t, `{"city":"Paris"}`, rendered.Content[0].Text)
+
+	plain := &ClaudeMessagesRequest{Model: "legacy-chat", MaxTokens: 16, Messages: claudeRequest.Messages}
+	plan, _ = planClaudeStructuredOutputEmulation(c, plain, getChannelModelConfigs(c))
+	require.Nil(t, plan, "requests without a forced structured tool are relayed as usual")
+}
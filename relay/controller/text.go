@@ -26,10 +26,12 @@ import (
 	"github.com/Laisky/one-api/relay/adaptor/openai"
 	"github.com/Laisky/one-api/relay/apitype"
 	"github.com/Laisky/one-api/relay/channeltype"
+	"github.com/Laisky/one-api/relay/guardrail"
 	metalib "github.com/Laisky/one-api/relay/meta"
 	relaymodel "github.com/Laisky/one-api/relay/model"
 	"github.com/Laisky/one-api/relay/pricing"
 	"github.com/Laisky/one-api/relay/relaymode"
+	"github.com/Laisky/one-api/relay/responsecache"
 	"github.com/Laisky/one-api/relay/streaming"
 	"github.com/Laisky/one-api/relay/tooling"
 )
@@ -41,6 +43,11 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	if err := logClientRequestPayload(c, "chat_completions"); err != nil {
 		return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
 	}
+	if meta.Mode == relaymode.ChatCompletions {
+		if bizErr := applyRequestGuardrail(c, meta, guardrail.FormatChatCompletions); bizErr != nil {
+			return bizErr
+		}
+	}
 
 	// BUG: should not override meta.BaseURL and meta.ChannelId outside of metalib.GetByContext
 	// meta.BaseURL = c.GetString(ctxkey.BaseURL)
@@ -82,6 +89,12 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		return openai.ErrorWrapper(errors.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
 	}
 
+	if meta.Mode == relaymode.ChatCompletions {
+		if bizErr := fitChatRequestContext(c, meta, textRequest, channelModelConfigs); bizErr != nil {
+			return bizErr
+		}
+	}
+
 	registry, mcpToolNames, regErr := expandMCPBuiltinsInChatRequest(c, meta, channelRecord, requestAdaptor, textRequest)
 	if regErr != nil {
 		return openai.ErrorWrapper(regErr, "mcp_tool_registry_failed", http.StatusBadRequest)
@@ -95,6 +108,24 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		}
 	}
 
+	// Emulate json_schema structured outputs and tool calls for models that cannot
+	// handle them natively; the reply is checked before anything is written, so
+	// upstream never streams and streaming clients get the result replayed.
+	downstreamStream := textRequest.Stream
+	includeUsage := textRequest.StreamOptions != nil && textRequest.StreamOptions.IncludeUsage
+	var emulation *structuredOutputEmulation
+	emulateTools := false
+	if registry == nil {
+		if meta.Mode == relaymode.ChatCompletions {
+			emulation = planStructuredOutputEmulation(textRequest, channelModelConfigs)
+		}
+		emulateTools = emulation == nil && toolCallEmulationNeeded(c, meta, textRequest)
+		if (emulation != nil || emulateTools) && textRequest.Stream {
+			textRequest.Stream = false
+			meta.IsStream = false
+		}
+	}
+
 	// get model ratio using three-layer pricing system
 	pricingAdaptor := resolvePricingAdaptor(meta)
 	modelRatio := pricing.ResolveModelRatioAt(textRequest.Model, channelModelConfigs, channelModelRatio, pricingAdaptor, meta.StartTime)
@@ -102,6 +133,19 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	// groupRatio := billingratio.GetGroupRatio(meta.Group)
 	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
 
+	// Exact-match response cache: a hit is billed like a normal request with its
+	// cached usage, at config.ResponseCacheHitRatio of the group ratio. The key
+	// is the raw body, so fitted conversations bypass the cache.
+	var responseCacheKey string
+	var cachedResponse *responsecache.Entry
+	if registry == nil && emulation == nil && !emulateTools && meta.ContextFit == nil {
+		responseCacheKey, cachedResponse = lookupResponseCache(c, meta, textRequest)
+	}
+	if cachedResponse != nil {
+		meta.ResponseCacheHit = true
+		groupRatio *= config.ResponseCacheHitRatio
+	}
+
 	ratio := modelRatio * groupRatio
 	if err := tooling.ValidateChatBuiltinTools(c, textRequest, meta, channelRecord, requestAdaptor); err != nil {
 		return openai.ErrorWrapper(err, "tool_not_allowed", http.StatusBadRequest)
@@ -132,10 +176,39 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	provisionalLogId := recordProvisionalLog(c, meta, textRequest.Model, preConsumedQuota)
 	c.Set(ctxkey.ProvisionalLogId, provisionalLogId)
 
+	if cachedResponse != nil {
+		// Nothing was forwarded upstream, so settlement alone reconciles the
+		// pre-consumed quota against the discounted cached usage.
+		usage := serveCachedResponse(c, cachedResponse)
+		quotaId := c.GetInt(ctxkey.Id)
+		requestId := c.GetString(ctxkey.RequestId)
+		markBillingReconciled(c)
+		runPostBillingWithTimeout(detachForBilling(c), "postBilling", lg, postBillingTimeoutInfo{
+			userID:              meta.UserId,
+			channelID:           meta.ChannelId,
+			model:               textRequest.Model,
+			requestID:           requestId,
+			startTime:           meta.StartTime,
+			estimatedQuota:      func() float64 { return float64(usage.PromptTokens+usage.CompletionTokens) * ratio },
+			guardTimeoutLog:     func() bool { return true },
+			logMessage:          "CRITICAL BILLING TIMEOUT",
+			includeElapsedField: true,
+		}, func(ctx context.Context) {
+			quota := postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, 0, modelRatio, channelModelRatio, groupRatio, systemPromptReset, channelModelConfigs, channelCompletionRatio)
+			if requestId != "" {
+				if err := model.UpdateUserRequestCostQuotaByRequestID(quotaId, requestId, quota); err != nil {
+					lg.Error("update user request cost failed", zap.Error(err), zap.String("request_id", requestId))
+				}
+			}
+		})
+		return nil
+	}
+
 	var tracker *streaming.QuotaTracker
 	if textRequest.Stream {
 		tracker = streaming.NewQuotaTracker(streaming.QuotaTrackerParams{
 			UserID:                 meta.UserId,
+			OrgID:                  meta.OrgId,
 			TokenID:                meta.TokenId,
 			ChannelID:              meta.ChannelId,
 			ModelName:              textRequest.Model,
@@ -155,10 +228,28 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	}
 
 	requestAdaptor.Init(meta)
-	if registry != nil {
-		response, usage, mcpSummary, incrementalCharged, execErr := executeChatMCPToolLoop(c, meta, textRequest, registry, preConsumedQuota)
+	if registry != nil || emulation != nil || emulateTools {
+		var response *openai.TextResponse
+		var usage *relaymodel.Usage
+		var mcpSummary *mcpExecutionSummary
+		var incrementalCharged int64
+		var execErr *relaymodel.ErrorWithStatusCode
+		refundReason := "mcp_tool_loop_failed"
+		switch {
+		case registry != nil:
+			response, usage, mcpSummary, incrementalCharged, execErr = executeChatMCPToolLoop(c, meta, textRequest, registry, preConsumedQuota)
+		case emulation != nil:
+			refundReason = "structured_output_emulation_failed"
+			response, usage, incrementalCharged, execErr = executeStructuredOutputEmulation(c, meta, textRequest, emulation, ratio)
+		default:
+			refundReason = "tool_call_emulation_failed"
+			response, usage, execErr = doChatRequestOnce(c, meta, requestAdaptor, textRequest)
+			if execErr == nil && usage != nil {
+				response.Usage = *usage
+			}
+		}
 		if execErr != nil {
-			_ = returnPreConsumedQuotaConservative(ctx, c, preConsumedQuota, meta.TokenId, "mcp_tool_loop_failed")
+			_ = returnPreConsumedQuotaConservative(ctx, c, preConsumedQuota, meta.TokenId, refundReason)
 			return execErr
 		}
 		applyOutputImageCharges(c, &usage, meta)
@@ -176,7 +267,11 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 			c.Set(ctxkey.ToolInvocationSummary, merged)
 		}
 
-		c.JSON(http.StatusOK, response)
+		if downstreamStream {
+			writeChatResponseAsStream(c, response, usage, includeUsage)
+		} else {
+			c.JSON(http.StatusOK, response)
+		}
 
 		// refund pre-consumed quota immediately
 		_ = returnPreConsumedQuotaConservative(ctx, c, preConsumedQuota, meta.TokenId, "pre_billing_reconcile_mcp")
@@ -309,7 +404,19 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 
 	// do response
 	c.Set(ctxkey.SkipAdaptorResponseBodyLog, true)
+	var cacheWriter *responseTeeWriter
+	if responseCacheKey != "" {
+		cacheWriter = beginResponseCapture(c, config.ResponseCacheMaxEntryBytes)
+	}
+	var guardrailWriter *guardrailResponseWriter
+	if meta.Mode == relaymode.ChatCompletions {
+		guardrailWriter = beginGuardrailResponseCapture(c, meta)
+	}
 	usage, respErr := requestAdaptor.DoResponse(c, resp, meta)
+	finishGuardrailResponseCapture(c, meta, guardrail.FormatChatCompletions, guardrailWriter, respErr == nil)
+	if cacheWriter != nil {
+		c.Writer = cacheWriter.ResponseWriter
+	}
 	if upstreamCapture != nil {
 		logUpstreamResponseFromCapture(lg, resp, upstreamCapture, "chat_completions")
 	} else {
@@ -345,6 +452,9 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 			return openai.ErrorWrapper(trackerErr, "streaming_billing_failed", http.StatusInternalServerError)
 		}
 	}
+	if respErr == nil {
+		storeResponseCache(ctx, responseCacheKey, cacheWriter, meta.IsStream, usage)
+	}
 
 	applyOutputImageCharges(c, &usage, meta)
 	applyOutputAudioCharges(c, &usage, meta)
@@ -446,7 +556,8 @@ func getRequestBody(c *gin.Context, meta *metalib.Meta, textRequest *relaymodel.
 		meta.OriginModelName == meta.ActualModelName &&
 		meta.ChannelType != channeltype.OpenAI &&
 		meta.ChannelType != channeltype.Baichuan &&
-		meta.ForcedSystemPrompt == "" {
+		meta.ForcedSystemPrompt == "" &&
+		meta.ContextFit == nil {
 		c.Set(ctxkey.ConvertedRequest, textRequest)
 		if (c.Request == nil || c.Request.URL == nil || !c.Request.URL.Query().Has("thinking")) && !bytes.Contains(originalBody, []byte(`"extra_body"`)) {
 			return bytes.NewBuffer(originalBody), nil
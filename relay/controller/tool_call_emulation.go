@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay/adaptor"
+	"github.com/Laisky/one-api/relay/adaptor/common/toolprompt"
+	"github.com/Laisky/one-api/relay/adaptor/openai"
+	"github.com/Laisky/one-api/relay/adaptor/openai_compatible"
+	metalib "github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+// modelSupportedFeatures returns the capability list of the upstream model: the
+// channel's ModelConfigs entry when it lists features, otherwise the adaptor's
+// default model metadata. nil means the capabilities are unknown.
+func modelSupportedFeatures(c *gin.Context, meta *metalib.Meta, modelName string) []string {
+	if raw, ok := c.Get(ctxkey.ChannelModel); ok {
+		if channel, ok := raw.(*model.Channel); ok && channel != nil {
+			if cfg, ok := channel.GetModelPriceConfigsWithContext(gmw.Ctx(c))[modelName]; ok && len(cfg.SupportedFeatures) > 0 {
+				return cfg.SupportedFeatures
+			}
+		}
+	}
+	if pricingAdaptor := resolvePricingAdaptor(meta); pricingAdaptor != nil {
+		if cfg, ok := pricingAdaptor.GetDefaultModelPricing()[modelName]; ok {
+			return cfg.SupportedFeatures
+		}
+	}
+	return nil
+}
+
+// modelLacksNativeTools reports whether the model is known not to support
+// function calling. Models with unknown capabilities are trusted with tools.
+func modelLacksNativeTools(c *gin.Context, meta *metalib.Meta, modelName string) bool {
+	if meta == nil {
+		return false
+	}
+	if meta.ActualModelName != "" {
+		modelName = meta.ActualModelName
+	}
+	features := modelSupportedFeatures(c, meta, modelName)
+	return len(features) > 0 && !slices.Contains(features, "tools")
+}
+
+// toolCallEmulationNeeded reports whether a chat request carries function tools
+// that must be emulated through the prompt.
+func toolCallEmulationNeeded(c *gin.Context, meta *metalib.Meta, request *relaymodel.GeneralOpenAIRequest) bool {
+	if request == nil || len(toolprompt.FunctionTools(request.Tools)) == 0 {
+		return false
+	}
+	return modelLacksNativeTools(c, meta, request.Model)
+}
+
+// responseRequestNeedsToolCallEmulation is toolCallEmulationNeeded for Response
+// API requests, which must then be served through the chat fallback.
+func responseRequestNeedsToolCallEmulation(c *gin.Context, meta *metalib.Meta, request *openai.ResponseAPIRequest) bool {
+	if request == nil {
+		return false
+	}
+	for _, tool := range request.Tools {
+		if tool.Type == "function" {
+			return modelLacksNativeTools(c, meta, request.Model)
+		}
+	}
+	return false
+}
+
+// claudeRequestNeedsToolCallEmulation is toolCallEmulationNeeded for Claude
+// Messages requests. Custom tools count; server tools such as web_search do not.
+func claudeRequestNeedsToolCallEmulation(c *gin.Context, meta *metalib.Meta, request *ClaudeMessagesRequest) bool {
+	if request == nil {
+		return false
+	}
+	for _, tool := range request.Tools {
+		if tool.Type == "" || tool.Type == "custom" || tool.InputSchema != nil {
+			return modelLacksNativeTools(c, meta, request.Model)
+		}
+	}
+	return false
+}
+
+// restoreEmulatedToolCalls turns <tool_call> blocks in the replies into
+// structured tool calls, as if the upstream had called the tools natively.
+func restoreEmulatedToolCalls(c *gin.Context, response *openai.TextResponse, tools []relaymodel.Tool) {
+	for idx := range response.Choices {
+		choice := &response.Choices[idx]
+		if len(choice.ToolCalls) > 0 {
+			continue
+		}
+		content, calls := toolprompt.Parse(choice.StringContent(), tools)
+		if len(calls) == 0 {
+			continue
+		}
+		choice.Content = content
+		choice.ToolCalls = calls
+		choice.FinishReason = "tool_calls"
+		gmw.GetLogger(c).Debug("parsed emulated tool calls", zap.Int("choice", idx), zap.Int("tool_calls", len(calls)))
+	}
+}
+
+// relayClaudeMessagesWithToolCallEmulation serves a Claude Messages request whose
+// model cannot call tools. The request is converted to a chat request and sent
+// through doChatRequestOnce, or the MCP tool loop when its tools match MCP
+// servers, with the tools in the prompt. The parsed reply is rendered as Claude
+// JSON or, for streaming clients, as Claude SSE events.
+func relayClaudeMessagesWithToolCallEmulation(c *gin.Context, meta *metalib.Meta, adaptorInstance adaptor.Adaptor, claudeRequest *ClaudeMessagesRequest, preConsumedQuota int64) (*relaymodel.Usage, int64, *relaymodel.ErrorWithStatusCode) {
+	registry, mcpToolNames, chatRequest, err := detectClaudeMCPTools(c, meta, claudeRequest, adaptorInstance)
+	if err != nil {
+		return nil, 0, openai.ErrorWrapper(err, "mcp_tool_registry_failed", http.StatusBadRequest)
+	}
+	if registry != nil {
+		chatRequest.ToolChoice = normalizeChatToolChoiceForMCP(chatRequest.ToolChoice, mcpToolNames)
+	} else {
+		convertedAny, err := openai_compatible.ConvertClaudeRequest(c, claudeRequest)
+		if err != nil {
+			return nil, 0, wrapConvertRequestError(err)
+		}
+		converted, ok := convertedAny.(*relaymodel.GeneralOpenAIRequest)
+		if !ok {
+			return nil, 0, openai.ErrorWrapper(errors.New("converted Claude request is not OpenAI request"), "convert_request_failed", http.StatusInternalServerError)
+		}
+		chatRequest = converted
+	}
+	// The upstream answers in chat format; the Claude rendering happens here.
+	c.Set(ctxkey.ClaudeMessagesConversion, false)
+
+	// Upstream is called as a plain chat completion; the Claude view of meta is
+	// restored before rendering and billing.
+	downstreamStream, mode, requestURLPath := meta.IsStream, meta.Mode, meta.RequestURLPath
+	chatRequest.Stream = false
+	chatRequest.StreamOptions = nil
+	meta.IsStream = false
+	meta.Mode = relaymode.ChatCompletions
+	meta.RequestURLPath = "/v1/chat/completions"
+	var response *openai.TextResponse
+	var usage *relaymodel.Usage
+	var incrementalCharged int64
+	var respErr *relaymodel.ErrorWithStatusCode
+	if registry != nil {
+		var mcpSummary *mcpExecutionSummary
+		response, usage, mcpSummary, incrementalCharged, respErr = executeChatMCPToolLoop(c, meta, chatRequest, registry, preConsumedQuota)
+		if mcpSummary != nil && mcpSummary.summary != nil {
+			var existing *model.ToolUsageSummary
+			if raw, ok := c.Get(ctxkey.ToolInvocationSummary); ok {
+				if summary, ok := raw.(*model.ToolUsageSummary); ok {
+					existing = summary
+				}
+			}
+			c.Set(ctxkey.ToolInvocationSummary, mergeToolUsageSummaries(existing, mcpSummary.summary))
+		}
+	} else {
+		response, usage, respErr = doChatRequestOnce(c, meta, adaptorInstance, chatRequest)
+	}
+	meta.IsStream, meta.Mode, meta.RequestURLPath = downstreamStream, mode, requestURLPath
+	if respErr != nil {
+		return nil, 0, respErr
+	}
+	if usage != nil {
+		response.Usage = *usage
+	}
+	return usage, incrementalCharged, writeClaudeMessagesFromChatResponse(c, meta, response, usage, downstreamStream)
+}
+
+// writeClaudeMessagesFromChatResponse renders a complete chat response as Claude
+// JSON or, for streaming clients, as Claude SSE events.
+func writeClaudeMessagesFromChatResponse(c *gin.Context, meta *metalib.Meta, response *openai.TextResponse, usage *relaymodel.Usage, stream bool) *relaymodel.ErrorWithStatusCode {
+	if !stream {
+		return renderClaudeMessagesFromChatResponse(c, response)
+	}
+	var body bytes.Buffer
+	for _, chunk := range chatResponseStreamChunks(response, usage, true) {
+		encoded, err := json.Marshal(chunk)
+		if err != nil {
+			return openai.ErrorWrapper(err, "marshal_stream_chunk_failed", http.StatusInternalServerError)
+		}
+		body.WriteString("data: ")
+		body.Write(encoded)
+		body.WriteString("\n\n")
+	}
+	body.WriteString("data: [DONE]\n\n")
+	synthetic := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(&body),
+	}
+	promptTokens := 0
+	if usage != nil {
+		promptTokens = usage.PromptTokens
+	}
+	if _, errResp := openai_compatible.ConvertOpenAIStreamToClaudeSSE(c, synthetic, promptTokens, meta.ActualModelName); errResp != nil {
+		return errResp
+	}
+	return nil
+}
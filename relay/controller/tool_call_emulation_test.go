@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v7"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common/client"
+	"github.com/Laisky/one-api/common/ctxkey"
+	"github.com/Laisky/one-api/common/logger"
+	"github.com/Laisky/one-api/model"
+	"github.com/Laisky/one-api/relay"
+	"github.com/Laisky/one-api/relay/apitype"
+	"github.com/Laisky/one-api/relay/channeltype"
+	metalib "github.com/Laisky/one-api/relay/meta"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+	"github.com/Laisky/one-api/relay/relaymode"
+)
+
+// toolEmulationTestContext returns a context whose channel lists the given
+// features for "legacy-chat".
+func toolEmulationTestContext(t *testing.T, recorder http.ResponseWriter, features string) *gin.Context {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	gmw.SetLogger(c, logger.Logger)
+	configs := `{"legacy-chat":{"supported_features":` + features + `}}`
+	c.Set(ctxkey.ChannelModel, &model.Channel{ModelConfigs: &configs})
+	return c
+}
+
+// toolEmulationUpstream serves one chat completion per reply and records the
+// request bodies it receives.
+func toolEmulationUpstream(t *testing.T, replies ...string) (string, *[]map[string]any) {
+	t.Helper()
+	var bodies []map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(raw, &body))
+		bodies = append(bodies, body)
+		reply := replies[min(len(bodies), len(replies))-1]
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion",
+			"created": 1,
+			"model":   "legacy-chat",
+			"choices": []map[string]any{{
+				"index":         0,
+				"message":       map[string]any{"role": "assistant", "content": reply},
+				"finish_reason": "stop",
+			}},
+			"usage": map[string]any{"prompt_tokens": 10, "completion_tokens": 4, "total_tokens": 14},
+		})
+	}))
+	t.Cleanup(upstream.Close)
+
+	prevClient := client.HTTPClient
+	client.HTTPClient = upstream.Client()
+	t.Cleanup(func() { client.HTTPClient = prevClient })
+	return upstream.URL, &bodies
+}
+
+func toolEmulationTestMeta() *metalib.Meta {
+	return &metalib.Meta{
+		Mode:            relaymode.ChatCompletions,
+		APIType:         apitype.OpenAI,
+		ChannelType:     channeltype.OpenAICompatible,
+		APIKey:          "sk-test",
+		ActualModelName: "legacy-chat",
+		RequestURLPath:  "/v1/chat/completions",
+	}
+}
+
+func weatherToolRequest() *relaymodel.GeneralOpenAIRequest {
+	return &relaymodel.GeneralOpenAIRequest{
+		Model:    "legacy-chat",
+		Messages: []relaymodel.Message{{Role: "user", Content: "Weather in Paris?"}},
+		Tools: []relaymodel.Tool{{Type: "function", Function: &relaymodel.Function{
+			Name:       "get_weather",
+			Parameters: map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+		}}},
+	}
+}
+
+func TestToolCallEmulationNeeded(t *testing.T) {
+	meta := toolEmulationTestMeta()
+
+	require.True(t, toolCallEmulationNeeded(toolEmulationTestContext(t, httptest.NewRecorder(), `["json_mode"]`), meta, weatherToolRequest()))
+	require.False(t, toolCallEmulationNeeded(toolEmulationTestContext(t, httptest.NewRecorder(), `["tools","json_mode"]`), meta, weatherToolRequest()))
+
+	noTools := weatherToolRequest()
+	noTools.Tools = []relaymodel.Tool{{Type: "web_search"}}
+	require.False(t, toolCallEmulationNeeded(toolEmulationTestContext(t, httptest.NewRecorder(), `["json_mode"]`), meta, noTools))
+
+	unknown := toolEmulationTestContext(t, httptest.NewRecorder(), `["json_mode"]`)
+	unknownMeta := toolEmulationTestMeta()
+	unknownMeta.ActualModelName = "private-finetune"
+	require.False(t, toolCallEmulationNeeded(unknown, unknownMeta, weatherToolRequest()), "unknown capabilities keep native tools")
+}
+
+func TestDoChatRequestOnceEmulatesToolCalls(t *testing.T) {
+	baseURL, bodies := toolEmulationUpstream(t,
+		"Checking.\n<tool_call>\n{\"name\": \"get_weather\", \"arguments\": {\"city\": \"Paris\"}}\n</tool_call>",
+		"It is sunny in Paris.",
+	)
+	c := toolEmulationTestContext(t, httptest.NewRecorder(), `["json_mode"]`)
+	meta := toolEmulationTestMeta()
+	meta.BaseURL = baseURL
+	adaptorInstance := relay.GetAdaptor(meta.APIType)
+	adaptorInstance.Init(meta)
+	request := weatherToolRequest()
+
+	response, usage, relayErr := doChatRequestOnce(c, meta, adaptorInstance, request)
+	require.Nil(t, relayErr)
+	require.Equal(t, 14, usage.TotalTokens)
+	require.NotContains(t, (*bodies)[0], "tools")
+	upstreamMessages := (*bodies)[0]["messages"].([]any)
+	require.Equal(t, "system", upstreamMessages[0].(map[string]any)["role"])
+	require.Contains(t, upstreamMessages[0].(map[string]any)["content"], "get_weather")
+
+	choice := response.Choices[0]
+	require.Equal(t, "tool_calls", choice.FinishReason)
+	require.Equal(t, "Checking.", choice.StringContent())
+	require.Len(t, choice.ToolCalls, 1)
+	require.Equal(t, "get_weather", choice.ToolCalls[0].Function.Name)
+	require.JSONEq(t, `{"city":"Paris"}`, choice.ToolCalls[0].Function.Arguments.(string))
+	require.Len(t, request.Tools, 1, "the caller's request keeps its tools")
+
+	// The next round replays the call and its result as text, as the MCP loop does.
+	request.Messages = append(request.Messages, choice.Message, relaymodel.Message{
+		Role: "tool", ToolCallId: choice.ToolCalls[0].Id, Content: "sunny",
+	})
+	response, _, relayErr = doChatRequestOnce(c, meta, adaptorInstance, request)
+	require.Nil(t, relayErr)
+	require.Empty(t, response.Choices[0].ToolCalls)
+	require.Equal(t, "It is sunny in Paris.", response.Choices[0].StringContent())
+
+	upstreamMessages = (*bodies)[1]["messages"].([]any)
+	require.Len(t, upstreamMessages, 4)
+	require.Contains(t, upstreamMessages[2].(map[string]any)["content"], `<tool_call>`)
+	result := upstreamMessages[3].(map[string]any)
+	require.Equal(t, "user", result["role"])
+	require.Contains(t, result["content"], "<tool_result name=\"get_weather\"")
+}
+
+// toolEmulationStreamRecorder adds the CloseNotify method gin's stream helpers expect.
+type toolEmulationStreamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (toolEmulationStreamRecorder) CloseNotify() <-chan bool { return make(chan bool) }
+
+func TestRelayClaudeMessagesWithToolCallEmulationStreams(t *testing.T) {
+	ensureResponseFallbackFixtures(t)
+	baseURL, bodies := toolEmulationUpstream(t, "<tool_call><name>get_weather</name><arguments>{\"city\":\"Paris\"}</arguments></tool_call>")
+	recorder := toolEmulationStreamRecorder{httptest.NewRecorder()}
+	c := toolEmulationTestContext(t, recorder, `["json_mode"]`)
+	c.Set(ctxkey.UserObj, &model.User{Id: 1})
+	meta := toolEmulationTestMeta()
+	meta.Mode = relaymode.ClaudeMessages
+	meta.BaseURL = baseURL
+	meta.IsStream = true
+	adaptorInstance := relay.GetAdaptor(meta.APIType)
+	adaptorInstance.Init(meta)
+
+	stream := true
+	claudeRequest := &ClaudeMessagesRequest{
+		Model:     "legacy-chat",
+		MaxTokens: 256,
+		Stream:    &stream,
+		Messages:  []relaymodel.ClaudeMessage{{Role: "user", Content: "Weather in Paris?"}},
+		Tools: []relaymodel.ClaudeTool{{
+			Name:        "get_weather",
+			InputSchema: map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+		}},
+	}
+	require.True(t, claudeRequestNeedsToolCallEmulation(c, meta, claudeRequest))
+
+	usage, incremental, relayErr := relayClaudeMessagesWithToolCallEmulation(c, meta, adaptorInstance, claudeRequest, 0)
+	require.Nil(t, relayErr)
+	require.Zero(t, incremental)
+	require.Equal(t, 10, usage.PromptTokens)
+	require.True(t, meta.IsStream)
+	require.NotEqual(t, true, (*bodies)[0]["stream"])
+	require.NotContains(t, (*bodies)[0], "tools")
+
+	body := recorder.Body.String()
+	require.Contains(t, body, "event: content_block_start")
+	require.Contains(t, body, `"type":"tool_use"`)
+	require.Contains(t, body, `"name":"get_weather"`)
+	require.Contains(t, body, `"partial_json":"{\"city\":\"Paris\"}"`)
+}
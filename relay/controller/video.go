@@ -151,7 +151,7 @@ func RelayVideoHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	tokenName := meta.TokenName
 
 	preConsumedQuota := int64(0)
-	userQuota, err := model.CacheGetUserQuota(ctx, userId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, userId, meta.OrgId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -171,7 +171,7 @@ func RelayVideoHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 			if err := model.PreConsumeTokenQuota(ctx, tokenId, preConsumedQuota); err != nil {
 				return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 			}
-			syncUserQuotaCacheAfterPreConsume(ctx, userId, preConsumedQuota, "video_preconsume")
+			syncUserQuotaCacheAfterPreConsume(ctx, userId, meta.OrgId, preConsumedQuota, "video_preconsume")
 
 			// Billing audit safety net
 			markPreConsumed(c, preConsumedQuota)
@@ -195,7 +195,8 @@ func RelayVideoHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 			}
 			if provLogID > 0 {
 				if err := model.ReconcileConsumeLog(ctx, provLogID, 0,
-					"upstream error, refunded", 0, 0, 0, nil); err != nil {
+					"upstream error, refunded", 0, 0, 0,
+					model.LogMetadata{model.LogMetadataKeyRefundedQuota: preConsumedQuota}); err != nil {
 					lg.Warn("failed to reconcile provisional log on error",
 						zap.Error(err), zap.Int("provisional_log_id", provLogID))
 				}
@@ -211,6 +212,7 @@ func RelayVideoHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		quotaDelta := usedQuota - preConsumedQuota
 		entry := &model.Log{
 			UserId:      userId,
+			OrgId:       meta.OrgId,
 			UserUUID:    model.StringPtrIfNotEmpty(meta.UserUUID),
 			ChannelId:   channelId,
 			ChannelUUID: model.StringPtrIfNotEmpty(meta.ChannelUUID),
@@ -202,7 +202,7 @@ func preConsumeVoiceCloneQuota(c *gin.Context, perCallQuota int64, meta *metalib
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return perCallQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -218,7 +218,7 @@ func preConsumeVoiceCloneQuota(c *gin.Context, perCallQuota int64, meta *metalib
 	if err := model.PreConsumeTokenQuota(ctx, meta.TokenId, perCallQuota); err != nil {
 		return perCallQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 	}
-	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, perCallQuota, "voice_clone_preconsume")
+	syncUserQuotaCacheAfterPreConsume(ctx, meta.UserId, meta.OrgId, perCallQuota, "voice_clone_preconsume")
 
 	return perCallQuota, nil
 }
@@ -243,6 +243,7 @@ func postConsumeVoiceCloneQuota(ctx context.Context,
 	if meta.TokenId > 0 && meta.UserId > 0 && meta.ChannelId > 0 {
 		logEntry := &model.Log{
 			UserId:      meta.UserId,
+			OrgId:       meta.OrgId,
 			ChannelId:   meta.ChannelId,
 			ModelName:   request.Model,
 			TokenName:   meta.TokenName,
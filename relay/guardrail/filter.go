@@ -0,0 +1,345 @@
+package guardrail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// Format identifies the wire format of a relayed request or response.
+type Format int
+
+const (
+	// FormatChatCompletions is the OpenAI Chat Completions format.
+	FormatChatCompletions Format = iota
+	// FormatResponseAPI is the OpenAI Response API format.
+	FormatResponseAPI
+	// FormatClaudeMessages is the Anthropic Messages format.
+	FormatClaudeMessages
+)
+
+// Stages at which a filter runs.
+const (
+	StageRequest  = "request"
+	StageResponse = "response"
+)
+
+// Filters that can report a violation.
+const (
+	FilterKeyword        = "keyword"
+	FilterPattern        = "pattern"
+	FilterPII            = "pii"
+	FilterMaxPromptChars = "max_prompt_chars"
+	FilterModeration     = "moderation"
+	// FilterResponseSize reports a response too large to be checked.
+	FilterResponseSize = "response_size"
+)
+
+// Actions taken on a violation.
+const (
+	// ActionBlocked means the request or response was rejected.
+	ActionBlocked = "blocked"
+	// ActionRedacted means the matched text was replaced before forwarding.
+	ActionRedacted = "redacted"
+	// ActionFlagged means the match was only recorded.
+	ActionFlagged = "flagged"
+	// ActionError means the filter could not run; the traffic was let through.
+	ActionError = "error"
+)
+
+// Violation is one filter finding, recorded in the log metadata.
+type Violation struct {
+	Stage  string `json:"stage"`
+	Filter string `json:"filter"`
+	Action string `json:"action"`
+	// Detail names what matched: the keyword, the pattern, the PII kind or
+	// the moderation categories.
+	Detail string `json:"detail,omitempty"`
+	// Count is the number of matches, for PII findings.
+	Count int `json:"count,omitempty"`
+}
+
+// RequestResult is the outcome of ApplyRequest.
+type RequestResult struct {
+	// Body is the rewritten request body, or nil when nothing was redacted.
+	Body []byte
+	// Violations lists every finding, including the blocking one.
+	Violations []Violation
+	// Blocked is the violation that rejected the request, or nil.
+	Blocked *Violation
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	// cardPattern matches 13-19 digits optionally grouped by spaces or dashes;
+	// candidates must also pass the Luhn check.
+	cardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// phonePattern matches numbers written with a country code, an area code
+	// in parentheses or separators; candidates must have 10-15 digits.
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\d{2,4}(?:[ .-]\d{2,4}){1,4}\b|\+\d{10,15}\b`)
+)
+
+var piiPlaceholders = map[string]string{
+	PIIEmail: "[REDACTED_EMAIL]",
+	PIIPhone: "[REDACTED_PHONE]",
+	PIICard:  "[REDACTED_CARD]",
+}
+
+// requestTextFields lists, per format, the top-level request fields holding
+// prompt text.
+var requestTextFields = map[Format][]string{
+	FormatChatCompletions: {"messages"},
+	FormatResponseAPI:     {"instructions", "input"},
+	FormatClaudeMessages:  {"system", "messages"},
+}
+
+// ApplyRequest redacts PII from the prompt text of a raw JSON request body and
+// then runs the blocking filters on the redacted text.
+//
+// Parameters:
+//   - ctx: request context, passed to the moderator.
+//   - format: the wire format of body.
+//   - body: the raw JSON request body.
+//   - tokenId: the token the moderation call is billed to.
+//
+// Returns:
+//   - *RequestResult: the rewritten body and the findings.
+//   - error: when body is not a JSON object.
+func (e *Engine) ApplyRequest(ctx context.Context, format Format, body []byte, tokenId int) (*RequestResult, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var request map[string]any
+	if err := decoder.Decode(&request); err != nil {
+		return nil, errors.Wrap(err, "decode request body for guardrail")
+	}
+
+	result := &RequestResult{}
+	if len(e.policy.RedactPII) > 0 {
+		counts := map[string]int{}
+		for _, field := range requestTextFields[format] {
+			if value, ok := request[field]; ok {
+				request[field] = walkText(value, func(text string) string {
+					return redactPII(text, e.policy.RedactPII, counts)
+				})
+			}
+		}
+		result.Violations = append(result.Violations, e.piiViolations(StageRequest, counts)...)
+		if len(result.Violations) > 0 {
+			rewritten, err := json.Marshal(request)
+			if err != nil {
+				return nil, errors.Wrap(err, "encode redacted request body")
+			}
+			result.Body = rewritten
+		}
+	}
+
+	var text strings.Builder
+	for _, field := range requestTextFields[format] {
+		collectText(request[field], &text)
+	}
+	prompt := text.String()
+
+	if e.policy.MaxPromptChars > 0 {
+		if n := utf8.RuneCountInString(prompt); n > e.policy.MaxPromptChars {
+			result.block(Violation{Stage: StageRequest, Filter: FilterMaxPromptChars, Action: ActionBlocked})
+			return result, nil
+		}
+	}
+	if violation := e.matchBlocklists(StageRequest, prompt, ActionBlocked); violation != nil {
+		result.block(*violation)
+		return result, nil
+	}
+	if e.policy.ModerationModel != "" && strings.TrimSpace(prompt) != "" {
+		moderation, err := moderate(ctx, ModerationRequest{TokenId: tokenId, Model: e.policy.ModerationModel, Input: prompt})
+		switch {
+		case err != nil:
+			// Moderation fails open: an unavailable moderation model must not
+			// take every guarded request down with it.
+			result.Violations = append(result.Violations, Violation{
+				Stage: StageRequest, Filter: FilterModeration, Action: ActionError, Detail: err.Error(),
+			})
+		case moderation.Flagged:
+			result.block(Violation{
+				Stage: StageRequest, Filter: FilterModeration, Action: ActionBlocked,
+				Detail: strings.Join(moderation.Categories, ","),
+			})
+		}
+	}
+	return result, nil
+}
+
+func (r *RequestResult) block(violation Violation) {
+	r.Violations = append(r.Violations, violation)
+	r.Blocked = &r.Violations[len(r.Violations)-1]
+}
+
+// piiViolations reports the redactions counted per PII kind.
+func (e *Engine) piiViolations(stage string, counts map[string]int) []Violation {
+	var violations []Violation
+	for _, kind := range e.policy.RedactPII {
+		if counts[kind] > 0 {
+			violations = append(violations, Violation{
+				Stage: stage, Filter: FilterPII, Action: ActionRedacted, Detail: kind, Count: counts[kind],
+			})
+		}
+	}
+	return violations
+}
+
+// matchBlocklists returns the first keyword or pattern found in text.
+func (e *Engine) matchBlocklists(stage, text, action string) *Violation {
+	if len(e.keywords) > 0 {
+		lower := strings.ToLower(text)
+		for i, keyword := range e.keywords {
+			if strings.Contains(lower, keyword) {
+				return &Violation{Stage: stage, Filter: FilterKeyword, Action: action, Detail: e.policy.BlockKeywords[i]}
+			}
+		}
+	}
+	for _, pattern := range e.patterns {
+		if pattern.MatchString(text) {
+			return &Violation{Stage: stage, Filter: FilterPattern, Action: action, Detail: pattern.String()}
+		}
+	}
+	return nil
+}
+
+// redactPII replaces every PII match of the given kinds in text and adds the
+// number of replacements per kind to counts.
+func redactPII(text string, kinds []string, counts map[string]int) string {
+	return redactSegments([]string{text}, kinds, counts)[0]
+}
+
+// redactSegments redacts PII from text split across segments, such as the
+// deltas of a stream, matching as if the segments were one string. A match
+// spanning several segments is replaced in the segment where it starts and
+// removed from the others. Cards are handled before phones so a card number
+// is not mistaken for a phone number.
+func redactSegments(segments []string, kinds []string, counts map[string]int) []string {
+	for _, kind := range []string{PIIEmail, PIICard, PIIPhone} {
+		if !slices.Contains(kinds, kind) {
+			continue
+		}
+		var pattern *regexp.Regexp
+		var valid func(string) bool
+		switch kind {
+		case PIIEmail:
+			pattern = emailPattern
+		case PIICard:
+			pattern, valid = cardPattern, luhnValid
+		case PIIPhone:
+			pattern, valid = phonePattern, phoneValid
+		}
+
+		text := strings.Join(segments, "")
+		var matches [][]int
+		for _, match := range pattern.FindAllStringIndex(text, -1) {
+			if valid == nil || valid(text[match[0]:match[1]]) {
+				matches = append(matches, match)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		counts[kind] += len(matches)
+
+		rewritten := make([]string, len(segments))
+		offset := 0
+		for i, segment := range segments {
+			start, end := offset, offset+len(segment)
+			offset = end
+			var b strings.Builder
+			cursor := start
+			for _, match := range matches {
+				if match[1] <= start || match[0] >= end {
+					continue
+				}
+				if match[0] >= start {
+					b.WriteString(text[cursor:match[0]])
+					b.WriteString(piiPlaceholders[kind])
+				}
+				cursor = min(match[1], end)
+			}
+			b.WriteString(text[cursor:end])
+			rewritten[i] = b.String()
+		}
+		segments = rewritten
+	}
+	return segments
+}
+
+func digitsOf(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	digits := digitsOf(s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func phoneValid(s string) bool {
+	n := len(digitsOf(s))
+	return n >= 10 && n <= 15
+}
+
+// walkText applies fn to every prompt string in a decoded JSON value: the
+// value itself when it is a string, the "text" of content parts and,
+// recursively, the "content" of messages, input items and tool results.
+func walkText(value any, fn func(string) string) any {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case []any:
+		for i := range v {
+			v[i] = walkText(v[i], fn)
+		}
+	case map[string]any:
+		if text, ok := v["text"].(string); ok {
+			v["text"] = fn(text)
+		}
+		if content, ok := v["content"]; ok {
+			v["content"] = walkText(content, fn)
+		}
+	}
+	return value
+}
+
+// collectText appends every prompt string of value to b, one per line.
+func collectText(value any, b *strings.Builder) {
+	walkText(value, func(text string) string {
+		if text != "" {
+			b.WriteString(text)
+			b.WriteByte('\n')
+		}
+		return text
+	})
+}
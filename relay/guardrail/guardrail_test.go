@@ -0,0 +1,195 @@
+package guardrail
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicies(t *testing.T) {
+	parsed, err := ParsePolicies(`{" strict ": {"groups": ["default", "default", " vip "], "redact_pii": ["Email"], "block_keywords": [" secret ", ""]}}`)
+	require.NoError(t, err)
+	require.Equal(t, Policy{
+		Groups:        []string{"default", "vip"},
+		BlockKeywords: []string{"secret"},
+		RedactPII:     []string{PIIEmail},
+	}, parsed["strict"])
+
+	parsed, err = ParsePolicies("  ")
+	require.NoError(t, err)
+	require.Empty(t, parsed)
+
+	for _, invalid := range []string{
+		`not json`,
+		`{"": {}}`,
+		`{"a": {"block_patterns": ["("]}}`,
+		`{"a": {"redact_pii": ["ssn"]}}`,
+		`{"a": {"max_prompt_chars": -1}}`,
+		`{"a": {"groups": ["default"]}, "b": {"groups": ["default"]}}`,
+	} {
+		_, err := ParsePolicies(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	require.NoError(t, UpdatePoliciesByJSONString(`{"group-policy": {"groups": ["default"]}, "token-policy": {}}`))
+	t.Cleanup(func() { require.NoError(t, UpdatePoliciesByJSONString("")) })
+
+	names := func(engines []*Engine) []string {
+		var out []string
+		for _, engine := range engines {
+			out = append(out, engine.Name())
+		}
+		return out
+	}
+	require.Equal(t, []string{"group-policy", "token-policy"}, names(Resolve("token-policy", "default")))
+	require.Equal(t, []string{"group-policy"}, names(Resolve("group-policy", "default")))
+	require.Equal(t, []string{"group-policy"}, names(Resolve("deleted-policy", "default")))
+	require.Equal(t, []string{"token-policy"}, names(Resolve("token-policy", "vip")))
+	require.Empty(t, Resolve("", "vip"))
+	require.True(t, HasPolicy("token-policy"))
+	require.False(t, HasPolicy("deleted-policy"))
+}
+
+func TestRedactPII(t *testing.T) {
+	counts := map[string]int{}
+	redacted := redactPII(
+		"mail jane.doe@example.co.uk, call +1 (555) 123-4567 or 555.123.4567, "+
+			"card 4111 1111 1111 1111, order 1234567890123 on 2026-10-16 at 1760000000",
+		[]string{PIIEmail, PIIPhone, PIICard}, counts)
+
+	require.Equal(t,
+		"mail [REDACTED_EMAIL], call [REDACTED_PHONE] or [REDACTED_PHONE], "+
+			"card [REDACTED_CARD], order 1234567890123 on 2026-10-16 at 1760000000",
+		redacted)
+	require.Equal(t, map[string]int{PIIEmail: 1, PIIPhone: 2, PIICard: 1}, counts)
+}
+
+func TestApplyRequestRedactsAndBlocks(t *testing.T) {
+	engine := compile("test", Policy{
+		RedactPII:     []string{PIIEmail},
+		BlockKeywords: []string{"Launch Codes"},
+		BlockPatterns: []string{`(?i)\bdrop\s+table\b`},
+	})
+	ctx := context.Background()
+
+	result, err := engine.ApplyRequest(ctx, FormatChatCompletions, []byte(`{"model":"gpt-4o","temperature":0.5,"messages":[
+		{"role":"system","content":"mail ops@example.com"},
+		{"role":"user","content":[{"type":"text","text":"cc bob@example.com"},{"type":"image_url","image_url":{"url":"https://x/a@b.co"}}]}
+	]}`), 1)
+	require.NoError(t, err)
+	require.Nil(t, result.Blocked)
+	require.Equal(t, []Violation{{Stage: StageRequest, Filter: FilterPII, Action: ActionRedacted, Detail: PIIEmail, Count: 2}}, result.Violations)
+
+	var rewritten map[string]any
+	require.NoError(t, json.Unmarshal(result.Body, &rewritten))
+	messages := rewritten["messages"].([]any)
+	require.Equal(t, "mail [REDACTED_EMAIL]", messages[0].(map[string]any)["content"])
+	parts := messages[1].(map[string]any)["content"].([]any)
+	require.Equal(t, "cc [REDACTED_EMAIL]", parts[0].(map[string]any)["text"])
+	require.Equal(t, "https://x/a@b.co", parts[1].(map[string]any)["image_url"].(map[string]any)["url"], "only prompt text is rewritten")
+	require.Equal(t, 0.5, rewritten["temperature"])
+
+	result, err = engine.ApplyRequest(ctx, FormatResponseAPI, []byte(`{"input":"what are the launch codes?"}`), 1)
+	require.NoError(t, err)
+	require.Nil(t, result.Body)
+	require.Equal(t, &Violation{Stage: StageRequest, Filter: FilterKeyword, Action: ActionBlocked, Detail: "Launch Codes"}, result.Blocked)
+
+	result, err = engine.ApplyRequest(ctx, FormatClaudeMessages, []byte(`{"system":[{"type":"text","text":"DROP  TABLE users"}],"messages":[]}`), 1)
+	require.NoError(t, err)
+	require.NotNil(t, result.Blocked)
+	require.Equal(t, FilterPattern, result.Blocked.Filter)
+
+	_, err = engine.ApplyRequest(ctx, FormatChatCompletions, []byte(`[]`), 1)
+	require.Error(t, err)
+}
+
+func TestApplyRequestLimitsAndModeration(t *testing.T) {
+	ctx := context.Background()
+	engine := compile("test", Policy{MaxPromptChars: 5})
+	result, err := engine.ApplyRequest(ctx, FormatResponseAPI, []byte(`{"instructions":"be brief","input":"hi"}`), 1)
+	require.NoError(t, err)
+	require.Equal(t, FilterMaxPromptChars, result.Blocked.Filter)
+
+	var seen ModerationRequest
+	SetModerator(func(_ context.Context, req ModerationRequest) (*ModerationResult, error) {
+		seen = req
+		return &ModerationResult{Flagged: req.Input == "bad\n", Categories: []string{"violence"}}, nil
+	})
+	t.Cleanup(func() { SetModerator(nil) })
+
+	engine = compile("test", Policy{ModerationModel: "omni-moderation-latest"})
+	result, err = engine.ApplyRequest(ctx, FormatChatCompletions, []byte(`{"messages":[{"role":"user","content":"bad"}]}`), 7)
+	require.NoError(t, err)
+	require.Equal(t, ModerationRequest{TokenId: 7, Model: "omni-moderation-latest", Input: "bad\n"}, seen)
+	require.Equal(t, &Violation{Stage: StageRequest, Filter: FilterModeration, Action: ActionBlocked, Detail: "violence"}, result.Blocked)
+
+	SetModerator(func(context.Context, ModerationRequest) (*ModerationResult, error) {
+		return nil, errors.New("upstream down")
+	})
+	result, err = engine.ApplyRequest(ctx, FormatChatCompletions, []byte(`{"messages":[{"role":"user","content":"bad"}]}`), 7)
+	require.NoError(t, err)
+	require.Nil(t, result.Blocked, "moderation fails open")
+	require.Len(t, result.Violations, 1)
+	require.Equal(t, ActionError, result.Violations[0].Action)
+}
+
+func TestRedactSegments(t *testing.T) {
+	counts := map[string]int{}
+	redacted := redactSegments([]string{"mail jane", ".doe@exa", "mple.com now", ""}, []string{PIIEmail}, counts)
+
+	require.Equal(t, []string{"mail [REDACTED_EMAIL]", "", " now", ""}, redacted)
+	require.Equal(t, map[string]int{PIIEmail: 1}, counts)
+}
+
+func TestApplyResponse(t *testing.T) {
+	engine := compile("test", Policy{BlockKeywords: []string{"secret"}, RedactPII: []string{PIIEmail}, CheckResponse: true})
+
+	chat := engine.ApplyResponse(FormatChatCompletions, []byte(`{"id":"x","choices":[{"message":{"content":"write a@b.io"}}]}`), false)
+	require.Nil(t, chat.Blocked)
+	require.Equal(t, []Violation{
+		{Stage: StageResponse, Filter: FilterPII, Action: ActionRedacted, Detail: PIIEmail, Count: 1},
+	}, chat.Violations)
+	require.JSONEq(t, `{"id":"x","choices":[{"message":{"content":"write [REDACTED_EMAIL]"}}]}`, string(chat.Body))
+
+	chatStream := "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"mail a@\"}}]}\n\n" +
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"b.io ok\"}}]}\n\ndata: [DONE]\n\n"
+	streamed := engine.ApplyResponse(FormatChatCompletions, []byte(chatStream), true)
+	require.Nil(t, streamed.Blocked)
+	require.Len(t, streamed.Violations, 1)
+	require.Equal(t, "data: {\"choices\":[{\"delta\":{\"content\":\"mail [REDACTED_EMAIL]\"},\"index\":0}]}\n\n"+
+		"data: {\"choices\":[{\"delta\":{\"content\":\" ok\"},\"index\":0}]}\n\ndata: [DONE]\n\n", string(streamed.Body))
+
+	responseStream := "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"the sec\"}\n\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"ret\"}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"output\":[{\"content\":[{\"text\":\"the secret\"}]}]}}\n\n"
+	blocked := engine.ApplyResponse(FormatResponseAPI, []byte(responseStream), true)
+	require.NotNil(t, blocked.Blocked)
+	require.Equal(t, Violation{Stage: StageResponse, Filter: FilterKeyword, Action: ActionBlocked, Detail: "secret"}, *blocked.Blocked)
+	require.Nil(t, blocked.Body)
+
+	responseAPI := `{"object":"response","output":[{"type":"reasoning","summary":[]},{"type":"message","content":[{"type":"output_text","text":"to a@b.io"}]}]}`
+	redacted := engine.ApplyResponse(FormatResponseAPI, []byte(responseAPI), false)
+	require.Contains(t, string(redacted.Body), `"text":"to [REDACTED_EMAIL]"`)
+
+	responseSnapshot := "data: {\"type\":\"response.output_text.delta\",\"delta\":\"to a@b.io\"}\n\n" +
+		"data: {\"type\":\"response.output_text.done\",\"text\":\"to a@b.io\"}\n\n"
+	snapshot := engine.ApplyResponse(FormatResponseAPI, []byte(responseSnapshot), true)
+	require.Equal(t, 1, snapshot.Violations[0].Count)
+	require.NotContains(t, string(snapshot.Body), "a@b.io")
+
+	claude := `{"type":"message","content":[{"type":"text","text":"a secret"},{"type":"tool_use","input":{"text":"secret"}}]}`
+	require.NotNil(t, engine.ApplyResponse(FormatClaudeMessages, []byte(claude), false).Blocked)
+	claudeStream := "data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"se\"}}\n\n" +
+		"data: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"text_delta\",\"text\":\"cret\"}}\n\n"
+	require.Nil(t, engine.ApplyResponse(FormatClaudeMessages, []byte(claudeStream), true).Blocked,
+		"deltas of different content blocks are not joined")
+
+	fine := engine.ApplyResponse(FormatChatCompletions, []byte(`{"choices":[{"message":{"content":"fine"}}]}`), false)
+	require.Empty(t, fine.Violations)
+	require.Nil(t, fine.Body)
+}
@@ -0,0 +1,59 @@
+package guardrail
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// ModerationRequest asks the moderation model to classify prompt text.
+type ModerationRequest struct {
+	// TokenId is the token the moderation call is authenticated and billed as.
+	TokenId int
+	// Model is the moderation model, e.g. "omni-moderation-latest".
+	Model string
+	// Input is the prompt text.
+	Input string
+}
+
+// ModerationResult is the verdict of the moderation model.
+type ModerationResult struct {
+	Flagged bool
+	// Categories lists the flagged categories.
+	Categories []string
+}
+
+// Moderator classifies prompt text, typically through the /v1/moderations relay.
+type Moderator func(ctx context.Context, req ModerationRequest) (*ModerationResult, error)
+
+var (
+	moderatorLock sync.RWMutex
+	moderator     Moderator
+)
+
+// SetModerator installs the function policies with a moderation model call.
+// The relay package cannot reach the HTTP router itself, so the server wires
+// it at startup.
+func SetModerator(m Moderator) {
+	moderatorLock.Lock()
+	defer moderatorLock.Unlock()
+	moderator = m
+}
+
+func moderate(ctx context.Context, req ModerationRequest) (*ModerationResult, error) {
+	moderatorLock.RLock()
+	m := moderator
+	moderatorLock.RUnlock()
+	if m == nil {
+		return nil, errors.New("no moderator is configured")
+	}
+	result, err := m(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "moderate prompt")
+	}
+	if result == nil {
+		return &ModerationResult{}, nil
+	}
+	return result, nil
+}
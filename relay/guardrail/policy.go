@@ -0,0 +1,235 @@
+// Package guardrail implements the content-policy filters the relay runs on
+// prompts before they are forwarded upstream and, optionally, on the response
+// text returned to the client. Policies are configured by administrators in the
+// GuardrailPolicies option and bound to user groups or individual tokens.
+package guardrail
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/Laisky/one-api/common/logger"
+)
+
+// PII kinds accepted in Policy.RedactPII.
+const (
+	PIIEmail = "email"
+	PIIPhone = "phone"
+	PIICard  = "card"
+)
+
+// Policy is one named set of filters.
+type Policy struct {
+	// Groups lists the user groups the policy applies to. A group may belong
+	// to at most one policy.
+	Groups []string `json:"groups,omitempty"`
+	// BlockKeywords rejects prompts containing any of the keywords,
+	// compared case-insensitively.
+	BlockKeywords []string `json:"block_keywords,omitempty"`
+	// BlockPatterns rejects prompts matching any of the regular expressions.
+	BlockPatterns []string `json:"block_patterns,omitempty"`
+	// RedactPII lists the PII kinds ("email", "phone", "card") replaced by a
+	// placeholder before the prompt is forwarded.
+	RedactPII []string `json:"redact_pii,omitempty"`
+	// MaxPromptChars rejects prompts whose text exceeds this many characters.
+	// Zero disables the limit.
+	MaxPromptChars int `json:"max_prompt_chars,omitempty"`
+	// ModerationModel, when set, sends the prompt text to this model through
+	// the /v1/moderations relay and rejects flagged prompts.
+	ModerationModel string `json:"moderation_model,omitempty"`
+	// CheckResponse also applies the keyword, pattern and PII filters to the
+	// response text: PII is redacted and a keyword or pattern match blocks
+	// the response.
+	CheckResponse bool `json:"check_response,omitempty"`
+}
+
+// Engine is a compiled Policy ready to inspect traffic.
+type Engine struct {
+	name     string
+	policy   Policy
+	keywords []string
+	patterns []*regexp.Regexp
+}
+
+// Name returns the name the policy is configured under.
+func (e *Engine) Name() string {
+	return e.name
+}
+
+// ChecksResponse reports whether response text should be inspected.
+func (e *Engine) ChecksResponse() bool {
+	return e.policy.CheckResponse
+}
+
+var policiesLock sync.RWMutex
+
+// policies holds the active GuardrailPolicies option value, engines its
+// compiled form keyed by policy name, and groupPolicies maps a user group to
+// the name of the policy that applies to it.
+var (
+	policies      = map[string]Policy{}
+	engines       = map[string]*Engine{}
+	groupPolicies = map[string]string{}
+)
+
+// ParsePolicies decodes and validates a GuardrailPolicies option value. An
+// empty value removes every policy.
+//
+// Parameters:
+//   - jsonStr: JSON object mapping a policy name to its Policy.
+//
+// Returns:
+//   - map[string]Policy: the normalized policies, with names, groups and keywords trimmed.
+//   - error: when the JSON is malformed, a name is blank, a pattern does not compile,
+//     a PII kind is unknown, a limit is negative, or a group is bound to two policies.
+func ParsePolicies(jsonStr string) (map[string]Policy, error) {
+	parsed := map[string]Policy{}
+	if strings.TrimSpace(jsonStr) == "" {
+		return parsed, nil
+	}
+
+	var raw map[string]Policy
+	if err := json.Unmarshal([]byte(jsonStr), &raw); err != nil {
+		return nil, errors.Wrap(err, "unmarshal guardrail policies")
+	}
+	owners := map[string]string{}
+	for name, policy := range raw {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, errors.New("guardrail policy has an empty name")
+		}
+		normalized, err := normalizePolicy(name, policy)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range normalized.Groups {
+			if owner, ok := owners[group]; ok {
+				return nil, errors.Errorf("group %q is bound to both guardrail policies %q and %q", group, owner, name)
+			}
+			owners[group] = name
+		}
+		parsed[name] = normalized
+	}
+	return parsed, nil
+}
+
+func normalizePolicy(name string, policy Policy) (Policy, error) {
+	out := Policy{
+		MaxPromptChars:  policy.MaxPromptChars,
+		ModerationModel: strings.TrimSpace(policy.ModerationModel),
+		CheckResponse:   policy.CheckResponse,
+	}
+	if out.MaxPromptChars < 0 {
+		return Policy{}, errors.Errorf("guardrail policy %q has a negative max_prompt_chars", name)
+	}
+	for _, group := range policy.Groups {
+		group = strings.TrimSpace(group)
+		if group != "" && !slices.Contains(out.Groups, group) {
+			out.Groups = append(out.Groups, group)
+		}
+	}
+	for _, keyword := range policy.BlockKeywords {
+		keyword = strings.TrimSpace(keyword)
+		if keyword != "" {
+			out.BlockKeywords = append(out.BlockKeywords, keyword)
+		}
+	}
+	for _, pattern := range policy.BlockPatterns {
+		if pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return Policy{}, errors.Wrapf(err, "guardrail policy %q has an invalid block pattern", name)
+		}
+		out.BlockPatterns = append(out.BlockPatterns, pattern)
+	}
+	for _, kind := range policy.RedactPII {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		switch kind {
+		case PIIEmail, PIIPhone, PIICard:
+		default:
+			return Policy{}, errors.Errorf("guardrail policy %q has an unknown redact_pii kind %q", name, kind)
+		}
+		if !slices.Contains(out.RedactPII, kind) {
+			out.RedactPII = append(out.RedactPII, kind)
+		}
+	}
+	return out, nil
+}
+
+func compile(name string, policy Policy) *Engine {
+	engine := &Engine{name: name, policy: policy}
+	for _, keyword := range policy.BlockKeywords {
+		engine.keywords = append(engine.keywords, strings.ToLower(keyword))
+	}
+	for _, pattern := range policy.BlockPatterns {
+		// Patterns were validated by ParsePolicies.
+		engine.patterns = append(engine.patterns, regexp.MustCompile(pattern))
+	}
+	return engine
+}
+
+// Policies2JSONString serializes the active policies for OptionMap.
+func Policies2JSONString() string {
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	jsonBytes, err := json.Marshal(policies)
+	if err != nil {
+		logger.Logger.Error("error marshalling guardrail policies", zap.Error(err))
+	}
+	return string(jsonBytes)
+}
+
+// UpdatePoliciesByJSONString replaces the active policies.
+func UpdatePoliciesByJSONString(jsonStr string) error {
+	parsed, err := ParsePolicies(jsonStr)
+	if err != nil {
+		return errors.Wrap(err, "update guardrail policies")
+	}
+	compiled := make(map[string]*Engine, len(parsed))
+	groups := map[string]string{}
+	for name, policy := range parsed {
+		compiled[name] = compile(name, policy)
+		for _, group := range policy.Groups {
+			groups[group] = name
+		}
+	}
+
+	policiesLock.Lock()
+	defer policiesLock.Unlock()
+	policies = parsed
+	engines = compiled
+	groupPolicies = groups
+	return nil
+}
+
+// HasPolicy reports whether a policy named name is configured.
+func HasPolicy(name string) bool {
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	_, ok := engines[name]
+	return ok
+}
+
+// Resolve returns the engines that apply to a request, the group policy first.
+// A token's own policy runs in addition to its group's policy, never instead
+// of it, so token owners can tighten but not loosen what an administrator
+// bound to their group. Unknown names are ignored.
+func Resolve(tokenPolicy, group string) []*Engine {
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	var resolved []*Engine
+	if name, ok := groupPolicies[group]; ok {
+		resolved = append(resolved, engines[name])
+	}
+	if engine, ok := engines[tokenPolicy]; ok && (len(resolved) == 0 || resolved[0] != engine) {
+		resolved = append(resolved, engine)
+	}
+	return resolved
+}
@@ -0,0 +1,286 @@
+package guardrail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ResponseResult is the outcome of ApplyResponse.
+type ResponseResult struct {
+	// Body is the rewritten response body, or nil when nothing was redacted.
+	Body []byte
+	// Violations lists every finding, including the blocking one.
+	Violations []Violation
+	// Blocked is the violation that rejects the response, or nil.
+	Blocked *Violation
+}
+
+func (r *ResponseResult) block(violation Violation) {
+	r.Violations = append(r.Violations, violation)
+	r.Blocked = &r.Violations[len(r.Violations)-1]
+}
+
+// ApplyResponse redacts PII from the generated text of a complete response
+// body and then runs the keyword and pattern filters on the redacted text.
+// For streams, body holds the SSE events: the text deltas are matched as one
+// transcript per output, and the events repeating the full text are redacted
+// as well.
+//
+// Parameters:
+//   - format: the wire format of body.
+//   - body: the raw response body.
+//   - stream: whether body is an SSE stream.
+//
+// Returns:
+//   - *ResponseResult: the rewritten body and the findings. A body that cannot
+//     be decoded yields no findings.
+func (e *Engine) ApplyResponse(format Format, body []byte, stream bool) *ResponseResult {
+	if stream {
+		return e.applyStreamResponse(format, body)
+	}
+
+	result := &ResponseResult{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document map[string]any
+	if err := decoder.Decode(&document); err != nil {
+		return result
+	}
+
+	counts := map[string]int{}
+	var text strings.Builder
+	rewriteResponseText(format, document, func(s string) string {
+		s = redactPII(s, e.policy.RedactPII, counts)
+		if s != "" {
+			text.WriteString(s)
+			text.WriteByte('\n')
+		}
+		return s
+	})
+	result.Violations = e.piiViolations(StageResponse, counts)
+	if len(result.Violations) > 0 {
+		if rewritten, err := json.Marshal(document); err == nil {
+			result.Body = rewritten
+		}
+	}
+	if violation := e.matchBlocklists(StageResponse, text.String(), ActionBlocked); violation != nil {
+		result.block(*violation)
+	}
+	return result
+}
+
+// streamEvent is one decoded "data:" line of an SSE body.
+type streamEvent struct {
+	line    int
+	prefix  []byte
+	data    map[string]any
+	changed bool
+}
+
+// textDelta is one text fragment of a stream event.
+type textDelta struct {
+	event *streamEvent
+	text  string
+	set   func(string)
+}
+
+func (e *Engine) applyStreamResponse(format Format, body []byte) *ResponseResult {
+	result := &ResponseResult{}
+	lines := bytes.Split(body, []byte("\n"))
+
+	var events []*streamEvent
+	for i, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		payload, ok := bytes.CutPrefix(trimmed, []byte("data:"))
+		if !ok {
+			continue
+		}
+		prefix := []byte("data:")
+		if bytes.HasPrefix(payload, []byte(" ")) {
+			prefix = []byte("data: ")
+		}
+		payload = bytes.TrimSpace(payload)
+		if len(payload) == 0 || bytes.Equal(payload, []byte("[DONE]")) {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(payload))
+		decoder.UseNumber()
+		var data map[string]any
+		if err := decoder.Decode(&data); err != nil {
+			continue
+		}
+		events = append(events, &streamEvent{line: i, prefix: prefix, data: data})
+	}
+
+	// Group the deltas per output so a match split across events is found.
+	var keys []string
+	outputs := map[string][]textDelta{}
+	for _, event := range events {
+		for key, delta := range streamDeltas(format, event) {
+			if _, ok := outputs[key]; !ok {
+				keys = append(keys, key)
+			}
+			outputs[key] = append(outputs[key], delta)
+		}
+	}
+
+	counts := map[string]int{}
+	var transcript strings.Builder
+	for _, key := range keys {
+		deltas := outputs[key]
+		segments := make([]string, len(deltas))
+		for i, delta := range deltas {
+			segments[i] = delta.text
+		}
+		redacted := segments
+		if len(e.policy.RedactPII) > 0 {
+			redacted = redactSegments(segments, e.policy.RedactPII, counts)
+		}
+		for i, delta := range deltas {
+			if redacted[i] != segments[i] {
+				delta.set(redacted[i])
+				delta.event.changed = true
+			}
+		}
+		transcript.WriteString(strings.Join(redacted, ""))
+		transcript.WriteByte('\n')
+	}
+	result.Violations = e.piiViolations(StageResponse, counts)
+
+	if len(e.policy.RedactPII) > 0 {
+		// Events repeating the full text were already counted via the deltas.
+		for _, event := range events {
+			repeated := map[string]int{}
+			rewriteStreamSnapshots(format, event.data, func(s string) string {
+				return redactPII(s, e.policy.RedactPII, repeated)
+			})
+			if len(repeated) > 0 {
+				event.changed = true
+			}
+		}
+	}
+
+	rewritten := false
+	for _, event := range events {
+		if !event.changed {
+			continue
+		}
+		data, err := json.Marshal(event.data)
+		if err != nil {
+			continue
+		}
+		lines[event.line] = append(bytes.Clone(event.prefix), data...)
+		rewritten = true
+	}
+	if rewritten {
+		result.Body = bytes.Join(lines, []byte("\n"))
+	}
+
+	if violation := e.matchBlocklists(StageResponse, transcript.String(), ActionBlocked); violation != nil {
+		result.block(*violation)
+	}
+	return result
+}
+
+// streamDeltas returns the text deltas of a stream event keyed by the output
+// they belong to: the choice of a Chat Completion chunk, the content part of a
+// Response API item or the content block of a Claude message.
+func streamDeltas(format Format, event *streamEvent) map[string]textDelta {
+	deltas := map[string]textDelta{}
+	switch format {
+	case FormatChatCompletions:
+		choices, _ := event.data["choices"].([]any)
+		for _, choice := range choices {
+			choice, _ := choice.(map[string]any)
+			delta, ok := choice["delta"].(map[string]any)
+			if !ok {
+				continue
+			}
+			if content, ok := delta["content"].(string); ok {
+				deltas[fmt.Sprint("choice:", choice["index"])] = textDelta{
+					event: event, text: content, set: func(s string) { delta["content"] = s },
+				}
+			}
+		}
+	case FormatResponseAPI:
+		if event.data["type"] != "response.output_text.delta" {
+			break
+		}
+		if text, ok := event.data["delta"].(string); ok {
+			deltas[fmt.Sprint("output:", event.data["output_index"], ":", event.data["content_index"])] = textDelta{
+				event: event, text: text, set: func(s string) { event.data["delta"] = s },
+			}
+		}
+	case FormatClaudeMessages:
+		if event.data["type"] != "content_block_delta" {
+			break
+		}
+		delta, ok := event.data["delta"].(map[string]any)
+		if !ok {
+			break
+		}
+		if text, ok := delta["text"].(string); ok {
+			deltas[fmt.Sprint("block:", event.data["index"])] = textDelta{
+				event: event, text: text, set: func(s string) { delta["text"] = s },
+			}
+		}
+	}
+	return deltas
+}
+
+// rewriteStreamSnapshots applies fn to the stream event fields that repeat
+// text already streamed as deltas, such as the final response of a Response
+// API stream.
+func rewriteStreamSnapshots(format Format, data map[string]any, fn func(string) string) {
+	switch format {
+	case FormatResponseAPI:
+		if response, ok := data["response"].(map[string]any); ok {
+			rewriteResponseText(format, response, fn)
+		}
+		for _, field := range []string{"item", "part"} {
+			if value, ok := data[field]; ok {
+				data[field] = walkText(value, fn)
+			}
+		}
+		if data["type"] == "response.output_text.done" {
+			if text, ok := data["text"].(string); ok {
+				data["text"] = fn(text)
+			}
+		}
+	case FormatClaudeMessages:
+		if message, ok := data["message"].(map[string]any); ok {
+			rewriteResponseText(format, message, fn)
+		}
+		if block, ok := data["content_block"]; ok {
+			data["content_block"] = walkText(block, fn)
+		}
+	}
+}
+
+// rewriteResponseText applies fn to the generated text of a complete
+// response: the message content of a Chat Completion, the output text of a
+// Response API response or the text blocks of a Claude message.
+func rewriteResponseText(format Format, document map[string]any, fn func(string) string) {
+	switch format {
+	case FormatChatCompletions:
+		choices, _ := document["choices"].([]any)
+		for _, choice := range choices {
+			choice, _ := choice.(map[string]any)
+			if message, ok := choice["message"].(map[string]any); ok {
+				if content, ok := message["content"]; ok {
+					message["content"] = walkText(content, fn)
+				}
+			}
+		}
+	case FormatResponseAPI:
+		if output, ok := document["output"]; ok {
+			document["output"] = walkText(output, fn)
+		}
+	case FormatClaudeMessages:
+		if content, ok := document["content"]; ok {
+			document["content"] = walkText(content, fn)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Laisky/errors/v2"
 	gmw "github.com/Laisky/gin-middlewares/v7"
+	glog "github.com/Laisky/go-utils/v6/log"
 	"github.com/Laisky/zap"
 	"github.com/gin-gonic/gin"
 
@@ -12,6 +14,8 @@ import (
 	"github.com/Laisky/one-api/common/identity"
 	"github.com/Laisky/one-api/model"
 	"github.com/Laisky/one-api/relay/channeltype"
+	"github.com/Laisky/one-api/relay/contextfit"
+	"github.com/Laisky/one-api/relay/guardrail"
 	"github.com/Laisky/one-api/relay/relaymode"
 )
 
@@ -48,6 +52,7 @@ type Meta struct {
 	UserId       int
 	UserUUID     string
 	Username     string
+	OrgId        int // organization paying for the request; 0 when the user pays
 	Group        string
 	ModelMapping map[string]string
 	// BaseURL is the proxy url set in the channel config
@@ -56,10 +61,17 @@ type Meta struct {
 	APIType  int
 	Config   model.ChannelConfig
 	IsStream bool
+	// CredentialErr is set when the channel key or a config credential could
+	// not be decrypted. The relay must fail such a request instead of sending
+	// ciphertext upstream.
+	CredentialErr error
 	// OriginModelName is the model name from the raw user request
 	OriginModelName string
 	// ActualModelName is the model name after mapping
-	ActualModelName     string
+	ActualModelName string
+	// ServedModelName is the model the channel serves, which differs from
+	// OriginModelName only after degrading along a model fallback chain
+	ServedModelName     string
 	RequestURLPath      string
 	ResponseAPIFallback bool
 	PromptTokens        int // only for DoResponse
@@ -69,6 +81,18 @@ type Meta struct {
 	// UpstreamRequestURL is the final URL sent to the upstream provider.
 	// Populated by the relay layer before/after the request is dispatched.
 	UpstreamRequestURL string
+	// ResponseCacheHit marks a request answered from the exact-match response
+	// cache instead of the upstream.
+	ResponseCacheHit bool
+	// GuardrailViolations collects the non-blocking guardrail findings on the
+	// request and response, recorded in the consume log metadata.
+	GuardrailViolations []guardrail.Violation
+	// ContextFit describes how an oversized conversation was fitted into the
+	// context window; nil when the request was relayed as sent.
+	ContextFit *contextfit.Result
+	// ParentRequestId is set on in-process sub-requests, such as a context
+	// summary, to the request id of the client request they were made for.
+	ParentRequestId string
 }
 
 // GetMappedModelName returns the mapped model name and a bool indicating if the model name is mapped
@@ -106,9 +130,12 @@ func GetByContext(c *gin.Context) *Meta {
 	lg := gmw.GetLogger(c)
 	if v, ok := c.Get(ctxkey.Meta); ok {
 		existingMeta := v.(*Meta)
-		// Check if channel information has changed (indicating a retry with new channel)
+		// Check if channel information has changed (indicating a retry with new
+		// channel, or a model fallback that may reuse the same channel)
 		currentChannelId := c.GetInt(ctxkey.ChannelId)
-		if existingMeta.ChannelId != currentChannelId && currentChannelId != 0 {
+		currentServedModel := c.GetString(ctxkey.ServedModel)
+		if (existingMeta.ChannelId != currentChannelId && currentChannelId != 0) ||
+			existingMeta.ServedModelName != currentServedModel {
 			// Channel has changed, update the cached meta with new channel information
 			if lg != nil {
 				lg.Info("Channel changed during retry", zap.Int("from", existingMeta.ChannelId), zap.Int("to", currentChannelId), zap.String("action", "updating meta"))
@@ -117,16 +144,14 @@ func GetByContext(c *gin.Context) *Meta {
 			existingMeta.ChannelId = currentChannelId
 			existingMeta.ChannelUUID = c.GetString(ctxkey.ChannelUUID)
 			existingMeta.ChannelName = c.GetString(ctxkey.ChannelName)
+			existingMeta.ServedModelName = currentServedModel
 			existingMeta.BaseURL = c.GetString(ctxkey.BaseURL)
-			existingMeta.APIKey = strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
 			existingMeta.ChannelRatio = c.GetFloat64(ctxkey.ChannelRatio)
 			existingMeta.ModelMapping = c.GetStringMapString(ctxkey.ModelMapping)
 			existingMeta.ForcedSystemPrompt = c.GetString(ctxkey.SystemPrompt)
 
-			// Update config
-			if cfg, ok := c.Get(ctxkey.Config); ok {
-				existingMeta.Config = cfg.(model.ChannelConfig)
-			}
+			// Update the decrypted key and config
+			existingMeta.loadChannelCredentials(c, lg)
 
 			// Update BaseURL fallback if needed
 			if existingMeta.BaseURL == "" {
@@ -156,21 +181,20 @@ func GetByContext(c *gin.Context) *Meta {
 		UserId:             c.GetInt(ctxkey.Id),
 		UserUUID:           c.GetString(ctxkey.UserUUID),
 		Username:           c.GetString(ctxkey.Username),
+		OrgId:              c.GetInt(ctxkey.OrgId),
 		Group:              c.GetString(ctxkey.Group),
 		ModelMapping:       c.GetStringMapString(ctxkey.ModelMapping),
 		OriginModelName:    c.GetString(ctxkey.RequestModel),
 		ActualModelName:    c.GetString(ctxkey.RequestModel),
+		ServedModelName:    c.GetString(ctxkey.ServedModel),
 		BaseURL:            c.GetString(ctxkey.BaseURL),
-		APIKey:             strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
 		RequestURLPath:     c.Request.URL.String(),
 		ChannelRatio:       c.GetFloat64(ctxkey.ChannelRatio), // add by Laisky
 		ForcedSystemPrompt: c.GetString(ctxkey.SystemPrompt),
+		ParentRequestId:    c.GetString(ctxkey.ParentRequestId),
 		StartTime:          time.Now(),
 	}
-	cfg, ok := c.Get(ctxkey.Config)
-	if ok {
-		meta.Config = cfg.(model.ChannelConfig)
-	}
+	meta.loadChannelCredentials(c, lg)
 	if meta.BaseURL == "" {
 		meta.BaseURL = channeltype.ChannelBaseURLs[meta.ChannelType]
 	}
@@ -183,6 +207,74 @@ func GetByContext(c *gin.Context) *Meta {
 	return &meta
 }
 
+// loadChannelCredentials sets the decrypted key and config of the selected
+// channel. The distributor forwards the stored, possibly encrypted, key in the
+// Authorization header and the stored config in the context; this is the only
+// place a relay request decrypts them. On any decryption failure the key and
+// config are cleared and CredentialErr is set, so no ciphertext is ever used as
+// a credential.
+func (m *Meta) loadChannelCredentials(c *gin.Context, lg glog.Logger) {
+	m.APIKey, m.Config, m.CredentialErr = "", model.ChannelConfig{}, nil
+
+	key, err := model.OpenChannelSecret(strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "))
+	if err != nil {
+		m.failCredentials(c, lg, errors.Wrap(err, "decrypt channel key"))
+		return
+	}
+	cfg, ok, err := channelConfig(c)
+	if err != nil {
+		m.failCredentials(c, lg, err)
+		return
+	}
+	m.APIKey = key
+	if ok {
+		m.Config = cfg
+	}
+}
+
+// failCredentials records a credential decryption failure.
+func (m *Meta) failCredentials(c *gin.Context, lg glog.Logger, err error) {
+	m.CredentialErr = err
+	if lg != nil {
+		lg.Error("failed to decrypt channel credentials",
+			zap.Int("channel_id", c.GetInt(ctxkey.ChannelId)), zap.Error(err))
+	}
+}
+
+// channelConfig returns the selected channel's config with its credential
+// fields decrypted. ok is false when no config was set or any field failed to
+// decrypt, in which case the partially decrypted config is discarded.
+func channelConfig(c *gin.Context) (cfg model.ChannelConfig, ok bool, err error) {
+	v, exists := c.Get(ctxkey.Config)
+	if !exists {
+		return model.ChannelConfig{}, false, nil
+	}
+	cfg, err = v.(model.ChannelConfig).OpenSecrets()
+	if err != nil {
+		return model.ChannelConfig{}, false, errors.Wrap(err, "decrypt channel config secrets")
+	}
+	return cfg, true, nil
+}
+
+// RevealChannelSecrets returns a copy of channel with its key and config
+// credentials decrypted, for upstream calls made outside a relay request, such
+// as balance queries. Together with GetByContext it is the only decryption
+// point for outbound credentials.
+//
+// Parameters:
+//   - channel: the stored channel.
+//
+// Return values:
+//   - *model.Channel: the decrypted copy.
+//   - error: when any credential cannot be decrypted.
+func RevealChannelSecrets(channel *model.Channel) (*model.Channel, error) {
+	revealed, err := channel.WithRevealedSecrets()
+	if err != nil {
+		return nil, errors.Wrapf(err, "decrypt secrets of channel %d", channel.Id)
+	}
+	return revealed, nil
+}
+
 func Set2Context(c *gin.Context, meta *Meta) {
 	c.Set(ctxkey.Meta, meta)
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/Laisky/one-api/common/ctxkey"
 	"github.com/Laisky/one-api/model"
 	"github.com/Laisky/one-api/relay/channeltype"
+	"github.com/Laisky/one-api/relay/state"
 )
 
 // TestIsClaudeModelName verifies case/space-insensitive Claude-family detection.
@@ -177,3 +178,64 @@ func TestEnsureActualModelName(t *testing.T) {
 	meta.EnsureActualModelName("")
 	require.Equal(t, "mapped", meta.ActualModelName, "expected ActualModelName to remain unchanged")
 }
+
+// TestGetByContext_DecryptsChannelSecrets verifies that the encrypted channel
+// key and config credentials forwarded by the distributor reach the adaptor in
+// plaintext.
+func TestGetByContext_DecryptsChannelSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ring, err := state.ParseKeyRing("v1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	require.NoError(t, err)
+	model.SetChannelSecretKeyRing(ring)
+	t.Cleanup(func() { model.SetChannelSecretKeyRing(nil) })
+
+	sealedKey, err := ring.Seal("sk-upstream-secret")
+	require.NoError(t, err)
+	sealedSK, err := ring.Seal("aws-secret")
+	require.NoError(t, err)
+
+	c, _ := gin.CreateTestContext(nil)
+	c.Request = &http.Request{
+		URL:    &url.URL{Path: "/v1/chat/completions"},
+		Header: make(http.Header),
+	}
+	c.Request.Header.Set("Authorization", "Bearer "+sealedKey)
+	c.Set(ctxkey.ChannelId, 100)
+	c.Set(ctxkey.Config, model.ChannelConfig{AK: "AKIAEXAMPLE", SK: sealedSK})
+
+	meta := GetByContext(c)
+	require.Equal(t, "sk-upstream-secret", meta.APIKey)
+	require.Equal(t, "AKIAEXAMPLE", meta.Config.AK, "legacy plaintext passes through")
+	require.Equal(t, "aws-secret", meta.Config.SK)
+}
+
+// TestGetByContext_FailsOnUndecryptableSecrets verifies that a config
+// credential that cannot be decrypted clears the credentials and records the
+// error instead of passing ciphertext on.
+func TestGetByContext_FailsOnUndecryptableSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	oldRing, err := state.ParseKeyRing("v0:ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	require.NoError(t, err)
+	sealedSK, err := oldRing.Seal("aws-secret")
+	require.NoError(t, err)
+
+	ring, err := state.ParseKeyRing("v1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	require.NoError(t, err)
+	model.SetChannelSecretKeyRing(ring)
+	t.Cleanup(func() { model.SetChannelSecretKeyRing(nil) })
+
+	c, _ := gin.CreateTestContext(nil)
+	c.Request = &http.Request{
+		URL:    &url.URL{Path: "/v1/chat/completions"},
+		Header: make(http.Header),
+	}
+	c.Request.Header.Set("Authorization", "Bearer sk-plaintext")
+	c.Set(ctxkey.ChannelId, 100)
+	c.Set(ctxkey.Config, model.ChannelConfig{AK: "AKIAEXAMPLE", SK: sealedSK})
+
+	meta := GetByContext(c)
+	require.Error(t, meta.CredentialErr)
+	require.Empty(t, meta.APIKey)
+	require.Empty(t, meta.Config.SK, "no ciphertext may be used as a credential")
+	require.Empty(t, meta.Config.AK)
+}
@@ -118,6 +118,8 @@ type GeneralOpenAIRequest struct {
 	// Others
 	Instruction string `json:"instruction,omitempty"`
 	NumCtx      int    `json:"num_ctx,omitempty"`
+	// KeepAlive is how long Ollama keeps the model loaded after the request.
+	KeepAlive any `json:"keep_alive,omitempty"`
 	// Duration is the length of the audio/video in seconds
 	Duration *int `json:"duration,omitempty"`
 	// -------------------------------------
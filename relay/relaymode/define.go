@@ -28,6 +28,9 @@ const (
 	// VoiceClone handles voice cloning / timbre replication endpoints
 	// (e.g., /v1/voice/clones, Zhipu /api/paas/v4/voice/clone).
 	VoiceClone
+	// GeminiNative handles Google Gemini native endpoints
+	// (e.g., /v1beta/models/{model}:generateContent).
+	GeminiNative
 )
 
 func String(mode int) string {
@@ -68,6 +71,8 @@ func String(mode int) string {
 		return "ocr"
 	case VoiceClone:
 		return "voice_clone"
+	case GeminiNative:
+		return "gemini_native"
 	default:
 		return "unknown"
 	}
@@ -4,6 +4,8 @@ import "strings"
 
 func GetByPath(path string) int {
 	switch {
+	case strings.HasPrefix(path, GeminiNativePathPrefix):
+		return GeminiNative
 	case strings.HasPrefix(path, "/v1/realtime"):
 		return Realtime
 	case strings.HasPrefix(path, "/v1/oneapi/proxy"):
@@ -51,3 +53,21 @@ func GetByPath(path string) int {
 		return Unknown
 	}
 }
+
+// GeminiNativePathPrefix is the route prefix of the native Gemini surface.
+const GeminiNativePathPrefix = "/v1beta/models/"
+
+// ParseGeminiNativePath splits a native Gemini path such as
+// /v1beta/models/gemini-2.5-flash:generateContent into the model name and the
+// action. Both are empty when the path is not a native Gemini model action.
+func ParseGeminiNativePath(path string) (modelName string, action string) {
+	rest, ok := strings.CutPrefix(path, GeminiNativePathPrefix)
+	if !ok {
+		return "", ""
+	}
+	idx := strings.LastIndex(rest, ":")
+	if idx <= 0 || idx == len(rest)-1 {
+		return "", ""
+	}
+	return rest[:idx], rest[idx+1:]
+}
@@ -48,3 +48,25 @@ func TestGetByPathVoiceClone(t *testing.T) {
 	require.Equal(t, VoiceClone, GetByPath("/api/paas/v4/voice_clone"), "expected VoiceClone for /api/paas/v4/voice_clone")
 	require.Equal(t, "voice_clone", String(VoiceClone), "expected voice_clone mode string")
 }
+
+func TestGetByPathGeminiNative(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, GeminiNative, GetByPath("/v1beta/models/gemini-2.5-flash:generateContent"))
+	require.Equal(t, GeminiNative, GetByPath("/v1beta/models/text-embedding-004:embedContent"))
+	require.Equal(t, "gemini_native", String(GeminiNative))
+}
+
+func TestParseGeminiNativePath(t *testing.T) {
+	t.Parallel()
+	modelName, action := ParseGeminiNativePath("/v1beta/models/gemini-2.5-flash:streamGenerateContent")
+	require.Equal(t, "gemini-2.5-flash", modelName)
+	require.Equal(t, "streamGenerateContent", action)
+
+	modelName, action = ParseGeminiNativePath("/v1beta/models/gemini-2.5-flash")
+	require.Empty(t, modelName)
+	require.Empty(t, action)
+
+	modelName, action = ParseGeminiNativePath("/v1/models/gemini-2.5-flash:generateContent")
+	require.Empty(t, modelName)
+	require.Empty(t, action)
+}
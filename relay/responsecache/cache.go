@@ -0,0 +1,185 @@
+// Package responsecache stores relay responses for exact repeats of
+// deterministic requests (embeddings and temperature-0 chat completions), so
+// identical calls can be answered without going upstream.
+package responsecache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+const redisKeyPrefix = "response_cache:"
+
+// Entry is one cached response.
+type Entry struct {
+	// StatusCode is the HTTP status the client originally received.
+	StatusCode int `json:"status_code"`
+	// ContentType is the original Content-Type header.
+	ContentType string `json:"content_type"`
+	// Stream reports whether Body is an SSE stream to replay verbatim.
+	Stream bool `json:"stream"`
+	// Body is the exact response body written to the client.
+	Body []byte `json:"body"`
+	// Usage is the upstream usage of the original request, billed again on a hit.
+	Usage *relaymodel.Usage `json:"usage"`
+	// CreatedAt is the unix time the entry was stored.
+	CreatedAt int64 `json:"created_at"`
+}
+
+// Key derives the cache key of a request from its body, the resolved upstream
+// model and the user group. The body is normalized by decoding and re-encoding
+// it (which sorts object keys) and dropping "model", which the resolved model
+// replaces.
+//
+// Parameters:
+//   - group: the user group; groups never share entries.
+//   - actualModel: the model name sent upstream after mapping.
+//   - body: the raw JSON request body.
+//
+// Returns:
+//   - string: the storage key.
+//   - error: when the body is not a JSON object.
+func Key(group, actualModel string, body []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var request map[string]any
+	if err := decoder.Decode(&request); err != nil {
+		return "", errors.Wrap(err, "decode request body for response cache key")
+	}
+	delete(request, "model")
+	normalized, err := json.Marshal(request)
+	if err != nil {
+		return "", errors.Wrap(err, "normalize request body for response cache key")
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(group))
+	hash.Write([]byte{0})
+	hash.Write([]byte(actualModel))
+	hash.Write([]byte{0})
+	hash.Write(normalized)
+	return redisKeyPrefix + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Get returns the entry stored under key, or nil on a miss.
+func Get(ctx context.Context, key string) (*Entry, error) {
+	if !usesRedis() {
+		return memory.get(key), nil
+	}
+
+	raw, err := common.RDB.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "get response cache entry %s", key)
+	}
+	entry := new(Entry)
+	if err := json.Unmarshal(raw, entry); err != nil {
+		return nil, errors.Wrapf(err, "decode response cache entry %s", key)
+	}
+	return entry, nil
+}
+
+// Set stores entry under key for config.ResponseCacheTTLSec seconds. Entries
+// whose body exceeds config.ResponseCacheMaxEntryBytes are silently skipped.
+func Set(ctx context.Context, key string, entry *Entry) error {
+	if entry == nil || len(entry.Body) == 0 || len(entry.Body) > config.ResponseCacheMaxEntryBytes {
+		return nil
+	}
+	ttl := time.Duration(config.ResponseCacheTTLSec) * time.Second
+	if ttl <= 0 {
+		return nil
+	}
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = time.Now().Unix()
+	}
+
+	if !usesRedis() {
+		memory.set(key, entry, ttl, config.ResponseCacheMaxEntries)
+		return nil
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "encode response cache entry")
+	}
+	if err := common.RDB.Set(ctx, key, raw, ttl).Err(); err != nil {
+		return errors.Wrapf(err, "set response cache entry %s", key)
+	}
+	return nil
+}
+
+func usesRedis() bool {
+	return common.IsRedisEnabled() && common.RDB != nil
+}
+
+// memory is the process-local store used when Redis is not enabled.
+var memory = newMemoryStore()
+
+// memoryStore is a TTL-bounded LRU of entries.
+type memoryStore struct {
+	mu    sync.Mutex
+	order *list.List // front = most recently used
+	items map[string]*list.Element
+}
+
+type memoryItem struct {
+	key       string
+	entry     *Entry
+	expiresAt time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (s *memoryStore) get(key string) *Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	item := elem.Value.(*memoryItem)
+	if time.Now().After(item.expiresAt) {
+		s.order.Remove(elem)
+		delete(s.items, key)
+		return nil
+	}
+	s.order.MoveToFront(elem)
+	return item.entry
+}
+
+func (s *memoryStore) set(key string, entry *Entry, ttl time.Duration, maxEntries int) {
+	if maxEntries <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item := &memoryItem{key: key, entry: entry, expiresAt: time.Now().Add(ttl)}
+	if elem, ok := s.items[key]; ok {
+		elem.Value = item
+		s.order.MoveToFront(elem)
+		return
+	}
+	s.items[key] = s.order.PushFront(item)
+	for s.order.Len() > maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*memoryItem).key)
+	}
+}
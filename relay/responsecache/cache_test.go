@@ -0,0 +1,128 @@
+package responsecache
+
+import (
+	"context"
+	"testing"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Laisky/one-api/common"
+	"github.com/Laisky/one-api/common/config"
+	relaymodel "github.com/Laisky/one-api/relay/model"
+)
+
+func TestKey_NormalizesBody(t *testing.T) {
+	key, err := Key("default", "gpt-4o-2024-08-06", []byte(`{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`))
+	require.NoError(t, err)
+
+	// Key order, whitespace and the client-facing model name do not matter.
+	same, err := Key("default", "gpt-4o-2024-08-06", []byte(`{ "messages":[{"content":"hi","role":"user"}], "temperature":0, "model":"my-alias" }`))
+	require.NoError(t, err)
+	require.Equal(t, key, same)
+
+	for _, other := range []struct{ group, model, body string }{
+		{"vip", "gpt-4o-2024-08-06", `{"temperature":0,"messages":[{"role":"user","content":"hi"}]}`},
+		{"default", "gpt-4o-mini", `{"temperature":0,"messages":[{"role":"user","content":"hi"}]}`},
+		{"default", "gpt-4o-2024-08-06", `{"temperature":0,"messages":[{"role":"user","content":"hi"}],"stream":true}`},
+		{"default", "gpt-4o-2024-08-06", `{"temperature":0.0001,"messages":[{"role":"user","content":"hi"}]}`},
+	} {
+		differs, err := Key(other.group, other.model, []byte(other.body))
+		require.NoError(t, err)
+		require.NotEqual(t, key, differs, other)
+	}
+
+	_, err = Key("default", "gpt-4o", []byte(`not json`))
+	require.Error(t, err)
+}
+
+func useMemoryStore(t *testing.T) {
+	t.Helper()
+	originalRedisClient := common.RDB
+	originalMemory := memory
+	common.RDB = nil
+	memory = newMemoryStore()
+	t.Cleanup(func() {
+		common.RDB = originalRedisClient
+		memory = originalMemory
+	})
+}
+
+func TestMemoryStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	useMemoryStore(t)
+	originalMax := config.ResponseCacheMaxEntries
+	config.ResponseCacheMaxEntries = 2
+	t.Cleanup(func() { config.ResponseCacheMaxEntries = originalMax })
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b"} {
+		require.NoError(t, Set(ctx, key, &Entry{Body: []byte(key)}))
+	}
+	// Touch "a" so "b" becomes the eviction candidate.
+	entry, err := Get(ctx, "a")
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+
+	require.NoError(t, Set(ctx, "c", &Entry{Body: []byte("c")}))
+	entry, err = Get(ctx, "b")
+	require.NoError(t, err)
+	require.Nil(t, entry)
+	for _, key := range []string{"a", "c"} {
+		entry, err = Get(ctx, key)
+		require.NoError(t, err)
+		require.NotNil(t, entry, key)
+	}
+}
+
+func TestSet_SkipsOversizeEntries(t *testing.T) {
+	useMemoryStore(t)
+	originalMaxBytes := config.ResponseCacheMaxEntryBytes
+	config.ResponseCacheMaxEntryBytes = 4
+	t.Cleanup(func() { config.ResponseCacheMaxEntryBytes = originalMaxBytes })
+	ctx := context.Background()
+
+	require.NoError(t, Set(ctx, "big", &Entry{Body: []byte("12345")}))
+	entry, err := Get(ctx, "big")
+	require.NoError(t, err)
+	require.Nil(t, entry)
+}
+
+func TestRedisStore_RoundTrip(t *testing.T) {
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(redisServer.Close)
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { require.NoError(t, redisClient.Close()) })
+
+	originalRedisEnabled := common.IsRedisEnabled()
+	originalRedisClient := common.RDB
+	common.SetRedisEnabled(true)
+	common.RDB = redisClient
+	t.Cleanup(func() {
+		common.SetRedisEnabled(originalRedisEnabled)
+		common.RDB = originalRedisClient
+	})
+	ctx := context.Background()
+
+	entry, err := Get(ctx, "response_cache:missing")
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	stored := &Entry{
+		StatusCode:  200,
+		ContentType: "application/json",
+		Body:        []byte(`{"object":"list"}`),
+		Usage:       &relaymodel.Usage{PromptTokens: 8, TotalTokens: 8},
+	}
+	require.NoError(t, Set(ctx, "response_cache:k", stored))
+	require.Positive(t, redisServer.TTL("response_cache:k"))
+
+	entry, err = Get(ctx, "response_cache:k")
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	require.Equal(t, stored.Body, entry.Body)
+	require.Equal(t, "application/json", entry.ContentType)
+	require.Equal(t, 8, entry.Usage.PromptTokens)
+	require.NotZero(t, entry.CreatedAt)
+}
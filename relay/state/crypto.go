@@ -16,7 +16,8 @@ import (
 // KeyRing holds the versioned AES-256 keys used to encrypt state payloads before
 // they are written to Redis. Writes always use the newest key; reads try the key
 // named by the ciphertext's version prefix, so a rotation can proceed while old
-// records remain readable (SEC02).
+// records remain readable (SEC02). The same KeyRing also seals channel
+// credentials at rest with per-value data keys (see envelope.go).
 //
 // Keys come from RESPONSE_STATE_ENCRYPTION_KEYS, or — when that is unset — are
 // derived from an EXPLICITLY configured SESSION_SECRET (DeriveKeyRingFromSecret).
@@ -0,0 +1,183 @@
+package state
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// Envelope encryption for secrets stored at rest outside the state layer, such
+// as upstream channel credentials. Every sealed value gets its own random data
+// key. The value is encrypted with the data key, and the data key is wrapped by
+// the KeyRing's primary key. Rotating the KeyRing therefore only rewraps the
+// small data key; the payload ciphertext never has to be re-encrypted.
+
+// sealedPrefix marks a value produced by Seal. A value without it is legacy
+// plaintext.
+const sealedPrefix = "enc:v1:"
+
+// dataKeySize is the size of a per-value AES-256 data key.
+const dataKeySize = 32
+
+// newDataKeyGCM builds the AES-GCM AEAD of a per-value data key.
+func newDataKeyGCM(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "state: build data key cipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "state: build data key gcm")
+	}
+	return gcm, nil
+}
+
+// IsSealed reports whether value was produced by Seal.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// KeyVersion returns the KEK version that wrapped a sealed value, or "" for
+// plaintext.
+func KeyVersion(value string) string {
+	if !IsSealed(value) {
+		return ""
+	}
+	version, _, _ := strings.Cut(strings.TrimPrefix(value, sealedPrefix), ":")
+	return version
+}
+
+// Seal encrypts plaintext under a fresh data key wrapped by the primary key and
+// returns "enc:v1:<version>:<base64 wrapped key>:<base64 ciphertext>". An empty
+// plaintext stays empty.
+func (r *KeyRing) Seal(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	if r == nil || r.primary.gcm == nil {
+		return "", errors.New("state: key ring not initialized")
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", errors.Wrap(err, "state: generate data key")
+	}
+	dataGCM, err := newDataKeyGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	payload, err := sealAEAD(dataGCM, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return r.wrap(dataKey, payload)
+}
+
+// Open decrypts a sealed value. Legacy plaintext is returned unchanged, so
+// callers can read rows written before encryption was enabled.
+func (r *KeyRing) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	dataKey, payload, err := r.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	dataGCM, err := newDataKeyGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openAEAD(dataGCM, payload, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "state: decrypt value")
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap moves a value onto the primary key. A sealed value keeps its data key
+// and ciphertext and only gets its data key rewrapped; plaintext is sealed.
+// The bool reports whether the value changed.
+func (r *KeyRing) Rewrap(value string) (string, bool, error) {
+	if value == "" {
+		return value, false, nil
+	}
+	if r == nil || r.primary.gcm == nil {
+		return "", false, errors.New("state: key ring not initialized")
+	}
+	if !IsSealed(value) {
+		sealed, err := r.Seal(value)
+		return sealed, err == nil, err
+	}
+	if KeyVersion(value) == r.primary.version {
+		return value, false, nil
+	}
+	dataKey, payload, err := r.unwrap(value)
+	if err != nil {
+		return "", false, err
+	}
+	rewrapped, err := r.wrap(dataKey, payload)
+	return rewrapped, err == nil, err
+}
+
+// wrap seals dataKey under the primary key and formats the sealed value. The
+// key version is bound as additional data so it cannot be swapped.
+func (r *KeyRing) wrap(dataKey, payload []byte) (string, error) {
+	version := r.primary.version
+	wrapped, err := sealAEAD(r.primary.gcm, dataKey, []byte(version))
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + version + ":" +
+		base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// unwrap parses a sealed value and recovers its data key and payload.
+func (r *KeyRing) unwrap(value string) ([]byte, []byte, error) {
+	if r == nil {
+		return nil, nil, errors.New("state: key ring not initialized")
+	}
+	parts := strings.Split(strings.TrimPrefix(value, sealedPrefix), ":")
+	if len(parts) != 3 {
+		return nil, nil, errors.New("state: malformed sealed value")
+	}
+	entry, ok := r.byVer[parts[0]]
+	if !ok {
+		return nil, nil, errors.Errorf("state: unknown key version %q", parts[0])
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "state: decode wrapped data key")
+	}
+	payload, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "state: decode ciphertext")
+	}
+	dataKey, err := openAEAD(entry.gcm, wrapped, []byte(entry.version))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "state: unwrap data key")
+	}
+	return dataKey, payload, nil
+}
+
+// sealAEAD encrypts plaintext with a random nonce and returns nonce||ciphertext.
+func sealAEAD(gcm cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "state: read nonce")
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// openAEAD reverses sealAEAD.
+func openAEAD(gcm cipher.AEAD, payload, additional []byte) ([]byte, error) {
+	nonceSize := gcm.NonceSize()
+	if len(payload) < nonceSize {
+		return nil, errors.New("state: ciphertext too short")
+	}
+	return gcm.Open(nil, payload[:nonceSize], payload[nonceSize:], additional)
+}
@@ -0,0 +1,105 @@
+package state
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	envelopeKeyV1 = "v1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	envelopeKeyV2 = "v2:ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+func mustParseEnvelopeKeyRing(t *testing.T, spec string) *KeyRing {
+	t.Helper()
+	ring, err := ParseKeyRing(spec)
+	require.NoError(t, err)
+	return ring
+}
+
+func TestEnvelopeSealOpen(t *testing.T) {
+	ring := mustParseEnvelopeKeyRing(t, envelopeKeyV1)
+
+	sealed, err := ring.Seal("sk-upstream-secret")
+	require.NoError(t, err)
+	require.True(t, IsSealed(sealed))
+	require.Equal(t, "v1", KeyVersion(sealed))
+	require.NotContains(t, sealed, "sk-upstream-secret")
+
+	again, err := ring.Seal("sk-upstream-secret")
+	require.NoError(t, err)
+	require.NotEqual(t, sealed, again, "every seal uses a fresh data key and nonce")
+
+	plaintext, err := ring.Open(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "sk-upstream-secret", plaintext)
+
+	empty, err := ring.Seal("")
+	require.NoError(t, err)
+	require.Empty(t, empty)
+
+	legacy, err := ring.Open("sk-legacy")
+	require.NoError(t, err)
+	require.Equal(t, "sk-legacy", legacy)
+	require.Empty(t, KeyVersion("sk-legacy"))
+}
+
+func TestEnvelopeOpenRejectsTamperingAndUnknownKeys(t *testing.T) {
+	ring := mustParseEnvelopeKeyRing(t, envelopeKeyV1)
+	sealed, err := ring.Seal("sk-upstream-secret")
+	require.NoError(t, err)
+
+	_, err = mustParseEnvelopeKeyRing(t, envelopeKeyV2).Open(sealed)
+	require.ErrorContains(t, err, "unknown key version")
+
+	// Relabelling the value with another configured version must fail, since
+	// the version is bound to the wrapped data key.
+	relabelled := strings.Replace(sealed, sealedPrefix+"v1:", sealedPrefix+"v2:", 1)
+	_, err = mustParseEnvelopeKeyRing(t, envelopeKeyV2+","+envelopeKeyV1).Open(relabelled)
+	require.Error(t, err)
+
+	parts := strings.Split(sealed, ":")
+	payload := []byte(parts[len(parts)-1])
+	payload[len(payload)/2] ^= 'A' ^ 'B'
+	parts[len(parts)-1] = string(payload)
+	_, err = ring.Open(strings.Join(parts, ":"))
+	require.Error(t, err)
+
+	_, err = ring.Open(sealedPrefix + "v1:broken")
+	require.ErrorContains(t, err, "malformed")
+}
+
+func TestEnvelopeRewrap(t *testing.T) {
+	oldRing := mustParseEnvelopeKeyRing(t, envelopeKeyV1)
+	sealed, err := oldRing.Seal("sk-upstream-secret")
+	require.NoError(t, err)
+
+	ring := mustParseEnvelopeKeyRing(t, envelopeKeyV2+","+envelopeKeyV1)
+	rewrapped, changed, err := ring.Rewrap(sealed)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "v2", KeyVersion(rewrapped))
+	require.Equal(t, sealed[strings.LastIndex(sealed, ":"):], rewrapped[strings.LastIndex(rewrapped, ":"):],
+		"rewrapping keeps the payload ciphertext")
+
+	plaintext, err := mustParseEnvelopeKeyRing(t, envelopeKeyV2).Open(rewrapped)
+	require.NoError(t, err)
+	require.Equal(t, "sk-upstream-secret", plaintext)
+
+	same, changed, err := ring.Rewrap(rewrapped)
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Equal(t, rewrapped, same)
+
+	fromPlain, changed, err := ring.Rewrap("sk-legacy")
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "v2", KeyVersion(fromPlain))
+
+	empty, changed, err := ring.Rewrap("")
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Empty(t, empty)
+}
@@ -24,6 +24,7 @@ var ErrQuotaExceeded = errors.New("streaming quota exceeded")
 // initialize a streaming quota tracker.
 type QuotaTrackerParams struct {
 	UserID                 int
+	OrgID                  int // organization paying for the request; 0 when the user pays
 	TokenID                int
 	ChannelID              int
 	ModelName              string
@@ -224,7 +225,7 @@ func (t *QuotaTracker) flushLocked(force bool) error {
 		return err
 	}
 
-	if err := model.CacheDecreaseUserQuota(ctx, t.params.UserID, delta); err != nil {
+	if err := model.CacheDecreasePayerQuota(ctx, t.params.UserID, t.params.OrgID, delta); err != nil {
 		t.params.Logger.Warn("streaming quota tracker failed to update user cache",
 			append(t.userRef().Zap(), zap.Error(err))...)
 	}
@@ -255,7 +256,7 @@ func (t *QuotaTracker) ensureQuotaLocked(delta int64) error {
 	if delta <= 0 {
 		return nil
 	}
-	remaining, err := model.CacheGetUserQuota(t.params.Ctx, t.params.UserID)
+	remaining, err := model.CacheGetPayerQuota(t.params.Ctx, t.params.UserID, t.params.OrgID)
 	if err != nil {
 		return errors.Wrap(err, "get user quota during streaming flush")
 	}
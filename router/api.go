@@ -61,6 +61,11 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/topup/stripe", controller.CreateStripeCheckout)
 				selfRoute.GET("/topup/stripe/orders", controller.ListStripePaymentOrders)
 				selfRoute.GET("/topup/stripe/orders/:session_id", controller.GetStripePaymentOrder)
+				selfRoute.GET("/subscription", controller.GetSelfSubscription)
+				selfRoute.POST("/subscription/stripe", controller.CreateStripeSubscriptionCheckout)
+				selfRoute.POST("/subscription/stripe/portal", controller.CreateStripeBillingPortal)
+				selfRoute.GET("/statements/:month", controller.GetSelfStatement)
+				selfRoute.GET("/statements/:month/export", controller.ExportSelfStatement)
 				selfRoute.GET("/available_models", controller.GetUserAvailableModels)
 				selfRoute.GET("/totp/status", controller.GetTotpStatus)
 				selfRoute.GET("/totp/setup", controller.SetupTotp)
@@ -101,6 +106,9 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ListAllModels)
 			channelRoute.GET("/metadata", controller.GetChannelMetadata)
+			channelRoute.GET("/health", controller.GetChannelHealth)
+			channelRoute.GET("/secrets/reencrypt", middleware.RootAuth(), controller.GetChannelSecretStatus)
+			channelRoute.POST("/secrets/reencrypt", middleware.RootAuth(), controller.ReencryptChannelSecrets)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.GET("/test", controller.TestChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
@@ -108,6 +116,12 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
 			channelRoute.GET("/pricing/:id", controller.GetChannelPricing)
 			channelRoute.GET("/default-pricing", controller.GetChannelDefaultPricing)
+			channelRoute.GET("/:id/health", controller.GetChannelHealthById)
+			channelRoute.GET("/:id/keys", controller.GetChannelKeys)
+			channelRoute.GET("/:id/keys/:key_id/test", controller.TestChannelKey)
+			channelRoute.POST("/:id/keys", controller.AddChannelKeys)
+			channelRoute.PUT("/:id/keys/:key_id", controller.UpdateChannelKey)
+			channelRoute.DELETE("/:id/keys/:key_id", controller.DeleteChannelKey)
 			channelRoute.POST("/", controller.AddChannel)
 			channelRoute.POST("/:id/duplicate", controller.DuplicateChannel)
 			channelRoute.PUT("/", controller.UpdateChannel)
@@ -149,6 +163,30 @@ func SetApiRouter(router *gin.Engine) {
 			adminTokenRoute.GET("/search", controller.AdminSearchTokens)
 			adminTokenRoute.GET("/:id", controller.AdminGetToken)
 		}
+		orgRoute := apiRouter.Group("/organization")
+		orgRoute.Use(middleware.UserAuth())
+		{
+			orgRoute.GET("/", controller.GetOrganizations)
+			orgRoute.POST("/", controller.CreateOrganization)
+			orgRoute.GET("/:id", controller.GetOrganization)
+			orgRoute.PUT("/:id", controller.UpdateOrganization)
+			orgRoute.DELETE("/:id", controller.DeleteOrganization)
+			orgRoute.GET("/:id/members", controller.GetOrganizationMembers)
+			orgRoute.POST("/:id/members", controller.AddOrganizationMember)
+			orgRoute.PUT("/:id/members/:user_id", controller.UpdateOrganizationMember)
+			orgRoute.DELETE("/:id/members/:user_id", controller.RemoveOrganizationMember)
+			orgRoute.POST("/:id/quota", controller.TransferOrganizationQuota)
+			orgRoute.GET("/:id/tokens", controller.GetOrganizationTokens)
+			orgRoute.POST("/:id/tokens", controller.AddOrganizationToken)
+			orgRoute.DELETE("/:id/tokens/:token_id", controller.DeleteOrganizationToken)
+			orgRoute.GET("/:id/logs", controller.GetOrganizationLogs)
+			orgRoute.GET("/:id/logs/stat", controller.GetOrganizationLogsStat)
+			orgRoute.GET("/:id/statements/:month", controller.GetOrganizationStatement)
+			orgRoute.GET("/:id/statements/:month/export", controller.ExportOrganizationStatement)
+		}
+		// Site-wide organization administration lives outside the member-scoped group.
+		apiRouter.GET("/admin/organizations", middleware.AdminAuth(), controller.GetAllOrganizations)
+		apiRouter.POST("/admin/organizations/:id/topup", middleware.AdminAuth(), controller.TopUpOrganization)
 		costRoute := apiRouter.Group("/cost")
 		{
 			costRoute.GET("/request/:request_id", controller.GetRequestCost)
@@ -163,6 +201,12 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.PUT("/", controller.UpdateRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
+		statementRoute := apiRouter.Group("/statements")
+		statementRoute.Use(middleware.AdminAuth())
+		{
+			statementRoute.GET("/:month", controller.GetStatement)
+			statementRoute.GET("/:month/export", controller.ExportStatements)
+		}
 		logRoute := apiRouter.Group("/log")
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
@@ -179,6 +223,21 @@ func SetApiRouter(router *gin.Engine) {
 			traceRoute.GET("/log/:log_id", controller.GetTraceByLogId)
 			traceRoute.GET("/:trace_id", controller.GetTraceByTraceId)
 		}
+		// Request capture: time-boxed capture rules and the captured bodies.
+		captureRuleRoute := apiRouter.Group("/capture_rules")
+		captureRuleRoute.Use(middleware.AdminAuth())
+		{
+			captureRuleRoute.GET("/", controller.GetCaptureRules)
+			captureRuleRoute.POST("/", controller.CreateCaptureRule)
+			captureRuleRoute.DELETE("/:id", controller.DeleteCaptureRule)
+		}
+		captureRoute := apiRouter.Group("/captures")
+		captureRoute.Use(middleware.AdminAuth())
+		{
+			captureRoute.GET("/", controller.GetRequestCaptures)
+			captureRoute.GET("/:id", controller.GetRequestCapture)
+			captureRoute.POST("/:id/replay", controller.ReplayRequestCapture)
+		}
 		groupRoute := apiRouter.Group("/group")
 		groupRoute.Use(middleware.AdminAuth())
 		{
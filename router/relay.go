@@ -73,6 +73,7 @@ func SetRelayRouter(router *gin.Engine) {
 	relayV1Router.DELETE("/responses/:response_id", controller.RelayResponseDelete)
 	relayV1Router.POST("/responses/:response_id/cancel", controller.RelayResponseCancel)
 	relayV1Router.POST("/messages", controller.Relay)
+	relayV1Router.POST("/messages/count_tokens", controller.Relay)
 	relayV1Router.POST("/edits", controller.Relay)
 	relayV1Router.POST("/images/generations", controller.Relay)
 	relayV1Router.POST("/images/edits", controller.Relay)
@@ -90,11 +91,6 @@ func SetRelayRouter(router *gin.Engine) {
 	relayV1Router.POST("/audio/transcriptions", controller.Relay)
 	relayV1Router.POST("/audio/translations", controller.Relay)
 	relayV1Router.POST("/audio/speech", controller.Relay)
-	relayV1Router.GET("/files", controller.RelayNotImplemented)
-	relayV1Router.POST("/files", controller.RelayNotImplemented)
-	relayV1Router.DELETE("/files/:id", controller.RelayNotImplemented)
-	relayV1Router.GET("/files/:id", controller.RelayNotImplemented)
-	relayV1Router.GET("/files/:id/content", controller.RelayNotImplemented)
 	relayV1Router.POST("/fine_tuning/jobs", controller.RelayNotImplemented)
 	relayV1Router.GET("/fine_tuning/jobs", controller.RelayNotImplemented)
 	relayV1Router.GET("/fine_tuning/jobs/:id", controller.RelayNotImplemented)
@@ -153,11 +149,43 @@ func SetRelayRouter(router *gin.Engine) {
 	conversationsRouter.GET("/:conversation_id/items/:item_id", controller.RelayConversationItemGet)
 	conversationsRouter.DELETE("/:conversation_id/items/:item_id", controller.RelayConversationItemDelete)
 
+	// -------------------------------------
+	// Files and Batch APIs. Files are owner-scoped gateway storage and batch CRUD
+	// performs no upstream call, so neither enters channel distribution. Batch
+	// lines are executed later by the batch worker through the relay routes above.
+	batchAPIMws := []gin.HandlerFunc{
+		func(c *gin.Context) { done := graceful.BeginRequest(); defer done(); c.Next() },
+		middleware.RelayPanicRecover(),
+		middleware.TokenAuth(),
+	}
+	filesRouter := router.Group("/v1/files")
+	filesRouter.Use(batchAPIMws...)
+	filesRouter.POST("", controller.RelayFileUpload)
+	filesRouter.GET("", controller.RelayFileList)
+	filesRouter.GET("/:id", controller.RelayFileGet)
+	filesRouter.DELETE("/:id", controller.RelayFileDelete)
+	filesRouter.GET("/:id/content", controller.RelayFileContent)
+
+	batchesRouter := router.Group("/v1/batches")
+	batchesRouter.Use(batchAPIMws...)
+	batchesRouter.POST("", controller.RelayBatchCreate)
+	batchesRouter.GET("", controller.RelayBatchList)
+	batchesRouter.GET("/:id", controller.RelayBatchGet)
+	batchesRouter.POST("/:id/cancel", controller.RelayBatchCancel)
+
 	// -------------------------------------
 	relayV2Router := router.Group("/v2")
 	relayV2Router.Use(relayMws...)
 	relayV2Router.POST("/rerank", controller.Relay)
 
+	// -------------------------------------
+	// Gemini-native endpoints for Google GenAI SDK clients:
+	// /v1beta/models/{model}:generateContent, :streamGenerateContent,
+	// :countTokens and :embedContent. The action is parsed from the path.
+	relayGeminiRouter := router.Group("/v1beta")
+	relayGeminiRouter.Use(relayMws...)
+	relayGeminiRouter.POST("/models/:model_action", controller.Relay)
+
 	// -------------------------------------
 	// Zhipu-compatible OCR endpoint: /api/paas/v4/layout_parsing
 	relayZhipuRouter := router.Group("/api/paas/v4")
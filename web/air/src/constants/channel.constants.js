@@ -38,6 +38,7 @@ export const CHANNEL_OPTIONS = [
   { key: 55, text: 'NVIDIA', value: 55, color: 'green' },
   { key: 56, text: 'Cerebras', value: 56, color: 'orange' },
   { key: 57, text: 'DeepInfra', value: 57, color: 'purple' },
+  { key: 58, text: 'Mock', value: 58, color: 'grey' },
   { key: 42, text: 'VertexAI', value: 42, color: 'blue' },
   { key: 43, text: 'Proxy', value: 43, color: 'blue' },
   { key: 44, text: 'SiliconFlow', value: 44, color: 'blue' },
@@ -0,0 +1,16 @@
+import { describe, expect, it } from 'vitest';
+
+import { CHANNEL_TYPES, CHANNEL_TYPE_LABELS } from '../constants';
+
+describe('Mock channel metadata', () => {
+  it('registers channel type 58 in the create dropdown and label map', () => {
+    const channel = CHANNEL_TYPES.find((candidate) => candidate.value === 58);
+
+    expect(channel).toMatchObject({
+      key: 58,
+      text: 'Mock',
+      value: 58,
+    });
+    expect(CHANNEL_TYPE_LABELS[58]).toEqual({ name: 'Mock', color: 'gray' });
+  });
+});
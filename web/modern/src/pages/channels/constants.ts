@@ -293,6 +293,14 @@ export const CHANNEL_TYPES: ChannelType[] = [
     description:
       'DeepInfra serverless inference; OpenAI-compatible chat, completions, embeddings, images, and audio, plus rerank and native Anthropic Messages.',
   },
+  {
+    key: 58,
+    text: 'Mock',
+    value: 58,
+    color: 'gray',
+    description:
+      'Answers inside the gateway without calling a provider; mimics OpenAI, Claude or Gemini responses and injects faults for offline testing.',
+  },
   {
     key: 42,
     text: 'VertexAI',